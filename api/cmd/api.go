@@ -0,0 +1,347 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/credstack/credstack/sdk/pkg/approval"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/resourceserver"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// errApiMissingId - Returned when a resource server is created without a name or an audience
+var errApiMissingId = errors.New("a name and an audience are required. Pass --name and --audience, or set them in the definition file")
+
+// apiCmd represents the api command
+var apiCmd = &cobra.Command{
+	Use:   "api",
+	Short: "Perform operations on resource servers",
+	Long: `Allows you to create and manage resource servers (the APIs tokens are issued for) directly through the credstack
+database, so that applications can be bootstrapped without the management API.`,
+}
+
+// apiCreateCmd represents the api create command
+var apiCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new resource server",
+	Long: `Creates a new resource server, along with a signing key for its audience.
+
+The resource server can be defined with flags, or with a YAML or JSON file passed with '--file' for repeatable
+provisioning. Flags that are passed override the values in the file. For example:
+
+  name: Billing API
+  audience: https://billing.example.com
+  token_type: RS256
+  enforce_rbac: true
+  claims_profile: standard
+
+If no token type is defined, then tokens for the resource server are signed with HS256.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		definition, err := newApiDefinition(cmd)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when reading API definition", err)
+		}
+
+		serv := server.New(globalConfig)
+
+		err = serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		created, err := createApi(serv, definition)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when creating API", err)
+		}
+
+		out := newApiOutput(created)
+
+		render(out, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "Audience:\t%s\n", out.Audience)
+			fmt.Fprintf(tw, "Name:\t%s\n", out.Name)
+			fmt.Fprintf(tw, "Token type:\t%s\n", out.TokenType)
+			fmt.Fprintf(tw, "Enforce RBAC:\t%t\n", out.EnforceRBAC)
+			fmt.Fprintf(tw, "Claims profile:\t%s\n", out.ClaimsProfile)
+			_ = tw.Flush()
+		})
+	},
+}
+
+// apiListCmd represents the api list command
+var apiListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List resource servers",
+	Long:  `Lists the resource servers stored in the credstack database, up to the number passed with '--limit'.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		serv := server.New(globalConfig)
+
+		err := serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		apis, err := resourceserver.List(serv, limit)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when listing APIs", err)
+		}
+
+		if limit > 0 && len(apis) > limit {
+			apis = apis[:limit]
+		}
+
+		out := apiListOutput{Apis: make([]apiOutput, 0, len(apis))}
+		for _, api := range apis {
+			out.Apis = append(out.Apis, newApiOutput(api))
+		}
+
+		render(out, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "AUDIENCE\tNAME\tTOKEN TYPE\tRBAC\tCLAIMS PROFILE")
+
+			for _, api := range out.Apis {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\n", api.Audience, api.Name, api.TokenType, api.EnforceRBAC, api.ClaimsProfile)
+			}
+
+			_ = tw.Flush()
+		})
+	},
+}
+
+// apiDeleteCmd represents the api delete command
+var apiDeleteCmd = &cobra.Command{
+	Use:   "delete <audience>",
+	Short: "Delete a resource server",
+	Long: `Permanently deletes the resource server with the audience provided, along with its scopes. Tokens can no longer
+be issued for it, so you are asked to confirm it first. Pass '--yes' to skip the confirmation, for use in scripts.
+
+The signing keys of the audience are kept, so that tokens that were already issued for it can still be validated.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		err := confirm(fmt.Sprintf("Permanently delete the API %s?", args[0]), yes)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when confirming deletion", err)
+		}
+
+		if requestApproval(approval.ActionResourceServerDelete, args[0]) {
+			return
+		}
+
+		serv := server.New(globalConfig)
+
+		err = serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		err = resourceserver.Delete(serv, args[0])
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when deleting API", err)
+		}
+
+		out := apiActionOutput{Audience: args[0], Action: "deleted"}
+
+		render(out, func(w io.Writer) {
+			fmt.Fprintf(w, "API %s: deleted\n", out.Audience)
+		})
+	},
+}
+
+/*
+apiDefinition - The definition of a resource server read by the api create command, from its flags or from the file
+passed with --file. Fields use the same names as the management API
+*/
+type apiDefinition struct {
+	// Name - The name of the resource server
+	Name string `json:"name" yaml:"name"`
+
+	// Audience - The audience of tokens issued for the resource server
+	Audience string `json:"audience" yaml:"audience"`
+
+	// TokenType - The algorithm tokens for the resource server are signed with. Can be: HS256 (default), RS256
+	TokenType string `json:"token_type" yaml:"token_type"`
+
+	// EnforceRBAC - If set to true, then tokens issued on behalf of users are narrowed to the scopes granted to them
+	EnforceRBAC bool `json:"enforce_rbac" yaml:"enforce_rbac"`
+
+	// ClaimsProfile - Determines which user claims are inserted into access tokens. Can be: minimal (default), standard, full
+	ClaimsProfile string `json:"claims_profile" yaml:"claims_profile"`
+}
+
+/*
+newApiDefinition - Builds the definition of the resource server to create from the file passed with --file, if any, and
+then from the flags that were passed, which override the values in the file. The token type and claims profile are
+validated here, as resourceserver.New silently replaces an unknown token type with HS256
+*/
+func newApiDefinition(cmd *cobra.Command) (*apiDefinition, error) {
+	definition := new(apiDefinition)
+
+	file, _ := cmd.Flags().GetString("file")
+	if file != "" {
+		err := readDefinition(file, definition)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	flags := cmd.Flags()
+
+	if flags.Changed("name") {
+		definition.Name, _ = flags.GetString("name")
+	}
+
+	if flags.Changed("audience") {
+		definition.Audience, _ = flags.GetString("audience")
+	}
+
+	if flags.Changed("token-type") {
+		definition.TokenType, _ = flags.GetString("token-type")
+	}
+
+	if flags.Changed("enforce-rbac") {
+		definition.EnforceRBAC, _ = flags.GetBool("enforce-rbac")
+	}
+
+	if flags.Changed("claims-profile") {
+		definition.ClaimsProfile, _ = flags.GetString("claims-profile")
+	}
+
+	if definition.Name == "" || definition.Audience == "" {
+		return nil, errApiMissingId
+	}
+
+	if definition.TokenType != "" && !slices.Contains(resourceserver.TokenTypes, definition.TokenType) {
+		return nil, fmt.Errorf("%q is not one of: %s", definition.TokenType, strings.Join(resourceserver.TokenTypes, ", "))
+	}
+
+	if definition.ClaimsProfile != "" && !slices.Contains(claim.Profiles, definition.ClaimsProfile) {
+		return nil, resourceserver.ErrUnknownClaimsProfile
+	}
+
+	return definition, nil
+}
+
+/*
+createApi - Creates the resource server described by the definition provided in the parameter, and returns it. Fields
+that resourceserver.New does not accept are applied afterward with resourceserver.Update
+*/
+func createApi(serv *server.Server, definition *apiDefinition) (*resourceserver.ResourceServer, error) {
+	err := resourceserver.New(serv, definition.Name, definition.Audience, definition.TokenType)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := resourceserver.Get(serv, definition.Audience)
+	if err != nil {
+		return nil, err
+	}
+
+	if !definition.EnforceRBAC && definition.ClaimsProfile == "" {
+		return created, nil
+	}
+
+	/*
+		Update always writes the token type and EnforceRBAC, so the token type the resource server was created with has
+		to be passed along with the patch
+	*/
+	err = resourceserver.Update(serv, definition.Audience, &resourceserver.ResourceServer{
+		TokenType:     created.TokenType,
+		EnforceRBAC:   definition.EnforceRBAC,
+		ClaimsProfile: definition.ClaimsProfile,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resourceserver.Get(serv, definition.Audience)
+}
+
+/*
+apiOutput - A resource server in the output of the api create and api list commands in the json and yaml output formats
+*/
+type apiOutput struct {
+	// Audience - The audience of tokens issued for the resource server
+	Audience string `json:"audience" yaml:"audience"`
+
+	// Name - The name of the resource server
+	Name string `json:"name" yaml:"name"`
+
+	// TokenType - The algorithm tokens for the resource server are signed with
+	TokenType string `json:"token_type" yaml:"token_type"`
+
+	// EnforceRBAC - Whether tokens issued on behalf of users are narrowed to the scopes granted to them
+	EnforceRBAC bool `json:"enforce_rbac" yaml:"enforce_rbac"`
+
+	// ClaimsProfile - Which user claims are inserted into access tokens
+	ClaimsProfile string `json:"claims_profile" yaml:"claims_profile"`
+}
+
+/*
+apiListOutput - The output of the api list command in the json and yaml output formats
+*/
+type apiListOutput struct {
+	// Apis - The resource servers that were listed
+	Apis []apiOutput `json:"apis" yaml:"apis"`
+}
+
+/*
+apiActionOutput - The output of the api delete command in the json and yaml output formats
+*/
+type apiActionOutput struct {
+	// Audience - The audience of the resource server that was changed
+	Audience string `json:"audience" yaml:"audience"`
+
+	// Action - The change that was made. One of: deleted
+	Action string `json:"action" yaml:"action"`
+}
+
+/*
+newApiOutput - Converts the resource server provided in the parameter into its apiOutput
+*/
+func newApiOutput(api *resourceserver.ResourceServer) apiOutput {
+	return apiOutput{
+		Audience:      api.Audience,
+		Name:          api.Name,
+		TokenType:     api.TokenType,
+		EnforceRBAC:   api.EnforceRBAC,
+		ClaimsProfile: api.ClaimsProfile,
+	}
+}
+
+func init() {
+	apiCreateCmd.Flags().StringP("file", "f", "", "A YAML or JSON file defining the API. Pass - to read it from stdin")
+	apiCreateCmd.Flags().String("name", "", "The name of the API")
+	apiCreateCmd.Flags().String("audience", "", "The audience of tokens issued for the API (https://api.example.com)")
+	apiCreateCmd.Flags().String("token-type", "", "The algorithm tokens for the API are signed with. Can be one of: HS256, RS256")
+	apiCreateCmd.Flags().Bool("enforce-rbac", false, "Narrow tokens issued on behalf of users to the scopes granted to them")
+	apiCreateCmd.Flags().String("claims-profile", "", "Which user claims are inserted into access tokens. Can be one of: minimal, standard, full")
+	apiListCmd.Flags().Int("limit", 10, "The maximum number of APIs to list")
+	apiDeleteCmd.Flags().BoolP("yes", "y", false, "Delete the API without asking for confirmation")
+
+	apiCmd.AddCommand(apiCreateCmd)
+	apiCmd.AddCommand(apiListCmd)
+	apiCmd.AddCommand(apiDeleteCmd)
+	rootCmd.AddCommand(apiCmd)
+}
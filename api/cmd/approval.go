@@ -0,0 +1,75 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/approval"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+/*
+approvalOutput - The output of a command whose action requires approval from a second admin (see
+ApprovalConfig.RequiredActions). The action is not executed, and a pending approval is requested instead
+*/
+type approvalOutput struct {
+	// Approval - The identifier of the pending approval. A second admin approves it with POST /approval/approve?id=
+	Approval string `json:"approval" yaml:"approval"`
+
+	// Action - The action that requires approval (client.delete, key.rotate)
+	Action string `json:"action" yaml:"action"`
+
+	// Target - The object the action is executed against once it is approved
+	Target string `json:"target" yaml:"target"`
+
+	// RequestedBy - The actor the approval was requested under
+	RequestedBy string `json:"requested_by" yaml:"requested_by"`
+
+	// ExpiresAt - A unix timestamp representing when the approval can no longer be approved
+	ExpiresAt int64 `json:"expires_at" yaml:"expires_at"`
+}
+
+/*
+requestApproval - Requests approval for the action provided in the parameter if it requires approval, and renders the
+pending approval. True is returned if approval was requested, in which case the calling command must return without
+executing the action. Otherwise, false is returned and nothing is written, so that the command can execute the action
+*/
+func requestApproval(action string, target string) bool {
+	if !globalConfig.ApprovalConfig.Required(action) {
+		return false
+	}
+
+	serv := server.New(globalConfig)
+
+	err := serv.Start()
+	if err != nil {
+		exitWithError(exitFailure, "Fatal error when connecting to database", err)
+	}
+
+	pending, err := approval.Request(serv, action, target, cliActor())
+	_ = serv.Stop()
+
+	if err != nil {
+		exitWithError(exitFailure, "Fatal error when requesting approval", err)
+	}
+
+	out := approvalOutput{
+		Approval:    pending.Header.Identifier,
+		Action:      pending.Action,
+		Target:      pending.Target,
+		RequestedBy: pending.RequestedBy,
+		ExpiresAt:   pending.ExpiresAt,
+	}
+
+	render(out, func(w io.Writer) {
+		fmt.Fprintf(w, "%s %s requires approval from a second admin\n", out.Action, out.Target)
+		fmt.Fprintf(w, "Approval:  %s\nExpires:   %s\n", out.Approval, time.Unix(out.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	})
+
+	return true
+}
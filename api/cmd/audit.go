@@ -0,0 +1,94 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/credstack/credstack/sdk/pkg/audit"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Perform operations on the audit log",
+	Long:  `Allows you to inspect and verify the audit log stored in the credstack database.`,
+}
+
+// auditVerifyCmd represents the audit verify command
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the integrity of the audit log",
+	Long: `Walks the entire audit log and verifies that no records have been modified, inserted, or removed. Each record
+is checked against the hash stored in it and the hash stored in the record after it. If batch signing is enabled, every
+batch signature is also verified against the public key it was signed with.
+
+Exits with status code 2 if tampering is detected, and 1 if the audit log could not be verified.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		serv := server.New(globalConfig)
+
+		err := serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		result, err := audit.Verify(serv)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when verifying audit log", err)
+		}
+
+		out := auditVerifyOutput{
+			Valid:          result.Valid(),
+			Records:        result.Records,
+			Signatures:     result.Signatures,
+			BrokenSequence: result.BrokenSequence,
+			Reason:         result.Reason,
+		}
+
+		render(out, func(w io.Writer) {
+			if !out.Valid {
+				fmt.Fprintf(w, "Audit log verification FAILED at sequence %d: %s\n", out.BrokenSequence, out.Reason)
+				return
+			}
+
+			fmt.Fprintf(w, "Audit log verified successfully (%d records, %d signed batches)\n", out.Records, out.Signatures)
+		})
+
+		if !out.Valid {
+			os.Exit(exitCheckFailed)
+		}
+	},
+}
+
+/*
+auditVerifyOutput - The output of 'audit verify' in the json and yaml output formats
+*/
+type auditVerifyOutput struct {
+	// Valid - Set if no tampering was detected
+	Valid bool `json:"valid" yaml:"valid"`
+
+	// Records - The number of records that were verified
+	Records int64 `json:"records" yaml:"records"`
+
+	// Signatures - The number of batch signatures that were verified
+	Signatures int64 `json:"signatures" yaml:"signatures"`
+
+	// BrokenSequence - The sequence of the first record that failed verification. 0 if the audit log is intact
+	BrokenSequence int64 `json:"broken_sequence" yaml:"broken_sequence"`
+
+	// Reason - Why verification failed. Empty if the audit log is intact
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+func init() {
+	auditCmd.AddCommand(auditVerifyCmd)
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,455 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/credstack/credstack/sdk/pkg/approval"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// errClientMissingName - Returned when a client is created without a name in its definition or in --name
+var errClientMissingName = errors.New("a name is required. Pass --name, or set name in the definition file")
+
+// clientCmd represents the client command
+var clientCmd = &cobra.Command{
+	Use:   "client",
+	Short: "Perform operations on OAuth clients",
+	Long: `Allows you to create and manage OAuth clients directly through the credstack database, so that applications can
+be bootstrapped without the management API.`,
+}
+
+// clientCreateCmd represents the client create command
+var clientCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new client",
+	Long: `Creates a new client and prints its client ID and client secret. The client secret of a confidential client is
+only printed here and by 'client rotate-secret', so store it somewhere safe.
+
+The client can be defined with flags, or with a YAML or JSON file passed with '--file' for repeatable provisioning. Flags
+that are passed override the values in the file. For example:
+
+  name: billing-worker
+  is_public: false
+  grant_types: [client_credentials]
+  allowed_audiences: [https://billing.example.com]
+  token_lifetime: 3600
+
+The file uses the same field names as the management API, and the fields it supports are listed in docs/cli.md. If no
+grant types are defined, then the client is created with the authorization_code grant type.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		definition, err := newClientDefinition(cmd)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when reading client definition", err)
+		}
+
+		serv := server.New(globalConfig)
+
+		err = serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		app, err := createClient(serv, definition)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when creating client", err)
+		}
+
+		out := newClientOutput(app, true)
+
+		render(out, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "Client ID:\t%s\n", out.ClientId)
+			if out.ClientSecret != "" {
+				fmt.Fprintf(tw, "Client secret:\t%s\n", out.ClientSecret)
+			}
+			fmt.Fprintf(tw, "Name:\t%s\n", out.Name)
+			fmt.Fprintf(tw, "Type:\t%s\n", clientType(out.IsPublic))
+			fmt.Fprintf(tw, "Grant types:\t%s\n", strings.Join(out.GrantTypes, ", "))
+			fmt.Fprintf(tw, "Audiences:\t%s\n", strings.Join(out.AllowedAudiences, ", "))
+			_ = tw.Flush()
+		})
+	},
+}
+
+// clientListCmd represents the client list command
+var clientListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List clients",
+	Long: `Lists the clients stored in the credstack database, up to the number passed with '--limit'. Client secrets are
+never listed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		serv := server.New(globalConfig)
+
+		err := serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		apps, err := client.List(serv, limit, false)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when listing clients", err)
+		}
+
+		out := clientListOutput{Clients: make([]clientOutput, 0, len(apps))}
+		for _, app := range apps {
+			out.Clients = append(out.Clients, newClientOutput(app, false))
+		}
+
+		render(out, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "CLIENT ID\tNAME\tTYPE\tGRANT TYPES\tAUDIENCES")
+
+			for _, app := range out.Clients {
+				fmt.Fprintf(
+					tw,
+					"%s\t%s\t%s\t%s\t%s\n",
+					app.ClientId,
+					app.Name,
+					clientType(app.IsPublic),
+					strings.Join(app.GrantTypes, ","),
+					strings.Join(app.AllowedAudiences, ","),
+				)
+			}
+
+			_ = tw.Flush()
+		})
+	},
+}
+
+// clientRotateSecretCmd represents the client rotate-secret command
+var clientRotateSecretCmd = &cobra.Command{
+	Use:   "rotate-secret <client_id>",
+	Short: "Replace the client secret of a client",
+	Long: `Replaces the client secret of the client with the client ID provided with a newly generated one, and prints it.
+The previous secret stops working immediately, so you are asked to confirm it first. Pass '--yes' to skip the
+confirmation, for use in scripts.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		err := confirm(fmt.Sprintf("Replace the client secret of %s? The current secret stops working immediately.", args[0]), yes)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when confirming rotation", err)
+		}
+
+		serv := server.New(globalConfig)
+
+		err = serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		clientSecret, err := client.RotateSecret(serv, args[0])
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when rotating client secret", err)
+		}
+
+		out := clientActionOutput{ClientId: args[0], Action: "secret_rotated", ClientSecret: clientSecret}
+
+		render(out, func(w io.Writer) {
+			fmt.Fprintf(w, "Client ID:     %s\nClient secret: %s\n", out.ClientId, out.ClientSecret)
+		})
+	},
+}
+
+// clientDeleteCmd represents the client delete command
+var clientDeleteCmd = &cobra.Command{
+	Use:   "delete <client_id>",
+	Short: "Delete a client",
+	Long: `Permanently deletes the client with the client ID provided. Tokens can no longer be issued to it, so you are
+asked to confirm it first. Pass '--yes' to skip the confirmation, for use in scripts.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		err := confirm(fmt.Sprintf("Permanently delete the client %s?", args[0]), yes)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when confirming deletion", err)
+		}
+
+		if requestApproval(approval.ActionClientDelete, args[0]) {
+			return
+		}
+
+		serv := server.New(globalConfig)
+
+		err = serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		err = client.Delete(serv, args[0])
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when deleting client", err)
+		}
+
+		out := clientActionOutput{ClientId: args[0], Action: "deleted"}
+
+		render(out, func(w io.Writer) {
+			fmt.Fprintf(w, "Client %s: deleted\n", out.ClientId)
+		})
+	},
+}
+
+/*
+clientDefinition - The definition of a client read by the client create command, from its flags or from the file passed
+with --file. Fields use the same names as the management API
+*/
+type clientDefinition struct {
+	// Name - The name of the client
+	Name string `json:"name" yaml:"name"`
+
+	// IsPublic - If set to true, then the client is created as a public client
+	IsPublic bool `json:"is_public" yaml:"is_public"`
+
+	// GrantTypes - The grant types the client is allowed to issue tokens under
+	GrantTypes []string `json:"grant_types" yaml:"grant_types"`
+
+	// RedirectURI - The redirect URI for post-authentication
+	RedirectURI string `json:"redirect_uri" yaml:"redirect_uri"`
+
+	// TokenLifetime - The amount of time in seconds that tokens issued to the client are valid for
+	TokenLifetime uint64 `json:"token_lifetime" yaml:"token_lifetime"`
+
+	// RefreshTokenLifetime - The amount of time in seconds that refresh tokens issued to the client are valid for
+	RefreshTokenLifetime uint64 `json:"refresh_token_lifetime" yaml:"refresh_token_lifetime"`
+
+	// AllowedAudiences - The audiences of the resource servers the client can issue tokens for
+	AllowedAudiences []string `json:"allowed_audiences" yaml:"allowed_audiences"`
+
+	// Capabilities - The capabilities granted to the client (can_introspect, can_revoke)
+	Capabilities []string `json:"capabilities" yaml:"capabilities"`
+
+	// ResponseTypes - The response types the client can request at the authorization endpoint
+	ResponseTypes []string `json:"response_types" yaml:"response_types"`
+
+	// IdTokenSignedResponseAlg - The algorithm ID tokens issued to the client are signed with
+	IdTokenSignedResponseAlg string `json:"id_token_signed_response_alg" yaml:"id_token_signed_response_alg"`
+
+	// PostLogoutRedirectURIs - The URIs the user agent can be redirected to after the client initiates a logout
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris" yaml:"post_logout_redirect_uris"`
+
+	// AllowedOrigins - The origins browsers can call the browser facing endpoints from on behalf of the client
+	AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins"`
+
+	// RefreshTokenCookie - If set to true, then refresh tokens are delivered in an HttpOnly cookie
+	RefreshTokenCookie bool `json:"refresh_token_cookie" yaml:"refresh_token_cookie"`
+
+	// DefaultScopes - The scopes a token is issued with when the client requests no scope
+	DefaultScopes []string `json:"default_scopes" yaml:"default_scopes"`
+
+	// ForcedScopes - The scopes that are always appended to the scopes the client requests
+	ForcedScopes []string `json:"forced_scopes" yaml:"forced_scopes"`
+}
+
+/*
+newClientDefinition - Builds the definition of the client to create from the file passed with --file, if any, and then
+from the flags that were passed, which override the values in the file
+*/
+func newClientDefinition(cmd *cobra.Command) (*clientDefinition, error) {
+	definition := new(clientDefinition)
+
+	file, _ := cmd.Flags().GetString("file")
+	if file != "" {
+		err := readDefinition(file, definition)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	flags := cmd.Flags()
+
+	if flags.Changed("name") {
+		definition.Name, _ = flags.GetString("name")
+	}
+
+	if flags.Changed("public") {
+		definition.IsPublic, _ = flags.GetBool("public")
+	}
+
+	if flags.Changed("grant-type") {
+		definition.GrantTypes, _ = flags.GetStringSlice("grant-type")
+	}
+
+	if flags.Changed("audience") {
+		definition.AllowedAudiences, _ = flags.GetStringSlice("audience")
+	}
+
+	if flags.Changed("redirect-uri") {
+		definition.RedirectURI, _ = flags.GetString("redirect-uri")
+	}
+
+	if definition.Name == "" {
+		return nil, errClientMissingName
+	}
+
+	return definition, nil
+}
+
+/*
+createClient - Creates the client described by the definition provided in the parameter, and returns it along with its
+client secret. Fields that client.New does not accept are applied afterward with client.Update. If they cannot be
+applied, then the client is deleted again, so that a failed provisioning run does not leave a partially configured
+client behind
+*/
+func createClient(serv *server.Server, definition *clientDefinition) (*client.Client, error) {
+	clientId, err := client.New(serv, definition.Name, definition.IsPublic, definition.GrantTypes...)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := &client.Client{
+		RedirectURI:              definition.RedirectURI,
+		TokenLifetime:            definition.TokenLifetime,
+		RefreshTokenLifetime:     definition.RefreshTokenLifetime,
+		AllowedAudiences:         definition.AllowedAudiences,
+		Capabilities:             definition.Capabilities,
+		ResponseTypes:            definition.ResponseTypes,
+		IdTokenSignedResponseAlg: definition.IdTokenSignedResponseAlg,
+		PostLogoutRedirectURIs:   definition.PostLogoutRedirectURIs,
+		AllowedOrigins:           definition.AllowedOrigins,
+		RefreshTokenCookie:       definition.RefreshTokenCookie,
+		DefaultScopes:            definition.DefaultScopes,
+		ForcedScopes:             definition.ForcedScopes,
+	}
+
+	if !reflect.DeepEqual(patch, &client.Client{}) {
+		err = client.Update(serv, clientId, patch)
+		if err != nil {
+			_ = client.Delete(serv, clientId)
+			return nil, err
+		}
+	}
+
+	return client.Get(serv, clientId, true)
+}
+
+/*
+clientOutput - A client in the output of the client create and client list commands in the json and yaml output formats
+*/
+type clientOutput struct {
+	// ClientId - The client ID of the client
+	ClientId string `json:"client_id" yaml:"client_id"`
+
+	// ClientSecret - The client secret of the client. Only set by client create, for confidential clients
+	ClientSecret string `json:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+
+	// Name - The name of the client
+	Name string `json:"name" yaml:"name"`
+
+	// IsPublic - Whether the client is a public client
+	IsPublic bool `json:"is_public" yaml:"is_public"`
+
+	// GrantTypes - The grant types the client is allowed to issue tokens under
+	GrantTypes []string `json:"grant_types" yaml:"grant_types"`
+
+	// AllowedAudiences - The audiences of the resource servers the client can issue tokens for
+	AllowedAudiences []string `json:"allowed_audiences" yaml:"allowed_audiences"`
+
+	// RedirectURI - The redirect URI of the client. Empty if it has not been set
+	RedirectURI string `json:"redirect_uri" yaml:"redirect_uri"`
+}
+
+/*
+clientListOutput - The output of the client list command in the json and yaml output formats
+*/
+type clientListOutput struct {
+	// Clients - The clients that were listed
+	Clients []clientOutput `json:"clients" yaml:"clients"`
+}
+
+/*
+clientActionOutput - The output of the client rotate-secret and client delete commands in the json and yaml output
+formats
+*/
+type clientActionOutput struct {
+	// ClientId - The client ID of the client that was changed
+	ClientId string `json:"client_id" yaml:"client_id"`
+
+	// Action - The change that was made. One of: secret_rotated, deleted
+	Action string `json:"action" yaml:"action"`
+
+	// ClientSecret - The new client secret. Only set for secret_rotated
+	ClientSecret string `json:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+}
+
+/*
+newClientOutput - Converts the client provided in the parameter into its clientOutput. The client secret is only included
+if withSecret is set and the client is confidential
+*/
+func newClientOutput(app *client.Client, withSecret bool) clientOutput {
+	out := clientOutput{
+		ClientId:         app.ClientId,
+		Name:             app.Name,
+		IsPublic:         app.IsPublic,
+		GrantTypes:       app.GrantTypes,
+		AllowedAudiences: app.AllowedAudiences,
+		RedirectURI:      app.RedirectURI,
+	}
+
+	if withSecret && !app.IsPublic {
+		out.ClientSecret = app.ClientSecret
+	}
+
+	if out.GrantTypes == nil {
+		out.GrantTypes = []string{}
+	}
+
+	if out.AllowedAudiences == nil {
+		out.AllowedAudiences = []string{}
+	}
+
+	return out
+}
+
+/*
+clientType - Returns the type of client displayed in the table output format
+*/
+func clientType(isPublic bool) string {
+	if isPublic {
+		return "public"
+	}
+
+	return "confidential"
+}
+
+func init() {
+	clientCreateCmd.Flags().StringP("file", "f", "", "A YAML or JSON file defining the client. Pass - to read it from stdin")
+	clientCreateCmd.Flags().String("name", "", "The name of the client")
+	clientCreateCmd.Flags().Bool("public", false, "Create a public client, which cannot keep a client secret")
+	clientCreateCmd.Flags().StringSlice("grant-type", []string{}, "The grant types the client is allowed to use. Defaults to authorization_code")
+	clientCreateCmd.Flags().StringSlice("audience", []string{}, "The audiences of the resource servers the client can issue tokens for")
+	clientCreateCmd.Flags().String("redirect-uri", "", "The redirect URI of the client")
+	clientListCmd.Flags().Int("limit", 10, "The maximum number of clients to list")
+	clientRotateSecretCmd.Flags().BoolP("yes", "y", false, "Rotate the client secret without asking for confirmation")
+	clientDeleteCmd.Flags().BoolP("yes", "y", false, "Delete the client without asking for confirmation")
+
+	clientCmd.AddCommand(clientCreateCmd)
+	clientCmd.AddCommand(clientListCmd)
+	clientCmd.AddCommand(clientRotateSecretCmd)
+	clientCmd.AddCommand(clientDeleteCmd)
+	rootCmd.AddCommand(clientCmd)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"go.yaml.in/yaml/v3"
+)
+
+/*
+readDefinition - Reads a definition file passed with --file into the value provided in the parameter. Definitions are
+decoded as YAML, and as JSON is a subset of YAML, JSON files are read the same way. Fields that the value does not define
+are rejected, so that typos are not silently ignored. Pass '-' to read the definition from stdin
+*/
+func readDefinition(path string, value any) error {
+	var (
+		data []byte
+		err  error
+	)
+
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(value)
+	if err == io.EOF {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/credstack/credstack/sdk/pkg/doctor"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// statusColors - The ANSI color each status is printed in by the table output
+var statusColors = map[doctor.Status]string{
+	doctor.StatusPass: "\033[32m",
+	doctor.StatusWarn: "\033[33m",
+	doctor.StatusFail: "\033[31m",
+	doctor.StatusSkip: "\033[90m",
+}
+
+/*
+useColor - Determines if the table output should be colored. Color is only used when stdout is a terminal, and can be
+disabled by setting NO_COLOR (https://no-color.org)
+*/
+func useColor() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose common problems with a credstack deployment",
+	Long: `Runs a series of checks against the deployment described by the config: the config is validated, MongoDB is
+connected to, every collection is checked for its unique index, the local clock is compared to MongoDB's, every stored
+signing key is parsed and compared to the key published in the JWKS, and a token is signed and verified with every
+current key. Nothing is written to the database.
+
+Exits with status code 2 if any check fails. Warnings do not change the exit code.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		report := doctor.Run(server.New(globalConfig))
+
+		render(report, func(w io.Writer) {
+			color := useColor()
+
+			for _, check := range report.Checks {
+				status := fmt.Sprintf("%-4s", check.Status)
+				if color {
+					status = statusColors[check.Status] + status + "\033[0m"
+				}
+
+				fmt.Fprintf(w, "[%s] %-22s %s\n", status, check.Name, check.Message)
+
+				for _, detail := range check.Details {
+					fmt.Fprintf(w, "       %-22s - %s\n", "", detail)
+				}
+			}
+
+			fmt.Fprintf(w, "\nOverall: %s\n", report.Status)
+		})
+
+		if report.Status == doctor.StatusFail {
+			os.Exit(exitCheckFailed)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,502 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/credstack/credstack/sdk/pkg/age"
+	"github.com/credstack/credstack/sdk/pkg/approval"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// envKeyPassphrase - The environment variable holding the passphrase key bundles are encrypted with
+const envKeyPassphrase = "CREDSTACK_KEY_PASSPHRASE"
+
+// errAlgRequiresNoApproval - Returned when --alg is passed to key rotate while key.rotate requires approval
+var errAlgRequiresNoApproval = errors.New("key.rotate requires approval, and approvals rotate every algorithm. Remove --alg to request one")
+
+// keyCmd represents the key command
+var keyCmd = &cobra.Command{
+	Use:     "key",
+	Aliases: []string{"keys"},
+	Short:   "Perform operations on signing keys",
+	Long: `Allows you to inspect and rotate the signing keys stored in the credstack database, back them up, and restore
+them into another environment.`,
+}
+
+// keyListCmd represents the key list command
+var keyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List every signing key",
+	Long: `Lists every signing key stored in the credstack database, along with its algorithm, audience, and status. Key
+material is never printed.
+
+A key is 'current' while new tokens are signed with it, and 'staged' until its staging period has elapsed and it becomes
+current. Keys that were rotated out are 'retiring' until they are removed along with their JWK, or 'inactive' if they
+were rotated out before retirement was tracked.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		audience, _ := cmd.Flags().GetString("audience")
+
+		serv := server.New(globalConfig)
+
+		err := serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		keys, err := jwk.ListPrivateKeys(serv)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when listing keys", err)
+		}
+
+		out := keyListOutput{Keys: make([]keyOutput, 0, len(keys))}
+		for _, key := range keys {
+			if audience != "" && key.Audience != audience {
+				continue
+			}
+
+			out.Keys = append(out.Keys, newKeyOutput(key))
+		}
+
+		render(out, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "KID\tALG\tAUDIENCE\tSTATUS\tCREATED\tACTIVATES\tRETIRES")
+
+			for _, key := range out.Keys {
+				fmt.Fprintf(
+					tw,
+					"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					key.Kid,
+					key.Alg,
+					key.Audience,
+					key.Status,
+					formatUnix(key.CreatedAt),
+					formatUnix(key.ActivatesAt),
+					formatUnix(key.RetiresAt),
+				)
+			}
+
+			_ = tw.Flush()
+		})
+	},
+}
+
+// keyRotateCmd represents the key rotate command
+var keyRotateCmd = &cobra.Command{
+	Use:   "rotate <audience>",
+	Short: "Rotate the signing keys of an audience",
+	Long: `Generates a new signing key for the audience provided, and rotates the current key out, in the same way as the
+management API. New tokens are signed with the new key immediately. The JWK of the previous key stays published until
+its grace period has elapsed, so that tokens signed with it remain valid.
+
+Every algorithm the audience has a current key for is rotated, unless one is passed with '--alg'. If another replica is
+rotating the same keys, then the command fails without rotating anything.
+
+If key.rotate requires approval, then a pending approval is requested instead, and the keys are rotated once a second
+admin approves it. Approvals always rotate every algorithm, so '--alg' cannot be passed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		alg, _ := cmd.Flags().GetString("alg")
+
+		if alg != "" && globalConfig.ApprovalConfig.Required(approval.ActionKeyRotate) {
+			exitWithError(exitUsage, "Fatal error when rotating keys", errAlgRequiresNoApproval)
+		}
+
+		if requestApproval(approval.ActionKeyRotate, args[0]) {
+			return
+		}
+
+		serv := server.New(globalConfig)
+
+		err := serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		rotated, err := rotateKeys(serv, args[0], alg)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when rotating keys", err)
+		}
+
+		out := keyRotateOutput{Audience: args[0], Keys: rotated}
+
+		render(out, func(w io.Writer) {
+			for _, key := range out.Keys {
+				fmt.Fprintf(w, "Rotated %s keys for %s. New key: %s\n", key.Alg, out.Audience, key.Kid)
+			}
+		})
+	},
+}
+
+// keyExportCmd represents the key export command
+var keyExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export every signing key to a passphrase encrypted file, or the public JWKS",
+	Long: `Exports every signing key, along with the JWK published for it, to a file encrypted with a passphrase. The file
+can be imported into another environment with 'key import', so that it can validate the tokens this environment has
+issued, and sign new ones with the same keys.
+
+The file is an ASCII armored age file, and can also be decrypted with 'age -d'. It contains private key material, so it
+should be stored as carefully as the database itself.
+
+The passphrase is read from the file passed with '--passphrase-file', or from the CREDSTACK_KEY_PASSPHRASE environment
+variable.
+
+Pass '--public' to export the public JWKS instead, as it is served at /.well-known/jwks.json, for distributing to relying
+parties that cannot fetch it. It is printed to stdout, or written to the file if one is passed, and no passphrase is
+needed.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if public, _ := cmd.Flags().GetBool("public"); public {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if public, _ := cmd.Flags().GetBool("public"); public {
+			exportPublicKeys(args)
+			return
+		}
+
+		passphrase, err := keyPassphrase(cmd)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when reading passphrase", err)
+		}
+
+		serv := server.New(globalConfig)
+
+		err = serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		bundle, err := jwk.Export(serv)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when exporting keys", err)
+		}
+
+		encoded, err := json.Marshal(bundle)
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when encoding keys", err)
+		}
+
+		encrypted, err := age.EncryptWithPassphrase(encoded, passphrase)
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when encrypting keys", err)
+		}
+
+		err = os.WriteFile(args[0], encrypted, 0600)
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when writing keys", err)
+		}
+
+		out := keyExportOutput{Path: args[0], Keys: make([]string, 0, len(bundle.Keys))}
+		for _, pair := range bundle.Keys {
+			out.Keys = append(out.Keys, pair.Public.Kid)
+		}
+
+		render(out, func(w io.Writer) {
+			fmt.Fprintf(w, "Exported %d keys to %s\n", len(out.Keys), out.Path)
+		})
+	},
+}
+
+// keyImportCmd represents the key import command
+var keyImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import signing keys from a file written by 'key export'",
+	Long: `Imports the signing keys from a file written by 'key export'. Every private key is verified against its JWK
+before anything is written.
+
+Keys that already exist are skipped, so the same file can be imported more than once. If a different key already exists
+under the same key ID, then nothing further is imported. Imported keys that were current in the environment they were
+exported from become current here as well, and the existing keys for the same algorithm and audience are kept for
+validating the tokens they signed.
+
+The passphrase is read from the file passed with '--passphrase-file', or from the CREDSTACK_KEY_PASSPHRASE environment
+variable.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passphrase, err := keyPassphrase(cmd)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when reading passphrase", err)
+		}
+
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when reading passphrase", err)
+		}
+
+		encrypted, err := os.ReadFile(args[0])
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when reading keys", err)
+		}
+
+		decrypted, err := age.Decrypt(encrypted, identity)
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when decrypting keys", err)
+		}
+
+		bundle := new(jwk.KeyBundle)
+
+		err = json.Unmarshal(decrypted, bundle)
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when decoding keys", err)
+		}
+
+		serv := server.New(globalConfig)
+
+		err = serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		result, err := jwk.Import(serv, bundle)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when importing keys", err)
+		}
+
+		render(result, func(w io.Writer) {
+			fmt.Fprintf(w, "Imported %d keys, skipped %d that already exist\n", len(result.Imported), len(result.Skipped))
+		})
+	},
+}
+
+/*
+keyExportOutput - The output of 'key export' in the json and yaml output formats
+*/
+type keyExportOutput struct {
+	// Path - The path the keys were written to
+	Path string `json:"path" yaml:"path"`
+
+	// Keys - The key IDs of the keys that were exported
+	Keys []string `json:"keys" yaml:"keys"`
+}
+
+/*
+keyOutput - A signing key in the output of the key list and key rotate commands in the json and yaml output formats
+*/
+type keyOutput struct {
+	// Kid - The key ID of the key
+	Kid string `json:"kid" yaml:"kid"`
+
+	// Alg - The algorithm the key signs tokens with
+	Alg string `json:"alg" yaml:"alg"`
+
+	// Audience - The audience the key signs tokens for
+	Audience string `json:"audience" yaml:"audience"`
+
+	// Status - The status of the key. One of: current, staged, retiring, inactive
+	Status string `json:"status" yaml:"status"`
+
+	// Active - Whether new tokens are signed with the key
+	Active bool `json:"active" yaml:"active"`
+
+	// Backend - The external signing backend the key lives in. Empty if the key material is stored in the database
+	Backend string `json:"backend,omitempty" yaml:"backend,omitempty"`
+
+	// CreatedAt - A unix timestamp representing when the key was created
+	CreatedAt int64 `json:"created_at" yaml:"created_at"`
+
+	// ActivatesAt - A unix timestamp representing when a staged key becomes current. Zero if the key is not staged
+	ActivatesAt int64 `json:"activates_at" yaml:"activates_at"`
+
+	// RetiresAt - A unix timestamp representing when a retiring key is removed. Zero if the key is not retiring
+	RetiresAt int64 `json:"retires_at" yaml:"retires_at"`
+}
+
+/*
+keyListOutput - The output of 'key list' in the json and yaml output formats
+*/
+type keyListOutput struct {
+	// Keys - The keys that were listed
+	Keys []keyOutput `json:"keys" yaml:"keys"`
+}
+
+/*
+keyRotateOutput - The output of 'key rotate' in the json and yaml output formats
+*/
+type keyRotateOutput struct {
+	// Audience - The audience whose keys were rotated
+	Audience string `json:"audience" yaml:"audience"`
+
+	// Keys - The new current key of every algorithm that was rotated
+	Keys []keyOutput `json:"keys" yaml:"keys"`
+}
+
+/*
+newKeyOutput - Converts the private key provided in the parameter into its keyOutput. Key material is never included
+*/
+func newKeyOutput(key *jwk.PrivateJSONWebKey) keyOutput {
+	out := keyOutput{
+		Alg:         key.Alg,
+		Audience:    key.Audience,
+		Active:      key.IsCurrent,
+		Backend:     key.Backend,
+		ActivatesAt: key.ActivatesAt,
+		RetiresAt:   key.RetiresAt,
+	}
+
+	if key.Header != nil {
+		out.Kid = key.Header.Identifier
+		out.CreatedAt = key.Header.CreatedAt
+	}
+
+	switch {
+	case key.IsCurrent:
+		out.Status = "current"
+	case key.ActivatesAt != 0:
+		out.Status = "staged"
+	case key.RetiresAt != 0:
+		out.Status = "retiring"
+	default:
+		out.Status = "inactive"
+	}
+
+	return out
+}
+
+/*
+rotateKeys - Rotates the keys of the audience provided in the parameter in the same way as the management API, and
+returns the new current key of each algorithm that was rotated. If alg is empty, then every algorithm the audience has a
+current key for is rotated with jwk.RotateAudience, which is what an approved key.rotate approval executes
+*/
+func rotateKeys(serv *server.Server, audience string, alg string) ([]keyOutput, error) {
+	algs := []string{alg}
+
+	var err error
+	if alg == "" {
+		algs, err = jwk.RotateAudience(serv, audience)
+	} else {
+		err = jwk.RotateKeys(serv, alg, audience)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := jwk.ListPrivateKeys(serv)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]keyOutput, 0, len(algs))
+	for _, key := range keys {
+		if key.Audience == audience && key.IsCurrent && slices.Contains(algs, key.Alg) {
+			ret = append(ret, newKeyOutput(key))
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+exportPublicKeys - Exports the public JWKS. It is printed to stdout as JSON, unless a file is passed in the arguments
+provided in the parameter, in which case it is written there and the key IDs of the exported keys are rendered instead
+*/
+func exportPublicKeys(args []string) {
+	serv := server.New(globalConfig)
+
+	err := serv.Start()
+	if err != nil {
+		exitWithError(exitFailure, "Fatal error when connecting to database", err)
+	}
+
+	jwks, err := jwk.JWKS(serv)
+	_ = serv.Stop()
+
+	if err != nil {
+		exitWithError(exitFailure, "Fatal error when exporting keys", err)
+	}
+
+	if jwks.Keys == nil {
+		jwks.Keys = []jwk.JSONWebKey{}
+	}
+
+	encoded, err := json.MarshalIndent(jwks, "", "  ")
+	if err != nil {
+		exitWithError(exitFailure, "Fatal error when encoding keys", err)
+	}
+
+	if len(args) == 0 {
+		/*
+			The JWKS is printed as JSON regardless of the output format, as that is the only form relying parties can
+			consume it in
+		*/
+		fmt.Println(string(encoded))
+		return
+	}
+
+	err = os.WriteFile(args[0], append(encoded, '\n'), 0644)
+	if err != nil {
+		exitWithError(exitFailure, "Fatal error when writing keys", err)
+	}
+
+	out := keyExportOutput{Path: args[0], Keys: make([]string, 0, len(jwks.Keys))}
+	for _, key := range jwks.Keys {
+		out.Keys = append(out.Keys, key.Kid)
+	}
+
+	render(out, func(w io.Writer) {
+		fmt.Fprintf(w, "Exported %d public keys to %s\n", len(out.Keys), out.Path)
+	})
+}
+
+/*
+keyPassphrase - Reads the passphrase for a key bundle from the file passed with --passphrase-file, or from the
+CREDSTACK_KEY_PASSPHRASE environment variable if it was not passed
+*/
+func keyPassphrase(cmd *cobra.Command) (string, error) {
+	passphraseFile, _ := cmd.Flags().GetString("passphrase-file")
+	if passphraseFile != "" {
+		contents, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	}
+
+	if passphrase := os.Getenv(envKeyPassphrase); passphrase != "" {
+		return passphrase, nil
+	}
+
+	return "", errors.New("either --passphrase-file or " + envKeyPassphrase + " must be set")
+}
+
+func init() {
+	keyListCmd.Flags().String("audience", "", "Only list the keys for this audience")
+	keyRotateCmd.Flags().String("alg", "", "Only rotate the keys for this algorithm (RS256, ES256)")
+	keyExportCmd.Flags().Bool("public", false, "Export the public JWKS instead of every signing key")
+
+	keyCmd.AddCommand(keyListCmd)
+	keyCmd.AddCommand(keyRotateCmd)
+
+	for _, command := range []*cobra.Command{keyExportCmd, keyImportCmd} {
+		command.Flags().String("passphrase-file", "", "The path to a file containing the passphrase the keys are encrypted with")
+		keyCmd.AddCommand(command)
+	}
+
+	rootCmd.AddCommand(keyCmd)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/credstack/credstack/sdk/pkg/management"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// managementCmd represents the management command
+var managementCmd = &cobra.Command{
+	Use:   "management",
+	Short: "Perform operations on the management API",
+	Long:  `Allows you to access the management API, which requires an access token issued to its admin client.`,
+}
+
+// managementCredentialsCmd represents the management credentials command
+var managementCredentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Print the credentials of the management API admin client",
+	Long: `Prints the client ID and client secret of the admin client that was bootstrapped for the management API when
+the API first started. Exchange them for an access token at /oauth/token with the client credentials grant, for the
+audience in 'management.audience'.
+
+The client secret is printed to stdout, so avoid running this where the output is recorded.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		serv := server.New(globalConfig)
+
+		err := serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		admin, err := management.AdminClient(serv)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when fetching the admin client", err)
+		}
+
+		out := managementCredentialsOutput{
+			ClientId:     admin.ClientId,
+			ClientSecret: admin.ClientSecret,
+			Audience:     globalConfig.ManagementConfig.Audience,
+		}
+
+		render(out, func(w io.Writer) {
+			fmt.Fprintf(w, "Client ID:     %s\nClient secret: %s\nAudience:      %s\n", out.ClientId, out.ClientSecret, out.Audience)
+		})
+	},
+}
+
+/*
+managementCredentialsOutput - The output of the management credentials command in the json and yaml output formats
+*/
+type managementCredentialsOutput struct {
+	// ClientId - The client ID of the admin client
+	ClientId string `json:"client_id" yaml:"client_id"`
+
+	// ClientSecret - The client secret of the admin client
+	ClientSecret string `json:"client_secret" yaml:"client_secret"`
+
+	// Audience - The audience tokens for the management API are issued for
+	Audience string `json:"audience" yaml:"audience"`
+}
+
+func init() {
+	managementCmd.AddCommand(managementCredentialsCmd)
+	rootCmd.AddCommand(managementCmd)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/credstack/credstack/sdk/pkg/lock"
+	"github.com/credstack/credstack/sdk/pkg/migration"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rewrite documents written by older versions of credstack",
+	Long: `Rewrites documents that were written by the protobuf models, which stored enum values (token types, grant types)
+as numbers, into the string values used today, and sets the canonical email of users created before email addresses were
+normalized. The canonical emails are also set by the API's pre-flight checks, before the indexes that depend on them are
+built.
+
+Documents are rewritten in batches, and credstack can keep serving requests while this runs, as documents with legacy
+enum values are still read correctly until they are rewritten. A document that is updated by someone else while it is
+being migrated is skipped, and picked up by the next run. Only one replica can run the migrations at a time.
+
+Progress is reported to stderr after every batch. Pass --dry-run to convert every document without writing anything.
+
+Exits with status code 2 if any document could not be converted, and 1 if the migrations could not be run.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+
+		serv := server.New(globalConfig)
+
+		err := serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		progress, err := migration.Run(serv, migration.Options{
+			DryRun:    dryRun,
+			BatchSize: batchSize,
+			OnProgress: func(current migration.Progress) {
+				fmt.Fprintf(os.Stderr, "%s: %d/%d rewritten, %d skipped, %d failed\n",
+					current.Migration, current.Rewritten, current.Pending, current.Skipped, current.Failed,
+				)
+			},
+		})
+		_ = serv.Stop()
+
+		if errors.Is(err, lock.ErrLockHeld) {
+			exitWithError(exitFailure, "The migrations are already being run by another replica", err)
+		}
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when running migrations", err)
+		}
+
+		out := migrateOutput{DryRun: dryRun, Migrations: progress}
+
+		render(out, func(w io.Writer) {
+			for _, applied := range out.Migrations {
+				fmt.Fprintf(w, "%-28s %d pending, %d rewritten, %d skipped, %d failed\n",
+					applied.Migration, applied.Pending, applied.Rewritten, applied.Skipped, applied.Failed,
+				)
+
+				for _, reason := range applied.Errors {
+					fmt.Fprintf(w, "  - %s\n", reason)
+				}
+			}
+
+			if out.DryRun {
+				fmt.Fprintln(w, "\nDry run: nothing was written")
+			}
+		})
+
+		for _, applied := range out.Migrations {
+			if applied.Failed != 0 {
+				os.Exit(exitCheckFailed)
+			}
+		}
+	},
+}
+
+/*
+migrateOutput - The output of 'migrate' in the json and yaml output formats
+*/
+type migrateOutput struct {
+	// DryRun - Set if nothing was written
+	DryRun bool `json:"dry_run" yaml:"dry_run"`
+
+	// Migrations - The progress of every migration, in the order they were applied
+	Migrations []migration.Progress `json:"migrations" yaml:"migrations"`
+}
+
+func init() {
+	migrateCmd.Flags().Bool("dry-run", false, "Convert every document without writing anything")
+	migrateCmd.Flags().Int("batch-size", migration.DefaultBatchSize, "The number of documents rewritten at once")
+	rootCmd.AddCommand(migrateCmd)
+}
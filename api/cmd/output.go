@@ -0,0 +1,150 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	credstackErrors "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	// outputTable - Human-readable output. The layout can change between releases and should not be parsed
+	outputTable = "table"
+
+	// outputJSON - A single JSON document written to stdout. The schema is stable across releases
+	outputJSON = "json"
+
+	// outputYAML - The same document as outputJSON, encoded as YAML
+	outputYAML = "yaml"
+)
+
+/*
+Exit codes returned by every command. These are documented in docs/cli.md and should only ever be added to, as CI
+pipelines depend on them
+*/
+const (
+	// exitOK - The command completed successfully
+	exitOK = 0
+
+	// exitFailure - The command could not complete (the database was unreachable, the config could not be loaded)
+	exitFailure = 1
+
+	// exitCheckFailed - The command completed, but the check it performs failed (tampering was detected in the audit log)
+	exitCheckFailed = 2
+
+	// exitUsage - The command was called with unknown flags, invalid arguments, or an unsupported output format
+	exitUsage = 3
+)
+
+// outputFormat - The format command output is written in. Set with --output
+var outputFormat string
+
+/*
+errorOutput - The document written to stderr in place of a command's output when it fails in the json or yaml output
+formats
+*/
+type errorOutput struct {
+	// Error - Describes the error that caused the command to fail
+	Error errorDetail `json:"error" yaml:"error"`
+}
+
+/*
+errorDetail - Describes the error that caused a command to fail
+*/
+type errorDetail struct {
+	// Code - The short code of the error (ERR_INTERNAL_DATABASE). Empty if the error was not a credstack error
+	Code string `json:"code,omitempty" yaml:"code,omitempty"`
+
+	// Message - A human-readable description of the error
+	Message string `json:"message" yaml:"message"`
+
+	// ExitCode - The exit code the command exited with
+	ExitCode int `json:"exit_code" yaml:"exit_code"`
+}
+
+/*
+validateOutput - Ensures that the format passed with --output is supported, exiting with exitUsage if it is not
+*/
+func validateOutput() {
+	switch outputFormat {
+	case outputTable, outputJSON, outputYAML:
+		return
+	}
+
+	invalid := outputFormat
+	outputFormat = outputTable
+
+	exitWithError(exitUsage, "Invalid output format", fmt.Errorf("%q is not one of: table, json, yaml", invalid))
+}
+
+/*
+render - Writes the result of a command to stdout in the selected output format. The value is encoded as-is for json and
+yaml, so every type passed here should have json and yaml tags, as they define the schema scripts depend on. The table
+function writes the human-readable form. Exits with exitFailure if the value cannot be encoded
+*/
+func render(value any, table func(w io.Writer)) {
+	var err error
+
+	switch outputFormat {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(value)
+	case outputYAML:
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		err = encoder.Encode(value)
+		if err == nil {
+			err = encoder.Close()
+		}
+	default:
+		table(os.Stdout)
+	}
+
+	if err != nil {
+		exitWithError(exitFailure, "Fatal error when writing output", err)
+	}
+}
+
+/*
+exitWithError - Reports an error and exits with the exit code provided in the parameter. In the table format, the context
+and the error are printed as they always have been. In the json and yaml formats, an errorOutput document is written to
+stderr instead, so that stdout only ever contains a command's result
+*/
+func exitWithError(code int, context string, err error) {
+	if outputFormat == outputTable || outputFormat == "" {
+		fmt.Println(context+": ", err)
+		os.Exit(code)
+	}
+
+	detail := errorDetail{Message: fmt.Sprintf("%s: %v", context, err), ExitCode: code}
+
+	var casted credstackErrors.CredstackError
+	if errors.As(err, &casted) {
+		detail.Code = casted.ShortCode
+	}
+
+	if outputFormat == outputYAML {
+		_ = yaml.NewEncoder(os.Stderr).Encode(errorOutput{Error: detail})
+	} else {
+		_ = json.NewEncoder(os.Stderr).Encode(errorOutput{Error: detail})
+	}
+
+	os.Exit(code)
+}
+
+/*
+addOutputFlag - Registers the persistent --output flag on the command provided in the parameter
+*/
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "The format command output is written in. Can be one of: table, json, yaml")
+}
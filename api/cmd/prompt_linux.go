@@ -0,0 +1,42 @@
+//go:build linux
+
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+/*
+readSecret - Reads a line from stdin with terminal echo disabled, so that the secret is not displayed as it is typed. If
+stdin is not a terminal, then errNotTerminal is returned
+*/
+func readSecret() (string, error) {
+	fd := int(os.Stdin.Fd())
+
+	original, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return "", errNotTerminal
+	}
+
+	noEcho := *original
+	noEcho.Lflag &^= unix.ECHO
+	noEcho.Lflag |= unix.ICANON | unix.ISIG
+	noEcho.Iflag |= unix.ICRNL
+
+	err = unix.IoctlSetTermios(fd, unix.TCSETS, &noEcho)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = unix.IoctlSetTermios(fd, unix.TCSETS, original)
+	}()
+
+	return readLine()
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+/*
+readSecret - Secrets cannot be read with echo disabled on this platform, so they must be piped through stdin instead
+*/
+func readSecret() (string, error) {
+	return "", errNotTerminal
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+/*
+readSecret - Reads a line from the console with echo disabled, so that the secret is not displayed as it is typed. If
+stdin is not a console, then errNotTerminal is returned
+*/
+func readSecret() (string, error) {
+	handle := windows.Handle(os.Stdin.Fd())
+
+	var original uint32
+
+	err := windows.GetConsoleMode(handle, &original)
+	if err != nil {
+		return "", errNotTerminal
+	}
+
+	noEcho := original&^windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT
+
+	err = windows.SetConsoleMode(handle, noEcho)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = windows.SetConsoleMode(handle, original)
+	}()
+
+	return readLine()
+}
@@ -6,7 +6,6 @@ package cmd
 
 import (
 	"context"
-	"fmt"
 	"os"
 	"time"
 
@@ -16,6 +15,7 @@ import (
 )
 
 var cfgFile string
+var dataDir string
 var globalConfig *config.ServerConfig
 
 // rootCmd represents the base command when called without any subcommands
@@ -24,18 +24,36 @@ var rootCmd = &cobra.Command{
 	Short: "",
 	Long:  `The open source & cloud-native identity provider`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		err := globalConfig.BindFlags(cmd)
+		err := globalConfig.BindFlags(cmd.Flags())
 		if err != nil {
-			fmt.Println("Fatal error when binding flags: ", err)
-			os.Exit(1)
+			exitWithError(exitFailure, "Fatal error when binding flags", err)
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		/*
+			Startup is given long enough for a pre-flight lock left behind by a replica that crashed to expire, as the
+			pre-flight checks wait for it before the API starts serving
+		*/
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10+globalConfig.LockConfig.LeaseTTL)
 		defer cancel()
-		err := api.New(globalConfig).Start(ctx)
+
+		instance := api.New(globalConfig)
+		start := func() error {
+			return instance.Start(ctx)
+		}
+
+		isService, err := runAsService(instance, start)
+		if isService {
+			if err != nil {
+				os.Exit(exitFailure)
+			}
+
+			return
+		}
+
+		err = start()
 		if err != nil {
-			os.Exit(1)
+			os.Exit(exitFailure)
 		}
 	},
 }
@@ -43,18 +61,39 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(exitUsage) // cobra only returns errors for unknown commands, flags, and arguments, and has already printed them
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "~/.credstack/config.json", "Set the the config file to load")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Set the the config file to load. Defaults to config.json under --data-dir, or under the platform config directory (e.g. ~/.config/credstack)")
+	addOutputFlag(rootCmd)
+	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", "", "A single directory to load the config file from and write logs under, replacing the platform defaults")
 	rootCmd.Flags().IntP("api.port", "p", 8080, "The default port that the API is going to listen for requests at")
 	rootCmd.Flags().Bool("api.debug", false, "Enables debug mode for the API and disables various options in Fiber. See the docs for more details")
 	rootCmd.Flags().Bool("api.prefork", false, "Allows the API to serve requests on multiple processes")
 	rootCmd.Flags().Bool("api.skip_preflight", false, "If set to true, then skip API pre-flight checks")
+	rootCmd.Flags().Duration("api.request_timeout", 30*time.Second, "The deadline applied to every request. Requests that exceed it receive a 503. Set to 0 to disable")
+	rootCmd.Flags().String("api.error_detail", "generic", "How much detail error responses include: generic (production) or detailed (development)")
+	rootCmd.Flags().StringSlice("api.allowed_origins", []string{}, "The origins that browsers can call the API from cross-origin. Set to * to allow every origin")
+	rootCmd.Flags().Duration("api.cors_max_age", 10*time.Minute, "How long browsers can cache the result of a CORS preflight request")
+	rootCmd.Flags().StringSlice("api.trusted_proxies", []string{}, "The IP addresses or CIDR ranges of the reverse proxies in front of the API. X-Forwarded-* headers are ignored from anyone else")
+
+	/*
+		TLS - Provides options for serving the API over TLS. Leave these unset when TLS is terminated by a load balancer
+	*/
+	rootCmd.Flags().String("api.tls.cert_file", "", "The path to a PEM encoded certificate chain to serve the API with. Requires api.tls.key_file")
+	rootCmd.Flags().String("api.tls.key_file", "", "The path to the PEM encoded private key of api.tls.cert_file")
+	rootCmd.Flags().StringSlice("api.tls.acme_domains", []string{}, "The domains to issue a certificate for automatically with ACME (Let's Encrypt). The API must be reachable on port 443")
+	rootCmd.Flags().String("api.tls.acme_email", "", "The contact email registered with the ACME certificate authority")
+	rootCmd.Flags().String("api.tls.acme_directory_url", "", "The directory URL of the ACME certificate authority. Defaults to Let's Encrypt")
+	rootCmd.Flags().String("api.tls.acme_cache_dir", "", "The directory issued certificates are stored in. Required with api.tls.acme_domains")
+	rootCmd.Flags().String("api.tls.min_version", "1.2", "The minimum TLS version that is negotiated: 1.2 or 1.3")
+	rootCmd.Flags().StringSlice("api.tls.cipher_suites", []string{}, "The cipher suites that can be negotiated with TLS 1.2. Defaults to the Go defaults")
+	rootCmd.Flags().String("api.tls.client_auth", "none", "If client certificates are requested for mutual TLS: none, request, optional, or require")
+	rootCmd.Flags().String("api.tls.client_ca_file", "", "The path to the PEM encoded certificate authorities that client certificates are verified against")
 	rootCmd.Flags().StringP("issuer", "i", "https://credstack.issuer.change.me", "The issuer to insert into the claims of issued JWT tokens")
 
 	/*
@@ -68,31 +107,279 @@ func init() {
 	rootCmd.Flags().String("database.authentication_database", "admin", "The default database in MongoDB that provides authentication")
 	rootCmd.Flags().String("database.username", "", "The username that credstack will use for authentication with MongoDB")
 	rootCmd.Flags().String("database.password", "", "The password that credstack will use for authentication with MongoDB")
+	rootCmd.Flags().Duration("database.server_selection_timeout", 5*time.Second, "How long to wait for an available MongoDB server before an operation fails")
+	rootCmd.Flags().Bool("database.retry_reads", true, "If set to true, reads that fail with a transient network error are retried")
+	rootCmd.Flags().Bool("database.retry_writes", true, "If set to true, writes that fail with a transient network error are retried")
+	rootCmd.Flags().Int("database.breaker_threshold", 3, "The number of consecutive database failures before requests fail fast with a 503. Set to 0 to disable")
+	rootCmd.Flags().Duration("database.breaker_cooldown", 10*time.Second, "How long requests fail fast for before the database is probed again")
+	rootCmd.Flags().Int("database.connect_retries", 5, "The number of times connecting to MongoDB is retried at startup before giving up")
+	rootCmd.Flags().Duration("database.connect_backoff", time.Second, "The delay before the first connection retry. Doubled after every attempt")
+	rootCmd.Flags().Duration("database.connect_max_backoff", 30*time.Second, "The maximum delay between connection retries")
+	rootCmd.Flags().String("database.collection_prefix", "", "Prepended to the name of every collection (e.g. cs_), so that credstack can share a database with other applications")
+	rootCmd.Flags().StringToString("database.collection_overrides", map[string]string{}, "Maps a collection to the exact name that should be used for it (e.g. user=accounts). Overrides are not prefixed")
+	rootCmd.Flags().String("database.list_read_preference", "primary", "The read preference used for list endpoints. Can be any of: primary, primaryPreferred, secondary, secondaryPreferred, nearest")
+	rootCmd.Flags().String("database.report_read_preference", "primary", "The read preference used for reports that scan entire collections, like audit verification")
+	rootCmd.Flags().String("database.export_read_preference", "primary", "The read preference used for bulk exports")
 
 	/*
 		Log - Provides options that control how logging is handled
 	*/
 	rootCmd.Flags().String("log.level", "", "The level of logging to use. Can be one of: debug, warn, info. Defaults to info")
-	rootCmd.Flags().String("log.path", "/var/log/credstack", "The directory to write log files too")
+	rootCmd.Flags().String("log.path", config.DefaultLogPath(), "The directory to write log files too. Defaults to logs under --data-dir if it is set")
 	rootCmd.Flags().Bool("log.use_file_logging", false, "If set to true, then log files will be written. Otherwise, only STDOUT logging will be used")
 
 	/*
 		Credential - Provides options that control how user credentials are hashed
 	*/
-	rootCmd.Flags().Uint32("argon.time", 1, "The number of iterations that will be made when hashing passwords with Argon2id")
-	rootCmd.Flags().Uint32("argon.memory", 1024, "The amount of memory that argon can consume while hashing passwords")
-	rootCmd.Flags().Uint8("argon.threads", 1, "The number of goroutines that argon can use while hashing passwords")
-	rootCmd.Flags().Uint32("argon.key_length", 16, "The length that passwords will be hashed to")
-	rootCmd.Flags().Uint32("argon.salt_length", 32, "The length that a salt will be generated to")
-	rootCmd.Flags().Uint32("argon.min_secret_length", 12, "The minimum length requirement of plaintext user credentials")
-	rootCmd.Flags().Uint32("argon.max_secret_length", 48, "The maximum length requirement of plaintext user credentials")
+	rootCmd.Flags().String("credential.algorithm", "argon2id", "The algorithm used for hashing new passwords. Can be one of: argon2id, pbkdf2. Must be pbkdf2 when FIPS mode is enabled")
+	rootCmd.Flags().Uint32("credential.iterations", 600000, "The number of iterations that will be made when hashing passwords with PBKDF2")
+	rootCmd.Flags().Uint32("credential.time", 1, "The number of iterations that will be made when hashing passwords with Argon2id")
+	rootCmd.Flags().Uint32("credential.memory", 1024, "The amount of memory that argon can consume while hashing passwords")
+	rootCmd.Flags().Uint8("credential.threads", 1, "The number of goroutines that argon can use while hashing passwords")
+	rootCmd.Flags().Uint32("credential.key_length", 16, "The length that passwords will be hashed to")
+	rootCmd.Flags().Uint32("credential.salt_length", 32, "The length that a salt will be generated to")
+	rootCmd.Flags().Uint32("credential.min_secret_length", 12, "The minimum length requirement of plaintext user credentials")
+	rootCmd.Flags().Uint32("credential.max_secret_length", 48, "The maximum length requirement of plaintext user credentials")
+
+	/*
+		Email - Provides options that control how user email addresses are normalized
+	*/
+	rootCmd.Flags().Bool("email.fold_case", true, "If set to true, email addresses are lower-cased before they are stored or looked up")
+	rootCmd.Flags().Bool("email.strip_plus_addressing", false, "If set to true, sub-addresses (user+tag@example.com) are ignored when checking for uniqueness")
+	rootCmd.Flags().Bool("email.strip_gmail_dots", false, "If set to true, dots in the local part of gmail addresses are ignored when checking for uniqueness")
+
+	/*
+		Phone - Provides options that control how user phone numbers are normalized
+	*/
+	rootCmd.Flags().String("phone.default_country_code", "", "The country calling code applied to phone numbers provided without one. If empty, numbers must be in E.164 format")
+
+	/*
+		GeoIP - Provides options that control how IP addresses are resolved to locations
+	*/
+	rootCmd.Flags().String("geoip.backend", "none", "The backend used for resolving IP addresses to locations. Can be one of: none, maxmind")
+	rootCmd.Flags().String("geoip.database_path", "/var/lib/credstack/GeoLite2-City.mmdb", "The path to the MaxMind database file")
+	rootCmd.Flags().Duration("geoip.refresh_interval", 24*time.Hour, "How often the geo-ip database file is re-opened to pick up updates. Set to 0 to disable")
+
+	/*
+		Audit - Provides options that control how audit records are signed
+	*/
+	rootCmd.Flags().String("audit.signing_audience", "", "The audience whose active RS256 key signs batches of audit records. If empty, batches are not signed")
+	rootCmd.Flags().Int64("audit.batch_size", 100, "The number of audit records included in each signed batch")
+
+	/*
+		Crypto - Provides options that control which cryptographic algorithms can be used
+	*/
+	rootCmd.Flags().Bool("crypto.fips_mode", false, "If set to true, only FIPS 140 approved algorithms can be used and the config is validated against them at startup")
+
+	/*
+		Secret - Provides options that control how client IDs and secrets are generated
+	*/
+	rootCmd.Flags().String("secret.client_id.encoding", "base64url", "How client IDs are encoded. Can be one of: base64url, hex, alphabet")
+	rootCmd.Flags().Uint32("secret.client_id.length", 16, "The number of random bytes (or characters for alphabet encoding) in a client ID")
+	rootCmd.Flags().String("secret.client_id.alphabet", "", "The characters that client IDs are drawn from when using alphabet encoding")
+	rootCmd.Flags().String("secret.client_id.prefix", "", "A fixed prefix prepended to every client ID")
+	rootCmd.Flags().Bool("secret.client_id.checksum", false, "If set to true, a CRC32 checksum is appended to every client ID")
+	rootCmd.Flags().String("secret.client_secret.encoding", "base64url", "How client secrets are encoded. Can be one of: base64url, hex, alphabet")
+	rootCmd.Flags().Uint32("secret.client_secret.length", 96, "The number of random bytes (or characters for alphabet encoding) in a client secret")
+	rootCmd.Flags().String("secret.client_secret.alphabet", "", "The characters that client secrets are drawn from when using alphabet encoding")
+	rootCmd.Flags().String("secret.client_secret.prefix", "", "A fixed prefix prepended to every client secret (cs_live_)")
+	rootCmd.Flags().Bool("secret.client_secret.checksum", false, "If set to true, a CRC32 checksum is appended to every client secret so that leaked secrets can be detected by scanners")
+
+	/*
+		Canary - Provides options that control how canary clients raise alerts
+	*/
+	rootCmd.Flags().String("canary.webhook_url", "", "A URL that receives a JSON POST whenever a canary client is used")
+	rootCmd.Flags().Duration("canary.webhook_timeout", 10*time.Second, "The maximum amount of time to wait for the canary webhook to respond")
+
+	/*
+		Approval - Provides options that control which destructive actions require a second admin's approval
+	*/
+	rootCmd.Flags().StringSlice("approval.required_actions", []string{}, "The actions that require approval from a second admin. Can be any of: client.delete, resource_server.delete, user.delete, key.rotate, token.revoke_all")
+	rootCmd.Flags().Duration("approval.ttl", 24*time.Hour, "How long a pending approval can wait before it expires")
+
+	/*
+		Document Cache - Provides options that control how public documents are cached for database outages
+	*/
+	rootCmd.Flags().String("document_cache.directory", "", "A directory where copies of the JWKS are written so that they survive a restart during a database outage. If empty, they are only cached in memory")
+	rootCmd.Flags().Duration("document_cache.max_stale", 24*time.Hour, "The maximum age of a cached JWKS that can be served while the database is unavailable")
+
+	/*
+		Lock - Provides options that control how singleton tasks are coordinated across replicas
+	*/
+	rootCmd.Flags().String("lock.owner", "", "Identifies this replica as the holder of a lock. Defaults to the hostname and process ID")
+	rootCmd.Flags().Duration("lock.lease_ttl", 30*time.Second, "How long a lock is held before another replica can take it over if it is not renewed")
+
+	/*
+		Key - Provides options that control how signing keys are staged before they are used, and retired after
+	*/
+	rootCmd.Flags().Duration("key.staging_period", time.Hour, "How long a staged signing key is published in the JWKS before it is used for signing")
+	rootCmd.Flags().Duration("key.grace_period", 24*time.Hour, "How long a rotated signing key is published in the JWKS for verification only. Extended to the longest token lifetime of any client")
+	rootCmd.Flags().Duration("key.cache_ttl", time.Minute, "How long the current signing key of an audience is cached in memory for. Set to zero to disable")
+
+	/*
+		Device - Provides options that control the device authorization grant
+	*/
+	rootCmd.Flags().String("device.verification_uri", "", "The URL that users are directed to for entering the user code displayed on their device")
+	rootCmd.Flags().Duration("device.code_lifetime", 10*time.Minute, "How long a device code is valid for before the device must start over")
+	rootCmd.Flags().Duration("device.polling_interval", 5*time.Second, "The minimum amount of time a device must wait between polling the token endpoint")
+
+	/*
+		Introspection - Provides options that control token introspection
+	*/
+	rootCmd.Flags().Int("introspection.max_batch_size", 100, "The maximum number of tokens that can be introspected in a single batch request")
+
+	/*
+		Authorization - Provides options that control the authorization endpoint
+	*/
+	rootCmd.Flags().Duration("authorization.code_lifetime", time.Minute, "How long an authorization code can be redeemed after it is issued")
+	rootCmd.Flags().String("authorization.login_template", "", "The path to an HTML template that replaces the hosted login page. If empty, the built-in page is used")
+	rootCmd.Flags().String("authorization.change_password_url", "", "The URL of the page where users change their password. /.well-known/change-password redirects here")
+	rootCmd.Flags().String("authorization.account_url", "", "The URL of the page where users manage their account. Advertised in the discovery document")
+
+	/*
+		Token Store - Provides options that control how issued tokens are persisted
+	*/
+	rootCmd.Flags().String("token_store.mode", "sync", "How issued tokens are persisted. Can be one of: sync, write_behind. Use sync if freshly issued tokens must be revocable or introspectable immediately")
+	rootCmd.Flags().Int("token_store.queue_size", 10000, "The number of tokens that can be queued in write_behind mode before tokens are written synchronously")
+	rootCmd.Flags().Int("token_store.batch_size", 100, "The maximum number of tokens written to the database in a single call")
+	rootCmd.Flags().Duration("token_store.flush_interval", time.Second, "The maximum amount of time a token is queued before it is written")
+	rootCmd.Flags().Int("token_store.max_retries", 3, "The number of times a failed batch of tokens is retried before it is dropped")
+
+	/*
+		Session - Provides options that control how long browser login sessions last
+	*/
+	rootCmd.Flags().Duration("session.idle_timeout", time.Hour, "How long a session stays active without being used. Zero disables the idle timeout")
+	rootCmd.Flags().Duration("session.absolute_timeout", 8*time.Hour, "How long a session stays active after the user logged in. Zero disables sessions")
+
+	/*
+		Claim - Provides options that control how custom claims are named
+	*/
+	rootCmd.Flags().String("claim.namespace", "", "A URI that every custom claim must be prefixed with (https://example.com/claims/). If empty, custom claims are not namespaced")
+
+	/*
+		Region - Provides options for running credstack in more than one region at once
+	*/
+	rootCmd.Flags().String("region.name", "", "The name of the region the server runs in (us-east). If empty, the server is not region-aware")
+	rootCmd.Flags().String("region.endpoint", "", "The base URL clients in this region reach credstack at. Discovery renders endpoints relative to it, while the issuer stays global")
+	rootCmd.Flags().Duration("region.peer_timeout", 2*time.Second, "How long a peer region has to respond to a health probe")
+	rootCmd.Flags().Duration("region.revocation_retention", 24*time.Hour, "How long revocations are kept in the feed other regions follow. Should be longer than the lifetime of any access token")
+
+	/*
+		Telemetry - Provides options for reporting anonymous usage to the credstack maintainers. Disabled by default
+	*/
+	rootCmd.Flags().Bool("telemetry.enabled", false, "If set to true, an anonymous aggregate usage report is sent once every interval. Preview it with GET /telemetry/preview")
+	rootCmd.Flags().String("telemetry.endpoint", "", "The URL telemetry reports are sent to")
+	rootCmd.Flags().Duration("telemetry.interval", 24*time.Hour, "How often a telemetry report is sent. Must be at least an hour")
+
+	/*
+		Identifier - Provides options for how the identifiers of new objects are generated
+	*/
+	rootCmd.Flags().String("identifier.strategy", "uuidv5", "The ID strategy for new objects: uuidv5, uuidv7, ulid, or sha256. Existing objects keep their identifiers")
+	rootCmd.Flags().String("identifier.namespace", "", "A namespace passed to the ID strategy. Hashed along with the object by the sha256 strategy")
+
+	/*
+		Metadata - Provides options for the metadata stored on users
+	*/
+	rootCmd.Flags().Uint32("metadata.max_user_metadata_size", 16384, "The largest the user metadata of a single user can grow to, in bytes")
+	rootCmd.Flags().Uint32("metadata.max_app_metadata_size", 16384, "The largest the app metadata of a single user can grow to, in bytes")
+
+	/*
+		Federation - Provides options for signing in through upstream identity providers. Connections are configured in the config file
+	*/
+	rootCmd.Flags().Duration("federation.state_lifetime", 10*time.Minute, "How long a user has to complete signing in at an upstream identity provider")
+	rootCmd.Flags().Duration("federation.timeout", 10*time.Second, "How long to wait for an upstream identity provider to respond")
+	rootCmd.Flags().String("federation.entity_id", "", "The entity ID credstack identifies itself with to SAML identity providers. Defaults to the URL of its service provider metadata")
+
+	/*
+		SCIM - Provides options for provisioning users and groups from a directory with SCIM 2.0
+	*/
+	rootCmd.Flags().StringSlice("scim.clients", []string{}, "The client IDs of the provisioning clients. SCIM provisioning is disabled if empty")
+	rootCmd.Flags().String("scim.audience", "credstack-scim", "The audience the access tokens of provisioning clients must be issued for")
+	rootCmd.Flags().String("scim.scope", "scim", "The scope the access tokens of provisioning clients must be issued with")
+	rootCmd.Flags().String("scim.connection", "", "The federation connection provisioned users sign in with. If empty, provisioned users sign in with a password")
+	rootCmd.Flags().String("scim.subject_attribute", "userName", "The SCIM attribute provisioned users are linked to the connection by. Can be either: userName, externalId")
+	rootCmd.Flags().Int("scim.max_results", 100, "The most resources returned from a single SCIM list request")
+
+	/*
+		Signer - Provides options for generating signing keys in, and signing tokens with, an external backend
+	*/
+	rootCmd.Flags().String("signer.backend", "local", "The backend new signing keys are generated in. Can be either: local, vault, aws_kms, gcp_kms, pkcs11")
+	rootCmd.Flags().Duration("signer.timeout", 10*time.Second, "How long a single request to an external signing backend can take")
+	rootCmd.Flags().String("signer.vault.address", "", "The address of the Vault server")
+	rootCmd.Flags().String("signer.vault.token", "", "The token used to authenticate with Vault")
+	rootCmd.Flags().String("signer.vault.namespace", "", "The Vault Enterprise namespace the transit secrets engine is mounted in")
+	rootCmd.Flags().String("signer.vault.mount_path", "transit", "The path the transit secrets engine is mounted at")
+	rootCmd.Flags().String("signer.vault.key_prefix", "credstack-", "The prefix of the names of the transit keys credstack creates")
+	rootCmd.Flags().String("signer.aws_kms.region", "", "The AWS region KMS keys are created in")
+	rootCmd.Flags().String("signer.aws_kms.endpoint", "", "Overrides the KMS endpoint of the region")
+	rootCmd.Flags().String("signer.aws_kms.access_key_id", "", "The AWS access key ID. Uses the default credential chain of the AWS SDK if empty")
+	rootCmd.Flags().String("signer.aws_kms.secret_access_key", "", "The AWS secret access key. Only used with signer.aws_kms.access_key_id")
+	rootCmd.Flags().String("signer.aws_kms.session_token", "", "The AWS session token of temporary credentials. Only used with signer.aws_kms.access_key_id")
+	rootCmd.Flags().Int("signer.aws_kms.pending_window_days", 30, "How many days a retired KMS key is kept for before it is deleted")
+	rootCmd.Flags().String("signer.gcp_kms.key_ring", "", "The resource name of the Cloud KMS key ring crypto keys are created in")
+	rootCmd.Flags().String("signer.gcp_kms.credentials_file", "", "The path of the credentials file used with Cloud KMS, such as the JSON key of a service account. Uses the application default credentials if empty")
+	rootCmd.Flags().String("signer.gcp_kms.endpoint", "https://cloudkms.googleapis.com", "Overrides the Cloud KMS endpoint")
+	rootCmd.Flags().String("signer.gcp_kms.key_prefix", "credstack-", "The prefix of the IDs of the crypto keys credstack creates")
+	rootCmd.Flags().String("signer.pkcs11.module_path", "", "The path of the PKCS#11 module of the HSM")
+	rootCmd.Flags().Uint("signer.pkcs11.slot", 0, "The ID of the HSM slot signing keys are generated in")
+	rootCmd.Flags().String("signer.pkcs11.pin", "", "The user PIN used to log in to the HSM token")
+	rootCmd.Flags().String("signer.pkcs11.key_prefix", "credstack-", "The prefix of the labels of the keys credstack generates in the HSM")
+
+	/*
+		Management - Provides options for authenticating requests to the management API
+	*/
+	rootCmd.Flags().Bool("management.require_authentication", true, "If set to true, management requests must carry an access token issued for the management audience with the scopes the route requires")
+	rootCmd.Flags().String("management.audience", "credstack-management", "The audience of the resource server bootstrapped for the management API")
+	rootCmd.Flags().String("management.client_name", "credstack-admin", "The name of the admin client bootstrapped with every management scope")
+
+	/*
+		Security - Provides options for the security headers applied to responses, and the limits applied to requests
+	*/
+	rootCmd.Flags().Bool("security.headers", true, "If set to true, security headers (HSTS, X-Content-Type-Options, X-Frame-Options, Referrer-Policy) are applied to every response")
+	rootCmd.Flags().Duration("security.hsts_max_age", 365*24*time.Hour, "How long browsers only connect to credstack over HTTPS. Set to 0 to disable HSTS")
+	rootCmd.Flags().Bool("security.hsts_include_subdomains", true, "If set to true, HSTS also applies to every subdomain")
+	rootCmd.Flags().Bool("security.hsts_preload", false, "If set to true, consent to being included in browser HSTS preload lists")
+	rootCmd.Flags().String("security.frame_options", "DENY", "The value of the X-Frame-Options header. Set to an empty string to disable")
+	rootCmd.Flags().String("security.referrer_policy", "no-referrer", "The value of the Referrer-Policy header. Set to an empty string to disable")
+	rootCmd.Flags().StringSlice("security.no_store_paths", []string{"/oauth/token", "/oauth/refresh", "/oauth/userinfo", "/oauth/introspect", "/oauth/device/code", "/oauth/bc-authorize"}, "Responses to paths starting with any of these prefixes are never cached")
+	rootCmd.Flags().Int("security.body_limit", 4*1024*1024, "The largest request body in bytes that is accepted, except on bulk imports")
+
+	/*
+		Tracing - Provides options for exporting OpenTelemetry traces with OTLP over HTTP
+	*/
+	rootCmd.Flags().Bool("tracing.enabled", false, "If set to true, spans for requests, database commands, and token issuance are exported, along with metrics")
+	rootCmd.Flags().String("tracing.endpoint", "localhost:4318", "The host and port of the OTLP/HTTP collector that spans and metrics are exported to")
+	rootCmd.Flags().Bool("tracing.insecure", false, "If set to true, spans and metrics are exported over plain HTTP instead of HTTPS")
+	rootCmd.Flags().String("tracing.service_name", "credstack", "The service name that spans and metrics are exported with")
+	rootCmd.Flags().Float64("tracing.sample_ratio", 1, "The fraction of traces started by credstack that are recorded, from 0 to 1")
+
+	/*
+		Secrets - Provides options for resolving secret references (vault://, awssm://, file://) set in place of secrets
+	*/
+	rootCmd.Flags().Duration("secrets.refresh_interval", 5*time.Minute, "How often the database credentials are resolved again to pick up rotated credentials. Set to 0 to only resolve them at startup")
+	rootCmd.Flags().Duration("secrets.timeout", 10*time.Second, "How long resolving a single secret reference can take")
+	rootCmd.Flags().String("secrets.vault.address", "", "The address of the Vault server secrets are read from. Read from VAULT_ADDR if empty")
+	rootCmd.Flags().String("secrets.vault.token", "", "The token used to read secrets from Vault. Read from VAULT_TOKEN if empty")
+	rootCmd.Flags().String("secrets.vault.namespace", "", "The Vault Enterprise namespace secrets are read from. Read from VAULT_NAMESPACE if empty")
+	rootCmd.Flags().String("secrets.aws.region", "", "The AWS region secrets are read from in Secrets Manager. Resolved by the AWS SDK if empty")
+	rootCmd.Flags().String("secrets.aws.endpoint", "", "Overrides the Secrets Manager endpoint of the region")
+	rootCmd.Flags().String("secrets.aws.access_key_id", "", "The AWS access key ID used with Secrets Manager. Uses the default credential chain of the AWS SDK if empty")
+	rootCmd.Flags().String("secrets.aws.secret_access_key", "", "The AWS secret access key used with Secrets Manager. Only used with secrets.aws.access_key_id")
+	rootCmd.Flags().String("secrets.aws.session_token", "", "The AWS session token of temporary credentials used with Secrets Manager. Only used with secrets.aws.access_key_id")
 }
 
 func initConfig() {
+	validateOutput()
+
 	globalConfig = config.New()
-	err := globalConfig.Load(cfgFile) // default needs to be set here!
+	globalConfig.SetDataDir(dataDir)
+
+	if cfgFile == "" {
+		cfgFile = config.ConfigPath(dataDir)
+	}
+
+	err := globalConfig.Load(cfgFile)
 	if err != nil {
-		fmt.Println("Fatal error when loading config: ", err)
-		os.Exit(1)
+		exitWithError(exitFailure, "Fatal error when loading config", err)
 	}
 }
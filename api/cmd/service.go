@@ -0,0 +1,183 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultServiceName - The name the service is installed under if --name is not provided
+const defaultServiceName = "credstack"
+
+/*
+serviceOptions - Describes the service that is installed by 'service install'
+*/
+type serviceOptions struct {
+	// Name - The name of the service (the systemd unit name, or the Windows service name)
+	Name string
+
+	// Executable - The absolute path to the credstack binary that the service runs
+	Executable string
+
+	// ConfigPath - The absolute path to the config file that the service is started with
+	ConfigPath string
+
+	// DataDir - The absolute path passed to the service with --data-dir. Empty if --data-dir was not provided
+	DataDir string
+
+	// User - The user the service runs as. Only used with systemd
+	User string
+}
+
+/*
+newServiceOptions - Resolves the binary and config file the service should be installed with to absolute paths, as
+service managers start services with a different working directory and home directory than the installing user
+*/
+func newServiceOptions(cmd *cobra.Command) (*serviceOptions, error) {
+	name, _ := cmd.Flags().GetString("name")
+	user, _ := cmd.Flags().GetString("user")
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return nil, err
+	}
+
+	configPath := cfgFile
+	if strings.HasPrefix(configPath, "~") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		configPath = strings.Replace(configPath, "~", home, 1)
+	}
+
+	configPath, err = filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceDataDir := dataDir
+	if serviceDataDir != "" {
+		serviceDataDir, err = filepath.Abs(serviceDataDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &serviceOptions{
+		Name:       name,
+		Executable: executable,
+		ConfigPath: configPath,
+		DataDir:    serviceDataDir,
+		User:       user,
+	}, nil
+}
+
+/*
+serviceOutput - The output of 'service install' and 'service uninstall' in the json and yaml output formats
+*/
+type serviceOutput struct {
+	// Name - The name of the service
+	Name string `json:"name" yaml:"name"`
+
+	// Action - What was done to the service. One of: installed, uninstalled, printed
+	Action string `json:"action" yaml:"action"`
+
+	// Path - The path of the systemd unit that was written or removed. Empty on Windows
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+
+	// StartCommand - The command that starts the service after it has been installed
+	StartCommand string `json:"start_command,omitempty" yaml:"start_command,omitempty"`
+
+	// Unit - The generated systemd unit. Only set when --print is passed
+	Unit string `json:"unit,omitempty" yaml:"unit,omitempty"`
+}
+
+// serviceCmd represents the service command
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Install credstack as a system service",
+	Long: `Allows you to install and uninstall credstack as a service that is started at boot. On Linux a systemd unit is
+generated, and on Windows the binary is registered with the service control manager. The service is started with the
+config file passed with '--config' (or found under '--data-dir'), which should be readable by the user the service
+runs as. When installed as root, the config file is loaded from /etc/credstack/config.json by default.`,
+}
+
+// serviceInstallCmd represents the service install command
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install credstack as a system service",
+	Long: `Installs credstack as a service that is started at boot. This needs to be run as root (Linux) or as an
+Administrator (Windows).
+
+On Linux, a systemd unit is written to /etc/systemd/system and enabled. Logs are written to the journal, and the unit
+creates /var/log/credstack for file logging. Pass '--print' to print the unit instead of installing it.
+
+On Windows, the service is registered to start automatically and to restart if it fails. As services have no console,
+file logging is enabled and logs are written to %ProgramData%\credstack\logs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts, err := newServiceOptions(cmd)
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when resolving service paths", err)
+		}
+
+		printOnly, _ := cmd.Flags().GetBool("print")
+
+		out, err := installService(opts, printOnly)
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when installing service", err)
+		}
+
+		render(out, func(w io.Writer) {
+			if out.Unit != "" {
+				fmt.Fprint(w, out.Unit)
+				return
+			}
+
+			fmt.Fprintf(w, "Installed service %s. Start it with: %s\n", out.Name, out.StartCommand)
+		})
+	},
+}
+
+// serviceUninstallCmd represents the service uninstall command
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Uninstall the credstack system service",
+	Long:  `Stops the credstack service and removes it. The config file and any logs are left in place.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+
+		out, err := uninstallService(name)
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when uninstalling service", err)
+		}
+
+		render(out, func(w io.Writer) {
+			fmt.Fprintf(w, "Uninstalled service %s\n", out.Name)
+		})
+	},
+}
+
+func init() {
+	serviceCmd.PersistentFlags().String("name", defaultServiceName, "The name of the service")
+	serviceInstallCmd.Flags().String("user", "credstack", "The user the service runs as (systemd only)")
+	serviceInstallCmd.Flags().Bool("print", false, "Print the systemd unit instead of installing it (systemd only)")
+
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
@@ -0,0 +1,139 @@
+//go:build linux
+
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"text/template"
+
+	"github.com/credstack/credstack/api/internal/api"
+)
+
+// systemdUnitDir - The directory that administrator installed systemd units are written to
+const systemdUnitDir = "/etc/systemd/system"
+
+/*
+systemdUnit - The unit generated by 'service install'. SIGTERM is handled by the API with a graceful shutdown, so the
+stop timeout leaves room for in-flight requests to finish before systemd kills the process
+*/
+var systemdUnit = template.Must(template.New("unit").Funcs(template.FuncMap{"quote": strconv.Quote}).Parse(`[Unit]
+Description=credstack identity provider
+Documentation=https://github.com/credstack/credstack
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+User={{ .User }}
+ExecStart={{ quote .Executable }} --config {{ quote .ConfigPath }}{{ if .DataDir }} --data-dir {{ quote .DataDir }}{{ end }}
+Restart=on-failure
+RestartSec=5
+KillSignal=SIGTERM
+TimeoutStopSec=30
+LogsDirectory=credstack
+NoNewPrivileges=true
+PrivateTmp=true
+ProtectSystem=full
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+/*
+systemctl - Runs systemctl with the arguments provided in the parameter, returning its output with any error
+*/
+func systemctl(args ...string) error {
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %v: %w (%s)", args, err, bytes.TrimSpace(output))
+	}
+
+	return nil
+}
+
+/*
+installService - Writes the systemd unit for the service and enables it. If printOnly is true, the unit is returned
+instead of written, so that it can be packaged or reviewed
+*/
+func installService(opts *serviceOptions, printOnly bool) (*serviceOutput, error) {
+	var unit bytes.Buffer
+
+	err := systemdUnit.Execute(&unit, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if printOnly {
+		return &serviceOutput{Name: opts.Name, Action: "printed", Unit: unit.String()}, nil
+	}
+
+	path := filepath.Join(systemdUnitDir, opts.Name+".service")
+
+	err = os.WriteFile(path, unit.Bytes(), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = systemctl("daemon-reload")
+	if err != nil {
+		return nil, err
+	}
+
+	err = systemctl("enable", opts.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &serviceOutput{
+		Name:         opts.Name,
+		Action:       "installed",
+		Path:         path,
+		StartCommand: "systemctl start " + opts.Name,
+	}, nil
+}
+
+/*
+uninstallService - Stops and disables the service, then removes its unit
+*/
+func uninstallService(name string) (*serviceOutput, error) {
+	path := filepath.Join(systemdUnitDir, name+".service")
+
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = systemctl("disable", "--now", name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = systemctl("daemon-reload")
+	if err != nil {
+		return nil, err
+	}
+
+	return &serviceOutput{Name: name, Action: "uninstalled", Path: path}, nil
+}
+
+/*
+runAsService - systemd manages services with signals, which the API already handles, so the API is always started
+directly
+*/
+func runAsService(instance *api.Api, start func() error) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,37 @@
+//go:build !linux && !windows
+
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/credstack/credstack/api/internal/api"
+)
+
+// errServiceUnsupported - Returned from the service commands on platforms without a supported service manager
+var errServiceUnsupported = errors.New("service: installing a service is only supported on Linux (systemd) and Windows")
+
+/*
+installService - Services cannot be installed on this platform
+*/
+func installService(opts *serviceOptions, printOnly bool) (*serviceOutput, error) {
+	return nil, errServiceUnsupported
+}
+
+/*
+uninstallService - Services cannot be uninstalled on this platform
+*/
+func uninstallService(name string) (*serviceOutput, error) {
+	return nil, errServiceUnsupported
+}
+
+/*
+runAsService - There is no service manager to integrate with, so the API is always started directly
+*/
+func runAsService(instance *api.Api, start func() error) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,194 @@
+//go:build windows
+
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/credstack/credstack/api/internal/api"
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceStopTimeout - How long uninstall waits for the service to stop before deleting it
+const serviceStopTimeout = 30 * time.Second
+
+/*
+installService - Registers the binary with the service control manager. The service starts automatically at boot and is
+restarted if it fails. File logging is enabled, as services have no console for stdout logging to be read from
+*/
+func installService(opts *serviceOptions, printOnly bool) (*serviceOutput, error) {
+	if printOnly {
+		return nil, errors.New("service: --print is only supported with systemd")
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Disconnect()
+
+	existing, err := m.OpenService(opts.Name)
+	if err == nil {
+		existing.Close()
+		return nil, fmt.Errorf("service: %s is already installed", opts.Name)
+	}
+
+	logPath := config.LogPath(opts.DataDir)
+
+	err = os.MkdirAll(logPath, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"--config", opts.ConfigPath, "--log.use_file_logging", "--log.path", logPath}
+	if opts.DataDir != "" {
+		args = append(args, "--data-dir", opts.DataDir)
+	}
+
+	service, err := m.CreateService(
+		opts.Name,
+		opts.Executable,
+		mgr.Config{
+			DisplayName: "credstack",
+			Description: "The open source & cloud-native identity provider",
+			StartType:   mgr.StartAutomatic,
+		},
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer service.Close()
+
+	err = service.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &serviceOutput{
+		Name:         opts.Name,
+		Action:       "installed",
+		StartCommand: "sc.exe start " + opts.Name,
+	}, nil
+}
+
+/*
+uninstallService - Stops the service if it is running, waits for it to stop, and removes it from the service control
+manager
+*/
+func uninstallService(name string) (*serviceOutput, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Disconnect()
+
+	service, err := m.OpenService(name)
+	if err != nil {
+		return nil, fmt.Errorf("service: %s is not installed (%w)", name, err)
+	}
+	defer service.Close()
+
+	status, err := service.Query()
+	if err != nil {
+		return nil, err
+	}
+
+	if status.State != svc.Stopped {
+		_, err = service.Control(svc.Stop)
+		if err != nil {
+			return nil, err
+		}
+
+		deadline := time.After(serviceStopTimeout)
+		for status.State != svc.Stopped {
+			select {
+			case <-deadline:
+				return nil, fmt.Errorf("service: timed out waiting for %s to stop", name)
+			case <-time.After(500 * time.Millisecond):
+			}
+
+			status, err = service.Query()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = service.Delete()
+	if err != nil {
+		return nil, err
+	}
+
+	return &serviceOutput{Name: name, Action: "uninstalled"}, nil
+}
+
+/*
+windowsService - Adapts the API to the service control manager. Stop and shutdown requests are translated into a
+graceful shutdown, exactly as SIGTERM would be on other platforms
+*/
+type windowsService struct {
+	// instance - The API that is being run as a service
+	instance *api.Api
+
+	// start - Starts the API. This blocks until the API has shut down
+	start func() error
+}
+
+/*
+Execute - Runs the API and reports its state to the service control manager. Required to implement svc.Handler
+*/
+func (service *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- service.start()
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return true, 1
+			}
+
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				service.instance.Shutdown()
+			}
+		}
+	}
+}
+
+/*
+runAsService - If the process was started by the service control manager, then the API is run as a service and true is
+returned. Otherwise, false is returned and the caller should start the API directly
+*/
+func runAsService(instance *api.Api, start func() error) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+
+	return true, svc.Run(defaultServiceName, &windowsService{instance: instance, start: start})
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+// tokenCmd represents the token command
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Perform operations on issued tokens",
+	Long:  `Allows you to inspect tokens issued by credstack, for debugging integrations with it.`,
+}
+
+// tokenDecodeCmd represents the token decode command
+var tokenDecodeCmd = &cobra.Command{
+	Use:   "decode <jwt>",
+	Short: "Decode a JWT and explain why it would be rejected",
+	Long: `Decodes a JWT and prints its header and claims. The signature is verified against the JWKS stored in the
+credstack database, using the kid in the token's header, and every reason a relying party would reject the token is
+explained: an expired or not yet valid token, an unexpected audience or issuer, an unknown kid, or an invalid signature.
+
+Pass '-' to read the token from stdin. Pass '--no-verify' to decode the token without connecting to the database.
+Encrypted access tokens (nested JWTs) are unwrapped with the PEM encoded private key passed with '--decryption-key'.
+
+Exits with status code 2 if any problems are found.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		raw := args[0]
+		if raw == "-" {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				exitWithError(exitFailure, "Fatal error when reading token from stdin", err)
+			}
+
+			raw = line
+		}
+
+		raw = strings.TrimPrefix(strings.TrimSpace(raw), "Bearer ")
+
+		audience, _ := cmd.Flags().GetString("audience")
+		issuer, _ := cmd.Flags().GetString("issuer")
+		noVerify, _ := cmd.Flags().GetBool("no-verify")
+		decryptionKeyPath, _ := cmd.Flags().GetString("decryption-key")
+
+		opts := token.DecodeOptions{Audience: audience, Issuer: issuer, Verify: !noVerify}
+
+		if decryptionKeyPath != "" {
+			encoded, err := os.ReadFile(decryptionKeyPath)
+			if err != nil {
+				exitWithError(exitFailure, "Fatal error when reading decryption key", err)
+			}
+
+			opts.DecryptionKey, err = token.ParseDecryptionKey(encoded)
+			if err != nil {
+				exitWithError(exitFailure, "Fatal error when parsing decryption key", err)
+			}
+		}
+
+		serv := server.New(globalConfig)
+
+		if !noVerify {
+			err := serv.Start()
+			if err != nil {
+				exitWithError(exitFailure, "Fatal error when connecting to database", err)
+			}
+		}
+
+		decoded := token.Decode(serv, raw, opts)
+
+		if !noVerify {
+			_ = serv.Stop()
+		}
+
+		render(decoded, func(w io.Writer) {
+			if decoded.Encrypted {
+				fmt.Fprintln(w, "Encrypted: true")
+			}
+
+			fmt.Fprintln(w, "Header:")
+			writeIndented(w, decoded.Header)
+
+			fmt.Fprintln(w, "\nClaims:")
+			writeIndented(w, decoded.Claims)
+
+			for _, name := range []string{"iat", "nbf", "exp"} {
+				if value, ok := decoded.Claims[name].(float64); ok {
+					fmt.Fprintf(w, "  %s = %s\n", name, time.Unix(int64(value), 0).UTC().Format(time.RFC3339))
+				}
+			}
+
+			fmt.Fprintf(w, "\nSignature: %s\n", decoded.Signature)
+
+			if len(decoded.Problems) == 0 {
+				fmt.Fprintln(w, "\nNo problems found")
+				return
+			}
+
+			fmt.Fprintln(w, "\nProblems:")
+			for _, problem := range decoded.Problems {
+				fmt.Fprintf(w, "  - [%s] %s\n", problem.Code, problem.Message)
+			}
+		})
+
+		if len(decoded.Problems) != 0 {
+			os.Exit(exitCheckFailed)
+		}
+	},
+}
+
+/*
+writeIndented - Writes the value provided in the parameter as indented JSON
+*/
+func writeIndented(w io.Writer, value any) {
+	encoded, err := json.MarshalIndent(value, "  ", "  ")
+	if err != nil {
+		fmt.Fprintf(w, "  %v\n", value)
+		return
+	}
+
+	fmt.Fprintf(w, "  %s\n", encoded)
+}
+
+func init() {
+	tokenDecodeCmd.Flags().String("audience", "", "The audience the token is expected to be issued for. If empty, the audience is not checked")
+	tokenDecodeCmd.Flags().String("issuer", "", "The issuer the token is expected to be issued by. If empty, the issuer is not checked")
+	tokenDecodeCmd.Flags().String("decryption-key", "", "The path to the PEM encoded RSA private key of the audience, used to decrypt encrypted access tokens")
+	tokenDecodeCmd.Flags().Bool("no-verify", false, "Decode the token without verifying its signature, so that no database connection is needed")
+
+	tokenCmd.AddCommand(tokenDecodeCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
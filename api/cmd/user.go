@@ -0,0 +1,570 @@
+/*
+Copyright © 2026 Steven A. Zaluk
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osUser "os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/approval"
+	"github.com/credstack/credstack/sdk/pkg/audit"
+	"github.com/credstack/credstack/sdk/pkg/rbac/role"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"github.com/spf13/cobra"
+)
+
+/*
+Audit events recorded for changes made with the user commands that the SDK does not record itself. Password resets and
+unlocks are recorded by the SDK, as user.EventPasswordReset and user.EventUnlocked
+*/
+const (
+	// eventUserCreated - The audit event recorded when a user is created from the CLI
+	eventUserCreated = "user.created"
+
+	// eventUserDeleted - The audit event recorded when a user is deleted from the CLI
+	eventUserDeleted = "user.deleted"
+
+	// eventRoleAssigned - The audit event recorded when a role is assigned to a user from the CLI
+	eventRoleAssigned = "user.role_assigned"
+)
+
+// errNotTerminal - Returned when a secret is prompted for, but stdin is not a terminal that echo can be disabled on
+var errNotTerminal = errors.New("stdin is not a terminal. Pass --password-stdin to pipe the password through stdin instead")
+
+// errPasswordMismatch - Returned when the password and its confirmation do not match
+var errPasswordMismatch = errors.New("the passwords do not match")
+
+// errNotConfirmed - Returned when a destructive operation is not confirmed at its prompt
+var errNotConfirmed = errors.New("the operation was not confirmed. Pass --yes to skip the confirmation prompt")
+
+// userCmd represents the user command
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Perform break-glass operations on user accounts",
+	Long: `Allows you to manage and recover user accounts directly through the credstack database, for when the management
+API is unavailable. Every change is recorded in the audit log under the name of the operating system user running the
+command.`,
+}
+
+// userCreateCmd represents the user create command
+var userCreateCmd = &cobra.Command{
+	Use:   "create <email>",
+	Short: "Create a new user",
+	Long: `Creates a new user with the email address provided, in the same way as registration. The password is prompted
+for twice with echo disabled. Pass '--password-stdin' to read it from a single line of stdin instead, for use in scripts.
+
+The username defaults to the part of the email address before the @, and the phone number is optional.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		username, _ := cmd.Flags().GetString("username")
+		phone, _ := cmd.Flags().GetString("phone")
+		passwordStdin, _ := cmd.Flags().GetBool("password-stdin")
+
+		if username == "" {
+			username, _, _ = strings.Cut(args[0], "@")
+		}
+
+		password, err := readPassword(passwordStdin)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when reading password", err)
+		}
+
+		runUserAction(userActionOutput{Email: args[0], Action: "created"}, func(serv *server.Server, actor string) error {
+			err := user.Register(serv, serv.Config.CredentialConfig, args[0], username, password, phone)
+			if err != nil {
+				return err
+			}
+
+			account, err := user.Get(serv, args[0], false)
+			if err != nil {
+				return err
+			}
+
+			recordUserChange(serv, account, eventUserCreated, actor, "User created from the CLI", nil)
+
+			return nil
+		})
+	},
+}
+
+// userGetCmd represents the user get command
+var userGetCmd = &cobra.Command{
+	Use:   "get <email>",
+	Short: "Print a user",
+	Long:  `Prints the user with the email address provided. The password hash of the user is never printed.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		serv := server.New(globalConfig)
+
+		err := serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		account, err := user.Get(serv, args[0], false)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when fetching user", err)
+		}
+
+		out := newUserOutput(account)
+
+		render(out, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "Identifier:\t%s\n", out.Identifier)
+			fmt.Fprintf(tw, "Email:\t%s\n", out.Email)
+			fmt.Fprintf(tw, "Email verified:\t%t\n", out.EmailVerified)
+			fmt.Fprintf(tw, "Username:\t%s\n", out.Username)
+			fmt.Fprintf(tw, "Phone number:\t%s\n", out.PhoneNumber)
+			fmt.Fprintf(tw, "Roles:\t%s\n", strings.Join(out.Roles, ", "))
+			fmt.Fprintf(tw, "Locked:\t%t\n", out.Locked)
+			fmt.Fprintf(tw, "Created:\t%s\n", formatUnix(out.CreatedAt))
+			_ = tw.Flush()
+		})
+	},
+}
+
+// userListCmd represents the user list command
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List users",
+	Long: `Lists the users stored in the credstack database, up to the number passed with '--limit'. Use the export endpoint
+of the management API to page through every user.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		serv := server.New(globalConfig)
+
+		err := serv.Start()
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when connecting to database", err)
+		}
+
+		accounts, err := user.List(serv, limit, false)
+		_ = serv.Stop()
+
+		if err != nil {
+			exitWithError(exitFailure, "Fatal error when listing users", err)
+		}
+
+		if limit > 0 && len(accounts) > limit {
+			accounts = accounts[:limit]
+		}
+
+		out := userListOutput{Users: make([]userOutput, 0, len(accounts))}
+		for _, account := range accounts {
+			out.Users = append(out.Users, newUserOutput(account))
+		}
+
+		render(out, func(w io.Writer) {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "EMAIL\tUSERNAME\tVERIFIED\tLOCKED\tROLES\tCREATED")
+
+			for _, account := range out.Users {
+				fmt.Fprintf(
+					tw,
+					"%s\t%s\t%t\t%t\t%s\t%s\n",
+					account.Email,
+					account.Username,
+					account.EmailVerified,
+					account.Locked,
+					strings.Join(account.Roles, ","),
+					formatUnix(account.CreatedAt),
+				)
+			}
+
+			_ = tw.Flush()
+		})
+	},
+}
+
+// userDeleteCmd represents the user delete command
+var userDeleteCmd = &cobra.Command{
+	Use:   "delete <email>",
+	Short: "Delete a user",
+	Long: `Permanently deletes the user with the email address provided. This cannot be undone, so you are asked to confirm
+it first. Pass '--yes' to skip the confirmation, for use in scripts.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		err := confirm(fmt.Sprintf("Permanently delete the user %s?", args[0]), yes)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when confirming deletion", err)
+		}
+
+		if requestApproval(approval.ActionUserDelete, args[0]) {
+			return
+		}
+
+		runUserAction(userActionOutput{Email: args[0], Action: "deleted"}, func(serv *server.Server, actor string) error {
+			account, err := user.Get(serv, args[0], false)
+			if err != nil {
+				return err
+			}
+
+			err = user.Delete(serv, args[0])
+			if err != nil {
+				return err
+			}
+
+			recordUserChange(serv, account, eventUserDeleted, actor, "User deleted from the CLI", nil)
+
+			return nil
+		})
+	},
+}
+
+// userResetPasswordCmd represents the user reset-password command
+var userResetPasswordCmd = &cobra.Command{
+	Use:     "reset-password <email>",
+	Aliases: []string{"set-password"},
+	Short:   "Set a new password for a user",
+	Long: `Sets a new password for the user with the email address provided, without requiring the current one. The new
+password is prompted for twice with echo disabled. Pass '--password-stdin' to read it from a single line of stdin
+instead, for use in scripts.
+
+The password must satisfy the same length requirements as registration. The account is not unlocked, use 'user unlock'
+for this.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passwordStdin, _ := cmd.Flags().GetBool("password-stdin")
+
+		password, err := readPassword(passwordStdin)
+		if err != nil {
+			exitWithError(exitUsage, "Fatal error when reading password", err)
+		}
+
+		runUserAction(userActionOutput{Email: args[0], Action: "password_reset"}, func(serv *server.Server, actor string) error {
+			return user.ResetPassword(serv, args[0], password, actor)
+		})
+	},
+}
+
+// userUnlockCmd represents the user unlock command
+var userUnlockCmd = &cobra.Command{
+	Use:   "unlock <email>",
+	Short: "Unlock a locked user",
+	Long:  `Unlocks the user with the email address provided, so that they can log in again.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runUserAction(userActionOutput{Email: args[0], Action: "unlocked"}, func(serv *server.Server, actor string) error {
+			return user.Unlock(serv, args[0], actor)
+		})
+	},
+}
+
+// userAssignRoleCmd represents the user assign-role command
+var userAssignRoleCmd = &cobra.Command{
+	Use:   "assign-role <email> <role>",
+	Short: "Assign a role to a user",
+	Long: `Assigns the role provided to the user with the email address provided. The role must already exist. Assigning a
+role that the user already has is not an error.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		out := userActionOutput{Email: args[0], Action: "role_assigned", Role: args[1]}
+
+		runUserAction(out, func(serv *server.Server, actor string) error {
+			err := role.Assign(serv, args[0], args[1])
+			if err != nil {
+				return err
+			}
+
+			account, err := user.Get(serv, args[0], false)
+			if err != nil {
+				return err
+			}
+
+			description := fmt.Sprintf("Role %s assigned from the CLI", args[1])
+			recordUserChange(serv, account, eventRoleAssigned, actor, description, map[string]string{"role": args[1]})
+
+			return nil
+		})
+	},
+}
+
+/*
+userActionOutput - The output of the user commands in the json and yaml output formats
+*/
+type userActionOutput struct {
+	// Email - The email address of the user that was changed
+	Email string `json:"email" yaml:"email"`
+
+	// Action - The change that was made. One of: created, deleted, password_reset, unlocked, role_assigned
+	Action string `json:"action" yaml:"action"`
+
+	// Role - The role that was assigned. Only set for role_assigned
+	Role string `json:"role,omitempty" yaml:"role,omitempty"`
+
+	// Actor - The name the change was recorded under in the audit log
+	Actor string `json:"actor" yaml:"actor"`
+}
+
+/*
+userOutput - A user in the output of the user get and user list commands in the json and yaml output formats. The
+password hash of the user is never included
+*/
+type userOutput struct {
+	// Identifier - The unique identifier of the user
+	Identifier string `json:"identifier" yaml:"identifier"`
+
+	// Email - The email address of the user
+	Email string `json:"email" yaml:"email"`
+
+	// EmailVerified - Whether the user has verified their email address
+	EmailVerified bool `json:"email_verified" yaml:"email_verified"`
+
+	// Username - The username of the user
+	Username string `json:"username" yaml:"username"`
+
+	// PhoneNumber - The phone number of the user in E.164 format. Empty if they have not set one
+	PhoneNumber string `json:"phone_number" yaml:"phone_number"`
+
+	// Roles - The names of the roles assigned to the user
+	Roles []string `json:"roles" yaml:"roles"`
+
+	// Locked - Whether the user is locked out of their account
+	Locked bool `json:"locked" yaml:"locked"`
+
+	// CreatedAt - A unix timestamp representing when the user was created
+	CreatedAt int64 `json:"created_at" yaml:"created_at"`
+}
+
+/*
+userListOutput - The output of the user list command in the json and yaml output formats
+*/
+type userListOutput struct {
+	// Users - The users that were listed
+	Users []userOutput `json:"users" yaml:"users"`
+}
+
+/*
+newUserOutput - Converts the user provided in the parameter into its userOutput
+*/
+func newUserOutput(account *user.User) userOutput {
+	out := userOutput{
+		Email:         account.Email,
+		EmailVerified: account.EmailVerified,
+		Username:      account.Username,
+		PhoneNumber:   account.PhoneNumber,
+		Roles:         account.Roles,
+		Locked:        account.Locked,
+	}
+
+	if account.Header != nil {
+		out.Identifier = account.Header.Identifier
+		out.CreatedAt = account.Header.CreatedAt
+	}
+
+	if out.Roles == nil {
+		out.Roles = []string{}
+	}
+
+	return out
+}
+
+/*
+formatUnix - Formats a unix timestamp for the table output format. Zero timestamps are formatted as a dash
+*/
+func formatUnix(timestamp int64) string {
+	if timestamp == 0 {
+		return "-"
+	}
+
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+/*
+runUserAction - Connects to the database, applies a change to a user, and renders the result. The actor the change is
+recorded under is filled in on the output provided in the parameter
+*/
+func runUserAction(out userActionOutput, apply func(serv *server.Server, actor string) error) {
+	actor := cliActor()
+
+	serv := server.New(globalConfig)
+
+	err := serv.Start()
+	if err != nil {
+		exitWithError(exitFailure, "Fatal error when connecting to database", err)
+	}
+
+	err = apply(serv, actor)
+	_ = serv.Stop()
+
+	if err != nil {
+		exitWithError(exitFailure, "Fatal error when updating user", err)
+	}
+
+	out.Actor = actor
+
+	render(out, func(w io.Writer) {
+		action := strings.ReplaceAll(out.Action, "_", " ")
+		if out.Role != "" {
+			action += " " + out.Role
+		}
+
+		fmt.Fprintf(w, "User %s: %s (recorded as %s)\n", out.Email, action, out.Actor)
+	})
+}
+
+/*
+recordUserChange - Records a change made to the user provided in the parameter in the audit log, under the actor provided
+in the parameter. The email address of the user is always included in the metadata. Failures to record the change are
+logged rather than returned, as the change has already been persisted
+*/
+func recordUserChange(serv *server.Server, account *user.User, eventType string, actor string, description string, metadata map[string]string) {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+
+	metadata["email"] = account.Email
+
+	err := audit.Log(serv, eventType, actor, account.Header.Identifier, description, metadata)
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to record account change in the audit log", err)
+	}
+}
+
+/*
+cliActor - Returns the name changes made from the CLI are recorded under in the audit log. This is the name of the
+operating system user running the command, as there is no credstack identity to attribute them to
+*/
+func cliActor() string {
+	name := os.Getenv("USER")
+
+	if current, err := osUser.Current(); err == nil {
+		name = current.Username
+	}
+
+	if name == "" {
+		name = "unknown"
+	}
+
+	return "cli:" + name
+}
+
+/*
+readPassword - Reads a new password. If fromStdin is set, then it is read from a single line of stdin. Otherwise, it is
+prompted for twice on stderr with echo disabled, and both entries must match
+*/
+func readPassword(fromStdin bool) (string, error) {
+	if fromStdin {
+		return readLine()
+	}
+
+	fmt.Fprint(os.Stderr, "New password: ")
+	password, err := readSecret()
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirm, err := readSecret()
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return "", err
+	}
+
+	if password != confirm {
+		return "", errPasswordMismatch
+	}
+
+	return password, nil
+}
+
+/*
+confirm - Asks for confirmation of a destructive operation on stderr, with the prompt provided in the parameter. Only an
+answer of y or yes confirms it. If assumeYes is set, then nothing is prompted for. If stdin is closed without an answer,
+as it is in scripts, then the operation is not confirmed and errNotConfirmed is returned
+*/
+func confirm(prompt string, assumeYes bool) error {
+	if assumeYes {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
+	answer, err := readLine()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return errNotConfirmed
+		}
+
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+
+	return errNotConfirmed
+}
+
+/*
+readLine - Reads a single line from stdin without the trailing line ending. Stdin is read one byte at a time, so that
+nothing past the end of the line is consumed and the next read starts at the next line
+*/
+func readLine() (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				break
+			}
+
+			line = append(line, buf[0])
+		}
+
+		if err == io.EOF {
+			if len(line) == 0 {
+				return "", io.ErrUnexpectedEOF
+			}
+
+			break
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
+
+func init() {
+	userCreateCmd.Flags().String("username", "", "The username of the new user. Defaults to the part of the email address before the @")
+	userCreateCmd.Flags().String("phone", "", "The phone number of the new user. Normalized to E.164 format")
+	userCreateCmd.Flags().Bool("password-stdin", false, "Read the password from a single line of stdin instead of prompting for it")
+	userListCmd.Flags().Int("limit", 10, "The maximum number of users to list")
+	userDeleteCmd.Flags().BoolP("yes", "y", false, "Delete the user without asking for confirmation")
+	userResetPasswordCmd.Flags().Bool("password-stdin", false, "Read the new password from a single line of stdin instead of prompting for it")
+
+	userCmd.AddCommand(userCreateCmd)
+	userCmd.AddCommand(userGetCmd)
+	userCmd.AddCommand(userListCmd)
+	userCmd.AddCommand(userDeleteCmd)
+	userCmd.AddCommand(userResetPasswordCmd)
+	userCmd.AddCommand(userUnlockCmd)
+	userCmd.AddCommand(userAssignRoleCmd)
+	rootCmd.AddCommand(userCmd)
+}
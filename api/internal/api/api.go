@@ -7,11 +7,21 @@ import (
 	"os/signal"
 	"strconv"
 	"syscall"
+	"time"
 
+	"github.com/credstack/credstack/api/internal/middleware"
 	"github.com/credstack/credstack/api/internal/service"
+	"github.com/credstack/credstack/sdk/pkg/changelog"
 	"github.com/credstack/credstack/sdk/pkg/config"
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/lock"
+	"github.com/credstack/credstack/sdk/pkg/management"
+	"github.com/credstack/credstack/sdk/pkg/migration"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/region"
 	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/telemetry"
+	"github.com/credstack/credstack/sdk/pkg/tracing"
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/pprof"
 	"github.com/gofiber/fiber/v3/middleware/recover"
@@ -29,34 +39,111 @@ type Api struct {
 
 	// server - Dependencies required by all API handlers
 	server *server.Server
+
+	// quit - Receives the signal that starts a graceful shutdown. Signals are delivered here by the OS, or by Shutdown
+	quit chan os.Signal
+
+	// telemetry - Sends anonymous usage reports in the background. Nil unless telemetry is enabled
+	telemetry *telemetry.Reporter
+
+	// tracer - Exports the spans recorded while serving requests. Nil unless tracing is enabled
+	tracer *tracing.Provider
 }
 
+// shutdownTimeout - How long in-flight requests are given to finish once a graceful shutdown has started
+const shutdownTimeout = 10 * time.Second
+
 func (api *Api) RegisterHandlers() {
 	service.NewUserService(api.server, api.app).RegisterHandlers()
 	service.NewClientService(api.server, api.app).RegisterHandlers()
 	service.NewResourceServerService(api.server, api.app).RegisterHandlers()
 	service.NewOAuthService(api.server, api.app).RegisterHandlers()
 	service.NewWellKnownService(api.server, api.app).RegisterHandlers()
+	service.NewApprovalService(api.server, api.app).RegisterHandlers()
+	service.NewKeyService(api.server, api.app).RegisterHandlers()
+	service.NewConfigService(api.server, api.app).RegisterHandlers()
+	service.NewBannerService(api.server, api.app).RegisterHandlers()
+	service.NewSessionService(api.server, api.app).RegisterHandlers()
+	service.NewScopeService(api.server, api.app).RegisterHandlers()
+	service.NewRoleService(api.server, api.app).RegisterHandlers()
+	service.NewRegionService(api.server, api.app).RegisterHandlers()
+	service.NewTelemetryService(api.server, api.app).RegisterHandlers()
+	service.NewAuditService(api.server, api.app).RegisterHandlers()
+	service.NewTokenService(api.server, api.app).RegisterHandlers()
+	service.NewScimService(api.server, api.app).RegisterHandlers()
 }
 
 /*
 preFlight - Executes a series of pre-flight checks and initializes API dependencies. An error is returned if pre-flight
-checks fail for whatever reason. This phase can be skipped by settings api.skip_preflight == true
+checks fail for whatever reason. If another replica is executing them, then this waits for it to finish before executing
+them again. If the context provided in the parameter is cancelled while waiting, or the lock is taken over by another
+replica while they are executing (lock.ErrLockLost), then the error is returned and the API never starts serving. This
+phase can be skipped by settings api.skip_preflight == true
 */
-func (api *Api) preFlight() error {
+func (api *Api) preFlight(ctx context.Context) error {
 	api.server.Log().LogStartupEvent("PreflightCheck", "Executing pre-flight checks on database")
-	dbErrors := api.server.Database().PreFlight()
-	if len(dbErrors) != 0 {
-		for coll, err := range dbErrors {
-			api.server.Log().LogErrorEvent("Preflight validation for collection failed: "+coll, err)
-		}
 
-		return fmt.Errorf("%w: %s", ErrPreflightFailed, dbErrors)
+	/*
+		Pre-flight checks are held under a lock, so that when multiple replicas are started at the same time only one of
+		them initializes the database at a time. The others wait for the lock and then run the checks themselves, so that
+		no replica starts serving before the database has been initialized. Every check is a no-op once it has completed,
+		so running them again after another replica is cheap
+	*/
+	onWait := func() {
+		api.server.Log().LogStartupEvent("PreflightCheck", "Waiting for another replica to finish executing pre-flight checks")
 	}
 
-	// TODO: Initialize resource server and client for credstack authentication
+	return lock.WaitWithLock(ctx, api.server, "preflight", onWait, func(ctx context.Context) error {
+		serv := api.server.WithContext(ctx)
 
-	return nil
+		/*
+			Migrations that indexes depend on are applied first, as documents written by older versions would otherwise
+			prevent the indexes from being built
+		*/
+		err := migration.ApplyRequired(serv)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrPreflightFailed, err)
+		}
+
+		dbErrors := serv.Database().PreFlight()
+		if len(dbErrors) != 0 {
+			for coll, err := range dbErrors {
+				api.server.Log().LogErrorEvent("Preflight validation for collection failed: "+coll, err)
+			}
+
+			return fmt.Errorf("%w: %s", ErrPreflightFailed, dbErrors)
+		}
+
+		/*
+			Keys that live in an external signing backend have their JWK's published again from the backend, so that the
+			JWKS never drifts from the keys that tokens are actually signed with
+		*/
+		synced, err := jwk.Sync(serv)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrPreflightFailed, err)
+		}
+
+		if len(synced) != 0 {
+			api.server.Log().LogStartupEvent("PreflightCheck", fmt.Sprintf("Synced %d JWK's from the signing backend", len(synced)))
+		}
+
+		/*
+			The management API can only be called with a token from a client that is allowed to issue tokens for it, so
+			its resource server and an admin client are bootstrapped before it starts accepting requests
+		*/
+		if api.config.ManagementConfig.RequireAuthentication {
+			clientId, err := management.Bootstrap(serv)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrPreflightFailed, err)
+			}
+
+			if clientId != "" {
+				api.server.Log().LogStartupEvent("PreflightCheck", "Bootstrapped the management API admin client "+clientId+". Read its client secret with 'credstack management credentials'")
+			}
+		}
+
+		return nil
+	})
 }
 
 /*
@@ -75,6 +162,21 @@ func (api *Api) Stop(ctx context.Context) error {
 		return err // log here
 	}
 
+	if api.telemetry != nil {
+		api.telemetry.Stop()
+	}
+
+	/*
+		The spans of the requests that were just drained are flushed before the database is disconnected, as a failure to
+		export them does not prevent the API from stopping
+	*/
+	if api.tracer != nil {
+		err = api.tracer.Shutdown(ctx)
+		if err != nil {
+			api.server.Log().LogErrorEvent("Failed to export remaining spans and metrics", err)
+		}
+	}
+
 	err = api.server.Stop()
 	if err != nil {
 		return err
@@ -87,6 +189,20 @@ func (api *Api) Stop(ctx context.Context) error {
 Start - Connects to MongoDB and starts the API
 */
 func (api *Api) Start(ctx context.Context) error {
+	/*
+		Tracing is started before the database is connected, so that the commands sent while connecting and during
+		preflight are recorded as well
+	*/
+	if api.config.TracingConfig.Enabled {
+		tracer, err := tracing.NewProvider(api.config.TracingConfig)
+		if err != nil {
+			return err
+		}
+
+		api.tracer = tracer
+		api.server.Log().LogStartupEvent("Tracing", "Spans are exported to "+api.config.TracingConfig.Endpoint)
+	}
+
 	err := api.server.Start() // this needs to go.
 	if err != nil {
 		return err
@@ -95,7 +211,7 @@ func (api *Api) Start(ctx context.Context) error {
 	if api.config.ApiConfig.SkipPreflight == false {
 		api.server.Log().LogStartupEvent("PreflightCheck", "Starting preflight checks")
 
-		err = api.preFlight()
+		err = api.preFlight(ctx)
 		if err != nil {
 			return err
 		}
@@ -105,18 +221,46 @@ func (api *Api) Start(ctx context.Context) error {
 		api.server.Log().LogStartupEvent("PreflightCheck", "Preflight checks skipped. Set api.skip_preflight == false to enforce pre-flight checks")
 	}
 
+	/*
+		A failure to record configuration changes does not prevent the API from starting, as the audit log is not
+		needed for serving requests
+	*/
+	err = changelog.RecordConfig(api.server)
+	if err != nil {
+		api.server.Log().LogErrorEvent("Failed to record configuration changes", err)
+	}
+
 	api.RegisterHandlers()
 
+	if api.config.TelemetryConfig.Enabled {
+		api.server.Log().LogStartupEvent("Telemetry", "Anonymous usage reports are enabled and will be sent to "+api.config.TelemetryConfig.Endpoint)
+
+		api.telemetry = telemetry.NewReporter(api.server)
+		api.telemetry.Start()
+	}
+
+	listenConfig := api.config.ApiConfig.ListenerConfig()
+
+	err = api.config.ApiConfig.TLS.Apply(&listenConfig)
+	if err != nil {
+		return err
+	}
+
+	scheme := "HTTP"
+	if api.config.ApiConfig.TLS.Enabled() {
+		scheme = "HTTPS"
+	}
+
 	errChan := make(chan error, 1)
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
+	signal.Notify(api.quit, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
+	defer signal.Stop(api.quit)
 	go func() {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			api.server.Log().LogStartupEvent("API", "API is now listening for requests on port "+strconv.Itoa(api.config.ApiConfig.Port))
-			err := api.app.Listen(":"+strconv.Itoa(api.config.ApiConfig.Port), api.config.ApiConfig.ListenerConfig())
+			api.server.Log().LogStartupEvent("API", "API is now listening for "+scheme+" requests on port "+strconv.Itoa(api.config.ApiConfig.Port))
+			err := api.app.Listen(":"+strconv.Itoa(api.config.ApiConfig.Port), listenConfig)
 			if err != nil {
 				errChan <- err
 				return
@@ -127,8 +271,17 @@ func (api *Api) Start(ctx context.Context) error {
 	select {
 	case err := <-errChan:
 		return err
-	case <-quit:
-		err = api.Stop(ctx)
+	case sig := <-api.quit:
+		api.server.Log().LogShutdownEvent("API", "Received signal: "+sig.String())
+
+		/*
+			The context passed to Start only bounds startup, so the shutdown gets its own deadline. Otherwise, in-flight
+			requests would be cut off immediately as that context has long expired by the time a signal is received
+		*/
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err = api.Stop(shutdownCtx)
 		if err != nil {
 			return err
 		}
@@ -137,15 +290,37 @@ func (api *Api) Start(ctx context.Context) error {
 	return nil
 }
 
+/*
+Shutdown - Starts a graceful shutdown of a running API, exactly as if SIGTERM was received. This is used by service
+managers that do not deliver signals, like the Windows service control manager. Start returns once the shutdown
+completes
+*/
+func (api *Api) Shutdown() {
+	select {
+	case api.quit <- syscall.SIGTERM:
+	default:
+		// a shutdown is already pending
+	}
+}
+
 /*
 New - Constructs a new fiber.api.app with recommended configurations
 */
 func New(config *config.ServerConfig) *Api {
 	app := fiber.New(config.ApiConfig.FiberConfig())
+	serv := server.New(config)
 
 	// recovery middleware is always added to ensure that the API does not crash due to a stray panic
 	app.Use(
 		recover.New(),
+		middleware.Tracing(serv),
+		middleware.ErrorDetail(config.ApiConfig),
+		middleware.SecurityHeaders(config.SecurityConfig),
+		middleware.Timeout(config.ApiConfig),
+		middleware.LimitBody(config.SecurityConfig.BodyLimit, service.PathUserBulkImport),
+		middleware.DatabaseAvailable(serv, "/.well-known", region.PathHealth),
+		middleware.CORS(serv),
+		middleware.Deprecation(serv),
 	)
 
 	// only register pprof if options.debug == true
@@ -157,8 +332,9 @@ func New(config *config.ServerConfig) *Api {
 
 	api := &Api{
 		config: config,
-		server: server.New(config),
+		server: serv,
 		app:    app,
+		quit:   make(chan os.Signal, 1),
 	}
 
 	return api
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/gofiber/fiber/v3"
+)
+
+// ActorHeader - The header used by admins to identify themselves when requesting or approving destructive actions
+const ActorHeader = "X-Credstack-Actor"
+
+/*
+Actor - Returns the admin performing the request. If the request was authenticated by ManagementAuth, then this is the
+subject of its access token: the client ID for tokens issued with client credentials, or the user the token was issued
+on behalf of. Otherwise, as authentication of the management API is disabled, this is read from the X-Credstack-Actor
+header and is self-declared by the caller
+*/
+func Actor(c fiber.Ctx) string {
+	if issued, ok := c.Locals(managementTokenKey).(*token.Token); ok {
+		return issued.Subject
+	}
+
+	return c.Get(ActorHeader)
+}
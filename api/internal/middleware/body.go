@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"io"
+	"slices"
+
+	credstackErrors "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/gofiber/fiber/v3"
+)
+
+// ErrRequestTooLarge - Provides a named error for when a request body is larger than the limit of its path
+var ErrRequestTooLarge = credstackErrors.NewError(413, "REQUEST_TOO_LARGE", "http: The request body is too large")
+
+/*
+LimitBody - Returns a handler that rejects request bodies larger than the limit provided in the parameter with
+ErrRequestTooLarge, except on the paths provided in the streamed parameter. Request bodies are streamed (see
+ApiConfig.FiberConfig) so that the streamed paths can read bodies of any size without holding them in memory, which
+means that Fiber no longer rejects large bodies by itself: bodies within the limit are read into memory as they always
+have been, and chunked bodies are read up to the limit before the request is handled
+*/
+func LimitBody(limit int, streamed ...string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if slices.Contains(streamed, c.Path()) {
+			return c.Next()
+		}
+
+		if c.Request().Header.ContentLength() > limit {
+			return HandleError(c, ErrRequestTooLarge)
+		}
+
+		/*
+			Bodies with a known length within the limit have already been read in full. Chunked bodies have no length, so
+			they are read here with one byte past the limit, which is how we know they went over it
+		*/
+		stream := c.Request().BodyStream()
+		if stream == nil || c.Request().Header.ContentLength() >= 0 {
+			return c.Next()
+		}
+
+		body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+		if err != nil {
+			return HandleError(c, err)
+		}
+
+		if len(body) > limit {
+			return HandleError(c, ErrRequestTooLarge)
+		}
+
+		c.Request().SetBody(body)
+
+		return c.Next()
+	}
+}
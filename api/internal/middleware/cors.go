@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	// pathAuthorize - The authorization endpoint, which single page applications can start the authorization code flow from
+	pathAuthorize = "/oauth/authorize"
+
+	// pathToken - The token endpoint. Only public clients can exchange codes from a browser, as confidential clients would have to expose their secret
+	pathToken = "/oauth/token"
+
+	// pathUserInfo - The userinfo endpoint, which is called with an access token instead of a client ID
+	pathUserInfo = "/oauth/userinfo"
+
+	// pathRefresh - The endpoint that redeems refresh tokens delivered in cookies, which is only ever called from a browser
+	pathRefresh = "/oauth/refresh"
+)
+
+// corsMethods - The methods that are allowed in response to a preflight request
+const corsMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+
+/*
+CORS - Returns a handler that allows browsers to call the API cross-origin. Origins in ApiConfig.AllowedOrigins are
+allowed on every endpoint. On the browser facing endpoints, the origins registered on clients (client.Client.AllowedOrigins)
+are also allowed: on the authorization and token endpoints the origin must be registered on the client named in the
+client_id parameter (of the query, or of the form body for POST requests to the token endpoint), and the token endpoint
+only allows it for public clients. As preflight requests, and requests to the userinfo and refresh endpoints, do not
+name a client, an origin registered on any client is allowed for them.
+
+Credentials are only allowed for origins that were matched exactly. An origin that is only allowed by * receives a
+wildcard response, so that a wildcard can never expose cookies or userinfo to every site. Requests from origins that are not
+allowed are passed through without CORS headers, so the browser blocks the response
+*/
+func CORS(serv *server.Server) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		origin := c.Get(fiber.HeaderOrigin)
+		if origin == "" {
+			return c.Next()
+		}
+
+		c.Vary(fiber.HeaderOrigin)
+
+		preflight := c.Method() == fiber.MethodOptions && c.Get(fiber.HeaderAccessControlRequestMethod) != ""
+
+		allowed, exact := allowOrigin(serv.WithContext(c.Context()), c, origin, preflight)
+		if !allowed {
+			return c.Next()
+		}
+
+		if exact {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+			c.Set(fiber.HeaderAccessControlAllowCredentials, "true")
+		} else {
+			c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+		}
+
+		if !preflight {
+			return c.Next()
+		}
+
+		c.Vary(fiber.HeaderAccessControlRequestHeaders)
+		c.Set(fiber.HeaderAccessControlAllowMethods, corsMethods)
+
+		if headers := c.Get(fiber.HeaderAccessControlRequestHeaders); headers != "" {
+			c.Set(fiber.HeaderAccessControlAllowHeaders, headers)
+		}
+
+		if maxAge := serv.Config.ApiConfig.CORSMaxAge; maxAge > 0 {
+			c.Set(fiber.HeaderAccessControlMaxAge, strconv.Itoa(int(maxAge.Seconds())))
+		}
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+/*
+allowOrigin - Determines if the origin provided in the parameter can call the requested endpoint cross-origin, along
+with if it was matched exactly. Origins that cannot be checked because a client could not be fetched are not allowed
+*/
+func allowOrigin(serv *server.Server, c fiber.Ctx, origin string, preflight bool) (bool, bool) {
+	config := serv.Config.ApiConfig
+
+	if slices.Contains(config.AllowedOrigins, origin) {
+		return true, true
+	}
+
+	path := c.Path()
+	if path != pathAuthorize && path != pathToken && path != pathUserInfo && path != pathRefresh {
+		return config.AllowsOrigin(origin), false
+	}
+
+	if preflight || path == pathUserInfo || path == pathRefresh {
+		registered, err := client.OriginRegistered(serv, origin)
+		if err == nil && registered {
+			return true, true
+		}
+
+		return config.AllowsOrigin(origin), false
+	}
+
+	clientId := c.Query("client_id")
+	if clientId == "" && path == pathToken {
+		clientId = c.FormValue("client_id")
+	}
+
+	if clientId != "" {
+		app, err := client.Get(serv, clientId, false)
+		if err == nil && app.AllowsOrigin(origin) && (path != pathToken || app.IsPublic) {
+			return true, true
+		}
+	}
+
+	return config.AllowsOrigin(origin), false
+}
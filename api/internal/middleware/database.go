@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+/*
+DatabaseAvailable - Returns a handler that fails requests fast with a 503 while the database circuit breaker is open,
+instead of letting every request wait out the server selection timeout. Requests to paths starting with any of the
+prefixes provided in the parameter are always passed through, as they can be served from the document cache
+*/
+func DatabaseAvailable(serv *server.Server, skipPrefixes ...string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		for _, prefix := range skipPrefixes {
+			if strings.HasPrefix(c.Path(), prefix) {
+				return c.Next()
+			}
+		}
+
+		err := serv.Database().Available()
+		if err != nil {
+			return HandleError(c, err)
+		}
+
+		return c.Next()
+	}
+}
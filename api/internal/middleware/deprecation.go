@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+/*
+Deprecation - Returns a handler that marks responses from deprecated endpoints (DeprecationConfig.Endpoints) with
+Deprecation, Sunset, and Link headers, and logs a warning each time one is used. The client ID is read from the
+client_id query parameter when one is present, so that operators can tell which clients still need to migrate
+*/
+func Deprecation(serv *server.Server) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		notice, ok := serv.Config.DeprecationConfig.Endpoint(c.Path())
+		if ok {
+			SetDeprecationHeaders(c, notice)
+			serv.Log().LogDeprecationEvent("endpoint "+c.Path(), c.Query("client_id"), c.IP(), notice.Sunset)
+		}
+
+		return c.Next()
+	}
+}
+
+/*
+DeprecatedGrantType - Marks the response with deprecation headers and logs a warning if the grant type provided in the
+parameter has been deprecated (DeprecationConfig.GrantTypes). Handlers that issue tokens should call this once the grant
+type of the request is known
+*/
+func DeprecatedGrantType(serv *server.Server, c fiber.Ctx, grantType string, clientId string) {
+	notice, ok := serv.Config.DeprecationConfig.GrantType(grantType)
+	if !ok {
+		return
+	}
+
+	SetDeprecationHeaders(c, notice)
+	serv.Log().LogDeprecationEvent("grant type "+grantType, clientId, c.IP(), notice.Sunset)
+}
+
+/*
+SetDeprecationHeaders - Sets the Deprecation (RFC 9745), Sunset (RFC 8594), and Link headers for the notice provided in
+the parameter. If the notice has no deprecation date, then Deprecation is set to true so that clients are still told
+*/
+func SetDeprecationHeaders(c fiber.Ctx, notice config.DeprecationNotice) {
+	deprecation := "true"
+	if since := notice.SinceTime(); !since.IsZero() {
+		deprecation = "@" + strconv.FormatInt(since.Unix(), 10)
+	}
+
+	c.Set("Deprecation", deprecation)
+
+	if sunset := notice.SunsetTime(); !sunset.IsZero() {
+		c.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	}
+
+	if notice.Link != "" {
+		c.Append("Link", "<"+notice.Link+`>; rel="deprecation"`)
+	}
+}
@@ -3,22 +3,56 @@ package middleware
 import (
 	"errors"
 
+	"github.com/credstack/credstack/sdk/pkg/config"
 	credstackErrors "github.com/credstack/credstack/sdk/pkg/errors" // this needs to be fixed
 	"github.com/gofiber/fiber/v3"
 )
 
+// errorDetailKey - The key of the fiber.Ctx local that holds how much detail the error responses of the request include
+const errorDetailKey = "credstack_error_detail"
+
+// genericErrorMessage - The message returned in place of errors that are not a CredstackError when error detail is generic
+const genericErrorMessage = "http: An internal error occurred"
+
 // ErrFailedToBindResponse - Provides a named error for when fiber can't bind a request body to a model
 var ErrFailedToBindResponse = credstackErrors.NewError(400, "BIND_FAILED", "http: Failed to bind request/response body to model")
 
 /*
-HandleError - Takes a CredStack error and marshal's it into a JSON response
+ErrorDetail - Returns a handler that selects how much detail the error responses of every request include, using
+ApiConfig.ErrorDetailFor with the request path. This should be registered before any other handler that can respond
+with HandleError
+*/
+func ErrorDetail(apiConfig config.ApiConfig) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		c.Locals(errorDetailKey, apiConfig.ErrorDetailFor(c.Path()))
+
+		return c.Next()
+	}
+}
+
+/*
+HandleError - Takes a CredStack error and marshal's it into a JSON response. With generic error detail (the default),
+only the message of the named error is returned, and errors that are not named are replaced with a generic message, as
+they can come from anywhere (database drivers, parsers) and describe internals. With detailed error detail, the full
+error is returned, including the reason it was wrapped with
 */
 func HandleError(c fiber.Ctx, err error) error {
+	detailed := c.Locals(errorDetailKey) == config.ErrorDetailDetailed
+
 	var casted credstackErrors.CredstackError
 
 	if !errors.As(err, &casted) {
+		if !detailed {
+			return c.Status(500).JSON(fiber.Map{"message": genericErrorMessage})
+		}
+
 		return c.Status(500).JSON(fiber.Map{"message": err.Error()})
 	}
 
-	return c.Status(casted.HTTPStatusCode).JSON(fiber.Map{"error": casted.Short(), "message": casted.Error()})
+	message := casted.Error()
+	if detailed {
+		message = err.Error()
+	}
+
+	return c.Status(casted.HTTPStatusCode).JSON(fiber.Map{"error": casted.Short(), "message": message})
 }
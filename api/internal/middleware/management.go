@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	credstackErrors "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/management"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+// managementTokenKey - The key of the fiber.Ctx local that holds the access token a management request was authenticated with
+const managementTokenKey = "credstack_management_token"
+
+/*
+ManagementAuth - Returns a handler that authenticates management requests with their bearer access token (see
+management.Authenticate), and ensures that the token was issued with the scope management.RouteGroups maps the route to.
+Requests to routes that no scope is mapped to are always rejected. The token is stored for Actor, so this should be
+registered before ManagementPolicy, so that the policy engine sees the authenticated actor. If
+ManagementConfig.RequireAuthentication is false, then every request is passed through
+*/
+func ManagementAuth(serv *server.Server) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if !serv.Config.ManagementConfig.RequireAuthentication {
+			return c.Next()
+		}
+
+		authorization := c.Get(fiber.HeaderAuthorization)
+		if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "bearer ") {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+			return HandleError(c, token.ErrInvalidAccessToken)
+		}
+
+		issued, err := management.Authenticate(serv.WithContext(c.Context()), strings.TrimSpace(authorization[7:]))
+		if err != nil {
+			return bearerError(c, err)
+		}
+
+		required, err := management.RequiredScope(c.Method(), c.Path())
+		if err == nil {
+			err = management.RequireScopes(issued, required)
+		}
+
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, required))
+			return HandleError(c, err)
+		}
+
+		c.Locals(managementTokenKey, issued)
+
+		return c.Next()
+	}
+}
+
+/*
+bearerError - Responds with an error from authenticating a management request. If the token was rejected, then the
+WWW-Authenticate header describes why (RFC 6750 section 3)
+*/
+func bearerError(c fiber.Ctx, err error) error {
+	var casted credstackErrors.CredstackError
+	if errors.As(err, &casted) && casted.HTTPStatusCode == 401 {
+		c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="%s"`, casted.Short()))
+	}
+
+	return HandleError(c, err)
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"github.com/credstack/credstack/sdk/pkg/policy"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+/*
+ManagementPolicy - Returns a handler that consults the policy engine (PolicyEngineConfig.ManagementPath) before a
+management API request is handled, with the method, path, actor, and origin of the request as input. Requests the
+policy denies are rejected before they reach the handler. If the policy engine is not configured, then every request is
+passed through
+*/
+func ManagementPolicy(serv *server.Server) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		err := policy.Evaluate(serv.WithContext(c.Context()), &policy.Input{
+			Decision: policy.DecisionManagement,
+			Request: policy.RequestInput{
+				Method:     c.Method(),
+				Path:       c.Path(),
+				RemoteAddr: c.IP(),
+				Actor:      Actor(c),
+			},
+		})
+		if err != nil {
+			return HandleError(c, err)
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/gofiber/fiber/v3"
+)
+
+/*
+SecurityHeaders - Returns a handler that applies the security headers configured in SecurityConfig to every response:
+Strict-Transport-Security, X-Content-Type-Options, X-Frame-Options, Referrer-Policy, and Cache-Control: no-store on the
+paths that carry tokens. The headers are applied once the request has been handled, and only where the handler did not
+set them itself, so that pages with their own framing or caching rules keep them
+*/
+func SecurityHeaders(config config.SecurityConfig) fiber.Handler {
+	hsts := config.StrictTransportSecurity()
+
+	return func(c fiber.Ctx) error {
+		err := c.Next()
+		if !config.Headers {
+			return err
+		}
+
+		setDefaultHeader(c, fiber.HeaderXContentTypeOptions, "nosniff")
+		setDefaultHeader(c, fiber.HeaderStrictTransportSecurity, hsts)
+		setDefaultHeader(c, fiber.HeaderReferrerPolicy, config.ReferrerPolicy)
+
+		/*
+			A frame-ancestors directive overrides X-Frame-Options in browsers that support it, but older browsers would
+			still refuse to frame a page that was deliberately allowed to be framed by a single origin
+		*/
+		if !strings.Contains(c.GetRespHeader(fiber.HeaderContentSecurityPolicy), "frame-ancestors") {
+			setDefaultHeader(c, fiber.HeaderXFrameOptions, config.FrameOptions)
+		}
+
+		if config.NoStore(c.Path()) {
+			c.Set(fiber.HeaderCacheControl, "no-store")
+			c.Set(fiber.HeaderPragma, "no-cache")
+		}
+
+		return err
+	}
+}
+
+/*
+setDefaultHeader - Sets the response header provided in the parameter, unless the handler already set it or the value
+is empty
+*/
+func setDefaultHeader(c fiber.Ctx, key string, value string) {
+	if value == "" || c.GetRespHeader(key) != "" {
+		return
+	}
+
+	c.Set(key, value)
+}
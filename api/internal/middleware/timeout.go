@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackErrors "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/gofiber/fiber/v3"
+)
+
+// ErrRequestTimeout - Provides a named error for when a request does not complete before its deadline
+var ErrRequestTimeout = credstackErrors.NewError(503, "REQUEST_TIMEOUT", "http: The request did not complete before its deadline")
+
+/*
+Timeout - Returns a handler that applies a deadline to every request, using ApiConfig.Timeout to select the deadline for
+the request path. The deadline is set on the requests context (fiber.Ctx.Context), which handlers pass to the SDK with
+server.Server.WithContext, so the database calls made on behalf of the request are cancelled once it elapses.
+
+If the deadline elapses and the handler failed (it returned context.DeadlineExceeded, or responded with a server error),
+then its response is discarded and ErrRequestTimeout is returned instead. A handler that completed successfully has
+already made its changes, so its response is always kept, even if the deadline elapsed before it returned
+*/
+func Timeout(apiConfig config.ApiConfig) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		timeout := apiConfig.Timeout(c.Path())
+		if timeout <= 0 {
+			return c.Next()
+		}
+
+		parent := c.Context()
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		c.SetContext(ctx)
+		defer func() {
+			cancel()
+			c.SetContext(parent)
+		}()
+
+		err := c.Next()
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.Response().ResetBody()
+			return HandleError(c, ErrRequestTimeout)
+		}
+
+		if err == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && c.Response().StatusCode() >= 500 {
+			c.Response().ResetBody()
+			return HandleError(c, ErrRequestTimeout)
+		}
+
+		return err
+	}
+}
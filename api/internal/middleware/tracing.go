@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/tracing"
+	"github.com/gofiber/fiber/v3"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+requestCarrier - Reads the trace context of an incoming request from its headers, so that it can be extracted with
+tracing.Extract
+*/
+type requestCarrier struct {
+	c fiber.Ctx
+}
+
+// Get - Returns the value of the request header provided in the parameter
+func (carrier requestCarrier) Get(key string) string {
+	return carrier.c.Get(key)
+}
+
+// Set - Sets the response header provided in the parameter
+func (carrier requestCarrier) Set(key string, value string) {
+	carrier.c.Set(key, value)
+}
+
+// Keys - Returns the names of every request header
+func (carrier requestCarrier) Keys() []string {
+	headers := carrier.c.GetReqHeaders()
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+/*
+Tracing - Returns a handler that records a server span for every request while tracing is enabled. If the request carries
+a traceparent header, then the span continues the trace of the caller. The span is set on the requests context
+(fiber.Ctx.Context), so that anything the request does with that context is recorded as part of it. Spans are named after
+the route that handled the request (GET /oauth/token), so that requests to the same route are grouped together, and
+responses with a 5xx status are marked as failed
+*/
+func Tracing(serv *server.Server) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if !serv.Config.TracingConfig.Enabled {
+			return c.Next()
+		}
+
+		parent := c.Context()
+		ctx, span := tracing.StartKind(
+			tracing.Extract(parent, requestCarrier{c: c}),
+			c.Method(),
+			trace.SpanKindServer,
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLPath(c.Path()),
+			semconv.URLScheme(c.Scheme()),
+			semconv.ClientAddress(c.IP()),
+			semconv.UserAgentOriginal(c.Get(fiber.HeaderUserAgent)),
+		)
+
+		c.SetContext(ctx)
+		defer c.SetContext(parent)
+
+		err := c.Next()
+
+		/*
+			Errors returned by handlers have not been written to the response yet, so their status is read from the error
+			itself
+		*/
+		status := c.Response().StatusCode()
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, fiber.ErrInternalServerError.Message)
+		}
+
+		tracing.End(span, err)
+
+		return err
+	}
+}
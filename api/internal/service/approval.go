@@ -0,0 +1,148 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/approval"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+/*
+approvalRequest - The request body used for requesting approval of an action directly
+*/
+type approvalRequest struct {
+	// Action - The name of the action to execute (key.rotate, token.revoke_all)
+	Action string `json:"action"`
+
+	// Target - The object the action is executed against
+	Target string `json:"target"`
+}
+
+type ApprovalService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *ApprovalService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *ApprovalService) RegisterHandlers() {
+	svc.group.Get("", svc.GetApprovalHandler)
+	svc.group.Post("", svc.PostApprovalHandler)
+	svc.group.Post("/approve", svc.ApproveHandler)
+	svc.group.Post("/reject", svc.RejectHandler)
+}
+
+/*
+GetApprovalHandler - Provides a Fiber handler for processing a GET request to /approval. If an identifier is not
+provided, then approvals are listed and can be filtered with the status query parameter. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ApprovalService) GetApprovalHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	identifier := c.Query("id")
+	if identifier == "" {
+		limit, err := strconv.Atoi(c.Query("limit", "10"))
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		approvals, err := approval.List(serv, c.Query("status", approval.StatusPending), limit)
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		return c.JSON(approvals)
+	}
+
+	ret, err := approval.Get(serv, identifier)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(ret)
+}
+
+/*
+PostApprovalHandler - Provides a Fiber handler for processing a POST request to /approval. This is used for actions
+that have no endpoint of their own (key.rotate, token.revoke_all). This should not be called directly, and should only
+ever be passed to Fiber
+*/
+func (svc *ApprovalService) PostApprovalHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model approvalRequest
+
+	err := middleware.BindJSON(c, &model)
+	if err != nil {
+		return err
+	}
+
+	ret, err := approval.Request(serv, model.Action, model.Target, middleware.Actor(c))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(202).JSON(&fiber.Map{"message": "Approval requested successfully", "approval": ret})
+}
+
+/*
+ApproveHandler - Provides a Fiber handler for processing a POST request to /approval/approve. The action is executed
+once it is approved. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *ApprovalService) ApproveHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	ret, err := approval.Approve(serv, c.Query("id"), middleware.Actor(c))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(200).JSON(&fiber.Map{"message": "Approved and executed action successfully", "approval": ret})
+}
+
+/*
+RejectHandler - Provides a Fiber handler for processing a POST request to /approval/reject. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ApprovalService) RejectHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	ret, err := approval.Reject(serv, c.Query("id"), middleware.Actor(c))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(200).JSON(&fiber.Map{"message": "Rejected action successfully", "approval": ret})
+}
+
+/*
+requireApproval - Checks if the action requires approval. If it does, then a pending approval is requested and a 202
+response is written, and true is returned so that the calling handler returns without executing the action
+*/
+func requireApproval(serv *server.Server, c fiber.Ctx, action string, target string) (bool, error) {
+	if !serv.Config.ApprovalConfig.Required(action) {
+		return false, nil
+	}
+
+	ret, err := approval.Request(serv, action, target, middleware.Actor(c))
+	if err != nil {
+		return true, middleware.HandleError(c, err)
+	}
+
+	return true, c.Status(202).JSON(&fiber.Map{"message": "This action requires approval from a second admin", "approval": ret})
+}
+
+func NewApprovalService(server *server.Server, app *fiber.App) *ApprovalService {
+	return &ApprovalService{
+		server: server,
+		group:  app.Group("/approval", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
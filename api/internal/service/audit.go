@@ -0,0 +1,74 @@
+package service
+
+import (
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/audit"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+type AuditService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *AuditService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *AuditService) RegisterHandlers() {
+	svc.group.Get("", svc.GetAuditHandler)
+	svc.group.Get("/export", svc.GetAuditExportHandler)
+}
+
+/*
+GetAuditHandler - Provides a Fiber handler for processing a GET request to /audit. Returns a single page of audit
+records, filtered and projected with the fields, sub, from, to, after, and limit query parameters. This should not be
+called directly, and should only ever be passed to Fiber
+*/
+func (svc *AuditService) GetAuditHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	opts, err := queryOptions(c)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	page, err := audit.List(serv, opts)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(page)
+}
+
+/*
+GetAuditExportHandler - Provides a Fiber handler for processing a GET request to /audit/export. Streams every audit
+record matching the same query parameters as GetAuditHandler as newline delimited JSON, ignoring the limit. This should
+not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *AuditService) GetAuditExportHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	opts, err := queryOptions(c)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	stream, err := audit.Export(serv, opts)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return sendStream(c, serv, stream)
+}
+
+func NewAuditService(server *server.Server, app *fiber.App) *AuditService {
+	return &AuditService{
+		server: server,
+		group:  app.Group("/audit", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
@@ -0,0 +1,594 @@
+package service
+
+import (
+	"bytes"
+	"crypto/subtle"
+	_ "embed"
+	"errors"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/banner"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/federation"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/flow"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/session"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"github.com/gofiber/fiber/v3"
+	"github.com/spf13/viper"
+)
+
+// sessionCookie - The name of the cookie holding the session ID (see session.Start), which prompt=none requests are completed against
+const sessionCookie = "credstack_session"
+
+// sessionCookiePath - The path the session cookie is sent to. This covers the authorization and end session endpoints
+const sessionCookiePath = "/oauth"
+
+// loginCSRFCookie - The name of the HttpOnly cookie holding the CSRF token the hosted login form must post back in loginCSRFField
+const loginCSRFCookie = "credstack_login_csrf"
+
+// loginCSRFField - The hidden field of the hosted login form that the CSRF token is posted back in
+const loginCSRFField = "csrf_token"
+
+// ErrLoginOriginMismatch - Returned when the hosted login form is posted from an origin other than credstack's own
+var ErrLoginOriginMismatch = credstackError.NewError(403, "LOGIN_ORIGIN_MISMATCH", "http: The login form was not posted from the origin it was served from")
+
+// webMessageTemplate - The page that posts the authorization response to the client in the web_message response mode
+//
+//go:embed templates/web_message.html
+var webMessageTemplate string
+
+// webMessagePage - The parsed web_message page
+var webMessagePage = template.Must(template.New("web_message").Parse(webMessageTemplate))
+
+// defaultLoginTemplate - The built-in hosted login page. Replaced by AuthorizationConfig.LoginTemplate if it is set
+//
+//go:embed templates/login.html
+var defaultLoginTemplate string
+
+/*
+loginPage - The data the hosted login page template is rendered with. Custom templates can use any of these fields
+*/
+type loginPage struct {
+	// ClientName - The name of the client requesting authorization
+	ClientName string
+
+	// Scopes - The scopes the client is requesting
+	Scopes []string
+
+	// Action - The URL the login form is posted to
+	Action string
+
+	// Params - The parameters of the authorization request. These must be posted back as hidden fields
+	Params map[string]string
+
+	// Email - The email address that was entered, so that it can be pre-filled after a failed login
+	Email string
+
+	// Error - A message describing why the last login attempt failed. Empty on the first render
+	Error string
+
+	// Banners - The announcements that are currently displayed for the client, most severe first
+	Banners []*banner.Banner
+
+	// Connections - The upstream identity providers the user can sign in with instead of a password
+	Connections []loginConnection
+}
+
+/*
+loginConnection - An upstream identity provider listed on the hosted login page
+*/
+type loginConnection struct {
+	// Name - The name of the connection
+	Name string
+
+	// DisplayName - The name of the identity provider shown to the user (Continue with Google)
+	DisplayName string
+
+	// URL - The URL that starts signing in through the connection. This is the authorization endpoint with the connection parameter added
+	URL string
+}
+
+/*
+loadLoginTemplate - Parses the hosted login page template. If AuthorizationConfig.LoginTemplate is set, then the file
+it points to is parsed instead of the built-in page. If the override cannot be parsed, the error is logged and the
+built-in page is used, so that a broken override never takes the authorization endpoint down
+*/
+func loadLoginTemplate(serv *server.Server) *template.Template {
+	path := serv.Config.AuthorizationConfig.LoginTemplate
+	if path != "" {
+		tmpl, err := template.ParseFiles(path)
+		if err == nil {
+			return tmpl
+		}
+
+		serv.Log().LogErrorEvent("Failed to parse login template, falling back to the built-in page: "+path, err)
+	}
+
+	return template.Must(template.New("login").Parse(defaultLoginTemplate))
+}
+
+/*
+GetAuthorizeHandler - Provides a fiber handler for processing a GET request to /oauth/authorize. The authorization
+request is validated and the hosted login page is rendered. If the client or redirect URI cannot be validated, the error
+is returned directly instead of redirecting, as the redirect URI cannot be trusted. Any other validation error is
+returned to the redirect URI.
+
+Requests with prompt=none never render the login page, and are completed against the user's login session instead (see
+flow.SilentAuthorize). Requests with a connection parameter redirect the user to the upstream identity provider it names
+instead (see federation.Start). This should not be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) GetAuthorizeHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req := new(request.AuthorizationRequest)
+
+	if err := c.Bind().Query(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	app, err := flow.ValidateAuthorizationRequest(serv, req, viper.GetString("issuer"))
+	if err != nil {
+		return svc.authorizeError(c, req, err)
+	}
+
+	if flow.HasPrompt(req, flow.PromptNone) {
+		resp, err := flow.SilentAuthorize(serv, app, req, c.Cookies(sessionCookie), viper.GetString("issuer"))
+		if err != nil {
+			return svc.redirectError(c, app, req, err)
+		}
+
+		return svc.respond(c, app, req, resp)
+	}
+
+	if connection := c.Query("connection"); connection != "" {
+		location, err := federation.Start(serv, connection, req, viper.GetString("issuer"))
+		if err != nil {
+			return svc.redirectError(c, app, req, err)
+		}
+
+		return c.Redirect().Status(fiber.StatusFound).To(location)
+	}
+
+	return svc.renderLogin(c, app, req, "", "")
+}
+
+/*
+PostAuthorizeHandler - Provides a fiber handler for processing a POST request to /oauth/authorize, which is sent by the
+hosted login page. The authorization request is validated again, as the hidden fields can be modified by the user agent.
+If the user denies the request, access_denied is returned to the redirect URI. Otherwise, the user is authenticated with
+their email address and password and redirected back to the client with the authorization response, and a login session
+is started for prompt=none requests. Failed logins re-render the login page.
+
+The form is protected against CSRF (and login CSRF) before anything else is done with it: it must be posted from
+credstack's own origin (see sameOrigin), and must post back the CSRF token it was rendered with (see loginCSRFToken). A
+form without a matching token is rendered again with a new one, as the cookie holding it may simply have expired. This
+should not be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostAuthorizeHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req := new(request.AuthorizationRequest)
+
+	if err := c.Bind().Body(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	if !sameOrigin(c) {
+		return middleware.HandleError(c, ErrLoginOriginMismatch)
+	}
+
+	app, err := flow.ValidateAuthorizationRequest(serv, req, viper.GetString("issuer"))
+	if err != nil {
+		return svc.authorizeError(c, req, err)
+	}
+
+	expected, sent := c.Cookies(loginCSRFCookie), c.FormValue(loginCSRFField)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(sent)) != 1 {
+		return svc.renderLogin(c, app, req, c.FormValue("email"), "The login form has expired. Sign in again")
+	}
+
+	if c.FormValue("decision") != "approve" {
+		return svc.redirectError(c, app, req, flow.ErrAuthorizationDenied)
+	}
+
+	email := c.FormValue("email")
+
+	account, err := user.Login(serv, email, c.FormValue("password"))
+	if err != nil {
+		if errors.Is(err, user.ErrUserCredentialInvalid) {
+			return svc.renderLogin(c, app, req, email, "The email address or password is incorrect")
+		}
+
+		if errors.Is(err, user.ErrUserLocked) {
+			return svc.renderLogin(c, app, req, email, "This account is locked. Contact an administrator to unlock it")
+		}
+
+		return svc.redirectError(c, app, req, err)
+	}
+
+	return svc.completeAuthorization(c, app, req, account)
+}
+
+/*
+GetFederationCallbackHandler - Provides a fiber handler for processing a GET request to /oauth/federation/callback, which
+upstream identity providers redirect the user back to once they have signed in (see federation.Callback). The
+authorization request the sign in was started for is completed for the user the identity is linked to (see
+completeFederation). This should not be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) GetFederationCallbackHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req, account, err := federation.Callback(serv, c.Query("state"), c.Query("code"), c.Query("error"))
+
+	return svc.completeFederation(c, req, account, err)
+}
+
+/*
+PostSAMLAssertionHandler - Provides a fiber handler for processing a POST request to /oauth/federation/saml/acs, the
+assertion consumer service SAML identity providers post their responses to once the user has signed in (see
+federation.AssertionCallback). The response is handled like the federation callback. This should not be called directly,
+and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostSAMLAssertionHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req, account, err := federation.AssertionCallback(serv, c.FormValue("SAMLResponse"), c.FormValue("RelayState"), viper.GetString("issuer"))
+
+	return svc.completeFederation(c, req, account, err)
+}
+
+/*
+GetSAMLMetadataHandler - Provides a fiber handler for processing a GET request to /oauth/federation/saml/metadata, which
+serves the metadata SAML identity providers import credstack as a service provider from. This should not be called
+directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) GetSAMLMetadataHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	c.Set(fiber.HeaderContentType, "application/samlmetadata+xml")
+
+	return c.Send(federation.ServiceProviderMetadata(serv, viper.GetString("issuer")))
+}
+
+/*
+completeFederation - Completes the authorization request a sign in through an upstream identity provider was started for,
+for the user the identity is linked to. The authorization request is validated again first. If the sign in cannot be
+matched to an authorization request, the error is returned directly, as there is no redirect URI to return it to. Users
+that already have an account under the email address of the identity, and locked users, are shown the login page with an
+explanation
+*/
+func (svc *OAuthService) completeFederation(c fiber.Ctx, req *request.AuthorizationRequest, account *user.User, err error) error {
+	serv := svc.server.WithContext(c.Context())
+
+	if req == nil {
+		return middleware.HandleError(c, err)
+	}
+
+	app, validateErr := flow.ValidateAuthorizationRequest(serv, req, viper.GetString("issuer"))
+	if validateErr != nil {
+		return svc.authorizeError(c, req, validateErr)
+	}
+
+	if err != nil {
+		if errors.Is(err, user.ErrIdentityEmailConflict) {
+			return svc.renderLogin(c, app, req, "", "An account already exists with this email address. Sign in with your password instead")
+		}
+
+		if errors.Is(err, user.ErrUserLocked) {
+			return svc.renderLogin(c, app, req, "", "This account is locked. Contact an administrator to unlock it")
+		}
+
+		return svc.redirectError(c, app, req, err)
+	}
+
+	return svc.completeAuthorization(c, app, req, account)
+}
+
+/*
+completeAuthorization - Completes the authorization request for the user that signed in, and returns the authorization
+response to the client. The session is started first, so that the tokens issued from this authorization are bound to it
+and are revoked when the user signs out everywhere
+*/
+func (svc *OAuthService) completeAuthorization(c fiber.Ctx, app *client.Client, req *request.AuthorizationRequest, account *user.User) error {
+	serv := svc.server.WithContext(c.Context())
+
+	sessionRef := svc.startSession(c, account.Subject(), app.ClientId)
+
+	resp, err := flow.Authorize(serv, app, req, account.Subject(), sessionRef, viper.GetString("issuer"))
+	if err != nil {
+		return svc.redirectError(c, app, req, err)
+	}
+
+	return svc.respond(c, app, req, resp)
+}
+
+/*
+startSession - Starts (or extends) the user's session and stores it in the session cookie, and returns the identifier of
+the session so that tokens can be bound to it. The cookie is only sent back to the OAuth endpoints. It is SameSite=None
+over HTTPS, so that it is sent from the hidden iframes single page applications make prompt=none requests from. A
+session that cannot be started only prevents later prompt=none requests from succeeding, so the error is logged and the
+login is completed regardless, with an empty identifier
+*/
+func (svc *OAuthService) startSession(c fiber.Ctx, subject string, clientId string) string {
+	serv := svc.server.WithContext(c.Context())
+
+	sessionId, started, err := session.Start(serv, c.Cookies(sessionCookie), subject, clientId, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to start session", err)
+		return ""
+	}
+
+	if sessionId == "" {
+		return ""
+	}
+
+	secure := c.Scheme() == "https"
+
+	sameSite := fiber.CookieSameSiteLaxMode
+	if secure {
+		sameSite = fiber.CookieSameSiteNoneMode
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     sessionCookie,
+		Value:    sessionId,
+		Path:     sessionCookiePath,
+		Expires:  time.Unix(started.AbsoluteExpiresAt, 0),
+		Secure:   secure,
+		HTTPOnly: true,
+		SameSite: sameSite,
+	})
+
+	return started.Header.Identifier
+}
+
+/*
+respond - Returns a successful authorization response to the client, with a redirect or with a web message depending on
+the response mode of the request
+*/
+func (svc *OAuthService) respond(c fiber.Ctx, app *client.Client, req *request.AuthorizationRequest, resp *response.AuthorizationResponse) error {
+	if req.ResponseMode == flow.ResponseModeWebMessage {
+		return svc.webMessage(c, app, req, flow.AuthorizationParams(resp))
+	}
+
+	location, err := flow.AuthorizationRedirect(app, req, resp)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Redirect().Status(fiber.StatusFound).To(location)
+}
+
+/*
+authorizeError - Handles an error returned while validating an authorization request. Errors about the client or the
+redirect URI are returned directly to the user agent, and every other error is returned to the redirect URI
+*/
+func (svc *OAuthService) authorizeError(c fiber.Ctx, req *request.AuthorizationRequest, err error) error {
+	serv := svc.server.WithContext(c.Context())
+
+	if errors.Is(err, flow.ErrRedirectURIMismatch) || errors.Is(err, client.ErrClientDoesNotExist) || errors.Is(err, client.ErrClientMissingIdentifier) || req.ClientId == "" {
+		return middleware.HandleError(c, err)
+	}
+
+	app, getErr := client.Get(serv, req.ClientId, false)
+	if getErr != nil {
+		return middleware.HandleError(c, getErr)
+	}
+
+	return svc.redirectError(c, app, req, err)
+}
+
+/*
+redirectError - Redirects the user agent back to the client with the error provided in the parameter, or posts it to the
+client if the request uses the web_message response mode
+*/
+func (svc *OAuthService) redirectError(c fiber.Ctx, app *client.Client, req *request.AuthorizationRequest, err error) error {
+	if req.ResponseMode == flow.ResponseModeWebMessage {
+		return svc.webMessage(c, app, req, flow.AuthorizationErrorParams(req, err))
+	}
+
+	location, redirectErr := flow.AuthorizationErrorRedirect(app, req, err)
+	if redirectErr != nil {
+		return middleware.HandleError(c, redirectErr)
+	}
+
+	return c.Redirect().Status(fiber.StatusFound).To(location)
+}
+
+/*
+webMessage - Renders a page that posts the authorization response to the window that opened the authorization endpoint
+(the web_message response mode). The message is only ever posted to the origin of the client's redirect URI, and only
+that origin may frame the page. The script is allowed by a nonce, so that nothing else can run on the page
+*/
+func (svc *OAuthService) webMessage(c fiber.Ctx, app *client.Client, req *request.AuthorizationRequest, params url.Values) error {
+	origin, err := flow.WebMessageOrigin(app, req)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	nonce, err := secret.RandString(16)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	values := make(map[string]string, len(params))
+	for name := range params {
+		values[name] = params.Get(name)
+	}
+
+	var body bytes.Buffer
+
+	err = webMessagePage.Execute(&body, map[string]any{"Nonce": nonce, "Origin": origin, "Response": values})
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; script-src 'nonce-"+nonce+"'; frame-ancestors "+origin)
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+
+	return c.Send(body.Bytes())
+}
+
+/*
+activeBanners - Returns the banners to display on the hosted pages of a client. Banners are informational, so if they
+cannot be fetched the error is logged and the page is rendered without them
+*/
+func (svc *OAuthService) activeBanners(serv *server.Server, clientId string) []*banner.Banner {
+	ret, err := banner.Active(serv, clientId)
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to fetch banners for client: "+clientId, err)
+		return nil
+	}
+
+	return ret
+}
+
+/*
+renderLogin - Renders the hosted login page for the authorization request. The page is never cached and cannot be
+framed, so that the consent buttons cannot be overlaid by another site (clickjacking)
+*/
+func (svc *OAuthService) renderLogin(c fiber.Ctx, app *client.Client, req *request.AuthorizationRequest, email string, message string) error {
+	serv := svc.server.WithContext(c.Context())
+
+	/*
+		The login page is also rendered from the federation callbacks, which the login form cannot be posted to
+	*/
+	action := c.Path()
+	if action == federation.PathCallback || action == federation.PathSAMLAssertionConsumer {
+		action = sessionCookiePath + "/authorize"
+	}
+
+	page := loginPage{
+		ClientName: app.Name,
+		Scopes:     strings.Fields(req.Scope),
+		Action:     action,
+		Params: map[string]string{
+			"response_type":         req.ResponseType,
+			"client_id":             req.ClientId,
+			"redirect_uri":          req.RedirectUri,
+			"audience":              req.Audience,
+			"scope":                 req.Scope,
+			"state":                 req.State,
+			"nonce":                 req.Nonce,
+			"prompt":                req.Prompt,
+			"response_mode":         req.ResponseMode,
+			"request":               req.Request,
+			"code_challenge":        req.CodeChallenge,
+			"code_challenge_method": req.CodeChallengeMethod,
+		},
+		Email:   email,
+		Error:   message,
+		Banners: svc.activeBanners(serv, app.ClientId),
+	}
+
+	for _, connection := range federation.Available(serv, app.ClientId) {
+		query := url.Values{}
+		for name, value := range page.Params {
+			if value != "" {
+				query.Set(name, value)
+			}
+		}
+
+		query.Set("connection", connection.Name)
+
+		page.Connections = append(page.Connections, loginConnection{
+			Name:        connection.Name,
+			DisplayName: connection.DisplayName,
+			URL:         action + "?" + query.Encode(),
+		})
+	}
+
+	/*
+		The CSRF token is added once the connection URLs have been built, so that it is only ever posted back in the form
+		and never leaks into a URL. It is a hidden field like the parameters of the request, so that custom login
+		templates post it back without any changes
+	*/
+	csrfToken, err := svc.loginCSRFToken(c)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	page.Params[loginCSRFField] = csrfToken
+
+	var body bytes.Buffer
+
+	err = svc.loginTemplate.Execute(&body, page)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderXFrameOptions, "DENY")
+	c.Set(fiber.HeaderContentSecurityPolicy, "frame-ancestors 'none'")
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+
+	if message != "" {
+		c.Status(fiber.StatusUnauthorized)
+	}
+
+	return c.Send(body.Bytes())
+}
+
+/*
+loginCSRFToken - Returns the CSRF token the hosted login form is rendered with. The token is kept in an HttpOnly cookie
+for the rest of the browser session, and is re-used by every login page rendered in it, so that a form left open in one
+tab is not invalidated by rendering another. The cookie is SameSite=Strict, so it is never sent with a form posted from
+another site, which cannot read the token to post it back either
+*/
+func (svc *OAuthService) loginCSRFToken(c fiber.Ctx) (string, error) {
+	token := c.Cookies(loginCSRFCookie)
+	if token != "" {
+		return token, nil
+	}
+
+	token, err := secret.RandString(32)
+	if err != nil {
+		return "", err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     loginCSRFCookie,
+		Value:    token,
+		Path:     sessionCookiePath,
+		Secure:   c.Scheme() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+
+	return token, nil
+}
+
+/*
+sameOrigin - Determines if the request was sent from credstack's own origin, by the Origin header, or by the Referer
+header if the browser did not send one. Requests without either are allowed, as older browsers omit both, and are left
+to the CSRF token alone
+*/
+func sameOrigin(c fiber.Ctx) bool {
+	expected := c.Scheme() + "://" + c.Host()
+
+	if origin := c.Get(fiber.HeaderOrigin); origin != "" {
+		return origin == expected
+	}
+
+	referer := c.Get(fiber.HeaderReferer)
+	if referer == "" {
+		return true
+	}
+
+	parsed, err := url.Parse(referer)
+	if err != nil {
+		return false
+	}
+
+	return parsed.Scheme+"://"+parsed.Host == expected
+}
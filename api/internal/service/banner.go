@@ -0,0 +1,103 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/banner"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+type BannerService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *BannerService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *BannerService) RegisterHandlers() {
+	svc.group.Get("", svc.GetBannerHandler)
+	svc.group.Post("", svc.PostBannerHandler)
+	svc.group.Delete("", svc.DeleteBannerHandler)
+}
+
+/*
+GetBannerHandler - Provides a Fiber handler for processing a GET request to /banner. If an identifier is not provided,
+then banners are listed. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *BannerService) GetBannerHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	identifier := c.Query("id")
+	if identifier == "" {
+		limit, err := strconv.Atoi(c.Query("limit", "10"))
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		banners, err := banner.List(serv, limit)
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		return c.JSON(banners)
+	}
+
+	ret, err := banner.Get(serv, identifier)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(ret)
+}
+
+/*
+PostBannerHandler - Provides a Fiber handler for processing a POST request to /banner. The banner is displayed on the
+hosted pages between its start and end times. This should not be called directly, and should only ever be passed to
+Fiber
+*/
+func (svc *BannerService) PostBannerHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model banner.Banner
+
+	err := middleware.BindJSON(c, &model)
+	if err != nil {
+		return err
+	}
+
+	ret, err := banner.New(serv, &model)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Created banner successfully", "banner": ret})
+}
+
+/*
+DeleteBannerHandler - Provides a Fiber handler for processing a DELETE request to /banner. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *BannerService) DeleteBannerHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	err := banner.Delete(serv, c.Query("id"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(200).JSON(&fiber.Map{"message": "Deleted banner successfully"})
+}
+
+func NewBannerService(server *server.Server, app *fiber.App) *BannerService {
+	return &BannerService{
+		server: server,
+		group:  app.Group("/banner", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"strconv"
 
 	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/approval"
 	"github.com/credstack/credstack/sdk/pkg/oauth/client"
 	"github.com/credstack/credstack/sdk/pkg/server"
 	"github.com/gofiber/fiber/v3"
@@ -24,6 +25,7 @@ func (svc *ClientService) Group() fiber.Router {
 func (svc *ClientService) RegisterHandlers() {
 	svc.group.Get("", svc.GetClientHandler)
 	svc.group.Post("", svc.PostClientHandler)
+	svc.group.Post("/canary", svc.PostCanaryHandler)
 	svc.group.Patch("", svc.PatchClientHandler)
 	svc.group.Delete("", svc.DeleteClientHandler)
 }
@@ -31,10 +33,10 @@ func (svc *ClientService) RegisterHandlers() {
 /*
 GetClientHandler - Provides a Fiber handler for processing a get request to /client. This should
 not be called directly, and should only ever be passed to Fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *ClientService) GetClientHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	clientId := c.Query("client_id")
 	if clientId == "" {
 		limit, err := strconv.Atoi(c.Query("limit", "10"))
@@ -42,7 +44,7 @@ func (svc *ClientService) GetClientHandler(c fiber.Ctx) error {
 			return middleware.HandleError(c, err)
 		}
 
-		apps, err := client.List(svc.server, limit, true)
+		apps, err := client.List(serv, limit, true)
 		if err != nil {
 			return middleware.HandleError(c, err)
 		}
@@ -50,7 +52,7 @@ func (svc *ClientService) GetClientHandler(c fiber.Ctx) error {
 		return c.JSON(apps)
 	}
 
-	app, err := client.Get(svc.server, clientId, true)
+	app, err := client.Get(serv, clientId, true)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -61,10 +63,10 @@ func (svc *ClientService) GetClientHandler(c fiber.Ctx) error {
 /*
 PostClientHandler - Provides a fiber handler for processing a POST request to /client This should
 not be called directly, and should only ever be passed to fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *ClientService) PostClientHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	var model client.Client
 
 	err := middleware.BindJSON(c, &model)
@@ -72,7 +74,7 @@ func (svc *ClientService) PostClientHandler(c fiber.Ctx) error {
 		return err
 	}
 
-	clientId, err := client.New(svc.server, model.Name, model.IsPublic, model.GrantTypes...)
+	clientId, err := client.New(serv, model.Name, model.IsPublic, model.GrantTypes...)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -80,13 +82,41 @@ func (svc *ClientService) PostClientHandler(c fiber.Ctx) error {
 	return c.Status(201).JSON(&fiber.Map{"message": "Created application successfully", "client_id": clientId})
 }
 
+/*
+PostCanaryHandler - Provides a fiber handler for processing a POST request to /client/canary This should
+not be called directly, and should only ever be passed to fiber. Both the client ID and the client secret are returned,
+as the purpose of a canary is to plant its credentials somewhere they should never be used
+*/
+func (svc *ClientService) PostCanaryHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model client.Client
+
+	err := middleware.BindJSON(c, &model)
+	if err != nil {
+		return err
+	}
+
+	clientId, err := client.NewCanary(serv, model.Name)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	app, err := client.Get(serv, clientId, true)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Created canary successfully", "client_id": app.ClientId, "client_secret": app.ClientSecret})
+}
+
 /*
 PatchClientHandler - Provides a fiber handler for processing a PATCH request to /client This should
 not be called directly, and should only ever be passed to fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *ClientService) PatchClientHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	clientId := c.Query("client_id")
 
 	var model client.Client
@@ -96,24 +126,37 @@ func (svc *ClientService) PatchClientHandler(c fiber.Ctx) error {
 		return err
 	}
 
-	err = client.Update(svc.server, clientId, &model)
+	previous, err := client.Get(serv, clientId, true)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	err = client.Update(serv, clientId, &model)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
 
+	recordSettings(serv, c, "client:"+clientId, previous, func() (any, error) {
+		return client.Get(serv, clientId, true)
+	})
+
 	return c.Status(200).JSON(&fiber.Map{"message": "Updated application successfully"})
 }
 
 /*
 DeleteClientHandler - Provides a fiber handler for processing a DELETE request to /client This should
 not be called directly, and should only ever be passed to fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *ClientService) DeleteClientHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	clientId := c.Query("client_id")
 
-	err := client.Delete(svc.server, clientId)
+	if pending, err := requireApproval(serv, c, approval.ActionClientDelete, clientId); pending {
+		return err
+	}
+
+	err := client.Delete(serv, clientId)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -124,6 +167,6 @@ func (svc *ClientService) DeleteClientHandler(c fiber.Ctx) error {
 func NewClientService(server *server.Server, app *fiber.App) *ClientService {
 	return &ClientService{
 		server: server,
-		group:  app.Group("/client"),
+		group:  app.Group("/client", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
 	}
 }
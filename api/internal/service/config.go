@@ -0,0 +1,70 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/changelog"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+type ConfigService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *ConfigService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *ConfigService) RegisterHandlers() {
+	svc.group.Get("/history", svc.GetHistoryHandler)
+}
+
+/*
+GetHistoryHandler - Provides a Fiber handler for processing a GET request to /config/history. Returns the most recent
+changes to the server configuration and to the settings of clients and resource servers, newest first. Pass subject to
+only return changes to a single object (config, client:<client_id>, resource_server:<audience>). This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ConfigService) GetHistoryHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	entries, err := changelog.History(serv, c.Query("subject"), limit)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(entries)
+}
+
+/*
+recordSettings - Records the changes made to an object by a management request that has already succeeded. The update
+is not rolled back if this fails, so the failure is only logged
+*/
+func recordSettings(serv *server.Server, c fiber.Ctx, subject string, previous any, fetch func() (any, error)) {
+	updated, err := fetch()
+	if err == nil {
+		err = changelog.RecordSettings(serv, middleware.Actor(c), subject, previous, updated)
+	}
+
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to record settings changes for "+subject, err)
+	}
+}
+
+func NewConfigService(server *server.Server, app *fiber.App) *ConfigService {
+	return &ConfigService{
+		server: server,
+		group:  app.Group("/config", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/oauth/resourceserver"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+type KeyService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *KeyService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *KeyService) RegisterHandlers() {
+	svc.group.Post("/stage", svc.PostStageKeyHandler)
+	svc.group.Post("/import", svc.PostImportKeyHandler)
+}
+
+/*
+PostStageKeyHandler - Provides a Fiber handler for processing a POST request to /key/stage. A new signing key is
+generated for the audience and published in the JWKS, and becomes the current key once the staging period has elapsed.
+This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *KeyService) PostStageKeyHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	audience := c.Query("audience")
+	alg := c.Query("alg", "RS256")
+
+	/*
+		We look up the resource server first so that keys cannot be staged for an audience that does not exist
+	*/
+	_, err := resourceserver.Get(serv, audience)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	key, err := jwk.Stage(serv, alg, audience)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Staged key successfully", "kid": key.Header.Identifier, "activates_at": key.ActivatesAt})
+}
+
+/*
+PostImportKeyHandler - Provides a Fiber handler for processing a POST request to /key/import. A private key generated by
+another identity provider is imported for the audience, either as its current key or only for verification. Importing
+the same key again responds with 200 instead of 201. This should not be called directly, and should only ever be passed
+to Fiber
+*/
+func (svc *KeyService) PostImportKeyHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var importRequest request.KeyImportRequest
+
+	err := middleware.BindJSON(c, &importRequest)
+	if err != nil {
+		return err
+	}
+
+	_, err = resourceserver.Get(serv, importRequest.Audience)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	/*
+		A PEM encoded key is sent as a JSON string, and a JSON Web Key as an object, which is passed on as is
+	*/
+	encoded := []byte(importRequest.Key)
+
+	var pemKey string
+	if json.Unmarshal(importRequest.Key, &pemKey) == nil {
+		encoded = []byte(pemKey)
+	}
+
+	key, imported, err := jwk.ImportKey(serv, encoded, importRequest.Audience, importRequest.Kid, importRequest.Activate)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	if !imported {
+		return c.Status(200).JSON(&fiber.Map{"message": "Key was already imported", "kid": key.Header.Identifier})
+	}
+
+	return c.Status(201).JSON(&fiber.Map{
+		"message":    "Imported key successfully",
+		"kid":        key.Header.Identifier,
+		"alg":        key.Alg,
+		"is_current": key.IsCurrent,
+		"retires_at": key.RetiresAt,
+	})
+}
+
+func NewKeyService(server *server.Server, app *fiber.App) *KeyService {
+	return &KeyService{
+		server: server,
+		group:  app.Group("/key", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"time"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/flow"
+	"github.com/gofiber/fiber/v3"
+	"github.com/spf13/viper"
+)
+
+// logoutTemplate - The page shown once a logout completes, if the client did not ask for a post logout redirect
+//
+//go:embed templates/logout.html
+var logoutTemplate string
+
+// logoutPage - The parsed logout page
+var logoutPage = template.Must(template.New("logout").Parse(logoutTemplate))
+
+/*
+GetEndSessionHandler - Provides a fiber handler for processing a GET request to /oauth/logout (OpenID Connect
+RP-Initiated Logout 1.0). This should not be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) GetEndSessionHandler(c fiber.Ctx) error {
+	req := new(request.EndSessionRequest)
+
+	if err := c.Bind().Query(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return svc.endSession(c, req)
+}
+
+/*
+PostEndSessionHandler - Provides a fiber handler for processing a POST request to /oauth/logout, which carries the
+same parameters as the GET request as form fields. This should not be called directly, and should only ever be passed
+to fiber
+*/
+func (svc *OAuthService) PostEndSessionHandler(c fiber.Ctx) error {
+	req := new(request.EndSessionRequest)
+
+	if err := c.Bind().Body(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return svc.endSession(c, req)
+}
+
+/*
+endSession - Logs the user out, clears the session cookie, and redirects the user agent to the post logout redirect URI.
+If the client did not send one, then the logout page is rendered instead
+*/
+func (svc *OAuthService) endSession(c fiber.Ctx, req *request.EndSessionRequest) error {
+	serv := svc.server.WithContext(c.Context())
+
+	result, err := flow.EndSession(serv, req, c.Cookies(sessionCookie), viper.GetString("issuer"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     sessionCookie,
+		Path:     sessionCookiePath,
+		Expires:  time.Unix(0, 0),
+		Secure:   c.Scheme() == "https",
+		HTTPOnly: true,
+	})
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	if result.Redirect != "" {
+		return c.Redirect().Status(fiber.StatusFound).To(result.Redirect)
+	}
+
+	var body bytes.Buffer
+
+	err = logoutPage.Execute(&body, result)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	c.Set(fiber.HeaderXFrameOptions, "DENY")
+	c.Set(fiber.HeaderContentSecurityPolicy, "frame-ancestors 'none'")
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+
+	return c.Send(body.Bytes())
+}
@@ -1,20 +1,41 @@
 package service
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
 	"github.com/credstack/credstack/api/internal/middleware"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/federation"
 	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
 	"github.com/credstack/credstack/sdk/pkg/oauth/flow"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
 	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
 	"github.com/gofiber/fiber/v3"
 	"github.com/spf13/viper"
 )
 
+// queryCredentialParameters - The parameters of a token request that carry credentials. These are rejected in the query string of a GET request, as query strings are recorded by proxies and access logs
+var queryCredentialParameters = []string{"client_secret", "code_verifier", "refresh_token", "subject_token", "actor_token"}
+
+// ErrCredentialsInQuery - Returned when a GET request to the token endpoint carries credentials in its query string. Uses the error code defined in RFC 6749 section 5.2
+var ErrCredentialsInQuery = credstackError.NewError(400, "invalid_request", "token: Credentials must be sent in the body of a POST request to the token endpoint, and never in the query string")
+
 type OAuthService struct {
 	// server - Dependencies required by all API handlers
 	server *server.Server
 
 	// group - The Fiber API group for this service
 	group fiber.Router
+
+	// loginTemplate - The hosted login page rendered by the authorization endpoint
+	loginTemplate *template.Template
 }
 
 func (svc *OAuthService) Group() fiber.Router {
@@ -22,21 +43,124 @@ func (svc *OAuthService) Group() fiber.Router {
 }
 
 func (svc *OAuthService) RegisterHandlers() {
+	svc.group.Get("/authorize", svc.GetAuthorizeHandler)
+	svc.group.Post("/authorize", svc.PostAuthorizeHandler)
+	svc.group.Get(strings.TrimPrefix(federation.PathCallback, "/oauth"), svc.GetFederationCallbackHandler)
+	svc.group.Post(strings.TrimPrefix(federation.PathSAMLAssertionConsumer, "/oauth"), svc.PostSAMLAssertionHandler)
+	svc.group.Get(strings.TrimPrefix(federation.PathSAMLMetadata, "/oauth"), svc.GetSAMLMetadataHandler)
 	svc.group.Get("/token", svc.GetTokenHandler)
+	svc.group.Post("/token", svc.PostTokenHandler)
+	svc.group.Post("/device/code", svc.PostDeviceCodeHandler)
+	svc.group.Post("/device/verify", svc.PostDeviceVerifyHandler)
+	svc.group.Post("/bc-authorize", svc.PostBackchannelAuthorizeHandler)
+	svc.group.Post("/bc-authorize/verify", svc.PostBackchannelVerifyHandler)
+	svc.group.Get("/userinfo", svc.UserInfoHandler)
+	svc.group.Post("/userinfo", svc.UserInfoHandler)
+	svc.group.Patch("/userinfo/metadata", svc.PatchUserInfoMetadataHandler)
+	svc.group.Post("/introspect", svc.PostIntrospectHandler)
+	svc.group.Post("/revoke", svc.PostRevokeHandler)
+	svc.group.Post("/introspect/batch", svc.PostBatchIntrospectHandler)
+	svc.group.Get("/logout", svc.GetEndSessionHandler)
+	svc.group.Post("/logout", svc.PostEndSessionHandler)
+	svc.group.Post("/refresh", svc.PostRefreshHandler)
 }
 
 /*
-GetTokenHandler - Provides a fiber handler for processing a GET request to /oauth2/token This should
-not be called directly, and should only ever be passed to fiber
+GetTokenHandler - Provides a fiber handler for processing a GET request to /oauth2/token. The token request is read
+from the query string (see issueToken). RFC 6749 section 3.2 requires the token endpoint to be called with POST, so
+requests that carry credentials in the query string (see queryCredentialParameters) are rejected with
+ErrCredentialsInQuery before anything is done with them. This should not be called directly, and should only ever be
+passed to fiber
 */
 func (svc *OAuthService) GetTokenHandler(c fiber.Ctx) error {
+	for _, parameter := range queryCredentialParameters {
+		if c.Query(parameter) != "" {
+			return middleware.HandleError(c, ErrCredentialsInQuery)
+		}
+	}
+
 	req := new(request.TokenRequest)
 
 	if err := c.Bind().Query(req); err != nil {
 		return middleware.HandleError(c, err)
 	}
 
-	resp, err := flow.IssueTokenForFlow(svc.server, req, viper.GetString("issuer"))
+	return svc.issueToken(c, req, c.Queries())
+}
+
+/*
+PostTokenHandler - Provides a fiber handler for processing a POST request to /oauth2/token (RFC 6749 section 3.2). The
+token request is read from the application/x-www-form-urlencoded body, and the client can authenticate with HTTP Basic
+authentication (client_secret_basic) or by sending its client credentials in the body (client_secret_post). This should
+not be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostTokenHandler(c fiber.Ctx) error {
+	req := new(request.TokenRequest)
+
+	if err := c.Bind().Form(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	parameters := make(map[string]string)
+
+	if err := c.Bind().Form(&parameters); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	req.ClientId, req.ClientSecret = clientCredentials(c, req.ClientId, req.ClientSecret)
+
+	return svc.issueToken(c, req, parameters)
+}
+
+/*
+issueToken - Issues a token for the token request provided in the parameter, which was read from the request by
+GetTokenHandler or PostTokenHandler along with all of its parameters. If the client receives its refresh tokens in
+cookies, then the refresh token is set in the refresh cookie instead of being returned in the response
+*/
+func (svc *OAuthService) issueToken(c fiber.Ctx, req *request.TokenRequest, parameters map[string]string) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req.RemoteAddr = c.IP()
+	req.Parameters = parameters
+	req.Context = c.Context()
+
+	middleware.DeprecatedGrantType(serv, c, req.GrantType, req.ClientId)
+
+	resp, err := flow.IssueTokenForFlow(serv, req, viper.GetString("issuer"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	if resp.RefreshToken != "" {
+		app, err := client.Get(serv, req.ClientId, false)
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		err = svc.deliverRefreshCookie(c, app, resp)
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+	}
+
+	return c.JSON(resp)
+}
+
+/*
+PostDeviceCodeHandler - Provides a fiber handler for processing a POST request to /oauth/device/code. This starts the
+device authorization grant and returns the device code and user code to the device. This should not be called directly,
+and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostDeviceCodeHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req := new(request.DeviceAuthorizationRequest)
+
+	if err := c.Bind().Body(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	resp, err := flow.NewDeviceAuthorization(serv, req)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -44,9 +168,327 @@ func (svc *OAuthService) GetTokenHandler(c fiber.Ctx) error {
 	return c.JSON(resp)
 }
 
+/*
+PostDeviceVerifyHandler - Provides a fiber handler for processing a POST request to /oauth/device/verify. The user
+authenticates with their email address and password and either approves or denies the device that displayed the user
+code. This should not be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostDeviceVerifyHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req := new(request.DeviceVerificationRequest)
+
+	if err := c.Bind().Body(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	account, err := user.Login(serv, req.Email, req.Password)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	if !req.Approve {
+		err = flow.DenyDevice(serv, req.UserCode)
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		return c.Status(200).JSON(&fiber.Map{"message": "Denied device successfully"})
+	}
+
+	err = flow.ApproveDevice(serv, req.UserCode, account.Subject())
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(200).JSON(&fiber.Map{"message": "Approved device successfully"})
+}
+
+/*
+PostBackchannelAuthorizeHandler - Provides a fiber handler for processing a POST request to /oauth/bc-authorize. This
+starts the client initiated backchannel authentication grant and returns the auth_req_id to the client. This should not
+be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostBackchannelAuthorizeHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req := new(request.BackchannelAuthenticationRequest)
+
+	if err := c.Bind().Body(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	req.RemoteAddr = c.IP()
+
+	resp, err := flow.NewBackchannelAuthentication(serv, req)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(resp)
+}
+
+/*
+PostBackchannelVerifyHandler - Provides a fiber handler for processing a POST request to /oauth/bc-authorize/verify,
+which is sent by the user's authentication device once it has been notified of a backchannel authentication request.
+The user authenticates with their email address and password and either approves or denies the request. This should not
+be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostBackchannelVerifyHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req := new(request.BackchannelVerificationRequest)
+
+	if err := c.Bind().Body(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	account, err := user.Login(serv, req.Email, req.Password)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	if !req.Approve {
+		err = flow.DenyBackchannel(serv, req.AuthReqId, account.Subject())
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		return c.Status(200).JSON(&fiber.Map{"message": "Denied authentication request successfully"})
+	}
+
+	err = flow.ApproveBackchannel(serv, req.AuthReqId, account.Subject())
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(200).JSON(&fiber.Map{"message": "Approved authentication request successfully"})
+}
+
+/*
+UserInfoHandler - Provides a fiber handler for processing a GET or POST request to /oauth/userinfo (OpenID Connect Core
+1.0 section 5.3). The caller authenticates with a bearer access token that was issued with the openid scope. If the token
+is rejected, the WWW-Authenticate header describes why (RFC 6750 section 3). This should not be called directly, and
+should only ever be passed to fiber
+*/
+func (svc *OAuthService) UserInfoHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	accessToken, ok := bearerToken(c)
+	if !ok {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+		return middleware.HandleError(c, token.ErrInvalidAccessToken)
+	}
+
+	claims, err := flow.UserInfo(serv, accessToken)
+	if err != nil {
+		return bearerError(c, err)
+	}
+
+	return c.JSON(claims)
+}
+
+/*
+PatchUserInfoMetadataHandler - Provides a fiber handler for processing a PATCH request to /oauth/userinfo/metadata. The
+caller authenticates exactly like UserInfoHandler, and the body is merged into the user metadata of the user the token
+was issued for: keys set to null are removed. The merged metadata is returned. This should not be called directly, and
+should only ever be passed to fiber
+*/
+func (svc *OAuthService) PatchUserInfoMetadataHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	accessToken, ok := bearerToken(c)
+	if !ok {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+		return middleware.HandleError(c, token.ErrInvalidAccessToken)
+	}
+
+	var patch map[string]any
+
+	err := middleware.BindJSON(c, &patch)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := flow.UpdateUserMetadata(serv, accessToken, patch)
+	if err != nil {
+		return bearerError(c, err)
+	}
+
+	return c.JSON(metadata)
+}
+
+/*
+bearerError - Responds with an error from an endpoint authenticated with a bearer access token. If the token was rejected,
+then the WWW-Authenticate header describes why (RFC 6750 section 3)
+*/
+func bearerError(c fiber.Ctx, err error) error {
+	var casted credstackError.CredstackError
+	if errors.As(err, &casted) && (casted.HTTPStatusCode == 401 || casted.HTTPStatusCode == 403) {
+		c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="%s"`, casted.Short()))
+	}
+
+	return middleware.HandleError(c, err)
+}
+
+/*
+PostIntrospectHandler - Provides a fiber handler for processing a POST request to /oauth/introspect (RFC 7662). The caller
+authenticates with its client credentials (HTTP Basic or in the body) and must have been granted the can_introspect
+capability. This should not be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostIntrospectHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req := new(request.IntrospectionRequest)
+
+	if err := c.Bind().Body(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	clientId, clientSecret := clientCredentials(c, req.ClientId, req.ClientSecret)
+
+	app, err := flow.AuthenticateClient(serv, clientId, clientSecret, c.IP())
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	err = app.RequireCapability(client.CapabilityIntrospect)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	resp, err := token.Introspect(serv, req.Token)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(resp)
+}
+
+/*
+PostRevokeHandler - Provides a fiber handler for processing a POST request to /oauth/revoke (RFC 7009). The caller
+authenticates with its client credentials (HTTP Basic or in the body) and must have been granted the can_revoke
+capability. A 200 is returned for tokens that do not exist, as required by the RFC. This should not be called directly,
+and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostRevokeHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req := new(request.RevocationRequest)
+
+	if err := c.Bind().Body(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	clientId, clientSecret := clientCredentials(c, req.ClientId, req.ClientSecret)
+
+	app, err := flow.AuthenticateClient(serv, clientId, clientSecret, c.IP())
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	err = app.RequireCapability(client.CapabilityRevoke)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	err = token.Revoke(serv, req.Token, app.ClientId, req.TokenTypeHint)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.SendStatus(200)
+}
+
+/*
+PostBatchIntrospectHandler - Provides a fiber handler for processing a POST request to /oauth/introspect/batch. The
+caller authenticates with its client credentials and must have been granted the can_introspect capability. The status of
+every token is returned in the same order that they were provided. This should not be called directly, and should only
+ever be passed to fiber
+*/
+func (svc *OAuthService) PostBatchIntrospectHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var req request.BatchIntrospectionRequest
+
+	err := middleware.BindJSON(c, &req)
+	if err != nil {
+		return err
+	}
+
+	app, err := flow.AuthenticateClient(serv, req.ClientId, req.ClientSecret, c.IP())
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	err = app.RequireCapability(client.CapabilityIntrospect)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	results, err := token.IntrospectBatch(serv, req.Tokens)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(&fiber.Map{"results": results})
+}
+
+/*
+clientCredentials - Returns the client credentials sent with HTTP Basic authentication (RFC 6749 section 2.3.1). If the
+request does not use HTTP Basic authentication, then the credentials provided in the parameters (from the body) are
+returned instead
+*/
+func clientCredentials(c fiber.Ctx, clientId string, clientSecret string) (string, string) {
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if len(authorization) < 6 || !strings.EqualFold(authorization[:6], "basic ") {
+		return clientId, clientSecret
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(authorization[6:])
+	if err != nil {
+		return clientId, clientSecret
+	}
+
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return clientId, clientSecret
+	}
+
+	/*
+		Client credentials are form encoded before they are placed in the header, so they need to be decoded here
+	*/
+	username, err = url.QueryUnescape(username)
+	if err != nil {
+		return clientId, clientSecret
+	}
+
+	password, err = url.QueryUnescape(password)
+	if err != nil {
+		return clientId, clientSecret
+	}
+
+	return username, password
+}
+
+/*
+bearerToken - Returns the access token sent in the Authorization header with the Bearer scheme (RFC 6750 section 2.1)
+*/
+func bearerToken(c fiber.Ctx) (string, bool) {
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "bearer ") {
+		return "", false
+	}
+
+	accessToken := strings.TrimSpace(authorization[7:])
+
+	return accessToken, accessToken != ""
+}
+
 func NewOAuthService(server *server.Server, app *fiber.App) *OAuthService {
 	return &OAuthService{
-		server: server,
-		group:  app.Group("/oauth"),
+		server:        server,
+		group:         app.Group("/oauth"),
+		loginTemplate: loadLoginTemplate(server),
 	}
 }
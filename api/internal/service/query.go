@@ -0,0 +1,66 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"strconv"
+
+	"github.com/credstack/credstack/sdk/pkg/query"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+/*
+queryOptions - Binds the query parameters shared by endpoints that list large collections: fields (a comma separated
+list of fields to return), sub, from and to (RFC 3339 or unix timestamps), after (the cursor returned with the previous
+page), and limit
+*/
+func queryOptions(c fiber.Ctx) (*query.Options, error) {
+	from, err := query.ParseTime(c.Query("from"))
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := query.ParseTime(c.Query("to"))
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(query.DefaultLimit)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &query.Options{
+		Fields:  query.ParseFields(c.Query("fields")),
+		Subject: c.Query("sub"),
+		From:    from,
+		To:      to,
+		After:   c.Query("after"),
+		Limit:   limit,
+	}, nil
+}
+
+/*
+sendStream - Writes every document in the stream as newline delimited JSON. The response is streamed to the caller as
+documents are read from the database, so the status has already been sent by the time an error can occur. Errors are
+logged, and the response is cut short
+*/
+func sendStream(c fiber.Ctx, serv *server.Server, stream *query.Stream) error {
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		encoder := json.NewEncoder(w)
+
+		err := stream.Each(func(document bson.M) error {
+			return encoder.Encode(document)
+		})
+		if err != nil {
+			serv.Log().LogErrorEvent("Failed to stream export", err)
+			return
+		}
+
+		_ = w.Flush()
+	})
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/flow"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/gofiber/fiber/v3"
+	"github.com/spf13/viper"
+)
+
+const (
+	// refreshCookie - The prefix of the name of the HttpOnly cookie holding the refresh token of a browser client. See refreshCookieName
+	refreshCookie = "credstack_refresh_"
+
+	// csrfCookie - The prefix of the name of the HttpOnly cookie holding the CSRF token the client must echo in the csrfHeader. See refreshCookieName
+	csrfCookie = "credstack_csrf_"
+
+	// csrfHeader - The header the CSRF token must be sent in when refreshing with the refresh cookie
+	csrfHeader = "X-Credstack-CSRF"
+
+	// refreshCookiePath - The path the refresh cookie is sent to. This is only the refresh endpoint
+	refreshCookiePath = "/oauth/refresh"
+)
+
+// ErrCSRFTokenMismatch - Returned when a refresh with the refresh cookie does not send the CSRF token it was issued with in the X-Credstack-CSRF header
+var ErrCSRFTokenMismatch = credstackError.NewError(403, "CSRF_TOKEN_MISMATCH", "http: The X-Credstack-CSRF header does not match the CSRF token issued with the refresh cookie")
+
+// ErrRefreshCookieNotEnabled - Returned when the refresh endpoint is called for a client that does not receive its refresh tokens in cookies
+var ErrRefreshCookieNotEnabled = credstackError.NewError(400, "REFRESH_COOKIE_NOT_ENABLED", "http: The client does not receive its refresh tokens in cookies")
+
+/*
+PostRefreshHandler - Provides a fiber handler for processing a POST request to /oauth/refresh. Browser clients that
+receive their refresh tokens in a cookie (client.Client.RefreshTokenCookie) call this instead of the token endpoint to
+redeem it. The refresh token is read from the HttpOnly refresh cookie, rotated exactly as it is at the token endpoint,
+and the new refresh token is written back to the cookie. The body only needs to identify the client with client_id.
+
+The request is protected against CSRF with a double-submit token: every response that sets the refresh cookie returns a
+new CSRF token in csrf_token, which must be sent in the X-Credstack-CSRF header on the next refresh. A copy of it is kept
+in an HttpOnly cookie to compare against, so the browser client never needs to read cookies of the credstack origin.
+A cross-site form or request cannot set the header, and both cookies are also SameSite=Strict, so they are never sent
+with cross-site requests to begin with. This should not be called directly, and should only ever be passed to fiber
+*/
+func (svc *OAuthService) PostRefreshHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	req := new(request.TokenRequest)
+
+	if err := c.Bind().Body(req); err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	expected, sent := c.Cookies(refreshCookieName(csrfCookie, req.ClientId)), c.Get(csrfHeader)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(sent)) != 1 {
+		return middleware.HandleError(c, ErrCSRFTokenMismatch)
+	}
+
+	app, err := client.Get(serv, req.ClientId, false)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	if !app.RefreshTokenCookie {
+		return middleware.HandleError(c, ErrRefreshCookieNotEnabled)
+	}
+
+	req.GrantType = client.GrantTypeRefreshToken
+	req.RefreshToken = c.Cookies(refreshCookieName(refreshCookie, app.ClientId))
+	req.RemoteAddr = c.IP()
+	req.Context = c.Context()
+
+	resp, err := flow.IssueTokenForFlow(serv, req, viper.GetString("issuer"))
+	if err != nil {
+		/*
+			The cookies are only cleared when the refresh token itself can no longer be redeemed (including when reuse
+			was detected and its family was revoked). Any other failure, such as the database being unavailable, keeps
+			them, so that the browser client can retry instead of the user being signed out
+		*/
+		if errors.Is(err, flow.ErrInvalidRefreshToken) {
+			svc.clearRefreshCookies(c, app.ClientId)
+		}
+
+		return middleware.HandleError(c, err)
+	}
+
+	err = svc.deliverRefreshCookie(c, app, resp)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(resp)
+}
+
+/*
+refreshCookieName - Returns the name of the refresh or CSRF cookie (the prefix provided in the parameter) of the client
+with the client ID provided in the parameter. Every client has its own cookies, so that browser clients served from the
+same site never overwrite or clear each other's refresh tokens. The client ID is base64url encoded, as cookie names
+cannot contain every character a client ID can
+*/
+func refreshCookieName(prefix string, clientId string) string {
+	return prefix + base64.RawURLEncoding.EncodeToString([]byte(clientId))
+}
+
+/*
+deliverRefreshCookie - Moves the refresh token out of the token response and into the refresh cookie for clients that
+receive their refresh tokens in cookies, and issues a new CSRF token alongside it, which is returned in the response.
+Responses for any other client, or without a refresh token, are left unchanged
+*/
+func (svc *OAuthService) deliverRefreshCookie(c fiber.Ctx, app *client.Client, resp *response.TokenResponse) error {
+	if !app.RefreshTokenCookie || resp.RefreshToken == "" {
+		return nil
+	}
+
+	csrfToken, err := secret.RandString(32)
+	if err != nil {
+		return err
+	}
+
+	maxAge := int(app.RefreshTokenLifetime)
+	secure := c.Scheme() == "https"
+
+	c.Cookie(&fiber.Cookie{
+		Name:     refreshCookieName(refreshCookie, app.ClientId),
+		Value:    resp.RefreshToken,
+		Path:     refreshCookiePath,
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+
+	c.Cookie(&fiber.Cookie{
+		Name:     refreshCookieName(csrfCookie, app.ClientId),
+		Value:    csrfToken,
+		Path:     refreshCookiePath,
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+
+	resp.RefreshToken = ""
+	resp.CSRFToken = csrfToken
+
+	return nil
+}
+
+/*
+clearRefreshCookies - Expires the refresh and CSRF cookies of the client with the client ID provided in the parameter,
+so that a browser client whose refresh token can no longer be redeemed starts a new authorization instead of retrying it.
+This must only be called once the refresh token is known to be invalid
+*/
+func (svc *OAuthService) clearRefreshCookies(c fiber.Ctx, clientId string) {
+	secure := c.Scheme() == "https"
+
+	c.Cookie(&fiber.Cookie{Name: refreshCookieName(refreshCookie, clientId), Path: refreshCookiePath, MaxAge: -1, Secure: secure, HTTPOnly: true, SameSite: fiber.CookieSameSiteStrictMode})
+	c.Cookie(&fiber.Cookie{Name: refreshCookieName(csrfCookie, clientId), Path: refreshCookiePath, MaxAge: -1, Secure: secure, HTTPOnly: true, SameSite: fiber.CookieSameSiteStrictMode})
+}
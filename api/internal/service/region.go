@@ -0,0 +1,81 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/region"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+type RegionService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *RegionService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *RegionService) RegisterHandlers() {
+	svc.group.Get("/health", svc.GetHealthHandler)
+	svc.group.Get("/revocations", middleware.ManagementAuth(svc.server), middleware.ManagementPolicy(svc.server), svc.GetRevocationsHandler)
+}
+
+/*
+GetHealthHandler - Provides a Fiber handler for processing a GET request to /region/health. Responds with a 503 only if
+the region itself is degraded, so that load balancers route traffic away from it. Unreachable peers are reported in the
+body with a 200, as the region can still serve requests. Peers are not probed if the peers query parameter is false,
+which is how regions probe each other. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *RegionService) GetHealthHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	health := region.Check(serv, c.Query("peers") != "false")
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	if health.Status == region.StatusDegradedLocal {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(health)
+	}
+
+	return c.JSON(health)
+}
+
+/*
+GetRevocationsHandler - Provides a Fiber handler for processing a GET request to /region/revocations. Returns the
+revocations recorded in every region since the unix timestamp in the since query parameter, so that resource servers
+that validate tokens locally can reject revoked tokens. This should not be called directly, and should only ever be
+passed to Fiber
+*/
+func (svc *RegionService) GetRevocationsHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	since, err := strconv.ParseInt(c.Query("since", "0"), 10, 64)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", "100"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	revocations, err := region.Revocations(serv, since, limit)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(revocations)
+}
+
+func NewRegionService(server *server.Server, app *fiber.App) *RegionService {
+	return &RegionService{
+		server: server,
+		group:  app.Group("/region"),
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"strconv"
 
 	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/approval"
 	"github.com/credstack/credstack/sdk/pkg/oauth/resourceserver"
 	"github.com/credstack/credstack/sdk/pkg/server"
 	"github.com/gofiber/fiber/v3"
@@ -31,10 +32,10 @@ func (svc *ResourceServerService) RegisterHandlers() {
 /*
 GetResourceServerHandler - Provides a Fiber handler for processing a GET request to /management/api. This should
 not be called directly, and should only ever be passed to Fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *ResourceServerService) GetResourceServerHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	audience := c.Query("audience")
 	if audience == "" {
 		limit, err := strconv.Atoi(c.Query("limit", "10"))
@@ -42,7 +43,7 @@ func (svc *ResourceServerService) GetResourceServerHandler(c fiber.Ctx) error {
 			return middleware.HandleError(c, err)
 		}
 
-		apis, err := resourceserver.List(svc.server, limit)
+		apis, err := resourceserver.List(serv, limit)
 		if err != nil {
 			return middleware.HandleError(c, err)
 		}
@@ -50,7 +51,7 @@ func (svc *ResourceServerService) GetResourceServerHandler(c fiber.Ctx) error {
 		return c.JSON(apis)
 	}
 
-	requestedApi, err := resourceserver.Get(svc.server, audience)
+	requestedApi, err := resourceserver.Get(serv, audience)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -62,11 +63,12 @@ func (svc *ResourceServerService) GetResourceServerHandler(c fiber.Ctx) error {
 PostResourceServerHandler - Provides a Fiber handler for processing a POST request to /management/api. This should
 not be called directly, and should only ever be passed to Fiber
 
-TODO: Authentication handler needs to happen here
 TODO: Underlying functions need domain validation in place
 TODO: Underlying functions need to be updated here so that we can assign applications at birth
 */
 func (svc *ResourceServerService) PostResourceServerHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	var model resourceserver.ResourceServer
 
 	err := middleware.BindJSON(c, &model)
@@ -74,7 +76,7 @@ func (svc *ResourceServerService) PostResourceServerHandler(c fiber.Ctx) error {
 		return err
 	}
 
-	err = resourceserver.New(svc.server, model.Name, model.Audience, model.TokenType)
+	err = resourceserver.New(serv, model.Name, model.Audience, model.TokenType)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -85,10 +87,10 @@ func (svc *ResourceServerService) PostResourceServerHandler(c fiber.Ctx) error {
 /*
 PatchResourceServerHandler - Provides a Fiber handler for processing a PATCH request to /management/api. This should
 not be called directly, and should only ever be passed to Fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *ResourceServerService) PatchResourceServerHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	audience := c.Query("audience")
 
 	var model resourceserver.ResourceServer
@@ -98,24 +100,37 @@ func (svc *ResourceServerService) PatchResourceServerHandler(c fiber.Ctx) error
 		return err
 	}
 
-	err = resourceserver.Update(svc.server, audience, &model)
+	previous, err := resourceserver.Get(serv, audience)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
 
+	err = resourceserver.Update(serv, audience, &model)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	recordSettings(serv, c, "resource_server:"+audience, previous, func() (any, error) {
+		return resourceserver.Get(serv, audience)
+	})
+
 	return c.Status(201).JSON(&fiber.Map{"message": "Updated API successfully"})
 }
 
 /*
 DeleteResourceServerHandler - Provides a Fiber handler for processing a DELETE request to /management/api. This should
 not be called directly, and should only ever be passed to Fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *ResourceServerService) DeleteResourceServerHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	audience := c.Query("audience")
 
-	err := resourceserver.Delete(svc.server, audience)
+	if pending, err := requireApproval(serv, c, approval.ActionResourceServerDelete, audience); pending {
+		return err
+	}
+
+	err := resourceserver.Delete(serv, audience)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -126,6 +141,6 @@ func (svc *ResourceServerService) DeleteResourceServerHandler(c fiber.Ctx) error
 func NewResourceServerService(server *server.Server, app *fiber.App) *ResourceServerService {
 	return &ResourceServerService{
 		server: server,
-		group:  app.Group("/resource_server"),
+		group:  app.Group("/resource_server", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
 	}
 }
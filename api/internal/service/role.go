@@ -0,0 +1,183 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/rbac/role"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"github.com/gofiber/fiber/v3"
+)
+
+type RoleService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *RoleService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *RoleService) RegisterHandlers() {
+	svc.group.Get("", svc.GetRoleHandler)
+	svc.group.Post("", svc.PostRoleHandler)
+	svc.group.Patch("", svc.PatchRoleHandler)
+	svc.group.Delete("", svc.DeleteRoleHandler)
+
+	svc.group.Get("/user", svc.GetUserRolesHandler)
+	svc.group.Post("/user", svc.PostUserRoleHandler)
+	svc.group.Delete("/user", svc.DeleteUserRoleHandler)
+}
+
+/*
+GetRoleHandler - Provides a Fiber handler for processing a GET request to /role. If a name is not provided, then all
+roles are listed. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *RoleService) GetRoleHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	name := c.Query("name")
+	if name == "" {
+		limit, err := strconv.Atoi(c.Query("limit", "10"))
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		roles, err := role.List(serv, limit)
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		return c.JSON(roles)
+	}
+
+	ret, err := role.Get(serv, name)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(ret)
+}
+
+/*
+PostRoleHandler - Provides a Fiber handler for processing a POST request to /role. This should not be called directly,
+and should only ever be passed to Fiber
+*/
+func (svc *RoleService) PostRoleHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model role.Role
+
+	err := middleware.BindJSON(c, &model)
+	if err != nil {
+		return err
+	}
+
+	err = role.New(serv, &model)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Created role successfully"})
+}
+
+/*
+PatchRoleHandler - Provides a Fiber handler for processing a PATCH request to /role. This should not be called directly,
+and should only ever be passed to Fiber
+*/
+func (svc *RoleService) PatchRoleHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model role.Role
+
+	err := middleware.BindJSON(c, &model)
+	if err != nil {
+		return err
+	}
+
+	err = role.Update(serv, c.Query("name"), &model)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Updated role successfully"})
+}
+
+/*
+DeleteRoleHandler - Provides a Fiber handler for processing a DELETE request to /role. The role is also unassigned from
+every user it was assigned to. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *RoleService) DeleteRoleHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	err := role.Delete(serv, c.Query("name"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Deleted role successfully"})
+}
+
+/*
+GetUserRolesHandler - Provides a Fiber handler for processing a GET request to /role/user. Returns the roles assigned to
+the user identified by the email query parameter, along with every scope they are granted through them. This should not
+be called directly, and should only ever be passed to Fiber
+*/
+func (svc *RoleService) GetUserRolesHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	account, err := user.Get(serv, c.Query("email"), false)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	scopes, err := role.Expand(serv, account)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(&fiber.Map{"roles": account.Roles, "scopes": scopes})
+}
+
+/*
+PostUserRoleHandler - Provides a Fiber handler for processing a POST request to /role/user. Assigns the role identified
+by the name query parameter to the user identified by the email query parameter. This should not be called directly,
+and should only ever be passed to Fiber
+*/
+func (svc *RoleService) PostUserRoleHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	err := role.Assign(serv, c.Query("email"), c.Query("name"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Assigned role successfully"})
+}
+
+/*
+DeleteUserRoleHandler - Provides a Fiber handler for processing a DELETE request to /role/user. Removes the role
+identified by the name query parameter from the user identified by the email query parameter. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *RoleService) DeleteUserRoleHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	err := role.Unassign(serv, c.Query("email"), c.Query("name"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Unassigned role successfully"})
+}
+
+func NewRoleService(server *server.Server, app *fiber.App) *RoleService {
+	return &RoleService{
+		server: server,
+		group:  app.Group("/role", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
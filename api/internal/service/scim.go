@@ -0,0 +1,390 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/scim"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+	"github.com/spf13/viper"
+)
+
+// scimClientKey - The key of the fiber.Ctx local that holds the client ID of the authenticated provisioning client
+const scimClientKey = "credstack_scim_client"
+
+type ScimService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *ScimService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *ScimService) RegisterHandlers() {
+	svc.group.Use(svc.authenticate)
+
+	svc.group.Get("/Users", svc.GetUsersHandler)
+	svc.group.Post("/Users", svc.PostUserHandler)
+	svc.group.Get("/Users/:id", svc.GetUserHandler)
+	svc.group.Put("/Users/:id", svc.PutUserHandler)
+	svc.group.Patch("/Users/:id", svc.PatchUserHandler)
+	svc.group.Delete("/Users/:id", svc.DeleteUserHandler)
+
+	svc.group.Get("/Groups", svc.GetGroupsHandler)
+	svc.group.Post("/Groups", svc.PostGroupHandler)
+	svc.group.Get("/Groups/:id", svc.GetGroupHandler)
+	svc.group.Put("/Groups/:id", svc.PutGroupHandler)
+	svc.group.Patch("/Groups/:id", svc.PatchGroupHandler)
+	svc.group.Delete("/Groups/:id", svc.DeleteGroupHandler)
+}
+
+/*
+authenticate - Authenticates the provisioning client of every SCIM request with its bearer access token (see
+scim.Authenticate), and stores its client ID for the handlers. This should not be called directly, and should only ever
+be passed to Fiber
+*/
+func (svc *ScimService) authenticate(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	accessToken, ok := bearerToken(c)
+	if !ok {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+		return scimError(c, token.ErrInvalidAccessToken)
+	}
+
+	clientId, err := scim.Authenticate(serv, accessToken)
+	if err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+		return scimError(c, err)
+	}
+
+	c.Locals(scimClientKey, clientId)
+
+	return c.Next()
+}
+
+/*
+actor - Returns the actor recorded for changes made by the authenticated provisioning client
+*/
+func (svc *ScimService) actor(c fiber.Ctx) string {
+	clientId, _ := c.Locals(scimClientKey).(string)
+	return "scim:" + clientId
+}
+
+/*
+scimError - Responds with the SCIM error response of the error provided in the parameter (see scim.NewError)
+*/
+func scimError(c fiber.Ctx, err error) error {
+	status, body := scim.NewError(err)
+	return scimJSON(c, status, body)
+}
+
+/*
+scimJSON - Responds with the body provided in the parameter, with the SCIM media type
+*/
+func scimJSON(c fiber.Ctx, status int, body any) error {
+	return c.Status(status).JSON(body, scim.ContentType)
+}
+
+/*
+bindScim - Decodes the body of a SCIM request into the model provided in the parameter. Directories send bodies with the
+SCIM media type, which Fiber does not bind as JSON, so the body is decoded directly
+*/
+func bindScim(c fiber.Ctx, model any) error {
+	err := json.Unmarshal(c.Body(), model)
+	if err != nil {
+		return scim.ErrInvalidSyntax
+	}
+
+	return nil
+}
+
+/*
+listParams - Returns the filter, 1-based start index and count of a list request (RFC 7644 section 3.4.2). The count
+defaults to ScimConfig.MaxResults
+*/
+func (svc *ScimService) listParams(c fiber.Ctx) (string, int, int, error) {
+	serv := svc.server.WithContext(c.Context())
+
+	startIndex, err := strconv.Atoi(c.Query("startIndex", "1"))
+	if err != nil {
+		return "", 0, 0, scim.ErrInvalidValue
+	}
+
+	count, err := strconv.Atoi(c.Query("count", strconv.Itoa(serv.Config.ScimConfig.MaxResults)))
+	if err != nil {
+		return "", 0, 0, scim.ErrInvalidValue
+	}
+
+	return c.Query("filter"), startIndex, count, nil
+}
+
+/*
+withMembers - Returns false if the members of groups were left out of the response with the excludedAttributes or
+attributes parameters (RFC 7644 section 3.9), which directories do when they only need the groups themselves
+*/
+func withMembers(c fiber.Ctx) bool {
+	isMembers := func(attr string) bool {
+		return strings.EqualFold(strings.TrimSpace(attr), "members")
+	}
+
+	if slices.ContainsFunc(strings.Split(c.Query("excludedAttributes"), ","), isMembers) {
+		return false
+	}
+
+	attributes := c.Query("attributes")
+
+	return attributes == "" || slices.ContainsFunc(strings.Split(attributes, ","), isMembers)
+}
+
+/*
+GetUsersHandler - Provides a Fiber handler for processing a GET request to /scim/v2/Users. Directories look users up
+with a filter (userName eq "...") before provisioning them. This should not be called directly, and should only ever be
+passed to Fiber
+*/
+func (svc *ScimService) GetUsersHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	expression, startIndex, count, err := svc.listParams(c)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	resp, err := scim.ListUsers(serv, expression, startIndex, count, viper.GetString("issuer"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, 200, resp)
+}
+
+/*
+PostUserHandler - Provides a Fiber handler for processing a POST request to /scim/v2/Users. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) PostUserHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model scim.User
+
+	err := bindScim(c, &model)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	resp, err := scim.CreateUser(serv, &model, viper.GetString("issuer"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	c.Set(fiber.HeaderLocation, resp.Meta.Location)
+
+	return scimJSON(c, 201, resp)
+}
+
+/*
+GetUserHandler - Provides a Fiber handler for processing a GET request to /scim/v2/Users/:id. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) GetUserHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	resp, err := scim.GetUser(serv, c.Params("id"), viper.GetString("issuer"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, 200, resp)
+}
+
+/*
+PutUserHandler - Provides a Fiber handler for processing a PUT request to /scim/v2/Users/:id. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) PutUserHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model scim.User
+
+	err := bindScim(c, &model)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	resp, err := scim.ReplaceUser(serv, c.Params("id"), &model, viper.GetString("issuer"), svc.actor(c))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, 200, resp)
+}
+
+/*
+PatchUserHandler - Provides a Fiber handler for processing a PATCH request to /scim/v2/Users/:id. Directories deprovision
+users by patching active to false. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) PatchUserHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model scim.PatchRequest
+
+	err := bindScim(c, &model)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	resp, err := scim.PatchUser(serv, c.Params("id"), &model, viper.GetString("issuer"), svc.actor(c))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, 200, resp)
+}
+
+/*
+DeleteUserHandler - Provides a Fiber handler for processing a DELETE request to /scim/v2/Users/:id. If deleting users
+requires approval, then the request fails with 403 and the user is left as-is. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) DeleteUserHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	err := scim.DeleteUser(serv, c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return c.SendStatus(204)
+}
+
+/*
+GetGroupsHandler - Provides a Fiber handler for processing a GET request to /scim/v2/Groups. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) GetGroupsHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	expression, startIndex, count, err := svc.listParams(c)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	resp, err := scim.ListGroups(serv, expression, startIndex, count, withMembers(c), viper.GetString("issuer"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, 200, resp)
+}
+
+/*
+PostGroupHandler - Provides a Fiber handler for processing a POST request to /scim/v2/Groups. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) PostGroupHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model scim.Group
+
+	err := bindScim(c, &model)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	resp, err := scim.CreateGroup(serv, &model, viper.GetString("issuer"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	c.Set(fiber.HeaderLocation, resp.Meta.Location)
+
+	return scimJSON(c, 201, resp)
+}
+
+/*
+GetGroupHandler - Provides a Fiber handler for processing a GET request to /scim/v2/Groups/:id. This should not be
+called directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) GetGroupHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	resp, err := scim.GetGroup(serv, c.Params("id"), withMembers(c), viper.GetString("issuer"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, 200, resp)
+}
+
+/*
+PutGroupHandler - Provides a Fiber handler for processing a PUT request to /scim/v2/Groups/:id. This should not be
+called directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) PutGroupHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model scim.Group
+
+	err := bindScim(c, &model)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	resp, err := scim.ReplaceGroup(serv, c.Params("id"), &model, viper.GetString("issuer"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, 200, resp)
+}
+
+/*
+PatchGroupHandler - Provides a Fiber handler for processing a PATCH request to /scim/v2/Groups/:id. Directories change
+group memberships by patching members. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) PatchGroupHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model scim.PatchRequest
+
+	err := bindScim(c, &model)
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	resp, err := scim.PatchGroup(serv, c.Params("id"), &model, viper.GetString("issuer"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return scimJSON(c, 200, resp)
+}
+
+/*
+DeleteGroupHandler - Provides a Fiber handler for processing a DELETE request to /scim/v2/Groups/:id. This should not be
+called directly, and should only ever be passed to Fiber
+*/
+func (svc *ScimService) DeleteGroupHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	err := scim.DeleteGroup(serv, c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+
+	return c.SendStatus(204)
+}
+
+func NewScimService(server *server.Server, app *fiber.App) *ScimService {
+	return &ScimService{
+		server: server,
+		group:  app.Group(scim.PathBase),
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/oauth/scope"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+type ScopeService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *ScopeService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *ScopeService) RegisterHandlers() {
+	svc.group.Get("", svc.GetScopeHandler)
+	svc.group.Post("", svc.PostScopeHandler)
+	svc.group.Patch("", svc.PatchScopeHandler)
+	svc.group.Delete("", svc.DeleteScopeHandler)
+}
+
+/*
+GetScopeHandler - Provides a Fiber handler for processing a GET request to /scope. If a name is not provided, then the
+scopes registered on the resource server identified by the audience query parameter are listed. This should not be
+called directly, and should only ever be passed to Fiber
+*/
+func (svc *ScopeService) GetScopeHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	audience, name := c.Query("audience"), c.Query("name")
+	if name == "" {
+		limit, err := strconv.Atoi(c.Query("limit", "10"))
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		scopes, err := scope.List(serv, audience, limit)
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		return c.JSON(scopes)
+	}
+
+	ret, err := scope.Get(serv, audience, name)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(ret)
+}
+
+/*
+PostScopeHandler - Provides a Fiber handler for processing a POST request to /scope. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ScopeService) PostScopeHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model scope.Scope
+
+	err := middleware.BindJSON(c, &model)
+	if err != nil {
+		return err
+	}
+
+	err = scope.New(serv, &model)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Created scope successfully"})
+}
+
+/*
+PatchScopeHandler - Provides a Fiber handler for processing a PATCH request to /scope. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ScopeService) PatchScopeHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var model scope.Scope
+
+	err := middleware.BindJSON(c, &model)
+	if err != nil {
+		return err
+	}
+
+	err = scope.Update(serv, c.Query("audience"), c.Query("name"), &model)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Updated scope successfully"})
+}
+
+/*
+DeleteScopeHandler - Provides a Fiber handler for processing a DELETE request to /scope. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *ScopeService) DeleteScopeHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	err := scope.Delete(serv, c.Query("audience"), c.Query("name"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(201).JSON(&fiber.Map{"message": "Deleted scope successfully"})
+}
+
+func NewScopeService(server *server.Server, app *fiber.App) *ScopeService {
+	return &ScopeService{
+		server: server,
+		group:  app.Group("/scope", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
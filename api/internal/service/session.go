@@ -0,0 +1,72 @@
+package service
+
+import (
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/oauth/flow"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/session"
+	"github.com/gofiber/fiber/v3"
+)
+
+type SessionService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *SessionService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *SessionService) RegisterHandlers() {
+	svc.group.Get("", svc.GetSessionHandler)
+	svc.group.Delete("", svc.DeleteSessionHandler)
+}
+
+/*
+GetSessionHandler - Provides a Fiber handler for processing a GET request to /session. The active sessions of the user
+identified by the subject query parameter are listed. This should not be called directly, and should only ever be passed
+to Fiber
+*/
+func (svc *SessionService) GetSessionHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	sessions, err := session.List(serv, c.Query("subject"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(sessions)
+}
+
+/*
+DeleteSessionHandler - Provides a Fiber handler for processing a DELETE request to /session. If an identifier is provided,
+then only that session of the user identified by the subject query parameter is revoked, otherwise every one of their
+sessions is revoked. Every token issued from the revoked sessions is revoked along with them (see flow.SignOut). This
+should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *SessionService) DeleteSessionHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	subject, identifier := c.Query("subject"), c.Query("id")
+
+	result, err := flow.SignOut(serv, subject, identifier, middleware.Actor(c))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	if identifier != "" {
+		return c.Status(200).JSON(&fiber.Map{"message": "Revoked session successfully", "revoked_tokens": result.Tokens})
+	}
+
+	return c.Status(200).JSON(&fiber.Map{"message": "Revoked sessions successfully", "revoked": result.Sessions, "revoked_tokens": result.Tokens})
+}
+
+func NewSessionService(server *server.Server, app *fiber.App) *SessionService {
+	return &SessionService{
+		server: server,
+		group:  app.Group("/session", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/telemetry"
+	"github.com/gofiber/fiber/v3"
+)
+
+type TelemetryService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *TelemetryService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *TelemetryService) RegisterHandlers() {
+	svc.group.Get("/preview", svc.GetPreviewHandler)
+}
+
+/*
+GetPreviewHandler - Provides a Fiber handler for processing a GET request to /telemetry/preview. Returns the exact report
+this instance would send to the telemetry endpoint next, along with whether telemetry is enabled. Nothing is sent, and
+the grant type counters are not reset. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *TelemetryService) GetPreviewHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	report, err := telemetry.Build(serv)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(&fiber.Map{
+		"enabled":  serv.Config.TelemetryConfig.Enabled,
+		"endpoint": serv.Config.TelemetryConfig.Endpoint,
+		"report":   report,
+	})
+}
+
+func NewTelemetryService(server *server.Server, app *fiber.App) *TelemetryService {
+	return &TelemetryService{
+		server: server,
+		group:  app.Group("/telemetry", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/gofiber/fiber/v3"
+)
+
+type TokenService struct {
+	// server - Dependencies required by all API handlers
+	server *server.Server
+
+	// group - The Fiber API group for this service
+	group fiber.Router
+}
+
+func (svc *TokenService) Group() fiber.Router {
+	return svc.group
+}
+
+func (svc *TokenService) RegisterHandlers() {
+	svc.group.Get("", svc.GetTokenListHandler)
+	svc.group.Get("/export", svc.GetTokenExportHandler)
+}
+
+/*
+GetTokenListHandler - Provides a Fiber handler for processing a GET request to /token. Returns a single page of issued
+tokens, filtered and projected with the fields, sub, from, to, after, and limit query parameters. The tokens themselves
+are never returned. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *TokenService) GetTokenListHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	opts, err := queryOptions(c)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	page, err := token.List(serv, opts)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(page)
+}
+
+/*
+GetTokenExportHandler - Provides a Fiber handler for processing a GET request to /token/export. Streams every issued
+token matching the same query parameters as GetTokenListHandler as newline delimited JSON, ignoring the limit. This
+should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *TokenService) GetTokenExportHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	opts, err := queryOptions(c)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	stream, err := token.Export(serv, opts)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return sendStream(c, serv, stream)
+}
+
+func NewTokenService(server *server.Server, app *fiber.App) *TokenService {
+	return &TokenService{
+		server: server,
+		group:  app.Group("/token", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
+	}
+}
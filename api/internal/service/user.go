@@ -1,15 +1,29 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"strconv"
+	"strings"
 
 	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/approval"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
 	"github.com/credstack/credstack/sdk/pkg/models/request"
 	"github.com/credstack/credstack/sdk/pkg/server"
 	"github.com/credstack/credstack/sdk/pkg/user"
 	"github.com/gofiber/fiber/v3"
 )
 
+/*
+PathUserBulkImport - The path bulk imports are posted to. Request bodies sent here are streamed instead of being read
+into memory, so they are exempt from the body limit applied to every other request (see middleware.LimitBody)
+*/
+const PathUserBulkImport = "/user/import/bulk"
+
 type UserService struct {
 	// server - Dependencies required by all API handlers
 	server *server.Server
@@ -28,17 +42,25 @@ RegisterHandlers - Registers required handlers with the associated Fiber router
 func (svc *UserService) RegisterHandlers() {
 	svc.group.Get("", svc.GetUserHandler)
 	svc.group.Post("", svc.PostUserHandler)
+	svc.group.Post("/import", svc.PostUserImportHandler)
+	svc.group.Post(strings.TrimPrefix(PathUserBulkImport, "/user"), svc.PostUserBulkImportHandler)
+	svc.group.Get("/export", svc.GetUserExportHandler)
 	svc.group.Patch("", svc.PatchUserHandler)
+	svc.group.Patch("/user_metadata", svc.PatchUserMetadataHandler)
+	svc.group.Patch("/app_metadata", svc.PatchAppMetadataHandler)
+	svc.group.Post("/identities", svc.PostUserIdentityHandler)
+	svc.group.Put("/identities/primary", svc.PutUserPrimaryIdentityHandler)
+	svc.group.Delete("/identities", svc.DeleteUserIdentityHandler)
 	svc.group.Delete("", svc.DeleteUserHandler)
 }
 
 /*
 GetUserHandler - Provides a Fiber handler for processing a get request to /management/user. This should
 not be called directly, and should only ever be passed to Fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *UserService) GetUserHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	email := c.Query("email")
 	if email == "" {
 		limit, err := strconv.Atoi(c.Query("limit", "10"))
@@ -46,7 +68,7 @@ func (svc *UserService) GetUserHandler(c fiber.Ctx) error {
 			return middleware.HandleError(c, err)
 		}
 
-		users, err := user.List(svc.server, limit, false)
+		users, err := user.List(serv, limit, false)
 		if err != nil {
 			return middleware.HandleError(c, err)
 		}
@@ -54,7 +76,7 @@ func (svc *UserService) GetUserHandler(c fiber.Ctx) error {
 		return c.JSON(users)
 	}
 
-	requestedUser, err := user.Get(svc.server, email, false)
+	requestedUser, err := user.Get(serv, email, false)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -65,10 +87,10 @@ func (svc *UserService) GetUserHandler(c fiber.Ctx) error {
 /*
 PostUserHandler - Provides a fiber handler for processing a POST request to /auth/register This should
 not be called directly, and should only ever be passed to fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *UserService) PostUserHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	var registerRequest request.UserRegisterRequest
 
 	err := middleware.BindJSON(c, &registerRequest)
@@ -77,11 +99,12 @@ func (svc *UserService) PostUserHandler(c fiber.Ctx) error {
 	}
 
 	err = user.Register(
-		svc.server,
-		svc.server.Config.CredentialConfig,
+		serv,
+		serv.Config.CredentialConfig,
 		registerRequest.Email,
 		registerRequest.Username,
 		registerRequest.Password,
+		registerRequest.PhoneNumber,
 	)
 
 	if err != nil {
@@ -91,13 +114,131 @@ func (svc *UserService) PostUserHandler(c fiber.Ctx) error {
 	return c.Status(200).JSON(&fiber.Map{"message": "User successfully registered"}) // this should get its own response
 }
 
+/*
+PostUserImportHandler - Provides a fiber handler for processing a POST request to /management/user/import. This should
+not be called directly, and should only ever be passed to fiber
+*/
+func (svc *UserService) PostUserImportHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var importRequest request.UserImportRequest
+
+	err := middleware.BindJSON(c, &importRequest)
+	if err != nil {
+		return err
+	}
+
+	err = user.Import(
+		serv,
+		importRequest.Email,
+		importRequest.Username,
+		importRequest.PhoneNumber,
+		&importRequest.Credential,
+	)
+
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(200).JSON(&fiber.Map{"message": "User successfully imported"})
+}
+
+/*
+PostUserBulkImportHandler - Provides a fiber handler for processing a POST request to /management/user/import/bulk. The
+body is either CSV (when sent with a text/csv content type), a JSON array, or newline delimited JSON, and is read as the
+import progresses. The result of every record is streamed back as newline delimited JSON as soon as its batch has been
+written. Pass dry_run=true to validate the import without writing anything. This should not be called directly, and
+should only ever be passed to fiber
+*/
+func (svc *UserService) PostUserBulkImportHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var body io.Reader = bytes.NewReader(c.Body())
+	if stream := c.Request().BodyStream(); stream != nil {
+		body = stream
+	}
+
+	var reader user.ImportReader
+	var err error
+
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), "text/csv") {
+		reader, err = user.NewCSVImportReader(body)
+	} else {
+		reader, err = user.NewJSONImportReader(body)
+	}
+
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	opts := user.ImportOptions{DryRun: c.Query("dry_run") == "true"}
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		encoder := json.NewEncoder(w)
+
+		opts.OnResult = func(result user.ImportResult) error {
+			err := encoder.Encode(result)
+			if err != nil {
+				return err
+			}
+
+			return w.Flush()
+		}
+
+		/*
+			The status has already been sent by the time the import can fail, so a failure is reported as a final result
+			without a record. Only the short code and message of named errors are included, as with HandleError
+		*/
+		_, err := user.BulkImport(serv, reader, opts)
+		if err != nil {
+			serv.Log().LogErrorEvent("Failed to complete bulk import", err)
+
+			failure := user.ImportResult{Error: "http: An internal error occurred"}
+
+			var casted credstackError.CredstackError
+			if errors.As(err, &casted) {
+				failure.Code = casted.Short()
+				failure.Error = casted.Error()
+			}
+
+			_ = encoder.Encode(failure)
+		}
+
+		_ = w.Flush()
+	})
+}
+
+/*
+GetUserExportHandler - Provides a Fiber handler for processing a GET request to /management/user/export. Streams every
+user matching the query as newline delimited JSON, without their credentials. Accepts the same query parameters as
+/management/audit, except for after and limit. This should not be called directly, and should only ever be passed to
+Fiber
+*/
+func (svc *UserService) GetUserExportHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	opts, err := queryOptions(c)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	stream, err := user.Export(serv, opts)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return sendStream(c, serv, stream)
+}
+
 /*
 PatchUserHandler - Provides a Fiber handler for processing a PATCH request to /management/user. This should
 not be called directly, and should only ever be passed to Fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *UserService) PatchUserHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	email := c.Query("email")
 
 	var model user.User
@@ -107,7 +248,7 @@ func (svc *UserService) PatchUserHandler(c fiber.Ctx) error {
 		return err
 	}
 
-	err = user.Update(svc.server, email, &model)
+	err = user.Update(serv, email, &model)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -115,16 +256,128 @@ func (svc *UserService) PatchUserHandler(c fiber.Ctx) error {
 	return c.Status(200).JSON(&fiber.Map{"message": "Updated user successfully"})
 }
 
+/*
+PatchUserMetadataHandler - Provides a Fiber handler for processing a PATCH request to /management/user/user_metadata.
+The body is merged into the user metadata of the user: keys set to null are removed. The merged metadata is returned.
+This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *UserService) PatchUserMetadataHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var patch map[string]any
+
+	err := middleware.BindJSON(c, &patch)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := user.UpdateUserMetadata(serv, c.Query("email"), patch)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(metadata)
+}
+
+/*
+PatchAppMetadataHandler - Provides a Fiber handler for processing a PATCH request to /management/user/app_metadata.
+Behaves exactly like PatchUserMetadataHandler, for the app metadata of the user. This should not be called directly, and
+should only ever be passed to Fiber
+*/
+func (svc *UserService) PatchAppMetadataHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var patch map[string]any
+
+	err := middleware.BindJSON(c, &patch)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := user.UpdateAppMetadata(serv, c.Query("email"), patch)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.JSON(metadata)
+}
+
+/*
+PostUserIdentityHandler - Provides a Fiber handler for processing a POST request to /management/user/identities. The
+identity in the body is linked to the user, without being made primary. This should not be called directly, and should
+only ever be passed to Fiber
+*/
+func (svc *UserService) PostUserIdentityHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var identity user.Identity
+
+	err := middleware.BindJSON(c, &identity)
+	if err != nil {
+		return err
+	}
+
+	err = user.Link(serv, c.Query("email"), identity)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(200).JSON(fiber.Map{"message": "Linked identity successfully"})
+}
+
+/*
+PutUserPrimaryIdentityHandler - Provides a Fiber handler for processing a PUT request to
+/management/user/identities/primary. The identity in the body, which must already be linked to the user, is made their
+primary identity. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *UserService) PutUserPrimaryIdentityHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	var identity user.Identity
+
+	err := middleware.BindJSON(c, &identity)
+	if err != nil {
+		return err
+	}
+
+	err = user.SetPrimaryIdentity(serv, c.Query("email"), identity.Provider, identity.Subject)
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(200).JSON(fiber.Map{"message": "Updated primary identity successfully"})
+}
+
+/*
+DeleteUserIdentityHandler - Provides a Fiber handler for processing a DELETE request to /management/user/identities.
+The identity named by the provider and subject query parameters is unlinked from the user. This should not be called
+directly, and should only ever be passed to Fiber
+*/
+func (svc *UserService) DeleteUserIdentityHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	err := user.Unlink(serv, c.Query("email"), c.Query("provider"), c.Query("subject"))
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	return c.Status(200).JSON(fiber.Map{"message": "Unlinked identity successfully"})
+}
+
 /*
 DeleteUserHandler - Provides a Fiber handler for processing a DELETE request to /management/user. This should
 not be called directly, and should only ever be passed to Fiber
-
-TODO: Authentication handler needs to happen here
 */
 func (svc *UserService) DeleteUserHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
 	email := c.Query("email")
 
-	err := user.Delete(svc.server, email)
+	if pending, err := requireApproval(serv, c, approval.ActionUserDelete, email); pending {
+		return err
+	}
+
+	err := user.Delete(serv, email)
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
@@ -135,6 +388,6 @@ func (svc *UserService) DeleteUserHandler(c fiber.Ctx) error {
 func NewUserService(server *server.Server, app *fiber.App) *UserService {
 	return &UserService{
 		server: server,
-		group:  app.Group("/user"),
+		group:  app.Group("/user", middleware.ManagementAuth(server), middleware.ManagementPolicy(server)),
 	}
 }
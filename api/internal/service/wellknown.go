@@ -1,10 +1,16 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+
 	"github.com/credstack/credstack/api/internal/middleware"
+	"github.com/credstack/credstack/sdk/pkg/oauth/discovery"
 	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/oauth/scope"
 	"github.com/credstack/credstack/sdk/pkg/server"
 	"github.com/gofiber/fiber/v3"
+	"github.com/spf13/viper"
 )
 
 type WellKnownService struct {
@@ -21,19 +27,118 @@ func (svc *WellKnownService) Group() fiber.Router {
 
 func (svc *WellKnownService) RegisterHandlers() {
 	svc.group.Get("/jwks.json", svc.GetJWKHandler)
+	svc.group.Get("/openid-configuration", svc.GetOpenIDConfigurationHandler)
+	svc.group.Get("/change-password", svc.GetChangePasswordHandler)
+	svc.group.Get("/scopes", svc.GetScopeCatalogHandler)
 }
 
 /*
-GetJWKHandler - Provides a Fiber handler for processing a GET request to /.well-known/jwks.json. This should
-not be called directly, and should only ever be passed to Fiber
+GetJWKHandler - Provides a Fiber handler for processing a GET request to /.well-known/jwks.json. The JWKS is served from
+the document cache if the database is unavailable, so that resource servers can keep verifying tokens during short
+outages. An ETag derived from the body is returned with it, so that resource servers can refresh their copy with
+If-None-Match and receive a 304 when the JWKS has not changed. This should not be called directly, and should only ever
+be passed to Fiber
 */
 func (svc *WellKnownService) GetJWKHandler(c fiber.Ctx) error {
-	jwks, err := jwk.JWKS(svc.server)
+	serv := svc.server.WithContext(c.Context())
+
+	body, stale, err := serv.Documents().Fetch("jwks", func() (any, error) {
+		err := serv.Database().Available()
+		if err != nil {
+			return nil, err
+		}
+
+		return jwk.JWKS(serv)
+	})
+	if err != nil {
+		return middleware.HandleError(c, err)
+	}
+
+	if stale {
+		c.Set("Warning", `110 - "Response is Stale"`)
+	}
+
+	digest := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(digest[:16]) + `"`
+
+	c.Set(fiber.HeaderETag, etag)
+
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	return c.Send(body)
+}
+
+/*
+GetOpenIDConfigurationHandler - Provides a Fiber handler for processing a GET request to
+/.well-known/openid-configuration. The discovery document is rendered from the server's configuration and never touches
+the database, so it is always available. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *WellKnownService) GetOpenIDConfigurationHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	return c.JSON(discovery.OpenIDConfiguration(viper.GetString("issuer"), serv.Config))
+}
+
+/*
+GetChangePasswordHandler - Provides a Fiber handler for processing a GET request to /.well-known/change-password.
+Password managers and browsers use this to send users straight to the page where they change their password, so this
+redirects to AuthorizationConfig.ChangePasswordURL. If it is not configured, then a 404 is returned so that they fall
+back to their own behavior. This should not be called directly, and should only ever be passed to Fiber
+*/
+func (svc *WellKnownService) GetChangePasswordHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	location := serv.Config.AuthorizationConfig.ChangePasswordURL
+	if location == "" {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	return c.Redirect().Status(fiber.StatusFound).To(location)
+}
+
+/*
+GetScopeCatalogHandler - Provides a Fiber handler for processing a GET request to /.well-known/scopes. Publishes the
+scopes registered on every resource server (or only on the resource server identified by the audience query parameter),
+so that consent screens and third-party developers can describe the permissions a client requests. The full catalog is
+served from the document cache if the database is unavailable, the same as the JWKS. The catalog of a single resource
+server is never cached, so that the query parameter cannot be used to fill the cache. This should not be called directly,
+and should only ever be passed to Fiber
+*/
+func (svc *WellKnownService) GetScopeCatalogHandler(c fiber.Ctx) error {
+	serv := svc.server.WithContext(c.Context())
+
+	if audience := c.Query("audience"); audience != "" {
+		catalog, err := scope.Catalog(serv, audience)
+		if err != nil {
+			return middleware.HandleError(c, err)
+		}
+
+		return c.JSON(catalog)
+	}
+
+	body, stale, err := serv.Documents().Fetch("scopes", func() (any, error) {
+		err := serv.Database().Available()
+		if err != nil {
+			return nil, err
+		}
+
+		return scope.Catalog(serv, "")
+	})
 	if err != nil {
 		return middleware.HandleError(c, err)
 	}
 
-	return c.JSON(jwks)
+	if stale {
+		c.Set("Warning", `110 - "Response is Stale"`)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	return c.Send(body)
 }
 
 func NewWellKnownService(server *server.Server, app *fiber.App) *WellKnownService {
@@ -0,0 +1,195 @@
+package golden
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/credstack/credstack/sdk/internal/random"
+	"github.com/credstack/credstack/sdk/pkg/clock"
+)
+
+// UpdateEnv - The environment variable that causes Assert to overwrite golden files instead of comparing against them
+const UpdateEnv = "CREDSTACK_UPDATE_GOLDEN"
+
+// Epoch - The fixed time Clock is set to. Tokens generated by a server using Clock are always issued at this time
+var Epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// rsaKey - A fixed 2048-bit RSA private key in PEM encoded PKCS#8. Only ever used by tests
+//
+//go:embed rsa.pem
+var rsaKey []byte
+
+// ecdsaKey - A fixed P-256 private key in PEM encoded PKCS#8. Only ever used by tests
+//
+//go:embed ecdsa.pem
+var ecdsaKey []byte
+
+/*
+reader - A deterministic io.Reader that produces a SHA-256 based stream from a seed. Each block is the hash of the
+seed and a block counter, so the same seed always produces the same bytes. This is not cryptographically secure and
+must never be used outside of tests
+*/
+type reader struct {
+	// seed - The seed the stream is derived from
+	seed []byte
+
+	// counter - The index of the next block to be generated
+	counter uint64
+
+	// buffer - Bytes from the current block that have not been read yet
+	buffer []byte
+}
+
+/*
+Read - Fills p with the next bytes in the stream. This never returns an error
+*/
+func (r *reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buffer) == 0 {
+			block := make([]byte, len(r.seed)+8)
+			copy(block, r.seed)
+			binary.BigEndian.PutUint64(block[len(r.seed):], r.counter)
+
+			sum := sha256.Sum256(block)
+			r.buffer = sum[:]
+			r.counter++
+		}
+
+		copied := copy(p[n:], r.buffer)
+		r.buffer = r.buffer[copied:]
+		n += copied
+	}
+
+	return n, nil
+}
+
+/*
+NewReader - Returns a deterministic io.Reader for the seed provided in the parameter
+*/
+func NewReader(seed string) io.Reader {
+	return &reader{seed: []byte(seed)}
+}
+
+/*
+Clock - Returns a clock fixed at Epoch. Tests pass this to server.Server.SetClock, so that token and header timestamps
+are the same on every run
+*/
+func Clock() *clock.Fake {
+	return clock.NewFake(Epoch)
+}
+
+/*
+Deterministic - Replaces the SDK's source of randomness with a reader seeded with the name of the test, and restores it
+when the test completes. Salts, client secrets, and random identifiers generated afterward are the same on every run.
+Timestamps are not covered here, as they are read from the clock of the server (see Clock).
+
+RSA key generation is not covered, as rsa.GenerateKey deliberately does not produce the same key from the same random
+stream. Tests should pass RSAKey to jwk.NewPrivateKeyFromRSA instead
+*/
+func Deterministic(t testing.TB) {
+	t.Helper()
+
+	t.Cleanup(random.SetReader(NewReader(t.Name())))
+}
+
+/*
+RSAKey - Returns a fixed RSA private key, so that JWK serialization and RS256 signatures are the same on every run
+*/
+func RSAKey(t testing.TB) *rsa.PrivateKey {
+	t.Helper()
+
+	key, ok := parseKey(t, rsaKey).(*rsa.PrivateKey)
+	if !ok {
+		t.Fatalf("golden: rsa.pem is not an RSA key")
+	}
+
+	return key
+}
+
+/*
+ECDSAKey - Returns a fixed P-256 private key, so that JWK serialization is the same on every run. ES256 signatures still
+differ on every run, as crypto/ecdsa always mixes in its own randomness
+*/
+func ECDSAKey(t testing.TB) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, ok := parseKey(t, ecdsaKey).(*ecdsa.PrivateKey)
+	if !ok {
+		t.Fatalf("golden: ecdsa.pem is not an ECDSA key")
+	}
+
+	return key
+}
+
+/*
+parseKey - Parses a PEM encoded PKCS#8 private key, and fails the test if it cannot be
+*/
+func parseKey(t testing.TB, encoded []byte) any {
+	t.Helper()
+
+	block, _ := pem.Decode(encoded)
+	if block == nil {
+		t.Fatalf("golden: failed to decode PEM block")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("golden: failed to parse key: %v", err)
+	}
+
+	return key
+}
+
+/*
+Path - Returns the path of the golden file for the name provided in the parameter. Golden files are stored under the
+testdata directory of the package being tested
+*/
+func Path(name string) string {
+	return filepath.Join("testdata", name+".golden")
+}
+
+/*
+Assert - Compares got against the contents of the golden file with the name provided in the parameter, and fails the
+test if they differ byte-for-byte. If the CREDSTACK_UPDATE_GOLDEN environment variable is set, then the golden file
+is written with got instead
+*/
+func Assert(t testing.TB, name string, got []byte) {
+	t.Helper()
+
+	path := Path(name)
+
+	if os.Getenv(UpdateEnv) != "" {
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatalf("golden: failed to create testdata directory: %v", err)
+		}
+
+		err = os.WriteFile(path, got, 0o644)
+		if err != nil {
+			t.Fatalf("golden: failed to write %s: %v", path, err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden: failed to read %s (run with %s=1 to create it): %v", path, UpdateEnv, err)
+	}
+
+	if !bytes.Equal(want, got) {
+		t.Errorf("golden: output does not match %s\n--- want\n%s\n--- got\n%s", path, want, got)
+	}
+}
@@ -0,0 +1,33 @@
+package random
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+/*
+reader - The source of randomness used for all secrets generated by credstack. This is only ever replaced with
+SetReader so that token generation and hashing can be verified against golden files
+*/
+var reader io.Reader = rand.Reader
+
+/*
+Reader - Returns the source of randomness used by the SDK. This is rand.Reader unless it has been replaced with SetReader
+*/
+func Reader() io.Reader {
+	return reader
+}
+
+/*
+SetReader - Replaces the source of randomness used by the SDK. This is internal so that it can only ever be called from
+tests within the SDK (see golden.Deterministic), as any secrets generated afterward are predictable. A function is
+returned that restores the previous reader, and should be deferred by the caller
+*/
+func SetReader(r io.Reader) func() {
+	previous := reader
+	reader = r
+
+	return func() {
+		reader = previous
+	}
+}
@@ -3,15 +3,26 @@ package internal
 import "time"
 
 /*
-UnixTimestamp - Returns a UNIX timestamp representing the current date/time
+StringTimestamp - Returns a string representing a human-readable timestamp of the time provided in the parameter. Most
+commonly used in log file names
 */
-func UnixTimestamp() int64 {
-	return time.Now().Unix()
+func StringTimestamp(t time.Time) string {
+	return t.Format("20060102T150405")
 }
 
 /*
-StringTimestamp - Returns a string representing a human-readable timestamp. Most commonly used in log file names
+LoadLocation - Loads the IANA time zone provided in the parameter (America/New_York). If the zone is empty or cannot
+be loaded, then UTC is returned instead, so that callers can always safely convert timestamps
 */
-func StringTimestamp() string {
-	return time.Now().Format("20060102T150405")
+func LoadLocation(zone string) *time.Location {
+	if zone == "" {
+		return time.UTC
+	}
+
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return location
 }
@@ -0,0 +1,147 @@
+package xmldsig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// ErrMalformedDocument - Returned when a document is not well-formed, contains a document type declaration, or has duplicate IDs
+var ErrMalformedDocument = errors.New("xmldsig: malformed document")
+
+/*
+Element - An element of a parsed document, with lookups that match elements by their namespace rather than the prefix
+they were written with
+*/
+type Element struct {
+	// element - The underlying element
+	element *etree.Element
+}
+
+/*
+Parse - Parses the document provided in the parameter and returns its document element. Documents with a document type
+declaration are rejected, so that entity expansion can never be used against the parser, as are documents with two
+elements sharing an ID, so that a signature can never be resolved to a different element than the one the caller reads
+*/
+func Parse(data []byte) (*Element, error) {
+	document := etree.NewDocument()
+
+	err := document.ReadFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrMalformedDocument, err)
+	}
+
+	for _, token := range document.Child {
+		if _, ok := token.(*etree.Directive); ok {
+			return nil, fmt.Errorf("%w (document type declarations are not allowed)", ErrMalformedDocument)
+		}
+	}
+
+	root := document.Root()
+	if root == nil {
+		return nil, fmt.Errorf("%w (no document element)", ErrMalformedDocument)
+	}
+
+	ids := make(map[string]bool)
+
+	var walk func(element *etree.Element) error
+	walk = func(element *etree.Element) error {
+		// prefixed ID attributes are counted as well, as etree matches them when looking an ID up
+		for _, attr := range element.Attr {
+			if attr.Key != "ID" || attr.Space == "xmlns" {
+				continue
+			}
+
+			if ids[attr.Value] {
+				return fmt.Errorf("%w (duplicate ID %s)", ErrMalformedDocument, attr.Value)
+			}
+
+			ids[attr.Value] = true
+		}
+
+		for _, child := range element.ChildElements() {
+			err := walk(child)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err = walk(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Element{element: root}, nil
+}
+
+/*
+Is - Determines if the element has the namespace and local name provided in the parameters
+*/
+func (element *Element) Is(namespace string, local string) bool {
+	return element.element.Tag == local && element.element.NamespaceURI() == namespace
+}
+
+/*
+Attr - Returns the value of the unprefixed attribute with the name provided in the parameter, or an empty string if the
+element does not have it
+*/
+func (element *Element) Attr(local string) string {
+	for _, attr := range element.element.Attr {
+		if attr.Space == "" && attr.Key == local {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+/*
+Child - Returns the first child element with the namespace and local name provided in the parameters, or nil if there is
+none
+*/
+func (element *Element) Child(namespace string, local string) *Element {
+	children := element.ChildrenNamed(namespace, local)
+	if len(children) == 0 {
+		return nil
+	}
+
+	return children[0]
+}
+
+/*
+ChildrenNamed - Returns every child element with the namespace and local name provided in the parameters
+*/
+func (element *Element) ChildrenNamed(namespace string, local string) []*Element {
+	var ret []*Element
+
+	for _, child := range element.element.ChildElements() {
+		nested := &Element{element: child}
+		if nested.Is(namespace, local) {
+			ret = append(ret, nested)
+		}
+	}
+
+	return ret
+}
+
+/*
+Text - Returns the character data of the element, excluding that of its children, with leading and trailing whitespace
+removed. Comments are skipped rather than ending the text, as they are not part of the canonical form a signature covers,
+so a comment injected into a signed value can never be used to truncate it
+*/
+func (element *Element) Text() string {
+	var builder strings.Builder
+
+	for _, token := range element.element.Child {
+		if data, ok := token.(*etree.CharData); ok {
+			builder.WriteString(data.Data)
+		}
+	}
+
+	return strings.TrimSpace(builder.String())
+}
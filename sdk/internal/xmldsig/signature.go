@@ -0,0 +1,128 @@
+package xmldsig
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// NamespaceDSig - The namespace of XML signatures
+const NamespaceDSig = dsig.Namespace
+
+// ErrInvalidSignature - Returned when an element is not signed, is signed with an unsupported algorithm, or its signature does not verify against any of the trusted certificates
+var ErrInvalidSignature = errors.New("xmldsig: invalid signature")
+
+/*
+sha1Algorithms - The signature and digest algorithms that use SHA-1, which are rejected unless the caller allows them
+*/
+var sha1Algorithms = map[string]bool{
+	dsig.RSASHA1SignatureMethod:              true,
+	dsig.ECDSASHA1SignatureMethod:            true,
+	"http://www.w3.org/2000/09/xmldsig#sha1": true,
+}
+
+/*
+Signed - Determines if the element provided in the parameter has an enveloped signature as a direct child
+*/
+func Signed(element *Element) bool {
+	return element.Child(NamespaceDSig, "Signature") != nil
+}
+
+/*
+Verify - Verifies the enveloped signature that is a direct child of the element provided in the parameter with
+goxmldsig, against the certificates provided in the parameter, and returns the element that was verified. Callers must
+only read from the element returned, as it is the content the signature covers, with the signature removed. Certificates
+that are not valid at the time provided in the parameter are not trusted.
+
+The signature must have exactly one reference, and it must be to the element itself (by its ID attribute), so that a
+signature over a different element cannot be wrapped around it. Only exclusive canonicalization is supported. If allowSHA1
+is false, then signatures and digests using SHA-1 are rejected
+*/
+func Verify(element *Element, certificates []*x509.Certificate, now time.Time, allowSHA1 bool) (*Element, error) {
+	signatures := element.ChildrenNamed(NamespaceDSig, "Signature")
+	if len(signatures) != 1 {
+		return nil, fmt.Errorf("%w (expected exactly one signature)", ErrInvalidSignature)
+	}
+
+	signedInfo := signatures[0].Child(NamespaceDSig, "SignedInfo")
+	if signedInfo == nil {
+		return nil, fmt.Errorf("%w (missing SignedInfo)", ErrInvalidSignature)
+	}
+
+	canonicalization := signedInfo.Child(NamespaceDSig, "CanonicalizationMethod")
+	if canonicalization == nil || canonicalization.Attr("Algorithm") != dsig.CanonicalXML10ExclusiveAlgorithmId.String() {
+		return nil, fmt.Errorf("%w (unsupported canonicalization method)", ErrInvalidSignature)
+	}
+
+	method := signedInfo.Child(NamespaceDSig, "SignatureMethod")
+	if method == nil || (sha1Algorithms[method.Attr("Algorithm")] && !allowSHA1) {
+		return nil, fmt.Errorf("%w (unsupported signature method)", ErrInvalidSignature)
+	}
+
+	references := signedInfo.ChildrenNamed(NamespaceDSig, "Reference")
+	if len(references) != 1 {
+		return nil, fmt.Errorf("%w (expected exactly one reference)", ErrInvalidSignature)
+	}
+
+	id := element.Attr("ID")
+	if id == "" || references[0].Attr("URI") != "#"+id {
+		return nil, fmt.Errorf("%w (the signature does not reference the signed element)", ErrInvalidSignature)
+	}
+
+	digestMethod := references[0].Child(NamespaceDSig, "DigestMethod")
+	if digestMethod == nil || (sha1Algorithms[digestMethod.Attr("Algorithm")] && !allowSHA1) {
+		return nil, fmt.Errorf("%w (unsupported digest method)", ErrInvalidSignature)
+	}
+
+	/*
+		The element is detached with every namespace that is in scope declared on it, as goxmldsig verifies a copy of the
+		element without its ancestors. Exclusive canonicalization only renders the namespaces that are used, so this
+		does not change what is digested
+	*/
+	nsContext, err := etreeutils.NSBuildParentContext(element.element)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrInvalidSignature, err)
+	}
+
+	detached, err := etreeutils.NSDetatch(nsContext, element.element)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrInvalidSignature, err)
+	}
+
+	err = errors.New("no trusted certificates")
+
+	// each certificate is tried on its own, as goxmldsig requires a signature without key information to have a single trusted certificate
+	for _, certificate := range certificates {
+		validation := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{certificate}})
+		validation.Clock = dsig.NewFakeClockAt(now)
+
+		var verified *etree.Element
+
+		verified, err = validation.Validate(detached)
+		if err == nil {
+			return &Element{element: verified}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w (%v)", ErrInvalidSignature, err)
+}
+
+/*
+ParseCertificate - Parses a base64 encoded DER certificate, as it appears in an X509Certificate element, which may be
+wrapped over several lines
+*/
+func ParseCertificate(value string) (*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
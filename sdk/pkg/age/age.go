@@ -0,0 +1,154 @@
+package age
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	agelib "filippo.io/age"
+	"filippo.io/age/armor"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+const (
+	// headerVersion - The first line of every age file
+	headerVersion = "age-encryption.org/v1"
+
+	// maxWorkFactor - The largest scrypt work factor (log2 of N) that will be attempted, so that a crafted file cannot make startup hang
+	maxWorkFactor = 22
+)
+
+// ErrMalformedFile - Provides a named error for when data is not a valid age file
+var ErrMalformedFile = credstackError.NewError(500, "ERR_AGE_MALFORMED", "age: file is not a valid age encrypted file")
+
+// ErrNoIdentityMatched - Provides a named error for when none of the identities can decrypt the file
+var ErrNoIdentityMatched = credstackError.NewError(500, "ERR_AGE_NO_IDENTITY", "age: none of the provided identities can decrypt the file")
+
+// ErrDecryptFailed - Provides a named error for when the header or payload fails authentication. The file has been corrupted or tampered with
+var ErrDecryptFailed = credstackError.NewError(500, "ERR_AGE_DECRYPT", "age: failed to decrypt file, it may have been modified")
+
+// ErrMalformedIdentity - Provides a named error for when an identity is not a valid AGE-SECRET-KEY-1... string
+var ErrMalformedIdentity = credstackError.NewError(500, "ERR_AGE_MALFORMED_IDENTITY", "age: identity is not a valid age secret key")
+
+/*
+Identity - Unwraps the file key from the stanzas of an age file. This is the identity of the reference implementation
+(filippo.io/age), so any identity it provides can be passed to Decrypt
+*/
+type Identity = agelib.Identity
+
+/*
+X25519Identity - An age identity backed by an X25519 private key. These are the keys generated by age-keygen
+*/
+type X25519Identity = agelib.X25519Identity
+
+/*
+ScryptIdentity - An age identity backed by a passphrase. These decrypt files encrypted with age -p
+*/
+type ScryptIdentity = agelib.ScryptIdentity
+
+/*
+IsEncrypted - Determines if the data provided in the parameter is an age encrypted file, in either the binary or the
+ASCII armored format
+*/
+func IsEncrypted(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+
+	return bytes.HasPrefix(trimmed, []byte(headerVersion+"\n")) || bytes.HasPrefix(trimmed, []byte(armor.Header))
+}
+
+/*
+Decrypt - Decrypts an age encrypted file (https://age-encryption.org/v1) with the first identity that is a recipient of
+it, using the reference implementation (filippo.io/age). Files produced by the age and rage CLIs with X25519 recipients
+or passphrases are supported, in either the binary or the ASCII armored (-a) format. Files encrypted to plugin or SSH
+recipients are not supported
+*/
+func Decrypt(data []byte, identities ...Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(data)
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(trimmed))
+	}
+
+	reader, err := agelib.Decrypt(src, identities...)
+	if err != nil {
+		return nil, decryptError(err)
+	}
+
+	ret, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, decryptError(err)
+	}
+
+	return ret, nil
+}
+
+/*
+decryptError - Converts an error returned by the reference implementation to the named error it represents
+*/
+func decryptError(err error) error {
+	var noMatch *agelib.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return fmt.Errorf("%w (%v)", ErrNoIdentityMatched, err)
+	}
+
+	var armorErr *armor.Error
+	if errors.As(err, &armorErr) {
+		return fmt.Errorf("%w (%v)", ErrMalformedFile, err)
+	}
+
+	return fmt.Errorf("%w (%v)", ErrDecryptFailed, err)
+}
+
+/*
+ParseX25519Identity - Parses an X25519 identity in the AGE-SECRET-KEY-1... format that age-keygen produces
+*/
+func ParseX25519Identity(value string) (*X25519Identity, error) {
+	identity, err := agelib.ParseX25519Identity(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrMalformedIdentity, err)
+	}
+
+	return identity, nil
+}
+
+/*
+ParseIdentities - Parses every identity in an identity file, like the ones written by age-keygen. Blank lines and lines
+starting with # are ignored
+*/
+func ParseIdentities(text string) ([]Identity, error) {
+	// lines are trimmed, as identities passed through the environment often carry indentation or CRLF line endings
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+
+	ret, err := agelib.ParseIdentities(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrMalformedIdentity, err)
+	}
+
+	return ret, nil
+}
+
+/*
+NewScryptIdentity - Constructs an identity that decrypts files encrypted with the passphrase provided in the parameter.
+Files that require a scrypt work factor above 22 are rejected, so that a crafted file cannot make startup hang. If the
+passphrase is empty, then ErrEmptyPassphrase is returned
+*/
+func NewScryptIdentity(passphrase string) (*ScryptIdentity, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+
+	identity, err := agelib.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrEmptyPassphrase, err)
+	}
+
+	identity.SetMaxWorkFactor(maxWorkFactor)
+
+	return identity, nil
+}
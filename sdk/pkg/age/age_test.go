@@ -0,0 +1,197 @@
+package age
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	agelib "filippo.io/age"
+)
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	identity, err := NewScryptIdentity("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewScryptIdentity: %v", err)
+	}
+
+	// the payload is encrypted in 64 KiB chunks, so the sizes around a chunk boundary are covered as well
+	for _, size := range []int{0, 1, 64 * 1024, 64*1024 + 1} {
+		plaintext := bytes.Repeat([]byte{'a'}, size)
+
+		encrypted, err := EncryptWithPassphrase(plaintext, "correct horse battery staple")
+		if err != nil {
+			t.Fatalf("EncryptWithPassphrase(%d bytes): %v", size, err)
+		}
+
+		if !IsEncrypted(encrypted) || !bytes.HasPrefix(encrypted, []byte("-----BEGIN AGE ENCRYPTED FILE-----\n")) {
+			t.Fatalf("EncryptWithPassphrase(%d bytes) is not an armored age file", size)
+		}
+
+		decrypted, err := Decrypt(encrypted, identity)
+		if err != nil {
+			t.Fatalf("Decrypt(%d bytes): %v", size, err)
+		}
+
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("Decrypt(%d bytes) returned %d bytes that do not match the plaintext", size, len(decrypted))
+		}
+	}
+}
+
+func TestPassphraseMismatch(t *testing.T) {
+	encrypted, err := EncryptWithPassphrase([]byte("secret"), "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase: %v", err)
+	}
+
+	identity, err := NewScryptIdentity("incorrect horse")
+	if err != nil {
+		t.Fatalf("NewScryptIdentity: %v", err)
+	}
+
+	_, err = Decrypt(encrypted, identity)
+	if !errors.Is(err, ErrNoIdentityMatched) {
+		t.Fatalf("Decrypt = %v, want ErrNoIdentityMatched", err)
+	}
+}
+
+func TestEmptyPassphrase(t *testing.T) {
+	_, err := EncryptWithPassphrase([]byte("secret"), "")
+	if !errors.Is(err, ErrEmptyPassphrase) {
+		t.Fatalf("EncryptWithPassphrase = %v, want ErrEmptyPassphrase", err)
+	}
+
+	_, err = NewScryptIdentity("")
+	if !errors.Is(err, ErrEmptyPassphrase) {
+		t.Fatalf("NewScryptIdentity = %v, want ErrEmptyPassphrase", err)
+	}
+}
+
+/*
+encryptTo - Encrypts the plaintext to the recipient with the reference implementation, in the binary format that age -r
+writes
+*/
+func encryptTo(t *testing.T, recipient agelib.Recipient, plaintext []byte) []byte {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	writer, err := agelib.Encrypt(&out, recipient)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	return out.Bytes()
+}
+
+func TestX25519IdentityFile(t *testing.T) {
+	other, err := agelib.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity: %v", err)
+	}
+
+	recipient, err := agelib.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity: %v", err)
+	}
+
+	encrypted := encryptTo(t, recipient.Recipient(), []byte(`{"database":{"password":"secret"}}`))
+	if !IsEncrypted(encrypted) {
+		t.Fatalf("IsEncrypted = false for a binary age file")
+	}
+
+	// the layout age-keygen writes, with CRLF line endings as identity files copied from Windows have
+	file := "# created: 2026-01-01T00:00:00Z\r\n# public key: " + other.Recipient().String() + "\r\n" + other.String() + "\r\n\r\n  " + recipient.String() + "\r\n"
+
+	identities, err := ParseIdentities(file)
+	if err != nil {
+		t.Fatalf("ParseIdentities: %v", err)
+	}
+
+	if len(identities) != 2 {
+		t.Fatalf("ParseIdentities returned %d identities, want 2", len(identities))
+	}
+
+	decrypted, err := Decrypt(encrypted, identities...)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+
+	if string(decrypted) != `{"database":{"password":"secret"}}` {
+		t.Fatalf("Decrypt = %q", decrypted)
+	}
+
+	_, err = Decrypt(encrypted, identities[0])
+	if !errors.Is(err, ErrNoIdentityMatched) {
+		t.Fatalf("Decrypt with another identity = %v, want ErrNoIdentityMatched", err)
+	}
+}
+
+func TestTamperedFile(t *testing.T) {
+	recipient, err := agelib.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity: %v", err)
+	}
+
+	encrypted := encryptTo(t, recipient.Recipient(), []byte("secret"))
+
+	tests := map[string]func([]byte) []byte{
+		"payload": func(file []byte) []byte {
+			file[len(file)-1] ^= 1
+			return file
+		},
+		"header": func(file []byte) []byte {
+			return bytes.Replace(file, []byte("-> X25519 "), []byte("-> X25519 A"), 1)
+		},
+		"truncated": func(file []byte) []byte {
+			return file[:len(file)-1]
+		},
+	}
+
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Decrypt(tamper(bytes.Clone(encrypted)), recipient)
+			if err == nil {
+				t.Fatalf("Decrypt succeeded on a tampered file")
+			}
+		})
+	}
+}
+
+func TestMalformedInput(t *testing.T) {
+	if IsEncrypted([]byte(`{"database":{}}`)) {
+		t.Fatalf("IsEncrypted = true for a plaintext config")
+	}
+
+	identity, err := NewScryptIdentity("passphrase")
+	if err != nil {
+		t.Fatalf("NewScryptIdentity: %v", err)
+	}
+
+	_, err = Decrypt([]byte("-----BEGIN AGE ENCRYPTED FILE-----\nnot base64!\n-----END AGE ENCRYPTED FILE-----\n"), identity)
+	if !errors.Is(err, ErrMalformedFile) {
+		t.Fatalf("Decrypt = %v, want ErrMalformedFile", err)
+	}
+
+	for _, text := range []string{"", "# only a comment\n", "AGE-SECRET-KEY-1INVALID", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"} {
+		_, err = ParseIdentities(text)
+		if !errors.Is(err, ErrMalformedIdentity) {
+			t.Errorf("ParseIdentities(%q) = %v, want ErrMalformedIdentity", text, err)
+		}
+	}
+
+	if _, err = ParseX25519Identity(strings.ToLower("AGE-SECRET-KEY-1INVALID")); !errors.Is(err, ErrMalformedIdentity) {
+		t.Errorf("ParseX25519Identity = %v, want ErrMalformedIdentity", err)
+	}
+}
@@ -0,0 +1,63 @@
+package age
+
+import (
+	"bytes"
+	"fmt"
+
+	agelib "filippo.io/age"
+	"filippo.io/age/armor"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// workFactor - The scrypt work factor (log2 of N) that files are encrypted with. This is the default of the age CLI
+const workFactor = 18
+
+// ErrEncryptFailed - Provides a named error for when a file cannot be encrypted
+var ErrEncryptFailed = credstackError.NewError(500, "ERR_AGE_ENCRYPT", "age: failed to encrypt file")
+
+// ErrEmptyPassphrase - Provides a named error for when a file is encrypted with an empty passphrase
+var ErrEmptyPassphrase = credstackError.NewError(400, "ERR_AGE_EMPTY_PASSPHRASE", "age: passphrase must not be empty")
+
+/*
+EncryptWithPassphrase - Encrypts the plaintext provided in the parameter with a passphrase, and returns it as an ASCII
+armored age file. The file is the same as one produced by age -p -a, so it can be decrypted with the age CLI as well as
+with Decrypt and a ScryptIdentity
+*/
+func EncryptWithPassphrase(plaintext []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+
+	recipient, err := agelib.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrEncryptFailed, err)
+	}
+
+	recipient.SetWorkFactor(workFactor)
+
+	var out bytes.Buffer
+
+	armored := armor.NewWriter(&out)
+
+	writer, err := agelib.Encrypt(armored, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrEncryptFailed, err)
+	}
+
+	_, err = writer.Write(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrEncryptFailed, err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrEncryptFailed, err)
+	}
+
+	err = armored.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrEncryptFailed, err)
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,59 @@
+package approval
+
+import (
+	"github.com/credstack/credstack/sdk/pkg/approval/gate"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+
+	/*
+		Each of these packages registers the actions it owns with the gate, so they are imported here to ensure that
+		every action can be requested whenever approvals are used
+	*/
+	_ "github.com/credstack/credstack/sdk/pkg/oauth/client"
+	_ "github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	_ "github.com/credstack/credstack/sdk/pkg/oauth/resourceserver"
+	_ "github.com/credstack/credstack/sdk/pkg/oauth/token"
+	_ "github.com/credstack/credstack/sdk/pkg/user"
+)
+
+const (
+	// ActionClientDelete - Deletes the client whose client ID is the target
+	ActionClientDelete = gate.ActionClientDelete
+
+	// ActionResourceServerDelete - Deletes the resource server whose audience is the target
+	ActionResourceServerDelete = gate.ActionResourceServerDelete
+
+	// ActionUserDelete - Deletes the user whose email address is the target
+	ActionUserDelete = gate.ActionUserDelete
+
+	// ActionKeyRotate - Rotates the signing keys of every algorithm the audience that is the target has a current key for
+	ActionKeyRotate = gate.ActionKeyRotate
+
+	// ActionTokenRevokeAll - Revokes every token issued to the client whose client ID is the target
+	ActionTokenRevokeAll = gate.ActionTokenRevokeAll
+)
+
+// ErrUnknownAction - An error that gets returned when an approval is requested for an action that does not exist
+var ErrUnknownAction = credstackError.NewError(400, "ERR_UNKNOWN_APPROVAL_ACTION", "approval: The requested action does not exist")
+
+// ErrApprovalRequired - An error that gets returned when an action requires approval but was executed directly
+var ErrApprovalRequired = gate.ErrApprovalRequired
+
+/*
+Executor - Executes an approved action against its target
+*/
+type Executor = gate.Executor
+
+/*
+Register - Makes an action available for approval under the name provided in the parameter. Registering an action with
+the same name as an existing one replaces it
+*/
+func Register(action string, executor Executor) {
+	gate.Register(action, executor)
+}
+
+/*
+executor - Returns the Executor registered for the action provided in the parameter
+*/
+func executor(action string) (Executor, bool) {
+	return gate.Lookup(action)
+}
@@ -0,0 +1,346 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/credstack/credstack/sdk/pkg/audit"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// StatusPending - The approval is waiting for a second admin
+	StatusPending string = "pending"
+
+	// StatusExecuted - The approval was approved and the action was executed successfully
+	StatusExecuted string = "executed"
+
+	// StatusFailed - The approval was approved, but the action returned an error when it was executed
+	StatusFailed string = "failed"
+
+	// StatusRejected - The approval was rejected by a second admin
+	StatusRejected string = "rejected"
+
+	// StatusExpired - The approval was not approved before its TTL elapsed
+	StatusExpired string = "expired"
+)
+
+// ErrApprovalDoesNotExist - An error that gets returned when an approval cannot be found
+var ErrApprovalDoesNotExist = credstackError.NewError(404, "ERR_APPROVAL_DOES_NOT_EXIST", "approval: Approval does not exist under the specified identifier")
+
+// ErrApprovalMissingIdentifier - An error that gets returned when an approval is fetched without an identifier
+var ErrApprovalMissingIdentifier = credstackError.NewError(400, "ERR_APPROVAL_MISSING_ID", "approval: Approval is missing an identifier")
+
+// ErrApprovalNotPending - An error that gets returned when an approval that has already been decided is approved or rejected
+var ErrApprovalNotPending = credstackError.NewError(409, "ERR_APPROVAL_NOT_PENDING", "approval: Approval is no longer pending")
+
+// ErrApprovalExpired - An error that gets returned when an approval is approved after its TTL has elapsed
+var ErrApprovalExpired = credstackError.NewError(410, "ERR_APPROVAL_EXPIRED", "approval: Approval has expired")
+
+// ErrSelfApproval - An error that gets returned when the admin that requested an action attempts to approve it
+var ErrSelfApproval = credstackError.NewError(403, "ERR_SELF_APPROVAL", "approval: An action must be approved by a different admin than the one who requested it")
+
+// ErrMissingActor - An error that gets returned when an approval is requested, approved, or rejected without identifying the admin
+var ErrMissingActor = credstackError.NewError(400, "ERR_APPROVAL_MISSING_ACTOR", "approval: The admin performing this operation must be identified")
+
+/*
+Approval - Represents a destructive action that is waiting for (or has received) a second admin's approval
+*/
+type Approval struct {
+	// Header - The header for the Approval. Created at object birth
+	Header *header.Header `json:"header" bson:"header"`
+
+	// Action - The name of the action to execute (client.delete, key.rotate)
+	Action string `json:"action" bson:"action"`
+
+	// Target - The object the action is executed against (a client ID, an audience, an email address)
+	Target string `json:"target" bson:"target"`
+
+	// RequestedBy - The admin that requested the action
+	RequestedBy string `json:"requested_by" bson:"requested_by"`
+
+	// DecidedBy - The admin that approved or rejected the action. Empty while pending
+	DecidedBy string `json:"decided_by" bson:"decided_by"`
+
+	// Status - The current status of the approval. Can be: pending, executed, failed, rejected, expired
+	Status string `json:"status" bson:"status"`
+
+	// ExpiresAt - A unix timestamp representing when the approval can no longer be approved
+	ExpiresAt int64 `json:"expires_at" bson:"expires_at"`
+
+	// Result - A message describing the result of executing the action. Empty until the action is executed
+	Result string `json:"result" bson:"result"`
+}
+
+/*
+Request - Creates a pending approval for the action provided in the parameter. The approval must be approved by a
+different admin with Approve before ApprovalConfig.TTL elapses, otherwise it expires. If the action does not exist,
+ErrUnknownAction is returned
+*/
+func Request(serv *server.Server, action string, target string, requestedBy string) (*Approval, error) {
+	if requestedBy == "" {
+		return nil, ErrMissingActor
+	}
+
+	if _, ok := executor(action); !ok {
+		return nil, ErrUnknownAction
+	}
+
+	/*
+		Approvals have no immutable natural key (the same action can be requested multiple times), so a random basis is
+		used for the header instead
+	*/
+	approvalHeader, err := header.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	now := serv.Clock().Now()
+
+	ret := &Approval{
+		Header:      approvalHeader,
+		Action:      action,
+		Target:      target,
+		RequestedBy: requestedBy,
+		Status:      StatusPending,
+		ExpiresAt:   now.Add(serv.Config.ApprovalConfig.TTL).Unix(),
+	}
+
+	_, err = serv.Database().Collection("approval").InsertOne(serv.Context(), ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	logEvent(serv, "approval.requested", requestedBy, ret)
+
+	return ret, nil
+}
+
+/*
+Get - Fetches an approval from the database using its identifier. If the approval does not exist, then
+ErrApprovalDoesNotExist is returned
+*/
+func Get(serv *server.Server, identifier string) (*Approval, error) {
+	if identifier == "" {
+		return nil, ErrApprovalMissingIdentifier
+	}
+
+	result := serv.Database().Collection("approval").FindOne(serv.Context(), bson.M{"header.identifier": identifier})
+
+	var ret Approval
+
+	err := result.Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrApprovalDoesNotExist
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+List - Lists approvals with the status provided in the parameter, newest first. If status is empty, then approvals of
+every status are returned. The maximum that can be returned in a single call is 10, and if a limit exceeds this, it
+will be reset to 10
+*/
+func List(serv *server.Server, status string, limit int) ([]*Approval, error) {
+	if limit > 10 || limit <= 0 {
+		limit = 10
+	}
+
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	result, err := serv.Database().ReadCollection("approval", server.ReadClassList).Find(
+		serv.Context(),
+		filter,
+		mongoOpts.Find().SetLimit(int64(limit)).SetSort(bson.D{{Key: "header.created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := make([]*Approval, 0, limit)
+
+	err = result.All(serv.Context(), &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return ret, nil
+}
+
+/*
+Approve - Approves a pending action and executes it. The approving admin must be different from the one who requested
+the action, and the approval must not have expired. The approval is claimed atomically before the action is executed,
+so two admins approving at the same time cannot execute the action twice. If the action fails, the approval is marked
+as failed and the error is returned
+*/
+func Approve(serv *server.Server, identifier string, approvedBy string) (*Approval, error) {
+	pending, err := claim(serv, identifier, approvedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	pending.DecidedBy = approvedBy
+	pending.Status = StatusExecuted
+	pending.Result = "executed successfully"
+
+	var execErr error
+
+	execute, ok := executor(pending.Action)
+	if !ok {
+		execErr = ErrUnknownAction
+	} else {
+		execErr = execute(serv, pending.Target)
+	}
+
+	if execErr != nil {
+		pending.Status = StatusFailed
+		pending.Result = execErr.Error()
+	}
+
+	// the action has already been executed, so its result is recorded even if the request has been cancelled since
+	_, err = serv.Database().Collection("approval").UpdateOne(
+		context.WithoutCancel(serv.Context()),
+		bson.M{"header.identifier": identifier},
+		bson.M{"$set": bson.M{"status": pending.Status, "result": pending.Result}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	logEvent(serv, "approval."+pending.Status, approvedBy, pending)
+
+	if execErr != nil {
+		return pending, execErr
+	}
+
+	return pending, nil
+}
+
+/*
+Reject - Rejects a pending action so that it can never be executed. Unlike Approve, the requesting admin may reject
+their own action, which is how a request is cancelled
+*/
+func Reject(serv *server.Server, identifier string, rejectedBy string) (*Approval, error) {
+	if rejectedBy == "" {
+		return nil, ErrMissingActor
+	}
+
+	result := serv.Database().Collection("approval").FindOneAndUpdate(
+		serv.Context(),
+		bson.M{"header.identifier": identifier, "status": StatusPending},
+		bson.M{"$set": bson.M{"status": StatusRejected, "decided_by": rejectedBy}},
+		mongoOpts.FindOneAndUpdate().SetReturnDocument(mongoOpts.After),
+	)
+
+	var ret Approval
+
+	err := result.Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, notPendingError(serv, identifier)
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	logEvent(serv, "approval.rejected", rejectedBy, &ret)
+
+	return &ret, nil
+}
+
+/*
+claim - Atomically moves a pending, unexpired approval that was requested by someone other than the approver out of the
+pending state. If no approval matches, then the reason is determined and a named error is returned
+*/
+func claim(serv *server.Server, identifier string, approvedBy string) (*Approval, error) {
+	if approvedBy == "" {
+		return nil, ErrMissingActor
+	}
+
+	result := serv.Database().Collection("approval").FindOneAndUpdate(
+		serv.Context(),
+		bson.M{
+			"header.identifier": identifier,
+			"status":            StatusPending,
+			"requested_by":      bson.M{"$ne": approvedBy},
+			"expires_at":        bson.M{"$gt": serv.Clock().Now().Unix()},
+		},
+		bson.M{"$set": bson.M{"status": StatusExecuted, "decided_by": approvedBy}},
+	)
+
+	var ret Approval
+
+	err := result.Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, notPendingError(serv, identifier, approvedBy)
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+notPendingError - Determines why an approval could not be claimed. Expired approvals are marked as expired here, as
+there is no background job that expires them
+*/
+func notPendingError(serv *server.Server, identifier string, approvedBy ...string) error {
+	existing, err := Get(serv, identifier)
+	if err != nil {
+		return err
+	}
+
+	if existing.Status != StatusPending {
+		return ErrApprovalNotPending
+	}
+
+	if len(approvedBy) != 0 && existing.RequestedBy == approvedBy[0] {
+		return ErrSelfApproval
+	}
+
+	if existing.ExpiresAt <= serv.Clock().Now().Unix() {
+		_, err = serv.Database().Collection("approval").UpdateOne(
+			serv.Context(),
+			bson.M{"header.identifier": identifier, "status": StatusPending},
+			bson.M{"$set": bson.M{"status": StatusExpired}},
+		)
+		if err != nil {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		return ErrApprovalExpired
+	}
+
+	return ErrApprovalNotPending
+}
+
+/*
+logEvent - Records a change to an approval in the audit log. Failures are logged rather than returned, as the approval
+itself has already been persisted
+*/
+func logEvent(serv *server.Server, eventType string, actor string, approval *Approval) {
+	err := audit.Log(serv, eventType, actor, approval.Header.Identifier, fmt.Sprintf("%s %s", approval.Action, approval.Target), map[string]string{
+		"action": approval.Action,
+		"target": approval.Target,
+		"status": approval.Status,
+	})
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to record approval in the audit log", err)
+	}
+}
@@ -0,0 +1,76 @@
+package gate
+
+import (
+	"sync"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+const (
+	// ActionClientDelete - Deletes the client whose client ID is the target
+	ActionClientDelete string = "client.delete"
+
+	// ActionResourceServerDelete - Deletes the resource server whose audience is the target
+	ActionResourceServerDelete string = "resource_server.delete"
+
+	// ActionUserDelete - Deletes the user whose email address is the target
+	ActionUserDelete string = "user.delete"
+
+	// ActionKeyRotate - Rotates the signing keys of every algorithm the audience that is the target has a current key for
+	ActionKeyRotate string = "key.rotate"
+
+	// ActionTokenRevokeAll - Revokes every token issued to the client whose client ID is the target
+	ActionTokenRevokeAll string = "token.revoke_all"
+)
+
+// ErrApprovalRequired - An error that gets returned when an action requires approval but was executed directly
+var ErrApprovalRequired = credstackError.NewError(403, "ERR_APPROVAL_REQUIRED", "approval: This action requires approval from a second admin")
+
+/*
+Executor - Executes an approved action against its target, without checking for approval again
+*/
+type Executor func(serv *server.Server, target string) error
+
+// mu - Protects executors, as actions may be registered while approvals are being processed
+var mu sync.RWMutex
+
+// executors - Every action that can be requested, keyed by its name. The packages that own each action register it here
+var executors = map[string]Executor{}
+
+/*
+Check - Returns ErrApprovalRequired if the action provided in the parameter requires approval (see
+ApprovalConfig.RequiredActions). Every SDK operation that can be gated calls this before doing anything, so that no caller
+can execute the action without it being approved. Approved actions are executed through their Executor instead, which
+skips this check
+*/
+func Check(serv *server.Server, action string) error {
+	if serv.Config.ApprovalConfig.Required(action) {
+		return ErrApprovalRequired
+	}
+
+	return nil
+}
+
+/*
+Register - Makes an action available for approval under the name provided in the parameter. The executor must be the
+ungated implementation of the action, as it is only called once the action has been approved. Registering an action
+with the same name as an existing one replaces it
+*/
+func Register(action string, executor Executor) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	executors[action] = executor
+}
+
+/*
+Lookup - Returns the Executor registered for the action provided in the parameter
+*/
+func Lookup(action string) (Executor, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	ret, ok := executors[action]
+	return ret, ok
+}
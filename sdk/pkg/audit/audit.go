@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/geoip"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/siem"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// maxAppendAttempts - The number of times Append will retry when another writer claims the same sequence number
+const maxAppendAttempts = 5
+
+// ErrAuditConflict - An error that gets returned when an audit record could not be appended due to repeated sequence collisions
+var ErrAuditConflict = credstackError.NewError(500, "ERR_AUDIT_CONFLICT", "audit: Failed to append audit record due to concurrent writes")
+
+// ErrFailedToHashRecord - An error that gets wrapped when an audit record cannot be marshaled for hashing
+var ErrFailedToHashRecord = credstackError.NewError(500, "ERR_AUDIT_HASH", "audit: Failed to compute the hash of an audit record")
+
+/*
+Record - Represents a single entry in the audit log. Records form a hash chain, where each record stores the hash of the
+record that came before it. Modifying, inserting, or removing a record anywhere in the chain will cause verification of
+every record after it to fail
+*/
+type Record struct {
+	// Sequence - The position of the record in the chain. The first record in the chain has a sequence of 1
+	Sequence int64 `json:"sequence" bson:"sequence"`
+
+	// Timestamp - A unix timestamp representing when the record was created
+	Timestamp int64 `json:"timestamp" bson:"timestamp"`
+
+	// EventType - The type of event that was recorded (user.registered, key.rotated)
+	EventType string `json:"event_type" bson:"event_type"`
+
+	// Actor - The user or client that performed the action
+	Actor string `json:"actor" bson:"actor"`
+
+	// Subject - The object that the action was performed on
+	Subject string `json:"subject" bson:"subject"`
+
+	// Description - A human-readable description of the event
+	Description string `json:"description" bson:"description"`
+
+	// Location - The resolved location of the IP address the action originated from. Nil for internal actions
+	Location *geoip.Location `json:"location" bson:"location"`
+
+	// Metadata - Arbitrary key/value data associated with the event
+	Metadata map[string]string `json:"metadata" bson:"metadata"`
+
+	// PreviousHash - The hash of the previous record in the chain. Empty for the first record
+	PreviousHash string `json:"previous_hash" bson:"previous_hash"`
+
+	// Hash - The SHA-256 hash of this record (excluding this field), encoded as a hex string
+	Hash string `json:"hash" bson:"hash"`
+}
+
+/*
+ComputeHash - Computes the SHA-256 hash of the record. Every field except Hash is included, so the hash of a record covers
+the hash of the previous record as well. The record is marshaled to JSON before hashing as encoding/json provides a
+deterministic output (struct fields in declaration order, map keys sorted)
+*/
+func (record *Record) ComputeHash() (string, error) {
+	hashable := *record
+	hashable.Hash = ""
+
+	data, err := json.Marshal(hashable)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", ErrFailedToHashRecord, err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+/*
+latest - Fetches the record at the end of the chain. If the audit log is empty, then nil is returned with no error
+*/
+func latest(serv *server.Server) (*Record, error) {
+	result := serv.Database().Collection("audit").FindOne(
+		serv.Context(),
+		bson.M{},
+		mongoOpts.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}}),
+	)
+
+	var ret Record
+
+	err := result.Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+Append - Appends a record to the end of the audit chain. The Sequence, PreviousHash, and Hash fields of the record are
+always overwritten here, and the Timestamp is set if the caller has not provided one. A unique index on the sequence
+field protects the chain from forking when multiple replicas write at the same time, and if a collision is detected, the
+append is retried against the new end of the chain.
+
+Once the record has been inserted it is published to any configured SIEM exporters. If batch signing is enabled
+(AuditConfig.SigningAudience) and this record completes a batch, then the batch is signed as well. The record is
+written even if the context of the server has been cancelled
+*/
+func Append(serv *server.Server, record *Record) error {
+	/*
+		Records are usually appended once the change they describe has been made, so they are written even if the
+		request that made the change has been cancelled since
+	*/
+	serv = serv.WithContext(context.WithoutCancel(serv.Context()))
+
+	if record.Timestamp == 0 {
+		record.Timestamp = serv.Clock().Now().Unix()
+	}
+
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		previous, err := latest(serv)
+		if err != nil {
+			return err
+		}
+
+		record.Sequence = 1
+		record.PreviousHash = ""
+
+		if previous != nil {
+			record.Sequence = previous.Sequence + 1
+			record.PreviousHash = previous.Hash
+		}
+
+		record.Hash, err = record.ComputeHash()
+		if err != nil {
+			return err
+		}
+
+		_, err = serv.Database().Collection("audit").InsertOne(serv.Context(), record)
+		if err != nil {
+			var writeError mongo.WriteException
+			if errors.As(err, &writeError) && writeError.HasErrorCode(11000) {
+				continue // another writer claimed this sequence number, so we need to re-read the end of the chain
+			}
+
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		serv.SIEM().Publish(siem.Event{
+			Time: record.Timestamp,
+			Type: record.EventType,
+			Data: *record,
+		})
+
+		auditConfig := serv.Config.AuditConfig
+		if auditConfig.SigningAudience != "" && auditConfig.BatchSize > 0 && record.Sequence%auditConfig.BatchSize == 0 {
+			return signBatch(serv, record.Sequence-auditConfig.BatchSize+1, record)
+		}
+
+		return nil
+	}
+
+	return ErrAuditConflict
+}
+
+/*
+Log - A convenience wrapper around Append for recording events that do not have location data attached to them
+*/
+func Log(serv *server.Server, eventType string, actor string, subject string, description string, metadata map[string]string) error {
+	return Append(serv, &Record{
+		EventType:   eventType,
+		Actor:       actor,
+		Subject:     subject,
+		Description: description,
+		Metadata:    metadata,
+	})
+}
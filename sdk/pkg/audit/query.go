@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/query"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+/*
+querySpec - Describes how the audit log is queried. Records are paginated by their sequence, filtered by their subject,
+and their time range is compared with their unix timestamp
+*/
+var querySpec = &query.Spec{
+	Collection: "audit",
+	Fields: []string{
+		"sequence",
+		"timestamp",
+		"event_type",
+		"actor",
+		"subject",
+		"description",
+		"location",
+		"metadata",
+		"previous_hash",
+		"hash",
+	},
+	CursorField: "sequence",
+	ParseCursor: func(cursor string) (any, error) {
+		return strconv.ParseInt(cursor, 10, 64)
+	},
+	FormatCursor: func(value any) (string, error) {
+		switch sequence := value.(type) {
+		case int64:
+			return strconv.FormatInt(sequence, 10), nil
+		case int32:
+			return strconv.FormatInt(int64(sequence), 10), nil
+		default:
+			return "", fmt.Errorf("unexpected sequence type: %T", value)
+		}
+	},
+	SubjectField: "subject",
+	TimeField:    "timestamp",
+	TimeValue: func(t time.Time) any {
+		return t.Unix()
+	},
+}
+
+/*
+List - Returns a single page of audit records matching the options provided in the parameter, in the order they were
+appended. The subject filter matches Record.Subject, and the time range matches Record.Timestamp
+*/
+func List(serv *server.Server, opts *query.Options) (*query.Page, error) {
+	return query.List(serv, querySpec, opts)
+}
+
+/*
+Export - Opens a stream of every audit record matching the options provided in the parameter, in the order they were
+appended. See query.Export
+*/
+func Export(serv *server.Server, opts *query.Options) (*query.Stream, error) {
+	return query.Export(serv, querySpec, opts)
+}
@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+// ErrFailedToSignBatch - An error that gets wrapped when a batch of audit records cannot be signed
+var ErrFailedToSignBatch = credstackError.NewError(500, "ERR_AUDIT_SIGN", "audit: Failed to sign batch of audit records")
+
+/*
+Signature - Represents a signature over a contiguous batch of audit records. Since every record in the chain includes
+the hash of the record before it, signing the hash of the last record in the batch is enough to cover the entire batch
+*/
+type Signature struct {
+	// FromSequence - The sequence of the first record covered by this signature
+	FromSequence int64 `json:"from_sequence" bson:"from_sequence"`
+
+	// ToSequence - The sequence of the last record covered by this signature
+	ToSequence int64 `json:"to_sequence" bson:"to_sequence"`
+
+	// Hash - The hash of the record at ToSequence, at the time that it was signed
+	Hash string `json:"hash" bson:"hash"`
+
+	// Kid - The identifier of the key that was used to produce the signature
+	Kid string `json:"kid" bson:"kid"`
+
+	// Alg - The algorithm used to produce the signature
+	Alg string `json:"alg" bson:"alg"`
+
+	// Signature - The URL-Safe base64 encoded signature over Hash
+	Signature string `json:"signature" bson:"signature"`
+}
+
+/*
+signBatch - Signs the hash of the last record in a batch with the active RS256 key of the configured signing audience and
+stores the resulting Signature in the audit_signature collection
+*/
+func signBatch(serv *server.Server, fromSequence int64, last *Record) error {
+	activeKey, err := jwk.ActiveKey(serv, "RS256", serv.Config.AuditConfig.SigningAudience)
+	if err != nil {
+		return err
+	}
+
+	signer, err := activeKey.Signer(serv)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(last.Hash))
+
+	sig, err := signer.Sign(digest[:])
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrFailedToSignBatch, err)
+	}
+
+	signature := &Signature{
+		FromSequence: fromSequence,
+		ToSequence:   last.Sequence,
+		Hash:         last.Hash,
+		Kid:          activeKey.Header.Identifier,
+		Alg:          activeKey.Alg,
+		Signature:    secret.EncodeBase64(sig),
+	}
+
+	_, err = serv.Database().Collection("audit_signature").InsertOne(serv.Context(), signature)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return nil
+}
+
+/*
+verifySignature - Validates the signature against the public JSON Web Key that it was signed with. A nil return value
+indicates that the signature is valid
+*/
+func verifySignature(serv *server.Server, signature *Signature) error {
+	publicJwk, err := jwk.Get(serv, signature.Kid)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := publicJwk.RSA()
+	if err != nil {
+		return err
+	}
+
+	sigBytes := []byte(signature.Signature)
+	decoded, err := secret.DecodeBase64(sigBytes, uint32(len(sigBytes)))
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(signature.Hash))
+
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], decoded)
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+/*
+VerifyResult - Describes the outcome of verifying the audit chain. If tampering was detected, then BrokenSequence
+holds the sequence of the first record that failed verification and Reason describes why
+*/
+type VerifyResult struct {
+	// Records - The number of records that were verified
+	Records int64 `json:"records"`
+
+	// Signatures - The number of batch signatures that were verified
+	Signatures int64 `json:"signatures"`
+
+	// BrokenSequence - The sequence of the first record that failed verification. 0 if the chain is intact
+	BrokenSequence int64 `json:"broken_sequence"`
+
+	// Reason - A human-readable description of why verification failed. Empty if the chain is intact
+	Reason string `json:"reason"`
+}
+
+/*
+Valid - Returns true if no tampering was detected in the audit chain
+*/
+func (result *VerifyResult) Valid() bool {
+	return result.BrokenSequence == 0
+}
+
+/*
+fail - Marks the result as failed at the provided sequence
+*/
+func (result *VerifyResult) fail(sequence int64, reason string) *VerifyResult {
+	result.BrokenSequence = sequence
+	result.Reason = reason
+
+	return result
+}
+
+/*
+Verify - Walks the entire audit chain in order and detects tampering. Each record must directly follow the previous one
+(no gaps in the sequence), must reference the hash of the previous record, and must hash to the value stored in it. Once
+the chain has been validated, every batch signature is checked against the public key it was signed with and against
+the hash of the record it claims to cover.
+
+Records are streamed from the database with a cursor, so memory usage stays constant regardless of the size of the
+audit log. The returned error is only non-nil if verification could not be completed (database errors); detected
+tampering is reported through VerifyResult
+*/
+func Verify(serv *server.Server) (*VerifyResult, error) {
+	result := new(VerifyResult)
+
+	cursor, err := serv.Database().ReadCollection("audit", server.ReadClassReport).Find(
+		serv.Context(),
+		bson.M{},
+		mongoOpts.Find().SetSort(bson.D{{Key: "sequence", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+	defer cursor.Close(serv.Context())
+
+	previousHash := ""
+	expectedSequence := int64(1)
+
+	for cursor.Next(serv.Context()) {
+		var record Record
+
+		err = cursor.Decode(&record)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		if record.Sequence != expectedSequence {
+			return result.fail(expectedSequence, "record is missing from the chain"), nil
+		}
+
+		if record.PreviousHash != previousHash {
+			return result.fail(record.Sequence, "record does not reference the hash of the previous record"), nil
+		}
+
+		computed, err := record.ComputeHash()
+		if err != nil {
+			return nil, err
+		}
+
+		if computed != record.Hash {
+			return result.fail(record.Sequence, "record contents do not match its hash"), nil
+		}
+
+		previousHash = record.Hash
+		expectedSequence++
+		result.Records++
+	}
+
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return verifySignatures(serv, result)
+}
+
+/*
+verifySignatures - Validates every batch signature stored in the audit_signature collection. This is called after the
+chain itself has been verified, so the hash of the record each signature covers can be trusted
+*/
+func verifySignatures(serv *server.Server, result *VerifyResult) (*VerifyResult, error) {
+	cursor, err := serv.Database().ReadCollection("audit_signature", server.ReadClassReport).Find(
+		serv.Context(),
+		bson.M{},
+		mongoOpts.Find().SetSort(bson.D{{Key: "to_sequence", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+	defer cursor.Close(serv.Context())
+
+	for cursor.Next(serv.Context()) {
+		var signature Signature
+
+		err = cursor.Decode(&signature)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		var record Record
+
+		err = serv.Database().ReadCollection("audit", server.ReadClassReport).FindOne(
+			serv.Context(),
+			bson.M{"sequence": signature.ToSequence},
+		).Decode(&record)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return result.fail(signature.ToSequence, "signed record is missing from the chain"), nil
+			}
+
+			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		if record.Hash != signature.Hash {
+			return result.fail(signature.ToSequence, "record hash does not match the signed batch"), nil
+		}
+
+		err = verifySignature(serv, &signature)
+		if err != nil {
+			return result.fail(signature.ToSequence, "batch signature is invalid: "+err.Error()), nil
+		}
+
+		result.Signatures++
+	}
+
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return result, nil
+}
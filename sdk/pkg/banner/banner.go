@@ -0,0 +1,233 @@
+package banner
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// SeverityInfo - The banner announces something the user does not need to act on (scheduled maintenance)
+	SeverityInfo string = "info"
+
+	// SeverityWarning - The banner announces something that may affect the user (degraded service)
+	SeverityWarning string = "warning"
+
+	// SeverityCritical - The banner announces something the user must act on (a security incident)
+	SeverityCritical string = "critical"
+)
+
+// Severities - Provides a slice of possible values for Banner.Severity
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// maxMessageLength - The longest message a banner can display. Banners are meant to be short notices, not pages
+const maxMessageLength = 500
+
+// ErrBannerDoesNotExist - Provides a named error for when a banner cannot be found
+var ErrBannerDoesNotExist = credstackError.NewError(404, "BANNER_DOES_NOT_EXIST", "banner: Banner does not exist under the specified identifier")
+
+// ErrBannerMissingIdentifier - Provides a named error for when a banner is fetched or deleted without an identifier
+var ErrBannerMissingIdentifier = credstackError.NewError(400, "BANNER_MISSING_ID", "banner: Banner is missing an identifier")
+
+// ErrInvalidMessage - Provides a named error for when a banner is created with an empty or overly long message
+var ErrInvalidMessage = credstackError.NewError(400, "BANNER_INVALID_MESSAGE", "banner: Banner message must not be empty, and must be at most 500 characters")
+
+// ErrInvalidSeverity - Provides a named error for when a banner is created with an unknown severity
+var ErrInvalidSeverity = credstackError.NewError(400, "BANNER_INVALID_SEVERITY", "banner: Banner severity must be one of: info, warning, critical")
+
+// ErrInvalidSchedule - Provides a named error for when a banner is created with an end time that is not after its start time
+var ErrInvalidSchedule = credstackError.NewError(400, "BANNER_INVALID_SCHEDULE", "banner: Banner must end after it starts")
+
+/*
+Banner - Represents an announcement that is displayed on the hosted pages (maintenance windows, security notices). A
+banner is either global, or displayed only for a single client
+*/
+type Banner struct {
+	// Header - The header for the Banner. Created at object birth
+	Header *header.Header `json:"header" bson:"header"`
+
+	// Message - The plain text message that is displayed
+	Message string `json:"message" bson:"message"`
+
+	// Severity - How prominently the banner is displayed. Can be: info, warning, critical. Defaults to info
+	Severity string `json:"severity" bson:"severity"`
+
+	// ClientId - The client whose hosted pages the banner is displayed on. Empty for a global banner, which is displayed
+	// for every client
+	ClientId string `json:"client_id" bson:"client_id"`
+
+	// StartsAt - A unix timestamp representing when the banner is first displayed. Zero to display it immediately
+	StartsAt int64 `json:"starts_at" bson:"starts_at"`
+
+	// EndsAt - A unix timestamp representing when the banner is no longer displayed. Zero to display it until deleted
+	EndsAt int64 `json:"ends_at" bson:"ends_at"`
+}
+
+/*
+New - Creates a banner from the one provided in the parameter and stores it. If a client ID is set, then the client must
+exist. The header of the banner is always overwritten
+*/
+func New(serv *server.Server, banner *Banner) (*Banner, error) {
+	if banner.Message == "" || len(banner.Message) > maxMessageLength {
+		return nil, ErrInvalidMessage
+	}
+
+	if banner.Severity == "" {
+		banner.Severity = SeverityInfo
+	}
+
+	if !slices.Contains(Severities, banner.Severity) {
+		return nil, ErrInvalidSeverity
+	}
+
+	if banner.EndsAt != 0 && banner.EndsAt <= banner.StartsAt {
+		return nil, ErrInvalidSchedule
+	}
+
+	if banner.ClientId != "" {
+		_, err := client.Get(serv, banner.ClientId, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	/*
+		Banners have no immutable natural key (the same message can be scheduled more than once), so a random basis is
+		used for the header instead
+	*/
+	bannerHeader, err := header.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	banner.Header = bannerHeader
+
+	_, err = serv.Database().Collection("banner").InsertOne(serv.Context(), banner)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return banner, nil
+}
+
+/*
+Get - Fetches a banner from the database using its identifier. If the banner does not exist, then ErrBannerDoesNotExist
+is returned
+*/
+func Get(serv *server.Server, identifier string) (*Banner, error) {
+	if identifier == "" {
+		return nil, ErrBannerMissingIdentifier
+	}
+
+	result := serv.Database().Collection("banner").FindOne(serv.Context(), bson.M{"header.identifier": identifier})
+
+	var ret Banner
+
+	err := result.Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrBannerDoesNotExist
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+List - Lists banners, including ones that have not started or have already ended, newest first. The maximum that can be
+returned in a single call is 10, and if a limit exceeds this, it will be reset to 10
+*/
+func List(serv *server.Server, limit int) ([]*Banner, error) {
+	if limit > 10 || limit <= 0 {
+		limit = 10
+	}
+
+	result, err := serv.Database().ReadCollection("banner", server.ReadClassList).Find(
+		serv.Context(),
+		bson.M{},
+		mongoOpts.Find().SetLimit(int64(limit)).SetSort(bson.D{{Key: "header.created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := make([]*Banner, 0, limit)
+
+	err = result.All(serv.Context(), &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return ret, nil
+}
+
+/*
+Active - Returns the banners that should currently be displayed on the hosted pages of the client provided in the
+parameter. This is every global banner and every banner for the client that has started and not yet ended, with the
+most severe first
+*/
+func Active(serv *server.Server, clientId string) ([]*Banner, error) {
+	now := serv.Clock().Now().Unix()
+
+	filter := bson.M{
+		"client_id": bson.M{"$in": []string{"", clientId}},
+		"starts_at": bson.M{"$lte": now},
+		"$or": []bson.M{
+			{"ends_at": 0},
+			{"ends_at": bson.M{"$gt": now}},
+		},
+	}
+
+	result, err := serv.Database().Collection("banner").Find(
+		serv.Context(),
+		filter,
+		mongoOpts.Find().SetSort(bson.D{{Key: "header.created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := []*Banner{}
+
+	err = result.All(serv.Context(), &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	slices.SortStableFunc(ret, func(a *Banner, b *Banner) int {
+		return slices.Index(Severities, b.Severity) - slices.Index(Severities, a.Severity)
+	})
+
+	return ret, nil
+}
+
+/*
+Delete - Removes a banner so that it is no longer displayed. If the banner does not exist, then ErrBannerDoesNotExist is
+returned
+*/
+func Delete(serv *server.Server, identifier string) error {
+	if identifier == "" {
+		return ErrBannerMissingIdentifier
+	}
+
+	result, err := serv.Database().Collection("banner").DeleteOne(serv.Context(), bson.M{"header.identifier": identifier})
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrBannerDoesNotExist
+	}
+
+	return nil
+}
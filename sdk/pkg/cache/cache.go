@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrDocumentCorrupt - An error that gets returned when a cached document on disk does not match its digest
+var ErrDocumentCorrupt = credstackError.NewError(500, "ERR_DOCUMENT_CORRUPT", "cache: The cached document does not match its digest")
+
+/*
+Document - A cached copy of a public document (like the JWKS). The digest is stored alongside the body so that copies
+written to disk can be checked for corruption or tampering before they are served
+*/
+type Document struct {
+	// Body - The JSON encoded document
+	Body json.RawMessage `json:"body"`
+
+	// Digest - The SHA-256 digest of Body, encoded as a hex string
+	Digest string `json:"digest"`
+
+	// UpdatedAt - When the document was last loaded successfully
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+/*
+valid - Determines if the documents digest matches its body
+*/
+func (document *Document) valid() bool {
+	sum := sha256.Sum256(document.Body)
+	return hex.EncodeToString(sum[:]) == document.Digest
+}
+
+/*
+Cache - Keeps the last successfully loaded copy of public documents, so that they can still be served while the
+database is unavailable. Resource servers only need the JWKS to verify tokens, so serving a recent copy keeps
+verification working during short outages even though issuance does not
+*/
+type Cache struct {
+	// config - The options for the cache
+	config config.DocumentCacheConfig
+
+	// mu - Protects documents
+	mu sync.RWMutex
+
+	// documents - The cached documents, keyed by name
+	documents map[string]*Document
+
+	// clock - The clock documents are timestamped with when they are stored, and aged with when they are served
+	clock clock.Clock
+}
+
+/*
+Fetch - Loads the document with the loader provided in the parameter and caches it. If the loader fails, then the
+cached copy (from memory, or from disk if the server has restarted) is returned instead, as long as it is not older
+than DocumentCacheConfig.MaxStale. The second return value is true if a cached copy was served. If there is no usable
+cached copy, then the loaders error is returned
+*/
+func (cache *Cache) Fetch(name string, loader func() (any, error)) ([]byte, bool, error) {
+	value, loadErr := loader()
+	if loadErr == nil {
+		body, err := json.Marshal(value)
+		if err != nil {
+			return nil, false, err
+		}
+
+		cache.store(name, body)
+
+		return body, false, nil
+	}
+
+	document := cache.load(name)
+	if document == nil || cache.clock.Now().Sub(document.UpdatedAt) > cache.config.MaxStale {
+		return nil, false, loadErr
+	}
+
+	return document.Body, true, nil
+}
+
+/*
+store - Saves the document in memory, and to disk if a directory is configured. Failing to write to disk is not fatal,
+as the in-memory copy is still usable
+*/
+func (cache *Cache) store(name string, body []byte) {
+	sum := sha256.Sum256(body)
+
+	document := &Document{
+		Body:      body,
+		Digest:    hex.EncodeToString(sum[:]),
+		UpdatedAt: cache.clock.Now(),
+	}
+
+	cache.mu.Lock()
+	cache.documents[name] = document
+	cache.mu.Unlock()
+
+	if cache.config.Directory != "" {
+		_ = cache.write(name, document)
+	}
+}
+
+/*
+load - Returns the cached document from memory. If it is not in memory, then the copy on disk is read and verified
+against its digest. Nil is returned if no valid copy exists
+*/
+func (cache *Cache) load(name string) *Document {
+	cache.mu.RLock()
+	document, ok := cache.documents[name]
+	cache.mu.RUnlock()
+
+	if ok {
+		return document
+	}
+
+	if cache.config.Directory == "" {
+		return nil
+	}
+
+	document, err := cache.read(name)
+	if err != nil {
+		return nil
+	}
+
+	cache.mu.Lock()
+	cache.documents[name] = document
+	cache.mu.Unlock()
+
+	return document
+}
+
+/*
+path - Returns the path that the document with the name provided in the parameter is written to
+*/
+func (cache *Cache) path(name string) string {
+	return filepath.Join(cache.config.Directory, name+".json")
+}
+
+/*
+write - Writes the document to disk. The document is written to a temporary file first and renamed, so that a crash
+mid-write never leaves a partial document behind
+*/
+func (cache *Cache) write(name string, document *Document) error {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(cache.config.Directory, 0o700)
+	if err != nil {
+		return err
+	}
+
+	tmp := cache.path(name) + ".tmp"
+
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, cache.path(name))
+}
+
+/*
+read - Reads the document from disk and verifies it against its digest. If verification fails, ErrDocumentCorrupt is
+returned
+*/
+func (cache *Cache) read(name string) (*Document, error) {
+	data, err := os.ReadFile(cache.path(name))
+	if err != nil {
+		return nil, err
+	}
+
+	var document Document
+
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrDocumentCorrupt, err)
+	}
+
+	if !document.valid() {
+		return nil, ErrDocumentCorrupt
+	}
+
+	return &document, nil
+}
+
+/*
+New - Constructs an empty Cache. Documents written to disk by a previous run are loaded lazily, the first time they are
+needed
+*/
+func New(config config.DocumentCacheConfig, c clock.Clock) *Cache {
+	return &Cache{
+		config:    config,
+		documents: make(map[string]*Document),
+		clock:     c,
+	}
+}
+
+/*
+SetClock - Replaces the clock documents are timestamped and aged with. This is called by Server.SetClock, and should not
+be called while the cache is in use
+*/
+func (cache *Cache) SetClock(c clock.Clock) {
+	cache.clock = c
+}
@@ -0,0 +1,139 @@
+package canary
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/credstack/credstack/sdk/pkg/audit"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/geoip"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+// EventTriggered - The audit event type recorded whenever a canary client is used
+const EventTriggered = "canary.triggered"
+
+// ErrWebhookFailed - An error that gets wrapped when the canary webhook cannot be delivered
+var ErrWebhookFailed = credstackError.NewError(502, "ERR_CANARY_WEBHOOK_FAILED", "canary: Failed to deliver canary alert to webhook")
+
+/*
+Alert - The payload sent to the canary webhook when a canary client is used
+*/
+type Alert struct {
+	// Event - Always canary.triggered. Included so that a single webhook receiver can handle multiple event types
+	Event string `json:"event"`
+
+	// Timestamp - A unix timestamp representing when the canary was used
+	Timestamp int64 `json:"timestamp"`
+
+	// ClientId - The client ID of the canary that was used
+	ClientId string `json:"client_id"`
+
+	// Name - The name of the canary, which should describe where its credentials were planted
+	Name string `json:"name"`
+
+	// GrantType - The grant type used in the token request
+	GrantType string `json:"grant_type"`
+
+	// Audience - The audience requested in the token request
+	Audience string `json:"audience"`
+
+	// SecretMatched - If set to true, the canaries client secret was used as well, meaning that the full credential leaked
+	SecretMatched bool `json:"secret_matched"`
+
+	// Location - The resolved location of the IP address the request originated from. Nil if it could not be resolved
+	Location *geoip.Location `json:"location"`
+}
+
+/*
+Trigger - Raises an alert for a token request that used a canary client. The alert is always recorded in the audit log
+(which also ships it to any configured SIEM exporters), and is posted to CanaryConfig.WebhookURL if one is configured.
+Webhook delivery happens in the background so that the caller sees the same latency as any other failed token request.
+Callers should reject the request with the same error used for invalid credentials so that the canary is not revealed
+*/
+func Trigger(serv *server.Server, app *client.Client, tokenRequest *request.TokenRequest) error {
+	alert := Alert{
+		Event:         EventTriggered,
+		Timestamp:     serv.Clock().Now().Unix(),
+		ClientId:      app.ClientId,
+		Name:          app.Name,
+		GrantType:     tokenRequest.GrantType,
+		Audience:      tokenRequest.Audience,
+		SecretMatched: subtle.ConstantTimeCompare([]byte(tokenRequest.ClientSecret), []byte(app.ClientSecret)) == 1,
+	}
+
+	if tokenRequest.RemoteAddr != "" && serv.GeoIP() != nil {
+		location, err := geoip.LookupString(serv.GeoIP(), tokenRequest.RemoteAddr)
+		if err == nil {
+			alert.Location = location
+		}
+	}
+
+	err := audit.Append(serv, &audit.Record{
+		Timestamp:   alert.Timestamp,
+		EventType:   EventTriggered,
+		Actor:       app.ClientId,
+		Subject:     app.ClientId,
+		Description: fmt.Sprintf("Canary client '%s' was used in a token request", app.Name),
+		Location:    alert.Location,
+		Metadata: map[string]string{
+			"grant_type":     alert.GrantType,
+			"audience":       alert.Audience,
+			"secret_matched": fmt.Sprintf("%t", alert.SecretMatched),
+		},
+	})
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to record canary alert in the audit log", err)
+	}
+
+	if serv.Config.CanaryConfig.WebhookURL != "" {
+		go func() {
+			err := sendWebhook(serv, alert)
+			if err != nil {
+				serv.Log().LogErrorEvent("Failed to deliver canary alert", err)
+			}
+		}()
+	}
+
+	return err
+}
+
+/*
+sendWebhook - Posts the alert to the configured webhook. Any non-2xx response is returned as a wrapped ErrWebhookFailed
+*/
+func sendWebhook(serv *server.Server, alert Alert) error {
+	canaryConfig := serv.Config.CanaryConfig
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrWebhookFailed, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), canaryConfig.WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, canaryConfig.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrWebhookFailed, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrWebhookFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w (webhook returned status %d)", ErrWebhookFailed, resp.StatusCode)
+	}
+
+	return nil
+}
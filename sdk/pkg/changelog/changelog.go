@@ -0,0 +1,265 @@
+package changelog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/audit"
+	"github.com/credstack/credstack/sdk/pkg/lock"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// EventConfigChanged - The audit event recorded when the server configuration differs from the one it was last started with
+const EventConfigChanged = "config.changed"
+
+// EventSettingsChanged - The audit event recorded when the stored settings of a client or resource server are changed
+const EventSettingsChanged = "settings.changed"
+
+// snapshotId - The identifier of the document holding the configuration the server was last started with
+const snapshotId = "server"
+
+// volatileSettings - Settings that change as a side effect of every update, and are not recorded as changes
+var volatileSettings = []string{"header.created_at", "header.updated_at", "header.accessed_at"}
+
+/*
+Change - A single setting that was changed. Secrets are shown as [redacted], so that a record shows that a secret was
+changed without revealing either value
+*/
+type Change struct {
+	// Path - The dotted path of the setting that changed (api.port, grant_types)
+	Path string `json:"path" bson:"path"`
+
+	// Old - The value of the setting before the change. Empty if the setting was added
+	Old string `json:"old" bson:"old"`
+
+	// New - The value of the setting after the change. Empty if the setting was removed
+	New string `json:"new" bson:"new"`
+}
+
+/*
+Entry - A recorded change to the server configuration, or to the settings of a client or resource server
+*/
+type Entry struct {
+	// Sequence - The sequence of the audit record the change was recorded in
+	Sequence int64 `json:"sequence"`
+
+	// Timestamp - A unix timestamp representing when the change was recorded
+	Timestamp int64 `json:"timestamp"`
+
+	// EventType - Either EventConfigChanged or EventSettingsChanged
+	EventType string `json:"event_type"`
+
+	// Actor - Who made the change. For configuration changes, this is the host the changed configuration was loaded on
+	Actor string `json:"actor"`
+
+	// Subject - What was changed (config, client:<client_id>, resource_server:<audience>)
+	Subject string `json:"subject"`
+
+	// Changes - The settings that changed
+	Changes []Change `json:"changes"`
+}
+
+/*
+snapshot - The flattened configuration that the server was last started with. Secrets are stored as fingerprints
+*/
+type snapshot struct {
+	// Id - Always snapshotId, as only the latest configuration is kept
+	Id string `bson:"_id"`
+
+	// RecordedAt - A unix timestamp representing when the snapshot was taken
+	RecordedAt int64 `bson:"recorded_at"`
+
+	// Settings - Every setting in the configuration. Stored as a list, as setting paths contain dots
+	Settings []Change `bson:"settings"`
+}
+
+/*
+Diff - Compares two flattened sets of settings, and returns every setting that was added, removed, or changed, sorted by
+path
+*/
+func Diff(before map[string]string, after map[string]string) []Change {
+	ret := []Change{}
+
+	for path, value := range after {
+		if previous, ok := before[path]; !ok || previous != value {
+			ret = append(ret, Change{Path: path, Old: display(before[path]), New: display(value)})
+		}
+	}
+
+	for path, value := range before {
+		if _, ok := after[path]; !ok {
+			ret = append(ret, Change{Path: path, Old: display(value)})
+		}
+	}
+
+	slices.SortFunc(ret, func(a Change, b Change) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return ret
+}
+
+/*
+RecordConfig - Compares the configuration the server was started with against the one it was last started with, and
+records every difference in the audit log under the name of this host. The configuration is then stored as the new
+snapshot. The first time this is called there is nothing to compare against, so the snapshot is only stored.
+
+This is held under a lock, so that replicas started at the same time with the same configuration do not each record the
+same change. A replica that fails to acquire the lock skips recording entirely
+*/
+func RecordConfig(serv *server.Server) error {
+	current := flatten(*serv.Config, "mapstructure")
+
+	err := lock.WithLock(serv, "config.changelog", func(ctx context.Context) error {
+		serv := serv.WithContext(ctx)
+
+		var previous snapshot
+
+		err := serv.Database().Collection("config_snapshot").FindOne(serv.Context(), bson.M{"_id": snapshotId}).Decode(&previous)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		if err == nil {
+			old := make(map[string]string, len(previous.Settings))
+			for _, setting := range previous.Settings {
+				old[setting.Path] = setting.New
+			}
+
+			changes := Diff(old, current)
+			if len(changes) == 0 {
+				return nil
+			}
+
+			err = logChanges(serv, EventConfigChanged, hostActor(), "config", "Server configuration changed since it was last started", changes)
+			if err != nil {
+				return err
+			}
+		}
+
+		next := snapshot{Id: snapshotId, RecordedAt: serv.Clock().Now().Unix(), Settings: make([]Change, 0, len(current))}
+		for path, value := range current {
+			next.Settings = append(next.Settings, Change{Path: path, New: value})
+		}
+
+		_, err = serv.Database().Collection("config_snapshot").ReplaceOne(
+			serv.Context(),
+			bson.M{"_id": snapshotId},
+			next,
+			mongoOpts.Replace().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		return nil
+	})
+	if errors.Is(err, lock.ErrLockHeld) {
+		return nil
+	}
+
+	return err
+}
+
+/*
+RecordSettings - Records the difference between the stored settings of an object before and after it was updated. The
+settings are compared by their JSON names, and nothing is recorded if no setting changed. The subject should identify the
+object (client:<client_id>, resource_server:<audience>)
+*/
+func RecordSettings(serv *server.Server, actor string, subject string, previous any, updated any) error {
+	before, after := flatten(previous, "json"), flatten(updated, "json")
+
+	for _, path := range volatileSettings {
+		delete(before, path)
+		delete(after, path)
+	}
+
+	changes := Diff(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return logChanges(serv, EventSettingsChanged, actor, subject, "Stored settings changed", changes)
+}
+
+/*
+History - Returns the most recent configuration and settings changes, newest first. If subject is not empty, then only
+changes to that subject are returned
+*/
+func History(serv *server.Server, subject string, limit int) ([]*Entry, error) {
+	filter := bson.M{"event_type": bson.M{"$in": []string{EventConfigChanged, EventSettingsChanged}}}
+	if subject != "" {
+		filter["subject"] = subject
+	}
+
+	cursor, err := serv.Database().Collection("audit").Find(
+		serv.Context(),
+		filter,
+		mongoOpts.Find().SetSort(bson.D{{Key: "sequence", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var records []audit.Record
+
+	err = cursor.All(serv.Context(), &records)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := make([]*Entry, 0, len(records))
+	for _, record := range records {
+		entry := &Entry{
+			Sequence:  record.Sequence,
+			Timestamp: record.Timestamp,
+			EventType: record.EventType,
+			Actor:     record.Actor,
+			Subject:   record.Subject,
+			Changes:   []Change{},
+		}
+
+		_ = json.Unmarshal([]byte(record.Metadata["changes"]), &entry.Changes)
+
+		ret = append(ret, entry)
+	}
+
+	return ret, nil
+}
+
+/*
+logChanges - Appends a set of changes to the audit log. The changes are stored as JSON under the changes metadata key, as
+audit metadata only holds strings
+*/
+func logChanges(serv *server.Server, eventType string, actor string, subject string, description string, changes []Change) error {
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	return audit.Log(serv, eventType, actor, subject, description, map[string]string{
+		"changes": string(encoded),
+		"count":   fmt.Sprint(len(changes)),
+	})
+}
+
+/*
+hostActor - Returns the name configuration changes are recorded under. Configuration is edited outside credstack, so the
+host that loaded it is the closest thing to an actor that is known
+*/
+func hostActor() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+
+	return "host:" + hostname
+}
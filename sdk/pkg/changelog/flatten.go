@@ -0,0 +1,152 @@
+package changelog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// redactedValue - The value that secrets are replaced with in change records
+const redactedValue = "[redacted]"
+
+// hashPrefix - The prefix of the fingerprint that secrets are stored as in the configuration snapshot
+const hashPrefix = "sha256:"
+
+// sensitiveNames - The names of settings (or the suffixes of their names) whose values are never recorded
+var sensitiveNames = []string{"password", "secret", "token", "passphrase", "private_key"}
+
+/*
+flatten - Converts a struct into a flat map of dotted setting paths to their values. Paths are built from the struct tag
+provided in the parameter (mapstructure for the server configuration, json for stored settings), maps are flattened by
+key, and lists are rendered as JSON. Secrets are replaced with a fingerprint, see isSensitive
+*/
+func flatten(value any, tag string) map[string]string {
+	ret := make(map[string]string)
+	flattenValue(reflect.ValueOf(value), tag, "", ret)
+
+	return ret
+}
+
+/*
+flattenValue - Recursively flattens a single value into the map provided in the parameter under the path prefix
+*/
+func flattenValue(value reflect.Value, tag string, prefix string, out map[string]string) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			out[prefix] = ""
+			return
+		}
+
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		valueType := value.Type()
+
+		for i := 0; i < valueType.NumField(); i++ {
+			field := valueType.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+			if name == "-" {
+				continue
+			}
+
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+
+			flattenValue(value.Field(i), tag, join(prefix, name), out)
+		}
+	case reflect.Map:
+		keys := value.MapKeys()
+		if len(keys) == 0 {
+			out[prefix] = ""
+			return
+		}
+
+		for _, key := range keys {
+			flattenValue(value.MapIndex(key), tag, join(prefix, fmt.Sprint(key.Interface())), out)
+		}
+	case reflect.Slice, reflect.Array:
+		if value.Len() == 0 {
+			out[prefix] = "" // nil and empty lists are the same setting
+			return
+		}
+
+		encoded, err := json.Marshal(value.Interface())
+		if err != nil {
+			encoded = []byte(fmt.Sprint(value.Interface()))
+		}
+
+		out[prefix] = protect(prefix, string(encoded))
+	default:
+		out[prefix] = protect(prefix, fmt.Sprint(value.Interface()))
+	}
+}
+
+/*
+protect - Replaces the value of a sensitive setting with a fingerprint of it, and strips the password from any URL. The
+fingerprint allows a changed secret to be detected without the secret itself ever being stored
+*/
+func protect(path string, value string) string {
+	if isSensitive(path) {
+		if value == "" {
+			return ""
+		}
+
+		sum := sha256.Sum256([]byte(value))
+		return hashPrefix + hex.EncodeToString(sum[:])
+	}
+
+	if parsed, err := url.Parse(value); err == nil && parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), redactedValue)
+			return parsed.String()
+		}
+	}
+
+	return value
+}
+
+/*
+isSensitive - Returns true if the last segment of the path provided in the parameter names a secret, or ends with the
+name of one (user_notification_token, client_secret)
+*/
+func isSensitive(path string) bool {
+	segment := path[strings.LastIndex(path, ".")+1:]
+
+	return slices.ContainsFunc(sensitiveNames, func(name string) bool {
+		return segment == name || strings.HasSuffix(segment, "_"+name)
+	})
+}
+
+/*
+display - Returns the value of a setting as it is shown in a change record. Fingerprints of secrets are never shown
+*/
+func display(value string) string {
+	if strings.HasPrefix(value, hashPrefix) {
+		return redactedValue
+	}
+
+	return value
+}
+
+/*
+join - Joins a setting path and the name of a setting under it
+*/
+func join(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "." + name
+}
@@ -0,0 +1,105 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+Clock - Interface that provides the current time to any code that evaluates expirations. The server holds a single
+Clock (server.Server.Clock) that should be used over time.Now, so that tests can fast-forward time deterministically
+with a Fake instead of sleeping
+*/
+type Clock interface {
+	// Now - Returns the current time
+	Now() time.Time
+}
+
+/*
+systemClock - The default Clock, which reads the time from the operating system
+*/
+type systemClock struct{}
+
+/*
+Now - Returns the current time as reported by time.Now
+*/
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// System - A Clock that reads the time from the operating system. This is the Clock used by the server unless it is replaced
+var System Clock = systemClock{}
+
+/*
+Fake - A Clock that only moves when it is told to. This should only ever be used in tests
+*/
+type Fake struct {
+	// mu - Protects now, as the Fake may be advanced while other goroutines are reading from it
+	mu sync.RWMutex
+
+	// now - The time that will be returned from Now
+	now time.Time
+}
+
+/*
+Now - Returns the time the Fake is currently set to
+*/
+func (fake *Fake) Now() time.Time {
+	fake.mu.RLock()
+	defer fake.mu.RUnlock()
+
+	return fake.now
+}
+
+/*
+Advance - Moves the Fake forward by the duration provided in the parameter. A negative duration moves it backward,
+which is useful for simulating clock skew between replicas
+*/
+func (fake *Fake) Advance(d time.Duration) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.now = fake.now.Add(d)
+}
+
+/*
+Set - Sets the Fake to the time provided in the parameter
+*/
+func (fake *Fake) Set(t time.Time) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.now = t
+}
+
+/*
+NewFake - Returns a Fake that is set to the time provided in the parameter
+*/
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t}
+}
+
+/*
+Expired - Determines if the expiration time provided in the parameter has passed according to the Clock. The leeway
+is added to the expiration time to tolerate clock skew between the issuer and the validator. A zero expiration time is
+treated as never expiring
+*/
+func Expired(c Clock, expiresAt time.Time, leeway time.Duration) bool {
+	if expiresAt.IsZero() {
+		return false
+	}
+
+	return c.Now().After(expiresAt.Add(leeway))
+}
+
+/*
+NotYetValid - Determines if the not-before time provided in the parameter is still in the future according to the
+Clock. The leeway is subtracted from the not-before time to tolerate clock skew. A zero time is always valid
+*/
+func NotYetValid(c Clock, notBefore time.Time, leeway time.Duration) bool {
+	if notBefore.IsZero() {
+		return false
+	}
+
+	return c.Now().Before(notBefore.Add(-leeway))
+}
@@ -1,11 +1,21 @@
 package config
 
 import (
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
 )
 
+const (
+	// ErrorDetailDetailed - Error responses include the full error, including the reason it was wrapped with. Useful for development
+	ErrorDetailDetailed string = "detailed"
+
+	// ErrorDetailGeneric - Error responses only include the message of the named error, and errors that are not named are replaced with a generic message
+	ErrorDetailGeneric string = "generic"
+)
+
 type ApiConfig struct {
 	// Port - The port number that the API should listen for requests on
 	Port int `mapstructure:"port"`
@@ -18,23 +28,108 @@ type ApiConfig struct {
 
 	// SkipPreflight - If set to true, then preflight checks are not conducted on API start
 	SkipPreflight bool `mapstructure:"skip_preflight"`
+
+	// RequestTimeout - The deadline applied to every request. Requests that exceed it receive a 503. Set to 0 to disable
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+
+	// RouteTimeouts - Overrides RequestTimeout for route groups, keyed by path prefix (/oauth). The longest matching prefix is used
+	RouteTimeouts map[string]time.Duration `mapstructure:"route_timeouts"`
+
+	// ErrorDetail - How much detail error responses include. One of: generic, detailed. Any other value is treated as generic
+	ErrorDetail string `mapstructure:"error_detail"`
+
+	// RouteErrorDetail - Overrides ErrorDetail for route groups, keyed by path prefix (/oauth2). The longest matching prefix is used
+	RouteErrorDetail map[string]string `mapstructure:"route_error_detail"`
+
+	// AllowedOrigins - The origins that browsers can call any endpoint from cross-origin (https://app.example.com). Set to * to allow every origin. Origins registered on a client are additionally allowed on the browser facing endpoints
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+
+	// CORSMaxAge - How long browsers can cache the result of a CORS preflight request
+	CORSMaxAge time.Duration `mapstructure:"cors_max_age"`
+
+	// TrustedProxies - The IP addresses or CIDR ranges of the reverse proxies in front of the API. The X-Forwarded-* headers (the scheme cookies are marked Secure by) are only honored from these
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+
+	// TLS - Options for serving the API over TLS, including mutual TLS
+	TLS TLSConfig `mapstructure:"tls"`
+}
+
+/*
+AllowsOrigin - Determines if the origin provided in the parameter is allowed to call any endpoint cross-origin, either
+because it is listed in AllowedOrigins or because AllowedOrigins contains *. Origins are matched exactly
+*/
+func (config *ApiConfig) AllowsOrigin(origin string) bool {
+	return slices.Contains(config.AllowedOrigins, origin) || slices.Contains(config.AllowedOrigins, "*")
+}
+
+/*
+Timeout - Returns the deadline for the request path provided in the parameter. The longest prefix in RouteTimeouts that
+matches the path is used, and RequestTimeout is returned if none of them match
+*/
+func (config *ApiConfig) Timeout(path string) time.Duration {
+	timeout := config.RequestTimeout
+	matched := -1
+
+	for prefix, routeTimeout := range config.RouteTimeouts {
+		if strings.HasPrefix(path, prefix) && len(prefix) > matched {
+			timeout = routeTimeout
+			matched = len(prefix)
+		}
+	}
+
+	return timeout
+}
+
+/*
+ErrorDetailFor - Returns how much detail error responses include for the request path provided in the parameter. The
+longest prefix in RouteErrorDetail that matches the path is used, and ErrorDetail is returned if none of them match.
+Anything other than ErrorDetailDetailed is returned as ErrorDetailGeneric, so that a misspelled value never exposes more
+than intended
+*/
+func (config *ApiConfig) ErrorDetailFor(path string) string {
+	detail := config.ErrorDetail
+	matched := -1
+
+	for prefix, routeDetail := range config.RouteErrorDetail {
+		if strings.HasPrefix(path, prefix) && len(prefix) > matched {
+			detail = routeDetail
+			matched = len(prefix)
+		}
+	}
+
+	if detail != ErrorDetailDetailed {
+		return ErrorDetailGeneric
+	}
+
+	return detail
 }
 
 /*
 FiberConfig - Returns a fiber.Config  structure for the Api structure to consume
 */
 func (config *ApiConfig) FiberConfig() fiber.Config {
+	/*
+		Request bodies are streamed so that bulk imports can be read as they arrive. Every other path is still limited
+		to SecurityConfig.BodyLimit by middleware.LimitBody in the API
+	*/
 	fiberConfig := fiber.Config{
-		CaseSensitive:    true,
-		StrictRouting:    true,
-		DisableKeepalive: true,
+		CaseSensitive:     true,
+		StrictRouting:     true,
+		DisableKeepalive:  true,
+		StreamRequestBody: true,
 	}
 
+	/*
+		Fiber honors the X-Forwarded-* headers from anyone unless TrustProxy is set, so it is always set, and only the
+		configured proxies are trusted. Without any, the headers are ignored entirely
+	*/
+	fiberConfig.TrustProxy = true
+	fiberConfig.TrustProxyConfig = fiber.TrustProxyConfig{Proxies: config.TrustedProxies}
+
 	if config.Debug {
 		fiberConfig.CaseSensitive = false
 		fiberConfig.StrictRouting = false
 		fiberConfig.IdleTimeout = 10 * time.Minute
-		fiberConfig.TrustProxy = true
 	}
 
 	return fiberConfig
@@ -61,9 +156,17 @@ func (config *ApiConfig) ListenerConfig() fiber.ListenConfig {
 // DefaultApiConfig Initializes the ApiConfig structure with sane defaults
 func DefaultApiConfig() ApiConfig {
 	return ApiConfig{
-		Port:          8080,
-		Debug:         false,
-		Prefork:       false,
-		SkipPreflight: false,
+		Port:             8080,
+		Debug:            false,
+		Prefork:          false,
+		SkipPreflight:    false,
+		RequestTimeout:   30 * time.Second,
+		RouteTimeouts:    map[string]time.Duration{},
+		ErrorDetail:      ErrorDetailGeneric,
+		RouteErrorDetail: map[string]string{},
+		AllowedOrigins:   []string{},
+		CORSMaxAge:       10 * time.Minute,
+		TrustedProxies:   []string{},
+		TLS:              DefaultTLSConfig(),
 	}
 }
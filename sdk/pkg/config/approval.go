@@ -0,0 +1,29 @@
+package config
+
+import (
+	"slices"
+	"time"
+)
+
+type ApprovalConfig struct {
+	// RequiredActions - The destructive actions that require a second admin's approval before they are executed (client.delete, key.rotate)
+	RequiredActions []string `mapstructure:"required_actions"`
+
+	// TTL - How long a pending approval can wait before it expires and can no longer be approved
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+/*
+Required - Determines if the action provided in the parameter requires approval before it can be executed
+*/
+func (config *ApprovalConfig) Required(action string) bool {
+	return slices.Contains(config.RequiredActions, action)
+}
+
+// DefaultApprovalConfig Initializes the ApprovalConfig structure with sane defaults
+func DefaultApprovalConfig() ApprovalConfig {
+	return ApprovalConfig{
+		RequiredActions: []string{},
+		TTL:             24 * time.Hour,
+	}
+}
@@ -0,0 +1,17 @@
+package config
+
+type AuditConfig struct {
+	// SigningAudience - The audience whose active RS256 key is used to sign batches of audit records. If empty, batches are not signed
+	SigningAudience string `mapstructure:"signing_audience"`
+
+	// BatchSize - The number of audit records that are included in each signed batch
+	BatchSize int64 `mapstructure:"batch_size"`
+}
+
+// DefaultAuditConfig Initializes the AuditConfig structure with sane defaults
+func DefaultAuditConfig() AuditConfig {
+	return AuditConfig{
+		SigningAudience: "",
+		BatchSize:       100,
+	}
+}
@@ -0,0 +1,27 @@
+package config
+
+import "time"
+
+type AuthorizationConfig struct {
+	// CodeLifetime - How long an authorization code can be redeemed at the token endpoint after it is issued
+	CodeLifetime time.Duration `mapstructure:"code_lifetime"`
+
+	// LoginTemplate - The path to an html/template file that replaces the hosted login page. If empty, the built-in page is used
+	LoginTemplate string `mapstructure:"login_template"`
+
+	// ChangePasswordURL - The URL of the page where users change their password. /.well-known/change-password redirects here, so that password managers can deep-link to it. If empty, /.well-known/change-password returns a 404
+	ChangePasswordURL string `mapstructure:"change_password_url"`
+
+	// AccountURL - The URL of the page where users manage their account. Advertised in the discovery document. If empty, it is omitted
+	AccountURL string `mapstructure:"account_url"`
+}
+
+// DefaultAuthorizationConfig Initializes the AuthorizationConfig structure with sane defaults
+func DefaultAuthorizationConfig() AuthorizationConfig {
+	return AuthorizationConfig{
+		CodeLifetime:      time.Minute,
+		LoginTemplate:     "",
+		ChangePasswordURL: "",
+		AccountURL:        "",
+	}
+}
@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+type CanaryConfig struct {
+	// WebhookURL - A URL that receives a JSON POST whenever a canary client is used. If empty, canaries are only recorded in the audit log
+	WebhookURL string `mapstructure:"webhook_url"`
+
+	// WebhookTimeout - The maximum amount of time to wait for the webhook to respond
+	WebhookTimeout time.Duration `mapstructure:"webhook_timeout"`
+}
+
+// DefaultCanaryConfig Initializes the CanaryConfig structure with sane defaults
+func DefaultCanaryConfig() CanaryConfig {
+	return CanaryConfig{
+		WebhookURL:     "",
+		WebhookTimeout: 10 * time.Second,
+	}
+}
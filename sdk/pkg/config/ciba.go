@@ -0,0 +1,31 @@
+package config
+
+import "time"
+
+type CIBAConfig struct {
+	// RequestLifetime - How long a backchannel authentication request is valid for before the client must start over. Clients can request a shorter lifetime with requested_expiry
+	RequestLifetime time.Duration `mapstructure:"request_lifetime"`
+
+	// PollingInterval - The minimum amount of time a client must wait between polling the token endpoint
+	PollingInterval time.Duration `mapstructure:"polling_interval"`
+
+	// UserNotificationEndpoint - The URL credstack POSTs new backchannel authentication requests to, so that the user can be prompted to approve them on their authentication device. If empty, users are not notified
+	UserNotificationEndpoint string `mapstructure:"user_notification_endpoint"`
+
+	// UserNotificationToken - The bearer token sent to the user notification endpoint, so that it can authenticate credstack
+	UserNotificationToken string `mapstructure:"user_notification_token"`
+
+	// NotificationTimeout - The timeout applied to each request made to the user notification endpoint and to client notification endpoints
+	NotificationTimeout time.Duration `mapstructure:"notification_timeout"`
+}
+
+// DefaultCIBAConfig Initializes the CIBAConfig structure with sane defaults
+func DefaultCIBAConfig() CIBAConfig {
+	return CIBAConfig{
+		RequestLifetime:          5 * time.Minute,
+		PollingInterval:          5 * time.Second,
+		UserNotificationEndpoint: "",
+		UserNotificationToken:    "",
+		NotificationTimeout:      10 * time.Second,
+	}
+}
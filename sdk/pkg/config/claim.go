@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidClaimNamespace - Provides a named error for when the claim namespace is not an absolute URI
+var ErrInvalidClaimNamespace = credstackError.NewError(500, "ERR_INVALID_CLAIM_NAMESPACE", "config: The claim namespace must be an absolute URI (https://example.com/claims/)")
+
+type ClaimConfig struct {
+	// Namespace - A URI that every custom claim must be prefixed with (https://example.com/claims/), so that they cannot collide with claims defined by other specifications. If empty, custom claims are not required to be namespaced, but still cannot shadow registered claims
+	Namespace string `mapstructure:"namespace"`
+}
+
+/*
+Validate - Ensures that the namespace is an absolute URI, so that a misconfigured namespace is surfaced when the server
+starts instead of being prefixed to every custom claim
+*/
+func (config *ClaimConfig) Validate() error {
+	if config.Namespace == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(config.Namespace)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrInvalidClaimNamespace, err)
+	}
+
+	if !parsed.IsAbs() || (parsed.Opaque == "" && parsed.Host == "") {
+		return fmt.Errorf("%w (%s)", ErrInvalidClaimNamespace, config.Namespace)
+	}
+
+	return nil
+}
+
+// DefaultClaimConfig Initializes the ClaimConfig structure with sane defaults
+func DefaultClaimConfig() ClaimConfig {
+	return ClaimConfig{
+		Namespace: "",
+	}
+}
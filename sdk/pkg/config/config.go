@@ -1,11 +1,13 @@
 package config
 
 import (
+	"bytes"
 	"os"
 	"path"
 	"strings"
 
-	"github.com/spf13/cobra"
+	"github.com/credstack/credstack/sdk/pkg/age"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -13,6 +15,9 @@ type ServerConfig struct {
 	// viper The viper instance that will store configuration values
 	viper *viper.Viper
 
+	// encrypted Set if the config was loaded from an encrypted file, so that it is never written back in plaintext
+	encrypted bool
+
 	// ApiConfig All API Configuration options
 	ApiConfig ApiConfig `mapstructure:"api"`
 
@@ -24,6 +29,108 @@ type ServerConfig struct {
 
 	// LogConfig All options for controlling how logs are generated/written
 	LogConfig LogConfig `mapstructure:"log"`
+
+	// EmailConfig All options for controlling how user email addresses are normalized
+	EmailConfig EmailConfig `mapstructure:"email"`
+
+	// PhoneConfig All options for controlling how user phone numbers are normalized
+	PhoneConfig PhoneConfig `mapstructure:"phone"`
+
+	// PolicyConfig All options for controlling time based token issuance policies
+	PolicyConfig PolicyConfig `mapstructure:"policy"`
+
+	// GeoIPConfig All options for controlling how IP addresses are resolved to locations
+	GeoIPConfig GeoIPConfig `mapstructure:"geoip"`
+
+	// AuditConfig All options for controlling how audit records are chained and signed
+	AuditConfig AuditConfig `mapstructure:"audit"`
+
+	// SIEMConfig All options for controlling how events are exported to external SIEMs
+	SIEMConfig SIEMConfig `mapstructure:"siem"`
+
+	// CryptoConfig All options for controlling which cryptographic algorithms can be used
+	CryptoConfig CryptoConfig `mapstructure:"crypto"`
+
+	// SecretConfig All options for controlling how client IDs and secrets are generated
+	SecretConfig SecretConfig `mapstructure:"secret"`
+
+	// CanaryConfig All options for controlling how canary clients raise alerts
+	CanaryConfig CanaryConfig `mapstructure:"canary"`
+
+	// ApprovalConfig All options for controlling which destructive actions require a second admin's approval
+	ApprovalConfig ApprovalConfig `mapstructure:"approval"`
+
+	// DocumentCacheConfig All options for controlling how public documents (JWKS) are cached for database outages
+	DocumentCacheConfig DocumentCacheConfig `mapstructure:"document_cache"`
+
+	// LockConfig All options for controlling the locks used to coordinate singleton tasks across replicas
+	LockConfig LockConfig `mapstructure:"lock"`
+
+	// KeyConfig All options for controlling how signing keys are staged before they are used, and retired after
+	KeyConfig KeyConfig `mapstructure:"key"`
+
+	// DeviceConfig All options for controlling the device authorization grant
+	DeviceConfig DeviceConfig `mapstructure:"device"`
+
+	// CIBAConfig All options for controlling the client initiated backchannel authentication grant
+	CIBAConfig CIBAConfig `mapstructure:"ciba"`
+
+	// IntrospectionConfig All options for controlling token introspection
+	IntrospectionConfig IntrospectionConfig `mapstructure:"introspection"`
+
+	// DeprecationConfig All options for marking endpoints and grant types as deprecated
+	DeprecationConfig DeprecationConfig `mapstructure:"deprecation"`
+
+	// AuthorizationConfig All options for controlling the authorization endpoint
+	AuthorizationConfig AuthorizationConfig `mapstructure:"authorization"`
+
+	// TokenStoreConfig All options for controlling how issued tokens are persisted
+	TokenStoreConfig TokenStoreConfig `mapstructure:"token_store"`
+
+	// SessionConfig All options for controlling how long browser login sessions last
+	SessionConfig SessionConfig `mapstructure:"session"`
+
+	// ClaimConfig All options for controlling how custom claims are named
+	ClaimConfig ClaimConfig `mapstructure:"claim"`
+
+	// RegionConfig All options for running credstack in more than one region at once
+	RegionConfig RegionConfig `mapstructure:"region"`
+
+	// HookConfig All options for the webhooks called before a token is signed
+	HookConfig HookConfig `mapstructure:"hook"`
+
+	// EventsConfig All options for delivering lifecycle events to webhooks
+	EventsConfig EventsConfig `mapstructure:"events"`
+
+	// TelemetryConfig All options for reporting anonymous usage to the credstack maintainers
+	TelemetryConfig TelemetryConfig `mapstructure:"telemetry"`
+
+	// IdentifierConfig All options for how the identifiers of new objects are generated
+	IdentifierConfig IdentifierConfig `mapstructure:"identifier"`
+
+	// MetadataConfig All options for the metadata stored on users
+	MetadataConfig MetadataConfig `mapstructure:"metadata"`
+
+	// FederationConfig All options for signing in through upstream identity providers
+	FederationConfig FederationConfig `mapstructure:"federation"`
+
+	// ScimConfig All options for provisioning users and groups from a directory with SCIM 2.0
+	ScimConfig ScimConfig `mapstructure:"scim"`
+
+	// SignerConfig All options for controlling the backend that signing keys are generated in and tokens are signed by
+	SignerConfig SignerConfig `mapstructure:"signer"`
+
+	// ManagementConfig All options for authenticating requests to the management API
+	ManagementConfig ManagementConfig `mapstructure:"management"`
+
+	// SecurityConfig All options for the security headers applied to responses, and the limits applied to requests
+	SecurityConfig SecurityConfig `mapstructure:"security"`
+
+	// TracingConfig All options for exporting OpenTelemetry traces
+	TracingConfig TracingConfig `mapstructure:"tracing"`
+
+	// SecretsConfig All options for resolving secret references (vault://, awssm://, file://) in other options
+	SecretsConfig SecretsConfig `mapstructure:"secrets"`
 }
 
 // sanitizePath Performs basic sanitation on user provided paths
@@ -36,10 +143,17 @@ func (config *ServerConfig) sanitizePath(configPath string) (string, error) {
 	return strings.Replace(configPath, "~", home, 1), nil
 }
 
+// SetDataDir Makes dataDir the default location of files credstack writes (currently logs), replacing the platform
+// defaults. Explicitly configured paths still take precedence. This must be called before Load
+func (config *ServerConfig) SetDataDir(dataDir string) {
+	config.LogConfig.LogPath = LogPath(dataDir)
+	config.viper.SetDefault("log.path", config.LogConfig.LogPath)
+}
+
 // BindFlags A wrapper around viper.BindPFlags that provides access to the viper instance that the config
 // structure keeps track of
-func (config *ServerConfig) BindFlags(cmd *cobra.Command) error {
-	err := config.viper.BindPFlags(cmd.Flags())
+func (config *ServerConfig) BindFlags(flags *pflag.FlagSet) error {
+	err := config.viper.BindPFlags(flags)
 	if err != nil {
 		return err
 	}
@@ -52,8 +166,13 @@ func (config *ServerConfig) BindFlags(cmd *cobra.Command) error {
 	return nil
 }
 
-// Write Writes the current configuration structure back to the config file
+// Write Writes the current configuration structure back to the config file. Configs that were loaded from an
+// encrypted file cannot be written, as they would be written in plaintext
 func (config *ServerConfig) Write(configPath string) error {
+	if config.encrypted {
+		return ErrEncryptedConfigWrite
+	}
+
 	sanitized, err := config.sanitizePath(configPath)
 	if err != nil {
 		return err
@@ -68,13 +187,33 @@ func (config *ServerConfig) Write(configPath string) error {
 }
 
 // Load Loads the config from the requested file path and falls back to environmental variables
-// if the file was not found
+// if the file was not found. If the file is encrypted with age, then it is decrypted with the key provided
+// through the environment (see configIdentities), and failing to decrypt it is always an error
 func (config *ServerConfig) Load(configPath string) error {
 	sanitized, err := config.sanitizePath(configPath)
 	if err != nil {
 		return err
 	}
 
+	contents, err := os.ReadFile(sanitized)
+	if err == nil && age.IsEncrypted(contents) {
+		decrypted, err := decryptConfig(contents)
+		if err != nil {
+			return err
+		}
+
+		config.viper.SetConfigType("json")
+
+		err = config.viper.ReadConfig(bytes.NewReader(decrypted))
+		if err != nil {
+			return err
+		}
+
+		config.encrypted = true
+
+		return config.viper.Unmarshal(&config)
+	}
+
 	config.viper.AddConfigPath(path.Dir(sanitized))
 	config.viper.SetConfigType("json")
 	config.viper.SetConfigName(path.Base(sanitized))
@@ -96,13 +235,147 @@ func (config *ServerConfig) Load(configPath string) error {
 	return nil
 }
 
+// Validate Validates the loaded configuration. This should be called before any services are started
+func (config *ServerConfig) Validate() error {
+	err := config.CryptoConfig.Validate(config.CredentialConfig)
+	if err != nil {
+		return err
+	}
+
+	err = config.ApiConfig.TLS.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.DeprecationConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.TokenStoreConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.DatabaseConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.ClaimConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.RegionConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.HookConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.EventsConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.TelemetryConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.IdentifierConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.MetadataConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.FederationConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.ScimConfig.Validate(&config.FederationConfig)
+	if err != nil {
+		return err
+	}
+
+	err = config.SignerConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.ManagementConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.TracingConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.SecretsConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = config.PolicyConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // New Initialize a new ServerConfig structure
 func New() *ServerConfig {
 	return &ServerConfig{
-		viper:            viper.New(),
-		ApiConfig:        DefaultApiConfig(),
-		DatabaseConfig:   DefaultDatabaseConfig(),
-		CredentialConfig: DefaultCredentialConfig(),
-		LogConfig:        DefaultLogConfig(),
+		viper:               viper.New(),
+		ApiConfig:           DefaultApiConfig(),
+		DatabaseConfig:      DefaultDatabaseConfig(),
+		CredentialConfig:    DefaultCredentialConfig(),
+		LogConfig:           DefaultLogConfig(),
+		EmailConfig:         DefaultEmailConfig(),
+		PhoneConfig:         DefaultPhoneConfig(),
+		PolicyConfig:        DefaultPolicyConfig(),
+		GeoIPConfig:         DefaultGeoIPConfig(),
+		AuditConfig:         DefaultAuditConfig(),
+		SIEMConfig:          DefaultSIEMConfig(),
+		CryptoConfig:        DefaultCryptoConfig(),
+		SecretConfig:        DefaultSecretConfig(),
+		CanaryConfig:        DefaultCanaryConfig(),
+		ApprovalConfig:      DefaultApprovalConfig(),
+		DocumentCacheConfig: DefaultDocumentCacheConfig(),
+		LockConfig:          DefaultLockConfig(),
+		KeyConfig:           DefaultKeyConfig(),
+		DeviceConfig:        DefaultDeviceConfig(),
+		CIBAConfig:          DefaultCIBAConfig(),
+		IntrospectionConfig: DefaultIntrospectionConfig(),
+		DeprecationConfig:   DefaultDeprecationConfig(),
+		AuthorizationConfig: DefaultAuthorizationConfig(),
+		TokenStoreConfig:    DefaultTokenStoreConfig(),
+		SessionConfig:       DefaultSessionConfig(),
+		ClaimConfig:         DefaultClaimConfig(),
+		RegionConfig:        DefaultRegionConfig(),
+		HookConfig:          DefaultHookConfig(),
+		EventsConfig:        DefaultEventsConfig(),
+		TelemetryConfig:     DefaultTelemetryConfig(),
+		IdentifierConfig:    DefaultIdentifierConfig(),
+		MetadataConfig:      DefaultMetadataConfig(),
+		FederationConfig:    DefaultFederationConfig(),
+		ScimConfig:          DefaultScimConfig(),
+		SignerConfig:        DefaultSignerConfig(),
+		ManagementConfig:    DefaultManagementConfig(),
+		SecurityConfig:      DefaultSecurityConfig(),
+		TracingConfig:       DefaultTracingConfig(),
+		SecretsConfig:       DefaultSecretsConfig(),
 	}
 }
@@ -1,9 +1,23 @@
 package config
 
+const (
+	// CredentialAlgorithmArgon2id - The default algorithm used for hashing user credentials
+	CredentialAlgorithmArgon2id string = "argon2id"
+
+	// CredentialAlgorithmPBKDF2 - A FIPS 140 approved algorithm (PBKDF2-HMAC-SHA256) used for hashing user credentials
+	CredentialAlgorithmPBKDF2 string = "pbkdf2"
+)
+
 type CredentialConfig struct {
+	// Algorithm - The algorithm used for hashing new credentials. Can be: argon2id (default), pbkdf2
+	Algorithm string `mapstructure:"algorithm"`
+
 	// Time - The number of iterations that the argon algorithm will run
 	Time uint32 `mapstructure:"time"`
 
+	// Iterations - The number of iterations used when hashing with PBKDF2. Ignored by Argon
+	Iterations uint32 `mapstructure:"iterations"`
+
 	// Memory - The maximum amount of memory (in Megabytes) that Argon can use to hash secrets
 	Memory uint32 `mapstructure:"memory"`
 
@@ -26,7 +40,9 @@ type CredentialConfig struct {
 // DefaultCredentialConfig Initializes the CredentialConfig structure with sane defaults
 func DefaultCredentialConfig() CredentialConfig {
 	return CredentialConfig{
+		Algorithm:       CredentialAlgorithmArgon2id,
 		Time:            1,
+		Iterations:      600000,
 		Memory:          1024,
 		Threads:         1,
 		KeyLength:       16,
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"crypto/fips140"
+	"fmt"
+	"slices"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrNotFIPSApproved - Provides a named error for when FIPS mode is enabled and the config uses an algorithm or parameter that is not approved
+var ErrNotFIPSApproved = credstackError.NewError(500, "ERR_NOT_FIPS_APPROVED", "config: The configuration is not compatible with FIPS mode")
+
+// ErrInvalidCredentialAlgorithm - Provides a named error for when an unknown credential hashing algorithm is configured
+var ErrInvalidCredentialAlgorithm = credstackError.NewError(500, "ERR_INVALID_CREDENTIAL_ALGORITHM", "config: The credential algorithm must be one of: argon2id, pbkdf2")
+
+type CryptoConfig struct {
+	// FIPSMode - If set to true, only FIPS 140 approved algorithms can be used. Always enabled when the binary is running in Go's FIPS 140-3 mode
+	FIPSMode bool `mapstructure:"fips_mode"`
+}
+
+/*
+FIPSEnabled - Returns true if FIPS mode was requested in the config, or if the binary was built with GOFIPS140 (or
+started with GODEBUG=fips140=on) so that Go's FIPS 140-3 module is active
+*/
+func (config *CryptoConfig) FIPSEnabled() bool {
+	return config.FIPSMode || fips140.Enabled()
+}
+
+/*
+Validate - Validates the credential config against the crypto config. Credential hashing is the only code path in
+credstack that uses a non-approved algorithm (Argon2id), so in FIPS mode credentials must be hashed with PBKDF2 using
+parameters that meet NIST SP 800-132: a salt of at least 128 bits, a derived key of at least 112 bits and at least 1000
+iterations. Token signing (RS256 with 2048-bit keys, HS256) is approved in both modes and needs no validation here
+*/
+func (config *CryptoConfig) Validate(credential CredentialConfig) error {
+	algorithms := []string{CredentialAlgorithmArgon2id, CredentialAlgorithmPBKDF2}
+	if !slices.Contains(algorithms, credential.Algorithm) {
+		return ErrInvalidCredentialAlgorithm
+	}
+
+	if !config.FIPSEnabled() {
+		return nil
+	}
+
+	if credential.Algorithm != CredentialAlgorithmPBKDF2 {
+		return fmt.Errorf("%w (credential.algorithm must be pbkdf2)", ErrNotFIPSApproved)
+	}
+
+	if credential.SaltLength < 16 {
+		return fmt.Errorf("%w (credential.salt_length must be at least 16 bytes)", ErrNotFIPSApproved)
+	}
+
+	if credential.KeyLength < 14 {
+		return fmt.Errorf("%w (credential.key_length must be at least 14 bytes)", ErrNotFIPSApproved)
+	}
+
+	if credential.Iterations < 1000 {
+		return fmt.Errorf("%w (credential.iterations must be at least 1000)", ErrNotFIPSApproved)
+	}
+
+	return nil
+}
+
+// DefaultCryptoConfig Initializes the CryptoConfig structure with sane defaults
+func DefaultCryptoConfig() CryptoConfig {
+	return CryptoConfig{
+		FIPSMode: false,
+	}
+}
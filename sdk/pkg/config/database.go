@@ -2,12 +2,22 @@ package config
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 )
 
+// ErrInvalidCollectionName - Provides a named error for when the collection prefix or an override produces an unusable collection name
+var ErrInvalidCollectionName = credstackError.NewError(500, "ERR_INVALID_COLLECTION_NAME", "config: database.collection_prefix and database.collection_overrides must produce valid, unique collection names")
+
+// ErrInvalidReadPreference - Provides a named error for when a read preference is not one of: primary, primaryPreferred, secondary, secondaryPreferred, nearest
+var ErrInvalidReadPreference = credstackError.NewError(500, "ERR_INVALID_READ_PREFERENCE", "config: database read preferences must be one of: primary, primaryPreferred, secondary, secondaryPreferred, nearest")
+
 type DatabaseConfig struct {
 	// Hostname - Defines the hostname that the MongoDB server can be accessed at
 	Hostname string `mapstructure:"hostname"`
@@ -32,11 +42,100 @@ type DatabaseConfig struct {
 
 	// ConnectionTimeout - The duration that credstack should wait for before force closing a Mongo connection
 	ConnectionTimeout time.Duration `mapstructure:"connection_timeout"`
+
+	// ServerSelectionTimeout - How long the driver waits to find an available server before an operation fails
+	ServerSelectionTimeout time.Duration `mapstructure:"server_selection_timeout"`
+
+	// RetryReads - If set to true, reads that fail with a transient network error are retried once by the driver
+	RetryReads bool `mapstructure:"retry_reads"`
+
+	// RetryWrites - If set to true, writes that fail with a transient network error are retried once by the driver
+	RetryWrites bool `mapstructure:"retry_writes"`
+
+	// BreakerThreshold - The number of consecutive failures (heartbeats or network errors) before requests fail fast. Set to 0 to disable
+	BreakerThreshold int `mapstructure:"breaker_threshold"`
+
+	// BreakerCooldown - How long requests fail fast for, before the database is probed again
+	BreakerCooldown time.Duration `mapstructure:"breaker_cooldown"`
+
+	// ConnectRetries - The number of times connecting to the database is retried at startup before giving up. Set to 0 to fail immediately
+	ConnectRetries int `mapstructure:"connect_retries"`
+
+	// ConnectBackoff - The delay before the first connection retry. This is doubled after every attempt (with jitter)
+	ConnectBackoff time.Duration `mapstructure:"connect_backoff"`
+
+	// ConnectMaxBackoff - The maximum delay between connection retries
+	ConnectMaxBackoff time.Duration `mapstructure:"connect_max_backoff"`
+
+	// CollectionPrefix - Prepended to the name of every collection (e.g. cs_), so that credstack can share a database with other applications
+	CollectionPrefix string `mapstructure:"collection_prefix"`
+
+	// CollectionOverrides - Maps the name of a collection (e.g. user) to the exact name that should be used for it. Overrides are not prefixed
+	CollectionOverrides map[string]string `mapstructure:"collection_overrides"`
+
+	// ListReadPreference - The read preference used for list endpoints (users, clients, resource servers, approvals)
+	ListReadPreference string `mapstructure:"list_read_preference"`
+
+	// ReportReadPreference - The read preference used for reports that scan entire collections (like audit verification)
+	ReportReadPreference string `mapstructure:"report_read_preference"`
+
+	// ExportReadPreference - The read preference used for bulk exports
+	ExportReadPreference string `mapstructure:"export_read_preference"`
+}
+
+/*
+CollectionName - Resolves the name of one of credstack's collections (as returned by Collections) to the name that is
+used in the database. If the collection has an override then the override is returned as-is, otherwise the collection
+prefix is prepended to it
+*/
+func (config *DatabaseConfig) CollectionName(collection string) string {
+	if override, ok := config.CollectionOverrides[collection]; ok {
+		return override
+	}
+
+	return config.CollectionPrefix + collection
+}
+
+/*
+Validate - Ensures that every read preference is known, that every override refers to a known collection, and that
+every collection resolves to a name that MongoDB will accept and that no other collection resolves to
+*/
+func (config *DatabaseConfig) Validate() error {
+	collections := config.Collections()
+
+	for collection := range config.CollectionOverrides {
+		if !slices.Contains(collections, collection) {
+			return fmt.Errorf("%w (unknown collection: %s)", ErrInvalidCollectionName, collection)
+		}
+	}
+
+	for _, preference := range []string{config.ListReadPreference, config.ReportReadPreference, config.ExportReadPreference} {
+		if _, err := readpref.ModeFromString(preference); err != nil {
+			return fmt.Errorf("%w (%s)", ErrInvalidReadPreference, preference)
+		}
+	}
+
+	resolved := make(map[string]string, len(collections))
+	for _, collection := range collections {
+		name := config.CollectionName(collection)
+		if name == "" || strings.ContainsAny(name, "$\x00") || strings.HasPrefix(name, "system.") {
+			return fmt.Errorf("%w (%s resolves to: %q)", ErrInvalidCollectionName, collection, name)
+		}
+
+		if existing, ok := resolved[name]; ok {
+			return fmt.Errorf("%w (%s and %s both resolve to: %s)", ErrInvalidCollectionName, existing, collection, name)
+		}
+
+		resolved[name] = collection
+	}
+
+	return nil
 }
 
 /*
 Collections - Returns the default collections that credstack expects to be able to read/write to. This
-is primarily used with Database.Init. This really shouldn't be changed so there is no setter defined for these
+is primarily used with Database.Init. This really shouldn't be changed so there is no setter defined for these. These
+are the names used throughout credstack, and are resolved to the names used in the database with CollectionName
 */
 func (config *DatabaseConfig) Collections() []string {
 	return []string{
@@ -48,6 +147,21 @@ func (config *DatabaseConfig) Collections() []string {
 		"token",
 		"key",
 		"jwk",
+		"audit",
+		"audit_signature",
+		"approval",
+		"lock",
+		"device_code",
+		"authorization_code",
+		"backchannel_request",
+		"config_snapshot",
+		"banner",
+		"session",
+		"revocation",
+		"event_dead_letter",
+		"telemetry",
+		"telemetry_instance",
+		"federation_state",
 	}
 }
 
@@ -58,14 +172,52 @@ defined for these
 */
 func (config *DatabaseConfig) IndexingMap() map[string]bson.D {
 	return map[string]bson.D{
-		"user":            {{Key: "email", Value: 1}, {Key: "header.identifier", Value: 1}},
-		"role":            {{Key: "header.identifier", Value: 1}},
-		"scope":           {{Key: "header.identifier", Value: 1}},
-		"client":          {{Key: "client_id", Value: 1}, {Key: "header.identifier", Value: 1}},
-		"resource_server": {{Key: "header.identifier", Value: 1}},
-		"token":           {{Key: "token", Value: 1}},
-		"key":             {{Key: "header.identifier", Value: 1}},
-		"jwk":             {{Key: "kid", Value: 1}},
+		"user":                {{Key: "canonical_email", Value: 1}, {Key: "header.identifier", Value: 1}},
+		"role":                {{Key: "header.identifier", Value: 1}},
+		"scope":               {{Key: "header.identifier", Value: 1}},
+		"client":              {{Key: "client_id", Value: 1}, {Key: "header.identifier", Value: 1}},
+		"resource_server":     {{Key: "header.identifier", Value: 1}},
+		"token":               {{Key: "access_token", Value: 1}},
+		"key":                 {{Key: "header.identifier", Value: 1}},
+		"jwk":                 {{Key: "kid", Value: 1}},
+		"audit":               {{Key: "sequence", Value: 1}},
+		"audit_signature":     {{Key: "to_sequence", Value: 1}},
+		"approval":            {{Key: "header.identifier", Value: 1}},
+		"device_code":         {{Key: "device_code", Value: 1}},
+		"authorization_code":  {{Key: "code", Value: 1}},
+		"backchannel_request": {{Key: "auth_req_id", Value: 1}},
+		"banner":              {{Key: "header.identifier", Value: 1}},
+		"session":             {{Key: "session_hash", Value: 1}},
+		"federation_state":    {{Key: "state_hash", Value: 1}},
+	}
+}
+
+/*
+NaturalKeyIndexes - Returns the unique indexes on the natural keys of the objects whose headers are created from them.
+With the default ID strategy, the unique index on header.identifier already rejects duplicates of these, but sortable
+strategies ignore the natural key, so these are created alongside the indexes in IndexingMap to keep rejecting them. This
+really shouldn't be changed so there is no setter defined for these
+*/
+func (config *DatabaseConfig) NaturalKeyIndexes() map[string]bson.D {
+	return map[string]bson.D{
+		"user":            {{Key: "canonical_email", Value: 1}},
+		"role":            {{Key: "name", Value: 1}},
+		"scope":           {{Key: "audience", Value: 1}, {Key: "name", Value: 1}},
+		"resource_server": {{Key: "audience", Value: 1}},
+	}
+}
+
+/*
+TTLIndexes - Returns the collections whose documents MongoDB removes automatically once they expire, mapped to the date
+field that holds their expiration. These are created alongside the indexes in IndexingMap, but are not unique. This
+really shouldn't be changed so there is no setter defined for these
+*/
+func (config *DatabaseConfig) TTLIndexes() map[string]string {
+	return map[string]string{
+		"session":            "expires_at",
+		"revocation":         "expires_at",
+		"telemetry_instance": "expires_at",
+		"federation_state":   "expires_at",
 	}
 }
 
@@ -85,7 +237,10 @@ func (config *DatabaseConfig) Mongo() *options.ClientOptions {
 	clientOptions := options.Client().
 		SetHosts([]string{fmt.Sprintf("%s:%d", config.Hostname, config.Port)}).
 		SetDirect(true).
-		SetTimeout(config.ConnectionTimeout)
+		SetTimeout(config.ConnectionTimeout).
+		SetServerSelectionTimeout(config.ServerSelectionTimeout).
+		SetRetryReads(config.RetryReads).
+		SetRetryWrites(config.RetryWrites)
 
 	/*
 		Only SCRAM-SHA-256 is going to be set here as it provides a nice balance between
@@ -117,5 +272,16 @@ func DefaultDatabaseConfig() DatabaseConfig {
 		AuthenticationDatabase: "admin",
 		Username:               "admin",
 		Password:               "admin",
+		ServerSelectionTimeout: 5 * time.Second,
+		RetryReads:             true,
+		RetryWrites:            true,
+		BreakerThreshold:       3,
+		BreakerCooldown:        10 * time.Second,
+		ConnectRetries:         5,
+		ConnectBackoff:         time.Second,
+		ConnectMaxBackoff:      30 * time.Second,
+		ListReadPreference:     "primary",
+		ReportReadPreference:   "primary",
+		ExportReadPreference:   "primary",
 	}
 }
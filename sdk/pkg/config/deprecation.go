@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidDeprecationDate - Provides a named error for when a deprecation or sunset date cannot be parsed
+var ErrInvalidDeprecationDate = credstackError.NewError(500, "ERR_INVALID_DEPRECATION_DATE", "config: Deprecation and sunset dates must be RFC 3339 timestamps")
+
+type DeprecationNotice struct {
+	// Since - An RFC 3339 timestamp representing when the feature was deprecated. Sent in the Deprecation header (RFC 9745)
+	Since string `mapstructure:"since"`
+
+	// Sunset - An RFC 3339 timestamp representing when the feature will be removed. Sent in the Sunset header (RFC 8594). Optional
+	Sunset string `mapstructure:"sunset"`
+
+	// Link - A URL describing the deprecation and how to migrate. Sent in a Link header with rel="deprecation". Optional
+	Link string `mapstructure:"link"`
+}
+
+/*
+SinceTime - Returns Since as a time.Time. A zero time is returned if it is not set. The notice should have been checked
+with DeprecationConfig.Validate first
+*/
+func (notice *DeprecationNotice) SinceTime() time.Time {
+	since, _ := time.Parse(time.RFC3339, notice.Since)
+	return since
+}
+
+/*
+SunsetTime - Returns Sunset as a time.Time. A zero time is returned if it is not set. The notice should have been
+checked with DeprecationConfig.Validate first
+*/
+func (notice *DeprecationNotice) SunsetTime() time.Time {
+	sunset, _ := time.Parse(time.RFC3339, notice.Sunset)
+	return sunset
+}
+
+type DeprecationConfig struct {
+	// Endpoints - Deprecated endpoints, keyed by path prefix (/oauth/token). The longest matching prefix is used
+	Endpoints map[string]DeprecationNotice `mapstructure:"endpoints"`
+
+	// GrantTypes - Deprecated grant types, keyed by grant type (password)
+	GrantTypes map[string]DeprecationNotice `mapstructure:"grant_types"`
+}
+
+/*
+Endpoint - Returns the deprecation notice for the request path provided in the parameter. The longest prefix in
+Endpoints that matches the path is used. If the path is not deprecated, then false is returned
+*/
+func (config *DeprecationConfig) Endpoint(path string) (DeprecationNotice, bool) {
+	var ret DeprecationNotice
+	matched := -1
+
+	for prefix, notice := range config.Endpoints {
+		if strings.HasPrefix(path, prefix) && len(prefix) > matched {
+			ret = notice
+			matched = len(prefix)
+		}
+	}
+
+	return ret, matched != -1
+}
+
+/*
+GrantType - Returns the deprecation notice for the grant type provided in the parameter. If the grant type is not
+deprecated, then false is returned
+*/
+func (config *DeprecationConfig) GrantType(grantType string) (DeprecationNotice, bool) {
+	notice, ok := config.GrantTypes[grantType]
+	return notice, ok
+}
+
+/*
+Validate - Ensures that every deprecation and sunset date can be parsed, so that misconfigured dates are surfaced when
+the server starts instead of being silently dropped from responses
+*/
+func (config *DeprecationConfig) Validate() error {
+	notices := make(map[string]DeprecationNotice, len(config.Endpoints)+len(config.GrantTypes))
+	for prefix, notice := range config.Endpoints {
+		notices["endpoint "+prefix] = notice
+	}
+
+	for grantType, notice := range config.GrantTypes {
+		notices["grant type "+grantType] = notice
+	}
+
+	for name, notice := range notices {
+		for _, value := range []string{notice.Since, notice.Sunset} {
+			if value == "" {
+				continue
+			}
+
+			_, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("%w (%s: %v)", ErrInvalidDeprecationDate, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// DefaultDeprecationConfig Initializes the DeprecationConfig structure with sane defaults
+func DefaultDeprecationConfig() DeprecationConfig {
+	return DeprecationConfig{
+		Endpoints:  map[string]DeprecationNotice{},
+		GrantTypes: map[string]DeprecationNotice{},
+	}
+}
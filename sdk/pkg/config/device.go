@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+type DeviceConfig struct {
+	// VerificationURI - The URL that users are directed to for entering their user code (https://auth.example.com/device)
+	VerificationURI string `mapstructure:"verification_uri"`
+
+	// CodeLifetime - How long a device code and its user code are valid for before the device must start over
+	CodeLifetime time.Duration `mapstructure:"code_lifetime"`
+
+	// PollingInterval - The minimum amount of time a device must wait between polling the token endpoint
+	PollingInterval time.Duration `mapstructure:"polling_interval"`
+}
+
+// DefaultDeviceConfig Initializes the DeviceConfig structure with sane defaults
+func DefaultDeviceConfig() DeviceConfig {
+	return DeviceConfig{
+		VerificationURI: "",
+		CodeLifetime:    10 * time.Minute,
+		PollingInterval: 5 * time.Second,
+	}
+}
@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+type DocumentCacheConfig struct {
+	// Directory - A directory where copies of public documents (JWKS, discovery) are written, so that they survive a restart during a database outage. If empty, documents are only cached in memory
+	Directory string `mapstructure:"directory"`
+
+	// MaxStale - The maximum age of a cached document that can be served while the database is unavailable
+	MaxStale time.Duration `mapstructure:"max_stale"`
+}
+
+// DefaultDocumentCacheConfig Initializes the DocumentCacheConfig structure with sane defaults
+func DefaultDocumentCacheConfig() DocumentCacheConfig {
+	return DocumentCacheConfig{
+		Directory: "",
+		MaxStale:  24 * time.Hour,
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+/*
+EmailConfig - Options for normalizing the email addresses of users. Addresses are normalized into a canonical email
+address, which is what uniqueness is enforced on and what users are looked up by, while the address as provided is
+kept for display and for sending email
+*/
+type EmailConfig struct {
+	// FoldCase - If set to true, email addresses are lower-cased before they are stored or looked up
+	FoldCase bool `mapstructure:"fold_case"`
+
+	// StripPlusAddressing - If set to true, any sub-address (user+tag@example.com) is removed from the local part
+	StripPlusAddressing bool `mapstructure:"strip_plus_addressing"`
+
+	// StripGmailDots - If set to true, dots are removed from the local part of gmail.com and googlemail.com addresses
+	StripGmailDots bool `mapstructure:"strip_gmail_dots"`
+}
+
+// DefaultEmailConfig Initializes the EmailConfig structure with sane defaults
+func DefaultEmailConfig() EmailConfig {
+	return EmailConfig{
+		FoldCase:            true,
+		StripPlusAddressing: false,
+		StripGmailDots:      false,
+	}
+}
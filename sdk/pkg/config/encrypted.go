@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/credstack/credstack/sdk/pkg/age"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+const (
+	// EnvConfigKey - The environment variable holding the age identities (AGE-SECRET-KEY-1...) that decrypt the config file
+	EnvConfigKey = "CREDSTACK_CONFIG_KEY"
+
+	// EnvConfigKeyFile - The environment variable holding the path to an age identity file that decrypts the config file
+	EnvConfigKeyFile = "CREDSTACK_CONFIG_KEY_FILE"
+
+	// EnvConfigPassphrase - The environment variable holding the passphrase that decrypts the config file
+	EnvConfigPassphrase = "CREDSTACK_CONFIG_PASSPHRASE"
+)
+
+// ErrConfigKeyMissing - Provides a named error for when the config file is encrypted, but no key was provided to decrypt it
+var ErrConfigKeyMissing = credstackError.NewError(500, "ERR_CONFIG_KEY_MISSING", "config: config file is encrypted, but none of CREDSTACK_CONFIG_KEY, CREDSTACK_CONFIG_KEY_FILE, or CREDSTACK_CONFIG_PASSPHRASE are set")
+
+// ErrEncryptedConfigWrite - Provides a named error for when writing the config back would store an encrypted config in plaintext
+var ErrEncryptedConfigWrite = credstackError.NewError(500, "ERR_ENCRYPTED_CONFIG_WRITE", "config: config was loaded from an encrypted file and cannot be written back in plaintext")
+
+/*
+configIdentities - Collects the age identities that the config file can be decrypted with from the environment. The
+variables holding key material are removed from the environment once they are read, so that they are not inherited by
+child processes or included in crash dumps
+*/
+func configIdentities() ([]age.Identity, error) {
+	var ret []age.Identity
+
+	if key := os.Getenv(EnvConfigKey); key != "" {
+		identities, err := age.ParseIdentities(key)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, identities...)
+		_ = os.Unsetenv(EnvConfigKey)
+	}
+
+	if keyFile := os.Getenv(EnvConfigKeyFile); keyFile != "" {
+		contents, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		identities, err := age.ParseIdentities(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, keyFile)
+		}
+
+		ret = append(ret, identities...)
+	}
+
+	if passphrase := os.Getenv(EnvConfigPassphrase); passphrase != "" {
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, identity)
+		_ = os.Unsetenv(EnvConfigPassphrase)
+	}
+
+	if len(ret) == 0 {
+		return nil, ErrConfigKeyMissing
+	}
+
+	return ret, nil
+}
+
+/*
+decryptConfig - Decrypts an age encrypted config file with the identities provided through the environment
+*/
+func decryptConfig(data []byte) ([]byte, error) {
+	identities, err := configIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	return age.Decrypt(data, identities...)
+}
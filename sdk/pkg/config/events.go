@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidEventsConfig - Provides a named error for when an event webhook is unnamed, named twice, has no signing secret, or has a URL that is not absolute
+var ErrInvalidEventsConfig = credstackError.NewError(500, "ERR_INVALID_EVENTS_CONFIG", "config: Every event webhook must have a unique name, a signing secret, and an absolute URL")
+
+type EventWebhookConfig struct {
+	// Name - A unique name for the webhook. Recorded on dead letters and used when logging delivery failures
+	Name string `mapstructure:"name"`
+
+	// URL - The URL that events are delivered to with a POST request
+	URL string `mapstructure:"url"`
+
+	// Secret - The secret every delivery is signed with (HMAC-SHA256), so that the receiver can verify that it was sent by credstack
+	Secret string `mapstructure:"secret"`
+
+	// EventTypes - Prefixes of the event types that are delivered (user., token.issued). If empty, all events are delivered
+	EventTypes []string `mapstructure:"event_types"`
+
+	// MaxRetries - The number of times a failed delivery is retried before the event is recorded as a dead letter
+	MaxRetries int `mapstructure:"max_retries"`
+
+	// Timeout - The timeout applied to each delivery
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type EventsConfig struct {
+	// QueueSize - The number of events that can be buffered per webhook before new events are dropped
+	QueueSize int `mapstructure:"queue_size"`
+
+	// Webhooks - The webhooks that lifecycle events are delivered to
+	Webhooks []EventWebhookConfig `mapstructure:"webhooks"`
+}
+
+/*
+Validate - Ensures that every webhook has a unique name, a signing secret, and an absolute URL, so that a misconfigured
+webhook is surfaced when the server starts instead of when its first delivery fails
+*/
+func (config *EventsConfig) Validate() error {
+	names := make(map[string]bool, len(config.Webhooks))
+
+	for _, webhook := range config.Webhooks {
+		if webhook.Name == "" || names[webhook.Name] || webhook.Secret == "" {
+			return fmt.Errorf("%w (%q)", ErrInvalidEventsConfig, webhook.Name)
+		}
+
+		names[webhook.Name] = true
+
+		parsed, err := url.Parse(webhook.URL)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			return fmt.Errorf("%w (%s: %s)", ErrInvalidEventsConfig, webhook.Name, webhook.URL)
+		}
+	}
+
+	return nil
+}
+
+// DefaultEventsConfig Initializes the EventsConfig structure with sane defaults
+func DefaultEventsConfig() EventsConfig {
+	return EventsConfig{
+		QueueSize: 10000,
+		Webhooks:  []EventWebhookConfig{},
+	}
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+const (
+	// FederationTypeOIDC - A connection to an OpenID Connect provider. Its endpoints are discovered from its issuer, and users are identified by the ID token it issues
+	FederationTypeOIDC = "oidc"
+
+	// FederationTypeOAuth2 - A connection to a plain OAuth 2.0 provider. Its endpoints must be configured, and users are identified by its userinfo endpoint
+	FederationTypeOAuth2 = "oauth2"
+
+	// FederationTypeSAML - A connection to a SAML 2.0 identity provider, with credstack as the service provider. Its endpoints and certificates are imported from its metadata
+	FederationTypeSAML = "saml"
+)
+
+const (
+	// FederationPresetGoogle - Configures the endpoints, scopes and claims of a connection for Google
+	FederationPresetGoogle = "google"
+
+	// FederationPresetGitHub - Configures the endpoints, scopes and claims of a connection for GitHub
+	FederationPresetGitHub = "github"
+)
+
+// ErrInvalidFederationConfig - Provides a named error for when a federation connection is unnamed, named twice, or is missing the endpoints or client credentials it needs
+var ErrInvalidFederationConfig = credstackError.NewError(500, "ERR_INVALID_FEDERATION_CONFIG", "config: Every connection must have a unique name, and either a preset, an issuer, absolute endpoints, or SAML metadata")
+
+type FederationConnectionConfig struct {
+	// Name - A unique name for the connection. This is the provider of the identities it links to users, so it should never be changed once users have signed in with it
+	Name string `mapstructure:"name"`
+
+	// DisplayName - The name shown on the hosted login page (Continue with Google). Defaults to Name
+	DisplayName string `mapstructure:"display_name"`
+
+	// Preset - Fills in the type, endpoints, scopes and claims of a well known provider (google, github). Any of them that are set explicitly take precedence
+	Preset string `mapstructure:"preset"`
+
+	// Type - The type of the connection: oidc, oauth2 or saml. Defaults to oidc
+	Type string `mapstructure:"type"`
+
+	// Issuer - The issuer of an OpenID Connect provider. Its endpoints are discovered from /.well-known/openid-configuration
+	Issuer string `mapstructure:"issuer"`
+
+	// AuthorizationEndpoint - The authorization endpoint of the provider. Required for oauth2 connections, and overrides the discovered one for oidc connections
+	AuthorizationEndpoint string `mapstructure:"authorization_endpoint"`
+
+	// TokenEndpoint - The token endpoint of the provider. Required for oauth2 connections, and overrides the discovered one for oidc connections
+	TokenEndpoint string `mapstructure:"token_endpoint"`
+
+	// UserInfoEndpoint - The userinfo endpoint of the provider. Required for oauth2 connections. For oidc connections, claims it returns are merged into the ID token claims
+	UserInfoEndpoint string `mapstructure:"userinfo_endpoint"`
+
+	// MetadataURL - The URL the metadata of a SAML identity provider is imported from. It is fetched again every hour
+	MetadataURL string `mapstructure:"metadata_url"`
+
+	// MetadataFile - The path of a file the metadata of a SAML identity provider is imported from, for providers that do not publish theirs. Takes precedence over MetadataURL
+	MetadataFile string `mapstructure:"metadata_file"`
+
+	// ClientId - The client ID credstack is registered with at the provider. Not used by saml connections
+	ClientId string `mapstructure:"client_id"`
+
+	// ClientSecret - The client secret credstack is registered with at the provider. It is sent in the body of token requests
+	ClientSecret string `mapstructure:"client_secret"`
+
+	// Scopes - The scopes requested from the provider. oidc connections always request openid
+	Scopes []string `mapstructure:"scopes"`
+
+	// SubjectClaim - The claim that identifies the user at the provider. Defaults to sub. For saml connections, sub is the NameID of the assertion, and any other value names an attribute
+	SubjectClaim string `mapstructure:"subject_claim"`
+
+	// ClaimMapping - Maps the fields of new users (email, username, given_name, family_name, middle_name, gender, birth_date, zone_info, phone_number, address, email_verified) to the provider claims they are filled from. Fields that are not mapped are filled from the standard OpenID Connect claim of the same meaning
+	ClaimMapping map[string]string `mapstructure:"claim_mapping"`
+
+	// Clients - The client IDs the connection is offered to on the hosted login page. If empty, it is offered to every client
+	Clients []string `mapstructure:"clients"`
+}
+
+/*
+FederationConfig - Options for signing in through upstream identity providers (social login). Users signing in through
+a connection for the first time are created on the fly, with the identity of the provider linked to them
+*/
+type FederationConfig struct {
+	// Connections - The upstream identity providers users can sign in with, in the order they are shown on the hosted login page
+	Connections []FederationConnectionConfig `mapstructure:"connections"`
+
+	// StateLifetime - How long a user has to complete signing in at the provider before the attempt expires
+	StateLifetime time.Duration `mapstructure:"state_lifetime"`
+
+	// Timeout - How long credstack waits for the provider to respond to discovery, metadata, token and userinfo requests
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// EntityId - The entity ID credstack identifies itself with to SAML identity providers. Defaults to the URL of its service provider metadata under the issuer
+	EntityId string `mapstructure:"entity_id"`
+}
+
+/*
+Connection - Returns the connection with the name provided in the parameter, and false if there is none
+*/
+func (config *FederationConfig) Connection(name string) (FederationConnectionConfig, bool) {
+	for _, connection := range config.Connections {
+		if connection.Name == name {
+			return connection, true
+		}
+	}
+
+	return FederationConnectionConfig{}, false
+}
+
+/*
+Validate - Ensures that every connection has a unique name that can be used as the provider of an identity, a client ID,
+and enough endpoints to sign users in, so that a misconfigured connection is surfaced when the server starts instead of
+when a user tries to sign in with it
+*/
+func (config *FederationConfig) Validate() error {
+	if config.StateLifetime <= 0 {
+		return fmt.Errorf("%w (state_lifetime must be greater than zero)", ErrInvalidFederationConfig)
+	}
+
+	names := make(map[string]bool, len(config.Connections))
+
+	for _, connection := range config.Connections {
+		if connection.Name == "" || names[connection.Name] || connection.Name == "password" || strings.Contains(connection.Name, "|") {
+			return fmt.Errorf("%w (%q)", ErrInvalidFederationConfig, connection.Name)
+		}
+
+		names[connection.Name] = true
+
+		if connection.ClientId == "" && connection.Type != FederationTypeSAML {
+			return fmt.Errorf("%w (%s: missing client_id)", ErrInvalidFederationConfig, connection.Name)
+		}
+
+		endpoints := []string{connection.Issuer, connection.AuthorizationEndpoint, connection.TokenEndpoint, connection.UserInfoEndpoint, connection.MetadataURL}
+		for _, endpoint := range endpoints {
+			if endpoint == "" {
+				continue
+			}
+
+			parsed, err := url.Parse(endpoint)
+			if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+				return fmt.Errorf("%w (%s: %s)", ErrInvalidFederationConfig, connection.Name, endpoint)
+			}
+		}
+
+		switch connection.Preset {
+		case FederationPresetGoogle, FederationPresetGitHub:
+			continue
+		case "":
+		default:
+			return fmt.Errorf("%w (%s: unknown preset %q)", ErrInvalidFederationConfig, connection.Name, connection.Preset)
+		}
+
+		switch connection.Type {
+		case FederationTypeOIDC, "":
+			if connection.Issuer == "" {
+				return fmt.Errorf("%w (%s: oidc connections require an issuer)", ErrInvalidFederationConfig, connection.Name)
+			}
+		case FederationTypeOAuth2:
+			if connection.AuthorizationEndpoint == "" || connection.TokenEndpoint == "" || connection.UserInfoEndpoint == "" {
+				return fmt.Errorf("%w (%s: oauth2 connections require an authorization, token and userinfo endpoint)", ErrInvalidFederationConfig, connection.Name)
+			}
+		case FederationTypeSAML:
+			if connection.MetadataURL == "" && connection.MetadataFile == "" {
+				return fmt.Errorf("%w (%s: saml connections require a metadata_url or metadata_file)", ErrInvalidFederationConfig, connection.Name)
+			}
+		default:
+			return fmt.Errorf("%w (%s: unknown type %q)", ErrInvalidFederationConfig, connection.Name, connection.Type)
+		}
+	}
+
+	return nil
+}
+
+// DefaultFederationConfig Initializes the FederationConfig structure with sane defaults
+func DefaultFederationConfig() FederationConfig {
+	return FederationConfig{
+		Connections:   []FederationConnectionConfig{},
+		StateLifetime: 10 * time.Minute,
+		Timeout:       10 * time.Second,
+	}
+}
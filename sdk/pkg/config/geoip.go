@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+type GeoIPConfig struct {
+	// Backend - The name of the geo-ip backend to use for resolving IP addresses. Can be: none (default), maxmind
+	Backend string `mapstructure:"backend"`
+
+	// DatabasePath - The path to the geo-ip database file (GeoLite2-City.mmdb) used by file based backends
+	DatabasePath string `mapstructure:"database_path"`
+
+	// RefreshInterval - How often the database file is re-opened to pick up updates. Set to 0 to disable refreshing
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+// DefaultGeoIPConfig Initializes the GeoIPConfig structure with sane defaults
+func DefaultGeoIPConfig() GeoIPConfig {
+	return GeoIPConfig{
+		Backend:         "none",
+		DatabasePath:    "/var/lib/credstack/GeoLite2-City.mmdb",
+		RefreshInterval: 24 * time.Hour,
+	}
+}
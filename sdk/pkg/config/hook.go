@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidHookConfig - Provides a named error for when a token issuance webhook is unnamed, named twice, or has a URL that is not absolute
+var ErrInvalidHookConfig = credstackError.NewError(500, "ERR_INVALID_HOOK_CONFIG", "config: Every webhook must have a unique name and an absolute URL")
+
+type HookWebhookConfig struct {
+	// Name - A unique name for the webhook. Used in logs and in the reason a token request is denied with
+	Name string `mapstructure:"name"`
+
+	// URL - The URL that the token issuance input is sent to with a POST request (https://entitlements.internal/hooks/token)
+	URL string `mapstructure:"url"`
+
+	// BearerToken - The bearer token sent to the webhook, so that it can authenticate credstack. If empty, no Authorization header is sent
+	BearerToken string `mapstructure:"bearer_token"`
+
+	// Audiences - The audiences the webhook is called for. If empty, it is called for every token
+	Audiences []string `mapstructure:"audiences"`
+
+	// Timeout - How long credstack waits for the webhook to respond before treating it as unavailable. Defaults to 2 seconds
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// FailOpen - If set to true, tokens are issued without the claims of the webhook when it is unavailable. Otherwise they are denied
+	FailOpen bool `mapstructure:"fail_open"`
+}
+
+/*
+HookConfig - Options for the webhooks that are called before a token is signed. Hooks written in Go are registered with
+hook.Register instead, and always run before the webhooks
+*/
+type HookConfig struct {
+	// Webhooks - The webhooks called before a token is signed, in the order they are defined
+	Webhooks []HookWebhookConfig `mapstructure:"webhooks"`
+}
+
+/*
+Validate - Ensures that every webhook has a unique name and an absolute URL, so that a misconfigured webhook is surfaced
+when the server starts instead of denying every token request
+*/
+func (config *HookConfig) Validate() error {
+	names := make(map[string]bool, len(config.Webhooks))
+
+	for _, webhook := range config.Webhooks {
+		if webhook.Name == "" || names[webhook.Name] {
+			return fmt.Errorf("%w (%q)", ErrInvalidHookConfig, webhook.Name)
+		}
+
+		names[webhook.Name] = true
+
+		parsed, err := url.Parse(webhook.URL)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			return fmt.Errorf("%w (%s: %s)", ErrInvalidHookConfig, webhook.Name, webhook.URL)
+		}
+	}
+
+	return nil
+}
+
+// DefaultHookConfig Initializes the HookConfig structure with sane defaults
+func DefaultHookConfig() HookConfig {
+	return HookConfig{
+		Webhooks: []HookWebhookConfig{},
+	}
+}
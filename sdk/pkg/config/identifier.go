@@ -0,0 +1,40 @@
+package config
+
+import (
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidIdentifierConfig - Provides a named error for when no ID strategy is selected
+var ErrInvalidIdentifierConfig = credstackError.NewError(500, "ERR_INVALID_IDENTIFIER_CONFIG", "config: An ID strategy must be selected")
+
+/*
+IdentifierConfig - Options for how the identifiers of new objects are generated. Changing the strategy only affects
+objects created afterward, as existing objects keep the identifier they were created with
+*/
+type IdentifierConfig struct {
+	// Strategy - The name of the ID strategy: uuidv5 (derived from the object, the default), uuidv7 or ulid (sortable by creation time), sha256 (derived from the object under the namespace), or a strategy registered with header.RegisterStrategy
+	Strategy string `mapstructure:"strategy"`
+
+	// Namespace - A value passed to the ID strategy. The sha256 strategy hashes it along with the object, so that deployments with different namespaces never produce the same identifiers
+	Namespace string `mapstructure:"namespace"`
+}
+
+/*
+Validate - Ensures that an ID strategy is selected. Whether the strategy is registered is only known once the server
+starts, as strategies can be registered by the embedding application
+*/
+func (config *IdentifierConfig) Validate() error {
+	if config.Strategy == "" {
+		return ErrInvalidIdentifierConfig
+	}
+
+	return nil
+}
+
+// DefaultIdentifierConfig Initializes the IdentifierConfig structure with sane defaults
+func DefaultIdentifierConfig() IdentifierConfig {
+	return IdentifierConfig{
+		Strategy:  "uuidv5",
+		Namespace: "",
+	}
+}
@@ -0,0 +1,13 @@
+package config
+
+type IntrospectionConfig struct {
+	// MaxBatchSize - The maximum number of tokens that can be introspected in a single batch request
+	MaxBatchSize int `mapstructure:"max_batch_size"`
+}
+
+// DefaultIntrospectionConfig Initializes the IntrospectionConfig structure with sane defaults
+func DefaultIntrospectionConfig() IntrospectionConfig {
+	return IntrospectionConfig{
+		MaxBatchSize: 100,
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+type KeyConfig struct {
+	// StagingPeriod - How long a staged signing key is published in the JWKS before it is used for signing. This should be longer than the amount of time resource servers cache the JWKS for
+	StagingPeriod time.Duration `mapstructure:"staging_period"`
+
+	// GracePeriod - How long a signing key that was rotated out stays published in the JWKS for verification only. Keys are kept for longer if a client has a longer token lifetime, so that every token signed with them expires first
+	GracePeriod time.Duration `mapstructure:"grace_period"`
+
+	// CacheTTL - How long the current signing key of an audience is cached in memory for. Rotations on this replica take effect immediately, however other replicas keep signing with the previous key until this elapses. Set to zero to disable the cache
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// DefaultKeyConfig Initializes the KeyConfig structure with sane defaults
+func DefaultKeyConfig() KeyConfig {
+	return KeyConfig{
+		StagingPeriod: time.Hour,
+		GracePeriod:   24 * time.Hour,
+		CacheTTL:      time.Minute,
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+type LockConfig struct {
+	// Owner - Identifies this replica as the holder of a lock, so that operators can tell who holds it. If empty, this defaults to the hostname and process ID. Leases are never matched by this, so it does not need to be unique
+	Owner string `mapstructure:"owner"`
+
+	// LeaseTTL - How long a lock is held for before another replica can take it over. Locks are renewed while the task holding them is running, so this only needs to cover a crashed replica
+	LeaseTTL time.Duration `mapstructure:"lease_ttl"`
+}
+
+/*
+OwnerID - Returns the identifier that this replica records on any locks it holds. If Owner has not been set, then this
+is derived from the hostname and the process ID
+*/
+func (config *LockConfig) OwnerID() string {
+	if config.Owner != "" {
+		return config.Owner
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return hostname + ":" + strconv.Itoa(os.Getpid())
+}
+
+// DefaultLockConfig Initializes the LockConfig structure with sane defaults
+func DefaultLockConfig() LockConfig {
+	return LockConfig{
+		Owner:    "",
+		LeaseTTL: 30 * time.Second,
+	}
+}
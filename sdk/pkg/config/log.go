@@ -9,8 +9,8 @@ type LogConfig struct {
 	// UseFileLogging - If set to true, log files will be written in JSON format
 	UseFileLogging bool `mapstructure:"use_file_logging"`
 
-	// LogPath - The directory that logs should be saved under
-	LogPath string `mapstructure:"log_path"`
+	// LogPath - The directory that logs should be saved under. Created if it does not exist
+	LogPath string `mapstructure:"path"`
 
 	// LogLevel - A string determining how verbose logs should be. Can be: Info (default), Debug, All
 	LogLevel zapcore.Level
@@ -23,7 +23,7 @@ type LogConfig struct {
 func DefaultLogConfig() LogConfig {
 	return LogConfig{
 		UseFileLogging: false,
-		LogPath:        "/var/log/credstack",
+		LogPath:        DefaultLogPath(),
 		LogLevel:       zapcore.InfoLevel,
 		EncoderConfig:  zap.NewProductionEncoderConfig(),
 	}
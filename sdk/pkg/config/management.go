@@ -0,0 +1,48 @@
+package config
+
+import (
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidManagementConfig - Provides a named error for when authentication of the management API is required without an audience or admin client name
+var ErrInvalidManagementConfig = credstackError.NewError(500, "ERR_INVALID_MANAGEMENT_CONFIG", "config: Authentication of the management API requires an audience and an admin client name")
+
+/*
+ManagementConfig - Options for authenticating requests to the management API. When authentication is required, every
+management request must carry an access token issued by credstack for Audience, with the scopes the route requires. The
+resource server for Audience, and an admin client that can issue tokens for it, are bootstrapped during preflight
+*/
+type ManagementConfig struct {
+	// RequireAuthentication - If set to true, management requests without a valid access token for Audience are rejected. Defaults to true
+	RequireAuthentication bool `mapstructure:"require_authentication"`
+
+	// Audience - The audience of the resource server that represents the management API
+	Audience string `mapstructure:"audience"`
+
+	// ClientName - The name of the admin client that is bootstrapped with every management scope
+	ClientName string `mapstructure:"client_name"`
+}
+
+/*
+Validate - Ensures that an audience and admin client name are configured when authentication is required
+*/
+func (config *ManagementConfig) Validate() error {
+	if !config.RequireAuthentication {
+		return nil
+	}
+
+	if config.Audience == "" || config.ClientName == "" {
+		return ErrInvalidManagementConfig
+	}
+
+	return nil
+}
+
+// DefaultManagementConfig Initializes the ManagementConfig structure with sane defaults
+func DefaultManagementConfig() ManagementConfig {
+	return ManagementConfig{
+		RequireAuthentication: true,
+		Audience:              "credstack-management",
+		ClientName:            "credstack-admin",
+	}
+}
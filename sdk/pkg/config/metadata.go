@@ -0,0 +1,39 @@
+package config
+
+import (
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidMetadataConfig - Provides a named error for when a metadata size limit is zero
+var ErrInvalidMetadataConfig = credstackError.NewError(500, "ERR_INVALID_METADATA_CONFIG", "config: Metadata size limits must be greater than zero")
+
+/*
+MetadataConfig - Options for the schemaless metadata stored on users. User metadata can be edited by the user it belongs
+to, while app metadata can only be edited through the management API
+*/
+type MetadataConfig struct {
+	// MaxUserMetadataSize - The largest that the user metadata of a single user can grow to, in bytes of BSON
+	MaxUserMetadataSize uint32 `mapstructure:"max_user_metadata_size"`
+
+	// MaxAppMetadataSize - The largest that the app metadata of a single user can grow to, in bytes of BSON
+	MaxAppMetadataSize uint32 `mapstructure:"max_app_metadata_size"`
+}
+
+/*
+Validate - Ensures that both size limits are set, as a limit of zero would reject every update
+*/
+func (config *MetadataConfig) Validate() error {
+	if config.MaxUserMetadataSize == 0 || config.MaxAppMetadataSize == 0 {
+		return ErrInvalidMetadataConfig
+	}
+
+	return nil
+}
+
+// DefaultMetadataConfig Initializes the MetadataConfig structure with sane defaults
+func DefaultMetadataConfig() MetadataConfig {
+	return MetadataConfig{
+		MaxUserMetadataSize: 16384,
+		MaxAppMetadataSize:  16384,
+	}
+}
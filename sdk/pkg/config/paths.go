@@ -0,0 +1,140 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// appName - The name of the directory that credstack stores its files under
+const appName = "credstack"
+
+// configFileName - The name of the config file within the config directory
+const configFileName = "config.json"
+
+/*
+isSystem - Determines if credstack is running as a system service (root on Unix), in which case system wide paths are
+used instead of the paths of the current user. On Windows this is always false, as services are always passed their
+paths explicitly by 'service install'
+*/
+func isSystem() bool {
+	return runtime.GOOS != "windows" && os.Geteuid() == 0
+}
+
+/*
+userDir - Resolves the base directory provided by an XDG environment variable, falling back to the path under the home
+directory that the XDG Base Directory Specification defines as its default. Relative values are ignored, as required by
+the specification
+*/
+func userDir(env string, fallback ...string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+
+	return filepath.Join(append([]string{home}, fallback...)...)
+}
+
+/*
+DefaultConfigDir - Returns the directory the config file is loaded from by default:
+
+  - Linux and other Unix systems: $XDG_CONFIG_HOME/credstack (~/.config/credstack), or /etc/credstack when running as root
+  - macOS: ~/Library/Application Support/credstack, or /Library/Application Support/credstack when running as root
+  - Windows: %AppData%\credstack
+*/
+func DefaultConfigDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(userDir("AppData", "AppData", "Roaming"), appName)
+	case "darwin":
+		if isSystem() {
+			return filepath.Join("/Library", "Application Support", appName)
+		}
+
+		return filepath.Join(userDir("", "Library", "Application Support"), appName)
+	default:
+		if isSystem() {
+			return filepath.Join("/etc", appName)
+		}
+
+		return filepath.Join(userDir("XDG_CONFIG_HOME", ".config"), appName)
+	}
+}
+
+/*
+DefaultLogPath - Returns the directory logs are written to by default:
+
+  - Linux and other Unix systems: $XDG_STATE_HOME/credstack/logs (~/.local/state/credstack/logs), or /var/log/credstack when running as root
+  - macOS: ~/Library/Logs/credstack, or /Library/Logs/credstack when running as root
+  - Windows: %ProgramData%\credstack\logs, as services do not have a console for stdout logging to be read from
+*/
+func DefaultLogPath() string {
+	switch runtime.GOOS {
+	case "windows":
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+
+		return filepath.Join(programData, appName, "logs")
+	case "darwin":
+		if isSystem() {
+			return filepath.Join("/Library", "Logs", appName)
+		}
+
+		return filepath.Join(userDir("", "Library", "Logs"), appName)
+	default:
+		if isSystem() {
+			return filepath.Join("/var", "log", appName)
+		}
+
+		return filepath.Join(userDir("XDG_STATE_HOME", ".local", "state"), appName, "logs")
+	}
+}
+
+/*
+LegacyConfigPath - Returns the path config files were loaded from before credstack followed platform conventions
+(~/.credstack/config.json). This is still loaded if it exists and no config file exists at the default path, so that
+existing installs keep working after an upgrade
+*/
+func LegacyConfigPath() string {
+	return filepath.Join(userDir("", "."+appName), configFileName)
+}
+
+/*
+ConfigPath - Returns the path of the config file that should be loaded when one was not provided explicitly. If
+dataDir is set, then the config file is loaded from it. Otherwise, the config file is loaded from DefaultConfigDir,
+falling back to LegacyConfigPath if only the legacy file exists
+*/
+func ConfigPath(dataDir string) string {
+	if dataDir != "" {
+		return filepath.Join(dataDir, configFileName)
+	}
+
+	path := filepath.Join(DefaultConfigDir(), configFileName)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		legacy := LegacyConfigPath()
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+
+	return path
+}
+
+/*
+LogPath - Returns the directory logs should be written to by default. If dataDir is set, then logs are written under
+it. Otherwise, DefaultLogPath is returned
+*/
+func LogPath(dataDir string) string {
+	if dataDir != "" {
+		return filepath.Join(dataDir, "logs")
+	}
+
+	return DefaultLogPath()
+}
@@ -0,0 +1,17 @@
+package config
+
+/*
+PhoneConfig - Options for normalizing the phone numbers of users. Phone numbers are always stored in E.164 format, so
+these options only control how numbers that are provided without a country calling code are handled
+*/
+type PhoneConfig struct {
+	// DefaultCountryCode - The country calling code (without a leading +) applied to phone numbers provided in national format. If empty, numbers must be provided in international format
+	DefaultCountryCode string `mapstructure:"default_country_code"`
+}
+
+// DefaultPhoneConfig Initializes the PhoneConfig structure with sane defaults
+func DefaultPhoneConfig() PhoneConfig {
+	return PhoneConfig{
+		DefaultCountryCode: "",
+	}
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidPolicyConfig - Provides a named error for when a business hours policy has no audience, hours or weekdays out of range, or an unknown time zone
+var ErrInvalidPolicyConfig = credstackError.NewError(500, "ERR_INVALID_POLICY_CONFIG", "config: Business hours policies require an audience, hours between 0 and 24 that start before they end, weekdays between 0 and 6, and a known time zone")
+
+/*
+BusinessHoursPolicy - Restricts token issuance for an audience to a window of hours on specific days of the week. The
+window is evaluated in the time zone of the user the token is issued for, so that a single policy covers users in
+every time zone
+*/
+type BusinessHoursPolicy struct {
+	// Audience - The audience (resource server) that this policy restricts token issuance for
+	Audience string `mapstructure:"audience"`
+
+	// Weekdays - The days of the week tokens can be issued on, where 0 is Sunday. If empty, Monday-Friday is assumed
+	Weekdays []int `mapstructure:"weekdays"`
+
+	// StartHour - The hour of the day (0-23) from which tokens can be issued
+	StartHour int `mapstructure:"start_hour"`
+
+	// EndHour - The hour of the day (1-24) after which tokens can no longer be issued
+	EndHour int `mapstructure:"end_hour"`
+
+	// ZoneInfo - The IANA time zone used when the subject of the token has no ZoneInfo of its own. Defaults to UTC
+	ZoneInfo string `mapstructure:"zone_info"`
+}
+
+/*
+PolicyEngineConfig - Options for consulting an external, OPA compatible, policy engine before tokens are issued and
+management API requests are handled
+*/
+type PolicyEngineConfig struct {
+	// URL - The base URL of an OPA compatible policy service (https://opa.internal:8181). Decisions are requested with the OPA Data API. If empty, the policy engine is disabled
+	URL string `mapstructure:"url"`
+
+	// TokenPath - The path of the rule consulted before a token is issued (credstack/token/allow). If empty, token issuance is not evaluated
+	TokenPath string `mapstructure:"token_path"`
+
+	// ManagementPath - The path of the rule consulted before a management API request is handled (credstack/management/allow). If empty, management requests are not evaluated
+	ManagementPath string `mapstructure:"management_path"`
+
+	// BearerToken - The bearer token sent to the policy service, so that it can authenticate credstack. If empty, no Authorization header is sent
+	BearerToken string `mapstructure:"bearer_token"`
+
+	// Timeout - How long credstack waits for a decision before treating the policy service as unavailable
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// FailOpen - If set to true, requests are allowed when the policy service is unavailable. Otherwise they are denied
+	FailOpen bool `mapstructure:"fail_open"`
+}
+
+/*
+PolicyConfig - Options for the policies that are evaluated before a token is issued, in addition to the checks that are
+built into every grant
+*/
+type PolicyConfig struct {
+	// BusinessHours - Policies restricting token issuance for specific audiences to business hours
+	BusinessHours []BusinessHoursPolicy `mapstructure:"business_hours"`
+
+	// Engine - An external policy engine consulted for token issuance and management API authorization
+	Engine PolicyEngineConfig `mapstructure:"engine"`
+}
+
+/*
+Validate - Ensures that every business hours policy names an audience, has a window that starts before it ends within
+the day, only lists valid weekdays, and names a time zone that can be loaded. Overnight windows (22-6) cannot be
+expressed by a single policy, so an inverted window is rejected instead of never allowing issuance
+*/
+func (config *PolicyConfig) Validate() error {
+	for i, policy := range config.BusinessHours {
+		if policy.Audience == "" {
+			return fmt.Errorf("%w (business_hours[%d]: the audience is required)", ErrInvalidPolicyConfig, i)
+		}
+
+		if policy.StartHour < 0 || policy.StartHour > 23 {
+			return fmt.Errorf("%w (business_hours[%d]: start_hour must be between 0 and 23, found %d)", ErrInvalidPolicyConfig, i, policy.StartHour)
+		}
+
+		if policy.EndHour < 1 || policy.EndHour > 24 {
+			return fmt.Errorf("%w (business_hours[%d]: end_hour must be between 1 and 24, found %d)", ErrInvalidPolicyConfig, i, policy.EndHour)
+		}
+
+		if policy.StartHour >= policy.EndHour {
+			return fmt.Errorf("%w (business_hours[%d]: start_hour %d must be before end_hour %d)", ErrInvalidPolicyConfig, i, policy.StartHour, policy.EndHour)
+		}
+
+		for _, weekday := range policy.Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return fmt.Errorf("%w (business_hours[%d]: weekdays must be between 0 and 6, found %d)", ErrInvalidPolicyConfig, i, weekday)
+			}
+		}
+
+		if policy.ZoneInfo != "" {
+			_, err := time.LoadLocation(policy.ZoneInfo)
+			if err != nil {
+				return fmt.Errorf("%w (business_hours[%d]: %v)", ErrInvalidPolicyConfig, i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// DefaultPolicyConfig Initializes the PolicyConfig structure with sane defaults
+func DefaultPolicyConfig() PolicyConfig {
+	return PolicyConfig{
+		BusinessHours: []BusinessHoursPolicy{},
+		Engine: PolicyEngineConfig{
+			URL:            "",
+			TokenPath:      "",
+			ManagementPath: "",
+			BearerToken:    "",
+			Timeout:        2 * time.Second,
+			FailOpen:       false,
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidRegionConfig - Provides a named error for when the region options cannot be used together
+var ErrInvalidRegionConfig = credstackError.NewError(500, "ERR_INVALID_REGION_CONFIG", "config: The region must be named when an endpoint or peers are configured, and every URL must be absolute")
+
+/*
+RegionConfig - Options for running credstack in more than one region at once (active-active). Every region connects to
+the same globally replicated MongoDB deployment and is started with the same issuer, so that a token issued in one region
+is valid in all of them. These options only describe the region a server runs in, and how it reaches the others
+*/
+type RegionConfig struct {
+	// Name - The name of the region the server runs in (us-east). Recorded on the objects and events it creates. If empty, the server is not region-aware
+	Name string `mapstructure:"name"`
+
+	// Endpoint - The base URL that clients in this region reach credstack at (https://us-east.auth.example.com). The discovery document renders endpoints relative to it, while the issuer is kept global. If empty, endpoints are rendered relative to the issuer
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Peers - The base URLs of the other regions, keyed by their name. These are probed when the health of the deployment is requested
+	Peers map[string]string `mapstructure:"peers"`
+
+	// PeerTimeout - How long a peer has to respond to a health probe before it is considered unavailable
+	PeerTimeout time.Duration `mapstructure:"peer_timeout"`
+
+	// RevocationRetention - How long revocations are kept in the feed that other regions and resource servers follow. This should be longer than the lifetime of any access token
+	RevocationRetention time.Duration `mapstructure:"revocation_retention"`
+}
+
+/*
+Validate - Ensures that the region is named if it has an endpoint or peers, and that every URL is absolute, so that a
+misconfigured region is surfaced when the server starts instead of advertising unreachable endpoints
+*/
+func (config *RegionConfig) Validate() error {
+	if config.Name == "" && (config.Endpoint != "" || len(config.Peers) != 0) {
+		return ErrInvalidRegionConfig
+	}
+
+	urls := map[string]string{"endpoint": config.Endpoint}
+	for name, peer := range config.Peers {
+		if name == config.Name {
+			return fmt.Errorf("%w (the region cannot be its own peer: %s)", ErrInvalidRegionConfig, name)
+		}
+
+		urls["peer "+name] = peer
+	}
+
+	for name, value := range urls {
+		if name == "endpoint" && value == "" {
+			continue
+		}
+
+		parsed, err := url.Parse(value)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			return fmt.Errorf("%w (%s: %s)", ErrInvalidRegionConfig, name, value)
+		}
+	}
+
+	return nil
+}
+
+// DefaultRegionConfig Initializes the RegionConfig structure with sane defaults
+func DefaultRegionConfig() RegionConfig {
+	return RegionConfig{
+		Name:                "",
+		Endpoint:            "",
+		Peers:               map[string]string{},
+		PeerTimeout:         2 * time.Second,
+		RevocationRetention: 24 * time.Hour,
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+const (
+	// ScimSubjectUserName - Provisioned users are linked to the federation connection by their SCIM userName
+	ScimSubjectUserName = "userName"
+
+	// ScimSubjectExternalId - Provisioned users are linked to the federation connection by their SCIM externalId
+	ScimSubjectExternalId = "externalId"
+)
+
+// ErrInvalidScimConfig - Provides a named error for when SCIM provisioning is configured with a connection that does not exist, or an unknown subject attribute
+var ErrInvalidScimConfig = credstackError.NewError(500, "ERR_INVALID_SCIM_CONFIG", "config: The SCIM connection must be a configured federation connection, the subject attribute must be userName or externalId, and the audience must be set")
+
+/*
+ScimConfig - Options for provisioning users and groups from a directory (Okta, Entra ID) with SCIM 2.0. Groups are
+provisioned as roles, and group memberships as the roles assigned to users
+*/
+type ScimConfig struct {
+	// Clients - The client IDs of the provisioning clients. Requests must be authenticated with an access token issued to one of them with client credentials. If empty, SCIM provisioning is disabled
+	Clients []string `mapstructure:"clients"`
+
+	// Audience - The audience the access tokens of provisioning clients must be issued for, so that a token issued to a provisioning client for another API cannot be used to provision users
+	Audience string `mapstructure:"audience"`
+
+	// Scope - The scope the access tokens of provisioning clients must be issued with
+	Scope string `mapstructure:"scope"`
+
+	// Connection - The federation connection provisioned users sign in with. Their identity with it is linked to them when they are provisioned, so that signing in does not conflict with their account. If empty, provisioned users sign in with a password
+	Connection string `mapstructure:"connection"`
+
+	// SubjectAttribute - The SCIM attribute (userName or externalId) that is the subject of the identity provisioned users are linked to Connection with. This must be what the connection identifies the user by (the NameID, or the sub claim)
+	SubjectAttribute string `mapstructure:"subject_attribute"`
+
+	// MaxResults - The most resources returned from a single list request. Directories page through the rest
+	MaxResults int `mapstructure:"max_results"`
+}
+
+/*
+Validate - Ensures that the connection provisioned users are linked to is configured in the federation config provided in
+the parameter, so that a typo is surfaced when the server starts instead of when the first user is provisioned
+*/
+func (config *ScimConfig) Validate(federation *FederationConfig) error {
+	if config.MaxResults <= 0 {
+		return fmt.Errorf("%w (max_results must be greater than zero)", ErrInvalidScimConfig)
+	}
+
+	if config.Audience == "" {
+		return fmt.Errorf("%w (audience must not be empty)", ErrInvalidScimConfig)
+	}
+
+	if config.SubjectAttribute != ScimSubjectUserName && config.SubjectAttribute != ScimSubjectExternalId {
+		return fmt.Errorf("%w (unknown subject_attribute %q)", ErrInvalidScimConfig, config.SubjectAttribute)
+	}
+
+	if config.Connection == "" {
+		return nil
+	}
+
+	if _, ok := federation.Connection(config.Connection); !ok {
+		return fmt.Errorf("%w (unknown connection %q)", ErrInvalidScimConfig, config.Connection)
+	}
+
+	return nil
+}
+
+// DefaultScimConfig Initializes the ScimConfig structure with sane defaults
+func DefaultScimConfig() ScimConfig {
+	return ScimConfig{
+		Clients:          []string{},
+		Audience:         "credstack-scim",
+		Scope:            "scim",
+		Connection:       "",
+		SubjectAttribute: ScimSubjectUserName,
+		MaxResults:       100,
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+const (
+	// SecretEncodingBase64 - Secrets are random bytes encoded as URL-Safe base64. This is the default, and the format used by credstack before policies existed
+	SecretEncodingBase64 string = "base64url"
+
+	// SecretEncodingHex - Secrets are random bytes encoded as lowercase hex
+	SecretEncodingHex string = "hex"
+
+	// SecretEncodingAlphabet - Secrets are random characters drawn from SecretPolicy.Alphabet
+	SecretEncodingAlphabet string = "alphabet"
+)
+
+type SecretPolicy struct {
+	// Encoding - How the random portion of the secret is encoded. Can be: base64url (default), hex, alphabet
+	Encoding string `mapstructure:"encoding"`
+
+	// Length - The number of random bytes used for base64url and hex encoding, or the number of characters for alphabet encoding
+	Length uint32 `mapstructure:"length"`
+
+	// Alphabet - The characters that secrets are drawn from when Encoding is alphabet. Ignored otherwise
+	Alphabet string `mapstructure:"alphabet"`
+
+	// Prefix - A fixed string prepended to every secret (cs_live_). Makes leaked secrets easy to identify
+	Prefix string `mapstructure:"prefix"`
+
+	// Checksum - If set to true, a CRC32 checksum is appended to every secret so that secret scanners can detect them without false positives
+	Checksum bool `mapstructure:"checksum"`
+}
+
+type SecretConfig struct {
+	// ClientId - The policy used for generating client IDs
+	ClientId SecretPolicy `mapstructure:"client_id"`
+
+	// ClientSecret - The policy used for generating client secrets
+	ClientSecret SecretPolicy `mapstructure:"client_secret"`
+}
+
+// DefaultSecretConfig Initializes the SecretConfig structure with sane defaults
+func DefaultSecretConfig() SecretConfig {
+	return SecretConfig{
+		ClientId: SecretPolicy{
+			Encoding: SecretEncodingBase64,
+			Length:   16,
+		},
+		ClientSecret: SecretPolicy{
+			Encoding: SecretEncodingBase64,
+			Length:   96,
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidSecretsConfig - Provides a named error for when secret references are resolved without a timeout, or re-resolved with a negative interval
+var ErrInvalidSecretsConfig = credstackError.NewError(500, "ERR_INVALID_SECRETS_CONFIG", "config: Secret references require a timeout, and a refresh interval that is not negative")
+
+/*
+SecretsConfig - Options for resolving secret references. Any of the fields returned by ServerConfig.SecretFields can be
+set to a reference (vault://, awssm://, file://) instead of the secret itself, and is replaced with the secret it refers
+to when the server starts. The options here are never resolved themselves, as they are needed to resolve everything else
+*/
+type SecretsConfig struct {
+	// RefreshInterval - How often the database credentials are resolved again, so that rotated credentials are picked up without a restart. Set to 0 to only resolve them at startup
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+
+	// Timeout - How long resolving a single reference can take
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// Vault - Options for resolving vault:// references
+	Vault VaultSecretsConfig `mapstructure:"vault"`
+
+	// AWS - Options for resolving awssm:// references
+	AWS AWSSecretsConfig `mapstructure:"aws"`
+}
+
+/*
+VaultSecretsConfig - Options for reading secrets from HashiCorp Vault. References are the API path of the secret relative
+to /v1/, so both KV version 1 and version 2 mounts can be read (vault://secret/data/credstack#password)
+*/
+type VaultSecretsConfig struct {
+	// Address - The address of the Vault server (https://vault.example.com:8200). If empty, then it is read from the VAULT_ADDR environment variable
+	Address string `mapstructure:"address"`
+
+	// Token - The token credstack authenticates with. It must be allowed to read every referenced path. If empty, then it is read from the VAULT_TOKEN environment variable
+	Token string `mapstructure:"token"`
+
+	// Namespace - The Vault Enterprise namespace the secrets are stored in. If empty, then it is read from the VAULT_NAMESPACE environment variable
+	Namespace string `mapstructure:"namespace"`
+}
+
+/*
+AWSSecretsConfig - Options for reading secrets from AWS Secrets Manager. References are the name or ARN of the secret
+(awssm://credstack/database#password)
+*/
+type AWSSecretsConfig struct {
+	// Region - The AWS region secrets are read from. If empty, then it is resolved by the AWS SDK (AWS_REGION, or the shared config file). References by ARN always use the region of the ARN
+	Region string `mapstructure:"region"`
+
+	// Endpoint - Overrides the Secrets Manager endpoint of the region, for VPC endpoints and local emulators. Optional
+	Endpoint string `mapstructure:"endpoint"`
+
+	// AccessKeyId - The access key ID credstack authenticates with. If empty, then credentials are resolved by the default credential chain of the AWS SDK (environment variables, shared config and SSO, web identity, and instance roles)
+	AccessKeyId string `mapstructure:"access_key_id"`
+
+	// SecretAccessKey - The secret access key credstack authenticates with. Only used if AccessKeyId is set
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+
+	// SessionToken - The session token of temporary credentials. Only used if AccessKeyId is set
+	SessionToken string `mapstructure:"session_token"`
+}
+
+/*
+Validate - Ensures that references can be resolved with a timeout, and that the refresh interval is not negative
+*/
+func (config *SecretsConfig) Validate() error {
+	if config.Timeout <= 0 {
+		return fmt.Errorf("%w (timeout must be greater than zero)", ErrInvalidSecretsConfig)
+	}
+
+	if config.RefreshInterval < 0 {
+		return fmt.Errorf("%w (refresh_interval must not be negative)", ErrInvalidSecretsConfig)
+	}
+
+	return nil
+}
+
+/*
+SecretFields - Returns the fields of the config that can be set to a secret reference, keyed by the name of their config
+key (database.password, events.webhooks.0.secret). Values are pointers to the fields themselves, so that a resolved
+secret can be written back in place. Secrets that live in maps (tracing.headers) are not included, as map values cannot
+be written through a pointer
+*/
+func (config *ServerConfig) SecretFields() map[string]*string {
+	fields := map[string]*string{
+		"database.username":                &config.DatabaseConfig.Username,
+		"database.password":                &config.DatabaseConfig.Password,
+		"ciba.user_notification_token":     &config.CIBAConfig.UserNotificationToken,
+		"policy.engine.bearer_token":       &config.PolicyConfig.Engine.BearerToken,
+		"signer.vault.token":               &config.SignerConfig.Vault.Token,
+		"signer.aws_kms.access_key_id":     &config.SignerConfig.AWSKMS.AccessKeyId,
+		"signer.aws_kms.secret_access_key": &config.SignerConfig.AWSKMS.SecretAccessKey,
+		"signer.aws_kms.session_token":     &config.SignerConfig.AWSKMS.SessionToken,
+		"signer.pkcs11.pin":                &config.SignerConfig.PKCS11.Pin,
+	}
+
+	for i := range config.SIEMConfig.Exporters {
+		fields["siem.exporters."+strconv.Itoa(i)+".token"] = &config.SIEMConfig.Exporters[i].Token
+	}
+
+	for i := range config.HookConfig.Webhooks {
+		fields["hook.webhooks."+strconv.Itoa(i)+".bearer_token"] = &config.HookConfig.Webhooks[i].BearerToken
+	}
+
+	for i := range config.EventsConfig.Webhooks {
+		fields["events.webhooks."+strconv.Itoa(i)+".secret"] = &config.EventsConfig.Webhooks[i].Secret
+	}
+
+	for i := range config.FederationConfig.Connections {
+		fields["federation.connections."+strconv.Itoa(i)+".client_secret"] = &config.FederationConfig.Connections[i].ClientSecret
+	}
+
+	return fields
+}
+
+// DefaultSecretsConfig Initializes the SecretsConfig structure with sane defaults
+func DefaultSecretsConfig() SecretsConfig {
+	return SecretsConfig{
+		RefreshInterval: 5 * time.Minute,
+		Timeout:         10 * time.Second,
+		Vault:           VaultSecretsConfig{},
+		AWS:             AWSSecretsConfig{},
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+SecurityConfig - Options for the security headers applied to every response, and the limits applied to every request.
+Handlers that set one of these headers themselves, like the hosted login pages that need to be framed by a single origin,
+always take precedence
+*/
+type SecurityConfig struct {
+	// Headers - If set to true, the security headers are applied to every response. Defaults to true
+	Headers bool `mapstructure:"headers"`
+
+	// HSTSMaxAge - How long browsers only connect over HTTPS (Strict-Transport-Security). Browsers ignore the header over plain HTTP, so it is safe to send when TLS is terminated by a load balancer. Set to 0 to disable
+	HSTSMaxAge time.Duration `mapstructure:"hsts_max_age"`
+
+	// HSTSIncludeSubdomains - If set to true, HSTS also applies to every subdomain of the issuer
+	HSTSIncludeSubdomains bool `mapstructure:"hsts_include_subdomains"`
+
+	// HSTSPreload - If set to true, the domain consents to being included in browser HSTS preload lists
+	HSTSPreload bool `mapstructure:"hsts_preload"`
+
+	// FrameOptions - The value of the X-Frame-Options header. Not sent on responses that restrict framing with a frame-ancestors Content-Security-Policy. Set to an empty string to disable
+	FrameOptions string `mapstructure:"frame_options"`
+
+	// ReferrerPolicy - The value of the Referrer-Policy header. Defaults to no-referrer, so that authorization codes and state in URLs never leak to other sites. Set to an empty string to disable
+	ReferrerPolicy string `mapstructure:"referrer_policy"`
+
+	// NoStorePaths - Responses to paths starting with any of these prefixes are never cached by browsers or proxies (Cache-Control: no-store), as they carry tokens or user claims (RFC 6749 section 5.1)
+	NoStorePaths []string `mapstructure:"no_store_paths"`
+
+	// BodyLimit - The largest request body in bytes that is accepted, except on the paths that stream their bodies (bulk imports)
+	BodyLimit int `mapstructure:"body_limit"`
+}
+
+/*
+StrictTransportSecurity - Returns the value of the Strict-Transport-Security header, or an empty string if HSTS is
+disabled
+*/
+func (config *SecurityConfig) StrictTransportSecurity() string {
+	if config.HSTSMaxAge <= 0 {
+		return ""
+	}
+
+	directives := []string{"max-age=" + strconv.FormatInt(int64(config.HSTSMaxAge.Seconds()), 10)}
+
+	if config.HSTSIncludeSubdomains {
+		directives = append(directives, "includeSubDomains")
+	}
+
+	if config.HSTSPreload {
+		directives = append(directives, "preload")
+	}
+
+	return strings.Join(directives, "; ")
+}
+
+/*
+NoStore - Determines if responses to the request path provided in the parameter must never be cached, as it starts with
+one of NoStorePaths
+*/
+func (config *SecurityConfig) NoStore(path string) bool {
+	for _, prefix := range config.NoStorePaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DefaultSecurityConfig Initializes the SecurityConfig structure with sane defaults
+func DefaultSecurityConfig() SecurityConfig {
+	return SecurityConfig{
+		Headers:               true,
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		HSTSPreload:           false,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		NoStorePaths: []string{
+			"/oauth/token",
+			"/oauth/refresh",
+			"/oauth/userinfo",
+			"/oauth/introspect",
+			"/oauth/device/code",
+			"/oauth/bc-authorize",
+		},
+		BodyLimit: 4 * 1024 * 1024,
+	}
+}
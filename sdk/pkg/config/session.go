@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+type SessionConfig struct {
+	// IdleTimeout - How long a session stays active without being used before the user must log in again. Zero disables the idle timeout
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+
+	// AbsoluteTimeout - How long a session stays active after the user logged in, regardless of how often it is used. Zero disables sessions
+	AbsoluteTimeout time.Duration `mapstructure:"absolute_timeout"`
+}
+
+// DefaultSessionConfig Initializes the SessionConfig structure with sane defaults
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		IdleTimeout:     time.Hour,
+		AbsoluteTimeout: 8 * time.Hour,
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import "time"
+
+type SIEMExporterConfig struct {
+	// Name - A unique name for the exporter. Used when logging export failures
+	Name string `mapstructure:"name"`
+
+	// Type - The type of SIEM that events are shipped to. Can be: splunk, elastic
+	Type string `mapstructure:"type"`
+
+	// Endpoint - The base URL of the SIEM (https://splunk.example.com:8088, https://elastic.example.com:9200)
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Token - The HEC token (splunk) or API key (elastic) used for authenticating with the SIEM
+	Token string `mapstructure:"token"`
+
+	// Index - The index that events are written to. Optional for splunk, required for elastic
+	Index string `mapstructure:"index"`
+
+	// SourceType - The sourcetype attached to events sent to splunk. Ignored by other exporters
+	SourceType string `mapstructure:"source_type"`
+
+	// EventTypes - Prefixes of the event types that should be exported (user., token.issued). If empty, all events are exported
+	EventTypes []string `mapstructure:"event_types"`
+
+	// BatchSize - The maximum number of events sent in a single request
+	BatchSize int `mapstructure:"batch_size"`
+
+	// FlushInterval - The maximum amount of time an event is buffered before it is sent
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+
+	// MaxRetries - The number of times a failed batch is retried before it is dropped
+	MaxRetries int `mapstructure:"max_retries"`
+
+	// Timeout - The timeout applied to each request made to the SIEM
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type SIEMConfig struct {
+	// QueueSize - The number of events that can be buffered per exporter before new events are dropped
+	QueueSize int `mapstructure:"queue_size"`
+
+	// Exporters - The SIEM exporters that events are shipped to
+	Exporters []SIEMExporterConfig `mapstructure:"exporters"`
+}
+
+// DefaultSIEMConfig Initializes the SIEMConfig structure with sane defaults
+func DefaultSIEMConfig() SIEMConfig {
+	return SIEMConfig{
+		QueueSize: 10000,
+		Exporters: []SIEMExporterConfig{},
+	}
+}
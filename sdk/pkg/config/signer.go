@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+const (
+	// SignerBackendLocal - Signing keys are generated by credstack, and their key material is stored in the database
+	SignerBackendLocal = "local"
+
+	// SignerBackendVault - Signing keys are generated in, and tokens are signed by, the transit secrets engine of HashiCorp Vault
+	SignerBackendVault = "vault"
+
+	// SignerBackendAWSKMS - Signing keys are generated in, and tokens are signed by, AWS KMS
+	SignerBackendAWSKMS = "aws_kms"
+
+	// SignerBackendGCPKMS - Signing keys are generated in, and tokens are signed by, Google Cloud KMS
+	SignerBackendGCPKMS = "gcp_kms"
+
+	// SignerBackendPKCS11 - Signing keys are generated in, and tokens are signed by, an HSM through its PKCS#11 module
+	SignerBackendPKCS11 = "pkcs11"
+)
+
+// ErrInvalidSignerConfig - Provides a named error for when an external signing backend is selected without the options it requires
+var ErrInvalidSignerConfig = credstackError.NewError(500, "ERR_INVALID_SIGNER_CONFIG", "config: The signing backend is missing a required option")
+
+/*
+SignerConfig - Options for the backend that signing keys live in. With an external backend, new RS256 and ES256 keys are
+generated in the backend and tokens are signed by calling it, so their private half never has to be stored in the
+database. Only the public half is stored, and published in the JWKS. Keys that were generated before the backend was
+changed keep signing with the backend they were generated with until they are rotated out
+*/
+type SignerConfig struct {
+	// Backend - The backend new signing keys are generated in. Can be: local (default), vault, aws_kms, gcp_kms, pkcs11
+	Backend string `mapstructure:"backend"`
+
+	// Timeout - How long a single request to an external backend can take
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// Vault - Options for the vault backend
+	Vault VaultSignerConfig `mapstructure:"vault"`
+
+	// AWSKMS - Options for the aws_kms backend
+	AWSKMS AWSKMSSignerConfig `mapstructure:"aws_kms"`
+
+	// GCPKMS - Options for the gcp_kms backend
+	GCPKMS GCPKMSSignerConfig `mapstructure:"gcp_kms"`
+
+	// PKCS11 - Options for the pkcs11 backend
+	PKCS11 PKCS11SignerConfig `mapstructure:"pkcs11"`
+}
+
+/*
+VaultSignerConfig - Options for signing with the transit secrets engine of HashiCorp Vault. A transit key is created for
+every algorithm and audience, and rotating a signing key rotates its transit key
+*/
+type VaultSignerConfig struct {
+	// Address - The address of the Vault server (https://vault.example.com:8200)
+	Address string `mapstructure:"address"`
+
+	// Token - The token credstack authenticates with. It must be allowed to create, rotate and read keys under KeyPrefix, and to sign with them
+	Token string `mapstructure:"token"`
+
+	// Namespace - The Vault Enterprise namespace the transit secrets engine is mounted in. Optional
+	Namespace string `mapstructure:"namespace"`
+
+	// MountPath - The path the transit secrets engine is mounted at
+	MountPath string `mapstructure:"mount_path"`
+
+	// KeyPrefix - The prefix of the names of the transit keys credstack creates
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+/*
+AWSKMSSignerConfig - Options for signing with AWS KMS. A KMS key is created for every signing key, and is scheduled for
+deletion once the signing key is retired
+*/
+type AWSKMSSignerConfig struct {
+	// Region - The AWS region KMS keys are created in
+	Region string `mapstructure:"region"`
+
+	// Endpoint - Overrides the KMS endpoint of the region, for VPC endpoints and local emulators. Optional
+	Endpoint string `mapstructure:"endpoint"`
+
+	// AccessKeyId - The access key ID credstack authenticates with. If empty, then credentials are resolved by the default credential chain of the AWS SDK (environment variables, shared config and SSO, web identity, and instance roles)
+	AccessKeyId string `mapstructure:"access_key_id"`
+
+	// SecretAccessKey - The secret access key credstack authenticates with. Only used if AccessKeyId is set
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+
+	// SessionToken - The session token of temporary credentials. Only used if AccessKeyId is set
+	SessionToken string `mapstructure:"session_token"`
+
+	// PendingWindowDays - How many days a KMS key is kept for after it is scheduled for deletion. Must be between 7 and 30
+	PendingWindowDays int `mapstructure:"pending_window_days"`
+}
+
+/*
+GCPKMSSignerConfig - Options for signing with Google Cloud KMS. A crypto key is created in the key ring for every
+algorithm and audience, and rotating a signing key adds a version to its crypto key
+*/
+type GCPKMSSignerConfig struct {
+	// KeyRing - The resource name of the key ring crypto keys are created in (projects/<project>/locations/<location>/keyRings/<key ring>)
+	KeyRing string `mapstructure:"key_ring"`
+
+	// CredentialsFile - The path of the credentials file credstack authenticates with, such as the JSON key of a service account. If empty, then the application default credentials are used, which include the service account of the instance through the metadata server
+	CredentialsFile string `mapstructure:"credentials_file"`
+
+	// Endpoint - Overrides the Cloud KMS endpoint, for private service connect endpoints. Optional
+	Endpoint string `mapstructure:"endpoint"`
+
+	// KeyPrefix - The prefix of the IDs of the crypto keys credstack creates
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+/*
+PKCS11SignerConfig - Options for signing with an HSM through its PKCS#11 module. A key pair is generated on the token in
+the slot for every signing key, and is destroyed once the signing key is retired. The module is loaded with cgo, so this
+backend is only available in builds with cgo enabled
+*/
+type PKCS11SignerConfig struct {
+	// ModulePath - The path of the PKCS#11 module (shared library) of the HSM
+	ModulePath string `mapstructure:"module_path"`
+
+	// Slot - The ID of the slot holding the token that keys are generated on
+	Slot uint `mapstructure:"slot"`
+
+	// Pin - The user PIN credstack logs in to the token with
+	Pin string `mapstructure:"pin"`
+
+	// KeyPrefix - The prefix of the labels of the keys credstack generates
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+/*
+Validate - Ensures that the selected backend has the options it requires to reach the backend, so that a missing option is
+surfaced when the server starts instead of when the first key is generated
+*/
+func (config *SignerConfig) Validate() error {
+	switch config.Backend {
+	case SignerBackendLocal:
+		return nil
+	case SignerBackendVault:
+		if config.Vault.Address == "" || config.Vault.MountPath == "" {
+			return fmt.Errorf("%w (vault requires address and mount_path)", ErrInvalidSignerConfig)
+		}
+	case SignerBackendAWSKMS:
+		if config.AWSKMS.Region == "" {
+			return fmt.Errorf("%w (aws_kms requires region)", ErrInvalidSignerConfig)
+		}
+
+		if config.AWSKMS.PendingWindowDays < 7 || config.AWSKMS.PendingWindowDays > 30 {
+			return fmt.Errorf("%w (aws_kms pending_window_days must be between 7 and 30)", ErrInvalidSignerConfig)
+		}
+	case SignerBackendGCPKMS:
+		if !strings.HasPrefix(config.GCPKMS.KeyRing, "projects/") || !strings.Contains(config.GCPKMS.KeyRing, "/keyRings/") {
+			return fmt.Errorf("%w (gcp_kms requires the resource name of a key_ring)", ErrInvalidSignerConfig)
+		}
+	case SignerBackendPKCS11:
+		if config.PKCS11.ModulePath == "" || config.PKCS11.Pin == "" {
+			return fmt.Errorf("%w (pkcs11 requires module_path and pin)", ErrInvalidSignerConfig)
+		}
+	default:
+		return fmt.Errorf("%w (unknown backend %q)", ErrInvalidSignerConfig, config.Backend)
+	}
+
+	if config.Timeout <= 0 {
+		return fmt.Errorf("%w (timeout must be greater than zero)", ErrInvalidSignerConfig)
+	}
+
+	return nil
+}
+
+// DefaultSignerConfig Initializes the SignerConfig structure with sane defaults
+func DefaultSignerConfig() SignerConfig {
+	return SignerConfig{
+		Backend: SignerBackendLocal,
+		Timeout: 10 * time.Second,
+		Vault: VaultSignerConfig{
+			MountPath: "transit",
+			KeyPrefix: "credstack-",
+		},
+		AWSKMS: AWSKMSSignerConfig{
+			PendingWindowDays: 30,
+		},
+		GCPKMS: GCPKMSSignerConfig{
+			Endpoint:  "https://cloudkms.googleapis.com",
+			KeyPrefix: "credstack-",
+		},
+		PKCS11: PKCS11SignerConfig{
+			KeyPrefix: "credstack-",
+		},
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"net/url"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidTelemetryConfig - Provides a named error for when telemetry is enabled without an absolute endpoint, or with an interval shorter than an hour
+var ErrInvalidTelemetryConfig = credstackError.NewError(500, "ERR_INVALID_TELEMETRY_CONFIG", "config: Telemetry requires an absolute endpoint and an interval of at least an hour")
+
+/*
+TelemetryConfig - Options for reporting anonymous, aggregate usage to the credstack maintainers. Telemetry is opt-in: it
+is disabled unless Enabled is set, and nothing is ever sent while it is disabled. The exact document that would be sent
+can be previewed from the management API at any time, whether telemetry is enabled or not
+*/
+type TelemetryConfig struct {
+	// Enabled - If set to true, a report is sent to the endpoint once every interval. Defaults to false
+	Enabled bool `mapstructure:"enabled"`
+
+	// Endpoint - The URL reports are sent to with a POST request
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Interval - How often a report is sent. Must be at least an hour
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+/*
+Validate - Ensures that an absolute endpoint is configured when telemetry is enabled, and that reports are not sent more
+than once an hour. Nothing is validated while telemetry is disabled
+*/
+func (config *TelemetryConfig) Validate() error {
+	if !config.Enabled {
+		return nil
+	}
+
+	parsed, err := url.Parse(config.Endpoint)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return ErrInvalidTelemetryConfig
+	}
+
+	if config.Interval < time.Hour {
+		return ErrInvalidTelemetryConfig
+	}
+
+	return nil
+}
+
+// DefaultTelemetryConfig Initializes the TelemetryConfig structure with sane defaults
+func DefaultTelemetryConfig() TelemetryConfig {
+	return TelemetryConfig{
+		Enabled:  false,
+		Endpoint: "",
+		Interval: 24 * time.Hour,
+	}
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/gofiber/fiber/v3"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// ClientAuthNone - Client certificates are never requested
+	ClientAuthNone string = "none"
+
+	// ClientAuthRequest - Client certificates are requested but not verified against a CA, so that self-signed certificates registered on clients can be presented
+	ClientAuthRequest string = "request"
+
+	// ClientAuthOptional - Client certificates are requested, and verified against ClientCAFile if one is presented
+	ClientAuthOptional string = "optional"
+
+	// ClientAuthRequire - Every connection must present a client certificate that verifies against ClientCAFile
+	ClientAuthRequire string = "require"
+)
+
+// ErrInvalidTLSConfig - Provides a named error for when the TLS options of the API listener are incomplete or conflict with each other
+var ErrInvalidTLSConfig = credstackError.NewError(500, "ERR_INVALID_TLS_CONFIG", "config: The TLS options of the API listener are invalid")
+
+/*
+tlsVersions - The minimum TLS versions that can be configured. Fiber refuses to serve anything older than TLS 1.2
+*/
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+/*
+TLSConfig - Options for serving the API over TLS. A certificate is either loaded from CertFile and KeyFile, or issued
+automatically with ACME for ACMEDomains, never both. If neither is configured, the API is served over plain HTTP, as is
+expected when TLS is terminated by a load balancer
+*/
+type TLSConfig struct {
+	// CertFile - The path to a PEM encoded certificate chain to serve. Requires KeyFile
+	CertFile string `mapstructure:"cert_file"`
+
+	// KeyFile - The path to the PEM encoded private key of CertFile
+	KeyFile string `mapstructure:"key_file"`
+
+	// ACMEDomains - The domains to issue a certificate for automatically with ACME. Certificates are issued on the first connection for each domain, with the TLS-ALPN-01 challenge, so the API must be reachable on port 443
+	ACMEDomains []string `mapstructure:"acme_domains"`
+
+	// ACMEEmail - The contact email registered with the ACME certificate authority. Optional
+	ACMEEmail string `mapstructure:"acme_email"`
+
+	// ACMEDirectoryURL - The directory URL of the ACME certificate authority. Defaults to Let's Encrypt
+	ACMEDirectoryURL string `mapstructure:"acme_directory_url"`
+
+	// ACMECacheDir - The directory issued certificates and the ACME account key are stored in, so that they survive restarts. Must be shared by every replica
+	ACMECacheDir string `mapstructure:"acme_cache_dir"`
+
+	// MinVersion - The minimum TLS version that is negotiated. One of: 1.2, 1.3
+	MinVersion string `mapstructure:"min_version"`
+
+	// CipherSuites - The names of the cipher suites that can be negotiated with TLS 1.2 (TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256). TLS 1.3 cipher suites are not configurable. Defaults to the Go defaults
+	CipherSuites []string `mapstructure:"cipher_suites"`
+
+	// ClientAuth - If client certificates are requested for mutual TLS. One of: none, request, optional, require
+	ClientAuth string `mapstructure:"client_auth"`
+
+	// ClientCAFile - The path to the PEM encoded certificate authorities that client certificates are verified against. Required when ClientAuth is optional or require
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+/*
+Enabled - Determines if the API is served over TLS, either with a certificate from disk or one issued with ACME
+*/
+func (config *TLSConfig) Enabled() bool {
+	return config.CertFile != "" || len(config.ACMEDomains) != 0
+}
+
+/*
+Validate - Ensures that a certificate is configured from exactly one source, that the minimum version, cipher suites,
+and client authentication mode are known, and that mutual TLS has a CA to verify client certificates against
+*/
+func (config *TLSConfig) Validate() error {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return fmt.Errorf("%w (cert_file and key_file must be set together)", ErrInvalidTLSConfig)
+	}
+
+	if config.CertFile != "" && len(config.ACMEDomains) != 0 {
+		return fmt.Errorf("%w (cert_file and acme_domains cannot be set together)", ErrInvalidTLSConfig)
+	}
+
+	if len(config.ACMEDomains) != 0 && config.ACMECacheDir == "" {
+		return fmt.Errorf("%w (acme_domains requires acme_cache_dir)", ErrInvalidTLSConfig)
+	}
+
+	if _, ok := tlsVersions[config.MinVersion]; !ok {
+		return fmt.Errorf("%w (unsupported min_version %s)", ErrInvalidTLSConfig, config.MinVersion)
+	}
+
+	_, err := cipherSuiteIds(config.CipherSuites)
+	if err != nil {
+		return err
+	}
+
+	switch config.ClientAuth {
+	case ClientAuthNone:
+		return nil
+	case ClientAuthRequest:
+	case ClientAuthOptional, ClientAuthRequire:
+		if config.ClientCAFile == "" {
+			return fmt.Errorf("%w (client_auth %s requires client_ca_file)", ErrInvalidTLSConfig, config.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("%w (unsupported client_auth %s)", ErrInvalidTLSConfig, config.ClientAuth)
+	}
+
+	if !config.Enabled() {
+		return fmt.Errorf("%w (client_auth requires cert_file or acme_domains)", ErrInvalidTLSConfig)
+	}
+
+	return nil
+}
+
+/*
+Apply - Configures the fiber.ListenConfig provided in the parameter to serve over TLS with these options. The client CA
+file is read here, so that a missing file fails the start of the API instead of every handshake. If TLS is not enabled,
+then the listener is left unchanged
+*/
+func (config *TLSConfig) Apply(listenConfig *fiber.ListenConfig) error {
+	if !config.Enabled() {
+		return nil
+	}
+
+	cipherSuites, err := cipherSuiteIds(config.CipherSuites)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if config.ClientCAFile != "" {
+		contents, err := os.ReadFile(filepath.Clean(config.ClientCAFile))
+		if err != nil {
+			return fmt.Errorf("%w (%v)", ErrInvalidTLSConfig, err)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(contents) {
+			return fmt.Errorf("%w (client_ca_file contains no PEM encoded certificates)", ErrInvalidTLSConfig)
+		}
+	}
+
+	if config.CertFile != "" {
+		listenConfig.CertFile = config.CertFile
+		listenConfig.CertKeyFile = config.KeyFile
+	} else {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(config.ACMECacheDir),
+			HostPolicy: autocert.HostWhitelist(config.ACMEDomains...),
+			Email:      config.ACMEEmail,
+		}
+
+		if config.ACMEDirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: config.ACMEDirectoryURL}
+		}
+
+		listenConfig.AutoCertManager = manager
+	}
+
+	listenConfig.TLSMinVersion = tlsVersions[config.MinVersion]
+	listenConfig.TLSConfigFunc = func(tlsConfig *tls.Config) {
+		tlsConfig.CipherSuites = cipherSuites
+		tlsConfig.ClientCAs = clientCAs
+
+		switch config.ClientAuth {
+		case ClientAuthRequest:
+			tlsConfig.ClientAuth = tls.RequestClientCert
+		case ClientAuthOptional:
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		case ClientAuthRequire:
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return nil
+}
+
+/*
+cipherSuiteIds - Resolves the names of the cipher suites provided in the parameter to their IDs. Only the cipher suites
+Go considers secure can be configured. If no names are provided, then nil is returned so that the Go defaults are used
+*/
+func cipherSuiteIds(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ret := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("%w (unsupported cipher suite %s)", ErrInvalidTLSConfig, name)
+		}
+
+		ret = append(ret, id)
+	}
+
+	return ret, nil
+}
+
+// DefaultTLSConfig Initializes the TLSConfig structure with sane defaults
+func DefaultTLSConfig() TLSConfig {
+	return TLSConfig{
+		CertFile:     "",
+		KeyFile:      "",
+		ACMEDomains:  []string{},
+		ACMECacheDir: "",
+		MinVersion:   "1.2",
+		CipherSuites: []string{},
+		ClientAuth:   ClientAuthNone,
+	}
+}
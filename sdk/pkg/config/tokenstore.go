@@ -0,0 +1,67 @@
+package config
+
+import (
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+const (
+	// TokenStoreModeSync - Tokens are written to the database before they are returned to the caller
+	TokenStoreModeSync string = "sync"
+
+	// TokenStoreModeWriteBehind - Tokens are queued and written to the database in batches after they are returned to the caller
+	TokenStoreModeWriteBehind string = "write_behind"
+)
+
+// ErrInvalidTokenStoreMode - Provides a named error for when the token store mode is not one of: sync, write_behind
+var ErrInvalidTokenStoreMode = credstackError.NewError(500, "ERR_INVALID_TOKEN_STORE_MODE", "config: token_store.mode must be one of: sync, write_behind")
+
+// ErrInvalidTokenStoreQueue - Provides a named error for when the queue options cannot be used in write_behind mode
+var ErrInvalidTokenStoreQueue = credstackError.NewError(500, "ERR_INVALID_TOKEN_STORE_QUEUE", "config: token_store.queue_size, batch_size, and flush_interval must be greater than zero in write_behind mode")
+
+type TokenStoreConfig struct {
+	// Mode - How issued tokens are persisted. Can be: sync (default), write_behind. Deployments that rely on revocation or introspection of freshly issued tokens should use sync
+	Mode string `mapstructure:"mode"`
+
+	// QueueSize - The number of tokens that can be queued in write_behind mode. When the queue is full, tokens are written synchronously instead
+	QueueSize int `mapstructure:"queue_size"`
+
+	// BatchSize - The maximum number of tokens written to the database in a single call
+	BatchSize int `mapstructure:"batch_size"`
+
+	// FlushInterval - The maximum amount of time a token is queued before it is written
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+
+	// MaxRetries - The number of times a failed batch is retried before it is dropped
+	MaxRetries int `mapstructure:"max_retries"`
+}
+
+/*
+Validate - Ensures that the token store mode is known, and that the queue options are usable in write_behind mode
+*/
+func (config TokenStoreConfig) Validate() error {
+	switch config.Mode {
+	case TokenStoreModeSync:
+		return nil
+	case TokenStoreModeWriteBehind:
+		if config.QueueSize <= 0 || config.BatchSize <= 0 || config.FlushInterval <= 0 {
+			return ErrInvalidTokenStoreQueue
+		}
+
+		return nil
+	default:
+		return ErrInvalidTokenStoreMode
+	}
+}
+
+// DefaultTokenStoreConfig Initializes the TokenStoreConfig structure with sane defaults
+func DefaultTokenStoreConfig() TokenStoreConfig {
+	return TokenStoreConfig{
+		Mode:          TokenStoreModeSync,
+		QueueSize:     10000,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		MaxRetries:    3,
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidTracingConfig - Provides a named error for when tracing is enabled without an exporter endpoint, or with a sample ratio outside of 0 and 1
+var ErrInvalidTracingConfig = credstackError.NewError(500, "ERR_INVALID_TRACING_CONFIG", "config: Tracing requires an OTLP endpoint and a sample ratio between 0 and 1")
+
+/*
+TracingConfig - Options for exporting OpenTelemetry traces of API requests, database commands, and the token issuance
+pipeline, along with metrics such as the depth of the token write-behind queue. Both are exported with OTLP over HTTP.
+The standard OTEL_EXPORTER_OTLP_* environment variables are honoured for anything that is not configured here
+*/
+type TracingConfig struct {
+	// Enabled - If set to true, spans and metrics are recorded and exported to Endpoint. Incoming traceparent headers are only honoured when tracing is enabled
+	Enabled bool `mapstructure:"enabled"`
+
+	// Endpoint - The host and port of the OTLP/HTTP collector that spans and metrics are exported to (localhost:4318)
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Insecure - If set to true, spans and metrics are exported over plain HTTP instead of HTTPS
+	Insecure bool `mapstructure:"insecure"`
+
+	// Headers - Headers sent with every export, such as the API key of a hosted collector
+	Headers map[string]string `mapstructure:"headers"`
+
+	// ServiceName - The service.name resource attribute that spans and metrics are exported with
+	ServiceName string `mapstructure:"service_name"`
+
+	// SampleRatio - The fraction of traces started by credstack that are recorded, from 0 to 1. Requests that carry a traceparent header follow the sampling decision of their caller
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+/*
+Validate - Ensures that an endpoint is configured when tracing is enabled, and that the sample ratio is between 0 and 1
+*/
+func (config *TracingConfig) Validate() error {
+	if !config.Enabled {
+		return nil
+	}
+
+	if config.Endpoint == "" || config.SampleRatio < 0 || config.SampleRatio > 1 {
+		return ErrInvalidTracingConfig
+	}
+
+	return nil
+}
+
+// DefaultTracingConfig Initializes the TracingConfig structure with sane defaults
+func DefaultTracingConfig() TracingConfig {
+	return TracingConfig{
+		Enabled:     false,
+		Endpoint:    "localhost:4318",
+		Insecure:    false,
+		Headers:     map[string]string{},
+		ServiceName: "credstack",
+		SampleRatio: 1,
+	}
+}
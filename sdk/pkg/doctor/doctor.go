@@ -0,0 +1,428 @@
+package doctor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/secretref"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Status - The outcome of a single check, or of the report as a whole
+type Status string
+
+const (
+	// StatusPass - The check passed
+	StatusPass Status = "pass"
+
+	// StatusWarn - The check passed, but found something that should be looked at
+	StatusWarn Status = "warn"
+
+	// StatusFail - The check failed. The deployment is not healthy
+	StatusFail Status = "fail"
+
+	// StatusSkip - The check could not be run, as a check it depends on failed
+	StatusSkip Status = "skip"
+)
+
+const (
+	// skewWarnThreshold - Clock skew above this is reported as a warning. Most validators allow a small amount of leeway
+	skewWarnThreshold = 5 * time.Second
+
+	// skewFailThreshold - Clock skew above this is reported as a failure, as tokens will be rejected as not yet valid or expired
+	skewFailThreshold = time.Minute
+
+	// roundTripIssuer - The issuer inserted into the tokens signed by the round trip check. These tokens are never stored
+	roundTripIssuer = "credstack-doctor"
+)
+
+/*
+Check - The outcome of a single diagnostic check
+*/
+type Check struct {
+	// Name - A short, stable identifier for the check (database.connectivity)
+	Name string `json:"name" yaml:"name"`
+
+	// Status - The outcome of the check
+	Status Status `json:"status" yaml:"status"`
+
+	// Message - A human-readable summary of the outcome
+	Message string `json:"message" yaml:"message"`
+
+	// Details - One entry for every individual problem the check found. Empty if the check passed
+	Details []string `json:"details" yaml:"details"`
+}
+
+/*
+Report - The outcome of every diagnostic check. Checks are always reported in the same order
+*/
+type Report struct {
+	// Status - The worst status of any check. Skipped checks are not considered
+	Status Status `json:"status" yaml:"status"`
+
+	// Checks - The outcome of every check that was run
+	Checks []Check `json:"checks" yaml:"checks"`
+}
+
+/*
+add - Appends a check to the report and updates the status of the report
+*/
+func (report *Report) add(check Check) {
+	if check.Details == nil {
+		check.Details = []string{}
+	}
+
+	report.Checks = append(report.Checks, check)
+
+	switch {
+	case check.Status == StatusFail:
+		report.Status = StatusFail
+	case check.Status == StatusWarn && report.Status != StatusFail:
+		report.Status = StatusWarn
+	}
+}
+
+/*
+Run - Diagnoses the deployment described by the server provided in the parameter. The config is validated first and its
+secret references are resolved, then the database is connected to and its indexes, the clock skew between this host and MongoDB, every stored signing key,
+and signing and verifying a token with every current key are checked.
+
+Run connects to the database itself, so the server should not be started beforehand. The database is disconnected
+before Run returns. Checks that depend on the database are skipped if it cannot be reached
+*/
+func Run(serv *server.Server) *Report {
+	report := &Report{Status: StatusPass, Checks: make([]Check, 0)}
+
+	report.add(checkConfig(serv))
+	report.add(checkSecrets(serv))
+
+	connectivity := checkConnectivity(serv)
+	report.add(connectivity)
+
+	if connectivity.Status == StatusFail {
+		for _, name := range []string{"database.indexes", "clock.skew", "keys.validity", "keys.round_trip"} {
+			report.add(Check{Name: name, Status: StatusSkip, Message: "Skipped as the database could not be reached"})
+		}
+
+		return report
+	}
+
+	defer func() { _ = serv.Database().Disconnect() }()
+
+	report.add(checkIndexes(serv))
+	report.add(checkClockSkew(serv))
+
+	keys, err := jwk.ListPrivateKeys(serv)
+	if err != nil {
+		report.add(Check{Name: "keys.validity", Status: StatusFail, Message: "Failed to list signing keys", Details: []string{err.Error()}})
+		report.add(Check{Name: "keys.round_trip", Status: StatusSkip, Message: "Skipped as the signing keys could not be listed"})
+
+		return report
+	}
+
+	report.add(checkKeys(serv, keys))
+	report.add(checkRoundTrip(serv, keys))
+
+	return report
+}
+
+/*
+checkConfig - Validates the config, and warns about settings that are valid but should not be used in production
+*/
+func checkConfig(serv *server.Server) Check {
+	check := Check{Name: "config"}
+
+	err := serv.Config.Validate()
+	if err != nil {
+		check.Status = StatusFail
+		check.Message = "The config failed validation"
+		check.Details = []string{err.Error()}
+
+		return check
+	}
+
+	if !serv.Config.DatabaseConfig.UseAuthentication {
+		check.Details = append(check.Details, "database.use_authentication is disabled, so credstack connects to MongoDB without credentials")
+	}
+
+	if serv.Config.ApiConfig.Debug {
+		check.Details = append(check.Details, "api.debug is enabled, which relaxes routing and should not be used in production")
+	}
+
+	if serv.Config.ApiConfig.SkipPreflight {
+		check.Details = append(check.Details, "api.skip_preflight is enabled, so missing collections and indexes are not created at startup")
+	}
+
+	if len(check.Details) != 0 {
+		check.Status = StatusWarn
+		check.Message = fmt.Sprintf("The config is valid, but %d setting(s) should be reviewed", len(check.Details))
+
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = "The config is valid"
+
+	return check
+}
+
+/*
+checkSecrets - Resolves every secret reference in the config, so that the remaining checks are made with the secrets they
+refer to. This is skipped if the config does not contain any references
+*/
+func checkSecrets(serv *server.Server) Check {
+	check := Check{Name: "secrets"}
+
+	references := 0
+	for _, value := range serv.Config.SecretFields() {
+		if secretref.IsReference(*value) {
+			references++
+		}
+	}
+
+	if references == 0 {
+		check.Status = StatusSkip
+		check.Message = "The config does not contain any secret references"
+
+		return check
+	}
+
+	err := serv.ResolveSecrets()
+	if err != nil {
+		check.Status = StatusFail
+		check.Message = "Failed to resolve secret references"
+		check.Details = []string{err.Error()}
+
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = fmt.Sprintf("Resolved %d secret reference(s)", references)
+
+	return check
+}
+
+/*
+checkConnectivity - Connects to the database, and ensures that the primary can be reached
+*/
+func checkConnectivity(serv *server.Server) Check {
+	check := Check{Name: "database.connectivity"}
+
+	config := serv.Config.DatabaseConfig
+
+	err := serv.Database().Connect()
+	if err != nil {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("Failed to connect to MongoDB at %s:%d", config.Hostname, config.Port)
+		check.Details = []string{err.Error()}
+
+		return check
+	}
+
+	latency, err := serv.Database().Ping()
+	if err != nil {
+		_ = serv.Database().Disconnect() // the remaining checks are skipped, so Run never disconnects
+		check.Status = StatusFail
+		check.Message = "Connected to MongoDB, but the primary could not be reached"
+		check.Details = []string{err.Error()}
+
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = fmt.Sprintf("Connected to MongoDB at %s:%d (%s round trip)", config.Hostname, config.Port, latency.Round(time.Millisecond))
+
+	return check
+}
+
+/*
+checkIndexes - Ensures that every collection has the unique index that PreFlight creates on it
+*/
+func checkIndexes(serv *server.Server) Check {
+	check := Check{Name: "database.indexes"}
+
+	missing := serv.Database().MissingIndexes()
+	if len(missing) == 0 {
+		check.Status = StatusPass
+		check.Message = "Every required index exists"
+
+		return check
+	}
+
+	for collection, err := range missing {
+		check.Details = append(check.Details, fmt.Sprintf("%s: %v", collection, err))
+	}
+
+	sort.Strings(check.Details)
+
+	check.Status = StatusFail
+	check.Message = fmt.Sprintf("%d collection(s) are missing their unique index. Start the API without api.skip_preflight to create them", len(missing))
+
+	return check
+}
+
+/*
+checkClockSkew - Compares the local clock to the clock of the MongoDB server. The server's clock stands in for the rest
+of the deployment, as a skewed clock here will cause tokens to be rejected by validators with correct clocks
+*/
+func checkClockSkew(serv *server.Server) Check {
+	check := Check{Name: "clock.skew"}
+
+	before := serv.Clock().Now()
+
+	serverTime, err := serv.Database().ServerTime()
+	if err != nil {
+		check.Status = StatusFail
+		check.Message = "Failed to read the time from MongoDB"
+		check.Details = []string{err.Error()}
+
+		return check
+	}
+
+	/*
+		The server's time is compared to the midpoint of the round trip, so that network latency is not counted as skew
+	*/
+	local := before.Add(serv.Clock().Now().Sub(before) / 2)
+	skew := local.Sub(serverTime)
+	if skew < 0 {
+		skew = -skew
+	}
+
+	message := fmt.Sprintf("The local clock is %s from MongoDB", skew.Round(time.Millisecond))
+
+	switch {
+	case skew > skewFailThreshold:
+		check.Status = StatusFail
+		check.Message = message + ". Tokens will be rejected as expired or not yet valid. Synchronize the clock with NTP"
+	case skew > skewWarnThreshold:
+		check.Status = StatusWarn
+		check.Message = message + ". Validators with little leeway may reject tokens"
+	default:
+		check.Status = StatusPass
+		check.Message = message
+	}
+
+	return check
+}
+
+/*
+checkKeys - Parses every stored signing key, and ensures that it matches the public key published in the JWKS under its
+kid. A key that is not published cannot be used to verify tokens, and a key that fails to parse cannot sign them
+*/
+func checkKeys(serv *server.Server, keys []*jwk.PrivateJSONWebKey) Check {
+	check := Check{Name: "keys.validity"}
+
+	for _, key := range keys {
+		kid := key.Header.Identifier
+
+		public, err := jwk.Get(serv, kid)
+		if err != nil {
+			check.Details = append(check.Details, fmt.Sprintf("%s (%s, %s): not published in the JWKS (%v)", kid, key.Alg, key.Audience, err))
+			continue
+		}
+
+		err = key.Verify(serv, public)
+		if err != nil {
+			check.Details = append(check.Details, fmt.Sprintf("%s (%s, %s): %v", kid, key.Alg, key.Audience, err))
+		}
+	}
+
+	if len(check.Details) != 0 {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%d of %d signing key(s) are invalid", len(check.Details), len(keys))
+
+		return check
+	}
+
+	if len(keys) == 0 {
+		check.Status = StatusWarn
+		check.Message = "No signing keys exist yet. They are generated when the first resource server is created"
+
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = fmt.Sprintf("All %d signing key(s) are valid", len(keys))
+
+	return check
+}
+
+/*
+checkRoundTrip - Signs a token with every current key, then verifies it exactly as a relying party would: by finding the
+public key in the JWKS using the kid in the token's header. The tokens are never stored
+*/
+func checkRoundTrip(serv *server.Server, keys []*jwk.PrivateJSONWebKey) Check {
+	check := Check{Name: "keys.round_trip"}
+
+	tested := 0
+	for _, key := range keys {
+		if !key.IsCurrent {
+			continue
+		}
+
+		tested++
+
+		err := roundTrip(serv, key)
+		if err != nil {
+			check.Details = append(check.Details, fmt.Sprintf("%s (%s, %s): %v", key.Header.Identifier, key.Alg, key.Audience, err))
+		}
+	}
+
+	if len(check.Details) != 0 {
+		check.Status = StatusFail
+		check.Message = fmt.Sprintf("%d of %d current key(s) failed to sign and verify a token", len(check.Details), tested)
+
+		return check
+	}
+
+	if tested == 0 {
+		check.Status = StatusSkip
+		check.Message = "No current signing keys to test"
+
+		return check
+	}
+
+	check.Status = StatusPass
+	check.Message = fmt.Sprintf("Signed and verified a token with all %d current key(s)", tested)
+
+	return check
+}
+
+/*
+roundTrip - Signs a token with the key provided in the parameter, and verifies it against the JWKS
+*/
+func roundTrip(serv *server.Server, key *jwk.PrivateJSONWebKey) error {
+	claims := claim.NewClaims(serv.Clock(), roundTripIssuer, key.Audience, 60)
+
+	var signed *token.Token
+	var err error
+
+	switch key.Alg {
+	case "RS256":
+		signed, err = token.RS256(serv, key, claims, 60)
+	case "ES256":
+		signed, err = token.ES256(serv, key, claims, 60)
+	default:
+		return jwk.ErrUnsupportedKeyAlg
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = jwt.Parse(
+		signed.AccessToken,
+		jwk.Keyfunc(serv),
+		jwt.WithValidMethods([]string{key.Alg}),
+		jwt.WithAudience(key.Audience),
+		jwt.WithIssuer(roundTripIssuer),
+		jwt.WithTimeFunc(serv.Clock().Now),
+	)
+
+	return err
+}
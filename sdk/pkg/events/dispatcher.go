@@ -0,0 +1,274 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+// retryBackoff - The initial delay between retries of a failed delivery. This is doubled after every attempt
+const retryBackoff = time.Second
+
+/*
+DeadLetterHandler - A function that is called whenever an event could not be delivered to a webhook after exhausting its
+retries. This is used for recording the dead letter in the database, as the events package has no awareness of it
+*/
+type DeadLetterHandler func(letter DeadLetter)
+
+/*
+pipeline - Buffers and delivers events for a single webhook. Every webhook gets its own pipeline so that a slow or
+unavailable receiver does not delay delivery to the others
+*/
+type pipeline struct {
+	// config - The options for the webhook this pipeline feeds
+	config config.EventWebhookConfig
+
+	// client - The HTTP client deliveries are made with
+	client *http.Client
+
+	// clock - The clock deliveries are signed with
+	clock clock.Clock
+
+	// queue - Events waiting to be delivered
+	queue chan Event
+
+	// dropped - The number of events dropped because the queue was full
+	dropped atomic.Int64
+}
+
+/*
+Dispatcher - Fans out published events to every configured webhook. Publishing is non-blocking, and events are dropped
+(and counted) if a webhooks queue is full, as we never want webhook delivery to block token issuance or management calls
+*/
+type Dispatcher struct {
+	// pipelines - One pipeline per configured webhook
+	pipelines []*pipeline
+
+	// onDeadLetter - Called when an event could not be delivered after exhausting its retries
+	onDeadLetter DeadLetterHandler
+
+	// clock - The clock dead letters are timestamped with
+	clock clock.Clock
+
+	// wg - Tracks the running pipeline goroutines so that Stop can wait for them to drain
+	wg sync.WaitGroup
+
+	// lock - Held for reading while events are queued, and for writing while Stop closes the queues, so that an event is never sent on a closed queue
+	lock sync.RWMutex
+
+	// stopped - Set by Stop. Events published after this are dropped
+	stopped bool
+}
+
+/*
+Publish - Queues the event for every webhook whose filter matches it. Calling Publish on a nil Dispatcher is a no-op,
+so callers do not need to check if the server has been started. Events published after Stop has been called are
+dropped, as the server is shutting down
+*/
+func (dispatcher *Dispatcher) Publish(event Event) {
+	if dispatcher == nil {
+		return
+	}
+
+	dispatcher.lock.RLock()
+	defer dispatcher.lock.RUnlock()
+
+	if dispatcher.stopped {
+		return
+	}
+
+	for _, p := range dispatcher.pipelines {
+		if !matches(p.config, event) {
+			continue
+		}
+
+		select {
+		case p.queue <- event:
+		default:
+			p.dropped.Add(1)
+		}
+	}
+}
+
+/*
+Dropped - Returns the number of events that have been dropped for each webhook because its queue was full
+*/
+func (dispatcher *Dispatcher) Dropped() map[string]int64 {
+	ret := make(map[string]int64, len(dispatcher.pipelines))
+	for _, p := range dispatcher.pipelines {
+		ret[p.config.Name] = p.dropped.Load()
+	}
+
+	return ret
+}
+
+/*
+Start - Starts a goroutine for each webhook that delivers queued events
+*/
+func (dispatcher *Dispatcher) Start() {
+	for _, p := range dispatcher.pipelines {
+		dispatcher.wg.Add(1)
+		go dispatcher.run(p)
+	}
+}
+
+/*
+Stop - Closes every webhooks queue and waits for any queued events to be delivered. Calling Stop more than once is a
+no-op
+*/
+func (dispatcher *Dispatcher) Stop() {
+	dispatcher.lock.Lock()
+	if dispatcher.stopped {
+		dispatcher.lock.Unlock()
+		return
+	}
+
+	dispatcher.stopped = true
+	for _, p := range dispatcher.pipelines {
+		close(p.queue)
+	}
+	dispatcher.lock.Unlock()
+
+	dispatcher.wg.Wait()
+}
+
+/*
+run - Delivers queued events one at a time, in the order they were published
+*/
+func (dispatcher *Dispatcher) run(p *pipeline) {
+	defer dispatcher.wg.Done()
+
+	for event := range p.queue {
+		dispatcher.deliver(p, event)
+	}
+}
+
+/*
+deliver - Sends the event to the webhook, retrying with exponential backoff. If every attempt fails, then the dead letter
+handler is called with the error of the final attempt
+*/
+func (dispatcher *Dispatcher) deliver(p *pipeline, event Event) {
+	body, err := json.Marshal(&event)
+	if err != nil {
+		dispatcher.deadLetter(p, event, 0, err)
+		return
+	}
+
+	attempts := 0
+	backoff := retryBackoff
+	for attempt := 0; attempt <= p.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		attempts++
+
+		err = p.send(event, body)
+		if err == nil {
+			return
+		}
+	}
+
+	dispatcher.deadLetter(p, event, attempts, err)
+}
+
+/*
+deadLetter - Calls the dead letter handler for an event that could not be delivered
+*/
+func (dispatcher *Dispatcher) deadLetter(p *pipeline, event Event, attempts int, err error) {
+	if dispatcher.onDeadLetter == nil {
+		return
+	}
+
+	dispatcher.onDeadLetter(DeadLetter{
+		Webhook:  p.config.Name,
+		Event:    event,
+		Attempts: attempts,
+		Error:    err.Error(),
+		FailedAt: dispatcher.clock.Now().Unix(),
+	})
+}
+
+/*
+send - Makes a single signed delivery of the event to the webhook. Every status code other than 2xx is treated as a
+failure, so that the delivery is retried
+*/
+func (p *pipeline) send(event Event, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, p.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderDelivery, event.Id)
+	req.Header.Set(HeaderSignature, Sign(p.config.Secret, p.clock.Now(), body))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+/*
+matches - Determines if the event should be delivered according to the webhooks EventTypes filter. An empty filter
+matches every event
+*/
+func matches(config config.EventWebhookConfig, event Event) bool {
+	if len(config.EventTypes) == 0 {
+		return true
+	}
+
+	for _, prefix := range config.EventTypes {
+		if strings.HasPrefix(event.Type, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+NewDispatcher - Constructs a Dispatcher with a pipeline for each webhook defined in the config. An unset timeout on a
+webhook is replaced with a default. Deliveries and dead letters are timestamped with the clock provided in the
+parameter. Calling this function does not start delivery, this needs to be done post-construction with Dispatcher.Start
+*/
+func NewDispatcher(config config.EventsConfig, c clock.Clock, onDeadLetter DeadLetterHandler) *Dispatcher {
+	dispatcher := &Dispatcher{
+		pipelines:    make([]*pipeline, 0, len(config.Webhooks)),
+		onDeadLetter: onDeadLetter,
+		clock:        c,
+	}
+
+	for _, webhookConfig := range config.Webhooks {
+		if webhookConfig.Timeout <= 0 {
+			webhookConfig.Timeout = 10 * time.Second
+		}
+
+		dispatcher.pipelines = append(dispatcher.pipelines, &pipeline{
+			config: webhookConfig,
+			client: &http.Client{Timeout: webhookConfig.Timeout},
+			clock:  c,
+			queue:  make(chan Event, config.QueueSize),
+		})
+	}
+
+	return dispatcher
+}
@@ -0,0 +1,154 @@
+package events
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+)
+
+const (
+	// TypeUserRegistered - Published when a user registers. The data holds the identifier and email address of the user
+	TypeUserRegistered string = "user.registered"
+
+	// TypeUserDeleted - Published when a user is deleted. The data holds the email address of the user
+	TypeUserDeleted string = "user.deleted"
+
+	// TypeClientCreated - Published when a client is created. The data holds the client ID and name of the client. Canary clients are never published
+	TypeClientCreated string = "client.created"
+
+	// TypeTokenIssued - Published when a token is issued. The data describes the token, but never holds the token itself
+	TypeTokenIssued string = "token.issued"
+
+	// TypeKeyRotated - Published when the signing keys of an audience are rotated. The data holds the algorithm, audience, and kid of the new key, along with the comma separated kids of the retired keys that were removed
+	TypeKeyRotated string = "key.rotated"
+
+	// TypeKeyImported - Published when a private key generated outside of credstack is imported. The data holds the algorithm, audience, and kid of the key, and whether it became the current key
+	TypeKeyImported string = "key.imported"
+)
+
+const (
+	// HeaderSignature - The header every delivery is signed in. Holds the time the delivery was signed and the signature: t=<unix>,v1=<hex>
+	HeaderSignature = "X-Credstack-Signature"
+
+	// HeaderEvent - The header holding the type of the delivered event
+	HeaderEvent = "X-Credstack-Event"
+
+	// HeaderDelivery - The header holding the ID of the delivered event. This is the same on every retry, so that receivers can discard duplicates
+	HeaderDelivery = "X-Credstack-Delivery"
+)
+
+// ErrInvalidSignature - An error that gets returned when a delivery is verified with a signature that is malformed, has expired, or does not match its body
+var ErrInvalidSignature = credstackError.NewError(401, "ERR_INVALID_EVENT_SIGNATURE", "events: The signature of the delivery is invalid or has expired")
+
+/*
+Event - Represents a single lifecycle event delivered to webhooks. Data is marshaled to JSON as-is, so it should be a
+map or a structure with JSON tags
+*/
+type Event struct {
+	// Id - A random identifier for the event, sent in HeaderDelivery
+	Id string `json:"id" bson:"id"`
+
+	// Type - The type of the event (user.registered, token.issued). Used for filtering
+	Type string `json:"type" bson:"type"`
+
+	// Time - A unix timestamp representing when the event occurred
+	Time int64 `json:"time" bson:"time"`
+
+	// Data - The payload of the event
+	Data any `json:"data" bson:"data"`
+}
+
+/*
+DeadLetter - Records an event that could not be delivered to a webhook after exhausting its retries, so that it can be
+inspected and redelivered by an operator
+*/
+type DeadLetter struct {
+	// Webhook - The name of the webhook the event could not be delivered to
+	Webhook string `json:"webhook" bson:"webhook"`
+
+	// Event - The event that could not be delivered
+	Event Event `json:"event" bson:"event"`
+
+	// Attempts - The number of deliveries that were attempted
+	Attempts int `json:"attempts" bson:"attempts"`
+
+	// Error - The error returned by the final delivery attempt
+	Error string `json:"error" bson:"error"`
+
+	// FailedAt - A unix timestamp representing when the final delivery attempt failed
+	FailedAt int64 `json:"failed_at" bson:"failed_at"`
+}
+
+/*
+New - Creates an event of the type provided in the parameter, occurring at the time provided, with a random identifier.
+If the identifier cannot be generated, then an error is returned and the event should not be published
+*/
+func New(eventType string, at time.Time, data any) (Event, error) {
+	id, err := secret.RandString(16)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{Id: id, Type: eventType, Time: at.Unix(), Data: data}, nil
+}
+
+/*
+Sign - Returns the value of HeaderSignature for the body provided in the parameter, signed at the time provided. The
+signature is the HMAC-SHA256 of the timestamp and the body joined with a period, so that a delivery cannot be replayed
+later with a new timestamp
+*/
+func Sign(key string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signature(key, timestamp, body)
+}
+
+/*
+Verify - Verifies the value of HeaderSignature provided in the parameter against the body of a delivery, for receivers
+written in Go. Deliveries signed more than the tolerance before now are rejected, so that a captured delivery cannot be
+replayed. If the signature is malformed, expired, or does not match, then ErrInvalidSignature is returned
+*/
+func Verify(key string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp, provided string
+
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(part, "=")
+		switch name {
+		case "t":
+			timestamp = value
+		case "v1":
+			provided = value
+		}
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || provided == "" {
+		return ErrInvalidSignature
+	}
+
+	if now.Sub(time.Unix(signedAt, 0)) > tolerance {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(provided), []byte(signature(key, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+/*
+signature - Computes the hex encoded HMAC-SHA256 of the timestamp and body provided in the parameter
+*/
+func signature(key string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
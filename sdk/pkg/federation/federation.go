@@ -0,0 +1,277 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+// PathCallback - The path of the endpoint that identity providers redirect users back to, relative to the issuer. This must be registered as a redirect URI with every provider
+const PathCallback = "/oauth/federation/callback"
+
+// discoveryLifetime - How long the discovered endpoints of an OpenID Connect provider are cached for
+const discoveryLifetime = time.Hour
+
+// maxResponseSize - The largest response credstack reads from an identity provider
+const maxResponseSize = 1 << 20
+
+// ErrConnectionDoesNotExist - Provides a named error for when a connection is not configured, or is not offered to the client
+var ErrConnectionDoesNotExist = credstackError.NewError(404, "FEDERATION_CONNECTION_DOES_NOT_EXIST", "federation: The connection does not exist")
+
+// ErrInvalidState - Provides a named error for when a callback does not belong to a sign in that was started by credstack, or it has expired
+var ErrInvalidState = credstackError.NewError(400, "FEDERATION_INVALID_STATE", "federation: The sign in attempt does not exist or has expired")
+
+// ErrUpstreamDenied - Provides a named error for when the identity provider returns an error instead of an authorization code, usually because the user denied the request
+var ErrUpstreamDenied = credstackError.NewError(403, "access_denied", "federation: The identity provider did not authorize the user")
+
+// ErrUpstreamUnavailable - Provides a named error for when the identity provider cannot be reached, or responds with an error
+var ErrUpstreamUnavailable = credstackError.NewError(503, "temporarily_unavailable", "federation: The identity provider is unavailable")
+
+// ErrInvalidUpstreamToken - Provides a named error for when the identity provider issues an ID token that is not valid for credstack, or does not identify the user
+var ErrInvalidUpstreamToken = credstackError.NewError(502, "FEDERATION_INVALID_UPSTREAM_TOKEN", "federation: The identity provider returned an invalid token")
+
+// ErrMissingEmail - Provides a named error for when the identity provider does not share the email address of a user that has never signed in before
+var ErrMissingEmail = credstackError.NewError(400, "FEDERATION_MISSING_EMAIL", "federation: The identity provider did not share an email address for the user")
+
+/*
+preset - The endpoints, scopes and claims of a well known identity provider
+*/
+type preset struct {
+	connectionType        string
+	issuer                string
+	authorizationEndpoint string
+	tokenEndpoint         string
+	userInfoEndpoint      string
+	scopes                []string
+	subjectClaim          string
+	claimMapping          map[string]string
+
+	// emailsEndpoint - Lists the email addresses of the user, for providers that do not return private ones from their userinfo endpoint
+	emailsEndpoint string
+}
+
+/*
+presets - Every preset that can be set on FederationConnectionConfig.Preset
+*/
+var presets = map[string]preset{
+	config.FederationPresetGoogle: {
+		connectionType: config.FederationTypeOIDC,
+		issuer:         "https://accounts.google.com",
+		scopes:         []string{"openid", "email", "profile"},
+	},
+	config.FederationPresetGitHub: {
+		connectionType:        config.FederationTypeOAuth2,
+		authorizationEndpoint: "https://github.com/login/oauth/authorize",
+		tokenEndpoint:         "https://github.com/login/oauth/access_token",
+		userInfoEndpoint:      "https://api.github.com/user",
+		emailsEndpoint:        "https://api.github.com/user/emails",
+		scopes:                []string{"read:user", "user:email"},
+		subjectClaim:          "id",
+		claimMapping:          map[string]string{"username": "login", "address": "location"},
+	},
+}
+
+/*
+Connection - A connection with its preset applied and, for OpenID Connect providers, its endpoints discovered
+*/
+type Connection struct {
+	config.FederationConnectionConfig
+
+	// emailsEndpoint - See preset.emailsEndpoint
+	emailsEndpoint string
+
+	// claimMapping - The claim mapping of the preset, overridden by the configured one
+	claimMapping map[string]string
+}
+
+/*
+Available - Returns the connections that are offered to the client with the client ID provided in the parameter, in the
+order they are configured, so that they can be listed on the hosted login page
+*/
+func Available(serv *server.Server, clientId string) []config.FederationConnectionConfig {
+	ret := make([]config.FederationConnectionConfig, 0, len(serv.Config.FederationConfig.Connections))
+
+	for _, connection := range serv.Config.FederationConfig.Connections {
+		if len(connection.Clients) != 0 && !slices.Contains(connection.Clients, clientId) {
+			continue
+		}
+
+		if connection.DisplayName == "" {
+			connection.DisplayName = connection.Name
+		}
+
+		ret = append(ret, connection)
+	}
+
+	return ret
+}
+
+/*
+resolve - Returns the connection with the name provided in the parameter, with its preset applied and its endpoints
+discovered. If the connection is not configured, or is not offered to the client, then ErrConnectionDoesNotExist is
+returned. If the endpoints of an OpenID Connect provider cannot be discovered, then ErrUpstreamUnavailable is returned
+*/
+func resolve(serv *server.Server, name string, clientId string) (*Connection, error) {
+	connection, ok := serv.Config.FederationConfig.Connection(name)
+	if !ok || (len(connection.Clients) != 0 && !slices.Contains(connection.Clients, clientId)) {
+		return nil, ErrConnectionDoesNotExist
+	}
+
+	ret := &Connection{FederationConnectionConfig: connection, claimMapping: map[string]string{}}
+
+	if p, ok := presets[connection.Preset]; ok {
+		ret.Type = orDefault(ret.Type, p.connectionType)
+		ret.Issuer = orDefault(ret.Issuer, p.issuer)
+		ret.AuthorizationEndpoint = orDefault(ret.AuthorizationEndpoint, p.authorizationEndpoint)
+		ret.TokenEndpoint = orDefault(ret.TokenEndpoint, p.tokenEndpoint)
+		ret.UserInfoEndpoint = orDefault(ret.UserInfoEndpoint, p.userInfoEndpoint)
+		ret.SubjectClaim = orDefault(ret.SubjectClaim, p.subjectClaim)
+		ret.emailsEndpoint = p.emailsEndpoint
+
+		if len(ret.Scopes) == 0 {
+			ret.Scopes = p.scopes
+		}
+
+		for field, claim := range p.claimMapping {
+			ret.claimMapping[field] = claim
+		}
+	}
+
+	for field, claim := range connection.ClaimMapping {
+		ret.claimMapping[field] = claim
+	}
+
+	ret.Type = orDefault(ret.Type, config.FederationTypeOIDC)
+	ret.SubjectClaim = orDefault(ret.SubjectClaim, "sub")
+
+	if ret.Type == config.FederationTypeOIDC {
+		if !slices.Contains(ret.Scopes, "openid") {
+			ret.Scopes = append([]string{"openid"}, ret.Scopes...)
+		}
+
+		metadata, err := discover(serv, ret.Issuer)
+		if err != nil {
+			return nil, err
+		}
+
+		ret.AuthorizationEndpoint = orDefault(ret.AuthorizationEndpoint, metadata.AuthorizationEndpoint)
+		ret.TokenEndpoint = orDefault(ret.TokenEndpoint, metadata.TokenEndpoint)
+		ret.UserInfoEndpoint = orDefault(ret.UserInfoEndpoint, metadata.UserInfoEndpoint)
+	}
+
+	return ret, nil
+}
+
+/*
+orDefault - Returns the value provided in the parameter, or the fallback if it is empty
+*/
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+/*
+discovery - The fields of an OpenID Provider metadata document that credstack uses
+*/
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+
+	// fetchedAt - When the document was fetched, so that it can be fetched again once it is older than discoveryLifetime
+	fetchedAt time.Time
+}
+
+var (
+	// discoveryMu - Protects discovered
+	discoveryMu sync.Mutex
+
+	// discovered - The metadata documents of the OpenID Connect providers that were discovered, keyed by issuer
+	discovered = map[string]*discovery{}
+)
+
+/*
+discover - Fetches the OpenID Provider metadata of the issuer provided in the parameter, and caches it for
+discoveryLifetime. The issuer in the document must match the configured one exactly, as it is compared against the
+issuer of every ID token the provider issues
+*/
+func discover(serv *server.Server, issuer string) (*discovery, error) {
+	discoveryMu.Lock()
+	cached, ok := discovered[issuer]
+	discoveryMu.Unlock()
+
+	if ok && serv.Clock().Now().Sub(cached.fetchedAt) < discoveryLifetime {
+		return cached, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrUpstreamUnavailable, err)
+	}
+
+	ret := new(discovery)
+
+	err = do(serv, req, ret)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Issuer != issuer || ret.AuthorizationEndpoint == "" || ret.TokenEndpoint == "" {
+		return nil, fmt.Errorf("%w (the discovery document of %s is invalid)", ErrUpstreamUnavailable, issuer)
+	}
+
+	ret.fetchedAt = serv.Clock().Now()
+
+	discoveryMu.Lock()
+	discovered[issuer] = ret
+	discoveryMu.Unlock()
+
+	return ret, nil
+}
+
+/*
+do - Sends the request provided in the parameter to the identity provider and decodes its JSON response into the value
+provided in the parameter. Numbers are decoded as json.Number when decoding into an interface, so that numeric subjects
+(like GitHub user IDs) are never rounded. If the provider cannot be reached, or responds with anything other than 200,
+then ErrUpstreamUnavailable is returned
+*/
+func do(serv *server.Server, req *http.Request, value any) error {
+	ctx, cancel := context.WithTimeout(req.Context(), serv.Config.FederationConfig.Timeout)
+	defer cancel()
+
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrUpstreamUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w (%s responded with status code %d)", ErrUpstreamUnavailable, req.URL.Host, resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize))
+	decoder.UseNumber()
+
+	err = decoder.Decode(value)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrUpstreamUnavailable, err)
+	}
+
+	return nil
+}
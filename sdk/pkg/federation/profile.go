@@ -0,0 +1,145 @@
+package federation
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+)
+
+/*
+defaultClaimMapping - The claim each field of a new user is filled from when the connection does not map it. These are
+the standard OpenID Connect claims (OpenID Connect Core 1.0 section 5.1)
+*/
+var defaultClaimMapping = map[string]string{
+	"email":          "email",
+	"email_verified": "email_verified",
+	"username":       "preferred_username",
+	"given_name":     "given_name",
+	"middle_name":    "middle_name",
+	"family_name":    "family_name",
+	"gender":         "gender",
+	"birth_date":     "birthdate",
+	"zone_info":      "zoneinfo",
+	"phone_number":   "phone_number",
+	"address":        "address",
+}
+
+/*
+provision - Creates the user signing in through the connection for the first time, with the identity of the provider
+linked to them. Their profile is filled from the claims of the provider with the claim mapping of the connection. An
+email address is required, so for providers that only return public email addresses from their userinfo endpoint
+(GitHub), the primary verified email address is fetched separately. A phone number that cannot be normalized is dropped
+instead of failing the sign in, as it cannot be corrected at the provider from here
+*/
+func provision(serv *server.Server, connection *Connection, subject string, claims map[string]any, accessToken string) (*user.User, error) {
+	mapped := func(field string) string {
+		claim, ok := connection.claimMapping[field]
+		if !ok {
+			claim = defaultClaimMapping[field]
+		}
+
+		return claimString(claims, claim)
+	}
+
+	profile := &user.User{
+		Email:         mapped("email"),
+		EmailVerified: mapped("email_verified") == "true",
+		Username:      mapped("username"),
+		GivenName:     mapped("given_name"),
+		MiddleName:    mapped("middle_name"),
+		FamilyName:    mapped("family_name"),
+		Gender:        mapped("gender"),
+		BirthDate:     mapped("birth_date"),
+		ZoneInfo:      mapped("zone_info"),
+		Address:       mapped("address"),
+	}
+
+	if profile.Email == "" && connection.emailsEndpoint != "" {
+		email, err := primaryEmail(serv, connection, accessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		profile.Email, profile.EmailVerified = email, email != ""
+	}
+
+	if profile.Email == "" {
+		return nil, ErrMissingEmail
+	}
+
+	if profile.Username == "" {
+		profile.Username = claimString(claims, "name")
+	}
+
+	if profile.Username == "" {
+		profile.Username, _, _ = strings.Cut(profile.Email, "@")
+	}
+
+	phoneNumber, err := user.NormalizePhoneNumber(mapped("phone_number"), serv.Config.PhoneConfig)
+	if err == nil {
+		profile.PhoneNumber = phoneNumber
+	}
+
+	identity := user.Identity{
+		Provider: connection.Name,
+		Subject:  subject,
+		Email:    profile.Email,
+	}
+
+	return user.Provision(serv, identity, profile)
+}
+
+/*
+emailAddress - An email address returned by the emails endpoint of a provider (GitHub)
+*/
+type emailAddress struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+/*
+primaryEmail - Fetches the primary email address of the user from the emails endpoint of the connection. Only a verified
+address is returned, so that nobody can sign in as the owner of an address they have not proven they own
+*/
+func primaryEmail(serv *server.Server, connection *Connection, accessToken string) (string, error) {
+	var addresses []emailAddress
+
+	err := fetch(serv, connection.emailsEndpoint, accessToken, &addresses)
+	if err != nil {
+		return "", err
+	}
+
+	for _, address := range addresses {
+		if address.Primary && address.Verified {
+			return address.Email, nil
+		}
+	}
+
+	return "", nil
+}
+
+/*
+claimString - Returns the claim with the name provided in the parameter as a string. Numbers and booleans are formatted,
+and addresses (OpenID Connect Core 1.0 section 5.1.1) are returned as their formatted value. Any other value, including
+a missing claim, is returned as an empty string
+*/
+func claimString(claims map[string]any, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case map[string]any:
+		return claimString(value, "formatted")
+	default:
+		return ""
+	}
+}
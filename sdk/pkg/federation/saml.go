@@ -0,0 +1,573 @@
+package federation
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/credstack/credstack/sdk/internal/xmldsig"
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+)
+
+const (
+	// PathSAMLAssertionConsumer - The path of the assertion consumer service, which SAML identity providers post their responses to, relative to the issuer
+	PathSAMLAssertionConsumer = "/oauth/federation/saml/acs"
+
+	// PathSAMLMetadata - The path of the service provider metadata, which SAML identity providers import credstack from, relative to the issuer
+	PathSAMLMetadata = "/oauth/federation/saml/metadata"
+)
+
+const (
+	namespaceMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	namespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	namespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+
+	bindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	statusSuccess       = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmationBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIdFormatEmail   = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	samlTimestampFormat = "2006-01-02T15:04:05Z"
+)
+
+// samlClockSkew - How far the clock of an identity provider can drift from credstack's before its assertions are rejected
+const samlClockSkew = time.Minute
+
+// ErrInvalidSAMLMetadata - Provides a named error for when the metadata of a SAML identity provider cannot be loaded, or does not describe an identity provider credstack can use
+var ErrInvalidSAMLMetadata = credstackError.NewError(502, "FEDERATION_INVALID_SAML_METADATA", "federation: The metadata of the SAML identity provider is invalid")
+
+// ErrInvalidSAMLResponse - Provides a named error for when a SAML response is malformed, is not signed by the identity provider, or is not valid for credstack
+var ErrInvalidSAMLResponse = credstackError.NewError(400, "FEDERATION_INVALID_SAML_RESPONSE", "federation: The SAML response is invalid")
+
+/*
+samlAttributeAliases - The standard OpenID Connect claims that common SAML attribute names are also exposed as, so that
+the default claim mapping works for most identity providers without configuration. These cover the claim types used by
+Active Directory Federation Services and Entra ID, and the LDAP attribute OIDs used by Shibboleth
+*/
+var samlAttributeAliases = map[string]string{
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": "email",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname":    "given_name",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname":      "family_name",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name":         "name",
+	"urn:oid:0.9.2342.19200300.100.1.3":                                  "email",
+	"urn:oid:2.5.4.42":                                                   "given_name",
+	"urn:oid:2.5.4.4":                                                    "family_name",
+	"urn:oid:2.16.840.1.113730.3.1.241":                                  "name",
+	"urn:oid:0.9.2342.19200300.100.1.1":                                  "preferred_username",
+	"mail":                                                               "email",
+	"givenName":                                                          "given_name",
+	"sn":                                                                 "family_name",
+	"displayName":                                                        "name",
+	"uid":                                                                "preferred_username",
+}
+
+/*
+samlMetadata - The parts of the metadata of a SAML identity provider that credstack uses
+*/
+type samlMetadata struct {
+	// entityId - The entity ID of the identity provider, which is the issuer of its assertions
+	entityId string
+
+	// ssoURL - The location of its single sign-on service with the HTTP-Redirect binding
+	ssoURL string
+
+	// certificates - The certificates its responses and assertions are signed with
+	certificates []*x509.Certificate
+
+	// fetchedAt - When the metadata was loaded, so that it can be loaded again once it is older than discoveryLifetime
+	fetchedAt time.Time
+}
+
+var (
+	// metadataMu - Protects metadataCache
+	metadataMu sync.Mutex
+
+	// metadataCache - The metadata of every SAML identity provider that was loaded, keyed by connection name
+	metadataCache = map[string]*samlMetadata{}
+)
+
+/*
+loadMetadata - Loads the metadata of the SAML identity provider of the connection from MetadataFile or MetadataURL, and
+caches it for discoveryLifetime, so that rotated signing certificates are picked up without a restart. If the metadata
+cannot be loaded, does not describe an identity provider with an HTTP-Redirect single sign-on service, or lists no signing
+certificates, then ErrInvalidSAMLMetadata is returned
+*/
+func loadMetadata(serv *server.Server, connection *Connection) (*samlMetadata, error) {
+	metadataMu.Lock()
+	cached, ok := metadataCache[connection.Name]
+	metadataMu.Unlock()
+
+	if ok && serv.Clock().Now().Sub(cached.fetchedAt) < discoveryLifetime {
+		return cached, nil
+	}
+
+	var data []byte
+	var err error
+
+	if connection.MetadataFile != "" {
+		data, err = os.ReadFile(connection.MetadataFile)
+	} else {
+		data, err = fetchMetadata(serv, connection.MetadataURL)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s: %v)", ErrInvalidSAMLMetadata, connection.Name, err)
+	}
+
+	ret, err := parseMetadata(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s: %v)", ErrInvalidSAMLMetadata, connection.Name, err)
+	}
+
+	ret.fetchedAt = serv.Clock().Now()
+
+	metadataMu.Lock()
+	metadataCache[connection.Name] = ret
+	metadataMu.Unlock()
+
+	return ret, nil
+}
+
+/*
+fetchMetadata - Fetches the metadata document at the URL provided in the parameter
+*/
+func fetchMetadata(serv *server.Server, metadataURL string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: serv.Config.FederationConfig.Timeout}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+/*
+parseMetadata - Parses the metadata of a SAML identity provider. Aggregated metadata (an EntitiesDescriptor) is
+accepted, in which case the first entity with an IDPSSODescriptor is used
+*/
+func parseMetadata(data []byte) (*samlMetadata, error) {
+	root, err := xmldsig.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := []*xmldsig.Element{root}
+	if root.Is(namespaceMetadata, "EntitiesDescriptor") {
+		entities = root.ChildrenNamed(namespaceMetadata, "EntityDescriptor")
+	}
+
+	for _, entity := range entities {
+		descriptor := entity.Child(namespaceMetadata, "IDPSSODescriptor")
+		if !entity.Is(namespaceMetadata, "EntityDescriptor") || descriptor == nil {
+			continue
+		}
+
+		ret := &samlMetadata{entityId: entity.Attr("entityID")}
+
+		for _, service := range descriptor.ChildrenNamed(namespaceMetadata, "SingleSignOnService") {
+			if service.Attr("Binding") == bindingRedirect {
+				ret.ssoURL = service.Attr("Location")
+				break
+			}
+		}
+
+		for _, key := range descriptor.ChildrenNamed(namespaceMetadata, "KeyDescriptor") {
+			if use := key.Attr("use"); use != "" && use != "signing" {
+				continue
+			}
+
+			info := key.Child(xmldsig.NamespaceDSig, "KeyInfo")
+			if info == nil {
+				continue
+			}
+
+			for _, data := range info.ChildrenNamed(xmldsig.NamespaceDSig, "X509Data") {
+				for _, encoded := range data.ChildrenNamed(xmldsig.NamespaceDSig, "X509Certificate") {
+					certificate, err := xmldsig.ParseCertificate(encoded.Text())
+					if err != nil {
+						return nil, err
+					}
+
+					ret.certificates = append(ret.certificates, certificate)
+				}
+			}
+		}
+
+		if ret.entityId == "" || ret.ssoURL == "" || len(ret.certificates) == 0 {
+			return nil, fmt.Errorf("the identity provider must have an entity ID, an HTTP-Redirect single sign-on service, and a signing certificate")
+		}
+
+		return ret, nil
+	}
+
+	return nil, fmt.Errorf("no identity provider descriptor")
+}
+
+/*
+entityId - Returns the entity ID credstack identifies itself with to SAML identity providers
+*/
+func entityId(serv *server.Server, issuer string) string {
+	if serv.Config.FederationConfig.EntityId != "" {
+		return serv.Config.FederationConfig.EntityId
+	}
+
+	return strings.TrimSuffix(issuer, "/") + PathSAMLMetadata
+}
+
+/*
+ServiceProviderMetadata - Returns the SAML metadata describing credstack as a service provider, so that it can be
+imported by identity providers. Every SAML connection shares the same entity ID and assertion consumer service, as the
+connection a response belongs to is identified by its RelayState
+*/
+func ServiceProviderMetadata(serv *server.Server, issuer string) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<md:EntityDescriptor xmlns:md="` + namespaceMetadata + `" entityID="`)
+	xml.EscapeText(&buf, []byte(entityId(serv, issuer)))
+	buf.WriteString(`"><md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="` + namespaceProtocol + `">`)
+	buf.WriteString(`<md:NameIDFormat>urn:oasis:names:tc:SAML:2.0:nameid-format:persistent</md:NameIDFormat>`)
+	buf.WriteString(`<md:AssertionConsumerService Binding="` + bindingPost + `" Location="`)
+	xml.EscapeText(&buf, []byte(strings.TrimSuffix(issuer, "/")+PathSAMLAssertionConsumer))
+	buf.WriteString(`" index="0" isDefault="true"/></md:SPSSODescriptor></md:EntityDescriptor>`)
+
+	return buf.Bytes()
+}
+
+/*
+startSAML - Builds the URL of the single sign-on service of the identity provider with an AuthnRequest for the sign in,
+using the HTTP-Redirect binding. The state is sent as the RelayState, and the ID of the request is stored on the sign in,
+so that only a response to this request can complete it
+*/
+func startSAML(serv *server.Server, connection *Connection, started *signIn, state string, issuer string) (string, error) {
+	metadata, err := loadMetadata(serv, connection)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := secret.RandBytes(20)
+	if err != nil {
+		return "", err
+	}
+
+	started.RequestId = "_" + hex.EncodeToString(id)
+	started.RedirectUri = strings.TrimSuffix(issuer, "/") + PathSAMLAssertionConsumer
+
+	var authnRequest bytes.Buffer
+
+	authnRequest.WriteString(`<samlp:AuthnRequest xmlns:samlp="` + namespaceProtocol + `" xmlns:saml="` + namespaceAssertion + `" ID="` + started.RequestId + `" Version="2.0" IssueInstant="`)
+	authnRequest.WriteString(serv.Clock().Now().UTC().Format(samlTimestampFormat))
+	authnRequest.WriteString(`" Destination="`)
+	xml.EscapeText(&authnRequest, []byte(metadata.ssoURL))
+	authnRequest.WriteString(`" AssertionConsumerServiceURL="`)
+	xml.EscapeText(&authnRequest, []byte(started.RedirectUri))
+	authnRequest.WriteString(`" ProtocolBinding="` + bindingPost + `"><saml:Issuer>`)
+	xml.EscapeText(&authnRequest, []byte(entityId(serv, issuer)))
+	authnRequest.WriteString(`</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"/></samlp:AuthnRequest>`)
+
+	var deflated bytes.Buffer
+
+	writer, err := flate.NewWriter(&deflated, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = writer.Write(authnRequest.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	location, err := url.Parse(metadata.ssoURL)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", ErrInvalidSAMLMetadata, err)
+	}
+
+	query := location.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	query.Set("RelayState", state)
+	location.RawQuery = query.Encode()
+
+	return location.String(), nil
+}
+
+/*
+AssertionCallback - Completes a sign in through a SAML connection that was started with Start, with the SAMLResponse and
+RelayState the identity provider posted to PathSAMLAssertionConsumer. The sign in can only be completed once, and only
+with a response to the AuthnRequest it sent, so unsolicited (identity provider initiated) responses are rejected.
+
+Either the response or its assertion must be signed with a certificate from the metadata of the identity provider that
+has not expired, and the assertion must be issued by it, for credstack, and be valid now. Encrypted assertions are not
+supported. The user is identified by the NameID of the assertion (or the attribute named by SubjectClaim), and the
+attributes of the assertion are mapped onto new users like the claims of any other connection. See Callback for what is
+returned
+*/
+func AssertionCallback(serv *server.Server, samlResponse string, relayState string, issuer string) (*request.AuthorizationRequest, *user.User, error) {
+	started, err := consume(serv, relayState)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := started.Request
+
+	connection, err := resolve(serv, started.Connection, req.ClientId)
+	if err != nil {
+		return req, nil, err
+	}
+
+	if connection.Type != config.FederationTypeSAML || started.RequestId == "" {
+		return req, nil, ErrInvalidState
+	}
+
+	metadata, err := loadMetadata(serv, connection)
+	if err != nil {
+		return req, nil, err
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(samlResponse), ""))
+	if err != nil {
+		return req, nil, fmt.Errorf("%w (%v)", ErrInvalidSAMLResponse, err)
+	}
+
+	root, err := xmldsig.Parse(decoded)
+	if err != nil {
+		return req, nil, fmt.Errorf("%w (%v)", ErrInvalidSAMLResponse, err)
+	}
+
+	subject, claims, err := validateResponse(serv, root, metadata, started, entityId(serv, issuer))
+	if err != nil {
+		return req, nil, err
+	}
+
+	if connection.SubjectClaim != "sub" {
+		subject = claimString(claims, connection.SubjectClaim)
+	}
+
+	if subject == "" {
+		return req, nil, fmt.Errorf("%w (missing %s)", ErrInvalidSAMLResponse, connection.SubjectClaim)
+	}
+
+	account, err := signInUser(serv, connection, subject, claims, "")
+	if err != nil {
+		return req, nil, err
+	}
+
+	return req, account, nil
+}
+
+/*
+validateResponse - Validates a SAML response for the sign in, and returns the NameID of its assertion along with its
+attributes as claims. Everything is read from the element that was verified (the response, or the assertion within it),
+so that unsigned content wrapped around a signed element is never trusted
+*/
+func validateResponse(serv *server.Server, root *xmldsig.Element, metadata *samlMetadata, started *signIn, audience string) (string, map[string]any, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w (%s)", ErrInvalidSAMLResponse, reason)
+	}
+
+	if !root.Is(namespaceProtocol, "Response") {
+		return "", nil, invalid("expected a Response")
+	}
+
+	if destination := root.Attr("Destination"); destination != "" && destination != started.RedirectUri {
+		return "", nil, invalid("the response was sent to a different destination")
+	}
+
+	if root.Attr("InResponseTo") != started.RequestId {
+		return "", nil, invalid("the response is not for this sign in")
+	}
+
+	now := serv.Clock().Now()
+	allowSHA1 := !serv.Config.CryptoConfig.FIPSEnabled()
+
+	responseSigned := xmldsig.Signed(root)
+	if responseSigned {
+		verified, err := xmldsig.Verify(root, metadata.certificates, now, allowSHA1)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w (%v)", ErrInvalidSAMLResponse, err)
+		}
+
+		root = verified
+	}
+
+	if issuer := root.Child(namespaceAssertion, "Issuer"); issuer != nil && issuer.Text() != metadata.entityId {
+		return "", nil, invalid("the response was issued by a different identity provider")
+	}
+
+	status := root.Child(namespaceProtocol, "Status")
+	if status == nil {
+		return "", nil, invalid("missing Status")
+	}
+
+	if code := status.Child(namespaceProtocol, "StatusCode"); code == nil || code.Attr("Value") != statusSuccess {
+		return "", nil, ErrUpstreamDenied
+	}
+
+	if root.Child(namespaceAssertion, "EncryptedAssertion") != nil {
+		return "", nil, invalid("encrypted assertions are not supported")
+	}
+
+	assertions := root.ChildrenNamed(namespaceAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return "", nil, invalid("expected exactly one assertion")
+	}
+
+	assertion := assertions[0]
+
+	if xmldsig.Signed(assertion) {
+		verified, err := xmldsig.Verify(assertion, metadata.certificates, now, allowSHA1)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w (%v)", ErrInvalidSAMLResponse, err)
+		}
+
+		assertion = verified
+	} else if !responseSigned {
+		return "", nil, invalid("neither the response nor the assertion is signed")
+	}
+
+	if issuer := assertion.Child(namespaceAssertion, "Issuer"); issuer == nil || issuer.Text() != metadata.entityId {
+		return "", nil, invalid("the assertion was issued by a different identity provider")
+	}
+
+	subjectElement := assertion.Child(namespaceAssertion, "Subject")
+	if subjectElement == nil {
+		return "", nil, invalid("missing Subject")
+	}
+
+	nameId := subjectElement.Child(namespaceAssertion, "NameID")
+	if nameId == nil || nameId.Text() == "" {
+		return "", nil, invalid("missing NameID")
+	}
+
+	confirmed := false
+	for _, confirmation := range subjectElement.ChildrenNamed(namespaceAssertion, "SubjectConfirmation") {
+		data := confirmation.Child(namespaceAssertion, "SubjectConfirmationData")
+		if confirmation.Attr("Method") != confirmationBearer || data == nil {
+			continue
+		}
+
+		if data.Attr("Recipient") != started.RedirectUri || data.Attr("InResponseTo") != started.RequestId {
+			continue
+		}
+
+		if !before(now, data.Attr("NotOnOrAfter")) {
+			continue
+		}
+
+		confirmed = true
+		break
+	}
+
+	if !confirmed {
+		return "", nil, invalid("the subject cannot be confirmed")
+	}
+
+	conditions := assertion.Child(namespaceAssertion, "Conditions")
+	if conditions == nil {
+		return "", nil, invalid("missing Conditions")
+	}
+
+	if notBefore := conditions.Attr("NotBefore"); notBefore != "" && !after(now, notBefore) {
+		return "", nil, invalid("the assertion is not valid yet")
+	}
+
+	if notOnOrAfter := conditions.Attr("NotOnOrAfter"); notOnOrAfter != "" && !before(now, notOnOrAfter) {
+		return "", nil, invalid("the assertion has expired")
+	}
+
+	for _, restriction := range conditions.ChildrenNamed(namespaceAssertion, "AudienceRestriction") {
+		found := false
+		for _, candidate := range restriction.ChildrenNamed(namespaceAssertion, "Audience") {
+			found = found || candidate.Text() == audience
+		}
+
+		if !found {
+			return "", nil, invalid("the assertion is for a different audience")
+		}
+	}
+
+	claims := map[string]any{}
+
+	for _, statement := range assertion.ChildrenNamed(namespaceAssertion, "AttributeStatement") {
+		for _, attribute := range statement.ChildrenNamed(namespaceAssertion, "Attribute") {
+			values := attribute.ChildrenNamed(namespaceAssertion, "AttributeValue")
+			if len(values) == 0 {
+				continue
+			}
+
+			value := values[0].Text()
+
+			names := []string{attribute.Attr("Name"), attribute.Attr("FriendlyName"), samlAttributeAliases[attribute.Attr("Name")], samlAttributeAliases[attribute.Attr("FriendlyName")]}
+			for _, name := range names {
+				if _, ok := claims[name]; name != "" && !ok {
+					claims[name] = value
+				}
+			}
+		}
+	}
+
+	claims["sub"] = nameId.Text()
+
+	if _, ok := claims["email"]; !ok && nameId.Attr("Format") == nameIdFormatEmail {
+		claims["email"] = nameId.Text()
+	}
+
+	return nameId.Text(), claims, nil
+}
+
+/*
+before - Determines if now is before the SAML timestamp provided in the parameter, allowing for samlClockSkew. A
+timestamp that cannot be parsed (including an empty one) is never after now
+*/
+func before(now time.Time, timestamp string) bool {
+	parsed, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return false
+	}
+
+	return now.Before(parsed.Add(samlClockSkew))
+}
+
+/*
+after - Determines if now is at or after the SAML timestamp provided in the parameter, allowing for samlClockSkew
+*/
+func after(now time.Time, timestamp string) bool {
+	parsed, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return false
+	}
+
+	return !now.Before(parsed.Add(-samlClockSkew))
+}
@@ -0,0 +1,391 @@
+package federation
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+/*
+signIn - A sign in through an identity provider that is waiting for the user to be redirected back to credstack. Only
+the hash of the state is stored, so that the callback cannot be forged from a copy of the database
+*/
+type signIn struct {
+	// StateHash - The SHA-256 hash of the state sent to the identity provider, encoded as a hex string
+	StateHash string `bson:"state_hash"`
+
+	// Connection - The name of the connection the user is signing in with
+	Connection string `bson:"connection"`
+
+	// Nonce - The nonce sent to OpenID Connect providers, which their ID token must contain
+	Nonce string `bson:"nonce"`
+
+	// RequestId - The ID of the AuthnRequest sent to SAML identity providers, which their response must be in response to
+	RequestId string `bson:"request_id,omitempty"`
+
+	// CodeVerifier - The PKCE code verifier (RFC 7636) the authorization code is redeemed with
+	CodeVerifier string `bson:"code_verifier"`
+
+	// RedirectUri - The redirect URI sent to the identity provider. The authorization code must be redeemed with the same one. For saml connections, this is the assertion consumer service
+	RedirectUri string `bson:"redirect_uri"`
+
+	// Request - The authorization request the user is signing in for, which is completed once they return
+	Request *request.AuthorizationRequest `bson:"request"`
+
+	// ExpiresAt - When the sign in expires. Stored as a date so that the TTL index on the collection removes it
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+/*
+Start - Begins signing the user in through the connection provided in the parameter, for the authorization request
+provided in the parameter, which must already be validated. The request is stored along with a random state, nonce and
+PKCE code verifier for FederationConfig.StateLifetime, and the URL of the identity provider to redirect the user agent to
+is returned. Once they sign in, the provider redirects them to PathCallback under the issuer, which must be passed to
+Callback. SAML identity providers instead post their response to PathSAMLAssertionConsumer, which must be passed to
+AssertionCallback.
+
+If the connection is not configured, or is not offered to the client, then ErrConnectionDoesNotExist is returned
+*/
+func Start(serv *server.Server, connectionName string, req *request.AuthorizationRequest, issuer string) (string, error) {
+	connection, err := resolve(serv, connectionName, req.ClientId)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := secret.RandString(32)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := secret.RandString(32)
+	if err != nil {
+		return "", err
+	}
+
+	/*
+		Code verifiers are limited to unreserved characters, so the padded encoding RandString uses cannot be used here
+	*/
+	verifierBytes, err := secret.RandBytes(32)
+	if err != nil {
+		return "", err
+	}
+
+	started := &signIn{
+		StateHash:    hashState(state),
+		Connection:   connection.Name,
+		Nonce:        nonce,
+		CodeVerifier: base64.RawURLEncoding.EncodeToString(verifierBytes),
+		RedirectUri:  strings.TrimSuffix(issuer, "/") + PathCallback,
+		Request:      req,
+		ExpiresAt:    serv.Clock().Now().Add(serv.Config.FederationConfig.StateLifetime),
+	}
+
+	var location string
+
+	if connection.Type == config.FederationTypeSAML {
+		started.Nonce, started.CodeVerifier = "", ""
+
+		location, err = startSAML(serv, connection, started, state, issuer)
+	} else {
+		location, err = authorizationURL(connection, started, state)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = serv.Database().Collection("federation_state").InsertOne(serv.Context(), started)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return location, nil
+}
+
+/*
+authorizationURL - Builds the URL of the authorization endpoint of an OpenID Connect or OAuth 2.0 connection for the sign
+in, with the state, nonce and PKCE code challenge of the sign in
+*/
+func authorizationURL(connection *Connection, started *signIn, state string) (string, error) {
+	challenge := sha256.Sum256([]byte(started.CodeVerifier))
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", connection.ClientId)
+	params.Set("redirect_uri", started.RedirectUri)
+	params.Set("scope", strings.Join(connection.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	if connection.Type != config.FederationTypeOAuth2 {
+		params.Set("nonce", started.Nonce)
+	}
+
+	location, err := url.Parse(connection.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", ErrUpstreamUnavailable, err)
+	}
+
+	query := location.Query()
+	for name := range params {
+		query.Set(name, params.Get(name))
+	}
+
+	location.RawQuery = query.Encode()
+
+	return location.String(), nil
+}
+
+/*
+Callback - Completes a sign in that was started with Start, with the query parameters the identity provider redirected
+the user agent back with. The sign in can only be completed once. The authorization code is redeemed, the user is
+identified by the ID token (oidc connections) or the userinfo endpoint (oauth2 connections), and the user the identity
+is linked to is returned. Users signing in for the first time are created with Provision.
+
+The authorization request the sign in was started for is returned whenever the state is valid, even alongside an error,
+so that the error can be returned to the client. If the state is not valid, then ErrInvalidState is returned with a nil
+request. If the provider returned an error instead of a code, then ErrUpstreamDenied is returned. If the user is locked,
+then user.ErrUserLocked is returned, and if the email address the provider shares is already registered to a user that
+has not linked the identity, then user.ErrIdentityEmailConflict is returned
+*/
+func Callback(serv *server.Server, state string, code string, upstreamError string) (*request.AuthorizationRequest, *user.User, error) {
+	started, err := consume(serv, state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := started.Request
+
+	if upstreamError != "" || code == "" {
+		return req, nil, fmt.Errorf("%w (%s)", ErrUpstreamDenied, upstreamError)
+	}
+
+	connection, err := resolve(serv, started.Connection, req.ClientId)
+	if err != nil {
+		return req, nil, err
+	}
+
+	if connection.Type == config.FederationTypeSAML {
+		return req, nil, ErrInvalidState
+	}
+
+	tokens, err := redeem(serv, connection, started, code)
+	if err != nil {
+		return req, nil, err
+	}
+
+	claims, err := identify(serv, connection, started, tokens)
+	if err != nil {
+		return req, nil, err
+	}
+
+	subject := claimString(claims, connection.SubjectClaim)
+	if subject == "" {
+		return req, nil, fmt.Errorf("%w (missing %s claim)", ErrInvalidUpstreamToken, connection.SubjectClaim)
+	}
+
+	account, err := signInUser(serv, connection, subject, claims, tokens.AccessToken)
+	if err != nil {
+		return req, nil, err
+	}
+
+	return req, account, nil
+}
+
+/*
+consume - Removes the sign in with the state provided in the parameter and returns it, so that it can only be completed
+once. If there is no sign in with the state, or it has expired, then ErrInvalidState is returned
+*/
+func consume(serv *server.Server, state string) (*signIn, error) {
+	if state == "" {
+		return nil, ErrInvalidState
+	}
+
+	var started signIn
+
+	err := serv.Database().Collection("federation_state").FindOneAndDelete(
+		serv.Context(),
+		bson.M{"state_hash": hashState(state), "expires_at": bson.M{"$gt": serv.Clock().Now()}},
+	).Decode(&started)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidState
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &started, nil
+}
+
+/*
+signInUser - Returns the user the identity of the connection with the subject provided in the parameter is linked to,
+provisioning one from the claims if there is none. If the user is locked, then user.ErrUserLocked is returned
+*/
+func signInUser(serv *server.Server, connection *Connection, subject string, claims map[string]any, accessToken string) (*user.User, error) {
+	account, err := user.GetByIdentity(serv, connection.Name, subject)
+	if errors.Is(err, user.ErrUserDoesNotExist) {
+		account, err = provision(serv, connection, subject, claims, accessToken)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if account.Locked {
+		return nil, user.ErrUserLocked
+	}
+
+	return account, nil
+}
+
+/*
+tokenResponse - The fields of a token response from an identity provider that credstack uses
+*/
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IdToken     string `json:"id_token"`
+	Error       string `json:"error"`
+}
+
+/*
+redeem - Redeems the authorization code at the token endpoint of the connection. The client credentials are sent in the
+body, as not every provider supports HTTP basic authentication
+*/
+func redeem(serv *server.Server, connection *Connection, started *signIn, code string) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", started.RedirectUri)
+	form.Set("client_id", connection.ClientId)
+	form.Set("client_secret", connection.ClientSecret)
+	form.Set("code_verifier", started.CodeVerifier)
+
+	req, err := http.NewRequest(http.MethodPost, connection.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrUpstreamUnavailable, err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	ret := new(tokenResponse)
+
+	err = do(serv, req, ret)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		Some providers (GitHub) respond to a failed redemption with 200 and an error in the body
+	*/
+	if ret.Error != "" || ret.AccessToken == "" {
+		return nil, fmt.Errorf("%w (the authorization code was rejected: %s)", ErrInvalidUpstreamToken, ret.Error)
+	}
+
+	return ret, nil
+}
+
+/*
+identify - Returns the claims identifying the user. For oidc connections, these are the claims of the ID token, merged
+with the claims returned by the userinfo endpoint if the connection has one. The ID token is received directly from the
+token endpoint over TLS, so its signature is not checked (OpenID Connect Core 1.0 section 3.1.3.7), however its issuer,
+audience, expiry and nonce are. For oauth2 connections, these are the claims returned by the userinfo endpoint
+*/
+func identify(serv *server.Server, connection *Connection, started *signIn, tokens *tokenResponse) (map[string]any, error) {
+	claims := jwt.MapClaims{}
+
+	if connection.Type != config.FederationTypeOAuth2 {
+		if tokens.IdToken == "" {
+			return nil, fmt.Errorf("%w (missing id_token)", ErrInvalidUpstreamToken)
+		}
+
+		parser := jwt.NewParser(jwt.WithJSONNumber())
+
+		_, _, err := parser.ParseUnverified(tokens.IdToken, claims)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrInvalidUpstreamToken, err)
+		}
+
+		validator := jwt.NewValidator(
+			jwt.WithIssuer(connection.Issuer),
+			jwt.WithAudience(connection.ClientId),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(time.Minute),
+			jwt.WithTimeFunc(serv.Clock().Now),
+		)
+
+		err = validator.Validate(claims)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrInvalidUpstreamToken, err)
+		}
+
+		if claimString(claims, "nonce") != started.Nonce {
+			return nil, fmt.Errorf("%w (nonce mismatch)", ErrInvalidUpstreamToken)
+		}
+
+		if connection.UserInfoEndpoint == "" {
+			return claims, nil
+		}
+	}
+
+	var userInfo map[string]any
+
+	err := fetch(serv, connection.UserInfoEndpoint, tokens.AccessToken, &userInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		The userinfo response must describe the same user as the ID token, otherwise it was substituted
+	*/
+	if len(claims) != 0 && claimString(userInfo, "sub") != "" && claimString(userInfo, "sub") != claimString(claims, "sub") {
+		return nil, fmt.Errorf("%w (the userinfo subject does not match the id_token)", ErrInvalidUpstreamToken)
+	}
+
+	for name, value := range userInfo {
+		if _, ok := claims[name]; !ok {
+			claims[name] = value
+		}
+	}
+
+	return claims, nil
+}
+
+/*
+fetch - Sends a GET request to the endpoint provided in the parameter, authenticated with the access token issued by the
+identity provider, and decodes its JSON response into the value provided in the parameter
+*/
+func fetch(serv *server.Server, endpoint string, accessToken string, value any) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrUpstreamUnavailable, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	return do(serv, req, value)
+}
+
+/*
+hashState - Returns the SHA-256 hash of the state provided in the parameter, encoded as a hex string
+*/
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
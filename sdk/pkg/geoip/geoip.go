@@ -0,0 +1,118 @@
+package geoip
+
+import (
+	"net"
+	"sync"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrUnknownBackend - An error that gets returned when the configured geo-ip backend has not been registered
+var ErrUnknownBackend = credstackError.NewError(500, "ERR_UNKNOWN_GEOIP_BACKEND", "geoip: The requested geo-ip backend does not exist")
+
+// ErrInvalidAddress - An error that gets returned when the caller tries to resolve an IP address that cannot be parsed
+var ErrInvalidAddress = credstackError.NewError(400, "ERR_INVALID_IP_ADDRESS", "geoip: Unable to resolve location. The IP address provided is invalid")
+
+// ErrLookupFailed - An error that gets wrapped when the underlying backend fails to resolve an IP address
+var ErrLookupFailed = credstackError.NewError(500, "ERR_GEOIP_LOOKUP_FAILED", "geoip: Failed to resolve the location of the IP address")
+
+/*
+Location - Represents the geographical location that an IP address was resolved to. Any fields that the backend could
+not resolve are left empty
+*/
+type Location struct {
+	// IP - The IP address that was resolved
+	IP string `json:"ip" bson:"ip"`
+
+	// CountryCode - The ISO 3166-1 alpha-2 code of the country the IP address belongs to
+	CountryCode string `json:"country_code" bson:"country_code"`
+
+	// Country - The english name of the country the IP address belongs to
+	Country string `json:"country" bson:"country"`
+
+	// Subdivision - The english name of the largest subdivision (state/province) the IP address belongs to
+	Subdivision string `json:"subdivision" bson:"subdivision"`
+
+	// City - The english name of the city the IP address belongs to
+	City string `json:"city" bson:"city"`
+
+	// Latitude - The approximate latitude of the IP address
+	Latitude float64 `json:"latitude" bson:"latitude"`
+
+	// Longitude - The approximate longitude of the IP address
+	Longitude float64 `json:"longitude" bson:"longitude"`
+
+	// TimeZone - The IANA time zone associated with the location
+	TimeZone string `json:"time_zone" bson:"time_zone"`
+}
+
+/*
+Resolver - Interface that all geo-ip backends must implement. Resolvers are shared across the entire server, so
+implementations must be safe for concurrent use
+*/
+type Resolver interface {
+	// Lookup - Resolves the IP address to a Location
+	Lookup(ip net.IP) (*Location, error)
+
+	// Close - Releases any resources (open files, connections) held by the resolver
+	Close() error
+}
+
+/*
+Factory - A function that constructs a Resolver from the geo-ip configuration. Backends register a Factory with Register
+so that they can be selected using GeoIPConfig.Backend
+*/
+type Factory func(config config.GeoIPConfig) (Resolver, error)
+
+var (
+	// registryLock - Protects the backends map
+	registryLock sync.RWMutex
+
+	// backends - All registered geo-ip backends keyed by their name
+	backends = map[string]Factory{
+		"none":    newNoopResolver,
+		"maxmind": newMaxMindResolver,
+	}
+)
+
+/*
+Register - Registers a new geo-ip backend under the provided name. If a backend already exists under this name, then it
+is overwritten. This should be called before the server is started, usually from an init function
+*/
+func Register(name string, factory Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	backends[name] = factory
+}
+
+/*
+New - Constructs the Resolver for the backend defined in the config. If the backend has not been registered, then
+ErrUnknownBackend is returned
+*/
+func New(config config.GeoIPConfig) (Resolver, error) {
+	registryLock.RLock()
+	factory, ok := backends[config.Backend]
+	registryLock.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownBackend
+	}
+
+	return factory(config)
+}
+
+/*
+LookupString - A convenience wrapper around Resolver.Lookup that parses the IP address first. Most callers will have the
+IP address as a string (fiber.Ctx.IP), so this avoids duplicating parsing logic. If the address cannot be parsed, then
+ErrInvalidAddress is returned
+*/
+func LookupString(resolver Resolver, ip string) (*Location, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, ErrInvalidAddress
+	}
+
+	return resolver.Lookup(parsed)
+}
@@ -0,0 +1,160 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+/*
+maxMindRecord - The subset of the GeoIP2/GeoLite2 City schema that credstack decodes. Decoding only the fields we need
+avoids allocating the (fairly large) localized name maps for every lookup
+*/
+type maxMindRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+}
+
+/*
+MaxMindResolver - A Resolver backed by a MaxMind (GeoIP2 or GeoLite2) City database file. The database is re-opened
+on the configured refresh interval so that updates written by geoipupdate are picked up without restarting credstack
+*/
+type MaxMindResolver struct {
+	// config - The options used for opening and refreshing the database
+	config config.GeoIPConfig
+
+	// lock - Protects reader while the database is being swapped during a refresh
+	lock sync.RWMutex
+
+	// reader - The currently open database
+	reader *maxminddb.Reader
+
+	// stop - Closed when the resolver is closed to stop the refresh goroutine
+	stop chan struct{}
+}
+
+/*
+Lookup - Resolves the IP address against the currently open database. Any errors returned from the database are
+wrapped with ErrLookupFailed
+*/
+func (resolver *MaxMindResolver) Lookup(ip net.IP) (*Location, error) {
+	var record maxMindRecord
+
+	resolver.lock.RLock()
+	err := resolver.reader.Lookup(ip, &record)
+	resolver.lock.RUnlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrLookupFailed, err)
+	}
+
+	location := &Location{
+		IP:          ip.String(),
+		CountryCode: record.Country.IsoCode,
+		Country:     record.Country.Names["en"],
+		City:        record.City.Names["en"],
+		Latitude:    record.Location.Latitude,
+		Longitude:   record.Location.Longitude,
+		TimeZone:    record.Location.TimeZone,
+	}
+
+	if len(record.Subdivisions) != 0 {
+		location.Subdivision = record.Subdivisions[0].Names["en"]
+	}
+
+	return location, nil
+}
+
+/*
+Refresh - Re-opens the database file and swaps it with the currently open one. If the file cannot be opened, then the
+existing database continues to be used and the error is returned
+*/
+func (resolver *MaxMindResolver) Refresh() error {
+	reader, err := maxminddb.Open(resolver.config.DatabasePath)
+	if err != nil {
+		return err
+	}
+
+	resolver.lock.Lock()
+	previous := resolver.reader
+	resolver.reader = reader
+	resolver.lock.Unlock()
+
+	if previous != nil {
+		return previous.Close()
+	}
+
+	return nil
+}
+
+/*
+Close - Stops the refresh goroutine and closes the open database
+*/
+func (resolver *MaxMindResolver) Close() error {
+	close(resolver.stop)
+
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+
+	return resolver.reader.Close()
+}
+
+/*
+refreshLoop - Periodically calls Refresh until the resolver is closed. Errors are ignored here as a failed refresh
+leaves the previous database in place
+*/
+func (resolver *MaxMindResolver) refreshLoop() {
+	ticker := time.NewTicker(resolver.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-resolver.stop:
+			return
+		case <-ticker.C:
+			_ = resolver.Refresh()
+		}
+	}
+}
+
+/*
+newMaxMindResolver - Opens the MaxMind database defined in GeoIPConfig.DatabasePath and starts the refresh goroutine
+if a refresh interval was provided
+*/
+func newMaxMindResolver(config config.GeoIPConfig) (Resolver, error) {
+	resolver := &MaxMindResolver{
+		config: config,
+		stop:   make(chan struct{}),
+	}
+
+	err := resolver.Refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.RefreshInterval > 0 {
+		go resolver.refreshLoop()
+	}
+
+	return resolver, nil
+}
@@ -0,0 +1,25 @@
+package geoip
+
+import (
+	"net"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+noopResolver - The default resolver used when geo-ip resolution is disabled. Every lookup succeeds, but only the IP
+address is filled in on the returned Location
+*/
+type noopResolver struct{}
+
+func (resolver *noopResolver) Lookup(ip net.IP) (*Location, error) {
+	return &Location{IP: ip.String()}, nil
+}
+
+func (resolver *noopResolver) Close() error {
+	return nil
+}
+
+func newNoopResolver(_ config.GeoIPConfig) (Resolver, error) {
+	return &noopResolver{}, nil
+}
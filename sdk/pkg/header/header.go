@@ -1,17 +1,39 @@
 package header
 
 import (
-	internalTime "github.com/credstack/credstack/sdk/internal/time"
+	"github.com/credstack/credstack/sdk/pkg/clock"
 	"github.com/credstack/credstack/sdk/pkg/secret"
 )
 
+// region - The region stamped on every header created by this process. Set once with SetRegion when the server starts
+var region string
+
+/*
+SetRegion - Sets the region that is stamped on every header created from now on. This should only be called once, when the
+server starts and before any objects are created
+*/
+func SetRegion(name string) {
+	region = name
+}
+
+// now - The clock that timestamps every header created by this process. Set with SetClock when the server starts
+var now clock.Clock = clock.System
+
+/*
+SetClock - Sets the clock that timestamps every header (and sortable identifier) created from now on. This is called by
+the server when it starts, or when its clock is replaced
+*/
+func SetClock(c clock.Clock) {
+	now = c
+}
+
 /*
 Header - A message representing shared data that is applied to all objects created by credstack. Primarily holds a
 unique identifier that gets assigned to all user/system created objects, although also holds metadata such as timestamps
 that can be shared across many different types of objects
 */
 type Header struct {
-	// Identifier - A UUID v5 based on an immutable property of the object this header is attached to.
+	// Identifier - A unique identifier for the object this header is attached to, produced by the ID strategy that was active when it was created. With the default strategy, this is a UUID v5 based on an immutable property of the object
 	Identifier string `json:"identifier" bson:"identifier"`
 
 	// CreatedAt - A unix timestamp representing when the object was created
@@ -25,21 +47,43 @@ type Header struct {
 
 	// Tags - An arbitrary map of tags that can be assigned by the user
 	Tags map[string]string `json:"tags" bson:"tags"`
+
+	// Region - The region the object was created in. Empty if the server that created it was not region-aware
+	Region string `json:"region,omitempty" bson:"region,omitempty"`
 }
 
 /*
-New - Generates a new header that can be attached to any cred-stack object. The basis that is provided in the
-parameter of the function, is used for generating a version 5 UUID. Ideally, this should be a unique, immutable value
-to protect against de-duplication.
+New - Generates a new header that can be attached to any cred-stack object. The identifier is produced from the basis
+that is provided in the parameter with the active ID strategy (see SetStrategy), which generates a version 5 UUID by
+default. Ideally, the basis should be a unique, immutable value to protect against de-duplication.
+
+With a strategy that derives the identifier from the basis alone, the same object gets the same identifier in every
+region. When the same object is created in two regions at once, the unique index on header.identifier rejects one of
+them instead of storing duplicates. Sortable strategies ignore the basis, and leave this to the unique indexes on the
+natural keys of each object
 */
 func New(basis string) *Header {
-	timestamp := internalTime.UnixTimestamp()
+	timestamp := now.Now().Unix()
 
 	return &Header{
-		Identifier: secret.GenerateUUID(basis),
+		Identifier: identifier(basis),
 		CreatedAt:  timestamp,
 		UpdatedAt:  timestamp,
 		AccessedAt: timestamp,
 		Tags:       make(map[string]string),
+		Region:     region,
 	}
 }
+
+/*
+NewRandom - Generates a new header for an object that has no immutable natural key to use as the basis. A random basis
+prefixed with the region is used instead, so that identifiers created concurrently in different regions never collide
+*/
+func NewRandom() (*Header, error) {
+	basis, err := secret.RandString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(region + ":" + basis), nil
+}
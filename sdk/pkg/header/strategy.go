@@ -0,0 +1,170 @@
+package header
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/google/uuid"
+)
+
+const (
+	// StrategyUUIDv5 - Derives the identifier from the basis as a version 5 UUID. This is the legacy strategy, and the default
+	StrategyUUIDv5 string = "uuidv5"
+
+	// StrategyUUIDv7 - Generates a version 7 UUID, which sorts by the time it was created. The basis is ignored
+	StrategyUUIDv7 string = "uuidv7"
+
+	// StrategyULID - Generates a ULID, which sorts by the time it was created. The basis is ignored
+	StrategyULID string = "ulid"
+
+	// StrategySHA256 - Derives the identifier from the basis as the hex encoded SHA-256 of the namespace followed by the basis
+	StrategySHA256 string = "sha256"
+)
+
+// ErrUnknownIDStrategy - Provides a named error for when an ID strategy is selected that was never registered
+var ErrUnknownIDStrategy = credstackError.NewError(500, "ERR_UNKNOWN_ID_STRATEGY", "header: The ID strategy has not been registered")
+
+/*
+Strategy - A function that produces the identifier of a new header from its basis, and the namespace configured in
+IdentifierConfig. Strategies that are not derived from the basis are free to ignore it
+*/
+type Strategy func(namespace string, basis string) (string, error)
+
+var (
+	// mu - Guards strategies and active, as strategies can be registered after the server has started
+	mu sync.RWMutex
+
+	// strategies - The strategies that can be selected with SetStrategy, keyed by their name
+	strategies = map[string]Strategy{
+		StrategyUUIDv5: uuidV5,
+		StrategyUUIDv7: uuidV7,
+		StrategyULID:   ulid,
+		StrategySHA256: namespacedSHA256,
+	}
+
+	// active - The name of the strategy used by New
+	active = StrategyUUIDv5
+
+	// namespace - The namespace passed to the active strategy
+	namespace string
+)
+
+/*
+RegisterStrategy - Registers a strategy under the name provided in the parameter, so that it can be selected with
+SetStrategy. Registering a strategy under a name that is already in use replaces it, including the built-in strategies
+*/
+func RegisterStrategy(name string, strategy Strategy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	strategies[name] = strategy
+}
+
+/*
+SetStrategy - Selects the strategy used to generate the identifier of every header created from now on, along with the
+namespace passed to it. Headers that were already created keep their identifier: objects are always looked up by the
+identifier stored on them and never by deriving it again, so switching strategies does not need a migration. If no
+strategy is registered under the name, then ErrUnknownIDStrategy is returned and the active strategy is left unchanged.
+This should only be called once, when the server starts and before any objects are created
+*/
+func SetStrategy(name string, ns string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := strategies[name]; !ok {
+		return ErrUnknownIDStrategy
+	}
+
+	active = name
+	namespace = ns
+
+	return nil
+}
+
+/*
+identifier - Produces the identifier for a new header with the active strategy. If the strategy fails, then the legacy
+UUID v5 is used instead, so that an object is never created without an identifier
+*/
+func identifier(basis string) string {
+	mu.RLock()
+	strategy := strategies[active]
+	ns := namespace
+	mu.RUnlock()
+
+	ret, err := strategy(ns, basis)
+	if err != nil || ret == "" {
+		return secret.GenerateUUID(basis)
+	}
+
+	return ret
+}
+
+/*
+uuidV5 - The legacy strategy: a version 5 UUID of the basis under the URL namespace. The configured namespace is not
+used, so that identifiers stay the same as the ones created before strategies were configurable
+*/
+func uuidV5(_ string, basis string) (string, error) {
+	return secret.GenerateUUID(basis), nil
+}
+
+/*
+uuidV7 - A version 7 UUID, made up of the current unix timestamp in milliseconds followed by random bits
+*/
+func uuidV7(_ string, _ string) (string, error) {
+	identifier, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+
+	return identifier.String(), nil
+}
+
+// crockford - The alphabet ULIDs are encoded with. Excludes I, L, O, and U so that identifiers cannot be misread
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+/*
+ulid - A ULID: the current unix timestamp in milliseconds (48 bits) followed by 80 random bits, encoded as 26 characters
+of Crockford's base32, so that identifiers sort lexicographically by the time they were created
+*/
+func ulid(_ string, _ string) (string, error) {
+	var raw [16]byte
+
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(now.Now().UnixMilli()))
+	copy(raw[:6], timestamp[2:])
+
+	if _, err := rand.Read(raw[6:]); err != nil {
+		return "", err
+	}
+
+	/*
+		The 128 bits are encoded 5 at a time from the least significant end, with the first character only holding the
+		top 3 bits. This is the same as encoding the 130 bit number that is the 128 bits padded with 2 leading zeros
+	*/
+	hi := binary.BigEndian.Uint64(raw[:8])
+	lo := binary.BigEndian.Uint64(raw[8:])
+
+	var ret [26]byte
+	for i := 25; i >= 0; i-- {
+		ret[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(ret[:]), nil
+}
+
+/*
+namespacedSHA256 - The hex encoded SHA-256 of the namespace followed by the basis. Like the legacy strategy, the same
+basis always produces the same identifier, while deployments with different namespaces produce different ones
+*/
+func namespacedSHA256(ns string, basis string) (string, error) {
+	sum := sha256.Sum256([]byte(ns + ":" + basis))
+
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,114 @@
+package legacy
+
+import (
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+/*
+TokenTypes - The values of the TokenType enum from the protobuf models, indexed by their number. Documents written before
+the models were moved to native types store the number in place of the string
+*/
+var TokenTypes = []string{"HS256", "RS256"}
+
+/*
+GrantTypes - The values of the GrantType enum from the protobuf models, indexed by their number. Grant types that were
+added after the models were moved to native types were never stored as numbers, so they are not listed here
+*/
+var GrantTypes = []string{"client_credentials", "authorization_code", "refresh_token", "password"}
+
+// ErrUnknownLegacyValue - Provides a named error for when a document holds an enum number that has no string equivalent
+var ErrUnknownLegacyValue = credstackError.NewError(500, "ERR_UNKNOWN_LEGACY_VALUE", "legacy: A document holds an enum value that cannot be converted")
+
+/*
+IsLegacy - Determines if the value provided in the parameter was written by the protobuf models: either a number, or an
+array that holds one
+*/
+func IsLegacy(value bson.RawValue) bool {
+	if value.Type != bson.TypeArray {
+		return isNumber(value)
+	}
+
+	values, err := value.Array().Values()
+	if err != nil {
+		return false
+	}
+
+	for _, element := range values {
+		if isNumber(element) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+DecodeString - Decodes a value that holds either a string, or the number of an enum value from the protobuf models,
+converting the number with the table provided in the parameter. A missing or null value is returned as an empty string.
+If the number has no string equivalent, then ErrUnknownLegacyValue is returned
+*/
+func DecodeString(value bson.RawValue, table []string) (string, error) {
+	switch value.Type {
+	case 0, bson.TypeNull, bson.TypeUndefined:
+		return "", nil
+	case bson.TypeString:
+		return value.StringValue(), nil
+	}
+
+	number, ok := value.AsInt64OK()
+	if !ok {
+		return "", fmt.Errorf("%w (unexpected type: %s)", ErrUnknownLegacyValue, value.Type)
+	}
+
+	if number < 0 || number >= int64(len(table)) {
+		return "", fmt.Errorf("%w (%d)", ErrUnknownLegacyValue, number)
+	}
+
+	return table[number], nil
+}
+
+/*
+DecodeStrings - Decodes an array whose elements are each decoded with DecodeString, so that arrays mixing strings and
+enum numbers are converted as well. A missing or null value is returned as a nil slice
+*/
+func DecodeStrings(value bson.RawValue, table []string) ([]string, error) {
+	switch value.Type {
+	case 0, bson.TypeNull, bson.TypeUndefined:
+		return nil, nil
+	case bson.TypeArray:
+	default:
+		return nil, fmt.Errorf("%w (unexpected type: %s)", ErrUnknownLegacyValue, value.Type)
+	}
+
+	values, err := value.Array().Values()
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrUnknownLegacyValue, err)
+	}
+
+	ret := make([]string, 0, len(values))
+	for _, element := range values {
+		decoded, err := DecodeString(element, table)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, decoded)
+	}
+
+	return ret, nil
+}
+
+/*
+isNumber - Determines if the value provided in the parameter is a number of any BSON numeric type
+*/
+func isNumber(value bson.RawValue) bool {
+	switch value.Type {
+	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble:
+		return true
+	default:
+		return false
+	}
+}
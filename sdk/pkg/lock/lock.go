@@ -0,0 +1,247 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrLockHeld - Returned when the lock is currently held by another replica
+var ErrLockHeld = credstackError.NewError(409, "ERR_LOCK_HELD", "lock: The lock is currently held by another replica")
+
+// waitInterval - How often WaitWithLock attempts to acquire a lock that is held by another replica
+const waitInterval = time.Second
+
+// ErrLockLost - Returned when a lease could not be renewed, as it expired and was taken over by another replica
+var ErrLockLost = credstackError.NewError(409, "ERR_LOCK_LOST", "lock: The lease expired and was taken over by another replica")
+
+/*
+Lock - Represents a lease on a singleton task that is stored in the lock collection. The name of the lock is used as the
+document's _id, so MongoDB's built-in unique index on _id guarantees that only one replica can insert it
+*/
+type Lock struct {
+	// Name - The name of the singleton task this lock protects (preflight, key.rotate:RS256:audience)
+	Name string `json:"name" bson:"_id"`
+
+	// Owner - Identifies the replica currently holding the lock. See LockConfig.OwnerID. Only recorded so that operators can tell who holds it
+	Owner string `json:"owner" bson:"owner"`
+
+	// Token - A random value generated every time the lock is acquired. The lease is renewed and released by this, so that only the acquisition that holds the lock can extend or release it
+	Token string `json:"-" bson:"token"`
+
+	// AcquiredAt - A unix timestamp representing when the current owner acquired the lock
+	AcquiredAt int64 `json:"acquired_at" bson:"acquired_at"`
+
+	// ExpiresAt - A unix timestamp representing when the lease expires and the lock can be taken over by another replica
+	ExpiresAt int64 `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+Lease - A lock that is currently held by this replica. Renew must be called before the lease expires if the task takes
+longer than LockConfig.LeaseTTL, and Release should be called once the task has completed
+*/
+type Lease struct {
+	// serv - The server the lock was acquired with
+	serv *server.Server
+
+	// name - The name of the lock that is held
+	name string
+
+	// token - The random token that was recorded on the lock when it was acquired
+	token string
+}
+
+/*
+Acquire - Attempts to acquire the lock provided in the parameter. A lock can be acquired if it does not exist, or if its
+lease has expired. If anyone holds an unexpired lease, including another goroutine of this replica, then ErrLockHeld is
+returned. This does not block, callers that need to wait for the lock should retry.
+
+Lease expiry is evaluated with the server's clock, so replicas need reasonably synchronized clocks. LeaseTTL should be
+set comfortably above any expected clock skew
+*/
+func Acquire(serv *server.Server, name string) (*Lease, error) {
+	/*
+		The token identifies this acquisition rather than the replica, so that two tasks in the same process (or two
+		replicas that were configured with the same owner) can never both believe they hold the lock
+	*/
+	token, err := secret.RandString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := serv.Clock().Now()
+
+	/*
+		If the lock exists with an unexpired lease, the filter does not match it and the upsert attempts to insert a new
+		document with the same _id. This fails with a duplicate key error, which is how we know the lock is held
+	*/
+	_, err = serv.Database().Collection("lock").UpdateOne(
+		serv.Context(),
+		bson.M{
+			"_id":        name,
+			"expires_at": bson.M{"$lte": now.Unix()},
+		},
+		bson.M{"$set": bson.M{
+			"owner":       serv.Config.LockConfig.OwnerID(),
+			"token":       token,
+			"acquired_at": now.Unix(),
+			"expires_at":  now.Add(serv.Config.LockConfig.LeaseTTL).Unix(),
+		}},
+		mongoOpts.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		var writeErr mongo.WriteException
+		if errors.As(err, &writeErr) && writeErr.HasErrorCode(11000) {
+			return nil, ErrLockHeld
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &Lease{serv: serv, name: name, token: token}, nil
+}
+
+/*
+Renew - Extends the lease by LockConfig.LeaseTTL. If the lease has already been taken over by another replica, then
+ErrLockLost is returned and the task holding the lease should stop
+*/
+func (lease *Lease) Renew() error {
+	result, err := lease.serv.Database().Collection("lock").UpdateOne(
+		context.Background(),
+		bson.M{"_id": lease.name, "token": lease.token},
+		bson.M{"$set": bson.M{"expires_at": lease.serv.Clock().Now().Add(lease.serv.Config.LockConfig.LeaseTTL).Unix()}},
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrLockLost
+	}
+
+	return nil
+}
+
+/*
+Release - Releases the lease so that another replica can acquire the lock immediately. If the lease was already taken
+over by another replica, then this does nothing
+*/
+func (lease *Lease) Release() error {
+	_, err := lease.serv.Database().Collection("lock").DeleteOne(
+		context.Background(),
+		bson.M{"_id": lease.name, "token": lease.token},
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return nil
+}
+
+/*
+WithLock - Acquires the lock provided in the parameter, calls fn, and then releases the lock. The lease is renewed in the
+background while fn is running, so fn can take longer than LockConfig.LeaseTTL. If another replica holds the lock, then
+fn is not called and ErrLockHeld is returned.
+
+fn is called with a context that is derived from the context of the server, and that is cancelled if the lease is lost
+(another replica took it over after a renewal failed to reach the database in time). fn must pass it to everything it
+does while holding the lock, such as with server.WithContext, so that it stops as soon as it no longer has exclusive
+access. If the lease was lost, then ErrLockLost is returned regardless of what fn returned
+*/
+func WithLock(serv *server.Server, name string, fn func(ctx context.Context) error) error {
+	lease, err := Acquire(serv, name)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(serv.Context())
+	defer cancel()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	var lost bool
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(max(serv.Config.LockConfig.LeaseTTL/3, time.Second))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := lease.Renew()
+				if errors.Is(err, ErrLockLost) {
+					serv.Log().LogErrorEvent("Lost lock while holding it: "+name, err)
+
+					lost = true
+					cancel()
+
+					return
+				}
+
+				if err != nil {
+					serv.Log().LogErrorEvent("Failed to renew lock: "+name, err)
+				}
+			}
+		}
+	}()
+
+	err = fn(ctx)
+
+	close(done)
+	<-stopped
+
+	if lost {
+		return ErrLockLost
+	}
+
+	releaseErr := lease.Release()
+	if releaseErr != nil {
+		serv.Log().LogErrorEvent("Failed to release lock: "+name, releaseErr)
+	}
+
+	return err
+}
+
+/*
+WaitWithLock - Acquires the lock provided in the parameter like WithLock, but waits for it if another replica holds it
+instead of returning ErrLockHeld. Acquiring the lock is attempted again every second, until the replica holding it
+releases it or its lease expires (if the replica crashed). onWait is called once, the first time the lock is found to be
+held, so that callers can report that they are waiting. If the context is cancelled before the lock is acquired, then
+fn is not called and the error of the context is returned. The context fn is called with is derived from the context
+provided in the parameter, and is also cancelled if the lease is lost (see WithLock)
+*/
+func WaitWithLock(ctx context.Context, serv *server.Server, name string, onWait func(), fn func(ctx context.Context) error) error {
+	waiting := false
+
+	for {
+		err := WithLock(serv.WithContext(ctx), name, fn)
+		if !errors.Is(err, ErrLockHeld) {
+			return err
+		}
+
+		if !waiting && onWait != nil {
+			onWait()
+		}
+
+		waiting = true
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitInterval):
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package management
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/resourceserver"
+	"github.com/credstack/credstack/sdk/pkg/oauth/scope"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrInsufficientScope - Provides a named error for when a management request is made with an access token that was not issued with the scopes the route requires. Uses the error code defined in RFC 6750 section 3.1
+var ErrInsufficientScope = credstackError.NewError(403, "insufficient_scope", "management: The access token was not issued with the scopes required by this route")
+
+// ErrAdminClientDoesNotExist - Provides a named error for when the admin client has not been bootstrapped yet
+var ErrAdminClientDoesNotExist = credstackError.NewError(404, "ERR_ADMIN_CLIENT_NOT_EXIST", "management: The admin client has not been bootstrapped. Start the API with preflight checks enabled")
+
+/*
+Authenticate - Authenticates a management request with its bearer access token. The token must be active (see
+token.Lookup), and must have been issued for the management audience. The issued token is returned so that the scopes
+it was issued with can be checked for each route with RequireScopes and RequiredScope
+*/
+func Authenticate(serv *server.Server, accessToken string) (*token.Token, error) {
+	issued, err := token.Lookup(serv, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if issued.Audience != serv.Config.ManagementConfig.Audience {
+		return nil, fmt.Errorf("%w (token was issued for %s)", token.ErrInvalidAccessToken, issued.Audience)
+	}
+
+	return issued, nil
+}
+
+/*
+RequireScopes - Ensures that the token was issued with every scope provided in the parameter. If it was not, then
+ErrInsufficientScope is returned with the missing scopes appended to it
+*/
+func RequireScopes(issued *token.Token, scopes ...string) error {
+	granted := strings.Fields(issued.Scope)
+
+	var missing []string
+	for _, name := range scopes {
+		if !slices.Contains(granted, name) {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) != 0 {
+		return fmt.Errorf("%w (missing %s)", ErrInsufficientScope, strings.Join(missing, " "))
+	}
+
+	return nil
+}
+
+/*
+Bootstrap - Creates the resource server that represents the management API, registers every scope in the Catalog on it,
+and creates a confidential admin client that can issue tokens for it with the client credentials grant. The resource
+server issues RS256 tokens and enforces RBAC, so that users can be granted management scopes through their roles.
+
+Every step is skipped if it was already completed, so this is safe to call on every start, and completes a bootstrap
+that was interrupted. Changes made to the resource server or admin client after they were bootstrapped are never
+overwritten. The client ID of the admin client is returned if it was created by this call, or an empty string if it
+already existed. The client secret can be read with AdminClient
+*/
+func Bootstrap(serv *server.Server) (string, error) {
+	config := serv.Config.ManagementConfig
+
+	_, err := resourceserver.Get(serv, config.Audience)
+	if errors.Is(err, resourceserver.ErrServerDoesNotExist) {
+		err = resourceserver.New(serv, "credstack management API", config.Audience, "RS256")
+		if err != nil && !errors.Is(err, resourceserver.ErrServerAlreadyExists) {
+			return "", err
+		}
+
+		err = resourceserver.Update(serv, config.Audience, &resourceserver.ResourceServer{TokenType: "RS256", EnforceRBAC: true})
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, definition := range Catalog {
+		err = scope.New(serv, &scope.Scope{
+			Name:        definition.Name,
+			Description: definition.Description,
+			ConsentText: definition.Description,
+			Audience:    config.Audience,
+		})
+		if err != nil && !errors.Is(err, scope.ErrScopeAlreadyExists) {
+			return "", err
+		}
+	}
+
+	_, err = AdminClient(serv)
+	if !errors.Is(err, ErrAdminClientDoesNotExist) {
+		return "", err
+	}
+
+	clientId, err := client.New(serv, config.ClientName, false, client.GrantTypeClientCredentials)
+	if err != nil {
+		return "", err
+	}
+
+	err = client.Update(serv, clientId, &client.Client{
+		AllowedAudiences: []string{config.Audience},
+		DefaultScopes:    Scopes(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return clientId, nil
+}
+
+/*
+AdminClient - Fetches the admin client that was bootstrapped for the management API, along with its client secret. If
+the management API has not been bootstrapped, then ErrAdminClientDoesNotExist is returned
+*/
+func AdminClient(serv *server.Server) (*client.Client, error) {
+	config := serv.Config.ManagementConfig
+
+	var ret client.Client
+
+	err := serv.Database().Collection("client").FindOne(
+		serv.Context(),
+		bson.M{"name": config.ClientName, "allowed_audiences": config.Audience},
+	).Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAdminClientDoesNotExist
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
@@ -0,0 +1,272 @@
+package management
+
+import (
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrUnmappedRoute - Provides a named error for when a management request is made to a route that no scope is mapped to. These are always rejected, so that a route can never be exposed without authorization by forgetting to map it
+var ErrUnmappedRoute = credstackError.NewError(403, "insufficient_scope", "management: No scope is mapped to this route of the management API")
+
+/*
+The names of the management scopes. See Catalog for what each of them grants access to
+*/
+const (
+	ScopeReadUsers   = "read:users"
+	ScopeCreateUsers = "create:users"
+	ScopeUpdateUsers = "update:users"
+	ScopeDeleteUsers = "delete:users"
+
+	ScopeReadClients   = "read:clients"
+	ScopeCreateClients = "create:clients"
+	ScopeUpdateClients = "update:clients"
+	ScopeDeleteClients = "delete:clients"
+
+	ScopeReadResourceServers   = "read:resource_servers"
+	ScopeCreateResourceServers = "create:resource_servers"
+	ScopeUpdateResourceServers = "update:resource_servers"
+	ScopeDeleteResourceServers = "delete:resource_servers"
+
+	ScopeReadScopes   = "read:scopes"
+	ScopeCreateScopes = "create:scopes"
+	ScopeUpdateScopes = "update:scopes"
+	ScopeDeleteScopes = "delete:scopes"
+
+	ScopeReadRoles   = "read:roles"
+	ScopeCreateRoles = "create:roles"
+	ScopeUpdateRoles = "update:roles"
+	ScopeDeleteRoles = "delete:roles"
+	ScopeAssignRoles = "assign:roles"
+
+	ScopeReadApprovals   = "read:approvals"
+	ScopeCreateApprovals = "create:approvals"
+	ScopeDecideApprovals = "decide:approvals"
+
+	ScopeReadBanners   = "read:banners"
+	ScopeCreateBanners = "create:banners"
+	ScopeDeleteBanners = "delete:banners"
+
+	ScopeReadSessions   = "read:sessions"
+	ScopeDeleteSessions = "delete:sessions"
+
+	ScopeReadTokens      = "read:tokens"
+	ScopeReadRevocations = "read:revocations"
+
+	ScopeRotateKeys = "rotate:keys"
+	ScopeImportKeys = "import:keys"
+
+	ScopeReadConfig    = "read:config"
+	ScopeReadAudit     = "read:audit"
+	ScopeReadTelemetry = "read:telemetry"
+)
+
+/*
+ScopeDefinition - Describes a management scope, as it is registered on the management resource server
+*/
+type ScopeDefinition struct {
+	// Name - The name of the scope, as it is requested and inserted into tokens
+	Name string
+
+	// Description - What the scope grants access to. Registered as both the description and consent text of the scope
+	Description string
+}
+
+/*
+Catalog - Every scope the management API authorizes requests with. These are registered on the management resource
+server on every start, so that scopes added in a release are available to existing deployments. The admin client is
+bootstrapped with every scope in the Catalog as its default scopes, however scopes added after it was bootstrapped have
+to be added to it
+*/
+var Catalog = []ScopeDefinition{
+	{ScopeReadUsers, "Read and export users"},
+	{ScopeCreateUsers, "Create and import users"},
+	{ScopeUpdateUsers, "Update users, their metadata, and their linked identities"},
+	{ScopeDeleteUsers, "Delete users"},
+
+	{ScopeReadClients, "Read clients"},
+	{ScopeCreateClients, "Create clients and canary clients"},
+	{ScopeUpdateClients, "Update clients"},
+	{ScopeDeleteClients, "Delete clients"},
+
+	{ScopeReadResourceServers, "Read resource servers"},
+	{ScopeCreateResourceServers, "Create resource servers"},
+	{ScopeUpdateResourceServers, "Update resource servers"},
+	{ScopeDeleteResourceServers, "Delete resource servers"},
+
+	{ScopeReadScopes, "Read the scopes of resource servers"},
+	{ScopeCreateScopes, "Register scopes on resource servers"},
+	{ScopeUpdateScopes, "Update the scopes of resource servers"},
+	{ScopeDeleteScopes, "Delete the scopes of resource servers"},
+
+	{ScopeReadRoles, "Read roles, and the roles assigned to users"},
+	{ScopeCreateRoles, "Create roles"},
+	{ScopeUpdateRoles, "Update roles"},
+	{ScopeDeleteRoles, "Delete roles"},
+	{ScopeAssignRoles, "Assign roles to users, and unassign them"},
+
+	{ScopeReadApprovals, "Read approval requests"},
+	{ScopeCreateApprovals, "Request approval for destructive actions"},
+	{ScopeDecideApprovals, "Approve or reject approval requests"},
+
+	{ScopeReadBanners, "Read the maintenance banner"},
+	{ScopeCreateBanners, "Publish the maintenance banner"},
+	{ScopeDeleteBanners, "Remove the maintenance banner"},
+
+	{ScopeReadSessions, "Read the sessions of users"},
+	{ScopeDeleteSessions, "Revoke the sessions of users"},
+
+	{ScopeReadTokens, "Read and export issued tokens"},
+	{ScopeReadRevocations, "Read the feed of revoked tokens"},
+
+	{ScopeRotateKeys, "Stage new signing keys"},
+	{ScopeImportKeys, "Import signing keys"},
+
+	{ScopeReadConfig, "Read the history of configuration changes"},
+	{ScopeReadAudit, "Read and export the audit log"},
+	{ScopeReadTelemetry, "Preview the telemetry report"},
+}
+
+/*
+RouteGroup - The scope required by every route of a route group of the management API
+*/
+type RouteGroup struct {
+	// Prefix - The path the route group is mounted at (/user)
+	Prefix string
+
+	// Routes - The scope each route requires, keyed by its method and its path relative to Prefix (GET /export). The route at Prefix itself is keyed by its method alone
+	Routes map[string]string
+}
+
+/*
+RouteGroups - Maps every route of the management API to the least privileged scope that authorizes it. Reading requires
+a read scope, and every change requires the scope of the change, so that a token can be limited to exactly the
+operations it is used for
+*/
+var RouteGroups = []RouteGroup{
+	{"/user", map[string]string{
+		"GET":                     ScopeReadUsers,
+		"GET /export":             ScopeReadUsers,
+		"POST":                    ScopeCreateUsers,
+		"POST /import":            ScopeCreateUsers,
+		"POST /import/bulk":       ScopeCreateUsers,
+		"PATCH":                   ScopeUpdateUsers,
+		"PATCH /user_metadata":    ScopeUpdateUsers,
+		"PATCH /app_metadata":     ScopeUpdateUsers,
+		"POST /identities":        ScopeUpdateUsers,
+		"PUT /identities/primary": ScopeUpdateUsers,
+		"DELETE /identities":      ScopeUpdateUsers,
+		"DELETE":                  ScopeDeleteUsers,
+	}},
+	{"/client", map[string]string{
+		"GET":          ScopeReadClients,
+		"POST":         ScopeCreateClients,
+		"POST /canary": ScopeCreateClients,
+		"PATCH":        ScopeUpdateClients,
+		"DELETE":       ScopeDeleteClients,
+	}},
+	{"/resource_server", map[string]string{
+		"GET":    ScopeReadResourceServers,
+		"POST":   ScopeCreateResourceServers,
+		"PATCH":  ScopeUpdateResourceServers,
+		"DELETE": ScopeDeleteResourceServers,
+	}},
+	{"/scope", map[string]string{
+		"GET":    ScopeReadScopes,
+		"POST":   ScopeCreateScopes,
+		"PATCH":  ScopeUpdateScopes,
+		"DELETE": ScopeDeleteScopes,
+	}},
+	{"/role", map[string]string{
+		"GET":          ScopeReadRoles,
+		"POST":         ScopeCreateRoles,
+		"PATCH":        ScopeUpdateRoles,
+		"DELETE":       ScopeDeleteRoles,
+		"GET /user":    ScopeReadRoles,
+		"POST /user":   ScopeAssignRoles,
+		"DELETE /user": ScopeAssignRoles,
+	}},
+	{"/approval", map[string]string{
+		"GET":           ScopeReadApprovals,
+		"POST":          ScopeCreateApprovals,
+		"POST /approve": ScopeDecideApprovals,
+		"POST /reject":  ScopeDecideApprovals,
+	}},
+	{"/banner", map[string]string{
+		"GET":    ScopeReadBanners,
+		"POST":   ScopeCreateBanners,
+		"DELETE": ScopeDeleteBanners,
+	}},
+	{"/session", map[string]string{
+		"GET":    ScopeReadSessions,
+		"DELETE": ScopeDeleteSessions,
+	}},
+	{"/token", map[string]string{
+		"GET":         ScopeReadTokens,
+		"GET /export": ScopeReadTokens,
+	}},
+	{"/region", map[string]string{
+		"GET /revocations": ScopeReadRevocations,
+	}},
+	{"/key", map[string]string{
+		"POST /stage":  ScopeRotateKeys,
+		"POST /import": ScopeImportKeys,
+	}},
+	{"/config", map[string]string{
+		"GET /history": ScopeReadConfig,
+	}},
+	{"/audit", map[string]string{
+		"GET":         ScopeReadAudit,
+		"GET /export": ScopeReadAudit,
+	}},
+	{"/telemetry", map[string]string{
+		"GET /preview": ScopeReadTelemetry,
+	}},
+}
+
+/*
+Scopes - Returns the names of every scope in the Catalog
+*/
+func Scopes() []string {
+	ret := make([]string, 0, len(Catalog))
+	for _, definition := range Catalog {
+		ret = append(ret, definition.Name)
+	}
+
+	return ret
+}
+
+/*
+RequiredScope - Returns the scope that a request to the management API with the method and path provided in the
+parameters requires, from RouteGroups. A trailing slash on the path is ignored, and HEAD requests require the scope of
+the GET route. If no scope is mapped to the route, then
+ErrUnmappedRoute is returned
+*/
+func RequiredScope(method string, path string) (string, error) {
+	path = strings.TrimSuffix(path, "/")
+
+	/*
+		Fiber answers HEAD requests with the handler of the GET route, so they are authorized in the same way
+	*/
+	if method == "HEAD" {
+		method = "GET"
+	}
+
+	for _, group := range RouteGroups {
+		relative, ok := strings.CutPrefix(path, group.Prefix)
+		if !ok || (relative != "" && !strings.HasPrefix(relative, "/")) {
+			continue
+		}
+
+		key := method
+		if relative != "" {
+			key += " " + relative
+		}
+
+		if name, ok := group.Routes[key]; ok {
+			return name, nil
+		}
+	}
+
+	return "", ErrUnmappedRoute
+}
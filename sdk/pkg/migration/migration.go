@@ -0,0 +1,294 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/legacy"
+	"github.com/credstack/credstack/sdk/pkg/lock"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DefaultBatchSize - The number of documents rewritten at once when no batch size is provided
+const DefaultBatchSize = 500
+
+// ErrUnexpectedType - Returned for a document whose field holds a value of a type that the migration cannot convert
+var ErrUnexpectedType = credstackError.NewError(500, "ERR_MIGRATION_UNEXPECTED_TYPE", "migration: A document holds a value of an unexpected type")
+
+/*
+Migration - Rewrites documents in a single collection. Documents are selected with Filter, and each one is passed to
+Rewrite, which returns the fields to set on it
+*/
+type Migration struct {
+	// Name - The name of the migration, as it is reported in Progress
+	Name string
+
+	// Collection - The collection the migration rewrites, as it is named throughout credstack
+	Collection string
+
+	// Field - The field the migration rewrites. A document is only rewritten if this field still holds the value it was read with, so that concurrent writes are never overwritten
+	Field string
+
+	// Target - The field the rewritten value is set on, for migrations that derive one field from another. Defaults to Field
+	Target string
+
+	// Filter - Selects the documents that still need to be rewritten. Once a document is rewritten, it must no longer match
+	Filter bson.M
+
+	// Rewrite - Converts the value of Field into the value it is rewritten with
+	Rewrite func(serv *server.Server, value bson.RawValue) (any, error)
+
+	// Required - If set to true, indexes depend on the migration, so it is applied by ApplyRequired before they are built instead of waiting for Run
+	Required bool
+}
+
+/*
+Migrations - Every migration that Run applies, in the order they are applied
+*/
+var Migrations = []Migration{
+	{
+		Name:       "resource_server.token_type",
+		Collection: "resource_server",
+		Field:      "token_type",
+		Filter:     bson.M{"token_type": bson.M{"$type": "number"}},
+		Rewrite: func(serv *server.Server, value bson.RawValue) (any, error) {
+			return legacy.DecodeString(value, legacy.TokenTypes)
+		},
+	},
+	{
+		Name:       "client.grant_types",
+		Collection: "client",
+		Field:      "grant_types",
+		Filter:     bson.M{"grant_types": bson.M{"$elemMatch": bson.M{"$type": "number"}}},
+		Rewrite: func(serv *server.Server, value bson.RawValue) (any, error) {
+			return legacy.DecodeStrings(value, legacy.GrantTypes)
+		},
+	},
+	{
+		/*
+			Users created before email addresses were normalized have no canonical email, so they cannot be found by it,
+			and they would all collide on null in its unique index
+		*/
+		Name:       "user.canonical_email",
+		Collection: "user",
+		Field:      "email",
+		Target:     "canonical_email",
+		Filter:     bson.M{"canonical_email": nil},
+		Rewrite: func(serv *server.Server, value bson.RawValue) (any, error) {
+			email, ok := value.StringValueOK()
+			if !ok {
+				return nil, fmt.Errorf("%w (email: %s)", ErrUnexpectedType, value.Type)
+			}
+
+			return user.NormalizeEmail(email, serv.Config.EmailConfig), nil
+		},
+		Required: true,
+	},
+}
+
+/*
+Options - Controls how Run applies the migrations
+*/
+type Options struct {
+	// DryRun - If set to true, every document is converted but nothing is written, so that the migrations can be checked before they are applied
+	DryRun bool
+
+	// BatchSize - The number of documents read and rewritten at once. Reset to DefaultBatchSize if zero or less
+	BatchSize int
+
+	// OnProgress - Called after every batch with the progress of the migration it belongs to. Optional
+	OnProgress func(progress Progress)
+}
+
+/*
+Progress - The progress of a single migration
+*/
+type Progress struct {
+	// Migration - The name of the migration
+	Migration string `json:"migration" yaml:"migration"`
+
+	// Pending - The number of documents that needed to be rewritten when the migration started
+	Pending int64 `json:"pending" yaml:"pending"`
+
+	// Rewritten - The number of documents that were rewritten. In a dry run, the number of documents that would have been
+	Rewritten int64 `json:"rewritten" yaml:"rewritten"`
+
+	// Skipped - The number of documents that were changed by someone else between being read and rewritten, and were left as they are
+	Skipped int64 `json:"skipped" yaml:"skipped"`
+
+	// Failed - The number of documents that could not be converted. These are left as they are, and are reported in Errors
+	Failed int64 `json:"failed" yaml:"failed"`
+
+	// Errors - Why each document that failed could not be converted
+	Errors []string `json:"errors" yaml:"errors"`
+}
+
+/*
+Run - Applies every migration in Migrations. Documents are read in batches sorted by their object ID and rewritten with a
+single bulk write per batch, so that the migrations can be run while credstack is serving requests: documents that have
+not been rewritten yet are still read by the compatibility decoding in the legacy package. Running the migrations again
+once they have completed is a no-op.
+
+The migrations are applied while holding a lock, so that they are only ever run by one replica at a time. If another
+replica is already running them, then lock.ErrLockHeld is returned and nothing is applied.
+
+The progress of every migration is returned, including the ones that had nothing to rewrite. If a database call fails,
+then the migrations stop and the progress up to that point is returned along with the error
+*/
+func Run(serv *server.Server, opts Options) ([]Progress, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	ret := make([]Progress, 0, len(Migrations))
+
+	err := lock.WithLock(serv, "migrate", func(ctx context.Context) error {
+		serv := serv.WithContext(ctx)
+
+		for _, migration := range Migrations {
+			progress, err := run(serv, migration, opts)
+			ret = append(ret, progress)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return ret, err
+}
+
+/*
+ApplyRequired - Applies every migration in Migrations that indexes depend on. This is called by the pre-flight checks
+before the indexes are built, so unlike Run it does not take the migration lock: the pre-flight checks are already held
+under their own, and the migrations never overwrite a concurrent write, so running them alongside Run is safe. If a
+document cannot be converted, then the migrations stop and the error is returned, as the indexes cannot be built
+*/
+func ApplyRequired(serv *server.Server) error {
+	for _, migration := range Migrations {
+		if !migration.Required {
+			continue
+		}
+
+		progress, err := run(serv, migration, Options{BatchSize: DefaultBatchSize})
+		if err != nil {
+			return err
+		}
+
+		if progress.Failed != 0 {
+			return fmt.Errorf("%w (%s: %s)", ErrUnexpectedType, migration.Name, progress.Errors[0])
+		}
+	}
+
+	return nil
+}
+
+/*
+run - Applies a single migration with the options provided in the parameter
+*/
+func run(serv *server.Server, migration Migration, opts Options) (Progress, error) {
+	progress := Progress{Migration: migration.Name, Errors: make([]string, 0)}
+
+	target := migration.Target
+	if target == "" {
+		target = migration.Field
+	}
+
+	collection := serv.Database().Collection(migration.Collection)
+
+	pending, err := collection.CountDocuments(context.Background(), migration.Filter)
+	if err != nil {
+		return progress, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	progress.Pending = pending
+
+	/*
+		Documents are paged through by their object ID instead of re-running the filter from the start, as documents that
+		fail to convert (or every document, in a dry run) keep matching the filter
+	*/
+	var after any
+
+	for {
+		filter := bson.M{}
+		for key, value := range migration.Filter {
+			filter[key] = value
+		}
+
+		if after != nil {
+			filter["_id"] = bson.M{"$gt": after}
+		}
+
+		cursor, err := collection.Find(
+			context.Background(),
+			filter,
+			mongoOpts.Find().
+				SetProjection(bson.M{"_id": 1, migration.Field: 1}).
+				SetSort(bson.D{{Key: "_id", Value: 1}}).
+				SetLimit(int64(opts.BatchSize)),
+		)
+		if err != nil {
+			return progress, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		var batch []bson.Raw
+
+		err = cursor.All(context.Background(), &batch)
+		if err != nil {
+			return progress, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		if len(batch) == 0 {
+			return progress, nil
+		}
+
+		models := make([]mongo.WriteModel, 0, len(batch))
+		for _, document := range batch {
+			id := document.Lookup("_id")
+			after = id
+
+			original := document.Lookup(migration.Field)
+
+			rewritten, err := migration.Rewrite(serv, original)
+			if err != nil {
+				progress.Failed++
+				progress.Errors = append(progress.Errors, fmt.Sprintf("%s %v: %v", migration.Collection, id, err))
+				continue
+			}
+
+			/*
+				The original value is part of the filter, so that a document updated by someone else since it was read is
+				skipped instead of having their update overwritten
+			*/
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.D{{Key: "_id", Value: id}, {Key: migration.Field, Value: original}}).
+				SetUpdate(bson.M{"$set": bson.M{target: rewritten}}),
+			)
+		}
+
+		switch {
+		case len(models) == 0:
+		case opts.DryRun:
+			progress.Rewritten += int64(len(models))
+		default:
+			result, err := collection.BulkWrite(context.Background(), models, mongoOpts.BulkWrite().SetOrdered(false))
+			if err != nil {
+				return progress, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+			}
+
+			progress.Rewritten += result.ModifiedCount
+			progress.Skipped += int64(len(models)) - result.MatchedCount
+		}
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package request
+
+/*
+AuthorizationRequest - A request to the authorization endpoint as defined in RFC 6749 section 4.1.1 and OpenID Connect
+Core 1.0 section 3.1.2.1. These are sent as query parameters when the user agent is redirected to credstack, and are
+posted back as form fields from the hosted login page
+*/
+type AuthorizationRequest struct {
+	// ResponseType - The response type combination being requested (code, id_token, code id_token). The order of the values does not matter
+	ResponseType string `json:"response_type" bson:"response_type" query:"response_type" form:"response_type"`
+
+	// ClientId - The client id of the application requesting authorization
+	ClientId string `json:"client_id" bson:"client_id" query:"client_id" form:"client_id"`
+
+	// RedirectUri - The URI the user agent is redirected to once authorization completes. Must match the one registered on the client
+	RedirectUri string `json:"redirect_uri" bson:"redirect_uri" query:"redirect_uri" form:"redirect_uri"`
+
+	// Audience - The audience for the API the client wants a token for
+	Audience string `json:"audience" bson:"audience" query:"audience" form:"audience"`
+
+	// Scope - A space separated list of the scopes being requested. Must include openid if an ID token is requested
+	Scope string `json:"scope" bson:"scope" query:"scope" form:"scope"`
+
+	// State - An opaque value returned to the client unchanged, used to protect against CSRF
+	State string `json:"state" bson:"state" query:"state" form:"state"`
+
+	// Nonce - A value inserted into the ID token to protect against replay. Required if an ID token is requested
+	Nonce string `json:"nonce" bson:"nonce" query:"nonce" form:"nonce"`
+
+	// CodeChallenge - The PKCE code challenge (RFC 7636) the authorization code is bound to. Required for public clients
+	CodeChallenge string `json:"code_challenge" bson:"code_challenge" query:"code_challenge" form:"code_challenge"`
+
+	// CodeChallengeMethod - The method the code challenge was derived with. Only S256 is supported
+	CodeChallengeMethod string `json:"code_challenge_method" bson:"code_challenge_method" query:"code_challenge_method" form:"code_challenge_method"`
+
+	// Prompt - A space separated list of how the user should be prompted (none, login, consent). none must be sent alone, and completes the request without displaying any page
+	Prompt string `json:"prompt" bson:"prompt" query:"prompt" form:"prompt"`
+
+	// ResponseMode - How the authorization response is returned to the client (query, fragment, web_message). Defaults to the mode of the response type
+	ResponseMode string `json:"response_mode" bson:"response_mode" query:"response_mode" form:"response_mode"`
+
+	// Request - A request object (RFC 9101) containing the parameters above as claims, signed with one of the client's registered keys
+	Request string `json:"request" bson:"request" query:"request" form:"request"`
+
+	// RequestUri - A reference to a request object. This is not supported, and is only bound so that it can be rejected
+	RequestUri string `json:"request_uri" bson:"request_uri" query:"request_uri" form:"request_uri"`
+}
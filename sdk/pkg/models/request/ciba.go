@@ -0,0 +1,58 @@
+package request
+
+/*
+BackchannelAuthenticationRequest - The request a client sends to the backchannel authentication endpoint to start the
+client initiated backchannel authentication grant (OpenID CIBA Core 1.0 section 7.1)
+*/
+type BackchannelAuthenticationRequest struct {
+	// ClientId - The client id of the application requesting authentication
+	ClientId string `json:"client_id" bson:"client_id" query:"client_id" form:"client_id"`
+
+	// ClientSecret - The client secret of the application. Backchannel authentication is only available to confidential clients
+	ClientSecret string `json:"client_secret" bson:"client_secret" query:"client_secret" form:"client_secret"`
+
+	// Audience - The audience for the API the client wants a token for
+	Audience string `json:"audience" bson:"audience" query:"audience" form:"audience"`
+
+	// Scope - A space separated list of the scopes being requested. Must include openid
+	Scope string `json:"scope" bson:"scope" query:"scope" form:"scope"`
+
+	// LoginHint - The email address of the user being asked to authenticate
+	LoginHint string `json:"login_hint" bson:"login_hint" query:"login_hint" form:"login_hint"`
+
+	// IdTokenHint - An ID token identifying the user. Not supported, and only bound so that it can be rejected
+	IdTokenHint string `json:"id_token_hint" bson:"id_token_hint" query:"id_token_hint" form:"id_token_hint"`
+
+	// LoginHintToken - A token identifying the user. Not supported, and only bound so that it can be rejected
+	LoginHintToken string `json:"login_hint_token" bson:"login_hint_token" query:"login_hint_token" form:"login_hint_token"`
+
+	// BindingMessage - A short message displayed on both the consumption device and the authentication device, so that the user can tell the request is theirs
+	BindingMessage string `json:"binding_message" bson:"binding_message" query:"binding_message" form:"binding_message"`
+
+	// ClientNotificationToken - The bearer token credstack sends to the client's notification endpoint. Required for clients using the ping delivery mode
+	ClientNotificationToken string `json:"client_notification_token" bson:"client_notification_token" query:"client_notification_token" form:"client_notification_token"`
+
+	// RequestedExpiry - The lifetime (in seconds) the client wants the request to have. Cannot exceed the configured lifetime
+	RequestedExpiry int64 `json:"requested_expiry" bson:"requested_expiry" query:"requested_expiry" form:"requested_expiry"`
+
+	// RemoteAddr - The IP address the request originated from. This is set by the API and never bound from the request
+	RemoteAddr string `json:"-" bson:"-" query:"-" form:"-"`
+}
+
+/*
+BackchannelVerificationRequest - The request the user's authentication device sends to approve or deny a backchannel
+authentication request
+*/
+type BackchannelVerificationRequest struct {
+	// AuthReqId - The identifier of the backchannel authentication request, as sent to the user notification endpoint
+	AuthReqId string `json:"auth_req_id" bson:"auth_req_id" query:"auth_req_id" form:"auth_req_id"`
+
+	// Email - The email address of the user approving the request
+	Email string `json:"email" bson:"email" query:"email" form:"email"`
+
+	// Password - The password of the user approving the request
+	Password string `json:"password" bson:"password" query:"password" form:"password"`
+
+	// Approve - If set to true, the request is approved. Otherwise, it is denied
+	Approve bool `json:"approve" bson:"approve" query:"approve" form:"approve"`
+}
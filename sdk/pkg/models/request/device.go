@@ -0,0 +1,29 @@
+package request
+
+/*
+DeviceAuthorizationRequest - The request a device sends to start the device authorization grant (RFC 8628)
+*/
+type DeviceAuthorizationRequest struct {
+	// ClientId - The client id of the application running on the device
+	ClientId string `json:"client_id" bson:"client_id" query:"client_id" form:"client_id"`
+
+	// Audience - The audience for the API the device is requesting a token for
+	Audience string `json:"audience" bson:"audience" query:"audience" form:"audience"`
+}
+
+/*
+DeviceVerificationRequest - The request a user sends to approve or deny a device after entering its user code
+*/
+type DeviceVerificationRequest struct {
+	// UserCode - The user code displayed on the device
+	UserCode string `json:"user_code" bson:"user_code" query:"user_code" form:"user_code"`
+
+	// Email - The email address of the user approving the device
+	Email string `json:"email" bson:"email" query:"email" form:"email"`
+
+	// Password - The password of the user approving the device
+	Password string `json:"password" bson:"password" query:"password" form:"password"`
+
+	// Approve - If set to true, the device is approved. Otherwise, it is denied
+	Approve bool `json:"approve" bson:"approve" query:"approve" form:"approve"`
+}
@@ -0,0 +1,34 @@
+package request
+
+/*
+IntrospectionRequest - A token introspection request as defined in RFC 7662. The caller can authenticate with HTTP Basic
+authentication or by sending its client credentials in the body, and must have been granted the can_introspect capability
+*/
+type IntrospectionRequest struct {
+	// Token - The access token or refresh token to introspect
+	Token string `json:"token" bson:"token" query:"token" form:"token"`
+
+	// TokenTypeHint - A hint about the type of the token (access_token, refresh_token). Access tokens are always checked first, so this is optional
+	TokenTypeHint string `json:"token_type_hint" bson:"token_type_hint" query:"token_type_hint" form:"token_type_hint"`
+
+	// ClientId - The client id of the application performing the introspection, if HTTP Basic authentication is not used
+	ClientId string `json:"client_id" bson:"client_id" query:"client_id" form:"client_id"`
+
+	// ClientSecret - The client secret of the application performing the introspection, if HTTP Basic authentication is not used
+	ClientSecret string `json:"client_secret" bson:"client_secret" query:"client_secret" form:"client_secret"`
+}
+
+/*
+BatchIntrospectionRequest - A request to introspect multiple tokens in a single call. The caller authenticates with its
+client credentials, and must have been granted the can_introspect capability
+*/
+type BatchIntrospectionRequest struct {
+	// ClientId - The client id of the application performing the introspection
+	ClientId string `json:"client_id" bson:"client_id"`
+
+	// ClientSecret - The client secret of the application performing the introspection
+	ClientSecret string `json:"client_secret" bson:"client_secret"`
+
+	// Tokens - The access tokens to introspect. Results are returned in the same order
+	Tokens []string `json:"tokens" bson:"tokens"`
+}
@@ -0,0 +1,21 @@
+package request
+
+import "encoding/json"
+
+/*
+KeyImportRequest - Imports a private key that was generated outside of credstack, so that tokens that were signed with it
+by another identity provider keep validating after migrating to credstack
+*/
+type KeyImportRequest struct {
+	// Audience - The audience of the resource server the key signs tokens for
+	Audience string `json:"audience" bson:"audience"`
+
+	// Key - The private key. Either a string holding the PEM encoded key (PKCS#8, PKCS#1 or SEC 1), or a private JSON Web Key object
+	Key json.RawMessage `json:"key" bson:"key"`
+
+	// Kid - The key ID to publish the key under. Optional, and defaults to the kid of the JSON Web Key, or to a key ID derived from the key
+	Kid string `json:"kid" bson:"kid"`
+
+	// Activate - If set to true, then the key becomes the current signing key for the audience. Otherwise, it is only published for verification until it is retired
+	Activate bool `json:"activate" bson:"activate"`
+}
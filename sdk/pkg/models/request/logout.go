@@ -0,0 +1,19 @@
+package request
+
+/*
+EndSessionRequest - A request to the end session endpoint as defined in OpenID Connect RP-Initiated Logout 1.0 section 2.
+These are sent as query parameters when the user agent is redirected to credstack, or as form fields when they are posted
+*/
+type EndSessionRequest struct {
+	// IdTokenHint - An ID token previously issued to the client, identifying the user that is logging out
+	IdTokenHint string `json:"id_token_hint" bson:"id_token_hint" query:"id_token_hint" form:"id_token_hint"`
+
+	// ClientId - The client id of the application initiating the logout. Required if id_token_hint is not sent
+	ClientId string `json:"client_id" bson:"client_id" query:"client_id" form:"client_id"`
+
+	// PostLogoutRedirectUri - The URI the user agent is redirected to once the logout completes. Must match one registered on the client
+	PostLogoutRedirectUri string `json:"post_logout_redirect_uri" bson:"post_logout_redirect_uri" query:"post_logout_redirect_uri" form:"post_logout_redirect_uri"`
+
+	// State - An opaque value returned to the client unchanged in the post logout redirect
+	State string `json:"state" bson:"state" query:"state" form:"state"`
+}
@@ -14,6 +14,54 @@ type UserRegisterRequest struct {
 	// Password - The plain text password for the user. Will be hashed on the server-side using Argonv2ID
 	Password string `json:"password" bson:"password"`
 
-	// PhoneNumber - The users phone number in the following format +1800-555-5555
+	// PhoneNumber - The users phone number. Optional, and normalized to E.164 format (+18005555555) on registration
 	PhoneNumber string `json:"phone_number" bson:"phone_number"`
 }
+
+/*
+ImportedCredential - A password hash produced by another identity provider, along with the parameters it was hashed with.
+Imported credentials are validated against on the user's first login and then rehashed with the servers CredentialConfig
+*/
+type ImportedCredential struct {
+	// Algorithm - The algorithm the password was hashed with. Can be: bcrypt, scrypt, pbkdf2
+	Algorithm string `json:"algorithm" bson:"algorithm"`
+
+	// Hash - The hashed password. For bcrypt, this is the full hash ($2a$10$...), which includes its salt and cost. For any other algorithm, this is the base64 encoded derived key
+	Hash string `json:"hash" bson:"hash"`
+
+	// Salt - The base64 encoded salt. Ignored for bcrypt
+	Salt string `json:"salt" bson:"salt"`
+
+	// Digest - The hash function used by PBKDF2. Can be: sha1, sha256 (default), sha512
+	Digest string `json:"digest" bson:"digest"`
+
+	// Iterations - The number of iterations used by PBKDF2
+	Iterations uint32 `json:"iterations" bson:"iterations"`
+
+	// Cost - The CPU/memory cost (N) used by scrypt. Must be a power of two
+	Cost uint32 `json:"cost" bson:"cost"`
+
+	// BlockSize - The block size (r) used by scrypt
+	BlockSize uint32 `json:"block_size" bson:"block_size"`
+
+	// Parallelism - The parallelism (p) used by scrypt
+	Parallelism uint32 `json:"parallelism" bson:"parallelism"`
+}
+
+/*
+UserImportRequest - Provides a way for administrators to import users from another identity provider without knowing
+their passwords
+*/
+type UserImportRequest struct {
+	// Email - The primary email address for the user. Must be unique
+	Email string `json:"email" bson:"email"`
+
+	// Username - The username of the user. Does not need to be unique as primary lookup for the user is done via email
+	Username string `json:"username" bson:"username"`
+
+	// PhoneNumber - The users phone number. Optional, and normalized to E.164 format (+18005555555) on import
+	PhoneNumber string `json:"phone_number" bson:"phone_number"`
+
+	// Credential - The users password hash, as it was exported from the other identity provider
+	Credential ImportedCredential `json:"credential" bson:"credential"`
+}
@@ -0,0 +1,19 @@
+package request
+
+/*
+RevocationRequest - A token revocation request as defined in RFC 7009. The caller can authenticate with HTTP Basic
+authentication or by sending its client credentials in the body, and must have been granted the can_revoke capability
+*/
+type RevocationRequest struct {
+	// Token - The access token or refresh token to revoke
+	Token string `json:"token" bson:"token" query:"token" form:"token"`
+
+	// TokenTypeHint - A hint about the type of the token (access_token, refresh_token). Used to decide which type is looked up first
+	TokenTypeHint string `json:"token_type_hint" bson:"token_type_hint" query:"token_type_hint" form:"token_type_hint"`
+
+	// ClientId - The client id of the application revoking the token, if HTTP Basic authentication is not used
+	ClientId string `json:"client_id" bson:"client_id" query:"client_id" form:"client_id"`
+
+	// ClientSecret - The client secret of the application revoking the token, if HTTP Basic authentication is not used
+	ClientSecret string `json:"client_secret" bson:"client_secret" query:"client_secret" form:"client_secret"`
+}
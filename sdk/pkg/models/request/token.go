@@ -1,25 +1,66 @@
 package request
 
+import "context"
+
 /*
 TokenRequest - Universal token request model for use in: Client credentials flow, authorization code flow, and
 password grant flow
 */
 type TokenRequest struct {
 	// GrantType - Describes the type of OAuth grant flow you are using
-	GrantType string `json:"grant_type" bson:"grant_type" query:"grant_type"`
+	GrantType string `json:"grant_type" bson:"grant_type" query:"grant_type" form:"grant_type"`
 
 	// ClientId - The client id of the application. Can be null in some cases
-	ClientId string `json:"client_id" bson:"client_id" query:"client_id"`
+	ClientId string `json:"client_id" bson:"client_id" query:"client_id" form:"client_id"`
 
 	// ClientSecret - The client secret of the application. Can be null in some cases
-	ClientSecret string `json:"client_secret" bson:"client_secret" query:"client_secret"`
+	ClientSecret string `json:"client_secret" bson:"client_secret" query:"client_secret" form:"client_secret"`
 
 	// Audience - The audience for the API you are requesting a token for
-	Audience string `json:"audience" bson:"audience" query:"audience"`
+	Audience string `json:"audience" bson:"audience" query:"audience" form:"audience"`
 
 	// Code - The code used in Authorization Code flow. Can be null in some cases
-	Code string `json:"code" bson:"code" query:"code"`
+	Code string `json:"code" bson:"code" query:"code" form:"code"`
 
 	// RedirectUri -  The redirect URI used in Authorization code flow
-	RedirectUri string `json:"redirect_uri" bson:"redirect_uri" query:"redirect_uri"`
+	RedirectUri string `json:"redirect_uri" bson:"redirect_uri" query:"redirect_uri" form:"redirect_uri"`
+
+	// CodeVerifier - The PKCE code verifier (RFC 7636) the code challenge of the authorization request was derived from. Required if the authorization request included a code challenge
+	CodeVerifier string `json:"code_verifier" bson:"code_verifier" query:"code_verifier" form:"code_verifier"`
+
+	// RefreshToken - The refresh token used in the refresh token grant. Can be null in some cases
+	RefreshToken string `json:"refresh_token" bson:"refresh_token" query:"refresh_token" form:"refresh_token"`
+
+	// DeviceCode - The device code used in the device authorization grant. Can be null in some cases
+	DeviceCode string `json:"device_code" bson:"device_code" query:"device_code" form:"device_code"`
+
+	// AuthReqId - The identifier of the request used in the client initiated backchannel authentication grant. Can be null in some cases
+	AuthReqId string `json:"auth_req_id" bson:"auth_req_id" query:"auth_req_id" form:"auth_req_id"`
+
+	// Scope - A space separated list of the scopes being requested. An ID token is only issued if this includes openid
+	Scope string `json:"scope" bson:"scope" query:"scope" form:"scope"`
+
+	// SubjectToken - The token being exchanged in the token exchange grant. Can be null in some cases
+	SubjectToken string `json:"subject_token" bson:"subject_token" query:"subject_token" form:"subject_token"`
+
+	// SubjectTokenType - The type of the subject token (RFC 8693 section 3). Required if a subject token is provided
+	SubjectTokenType string `json:"subject_token_type" bson:"subject_token_type" query:"subject_token_type" form:"subject_token_type"`
+
+	// ActorToken - A token representing the party acting on behalf of the subject in the token exchange grant. Optional
+	ActorToken string `json:"actor_token" bson:"actor_token" query:"actor_token" form:"actor_token"`
+
+	// ActorTokenType - The type of the actor token. Required if an actor token is provided
+	ActorTokenType string `json:"actor_token_type" bson:"actor_token_type" query:"actor_token_type" form:"actor_token_type"`
+
+	// RequestedTokenType - The type of token requested in the token exchange grant. Only access tokens can be issued
+	RequestedTokenType string `json:"requested_token_type" bson:"requested_token_type" query:"requested_token_type" form:"requested_token_type"`
+
+	// RemoteAddr - The IP address the request originated from. This is set by the API and never bound from the request
+	RemoteAddr string `json:"-" bson:"-" query:"-" form:"-"`
+
+	// Parameters - Every parameter of the request, so that extended grants (see flow.RegisterGrant) can read parameters of their own. This is set by the API and never bound from the request
+	Parameters map[string]string `json:"-" bson:"-" query:"-" form:"-"`
+
+	// Context - The context of the request, which carries its trace so that the spans of the token issuance pipeline are recorded as part of it. Treated as context.Background() if nil. This is set by the API and never bound from the request
+	Context context.Context `json:"-" bson:"-" query:"-" form:"-"`
 }
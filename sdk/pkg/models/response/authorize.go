@@ -0,0 +1,16 @@
+package response
+
+/*
+AuthorizationResponse - Represents the parameters returned to the client's redirect URI once the user has authorized
+it. Which of these are set depends on the response type that was requested
+*/
+type AuthorizationResponse struct {
+	// Code - The authorization code. Set for the code and code id_token response types
+	Code string `json:"code,omitempty" bson:"code,omitempty" query:"code"`
+
+	// IdToken - The ID token. Set for the id_token and code id_token response types
+	IdToken string `json:"id_token,omitempty" bson:"id_token,omitempty" query:"id_token"`
+
+	// State - The state sent in the authorization request, returned unchanged
+	State string `json:"state,omitempty" bson:"state,omitempty" query:"state"`
+}
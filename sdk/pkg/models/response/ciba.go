@@ -0,0 +1,16 @@
+package response
+
+/*
+BackchannelAuthenticationResponse - Represents the HTTP response returned to a client that has started the client
+initiated backchannel authentication grant (OpenID CIBA Core 1.0 section 7.3)
+*/
+type BackchannelAuthenticationResponse struct {
+	// AuthReqId - The identifier of the request, which the client redeems at the token endpoint
+	AuthReqId string `json:"auth_req_id" bson:"auth_req_id"`
+
+	// ExpiresIn - The amount of time (in seconds) until the request expires
+	ExpiresIn uint32 `json:"expires_in" bson:"expires_in"`
+
+	// Interval - The minimum amount of time (in seconds) the client must wait between polling requests
+	Interval uint32 `json:"interval" bson:"interval"`
+}
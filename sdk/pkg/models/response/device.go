@@ -0,0 +1,25 @@
+package response
+
+/*
+DeviceAuthorizationResponse - Represents the HTTP response returned to a device that has started the device
+authorization grant (RFC 8628)
+*/
+type DeviceAuthorizationResponse struct {
+	// DeviceCode - The code the device uses for polling the token endpoint. This is never shown to the user
+	DeviceCode string `json:"device_code" bson:"device_code"`
+
+	// UserCode - The short code the user enters at the verification URI
+	UserCode string `json:"user_code" bson:"user_code"`
+
+	// VerificationURI - The URL the user should visit to enter the user code
+	VerificationURI string `json:"verification_uri" bson:"verification_uri"`
+
+	// VerificationURIComplete - The verification URI with the user code already included, for devices that can display a QR code
+	VerificationURIComplete string `json:"verification_uri_complete" bson:"verification_uri_complete"`
+
+	// ExpiresIn - The amount of time (in seconds) until the device code and user code expire
+	ExpiresIn uint32 `json:"expires_in" bson:"expires_in"`
+
+	// Interval - The minimum amount of time (in seconds) the device must wait between polling requests
+	Interval uint32 `json:"interval" bson:"interval"`
+}
@@ -0,0 +1,88 @@
+package response
+
+/*
+OpenIDConfiguration - Represents the OpenID Provider metadata served from /.well-known/openid-configuration (OpenID
+Connect Discovery 1.0 section 3). Standard OIDC client libraries use this to configure themselves from the issuer alone
+*/
+type OpenIDConfiguration struct {
+	// Issuer - The issuer inserted into the iss claim of every token credstack issues
+	Issuer string `json:"issuer" bson:"issuer"`
+
+	// AuthorizationEndpoint - The URL of the authorization endpoint
+	AuthorizationEndpoint string `json:"authorization_endpoint" bson:"authorization_endpoint"`
+
+	// TokenEndpoint - The URL of the token endpoint
+	TokenEndpoint string `json:"token_endpoint" bson:"token_endpoint"`
+
+	// UserinfoEndpoint - The URL of the userinfo endpoint
+	UserinfoEndpoint string `json:"userinfo_endpoint" bson:"userinfo_endpoint"`
+
+	// JwksURI - The URL of the JWKS containing the public keys tokens are signed with
+	JwksURI string `json:"jwks_uri" bson:"jwks_uri"`
+
+	// IntrospectionEndpoint - The URL of the token introspection endpoint (RFC 7662)
+	IntrospectionEndpoint string `json:"introspection_endpoint" bson:"introspection_endpoint"`
+
+	// RevocationEndpoint - The URL of the token revocation endpoint (RFC 7009)
+	RevocationEndpoint string `json:"revocation_endpoint" bson:"revocation_endpoint"`
+
+	// DeviceAuthorizationEndpoint - The URL of the device authorization endpoint (RFC 8628)
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint" bson:"device_authorization_endpoint"`
+
+	// BackchannelAuthenticationEndpoint - The URL of the backchannel authentication endpoint (OpenID CIBA Core 1.0)
+	BackchannelAuthenticationEndpoint string `json:"backchannel_authentication_endpoint" bson:"backchannel_authentication_endpoint"`
+
+	// BackchannelTokenDeliveryModesSupported - The CIBA token delivery modes clients can register
+	BackchannelTokenDeliveryModesSupported []string `json:"backchannel_token_delivery_modes_supported" bson:"backchannel_token_delivery_modes_supported"`
+
+	// BackchannelUserCodeParameterSupported - Whether backchannel authentication requests can include a user code. Always false
+	BackchannelUserCodeParameterSupported bool `json:"backchannel_user_code_parameter_supported" bson:"backchannel_user_code_parameter_supported"`
+
+	// EndSessionEndpoint - The URL clients redirect the user agent to in order to log the user out (OpenID Connect RP-Initiated Logout 1.0)
+	EndSessionEndpoint string `json:"end_session_endpoint" bson:"end_session_endpoint"`
+
+	// ScopesSupported - The scopes that clients can request
+	ScopesSupported []string `json:"scopes_supported" bson:"scopes_supported"`
+
+	// ResponseTypesSupported - The response type combinations the authorization endpoint supports
+	ResponseTypesSupported []string `json:"response_types_supported" bson:"response_types_supported"`
+
+	// ResponseModesSupported - The response modes the authorization endpoint supports, including web_message for single page applications
+	ResponseModesSupported []string `json:"response_modes_supported" bson:"response_modes_supported"`
+
+	// GrantTypesSupported - The grant types the token endpoint supports
+	GrantTypesSupported []string `json:"grant_types_supported" bson:"grant_types_supported"`
+
+	// CodeChallengeMethodsSupported - The PKCE code challenge methods (RFC 7636) the authorization endpoint supports
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported" bson:"code_challenge_methods_supported"`
+
+	// SubjectTypesSupported - The subject identifier types that are supported. Always public
+	SubjectTypesSupported []string `json:"subject_types_supported" bson:"subject_types_supported"`
+
+	// IdTokenSigningAlgValuesSupported - The algorithms ID tokens can be signed with
+	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported" bson:"id_token_signing_alg_values_supported"`
+
+	// TokenEndpointAuthMethodsSupported - How clients can authenticate with the token endpoint
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported" bson:"token_endpoint_auth_methods_supported"`
+
+	// ClaimsSupported - The claims that can be inserted into ID tokens and returned from the userinfo endpoint
+	ClaimsSupported []string `json:"claims_supported" bson:"claims_supported"`
+
+	// RequestParameterSupported - Whether the authorization endpoint accepts request objects in the request parameter (RFC 9101)
+	RequestParameterSupported bool `json:"request_parameter_supported" bson:"request_parameter_supported"`
+
+	// RequestURIParameterSupported - Whether the authorization endpoint accepts request objects by reference. Always false
+	RequestURIParameterSupported bool `json:"request_uri_parameter_supported" bson:"request_uri_parameter_supported"`
+
+	// RequestObjectSigningAlgValuesSupported - The algorithms request objects can be signed with
+	RequestObjectSigningAlgValuesSupported []string `json:"request_object_signing_alg_values_supported" bson:"request_object_signing_alg_values_supported"`
+
+	// AccountManagementURI - The URL of the page where users manage their account. Omitted if it is not configured
+	AccountManagementURI string `json:"account_management_uri,omitempty" bson:"account_management_uri,omitempty"`
+
+	// ScopeCatalogEndpoint - The URL of the scope catalog, which describes the scopes registered on every resource server (see ScopeCatalog). This is specific to credstack
+	ScopeCatalogEndpoint string `json:"scope_catalog_endpoint" bson:"scope_catalog_endpoint"`
+
+	// ChangePasswordURI - The URL users are sent to in order to change their password (/.well-known/change-password). Omitted if it is not configured
+	ChangePasswordURI string `json:"change_password_uri,omitempty" bson:"change_password_uri,omitempty"`
+}
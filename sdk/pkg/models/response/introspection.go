@@ -0,0 +1,25 @@
+package response
+
+/*
+IntrospectionResponse - Represents the status of a single token as defined in RFC 7662. Inactive tokens only include the
+active field, so that callers cannot learn anything about tokens that are expired or were never issued
+*/
+type IntrospectionResponse struct {
+	// Active - If set to true, the token was issued by credstack and has not expired or been revoked
+	Active bool `json:"active" bson:"active"`
+
+	// Scope - A space separated list of scopes associated with the token
+	Scope string `json:"scope,omitempty" bson:"scope,omitempty"`
+
+	// ClientId - The client ID of the application the token was issued to
+	ClientId string `json:"client_id,omitempty" bson:"client_id,omitempty"`
+
+	// TokenType - The type of the token. Always Bearer for active tokens
+	TokenType string `json:"token_type,omitempty" bson:"token_type,omitempty"`
+
+	// Exp - A unix timestamp representing when the token expires
+	Exp int64 `json:"exp,omitempty" bson:"exp,omitempty"`
+
+	// Sub - The subject the token was issued for
+	Sub string `json:"sub,omitempty" bson:"sub,omitempty"`
+}
@@ -0,0 +1,38 @@
+package response
+
+/*
+ScopeMetadata - Describes a single scope registered on a resource server
+*/
+type ScopeMetadata struct {
+	// Name - The name of the scope, as it is requested
+	Name string `json:"name" bson:"name"`
+
+	// Description - A human-readable explanation of what the scope grants access to, for developers
+	Description string `json:"description" bson:"description"`
+
+	// ConsentText - The text shown to users when a client requests the scope (Read your orders). Omitted if it is not set
+	ConsentText string `json:"consent_text,omitempty" bson:"consent_text,omitempty"`
+}
+
+/*
+ResourceServerScopes - The scopes registered on a single resource server
+*/
+type ResourceServerScopes struct {
+	// Audience - The audience of the resource server, as it is requested
+	Audience string `json:"audience" bson:"audience"`
+
+	// Name - The name of the resource server
+	Name string `json:"name" bson:"name"`
+
+	// Scopes - The scopes registered on the resource server, sorted by name
+	Scopes []ScopeMetadata `json:"scopes" bson:"scopes"`
+}
+
+/*
+ScopeCatalog - The scopes registered on every resource server. This is public, so that consent screens and third-party
+developers can describe the permissions a client requests
+*/
+type ScopeCatalog struct {
+	// ResourceServers - Every resource server that has scopes registered, sorted by audience
+	ResourceServers []ResourceServerScopes `json:"resource_servers" bson:"resource_servers"`
+}
@@ -21,4 +21,10 @@ type TokenResponse struct {
 
 	// Scope - A list of permission scopes that are associated with the claims of the token
 	Scope string `json:"scope" bson:"scope"` // omit if empty
+
+	// CSRFToken - The token that must be sent in the X-Credstack-CSRF header when redeeming the refresh cookie. Only set for clients that receive their refresh tokens in cookies
+	CSRFToken string `json:"csrf_token,omitempty" bson:"csrf_token,omitempty"`
+
+	// IssuedTokenType - The type of the token that was issued. Only set by the token exchange grant (RFC 8693 section 2.2.1)
+	IssuedTokenType string `json:"issued_token_type,omitempty" bson:"issued_token_type,omitempty"`
 }
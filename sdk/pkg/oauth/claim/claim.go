@@ -1,18 +1,20 @@
 package claim
 
 import (
-	internalTime "github.com/credstack/credstack/sdk/internal/time"
-	"github.com/golang-jwt/jwt/v5"
 	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 /*
 NewClaims - Creates a new claims structure with required claims applied to it. All tokens get the following claims applied
 to it: iss, aud, kid, iat, nbf, and exp. No custom expiration dates are supported for now, and all tokens will expires 1 day
-after they are issued
+after they are issued. The issued at time is read from the clock provided in the parameter and truncated to the second,
+as NumericDate claims do not carry sub-second precision
 */
-func NewClaims(iss string, aud string, exp uint64) jwt.RegisteredClaims {
-	currentTime := time.Unix(internalTime.UnixTimestamp(), 0)
+func NewClaims(c clock.Clock, iss string, aud string, exp uint64) jwt.RegisteredClaims {
+	currentTime := c.Now().Truncate(time.Second)
 
 	return jwt.RegisteredClaims{
 		Issuer:    iss,
@@ -27,8 +29,8 @@ func NewClaims(iss string, aud string, exp uint64) jwt.RegisteredClaims {
 NewClaimsWithSubject - Provides a simple wrapper around NewClaims and inserts the subject string into the structure. This
 should be either a user ID or an application ID depending on the flow that was used
 */
-func NewClaimsWithSubject(iss string, aud string, sub string, exp uint64) jwt.RegisteredClaims {
-	ret := NewClaims(iss, aud, exp)
+func NewClaimsWithSubject(c clock.Clock, iss string, aud string, sub string, exp uint64) jwt.RegisteredClaims {
+	ret := NewClaims(c, iss, aud, exp)
 	ret.Subject = sub
 
 	return ret
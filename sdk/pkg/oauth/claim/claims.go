@@ -0,0 +1,48 @@
+package claim
+
+import (
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/*
+Claims - Registered claims with additional claims (user claims) merged into them when the token is serialized. This
+implements jwt.Claims through the embedded jwt.RegisteredClaims, so it can be signed like any other claims structure
+*/
+type Claims struct {
+	jwt.RegisteredClaims
+
+	// Extra - Additional claims inserted into the token. These can never override a registered claim
+	Extra map[string]any
+}
+
+/*
+MarshalJSON - Serializes the registered claims and merges the extra claims into the same JSON object. If an extra claim
+has the same name as a registered claim, the registered claim is kept
+*/
+func (claims Claims) MarshalJSON() ([]byte, error) {
+	registered, err := json.Marshal(claims.RegisteredClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]any, len(claims.Extra))
+	for name, value := range claims.Extra {
+		merged[name] = value
+	}
+
+	err = json.Unmarshal(registered, &merged)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merged)
+}
+
+/*
+WithExtra - Wraps the registered claims provided in the parameter with additional claims
+*/
+func WithExtra(registered jwt.RegisteredClaims, extra map[string]any) Claims {
+	return Claims{RegisteredClaims: registered, Extra: extra}
+}
@@ -0,0 +1,32 @@
+package claim
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"strings"
+)
+
+/*
+HalfHash - Computes the value of the at_hash and c_hash claims (OpenID Connect Core 1.0 section 3.3.2.11). The value is
+hashed with the hash function of the algorithm the ID token is signed with, and the left-most half of the hash is
+base64url encoded without padding. Algorithms that do not end in 384 or 512 are hashed with SHA-256
+*/
+func HalfHash(alg string, value string) string {
+	var h hash.Hash
+
+	switch {
+	case strings.HasSuffix(alg, "384"):
+		h = sha512.New384()
+	case strings.HasSuffix(alg, "512"):
+		h = sha512.New()
+	default:
+		h = sha256.New()
+	}
+
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,151 @@
+package claim
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+const (
+	// SourceUserMetadata - Prefixes mapping sources that read a key from the user's user metadata (user_metadata.locale)
+	SourceUserMetadata string = "user_metadata"
+
+	// SourceAppMetadata - Prefixes mapping sources that read a key from the user's app metadata (app_metadata.plan)
+	SourceAppMetadata string = "app_metadata"
+)
+
+// ErrInvalidClaimMapping - Provides a named error for when a claim mapping has no claim, or does not set exactly one of its source and value
+var ErrInvalidClaimMapping = credstackError.NewError(400, "CLAIM_INVALID_MAPPING", "claim: Claim mappings must name a claim, and set exactly one of a source user claim or a static value")
+
+// ErrDuplicateClaimMapping - Provides a named error for when more than one claim mapping inserts the same claim
+var ErrDuplicateClaimMapping = credstackError.NewError(400, "CLAIM_DUPLICATE_MAPPING", "claim: More than one claim mapping inserts the same claim")
+
+/*
+Mapping - Inserts a single custom claim into the access tokens issued for a ResourceServer. The value of the claim is
+either read from one of the user's claims (Source), or is the same static value for every token (Value)
+*/
+type Mapping struct {
+	// Claim - The name of the claim inserted into the token. Prefixed with ClaimConfig.Namespace if one is configured and the name is not already prefixed
+	Claim string `json:"claim" bson:"claim"`
+
+	// Source - The user claim the value is read from (family_name), or a dotted path into the user's metadata (app_metadata.plan.tier). The claim is omitted from tokens that are not issued on behalf of a user, or if the user has not set it
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+
+	// Value - A static value inserted into every token, including tokens issued with client credentials
+	Value string `json:"value,omitempty" bson:"value,omitempty"`
+}
+
+/*
+name - Returns the name of the claim the mapping inserts. A user claim mapped to its own name (family_name to
+family_name) is inserted as is, so that a single user claim can be added without changing the ResourceServer's claims
+profile. Every other claim is a custom claim, and is namespaced
+*/
+func (mapping Mapping) name(config config.ClaimConfig) string {
+	if mapping.Source != "" && mapping.Claim == mapping.Source && slices.Contains(fullClaims, mapping.Source) {
+		return mapping.Claim
+	}
+
+	return Namespaced(config, mapping.Claim)
+}
+
+/*
+ValidateMappings - Ensures that every mapping provided in the parameter can be inserted into tokens. Each mapping must set
+exactly one of Source and Value, Source must be a user claim or a path into the user's metadata, and the claim must pass ValidateCustom unless it is a user
+claim mapped to its own name. No two mappings can insert the same claim. This should be called when mappings are saved,
+so that an invalid mapping is rejected then instead of being evaluated when tokens are issued
+*/
+func ValidateMappings(config config.ClaimConfig, mappings []Mapping) error {
+	seen := make([]string, 0, len(mappings))
+
+	for _, mapping := range mappings {
+		if mapping.Claim == "" || (mapping.Source == "") == (mapping.Value == "") {
+			return fmt.Errorf("%w (%s)", ErrInvalidClaimMapping, mapping.Claim)
+		}
+
+		if mapping.Source != "" && !slices.Contains(fullClaims, mapping.Source) && metadataPath(mapping.Source) == nil {
+			return fmt.Errorf("%w (unknown source: %s)", ErrInvalidClaimMapping, mapping.Source)
+		}
+
+		name := mapping.name(config)
+		if name != mapping.Source {
+			err := ValidateCustom(config, name)
+			if err != nil {
+				return err
+			}
+		}
+
+		if slices.Contains(seen, name) {
+			return fmt.Errorf("%w (%s)", ErrDuplicateClaimMapping, name)
+		}
+
+		seen = append(seen, name)
+	}
+
+	return nil
+}
+
+/*
+Map - Evaluates the mappings provided in the parameter against the user claims, and returns the claims to insert into the
+token. userClaims should be nil for tokens that are not issued on behalf of a user, in which case only the static values
+are returned. Metadata is read from the SourceUserMetadata and SourceAppMetadata keys of userClaims, which are never
+inserted into tokens by a claims profile. The mappings should have been checked with ValidateMappings first
+*/
+func Map(config config.ClaimConfig, mappings []Mapping, userClaims map[string]any) map[string]any {
+	ret := make(map[string]any, len(mappings))
+
+	for _, mapping := range mappings {
+		if mapping.Value != "" {
+			ret[mapping.name(config)] = mapping.Value
+			continue
+		}
+
+		if value, ok := lookup(userClaims, mapping.Source); ok {
+			ret[mapping.name(config)] = value
+		}
+	}
+
+	return ret
+}
+
+/*
+metadataPath - Splits a mapping source into the keys that lead to a value in the user's metadata, starting with the
+metadata field itself (app_metadata.plan.tier). Returns nil if the source does not read from metadata, or names no key
+*/
+func metadataPath(source string) []string {
+	path := strings.Split(source, ".")
+	if len(path) < 2 || (path[0] != SourceUserMetadata && path[0] != SourceAppMetadata) || slices.Contains(path, "") {
+		return nil
+	}
+
+	return path
+}
+
+/*
+lookup - Reads the value of a mapping source from the user claims. Metadata sources are followed through nested objects,
+and are not found if any key along the way is missing or is not an object
+*/
+func lookup(userClaims map[string]any, source string) (any, bool) {
+	path := metadataPath(source)
+	if path == nil {
+		value, ok := userClaims[source]
+		return value, ok
+	}
+
+	var current any = userClaims
+	for _, key := range path {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		current, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
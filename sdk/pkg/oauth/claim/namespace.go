@@ -0,0 +1,55 @@
+package claim
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+/*
+Registered - The claims that credstack inserts into tokens itself: the registered claims defined in RFC 7519 section 4.1,
+the claims inserted by specific grants and by RBAC, and every user claim. Custom claims can never use these names, as they
+would shadow the claims that resource servers rely on
+*/
+var Registered = append([]string{
+	"iss", "sub", "aud", "exp", "nbf", "iat", "jti",
+	"act", "may_act", "client_id", "azp", "scope", "roles", "nonce", "auth_time", "at_hash", "c_hash", "sid", "cnf",
+}, fullClaims...)
+
+// ErrReservedClaim - Provides a named error for when a custom claim uses the name of a registered claim
+var ErrReservedClaim = credstackError.NewError(400, "CLAIM_RESERVED", "claim: Custom claims cannot use the name of a registered claim")
+
+// ErrClaimNotNamespaced - Provides a named error for when a custom claim is not prefixed with the configured namespace
+var ErrClaimNotNamespaced = credstackError.NewError(400, "CLAIM_NOT_NAMESPACED", "claim: Custom claims must be prefixed with the configured claim namespace")
+
+/*
+ValidateCustom - Ensures that the name provided in the parameter can be used for a custom claim. The name must not be a
+registered claim, and must be prefixed with ClaimConfig.Namespace if one is configured. This should be called when custom
+claims are saved, so that an invalid claim is rejected then instead of being inserted into tokens
+*/
+func ValidateCustom(config config.ClaimConfig, name string) error {
+	if name == "" || slices.Contains(Registered, name) {
+		return fmt.Errorf("%w (%s)", ErrReservedClaim, name)
+	}
+
+	if config.Namespace != "" && (!strings.HasPrefix(name, config.Namespace) || name == config.Namespace) {
+		return fmt.Errorf("%w (%s)", ErrClaimNotNamespaced, name)
+	}
+
+	return nil
+}
+
+/*
+Namespaced - Prefixes the name provided in the parameter with ClaimConfig.Namespace, so that it can be used for a custom
+claim. Names that are already prefixed, and all names when no namespace is configured, are returned unchanged
+*/
+func Namespaced(config config.ClaimConfig, name string) string {
+	if config.Namespace == "" || strings.HasPrefix(name, config.Namespace) {
+		return name
+	}
+
+	return config.Namespace + name
+}
@@ -0,0 +1,57 @@
+package claim
+
+import "slices"
+
+const (
+	// ProfileMinimal - No user claims are inserted into access tokens. Only the registered claims (iss, sub, aud, exp) are present
+	ProfileMinimal string = "minimal"
+
+	// ProfileStandard - Inserts the claims needed to identify the user (email, preferred_username, name, zoneinfo)
+	ProfileStandard string = "standard"
+
+	// ProfileFull - Inserts every user claim that credstack stores, including PII like phone numbers and addresses
+	ProfileFull string = "full"
+)
+
+// Profiles - All possible claims profiles that can be assigned to a ResourceServer
+var Profiles = []string{ProfileMinimal, ProfileStandard, ProfileFull}
+
+// standardClaims - The user claims inserted into access tokens under ProfileStandard
+var standardClaims = []string{"email", "email_verified", "preferred_username", "name", "zoneinfo"}
+
+// fullClaims - The user claims inserted into access tokens under ProfileFull
+var fullClaims = append(slices.Clone(standardClaims),
+	"given_name", "middle_name", "family_name", "gender", "birthdate", "phone_number", "phone_number_verified", "address",
+)
+
+/*
+ProfileClaims - Returns the names of the user claims that are inserted into access tokens under the profile provided in
+the parameter. Unknown profiles are treated as ProfileMinimal, so that a misconfigured profile never leaks PII
+*/
+func ProfileClaims(profile string) []string {
+	switch profile {
+	case ProfileStandard:
+		return standardClaims
+	case ProfileFull:
+		return fullClaims
+	default:
+		return nil
+	}
+}
+
+/*
+Filter - Returns the subset of the user claims provided in the parameter that are allowed under the profile. This only
+governs access tokens, endpoints that are meant to return user claims (userinfo) should not filter them with this
+*/
+func Filter(profile string, userClaims map[string]any) map[string]any {
+	allowed := ProfileClaims(profile)
+
+	ret := make(map[string]any, len(allowed))
+	for _, name := range allowed {
+		if value, ok := userClaims[name]; ok {
+			ret[name] = value
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,33 @@
+package claim
+
+import "strings"
+
+// ClaimScopes - The OpenID Connect scopes that grant access to user claims
+var ClaimScopes = []string{"profile", "email", "address", "phone"}
+
+// scopeClaims - The user claims each OpenID Connect scope grants access to (OpenID Connect Core 1.0 section 5.4)
+var scopeClaims = map[string][]string{
+	"profile": {"name", "family_name", "given_name", "middle_name", "preferred_username", "gender", "birthdate", "zoneinfo"},
+	"email":   {"email", "email_verified"},
+	"address": {"address"},
+	"phone":   {"phone_number", "phone_number_verified"},
+}
+
+/*
+FilterByScope - Returns the subset of the user claims provided in the parameter that the space separated scopes grant
+access to. Unlike Filter, this governs the claims returned from the userinfo endpoint, where the client decides which
+claims it needs by requesting the profile, email, address, and phone scopes. Scopes that do not grant claims are ignored
+*/
+func FilterByScope(scope string, userClaims map[string]any) map[string]any {
+	ret := make(map[string]any)
+
+	for _, granted := range strings.Fields(scope) {
+		for _, name := range scopeClaims[granted] {
+			if value, ok := userClaims[name]; ok {
+				ret[name] = value
+			}
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"net/url"
+	"slices"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+const (
+	// DeliveryModePoll - The client polls the token endpoint until the user has approved or denied the authentication request
+	DeliveryModePoll string = "poll"
+
+	// DeliveryModePing - credstack calls the client's notification endpoint once the user has approved or denied the authentication request, and the client then calls the token endpoint
+	DeliveryModePing string = "ping"
+)
+
+// DeliveryModes - The CIBA token delivery modes that clients can register. The push mode is not supported, as it was removed from the FAPI CIBA profile
+var DeliveryModes = []string{DeliveryModePoll, DeliveryModePing}
+
+// ErrUnsupportedDeliveryMode - An error that gets returned when a client is updated with a CIBA token delivery mode that credstack does not support
+var ErrUnsupportedDeliveryMode = credstackError.NewError(400, "ERR_UNSUPPORTED_DELIVERY_MODE", "oauth_client: The requested backchannel token delivery mode is not supported. Can be: poll, ping")
+
+// ErrInvalidNotificationEndpoint - An error that gets returned when a client uses the ping delivery mode without an absolute HTTPS notification endpoint
+var ErrInvalidNotificationEndpoint = credstackError.NewError(400, "ERR_INVALID_NOTIFICATION_ENDPOINT", "oauth_client: Clients using the ping delivery mode must register an absolute HTTPS notification endpoint")
+
+/*
+DeliveryMode - Returns the CIBA token delivery mode of the client. Clients that have not registered one use poll
+*/
+func (client *Client) DeliveryMode() string {
+	if client.BackchannelTokenDeliveryMode == "" {
+		return DeliveryModePoll
+	}
+
+	return client.BackchannelTokenDeliveryMode
+}
+
+/*
+ValidateDeliveryMode - Ensures that the CIBA token delivery mode and notification endpoint provided in the parameters can
+be registered together (OpenID CIBA Core 1.0 section 4). The ping mode requires an absolute HTTPS notification endpoint.
+An empty delivery mode is treated as poll
+*/
+func ValidateDeliveryMode(mode string, notificationEndpoint string) error {
+	if mode != "" && !slices.Contains(DeliveryModes, mode) {
+		return ErrUnsupportedDeliveryMode
+	}
+
+	if mode != DeliveryModePing {
+		return nil
+	}
+
+	parsed, err := url.Parse(notificationEndpoint)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return ErrInvalidNotificationEndpoint
+	}
+
+	return nil
+}
@@ -1,16 +1,19 @@
 package client
 
 import (
-	"context"
 	"crypto/subtle"
 	"errors"
 	"fmt"
 	"slices"
 
+	"github.com/credstack/credstack/sdk/pkg/approval/gate"
+	"github.com/credstack/credstack/sdk/pkg/clock"
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/events"
 	"github.com/credstack/credstack/sdk/pkg/header"
 	"github.com/credstack/credstack/sdk/pkg/models/request"
 	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
 	"github.com/credstack/credstack/sdk/pkg/secret"
 	"github.com/credstack/credstack/sdk/pkg/server"
 	"github.com/golang-jwt/jwt/v5"
@@ -31,10 +34,58 @@ const (
 
 	// GrantTypePassword - A constant string representing the deprecated password grant type
 	GrantTypePassword string = "password"
+
+	// GrantTypeDeviceCode - A constant string representing the device authorization grant type (RFC 8628)
+	GrantTypeDeviceCode string = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// GrantTypeTokenExchange - A constant string representing the token exchange grant type (RFC 8693)
+	GrantTypeTokenExchange string = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// GrantTypeCIBA - A constant string representing the client initiated backchannel authentication grant type (OpenID CIBA Core 1.0)
+	GrantTypeCIBA string = "urn:openid:params:grant-type:ciba"
 )
 
 // GrantTypes - All possible grant types that a caller can use for creating new applications
-var GrantTypes = []string{GrantTypeClientCredentials, GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypePassword}
+var GrantTypes = []string{GrantTypeClientCredentials, GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypePassword, GrantTypeDeviceCode, GrantTypeTokenExchange, GrantTypeCIBA}
+
+const (
+	// CapabilityIntrospect - Allows the client to call the token introspection endpoint
+	CapabilityIntrospect string = "can_introspect"
+
+	// CapabilityRevoke - Allows the client to call the token revocation endpoint
+	CapabilityRevoke string = "can_revoke"
+
+	// CapabilityImpersonate - Allows the client to request tokens on behalf of other subjects (token exchange)
+	CapabilityImpersonate string = "can_impersonate"
+
+	// CapabilityUsePAR - Allows the client to use pushed authorization requests
+	CapabilityUsePAR string = "can_use_par"
+)
+
+// Capabilities - All possible capabilities that can be granted to a client. Clients have none of these by default
+var Capabilities = []string{CapabilityIntrospect, CapabilityRevoke, CapabilityImpersonate, CapabilityUsePAR}
+
+const (
+	// IdTokenAlgRS256 - ID tokens are signed with the current RS256 key of the requested audience
+	IdTokenAlgRS256 string = "RS256"
+
+	// IdTokenAlgES256 - ID tokens are signed with the current ES256 key of the requested audience
+	IdTokenAlgES256 string = "ES256"
+
+	// IdTokenAlgHS256 - ID tokens are signed with the client secret. Only confidential clients can use this
+	IdTokenAlgHS256 string = "HS256"
+)
+
+// IdTokenAlgs - All possible algorithms that a client can register for signing its ID tokens
+var IdTokenAlgs = []string{IdTokenAlgRS256, IdTokenAlgES256, IdTokenAlgHS256}
+
+const (
+	// SecretEncodingRaw - The bytes of the client secret are used as the HS256 signing key as-is. Set on every client secret generated by credstack
+	SecretEncodingRaw string = "raw"
+
+	// SecretEncodingBase64 - The client secret is base64 decoded to recover the HS256 signing key. Clients created before the encoding was stored have no encoding, and are treated as this
+	SecretEncodingBase64 string = "base64"
+)
 
 // ErrInvalidClientCredentials - An error that gets returned when the client credentials sent in a token request do not match what was received from the database (during client credentials flow)
 var ErrInvalidClientCredentials = credstackError.NewError(401, "ERR_INVALID_CLIENT_CREDENTIALS", "token: Unable to issue token. Invalid client credentials were supplied")
@@ -54,6 +105,18 @@ var ErrClientDoesNotExist = credstackError.NewError(404, "CLIENT_DOES_NOT_EXIST"
 // ErrUnauthorizedGrantType - An error that gets returned when an application tries to issue tokens for a grant type that it is not authorized too
 var ErrUnauthorizedGrantType = credstackError.NewError(403, "ERR_UNAUTHORIZED_GRANT_TYPE", "token: Invalid grant type for the specified application")
 
+// ErrMissingCapability - An error that gets returned when a client calls an endpoint that it has not been granted the capability for
+var ErrMissingCapability = credstackError.NewError(403, "ERR_MISSING_CAPABILITY", "oauth_client: The client has not been granted the capability required for this endpoint")
+
+// ErrUnknownCapability - An error that gets returned when a client is updated with a capability that does not exist
+var ErrUnknownCapability = credstackError.NewError(400, "ERR_UNKNOWN_CAPABILITY", "oauth_client: One or more of the requested capabilities do not exist")
+
+// ErrUnsupportedIdTokenAlg - An error that gets returned when a client is updated with an ID token signing algorithm that credstack does not support
+var ErrUnsupportedIdTokenAlg = credstackError.NewError(400, "ERR_UNSUPPORTED_ID_TOKEN_ALG", "oauth_client: The requested ID token signing algorithm is not supported")
+
+// ErrIdTokenAlgUnavailable - An error that gets returned when a client registers an ID token signing algorithm it cannot be issued tokens with, as no key exists for it
+var ErrIdTokenAlgUnavailable = credstackError.NewError(400, "ERR_ID_TOKEN_ALG_UNAVAILABLE", "oauth_client: No signing key exists for the requested ID token signing algorithm under one or more of the client's audiences")
+
 // ErrUnauthorizedAudience - An error that gets returned when an application tries to issue tokens for an audience that it is not authorized too
 var ErrUnauthorizedAudience = credstackError.NewError(403, "ERR_UNAUTHORIZED_AUDIENCE", "token: Unable to issue token for the specified audience. Application is not authorized too")
 
@@ -76,17 +139,139 @@ type Client struct {
 	// ClientSecret - The client secret for the Client. Gets generated at birth
 	ClientSecret string `bson:"client_secret" json:"client_secret"`
 
+	// SecretEncoding - How the HS256 signing key is derived from the ClientSecret. Can be: raw, base64. Set whenever the secret is generated
+	SecretEncoding string `bson:"secret_encoding" json:"secret_encoding"`
+
 	// RedirectURI - The redirect URI for post-authentication. Defined by the user
 	RedirectURI string `bson:"redirect_uri" json:"redirect_uri"`
 
 	// TokenLifetime - An unsigned integer representing the amount of time in seconds that the token is valid for
 	TokenLifetime uint64 `bson:"token_lifetime" json:"token_lifetime"`
 
+	// RefreshTokenLifetime - An unsigned integer representing the amount of time in seconds that a refresh token (and every token it is rotated into) is valid for
+	RefreshTokenLifetime uint64 `bson:"refresh_token_lifetime" json:"refresh_token_lifetime"`
+
 	// GrantTypes - The grant types that the Client is allowed to issue tokens under
 	GrantTypes []string `bson:"grant_types" json:"grant_types"`
 
 	// AllowedAudiences - A string slice representing which ResourceServers are allowed to issue tokens for this Client
 	AllowedAudiences []string `bson:"allowed_audiences" json:"allowed_audiences"`
+
+	// IsCanary - If set to true, the Client only exists to detect leaked credentials. Tokens are never issued for it, and any use of it raises an alert
+	IsCanary bool `bson:"is_canary" json:"is_canary"`
+
+	// Capabilities - Opt-in flags that allow the Client to use powerful endpoints (can_introspect, can_revoke). Empty by default. Checked by RequireCapability
+	Capabilities []string `bson:"capabilities" json:"capabilities"`
+
+	// ResponseTypes - The response types the Client can request at the authorization endpoint (code, id_token, code id_token). Defaults to code
+	ResponseTypes []string `bson:"response_types" json:"response_types"`
+
+	// IdTokenSignedResponseAlg - The algorithm ID tokens issued to the Client are signed with. Can be: RS256 (default), ES256, HS256
+	IdTokenSignedResponseAlg string `bson:"id_token_signed_response_alg" json:"id_token_signed_response_alg"`
+
+	// ExchangePolicy - Controls which tokens the Client can exchange, and for which audiences, with the token exchange grant
+	ExchangePolicy ExchangePolicy `bson:"exchange_policy" json:"exchange_policy"`
+
+	// Jwks - The public keys the Client signs request objects with (RFC 9101). Each key must have a unique kid
+	Jwks []jwk.JSONWebKey `bson:"jwks" json:"jwks"`
+
+	// RequireSignedRequestObject - If set to true, authorization requests must be sent as a signed request object, and any parameters outside of it are ignored
+	RequireSignedRequestObject bool `bson:"require_signed_request_object" json:"require_signed_request_object"`
+
+	// BackchannelTokenDeliveryMode - How the Client learns that a backchannel authentication request has completed (OpenID CIBA Core 1.0). Can be: poll (default), ping
+	BackchannelTokenDeliveryMode string `bson:"backchannel_token_delivery_mode" json:"backchannel_token_delivery_mode"`
+
+	// BackchannelClientNotificationEndpoint - The HTTPS endpoint credstack calls when a backchannel authentication request completes. Required for the ping delivery mode
+	BackchannelClientNotificationEndpoint string `bson:"backchannel_client_notification_endpoint" json:"backchannel_client_notification_endpoint"`
+
+	// PostLogoutRedirectURIs - The URIs the user agent can be redirected to after the Client initiates a logout. Must be matched exactly
+	PostLogoutRedirectURIs []string `bson:"post_logout_redirect_uris" json:"post_logout_redirect_uris"`
+
+	// AllowedOrigins - The origins that browsers can call the browser facing endpoints from on behalf of the Client (https://app.example.com). Must be matched exactly
+	AllowedOrigins []string `bson:"allowed_origins" json:"allowed_origins"`
+
+	// RefreshTokenCookie - If set to true, refresh tokens are delivered to the browser in an HttpOnly cookie instead of the token response, and are redeemed and rotated at /oauth/refresh
+	RefreshTokenCookie bool `bson:"refresh_token_cookie" json:"refresh_token_cookie"`
+
+	// DefaultScopes - The scopes a token is issued with when the Client requests no scope. Scopes that are not registered on the audience are skipped
+	DefaultScopes []string `bson:"default_scopes" json:"default_scopes"`
+
+	// ForcedScopes - The scopes that are always appended to the scopes the Client requests. Scopes that are not registered on the audience are skipped
+	ForcedScopes []string `bson:"forced_scopes" json:"forced_scopes"`
+}
+
+/*
+HasCapability - Determines if the client has been granted the capability provided in the parameter
+*/
+func (client *Client) HasCapability(capability string) bool {
+	return slices.Contains(client.Capabilities, capability)
+}
+
+/*
+RequireCapability - Returns ErrMissingCapability if the client has not been granted the capability provided in the
+parameter. Endpoints that are gated by a capability should call this after authenticating the client
+*/
+func (client *Client) RequireCapability(capability string) error {
+	if !client.HasCapability(capability) {
+		return ErrMissingCapability
+	}
+
+	return nil
+}
+
+/*
+SigningKey - Returns the key HS256 tokens issued to the client are signed and verified with. The key is derived from the
+client secret according to its SecretEncoding, so that the issuer and every validator always derive the same key. If the
+secret of a legacy client is not valid base64, then its raw bytes are used, as they were when it was signed
+*/
+func (client *Client) SigningKey() []byte {
+	secretBytes := []byte(client.ClientSecret)
+
+	if client.SecretEncoding == SecretEncodingRaw {
+		return secretBytes
+	}
+
+	decoded, err := secret.DecodeBase64(secretBytes, uint32(len(secretBytes)))
+	if err != nil {
+		return secretBytes
+	}
+
+	return decoded
+}
+
+/*
+ValidateIdTokenAlg - Ensures that ID tokens can actually be issued to the client with the algorithm provided in the
+parameter (OpenID Connect Dynamic Client Registration 1.0 section 2). For RS256 and ES256, a current key for the
+algorithm must exist under every audience the client is allowed to request tokens for, as ID tokens are signed with
+the key of the requested audience. HS256 ID tokens are signed with the client secret, so public clients cannot use it.
+If the algorithm is not supported, ErrUnsupportedIdTokenAlg is returned, and if it cannot be used, then
+ErrIdTokenAlgUnavailable is returned
+*/
+func (client *Client) ValidateIdTokenAlg(serv *server.Server, alg string) error {
+	if !slices.Contains(IdTokenAlgs, alg) {
+		return ErrUnsupportedIdTokenAlg
+	}
+
+	if alg == IdTokenAlgHS256 {
+		if client.IsPublic {
+			return ErrIdTokenAlgUnavailable
+		}
+
+		return nil
+	}
+
+	for _, audience := range client.AllowedAudiences {
+		_, err := jwk.ActiveKey(serv, alg, audience)
+		if err != nil {
+			if errors.Is(err, jwk.ErrKeyNotExist) {
+				return ErrIdTokenAlgUnavailable
+			}
+
+			return err
+		}
+	}
+
+	return nil
 }
 
 /*
@@ -107,11 +292,12 @@ func (client *Client) ValidateAuthFlow(request *request.TokenRequest) error {
 
 /*
 ClientCredentials - Attempts to issue a token under Client Credentials flow and begins any validation required for
-ensuring that the request received was valid.
+ensuring that the request received was valid. The clock provided in the parameter is used for setting the iat, nbf, and
+exp claims, and should be the servers clock (server.Server.Clock)
 
 TODO: When tenant's are implemented, issuer needs to be removed as a parameter here
 */
-func (client *Client) ClientCredentials(request *request.TokenRequest, issuer string) (*jwt.RegisteredClaims, error) {
+func (client *Client) ClientCredentials(c clock.Clock, request *request.TokenRequest, issuer string) (*jwt.RegisteredClaims, error) {
 	if client.IsPublic {
 		return nil, ErrVisibilityIssue
 	}
@@ -127,6 +313,7 @@ func (client *Client) ClientCredentials(request *request.TokenRequest, issuer st
 	}
 
 	claims := claim.NewClaimsWithSubject(
+		c,
 		issuer,
 		request.Audience, // this might cause issues later; this should really be pulled from the API model so that the user doesn't have to use it in the request
 		client.ClientId,
@@ -147,6 +334,23 @@ an existing application, then the error: ErrClientIDCollision is returned. Addit
 encountered here and returned.
 */
 func New(serv *server.Server, name string, isPublic bool, grantTypes ...string) (string, error) {
+	return newClient(serv, name, isPublic, false, grantTypes...)
+}
+
+/*
+NewCanary - Creates a new canary client. Canary clients are confidential clients with the client credentials grant type
+whose credentials are planted somewhere they should never be used (source repositories, CI variables, config files).
+Tokens are never issued for a canary client, and any token request that uses its client ID raises an alert (see the
+canary package). The client ID of the new canary is returned
+*/
+func NewCanary(serv *server.Server, name string) (string, error) {
+	return newClient(serv, name, false, true, GrantTypeClientCredentials)
+}
+
+/*
+newClient - Provides the shared logic for New and NewCanary
+*/
+func newClient(serv *server.Server, name string, isPublic bool, isCanary bool, grantTypes ...string) (string, error) {
 	/*
 		If we get a grant types slice that has a length of zero, we always want to append the Authorization Code grant
 		type to it. This ensures that we always have a form of authentication available
@@ -158,28 +362,29 @@ func New(serv *server.Server, name string, isPublic bool, grantTypes ...string)
 	/*
 		This is pretty shit code, but I am strapped for time right now and want to get this finished
 	*/
+	supported := SupportedGrantTypes()
 	for _, grantType := range grantTypes {
-		if !slices.Contains(GrantTypes, grantType) {
+		if !slices.Contains(supported, grantType) {
 			return "", ErrUnauthorizedGrantType
 		}
 	}
 
 	/*
 		Similar to the hashing functions we have, we always generate our secrets first to ensure that we can catch
-		any errors before we consume a DB call. The client ID for an application is a simple base64 encoded string
-		that is generated using cryptographically secure bytes
+		any errors before we consume a DB call. The client ID for an application is generated from cryptographically
+		secure bytes according to the configured secret policy (a base64 encoded string by default)
 	*/
-	clientId, err := secret.RandString(16)
+	clientId, err := secret.Generate(serv.Config.SecretConfig.ClientId)
 	if err != nil {
 		return "", err // named error here
 	}
 
 	/*
-		Just like client_id, the client secret is a base64 encoded string that is generated with cryptographically
-		secure bytes. We increase the length here to 128 as we want to provide a great deal of entropy as this is
+		Just like client_id, the client secret is generated with cryptographically secure bytes according to its
+		policy. The default length is much larger here as we want to provide a great deal of entropy as this is
 		effectively a password for the application (for client credentials flow)
 	*/
-	clientSecret, err := secret.RandString(96)
+	clientSecret, err := secret.Generate(serv.Config.SecretConfig.ClientSecret)
 	if err != nil {
 		return "", err // named error here
 	}
@@ -191,15 +396,25 @@ func New(serv *server.Server, name string, isPublic bool, grantTypes ...string)
 		TODO: URL Validation for redirect URI
 	*/
 	newApplication := &Client{
-		Header:           header.New(clientId),
-		Name:             name,
-		IsPublic:         isPublic,
-		GrantTypes:       grantTypes,
-		RedirectURI:      "",
-		TokenLifetime:    86400,
-		ClientId:         clientId,
-		ClientSecret:     clientSecret,
-		AllowedAudiences: []string{},
+		Header:                   header.New(clientId),
+		Name:                     name,
+		IsPublic:                 isPublic,
+		GrantTypes:               grantTypes,
+		RedirectURI:              "",
+		TokenLifetime:            86400,
+		RefreshTokenLifetime:     2592000,
+		ClientId:                 clientId,
+		ClientSecret:             clientSecret,
+		SecretEncoding:           SecretEncodingRaw,
+		AllowedAudiences:         []string{},
+		IsCanary:                 isCanary,
+		Capabilities:             []string{},
+		ResponseTypes:            []string{ResponseTypeCode},
+		IdTokenSignedResponseAlg: IdTokenAlgRS256,
+		ExchangePolicy:           ExchangePolicy{Audiences: []string{}, SubjectClients: []string{}},
+		Jwks:                     []jwk.JSONWebKey{},
+		DefaultScopes:            []string{},
+		ForcedScopes:             []string{},
 	}
 
 	/*
@@ -207,7 +422,7 @@ func New(serv *server.Server, name string, isPublic bool, grantTypes ...string)
 		created on both the client ID and header.Identifier fields. Realistically, this should **never** be returned
 		as the client ID used is cryptographically secure. Nonetheless, we want to check for the error regardless
 	*/
-	_, err = serv.Database().Collection("client").InsertOne(context.Background(), newApplication)
+	_, err = serv.Database().Collection("client").InsertOne(serv.Context(), newApplication)
 	if err != nil {
 		var writeError mongo.WriteException
 		if errors.As(err, &writeError) {
@@ -223,6 +438,17 @@ func New(serv *server.Server, name string, isPublic bool, grantTypes ...string)
 		return "", fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
 	}
 
+	/*
+		Canary clients are never published, as their existence must not be revealed to anything that could leak it
+	*/
+	if !isCanary {
+		serv.PublishEvent(events.TypeClientCreated, map[string]any{
+			"client_id": clientId,
+			"name":      name,
+			"is_public": isPublic,
+		})
+	}
+
 	return clientId, nil
 }
 
@@ -241,8 +467,8 @@ func List(serv *server.Server, limit int, withCredentials bool) ([]*Client, erro
 		findOpts = findOpts.SetProjection(bson.M{"client_secret": 0})
 	}
 
-	result, err := serv.Database().Collection("client").Find(
-		context.Background(),
+	result, err := serv.Database().ReadCollection("client", server.ReadClassList).Find(
+		serv.Context(),
 		bson.M{},
 		findOpts,
 	)
@@ -252,7 +478,7 @@ func List(serv *server.Server, limit int, withCredentials bool) ([]*Client, erro
 
 	ret := make([]*Client, 0, limit)
 
-	err = result.All(context.Background(), &ret)
+	err = result.All(serv.Context(), &ret)
 	if err != nil {
 		if !errors.Is(err, mongo.ErrNoDocuments) && err != nil {
 			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
@@ -290,7 +516,7 @@ func Get(serv *server.Server, clientId string, withCredentials bool) (*Client, e
 		does not set withCredentials to false
 	*/
 	result := serv.Database().Collection("client").FindOne(
-		context.Background(),
+		serv.Context(),
 		bson.M{"client_id": clientId},
 		findOpts,
 	)
@@ -318,13 +544,104 @@ func Get(serv *server.Server, clientId string, withCredentials bool) (*Client, e
 /*
 Update - Provides functionality for updating a select number of fields of the app model. A valid client id
 must be provided as an argument for this function call. Fields to update can be passed in the patch parameter. The
-following fields can be updated: RedirectURI, TokenLifetime, GrantType.
+following fields can be updated: RedirectURI, TokenLifetime, RefreshTokenLifetime, GrantType, Capabilities,
+ResponseTypes, IdTokenSignedResponseAlg, ExchangePolicy, Jwks, RequireSignedRequestObject, BackchannelTokenDeliveryMode,
+BackchannelClientNotificationEndpoint, PostLogoutRedirectURIs, AllowedOrigins, RefreshTokenCookie, DefaultScopes,
+ForcedScopes. If any of the capabilities do not exist, then ErrUnknownCapability is returned, and if any of the response
+types are not supported, then ErrUnsupportedResponseType is returned. If the ID token signing algorithm changes, it is
+validated against the client's keys with Client.ValidateIdTokenAlg, any keys are validated with ValidateJWKS, the CIBA
+delivery mode is validated with ValidateDeliveryMode, post logout redirect URIs are validated with
+ValidatePostLogoutRedirectURIs, allowed origins are validated with ValidateOrigins, and default and forced
+scopes are validated with ValidateScopes.
+
+Capabilities, PostLogoutRedirectURIs, AllowedOrigins, DefaultScopes and ForcedScopes are replaced whenever the patch
+sets them, even to an empty list, so that they can be cleared. A nil list (a patch decoded from JSON without the field)
+leaves them as they are
 */
 func Update(serv *server.Server, clientId string, patch *Client) error {
 	if clientId == "" {
 		return ErrClientMissingIdentifier
 	}
 
+	for _, capability := range patch.Capabilities {
+		if !slices.Contains(Capabilities, capability) {
+			return ErrUnknownCapability
+		}
+	}
+
+	responseTypes, err := ValidateResponseTypes(patch.ResponseTypes)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateJWKS(patch.Jwks)
+	if err != nil {
+		return err
+	}
+
+	err = ValidatePostLogoutRedirectURIs(patch.PostLogoutRedirectURIs)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateOrigins(patch.AllowedOrigins)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateScopes(append(slices.Clone(patch.DefaultScopes), patch.ForcedScopes...))
+	if err != nil {
+		return err
+	}
+
+	/*
+		The delivery mode and notification endpoint are validated against the client as it will be after the patch is
+		applied, so that the notification endpoint can be registered before the client switches to the ping mode
+	*/
+	if patch.BackchannelTokenDeliveryMode != "" || patch.BackchannelClientNotificationEndpoint != "" {
+		existing, err := Get(serv, clientId, false)
+		if err != nil {
+			return err
+		}
+
+		if patch.BackchannelTokenDeliveryMode != "" {
+			existing.BackchannelTokenDeliveryMode = patch.BackchannelTokenDeliveryMode
+		}
+
+		if patch.BackchannelClientNotificationEndpoint != "" {
+			existing.BackchannelClientNotificationEndpoint = patch.BackchannelClientNotificationEndpoint
+		}
+
+		err = ValidateDeliveryMode(existing.BackchannelTokenDeliveryMode, existing.BackchannelClientNotificationEndpoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	/*
+		The algorithm is validated against the client as it will be after the patch is applied, so that changing the
+		allowed audiences and the algorithm in the same request is validated against the new audiences
+	*/
+	if patch.IdTokenSignedResponseAlg != "" {
+		existing, err := Get(serv, clientId, false)
+		if err != nil {
+			return err
+		}
+
+		if len(patch.AllowedAudiences) != 0 {
+			existing.AllowedAudiences = patch.AllowedAudiences
+		}
+
+		if patch.IsPublic {
+			existing.IsPublic = patch.IsPublic
+		}
+
+		err = existing.ValidateIdTokenAlg(serv, patch.IdTokenSignedResponseAlg)
+		if err != nil {
+			return err
+		}
+	}
+
 	/*
 		buildAppPatch - Provides a sub-function to convert the given appModel into a bson.M struct that can be
 		provided to mongo.UpdateOne. Only specified fields are supported in this function, so not all are included
@@ -349,6 +666,10 @@ func Update(serv *server.Server, clientId string, patch *Client) error {
 			update["token_lifetime"] = patch.TokenLifetime
 		}
 
+		if patch.RefreshTokenLifetime != 0 {
+			update["refresh_token_lifetime"] = patch.RefreshTokenLifetime
+		}
+
 		if len(patch.GrantTypes) != 0 {
 			update["grant_type"] = patch.GrantTypes
 		}
@@ -357,11 +678,63 @@ func Update(serv *server.Server, clientId string, patch *Client) error {
 			update["allowed_audiences"] = patch.AllowedAudiences
 		}
 
+		if patch.Capabilities != nil {
+			update["capabilities"] = patch.Capabilities
+		}
+
+		if len(responseTypes) != 0 {
+			update["response_types"] = responseTypes
+		}
+
+		if patch.IdTokenSignedResponseAlg != "" {
+			update["id_token_signed_response_alg"] = patch.IdTokenSignedResponseAlg
+		}
+
+		if len(patch.ExchangePolicy.Audiences) != 0 || len(patch.ExchangePolicy.SubjectClients) != 0 {
+			update["exchange_policy"] = patch.ExchangePolicy
+		}
+
+		if len(patch.Jwks) != 0 {
+			update["jwks"] = patch.Jwks
+		}
+
+		if patch.RequireSignedRequestObject {
+			update["require_signed_request_object"] = patch.RequireSignedRequestObject
+		}
+
+		if patch.BackchannelTokenDeliveryMode != "" {
+			update["backchannel_token_delivery_mode"] = patch.BackchannelTokenDeliveryMode
+		}
+
+		if patch.BackchannelClientNotificationEndpoint != "" {
+			update["backchannel_client_notification_endpoint"] = patch.BackchannelClientNotificationEndpoint
+		}
+
+		if patch.PostLogoutRedirectURIs != nil {
+			update["post_logout_redirect_uris"] = patch.PostLogoutRedirectURIs
+		}
+
+		if patch.AllowedOrigins != nil {
+			update["allowed_origins"] = patch.AllowedOrigins
+		}
+
+		if patch.RefreshTokenCookie {
+			update["refresh_token_cookie"] = patch.RefreshTokenCookie
+		}
+
+		if patch.DefaultScopes != nil {
+			update["default_scopes"] = patch.DefaultScopes
+		}
+
+		if patch.ForcedScopes != nil {
+			update["forced_scopes"] = patch.ForcedScopes
+		}
+
 		return update
 	}
 
 	result, err := serv.Database().Collection("client").UpdateOne(
-		context.Background(),
+		serv.Context(),
 		bson.M{"client_id": clientId},
 		bson.M{"$set": buildAppPatch(patch)},
 	)
@@ -377,19 +750,70 @@ func Update(serv *server.Server, clientId string, patch *Client) error {
 	return nil
 }
 
+/*
+RotateSecret - Replaces the client secret of the application with the client ID provided in the parameter with a newly
+generated one, and returns it. The secret is generated according to the servers SecretConfig, in the same way as New. The
+previous secret stops working immediately, so anything using it must be updated with the new one. If the application
+does not exist, then ErrClientDoesNotExist is returned
+*/
+func RotateSecret(serv *server.Server, clientId string) (string, error) {
+	if clientId == "" {
+		return "", ErrClientMissingIdentifier
+	}
+
+	clientSecret, err := secret.Generate(serv.Config.SecretConfig.ClientSecret)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := serv.Database().Collection("client").UpdateOne(
+		serv.Context(),
+		bson.M{"client_id": clientId},
+		bson.M{"$set": bson.M{"client_secret": clientSecret, "secret_encoding": SecretEncodingRaw}},
+	)
+
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return "", ErrClientDoesNotExist
+	}
+
+	return clientSecret, nil
+}
+
+func init() {
+	gate.Register(gate.ActionClientDelete, deleteClient)
+}
+
 /*
 Delete - Completely removes an application from CredStack. A valid client ID must be passed
 in this parameter, or it will return ErrAppMissingIdentifier. If the deleted count returned is equal to
 zero, then the function considers the user to not exist. A successful call to this function will return
-nil
+nil. If deleting clients requires approval, then gate.ErrApprovalRequired is returned instead, and the client must be
+deleted by approving a client.delete approval
 */
 func Delete(serv *server.Server, clientId string) error {
+	err := gate.Check(serv, gate.ActionClientDelete)
+	if err != nil {
+		return err
+	}
+
+	return deleteClient(serv, clientId)
+}
+
+/*
+deleteClient - Provides the logic for Delete without checking for approval. This is what is executed once a
+client.delete approval has been approved
+*/
+func deleteClient(serv *server.Server, clientId string) error {
 	if clientId == "" {
 		return ErrClientMissingIdentifier
 	}
 
 	result, err := serv.Database().Collection("client").DeleteOne(
-		context.Background(),
+		serv.Context(),
 		bson.M{"client_id": clientId},
 	)
 
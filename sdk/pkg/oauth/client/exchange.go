@@ -0,0 +1,39 @@
+package client
+
+import (
+	"slices"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrExchangeNotPermitted - An error that gets returned when a client's exchange policy does not allow a token to be exchanged for the requested audience
+var ErrExchangeNotPermitted = credstackError.NewError(403, "unauthorized_client", "oauth_client: The client is not permitted to exchange this token for the requested audience")
+
+/*
+ExchangePolicy - Controls how a Client can use the token exchange grant (RFC 8693). Clients can only exchange tokens
+once they have been granted the token exchange grant type and the can_impersonate capability, and the policy is empty by
+default, so an exchange policy must always be configured explicitly
+*/
+type ExchangePolicy struct {
+	// Audiences - The audiences the Client can request exchanged tokens for
+	Audiences []string `bson:"audiences" json:"audiences"`
+
+	// SubjectClients - The clients whose tokens can be exchanged, in addition to tokens issued to the Client itself
+	SubjectClients []string `bson:"subject_clients" json:"subject_clients"`
+}
+
+/*
+ValidateExchange - Ensures that the client's exchange policy allows a token issued to subjectClientId to be exchanged for
+a token for the audience provided in the parameter. If it does not, then ErrExchangeNotPermitted is returned
+*/
+func (client *Client) ValidateExchange(audience string, subjectClientId string) error {
+	if !slices.Contains(client.ExchangePolicy.Audiences, audience) {
+		return ErrExchangeNotPermitted
+	}
+
+	if subjectClientId != client.ClientId && !slices.Contains(client.ExchangePolicy.SubjectClients, subjectClientId) {
+		return ErrExchangeNotPermitted
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"slices"
+	"sync"
+)
+
+var (
+	// grantMu - Guards extendedGrantTypes, as grant types can be registered while clients are being created
+	grantMu sync.RWMutex
+
+	// extendedGrantTypes - The grant types registered with RegisterGrantType, in the order they were registered
+	extendedGrantTypes []string
+)
+
+/*
+RegisterGrantType - Allows clients to be created with the extended grant type provided in the parameter, alongside the
+grant types in GrantTypes. This only makes the grant type assignable, and is called by flow.RegisterGrant, which also
+registers how tokens are issued under it. Registering a grant type that is already supported is a no-op
+*/
+func RegisterGrantType(grantType string) {
+	grantMu.Lock()
+	defer grantMu.Unlock()
+
+	if slices.Contains(GrantTypes, grantType) || slices.Contains(extendedGrantTypes, grantType) {
+		return
+	}
+
+	extendedGrantTypes = append(extendedGrantTypes, grantType)
+}
+
+/*
+UnregisterGrantType - Removes an extended grant type registered with RegisterGrantType. Clients that were already
+created with it keep it, but tokens can no longer be issued under it
+*/
+func UnregisterGrantType(grantType string) {
+	grantMu.Lock()
+	defer grantMu.Unlock()
+
+	extendedGrantTypes = slices.DeleteFunc(extendedGrantTypes, func(registered string) bool {
+		return registered == grantType
+	})
+}
+
+/*
+SupportedGrantTypes - Returns every grant type that clients can be created with: the grant types in GrantTypes, followed
+by the extended grant types registered with RegisterGrantType
+*/
+func SupportedGrantTypes() []string {
+	grantMu.RLock()
+	defer grantMu.RUnlock()
+
+	return append(slices.Clone(GrantTypes), extendedGrantTypes...)
+}
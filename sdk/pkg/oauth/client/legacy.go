@@ -0,0 +1,32 @@
+package client
+
+import (
+	"github.com/credstack/credstack/sdk/pkg/legacy"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+/*
+UnmarshalBSON - Decodes a Client, converting GrantTypes that were written by the protobuf models as enum numbers into
+their string equivalents. This lets documents that have not been rewritten by the legacy migration be read while it runs
+*/
+func (client *Client) UnmarshalBSON(data []byte) error {
+	type plain Client
+
+	/*
+		The GrantTypes declared here is shallower than the one inlined from Plain, so it takes precedence and receives the
+		raw value of grant_types
+	*/
+	document := struct {
+		Plain      *plain        `bson:",inline"`
+		GrantTypes bson.RawValue `bson:"grant_types"`
+	}{Plain: (*plain)(client)}
+
+	err := bson.Unmarshal(data, &document)
+	if err != nil {
+		return err
+	}
+
+	client.GrantTypes, err = legacy.DecodeStrings(document.GrantTypes, legacy.GrantTypes)
+
+	return err
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"net/url"
+	"slices"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidPostLogoutRedirectURI - An error that gets returned when a client is updated with a post logout redirect URI that is not an absolute URI, or has a fragment
+var ErrInvalidPostLogoutRedirectURI = credstackError.NewError(400, "ERR_INVALID_POST_LOGOUT_REDIRECT_URI", "oauth_client: Post logout redirect URIs must be absolute URIs without a fragment")
+
+/*
+ValidatePostLogoutRedirectURIs - Ensures that every post logout redirect URI provided in the parameter is an absolute URI
+without a fragment (OpenID Connect RP-Initiated Logout 1.0 section 3.1), as the state parameter is appended to it
+*/
+func ValidatePostLogoutRedirectURIs(uris []string) error {
+	for _, uri := range uris {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" {
+			return ErrInvalidPostLogoutRedirectURI
+		}
+	}
+
+	return nil
+}
+
+/*
+AllowsPostLogoutRedirect - Determines if the URI provided in the parameter exactly matches one of the client's post logout
+redirect URIs. No normalization is applied, so that a URI can never be matched by a look-alike
+*/
+func (client *Client) AllowsPostLogoutRedirect(uri string) bool {
+	return slices.Contains(client.PostLogoutRedirectURIs, uri)
+}
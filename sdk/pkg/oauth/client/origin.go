@@ -0,0 +1,58 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrInvalidOrigin - An error that gets returned when a client is updated with an allowed origin that is not an http or https origin, or has a path, query, or fragment
+var ErrInvalidOrigin = credstackError.NewError(400, "ERR_INVALID_ORIGIN", "oauth_client: Allowed origins must be http or https origins without a path, query, or fragment (https://app.example.com)")
+
+/*
+ValidateOrigins - Ensures that every origin provided in the parameter is a serialized http or https origin (RFC 6454
+section 6.1), as browsers send it in the Origin header. Origins are matched exactly, so anything else could never match
+*/
+func ValidateOrigins(origins []string) error {
+	for _, origin := range origins {
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return ErrInvalidOrigin
+		}
+
+		if parsed.Path != "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil || parsed.ForceQuery {
+			return ErrInvalidOrigin
+		}
+	}
+
+	return nil
+}
+
+/*
+AllowsOrigin - Determines if the origin provided in the parameter exactly matches one of the client's allowed origins
+*/
+func (client *Client) AllowsOrigin(origin string) bool {
+	return slices.Contains(client.AllowedOrigins, origin)
+}
+
+/*
+OriginRegistered - Determines if the origin provided in the parameter is an allowed origin of any client. CORS preflight
+requests do not carry the parameters of the request they are made for, so they cannot be checked against a single client
+*/
+func OriginRegistered(serv *server.Server, origin string) (bool, error) {
+	count, err := serv.Database().Collection("client").CountDocuments(
+		serv.Context(),
+		bson.M{"allowed_origins": origin},
+		mongoOpts.Count().SetLimit(1),
+	)
+	if err != nil {
+		return false, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return count != 0, nil
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+)
+
+// RequestObjectAlgs - The algorithms that request objects (RFC 9101) can be signed with. Request objects are verified with the client's registered keys, so only asymmetric algorithms are supported
+var RequestObjectAlgs = []string{"RS256", "ES256"}
+
+// ErrInvalidClientJWKS - An error that gets returned when a client is updated with a key that cannot be used for verifying request objects
+var ErrInvalidClientJWKS = credstackError.NewError(400, "ERR_INVALID_CLIENT_JWKS", "oauth_client: One or more of the client's keys are invalid. Every key must have a unique kid and be an RS256 or ES256 public key")
+
+// ErrRequestObjectKeyNotFound - An error that gets returned when a request object is signed with a key that is not registered on the client
+var ErrRequestObjectKeyNotFound = credstackError.NewError(400, "invalid_request_object", "oauth_client: The request object was not signed with one of the client's registered keys")
+
+/*
+ValidateJWKS - Ensures that every key provided in the parameter can be used to verify request objects. Every key must
+have a kid that is unique among the keys, and must be an RS256 or ES256 public key. If any key is invalid, then
+ErrInvalidClientJWKS is returned
+*/
+func ValidateJWKS(keys []jwk.JSONWebKey) error {
+	seen := make(map[string]bool, len(keys))
+
+	for _, key := range keys {
+		if key.Kid == "" || seen[key.Kid] {
+			return ErrInvalidClientJWKS
+		}
+
+		seen[key.Kid] = true
+
+		_, err := publicKey(&key)
+		if err != nil {
+			return ErrInvalidClientJWKS
+		}
+	}
+
+	return nil
+}
+
+/*
+RequestObjectKey - Returns the public key registered on the client that a request object signed with the kid and alg
+provided in the parameters should be verified with. If the kid is empty, then the key is only found if the client has a
+single key registered for the algorithm. If no key matches, then ErrRequestObjectKeyNotFound is returned
+*/
+func (client *Client) RequestObjectKey(kid string, alg string) (any, error) {
+	var match *jwk.JSONWebKey
+
+	for i := range client.Jwks {
+		key := &client.Jwks[i]
+		if key.Alg != alg {
+			continue
+		}
+
+		if kid == key.Kid {
+			match = key
+			break
+		}
+
+		if kid == "" {
+			if match != nil {
+				return nil, ErrRequestObjectKeyNotFound // ambiguous, as more than one key could have signed it
+			}
+
+			match = key
+		}
+	}
+
+	if match == nil {
+		return nil, ErrRequestObjectKeyNotFound
+	}
+
+	return publicKey(match)
+}
+
+/*
+publicKey - Converts a public JSON Web Key into the public key type expected by the jwt package for its algorithm
+*/
+func publicKey(key *jwk.JSONWebKey) (any, error) {
+	switch key.Alg {
+	case "RS256":
+		if key.Kty != "RSA" {
+			return nil, jwk.ErrKeyIsNotValid
+		}
+
+		return key.RSA()
+	case "ES256":
+		return key.ECDSA()
+	default:
+		return nil, jwk.ErrUnsupportedKeyAlg
+	}
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"slices"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+const (
+	// ResponseTypeCode - The authorization code flow. Only an authorization code is returned from the authorization endpoint
+	ResponseTypeCode string = "code"
+
+	// ResponseTypeIdToken - The implicit flow. Only an ID token is returned from the authorization endpoint
+	ResponseTypeIdToken string = "id_token"
+
+	// ResponseTypeCodeIdToken - The hybrid flow. Both an authorization code and an ID token are returned from the authorization endpoint
+	ResponseTypeCodeIdToken string = "code id_token"
+)
+
+// ResponseTypes - All response type combinations that credstack supports. Each is stored in its normalized form (see NormalizeResponseType)
+var ResponseTypes = []string{ResponseTypeCode, ResponseTypeIdToken, ResponseTypeCodeIdToken}
+
+/*
+The short codes of the response type errors below are the error codes defined in RFC 6749 section 4.1.2.1, as they are
+returned to the client's redirect URI where clients expect the standard codes
+*/
+
+// ErrUnsupportedResponseType - An error that gets returned when a response type combination is requested that credstack does not support
+var ErrUnsupportedResponseType = credstackError.NewError(400, "unsupported_response_type", "oauth_client: The requested response type is not supported")
+
+// ErrUnauthorizedResponseType - An error that gets returned when a client requests a response type that has not been registered for it
+var ErrUnauthorizedResponseType = credstackError.NewError(400, "unauthorized_client", "oauth_client: The client is not allowed to use the requested response type")
+
+/*
+NormalizeResponseType - Converts a response type into the form it is stored in. Response types are a space separated
+list of values where the order does not matter (OAuth 2.0 Multiple Response Type Encoding Practices section 5), so
+"id_token code" and "code id_token" are the same response type. The values are sorted and joined with a single space
+*/
+func NormalizeResponseType(responseType string) string {
+	values := strings.Fields(responseType)
+	slices.Sort(values)
+
+	return strings.Join(slices.Compact(values), " ")
+}
+
+/*
+ValidateResponseTypes - Ensures that every response type provided in the parameter is supported. The normalized
+response types are returned so that they can be stored. If any are not supported, then ErrUnsupportedResponseType is
+returned
+*/
+func ValidateResponseTypes(responseTypes []string) ([]string, error) {
+	ret := make([]string, 0, len(responseTypes))
+
+	for _, responseType := range responseTypes {
+		normalized := NormalizeResponseType(responseType)
+		if !slices.Contains(ResponseTypes, normalized) {
+			return nil, ErrUnsupportedResponseType
+		}
+
+		ret = append(ret, normalized)
+	}
+
+	return ret, nil
+}
+
+/*
+ValidateResponseType - Ensures that the client can use the response type provided in the parameter at the authorization
+endpoint. If the response type is not one that credstack supports, ErrUnsupportedResponseType is returned, and if it has
+not been registered for the client, then ErrUnauthorizedResponseType is returned. Response types that return an
+authorization code additionally require the client to be allowed the authorization code grant.
+
+Clients created before response types were registered have none stored, and are only allowed the code response type
+*/
+func (client *Client) ValidateResponseType(responseType string) error {
+	normalized := NormalizeResponseType(responseType)
+	if !slices.Contains(ResponseTypes, normalized) {
+		return ErrUnsupportedResponseType
+	}
+
+	allowed := client.ResponseTypes
+	if len(allowed) == 0 {
+		allowed = []string{ResponseTypeCode}
+	}
+
+	if !slices.Contains(allowed, normalized) {
+		return ErrUnauthorizedResponseType
+	}
+
+	if slices.Contains(strings.Fields(normalized), ResponseTypeCode) && !slices.Contains(client.GrantTypes, GrantTypeAuthorizationCode) {
+		return ErrUnauthorizedResponseType
+	}
+
+	return nil
+}
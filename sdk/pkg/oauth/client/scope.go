@@ -0,0 +1,29 @@
+package client
+
+import (
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrInvalidClientScope - An error that gets returned when a client is updated with a default or forced scope that contains whitespace, quotes, or backslashes
+var ErrInvalidClientScope = credstackError.NewError(400, "ERR_INVALID_CLIENT_SCOPE", "oauth_client: Default and forced scopes must not contain whitespace, quotes, or backslashes")
+
+/*
+ValidateScopes - Ensures that every scope provided in the parameter only uses the characters allowed in a scope-token
+(RFC 6749 section 3.3), so that it can be appended to the scope string of a token request. The scopes are not required to
+be registered, as a client can be given scopes for more than one resource server
+*/
+func ValidateScopes(scopes []string) error {
+	for _, name := range scopes {
+		if name == "" {
+			return ErrInvalidClientScope
+		}
+
+		for _, c := range name {
+			if c <= 0x20 || c == '"' || c == '\\' || c >= 0x7f {
+				return ErrInvalidClientScope
+			}
+		}
+	}
+
+	return nil
+}
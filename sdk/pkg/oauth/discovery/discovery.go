@@ -0,0 +1,105 @@
+package discovery
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/flow"
+)
+
+const (
+	// PathAuthorize - The path of the authorization endpoint, relative to the issuer
+	PathAuthorize string = "/oauth/authorize"
+
+	// PathToken - The path of the token endpoint, relative to the issuer
+	PathToken string = "/oauth/token"
+
+	// PathUserinfo - The path of the userinfo endpoint, relative to the issuer
+	PathUserinfo string = "/oauth/userinfo"
+
+	// PathJWKS - The path of the JWKS, relative to the issuer
+	PathJWKS string = "/.well-known/jwks.json"
+
+	// PathIntrospect - The path of the token introspection endpoint, relative to the issuer
+	PathIntrospect string = "/oauth/introspect"
+
+	// PathRevoke - The path of the token revocation endpoint, relative to the issuer
+	PathRevoke string = "/oauth/revoke"
+
+	// PathDeviceAuthorization - The path of the device authorization endpoint, relative to the issuer
+	PathDeviceAuthorization string = "/oauth/device/code"
+
+	// PathBackchannelAuthentication - The path of the backchannel authentication endpoint, relative to the issuer
+	PathBackchannelAuthentication string = "/oauth/bc-authorize"
+
+	// PathEndSession - The path of the end session endpoint, relative to the issuer
+	PathEndSession string = "/oauth/logout"
+
+	// PathChangePassword - The well-known path that redirects to the change password page (W3C A Well-Known URL for Changing Passwords)
+	PathChangePassword string = "/.well-known/change-password"
+
+	// PathScopeCatalog - The path of the scope catalog, which publishes the scopes registered on every resource server, relative to the issuer
+	PathScopeCatalog string = "/.well-known/scopes"
+)
+
+/*
+OpenIDConfiguration - Builds the OpenID Provider metadata for the issuer provided in the parameter. Every endpoint is
+rendered relative to the issuer, as credstack serves all of them from the same origin, unless the server runs in a region
+with its own endpoint (RegionConfig.Endpoint). The issuer itself is always kept global, so that tokens issued in one
+region are valid in all of them. The supported grant types,
+response types, and signing algorithms are read from the values credstack actually implements, so the document never
+advertises something that cannot be used. The account management URLs are only advertised when they are configured
+*/
+func OpenIDConfiguration(issuer string, serverConfig *config.ServerConfig) *response.OpenIDConfiguration {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	endpoint := issuer
+	if serverConfig.RegionConfig.Endpoint != "" {
+		endpoint = strings.TrimSuffix(serverConfig.RegionConfig.Endpoint, "/")
+	}
+
+	authorization := serverConfig.AuthorizationConfig
+
+	/*
+		The subject is always present in ID tokens, and the remaining claims are every user claim that credstack can
+		store (the full claims profile)
+	*/
+	claims := append([]string{"sub", "iss", "aud", "exp", "iat"}, claim.ProfileClaims(claim.ProfileFull)...)
+
+	ret := &response.OpenIDConfiguration{
+		Issuer:                                 issuer,
+		AuthorizationEndpoint:                  endpoint + PathAuthorize,
+		TokenEndpoint:                          endpoint + PathToken,
+		UserinfoEndpoint:                       endpoint + PathUserinfo,
+		JwksURI:                                endpoint + PathJWKS,
+		IntrospectionEndpoint:                  endpoint + PathIntrospect,
+		RevocationEndpoint:                     endpoint + PathRevoke,
+		DeviceAuthorizationEndpoint:            endpoint + PathDeviceAuthorization,
+		BackchannelAuthenticationEndpoint:      endpoint + PathBackchannelAuthentication,
+		BackchannelTokenDeliveryModesSupported: slices.Clone(client.DeliveryModes),
+		EndSessionEndpoint:                     endpoint + PathEndSession,
+		ScopeCatalogEndpoint:                   endpoint + PathScopeCatalog,
+		ScopesSupported:                        append([]string{flow.ScopeOpenID}, claim.ClaimScopes...),
+		ResponseTypesSupported:                 slices.Clone(client.ResponseTypes),
+		ResponseModesSupported:                 slices.Clone(flow.ResponseModes),
+		GrantTypesSupported:                    flow.IssuableGrantTypes(),
+		CodeChallengeMethodsSupported:          slices.Clone(flow.CodeChallengeMethods),
+		SubjectTypesSupported:                  []string{"public"},
+		IdTokenSigningAlgValuesSupported:       slices.Clone(client.IdTokenAlgs),
+		TokenEndpointAuthMethodsSupported:      []string{"client_secret_basic", "client_secret_post", "none"},
+		ClaimsSupported:                        claims,
+		RequestParameterSupported:              true,
+		RequestObjectSigningAlgValuesSupported: slices.Clone(client.RequestObjectAlgs),
+		AccountManagementURI:                   authorization.AccountURL,
+	}
+
+	if authorization.ChangePasswordURL != "" {
+		ret.ChangePasswordURI = endpoint + PathChangePassword
+	}
+
+	return ret
+}
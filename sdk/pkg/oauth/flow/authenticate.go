@@ -0,0 +1,62 @@
+package flow
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/credstack/credstack/sdk/pkg/canary"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+/*
+AuthenticateClient - Authenticates a confidential client with its client ID and client secret. This is used by endpoints
+that are called by clients directly instead of issuing tokens (introspection, revocation). If the client does not exist,
+is public, or the secret does not match, then client.ErrInvalidClientCredentials is returned. Canary clients raise an
+alert and fail in the same way, so that whoever is using them cannot tell that they have been detected
+*/
+func AuthenticateClient(serv *server.Server, clientId string, clientSecret string, remoteAddr string) (*client.Client, error) {
+	app, err := authenticateClient(serv, &request.TokenRequest{ClientId: clientId, ClientSecret: clientSecret, RemoteAddr: remoteAddr})
+	if err != nil {
+		return nil, err
+	}
+
+	if app.IsPublic {
+		return nil, client.ErrInvalidClientCredentials
+	}
+
+	return app, nil
+}
+
+/*
+authenticateClient - Provides the logic of AuthenticateClient for every grant at the token endpoint, which also accepts
+public clients. Public clients cannot hold a secret, so they are returned without one being checked, and grants that
+are only available to confidential clients must reject them. Every way of authenticating a client goes through this, so
+that they all treat canary clients and mismatched secrets the same way
+*/
+func authenticateClient(serv *server.Server, req *request.TokenRequest) (*client.Client, error) {
+	app, err := client.Get(serv, req.ClientId, true)
+	if err != nil {
+		if errors.Is(err, client.ErrClientDoesNotExist) || errors.Is(err, client.ErrClientMissingIdentifier) {
+			return nil, client.ErrInvalidClientCredentials
+		}
+
+		return nil, err
+	}
+
+	/*
+		Canary clients only exist to detect leaked credentials, so we raise an alert and then fail the request exactly as
+		we would for invalid credentials, so that whoever is using them cannot tell that they have been detected
+	*/
+	if app.IsCanary {
+		_ = canary.Trigger(serv, app, req) // failures are logged by Trigger, and never change the response
+		return nil, client.ErrInvalidClientCredentials
+	}
+
+	if !app.IsPublic && subtle.ConstantTimeCompare([]byte(app.ClientSecret), []byte(req.ClientSecret)) != 1 {
+		return nil, client.ErrInvalidClientCredentials
+	}
+
+	return app, nil
+}
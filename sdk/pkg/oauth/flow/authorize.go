@@ -0,0 +1,268 @@
+package flow
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+// ErrInvalidAuthorizationRequest - Returned when an authorization request is missing a required parameter, or its parameters cannot be used together. Uses the error code defined in RFC 6749 section 4.1.2.1
+var ErrInvalidAuthorizationRequest = credstackError.NewError(400, "invalid_request", "authorize: The authorization request is missing a required parameter or is malformed")
+
+// ErrAuthorizationDenied - Returned to the client's redirect URI when the user denies the authorization request. Uses the error code defined in RFC 6749 section 4.1.2.1
+var ErrAuthorizationDenied = credstackError.NewError(403, "access_denied", "authorize: The user denied the authorization request")
+
+// ErrRedirectURIMismatch - Returned when the redirect URI of an authorization request does not match the one registered on the client. This must never be returned to the redirect URI
+var ErrRedirectURIMismatch = credstackError.NewError(400, "ERR_REDIRECT_URI_MISMATCH", "authorize: The redirect URI does not match the one registered for the client")
+
+/*
+ValidateAuthorizationRequest - Validates a request to the authorization endpoint and returns the client it was made
+for. The client must exist and the redirect URI must match the one registered on it. If either of these fail, then the
+error must be displayed to the user instead of being sent to the redirect URI, as the redirect URI cannot be trusted
+(RFC 6749 section 4.1.2.1).
+
+If the request includes a signed request object (RFC 9101), then it is verified and its parameters are applied to the
+request (see resolveRequestObject). The issuer provided in the parameter is the value the aud claim of the request
+object must contain.
+
+The client must be allowed to request tokens for the audience, and the response type must be one the client has
+registered (see Client.ValidateResponseType). Response types that return an ID token must request the openid scope and
+include a nonce (OpenID Connect Core 1.0 section 3.2.2.1). Response types that return a code must send a valid S256
+code challenge if the client is public, as public clients cannot authenticate when the code is redeemed (see
+validateCodeChallenge). The prompt and response mode, if present, must be supported
+(see validatePrompt and validateResponseMode)
+*/
+func ValidateAuthorizationRequest(serv *server.Server, req *request.AuthorizationRequest, issuer string) (*client.Client, error) {
+	if req.ClientId == "" {
+		return nil, ErrInvalidAuthorizationRequest
+	}
+
+	app, err := client.Get(serv, req.ClientId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.RedirectURI == "" || (req.RedirectUri != "" && req.RedirectUri != app.RedirectURI) {
+		return nil, ErrRedirectURIMismatch
+	}
+
+	/*
+		The redirect URI in the query is validated before the request object is, so that errors in the request object
+		are only ever returned to a redirect URI that is registered on the client. It is validated again afterward, as the
+		request object can override it
+	*/
+	err = resolveRequestObject(serv, app, req, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RedirectUri != "" && req.RedirectUri != app.RedirectURI {
+		return nil, ErrRedirectURIMismatch
+	}
+
+	if req.ResponseType == "" || req.Audience == "" {
+		return nil, ErrInvalidAuthorizationRequest
+	}
+
+	if !slices.Contains(app.AllowedAudiences, req.Audience) {
+		return nil, client.ErrUnauthorizedAudience
+	}
+
+	err = app.ValidateResponseType(req.ResponseType)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(strings.Fields(req.ResponseType), client.ResponseTypeIdToken) {
+		if !requestsOpenID(req.Scope) || req.Nonce == "" {
+			return nil, ErrInvalidAuthorizationRequest
+		}
+	}
+
+	err = validateCodeChallenge(req.CodeChallenge, req.CodeChallengeMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	if app.IsPublic && req.CodeChallenge == "" && slices.Contains(strings.Fields(req.ResponseType), client.ResponseTypeCode) {
+		return nil, ErrInvalidAuthorizationRequest
+	}
+
+	err = validatePrompt(req.Prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateResponseMode(req.ResponseMode, req.ResponseType)
+	if err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+/*
+Authorize - Completes an authorization request that was validated with ValidateAuthorizationRequest, once the user
+identified by the subject has authenticated and authorized the client. An authorization code is issued for response
+types that include code, and an ID token is issued for response types that include id_token. The code is bound to the
+session identified by sessionRef (the identifier of the session, not its ID), so that the tokens it is redeemed for are
+revoked when the session is signed out. This can be empty if sessions are disabled.
+
+When both are issued (the hybrid flow), the ID token includes the c_hash claim so that the client can verify that the
+code was issued alongside it. No access token is ever returned from the authorization endpoint, so at_hash is not
+included
+*/
+func Authorize(serv *server.Server, app *client.Client, req *request.AuthorizationRequest, subject string, sessionRef string, issuer string) (*response.AuthorizationResponse, error) {
+	responseTypes := strings.Fields(client.NormalizeResponseType(req.ResponseType))
+
+	ret := &response.AuthorizationResponse{State: req.State}
+
+	if slices.Contains(responseTypes, client.ResponseTypeCode) {
+		code, err := issueAuthorizationCode(serv, app, req, subject, sessionRef)
+		if err != nil {
+			return nil, err
+		}
+
+		ret.Code = code
+	}
+
+	if slices.Contains(responseTypes, client.ResponseTypeIdToken) {
+		binding := idTokenBinding{Nonce: req.Nonce, Code: ret.Code}
+
+		idToken, err := issueIdToken(serv, app, req.Audience, subject, issuer, binding)
+		if err != nil {
+			return nil, err
+		}
+
+		ret.IdToken = idToken
+	}
+
+	return ret, nil
+}
+
+/*
+RedirectURI - Returns the URI the user agent should be redirected to for the authorization request. If the request did
+not include a redirect URI, then the one registered on the client is used
+*/
+func RedirectURI(app *client.Client, req *request.AuthorizationRequest) string {
+	if req.RedirectUri != "" {
+		return req.RedirectUri
+	}
+
+	return app.RedirectURI
+}
+
+/*
+AuthorizationRedirect - Builds the URL the user agent is redirected to once the authorization request completes. The
+code response type returns its parameters in the query string (RFC 6749 section 4.1.2). Response types that include an
+ID token return them in the fragment instead, so that the ID token is never sent to the client's server in a request
+log (OAuth 2.0 Multiple Response Type Encoding Practices section 5). The response mode of the request overrides this
+*/
+func AuthorizationRedirect(app *client.Client, req *request.AuthorizationRequest, resp *response.AuthorizationResponse) (string, error) {
+	return redirectWith(RedirectURI(app, req), req.ResponseType, req.ResponseMode, AuthorizationParams(resp))
+}
+
+/*
+AuthorizationParams - Returns the parameters of a successful authorization response, as they are returned to the client
+*/
+func AuthorizationParams(resp *response.AuthorizationResponse) url.Values {
+	params := url.Values{}
+
+	if resp.Code != "" {
+		params.Set("code", resp.Code)
+	}
+
+	if resp.IdToken != "" {
+		params.Set("id_token", resp.IdToken)
+	}
+
+	if resp.State != "" {
+		params.Set("state", resp.State)
+	}
+
+	return params
+}
+
+/*
+AuthorizationErrorRedirect - Builds the URL the user agent is redirected to when an authorization request fails after
+the client and redirect URI have been validated (RFC 6749 section 4.1.2.1). See AuthorizationErrorParams for the
+parameters that are returned
+*/
+func AuthorizationErrorRedirect(app *client.Client, req *request.AuthorizationRequest, err error) (string, error) {
+	return redirectWith(RedirectURI(app, req), req.ResponseType, req.ResponseMode, AuthorizationErrorParams(req, err))
+}
+
+/*
+AuthorizationErrorParams - Returns the parameters of a failed authorization response. The short code of the error is
+returned as the error parameter. Errors that do not carry a standard (lowercase) code are returned as invalid_request if
+they were caused by the request, and as server_error otherwise, so that internal error details never leave credstack
+*/
+func AuthorizationErrorParams(req *request.AuthorizationRequest, err error) url.Values {
+	code := "server_error"
+
+	var casted credstackError.CredstackError
+	if errors.As(err, &casted) {
+		switch {
+		case strings.ToLower(casted.Short()) == casted.Short():
+			code = casted.Short()
+		case casted.HTTPStatusCode < 500:
+			code = "invalid_request"
+		}
+	}
+
+	params := url.Values{}
+	params.Set("error", code)
+
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	return params
+}
+
+/*
+WebMessageOrigin - Returns the origin of the redirect URI of the authorization request. Responses in the web_message
+response mode are only ever posted to this origin, so that no other site embedding the authorization endpoint can
+receive them
+*/
+func WebMessageOrigin(app *client.Client, req *request.AuthorizationRequest) (string, error) {
+	parsed, err := url.Parse(RedirectURI(app, req))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", ErrRedirectURIMismatch
+	}
+
+	return parsed.Scheme + "://" + parsed.Host, nil
+}
+
+/*
+redirectWith - Appends the parameters to the redirect URI, in the fragment if the response mode is fragment or the
+response type includes an ID token, and in the query string otherwise. Any existing query parameters on the redirect URI
+are preserved
+*/
+func redirectWith(redirectUri string, responseType string, responseMode string, params url.Values) (string, error) {
+	parsed, err := url.Parse(redirectUri)
+	if err != nil {
+		return "", ErrRedirectURIMismatch
+	}
+
+	if responseMode == ResponseModeFragment || (responseMode != ResponseModeQuery && slices.Contains(strings.Fields(responseType), client.ResponseTypeIdToken)) {
+		parsed.Fragment = params.Encode()
+		return parsed.String(), nil
+	}
+
+	query := parsed.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String(), nil
+}
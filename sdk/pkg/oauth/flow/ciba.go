@@ -0,0 +1,426 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/resourceserver"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// maxBindingMessageLength - The longest binding message that is accepted. Binding messages are displayed on the user's authentication device, so they must be short
+const maxBindingMessageLength = 64
+
+/*
+The short codes of the backchannel authentication errors below are the error codes defined in OpenID CIBA Core 1.0
+sections 13 and 11, as clients decide whether to keep polling based on them. The polling errors of the device
+authorization grant (ErrAuthorizationPending, ErrSlowDown) and its statuses (DeviceStatusPending) are shared with this
+grant, as they have the same meaning
+*/
+
+// ErrInvalidBackchannelRequest - Returned when a backchannel authentication request is missing a required parameter, or uses one that is not supported
+var ErrInvalidBackchannelRequest = credstackError.NewError(400, "invalid_request", "ciba: The backchannel authentication request is missing a required parameter or is malformed")
+
+// ErrUnknownUserId - Returned when the user identified by the login hint does not exist
+var ErrUnknownUserId = credstackError.NewError(400, "unknown_user_id", "ciba: The user identified by the login hint does not exist")
+
+// ErrInvalidBindingMessage - Returned when the binding message is too long to be displayed on the user's authentication device
+var ErrInvalidBindingMessage = credstackError.NewError(400, "invalid_binding_message", "ciba: The binding message must be 64 characters or fewer")
+
+// ErrBackchannelAccessDenied - Returned when the user denied the backchannel authentication request
+var ErrBackchannelAccessDenied = credstackError.NewError(403, "access_denied", "ciba: The user denied the authentication request")
+
+// ErrBackchannelRequestExpired - Returned when the backchannel authentication request has expired and the client must start over
+var ErrBackchannelRequestExpired = credstackError.NewError(400, "expired_token", "ciba: The authentication request has expired")
+
+// ErrInvalidAuthReqId - Returned when the auth_req_id does not exist, does not belong to the client, or has already been used
+var ErrInvalidAuthReqId = credstackError.NewError(400, "invalid_grant", "ciba: The auth_req_id is invalid")
+
+// ErrBackchannelRequestNotFound - Returned when a user tries to decide a backchannel authentication request that does not exist, has expired, was not made for them, or has already been decided
+var ErrBackchannelRequestNotFound = credstackError.NewError(404, "ERR_BACKCHANNEL_REQUEST_NOT_FOUND", "ciba: The authentication request does not exist or has expired")
+
+/*
+BackchannelAuthentication - Represents a pending backchannel authentication request stored in the backchannel_request
+collection
+*/
+type BackchannelAuthentication struct {
+	// Header - The header for the BackchannelAuthentication. Created at object birth
+	Header *header.Header `json:"header" bson:"header"`
+
+	// AuthReqId - The identifier the client redeems at the token endpoint
+	AuthReqId string `json:"auth_req_id" bson:"auth_req_id"`
+
+	// ClientId - The client ID of the application that requested authentication
+	ClientId string `json:"client_id" bson:"client_id"`
+
+	// Audience - The audience the client requested a token for
+	Audience string `json:"audience" bson:"audience"`
+
+	// Scope - The scopes the client requested. Always includes openid
+	Scope string `json:"scope" bson:"scope"`
+
+	// Subject - The identifier of the user being asked to authenticate, resolved from the login hint
+	Subject string `json:"subject" bson:"subject"`
+
+	// BindingMessage - The message displayed on the user's authentication device. Can be empty
+	BindingMessage string `json:"binding_message" bson:"binding_message"`
+
+	// ClientNotificationToken - The bearer token sent to the client's notification endpoint. Only set for the ping delivery mode
+	ClientNotificationToken string `json:"client_notification_token" bson:"client_notification_token"`
+
+	// Status - The current status of the request. Can be: pending, approved, denied, consumed
+	Status string `json:"status" bson:"status"`
+
+	// ExpiresAt - A unix timestamp representing when the request expires
+	ExpiresAt int64 `json:"expires_at" bson:"expires_at"`
+
+	// Interval - The minimum number of seconds the client must wait between polling requests
+	Interval int64 `json:"interval" bson:"interval"`
+
+	// LastPolledAt - A unix timestamp representing the last time the client polled the token endpoint
+	LastPolledAt int64 `json:"last_polled_at" bson:"last_polled_at"`
+}
+
+/*
+userNotification - The body POSTed to the user notification endpoint when a new backchannel authentication request is
+created. The endpoint is expected to prompt the user on their authentication device, which then approves or denies the
+request at the backchannel verification endpoint
+*/
+type userNotification struct {
+	// AuthReqId - The identifier of the request, which the authentication device sends back when deciding it
+	AuthReqId string `json:"auth_req_id"`
+
+	// Subject - The identifier of the user being asked to authenticate
+	Subject string `json:"sub"`
+
+	// ClientId - The client ID of the application that requested authentication
+	ClientId string `json:"client_id"`
+
+	// ClientName - The name of the application that requested authentication, for display
+	ClientName string `json:"client_name"`
+
+	// Scope - The scopes the application requested
+	Scope string `json:"scope"`
+
+	// BindingMessage - The message the user should compare with the one displayed by the application
+	BindingMessage string `json:"binding_message,omitempty"`
+
+	// ExpiresAt - A unix timestamp representing when the request expires
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+/*
+NewBackchannelAuthentication - Starts the client initiated backchannel authentication grant (OpenID CIBA Core 1.0) for
+the user identified by the login hint. Only confidential clients that have been granted the CIBA grant type can start
+it, and the request must include the openid scope. Only the login_hint is supported for identifying the user, and it
+must be their email address.
+
+The request is stored as pending, and the user notification endpoint is notified in the background, so that the user
+can be prompted to approve it on their authentication device. Clients using the ping delivery mode must include a
+client notification token, which is sent back to their notification endpoint once the user decides
+*/
+func NewBackchannelAuthentication(serv *server.Server, req *request.BackchannelAuthenticationRequest) (*response.BackchannelAuthenticationResponse, error) {
+	if req.ClientId == "" || req.Audience == "" {
+		return nil, ErrInvalidBackchannelRequest
+	}
+
+	app, err := AuthenticateClient(serv, req.ClientId, req.ClientSecret, req.RemoteAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.ValidateAuthFlow(&request.TokenRequest{GrantType: client.GrantTypeCIBA, Audience: req.Audience})
+	if err != nil {
+		return nil, err
+	}
+
+	if !requestsOpenID(req.Scope) || req.LoginHint == "" || req.IdTokenHint != "" || req.LoginHintToken != "" {
+		return nil, ErrInvalidBackchannelRequest
+	}
+
+	if app.DeliveryMode() == client.DeliveryModePing && req.ClientNotificationToken == "" {
+		return nil, ErrInvalidBackchannelRequest
+	}
+
+	if len([]rune(req.BindingMessage)) > maxBindingMessageLength {
+		return nil, ErrInvalidBindingMessage
+	}
+
+	_, err = resourceserver.Get(serv, req.Audience)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := user.Get(serv, req.LoginHint, false)
+	if err != nil {
+		if errors.Is(err, user.ErrUserDoesNotExist) {
+			return nil, ErrUnknownUserId
+		}
+
+		return nil, err
+	}
+
+	cibaConfig := serv.Config.CIBAConfig
+
+	lifetime := int64(cibaConfig.RequestLifetime.Seconds())
+	if req.RequestedExpiry > 0 && req.RequestedExpiry < lifetime {
+		lifetime = req.RequestedExpiry
+	}
+
+	authReqId, err := secret.Generate(config.SecretPolicy{Encoding: config.SecretEncodingBase64, Length: 32})
+	if err != nil {
+		return nil, err
+	}
+
+	authentication := &BackchannelAuthentication{
+		Header:                  header.New(authReqId),
+		AuthReqId:               authReqId,
+		ClientId:                app.ClientId,
+		Audience:                req.Audience,
+		Scope:                   req.Scope,
+		Subject:                 account.Subject(),
+		BindingMessage:          req.BindingMessage,
+		ClientNotificationToken: req.ClientNotificationToken,
+		Status:                  DeviceStatusPending,
+		ExpiresAt:               serv.Clock().Now().Unix() + lifetime,
+		Interval:                int64(cibaConfig.PollingInterval.Seconds()),
+		LastPolledAt:            0,
+	}
+
+	_, err = serv.Database().Collection("backchannel_request").InsertOne(serv.Context(), authentication)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if cibaConfig.UserNotificationEndpoint != "" {
+		go notify(serv, cibaConfig.UserNotificationEndpoint, cibaConfig.UserNotificationToken, userNotification{
+			AuthReqId:      authReqId,
+			Subject:        authentication.Subject,
+			ClientId:       app.ClientId,
+			ClientName:     app.Name,
+			Scope:          authentication.Scope,
+			BindingMessage: authentication.BindingMessage,
+			ExpiresAt:      authentication.ExpiresAt,
+		})
+	}
+
+	return &response.BackchannelAuthenticationResponse{
+		AuthReqId: authReqId,
+		ExpiresIn: uint32(lifetime),
+		Interval:  uint32(authentication.Interval),
+	}, nil
+}
+
+/*
+ApproveBackchannel - Approves the pending backchannel authentication request for the auth_req_id provided in the
+parameter. The subject is the identifier of the user that authenticated on their authentication device, and must be the
+user the request was made for. If the request does not exist, has expired, was made for another user, or has already
+been decided, then ErrBackchannelRequestNotFound is returned
+*/
+func ApproveBackchannel(serv *server.Server, authReqId string, subject string) error {
+	return decideBackchannel(serv, authReqId, subject, DeviceStatusApproved)
+}
+
+/*
+DenyBackchannel - Denies the pending backchannel authentication request for the auth_req_id provided in the parameter.
+The next time the client polls, it receives ErrBackchannelAccessDenied
+*/
+func DenyBackchannel(serv *server.Server, authReqId string, subject string) error {
+	return decideBackchannel(serv, authReqId, subject, DeviceStatusDenied)
+}
+
+/*
+decideBackchannel - Provides the shared logic for ApproveBackchannel and DenyBackchannel. Only pending, unexpired
+requests made for the subject can be decided, and this is enforced in the filter so that a request cannot be decided
+twice. Clients using the ping delivery mode are notified in the background once the request is decided, whether it
+was approved or denied (OpenID CIBA Core 1.0 section 10.2)
+*/
+func decideBackchannel(serv *server.Server, authReqId string, subject string, status string) error {
+	var authentication BackchannelAuthentication
+
+	err := serv.Database().Collection("backchannel_request").FindOneAndUpdate(
+		serv.Context(),
+		bson.M{
+			"auth_req_id": authReqId,
+			"subject":     subject,
+			"status":      DeviceStatusPending,
+			"expires_at":  bson.M{"$gt": serv.Clock().Now().Unix()},
+		},
+		bson.M{"$set": bson.M{"status": status}},
+	).Decode(&authentication)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrBackchannelRequestNotFound
+		}
+
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	app, err := client.Get(serv, authentication.ClientId, false)
+	if err != nil {
+		return err
+	}
+
+	if app.DeliveryMode() == client.DeliveryModePing {
+		go notify(serv, app.BackchannelClientNotificationEndpoint, authentication.ClientNotificationToken, map[string]string{
+			"auth_req_id": authentication.AuthReqId,
+		})
+	}
+
+	return nil
+}
+
+/*
+notify - POSTs the body provided in the parameter as JSON to the endpoint, authenticated with the bearer token. This is
+used for both the user notification endpoint and client notification endpoints. Failures are logged rather than
+returned, as the client can still poll the token endpoint
+*/
+func notify(serv *server.Server, endpoint string, bearer string, body any) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to encode backchannel notification", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), serv.Config.CIBAConfig.NotificationTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(encoded))
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to build backchannel notification for "+endpoint, err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to send backchannel notification to "+endpoint, err)
+		return
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		serv.Log().LogErrorEvent("Backchannel notification was rejected by "+endpoint, fmt.Errorf("status code %d", resp.StatusCode))
+	}
+}
+
+/*
+backchannelGrant - Issues claims for the client initiated backchannel authentication grant once the user has approved
+the request. Clients using the poll delivery mode are expected to poll this until it succeeds, so every call that does
+not return claims returns one of the polling errors defined in OpenID CIBA Core 1.0 section 11. The request is returned
+alongside the claims, so that the requested scopes can be applied to the token
+*/
+func backchannelGrant(serv *server.Server, app *client.Client, req *request.TokenRequest, issuer string) (*jwt.RegisteredClaims, *BackchannelAuthentication, error) {
+	if req.AuthReqId == "" {
+		return nil, nil, ErrInvalidTokenRequest
+	}
+
+	if app.IsPublic {
+		return nil, nil, client.ErrVisibilityIssue
+	}
+
+	var authentication BackchannelAuthentication
+
+	err := serv.Database().Collection("backchannel_request").FindOne(
+		serv.Context(),
+		bson.M{"auth_req_id": req.AuthReqId, "client_id": app.ClientId},
+	).Decode(&authentication)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil, ErrInvalidAuthReqId
+		}
+
+		return nil, nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if authentication.Audience != req.Audience {
+		return nil, nil, ErrInvalidAuthReqId
+	}
+
+	now := serv.Clock().Now().Unix()
+	if authentication.ExpiresAt <= now {
+		return nil, nil, ErrBackchannelRequestExpired
+	}
+
+	/*
+		Polling is throttled in the same way as the device authorization grant. Clients using the ping delivery mode
+		should only call the token endpoint once they are notified, so they are never throttled
+	*/
+	if app.DeliveryMode() == client.DeliveryModePoll {
+		update := bson.M{"last_polled_at": now}
+		tooFast := now-authentication.LastPolledAt < authentication.Interval
+		if tooFast {
+			update["interval"] = authentication.Interval + slowDownIncrement
+		}
+
+		_, err = serv.Database().Collection("backchannel_request").UpdateOne(
+			serv.Context(),
+			bson.M{"auth_req_id": authentication.AuthReqId},
+			bson.M{"$set": update},
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		if tooFast {
+			return nil, nil, ErrSlowDown
+		}
+	}
+
+	switch authentication.Status {
+	case DeviceStatusPending:
+		return nil, nil, ErrAuthorizationPending
+	case DeviceStatusDenied:
+		return nil, nil, ErrBackchannelAccessDenied
+	case DeviceStatusConsumed:
+		return nil, nil, ErrInvalidAuthReqId
+	}
+
+	/*
+		The request is consumed atomically, so that if the client polls twice at the same time only one token is issued
+		for it
+	*/
+	result, err := serv.Database().Collection("backchannel_request").UpdateOne(
+		serv.Context(),
+		bson.M{"auth_req_id": authentication.AuthReqId, "status": DeviceStatusApproved},
+		bson.M{"$set": bson.M{"status": DeviceStatusConsumed}},
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.ModifiedCount == 0 {
+		return nil, nil, ErrInvalidAuthReqId
+	}
+
+	claims := claim.NewClaimsWithSubject(
+		serv.Clock(),
+		issuer,
+		authentication.Audience,
+		authentication.Subject,
+		app.TokenLifetime,
+	)
+
+	return &claims, &authentication, nil
+}
@@ -0,0 +1,159 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrInvalidAuthorizationCode - Returned when an authorization code does not exist, has expired, has already been redeemed, or was issued to a different client, redirect URI, or audience
+var ErrInvalidAuthorizationCode = credstackError.NewError(400, "invalid_grant", "authorize: The authorization code is invalid or has expired")
+
+/*
+AuthorizationCode - Represents an authorization code stored in the authorization_code collection. Authorization codes
+are single use, and are exchanged for tokens at the token endpoint with the authorization code grant
+*/
+type AuthorizationCode struct {
+	// Header - The header for the AuthorizationCode. Created at object birth
+	Header *header.Header `json:"header" bson:"header"`
+
+	// Code - The authorization code that was returned to the client
+	Code string `json:"code" bson:"code"`
+
+	// ClientId - The client ID of the application the code was issued to
+	ClientId string `json:"client_id" bson:"client_id"`
+
+	// RedirectUri - The redirect URI sent in the authorization request. If set, the token request must send the same one
+	RedirectUri string `json:"redirect_uri" bson:"redirect_uri"`
+
+	// Audience - The audience the code can be exchanged for a token for
+	Audience string `json:"audience" bson:"audience"`
+
+	// Subject - The identifier of the user that authorized the client
+	Subject string `json:"subject" bson:"subject"`
+
+	// Scope - The scopes that were requested in the authorization request
+	Scope string `json:"scope" bson:"scope"`
+
+	// Nonce - The nonce sent in the authorization request. Inserted into the ID token issued when the code is redeemed
+	Nonce string `json:"nonce" bson:"nonce"`
+
+	// CodeChallenge - The PKCE code challenge sent in the authorization request. If set, the token request must send the code verifier it was derived from
+	CodeChallenge string `json:"code_challenge" bson:"code_challenge"`
+
+	// CodeChallengeMethod - The method the code challenge was derived with. Always S256 if a code challenge is set
+	CodeChallengeMethod string `json:"code_challenge_method" bson:"code_challenge_method"`
+
+	// SessionId - The identifier of the session the user authorized the client in. Copied to the tokens the code is redeemed for
+	SessionId string `json:"session_id" bson:"session_id"`
+
+	// ExpiresAt - A unix timestamp representing when the code expires
+	ExpiresAt int64 `json:"expires_at" bson:"expires_at"`
+
+	// Consumed - If set to true, the code has already been redeemed
+	Consumed bool `json:"consumed" bson:"consumed"`
+}
+
+/*
+issueAuthorizationCode - Generates and stores an authorization code for the user identified by the subject, bound to the
+session identified by sessionRef. The code expires after AuthorizationConfig.CodeLifetime
+*/
+func issueAuthorizationCode(serv *server.Server, app *client.Client, req *request.AuthorizationRequest, subject string, sessionRef string) (string, error) {
+	code, err := secret.Generate(config.SecretPolicy{Encoding: config.SecretEncodingBase64, Length: 32})
+	if err != nil {
+		return "", err
+	}
+
+	authorizationCode := &AuthorizationCode{
+		Header:              header.New(code),
+		Code:                code,
+		ClientId:            app.ClientId,
+		RedirectUri:         req.RedirectUri,
+		Audience:            req.Audience,
+		Subject:             subject,
+		Scope:               req.Scope,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		SessionId:           sessionRef,
+		ExpiresAt:           serv.Clock().Now().Add(serv.Config.AuthorizationConfig.CodeLifetime).Unix(),
+		Consumed:            false,
+	}
+
+	_, err = serv.Database().Collection("authorization_code").InsertOne(serv.Context(), authorizationCode)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return code, nil
+}
+
+/*
+authorizationCodeGrant - Exchanges an authorization code for claims issued on behalf of the user that authorized the
+client. The code is consumed atomically, so it can only be redeemed once. If the authorization request included a
+redirect URI, then the token request must include the same one (RFC 6749 section 4.1.3). Public clients are not
+required to send a client secret, however confidential clients are.
+
+If the authorization request included a code challenge, then the token request must include the code verifier it was
+derived from (RFC 7636 section 4.5). Public clients are always required to, as without a secret the verifier is the only
+proof that the code was not intercepted. The code is consumed before the verifier is checked, so that a code cannot be
+brute forced with repeated guesses. The redeemed code is returned so that the scope and nonce of the authorization
+request can be applied to the ID token
+*/
+func authorizationCodeGrant(serv *server.Server, app *client.Client, req *request.TokenRequest, issuer string) (*jwt.RegisteredClaims, *AuthorizationCode, error) {
+	if req.Code == "" {
+		return nil, nil, ErrInvalidTokenRequest
+	}
+
+	var redeemed AuthorizationCode
+
+	err := serv.Database().Collection("authorization_code").FindOneAndUpdate(
+		serv.Context(),
+		bson.M{
+			"code":         req.Code,
+			"client_id":    app.ClientId,
+			"redirect_uri": req.RedirectUri,
+			"audience":     req.Audience,
+			"consumed":     false,
+			"expires_at":   bson.M{"$gt": serv.Clock().Now().Unix()},
+		},
+		bson.M{"$set": bson.M{"consumed": true}},
+	).Decode(&redeemed)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil, ErrInvalidAuthorizationCode
+		}
+
+		return nil, nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if app.IsPublic && redeemed.CodeChallenge == "" {
+		return nil, nil, ErrInvalidCodeVerifier
+	}
+
+	err = verifyCodeVerifier(redeemed.CodeChallenge, req.CodeVerifier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims := claim.NewClaimsWithSubject(
+		serv.Clock(),
+		issuer,
+		redeemed.Audience,
+		redeemed.Subject,
+		app.TokenLifetime,
+	)
+
+	return &claims, &redeemed, nil
+}
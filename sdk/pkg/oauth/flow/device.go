@@ -0,0 +1,309 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/resourceserver"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	// DeviceStatusPending - The user has not entered the user code yet
+	DeviceStatusPending string = "pending"
+
+	// DeviceStatusApproved - The user approved the device, and a token can be issued the next time it polls
+	DeviceStatusApproved string = "approved"
+
+	// DeviceStatusDenied - The user denied the device. Tokens are never issued for it
+	DeviceStatusDenied string = "denied"
+
+	// DeviceStatusConsumed - A token has already been issued for the device code
+	DeviceStatusConsumed string = "consumed"
+)
+
+// userCodeAlphabet - The characters user codes are drawn from. Vowels are excluded so that user codes never spell words, and ambiguous characters are excluded so that they can be typed on a TV remote (RFC 8628 section 6.1)
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// slowDownIncrement - The number of seconds added to a device's polling interval each time it polls too quickly (RFC 8628 section 3.5)
+const slowDownIncrement = 5
+
+/*
+The short codes of the polling errors below are the error codes defined in RFC 8628 section 3.5, instead of the ERR_
+codes used elsewhere, as devices decide whether to keep polling based on them
+*/
+
+// ErrAuthorizationPending - Returned when a device polls before the user has approved or denied it
+var ErrAuthorizationPending = credstackError.NewError(400, "authorization_pending", "device: The user has not approved the device yet")
+
+// ErrSlowDown - Returned when a device polls more often than its interval allows. The interval is increased by 5 seconds each time this is returned
+var ErrSlowDown = credstackError.NewError(400, "slow_down", "device: The device is polling too quickly")
+
+// ErrDeviceAccessDenied - Returned when the user denied the device
+var ErrDeviceAccessDenied = credstackError.NewError(400, "access_denied", "device: The user denied the device")
+
+// ErrDeviceCodeExpired - Returned when the device code has expired and the device must start over
+var ErrDeviceCodeExpired = credstackError.NewError(400, "expired_token", "device: The device code has expired")
+
+// ErrInvalidDeviceCode - Returned when the device code does not exist, does not belong to the client, or has already been used
+var ErrInvalidDeviceCode = credstackError.NewError(400, "invalid_grant", "device: The device code is invalid")
+
+// ErrInvalidUserCode - Returned when a user enters a user code that does not exist, has expired, or has already been used
+var ErrInvalidUserCode = credstackError.NewError(404, "ERR_INVALID_USER_CODE", "device: The user code is invalid or has expired")
+
+/*
+DeviceAuthorization - Represents a pending device authorization stored in the device_code collection
+*/
+type DeviceAuthorization struct {
+	// Header - The header for the DeviceAuthorization. Created at object birth
+	Header *header.Header `json:"header" bson:"header"`
+
+	// DeviceCode - The code the device polls the token endpoint with
+	DeviceCode string `json:"device_code" bson:"device_code"`
+
+	// UserCode - The code the user enters at the verification URI. Stored without its separator (BCDFGHJK)
+	UserCode string `json:"user_code" bson:"user_code"`
+
+	// ClientId - The client ID of the application running on the device
+	ClientId string `json:"client_id" bson:"client_id"`
+
+	// Audience - The audience the device requested a token for
+	Audience string `json:"audience" bson:"audience"`
+
+	// Status - The current status of the authorization. Can be: pending, approved, denied, consumed
+	Status string `json:"status" bson:"status"`
+
+	// Subject - The identifier of the user that approved the device. Empty until approved
+	Subject string `json:"subject" bson:"subject"`
+
+	// ExpiresAt - A unix timestamp representing when the device code expires
+	ExpiresAt int64 `json:"expires_at" bson:"expires_at"`
+
+	// Interval - The minimum number of seconds the device must wait between polling requests
+	Interval int64 `json:"interval" bson:"interval"`
+
+	// LastPolledAt - A unix timestamp representing the last time the device polled the token endpoint
+	LastPolledAt int64 `json:"last_polled_at" bson:"last_polled_at"`
+}
+
+/*
+normalizeUserCode - Converts a user entered code into the form it is stored in. Users may enter the code in lowercase
+and with or without the separator, so both are stripped here
+*/
+func normalizeUserCode(userCode string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(userCode))
+}
+
+/*
+NewDeviceAuthorization - Starts the device authorization grant for the client and audience in the request. A device
+code and user code are generated and stored, and the response that should be returned to the device is built. The user
+code is returned formatted with a separator (BCDF-GHJK) so that it is easier to read
+*/
+func NewDeviceAuthorization(serv *server.Server, req *request.DeviceAuthorizationRequest) (*response.DeviceAuthorizationResponse, error) {
+	if req.ClientId == "" || req.Audience == "" {
+		return nil, ErrInvalidTokenRequest
+	}
+
+	app, err := client.Get(serv, req.ClientId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.ValidateAuthFlow(&request.TokenRequest{GrantType: client.GrantTypeDeviceCode, Audience: req.Audience})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = resourceserver.Get(serv, req.Audience)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, err := secret.Generate(config.SecretPolicy{Encoding: config.SecretEncodingBase64, Length: 32})
+	if err != nil {
+		return nil, err
+	}
+
+	userCode, err := secret.Generate(config.SecretPolicy{Encoding: config.SecretEncodingAlphabet, Length: 8, Alphabet: userCodeAlphabet})
+	if err != nil {
+		return nil, err
+	}
+
+	deviceConfig := serv.Config.DeviceConfig
+
+	authorization := &DeviceAuthorization{
+		Header:       header.New(deviceCode),
+		DeviceCode:   deviceCode,
+		UserCode:     userCode,
+		ClientId:     app.ClientId,
+		Audience:     req.Audience,
+		Status:       DeviceStatusPending,
+		ExpiresAt:    serv.Clock().Now().Add(deviceConfig.CodeLifetime).Unix(),
+		Interval:     int64(deviceConfig.PollingInterval.Seconds()),
+		LastPolledAt: 0,
+	}
+
+	_, err = serv.Database().Collection("device_code").InsertOne(serv.Context(), authorization)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	formatted := userCode[:4] + "-" + userCode[4:]
+
+	return &response.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatted,
+		VerificationURI:         deviceConfig.VerificationURI,
+		VerificationURIComplete: deviceConfig.VerificationURI + "?user_code=" + url.QueryEscape(formatted),
+		ExpiresIn:               uint32(deviceConfig.CodeLifetime.Seconds()),
+		Interval:                uint32(authorization.Interval),
+	}, nil
+}
+
+/*
+ApproveDevice - Approves the pending device authorization for the user code provided in the parameter. The subject is
+the identifier of the user that approved it, and is used as the sub claim of the token issued to the device. If the user
+code does not exist, has expired, or has already been used, then ErrInvalidUserCode is returned
+*/
+func ApproveDevice(serv *server.Server, userCode string, subject string) error {
+	return decideDevice(serv, userCode, bson.M{"status": DeviceStatusApproved, "subject": subject})
+}
+
+/*
+DenyDevice - Denies the pending device authorization for the user code provided in the parameter. The next time the
+device polls, it receives ErrDeviceAccessDenied
+*/
+func DenyDevice(serv *server.Server, userCode string) error {
+	return decideDevice(serv, userCode, bson.M{"status": DeviceStatusDenied})
+}
+
+/*
+decideDevice - Provides the shared logic for ApproveDevice and DenyDevice. Only pending, unexpired authorizations can be
+decided, and this is enforced in the filter so that a user code cannot be approved twice
+*/
+func decideDevice(serv *server.Server, userCode string, update bson.M) error {
+	result, err := serv.Database().Collection("device_code").UpdateOne(
+		serv.Context(),
+		bson.M{
+			"user_code":  normalizeUserCode(userCode),
+			"status":     DeviceStatusPending,
+			"expires_at": bson.M{"$gt": serv.Clock().Now().Unix()},
+		},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrInvalidUserCode
+	}
+
+	return nil
+}
+
+/*
+deviceCodeGrant - Issues claims for the device authorization grant once the user has approved the device. Devices are
+expected to poll this until it succeeds, so every call that does not return claims returns one of the polling errors
+defined in RFC 8628. Public clients are not required to send a client secret, however confidential clients are
+*/
+func deviceCodeGrant(serv *server.Server, app *client.Client, req *request.TokenRequest, issuer string) (*jwt.RegisteredClaims, error) {
+	if req.DeviceCode == "" {
+		return nil, ErrInvalidTokenRequest
+	}
+
+	var authorization DeviceAuthorization
+
+	err := serv.Database().Collection("device_code").FindOne(
+		serv.Context(),
+		bson.M{"device_code": req.DeviceCode, "client_id": app.ClientId},
+	).Decode(&authorization)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidDeviceCode
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if authorization.Audience != req.Audience {
+		return nil, ErrInvalidDeviceCode
+	}
+
+	now := serv.Clock().Now().Unix()
+	if authorization.ExpiresAt <= now {
+		return nil, ErrDeviceCodeExpired
+	}
+
+	/*
+		Every poll is recorded so that we can tell if the device is polling faster than its interval. If it is, then the
+		interval is increased, as RFC 8628 requires the device to add 5 seconds to its interval when it receives slow_down
+	*/
+	update := bson.M{"last_polled_at": now}
+	tooFast := now-authorization.LastPolledAt < authorization.Interval
+	if tooFast {
+		update["interval"] = authorization.Interval + slowDownIncrement
+	}
+
+	_, err = serv.Database().Collection("device_code").UpdateOne(
+		serv.Context(),
+		bson.M{"device_code": authorization.DeviceCode},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if tooFast {
+		return nil, ErrSlowDown
+	}
+
+	switch authorization.Status {
+	case DeviceStatusPending:
+		return nil, ErrAuthorizationPending
+	case DeviceStatusDenied:
+		return nil, ErrDeviceAccessDenied
+	case DeviceStatusConsumed:
+		return nil, ErrInvalidDeviceCode
+	}
+
+	/*
+		The device code is consumed atomically, so that if the device polls twice at the same time only one token is
+		issued for it
+	*/
+	result, err := serv.Database().Collection("device_code").UpdateOne(
+		serv.Context(),
+		bson.M{"device_code": authorization.DeviceCode, "status": DeviceStatusApproved},
+		bson.M{"$set": bson.M{"status": DeviceStatusConsumed}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.ModifiedCount == 0 {
+		return nil, ErrInvalidDeviceCode
+	}
+
+	claims := claim.NewClaimsWithSubject(
+		serv.Clock(),
+		issuer,
+		authorization.Audience,
+		authorization.Subject,
+		app.TokenLifetime,
+	)
+
+	return &claims, nil
+}
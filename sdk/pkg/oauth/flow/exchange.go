@@ -0,0 +1,180 @@
+package flow
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// TokenTypeAccessToken - The token type identifier for OAuth 2.0 access tokens (RFC 8693 section 3)
+	TokenTypeAccessToken string = "urn:ietf:params:oauth:token-type:access_token"
+
+	// TokenTypeJWT - The token type identifier for JWTs (RFC 8693 section 3). Accepted for subject and actor tokens, as access tokens issued by credstack are JWTs
+	TokenTypeJWT string = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+/*
+The short codes of the token exchange errors below are the error codes defined in RFC 6749 section 5.2, as RFC 8693
+section 2.2.2 requires them to be used for token exchange
+*/
+
+// ErrUnsupportedTokenType - Returned when a subject, actor, or requested token type is not one that credstack can exchange
+var ErrUnsupportedTokenType = credstackError.NewError(400, "invalid_request", "token: Only access tokens issued by credstack can be exchanged")
+
+// ErrInvalidSubjectToken - Returned when the subject or actor token does not exist, has expired, or has been revoked
+var ErrInvalidSubjectToken = credstackError.NewError(400, "invalid_grant", "token: The subject or actor token is invalid, expired, or revoked")
+
+// ErrActorNotPermitted - Returned when the subject token names the parties that can act on its behalf (may_act), and the actor is not one of them
+var ErrActorNotPermitted = credstackError.NewError(400, "invalid_grant", "token: The actor is not permitted to act on behalf of the subject")
+
+// ErrInvalidExchangeScope - Returned when the requested scope is not a subset of the scope of the subject token
+var ErrInvalidExchangeScope = credstackError.NewError(400, "invalid_scope", "token: The requested scope exceeds the scope of the subject token")
+
+/*
+tokenExchange - The outcome of a validated token exchange, used to issue the new token
+*/
+type tokenExchange struct {
+	// Subject - The subject token that was exchanged
+	Subject *token.Token
+
+	// Scope - The scope the new token is issued with. Either the requested scope or the scope of the subject token
+	Scope string
+
+	// Act - The act claim (RFC 8693 section 4.1) inserted into the new token. Identifies the current actor, with any previous actors nested under it
+	Act map[string]any
+}
+
+/*
+tokenExchangeGrant - Exchanges a subject token for claims targeting a different audience (RFC 8693). The client must be
+confidential, must have been granted the can_impersonate capability, and its exchange policy must allow tokens issued to
+the subject token's client to be exchanged for the requested audience.
+
+Exchanged tokens always describe delegation rather than impersonation: the new token keeps the subject of the subject
+token and identifies the actor in the act claim. The actor is the subject of the actor token if one is provided, and
+the requesting client otherwise. If the subject token was itself exchanged, its act claim is nested under the new one,
+so that the full delegation chain is preserved. If the subject token has a may_act claim, then only the actor it names
+can exchange it.
+
+The new token can only be issued with a subset of the subject token's scope, and never outlives the subject token
+*/
+func tokenExchangeGrant(serv *server.Server, app *client.Client, req *request.TokenRequest, issuer string) (*jwt.RegisteredClaims, *tokenExchange, error) {
+	if req.SubjectToken == "" || req.SubjectTokenType == "" {
+		return nil, nil, ErrInvalidTokenRequest
+	}
+
+	if app.IsPublic {
+		return nil, nil, client.ErrVisibilityIssue
+	}
+
+	err := app.RequireCapability(client.CapabilityImpersonate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken {
+		return nil, nil, ErrUnsupportedTokenType
+	}
+
+	subject, subjectClaims, err := exchangeableToken(serv, req.SubjectToken, req.SubjectTokenType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = app.ValidateExchange(req.Audience, subject.ClientId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	actor := app.ClientId
+	if req.ActorToken != "" {
+		actorToken, _, err := exchangeableToken(serv, req.ActorToken, req.ActorTokenType)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		actor = actorToken.Subject
+	}
+
+	/*
+		may_act is an object naming the party allowed to act for the subject. Only the sub member is evaluated, as it is
+		the only member credstack can compare against the actor
+	*/
+	if mayAct, ok := subjectClaims["may_act"].(map[string]any); ok {
+		if allowed, _ := mayAct["sub"].(string); allowed != actor {
+			return nil, nil, ErrActorNotPermitted
+		}
+	}
+
+	scope := subject.Scope
+	if req.Scope != "" {
+		granted := strings.Fields(subject.Scope)
+		for _, requested := range strings.Fields(req.Scope) {
+			if !slices.Contains(granted, requested) {
+				return nil, nil, ErrInvalidExchangeScope
+			}
+		}
+
+		scope = req.Scope
+	}
+
+	act := map[string]any{"sub": actor}
+	if previous, ok := subjectClaims["act"].(map[string]any); ok {
+		act["act"] = previous
+	}
+
+	lifetime := app.TokenLifetime
+	if !subject.ExpiresAt.IsZero() {
+		remaining := uint64(subject.ExpiresAt.Sub(serv.Clock().Now()) / time.Second)
+		if remaining < lifetime {
+			lifetime = remaining
+		}
+	}
+
+	claims := claim.NewClaimsWithSubject(
+		serv.Clock(),
+		issuer,
+		req.Audience,
+		subject.Subject,
+		lifetime,
+	)
+
+	return &claims, &tokenExchange{Subject: subject, Scope: scope, Act: act}, nil
+}
+
+/*
+exchangeableToken - Fetches the active token that a subject or actor token was issued as, along with the claims in it.
+The claims are read without verifying the signature, which is safe as the token was found in the database and was
+therefore issued by credstack
+*/
+func exchangeableToken(serv *server.Server, tok string, tokenType string) (*token.Token, jwt.MapClaims, error) {
+	if tokenType != TokenTypeAccessToken && tokenType != TokenTypeJWT {
+		return nil, nil, ErrUnsupportedTokenType
+	}
+
+	issued, err := token.Lookup(serv, tok)
+	if err != nil {
+		if err == token.ErrInvalidAccessToken {
+			return nil, nil, ErrInvalidSubjectToken
+		}
+
+		return nil, nil, err
+	}
+
+	claims := jwt.MapClaims{}
+
+	_, _, err = jwt.NewParser().ParseUnverified(issued.Signed(), claims)
+	if err != nil {
+		return nil, nil, ErrInvalidSubjectToken
+	}
+
+	return issued, claims, nil
+}
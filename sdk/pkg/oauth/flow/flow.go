@@ -1,14 +1,30 @@
 package flow
 
 import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/events"
 	"github.com/credstack/credstack/sdk/pkg/models/request"
 	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
 	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/hook"
 	"github.com/credstack/credstack/sdk/pkg/oauth/resourceserver"
+	oauthScope "github.com/credstack/credstack/sdk/pkg/oauth/scope"
 	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/policy"
+	"github.com/credstack/credstack/sdk/pkg/rbac/role"
 	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/telemetry"
+	"github.com/credstack/credstack/sdk/pkg/tracing"
+	"github.com/credstack/credstack/sdk/pkg/user"
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ErrInvalidGrantType - A named error that gets returned when an unrecognized grant type is used to attempt to issue tokens
@@ -19,10 +35,34 @@ var ErrInvalidTokenRequest = credstackError.NewError(400, "ERR_INVALID_TOKEN_REQ
 
 /*
 IssueTokenForFlow - Responsible for issuing access tokens under a specific OAuth authentication flow. Handles validating
-token requests and marshaling access tokens to a token.TokenResponse structure. Any errors that are returned from this
+token requests and marshaling access tokens to a token.TokenResponse structure. Grant types other than the built-in ones
+are issued with the extended grant registered under them with RegisterGrant. Any errors that are returned from this
 function are wrapped with errors.CredstackError.
+
+The pipeline is recorded as a span (token.issue) of the trace carried by TokenRequest.Context, with a child span for each
+stage that can be slow: the policy engine, the user's claims, the hooks, signing, and storing the token
 */
 func IssueTokenForFlow(serv *server.Server, request *request.TokenRequest, issuer string) (*response.TokenResponse, error) {
+	ctx, span := tracing.Start(
+		request.Context,
+		"token.issue",
+		attribute.String("oauth.grant_type", request.GrantType),
+		attribute.String("oauth.client_id", request.ClientId),
+		attribute.String("oauth.audience", request.Audience),
+	)
+
+	request.Context = ctx
+
+	resp, err := issueToken(serv, request, issuer)
+	tracing.End(span, err)
+
+	return resp, err
+}
+
+/*
+issueToken - Provides the logic of IssueTokenForFlow, within the span it records
+*/
+func issueToken(serv *server.Server, request *request.TokenRequest, issuer string) (*response.TokenResponse, error) {
 	/*
 		This should change so that the user doesn't have to use an audience to issue tokens
 	*/
@@ -30,21 +70,142 @@ func IssueTokenForFlow(serv *server.Server, request *request.TokenRequest, issue
 		return nil, ErrInvalidTokenRequest
 	}
 
-	app, err := client.Get(serv, request.ClientId, true)
+	/*
+		The client is authenticated once for every grant. Public clients are returned without a secret being checked,
+		so grants that are only available to confidential clients reject them on their own
+	*/
+	app, err := authenticateClient(serv, request)
 	if err != nil {
 		return nil, err
 	}
 
 	var claims *jwt.RegisteredClaims
 
+	// subjectIsUser - Set for grants that issue tokens on behalf of a user, so that the user's claims can be inserted
+	var subjectIsUser bool
+
+	// refreshExpiresAt - The expiration inherited by the new refresh token when a refresh token is redeemed
+	var refreshExpiresAt time.Time
+
+	// refreshFamily - The family inherited by the new refresh token when a refresh token is redeemed
+	var refreshFamily string
+
+	// scope - The scopes the token is issued with. These come from the authorization request, the backchannel authentication request, or the redeemed refresh token for those grants
+	scope := request.Scope
+
+	// nonce - The nonce inserted into the ID token. Only set when an authorization code is redeemed
+	var nonce string
+
+	// sessionRef - The identifier of the session the token is bound to. Inherited from the redeemed authorization code, refresh token, or subject token
+	var sessionRef string
+
+	// exchange - The validated token exchange. Only set for the token exchange grant
+	var exchange *tokenExchange
+
 	switch request.GrantType {
 	case client.GrantTypeClientCredentials:
-		claims, err = app.ClientCredentials(request, issuer)
+		claims, err = app.ClientCredentials(serv.Clock(), request, issuer)
+		if err != nil {
+			return nil, err
+		}
+	case client.GrantTypeAuthorizationCode:
+		err = app.ValidateAuthFlow(request)
+		if err != nil {
+			return nil, err
+		}
+
+		var redeemed *AuthorizationCode
+
+		claims, redeemed, err = authorizationCodeGrant(serv, app, request, issuer)
+		if err != nil {
+			return nil, err
+		}
+
+		scope = redeemed.Scope
+		nonce = redeemed.Nonce
+		sessionRef = redeemed.SessionId
+		subjectIsUser = true
+	case client.GrantTypeDeviceCode:
+		err = app.ValidateAuthFlow(request)
+		if err != nil {
+			return nil, err
+		}
+
+		claims, err = deviceCodeGrant(serv, app, request, issuer)
+		if err != nil {
+			return nil, err
+		}
+
+		subjectIsUser = true
+	case client.GrantTypeCIBA:
+		err = app.ValidateAuthFlow(request)
+		if err != nil {
+			return nil, err
+		}
+
+		var authentication *BackchannelAuthentication
+
+		claims, authentication, err = backchannelGrant(serv, app, request, issuer)
+		if err != nil {
+			return nil, err
+		}
+
+		scope = authentication.Scope
+		subjectIsUser = true
+	case client.GrantTypeRefreshToken:
+		err = app.ValidateAuthFlow(request)
+		if err != nil {
+			return nil, err
+		}
+
+		var previous *token.Token
+
+		claims, previous, err = refreshTokenGrant(serv, app, request, issuer)
 		if err != nil {
 			return nil, err
 		}
+
+		refreshExpiresAt = previous.RefreshExpiresAt
+		refreshFamily = previous.Family
+		scope = previous.Scope
+		sessionRef = previous.SessionId
+
+		subjectIsUser = true
+	case client.GrantTypeTokenExchange:
+		err = app.ValidateAuthFlow(request)
+		if err != nil {
+			return nil, err
+		}
+
+		claims, exchange, err = tokenExchangeGrant(serv, app, request, issuer)
+		if err != nil {
+			return nil, err
+		}
+
+		/*
+			Subject tokens issued with client credentials have the client as their subject, so user claims are only
+			inserted when the subject token was issued on behalf of a user
+		*/
+		scope = exchange.Scope
+		sessionRef = exchange.Subject.SessionId
+		subjectIsUser = exchange.Subject.Subject != exchange.Subject.ClientId
 	default:
-		return nil, ErrInvalidGrantType
+		/*
+			Any other grant type must have been registered with RegisterGrant. Extended grants resolve everything the
+			built-in grants do above, so the token is issued from here exactly as it is for them
+		*/
+		result, err := extendedGrant(serv, app, request, issuer)
+		if err != nil {
+			return nil, err
+		}
+
+		claims = result.Claims
+		if result.Scope != "" {
+			scope = result.Scope
+		}
+
+		sessionRef = result.SessionId
+		subjectIsUser = result.SubjectIsUser
 	}
 
 	requestedApi, err := resourceserver.Get(serv, request.Audience)
@@ -52,15 +213,268 @@ func IssueTokenForFlow(serv *server.Server, request *request.TokenRequest, issue
 		return nil, err
 	}
 
-	generatedToken, err := requestedApi.GenerateToken(serv, app, *claims)
+	/*
+		The default and forced scopes of the client are applied before the scope is validated, so that the claims are
+		built from the resolved scope. Refreshed tokens keep the scope of the refresh token, as a refresh can never
+		broaden the scope that was originally granted (RFC 6749 section 6)
+	*/
+	if request.GrantType != client.GrantTypeRefreshToken {
+		scope, err = oauthScope.Resolve(serv, requestedApi.Audience, scope, app.DefaultScopes, app.ForcedScopes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = oauthScope.Validate(serv, requestedApi.Audience, scope)
 	if err != nil {
 		return nil, err
 	}
 
+	var subject string
+	if subjectIsUser {
+		subject = claims.Subject
+	}
+
+	extra := map[string]any{}
+	if exchange != nil {
+		extra["act"] = exchange.Act
+	}
+
+	/*
+		The user the token is issued for is fetched once, and only when something needs it: RBAC grants their roles,
+		business hours are evaluated in their time zone, their claims are inserted by the claims profile and claim
+		mappings, and hooks receive them. With RBAC enforced, the scopes of tokens issued on behalf of a user are narrowed
+		to the scopes granted to them, and their roles are inserted as a claim. Tokens issued with client credentials keep
+		the scopes they requested, which were validated above. This happens before the policy engine is consulted, so that
+		it sees the scopes the token is issued with
+	*/
+	var account *user.User
+	if subjectIsUser && (requestedApi.EnforceRBAC || policy.HasBusinessHours(serv.Config.PolicyConfig, requestedApi.Audience) || insertsUserClaims(requestedApi) || hook.Enabled(serv, requestedApi.Audience)) {
+		account, err = user.GetBySubject(serv, claims.Subject, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if requestedApi.EnforceRBAC && account != nil {
+		scope, err = role.Grant(serv, account, requestedApi.Audience, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		extra["roles"] = account.Roles
+	}
+
+	/*
+		The scope claim is inserted for every API, so that resource servers can authorize requests from the token alone
+		(see verify.Claims.HasScope), whether or not the API enforces RBAC
+	*/
+	if scope != "" {
+		extra["scope"] = scope
+	}
+
+	_, span := tracing.Start(request.Context, "token.policy")
+	err = policy.Evaluate(serv, &policy.Input{
+		Decision:  policy.DecisionToken,
+		Client:    &policy.ClientInput{ClientId: app.ClientId, Name: app.Name, IsPublic: app.IsPublic},
+		Subject:   subject,
+		GrantType: request.GrantType,
+		Audience:  requestedApi.Audience,
+		Scopes:    strings.Fields(scope),
+		Request:   policy.RequestInput{RemoteAddr: request.RemoteAddr},
+	})
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		Business hours are evaluated in the time zone of the user the token is issued for. Tokens that are not issued on
+		behalf of a user (client credentials) have no ZoneInfo, so the time zone defined on the policy itself is used
+		instead, as it is for users that have not set one
+	*/
+	zoneInfo := ""
+	if account != nil {
+		zoneInfo = account.ZoneInfo
+	}
+
+	err = policy.EnforceBusinessHours(serv.Config.PolicyConfig, requestedApi.Audience, zoneInfo, serv.Clock().Now())
+	if err != nil {
+		return nil, err
+	}
+
+	_, span = tracing.Start(request.Context, "token.claims")
+	extraClaims := userClaims(serv, requestedApi, account, extra)
+	tracing.End(span, nil)
+
+	/*
+		Hooks run once every other claim has been gathered, so that they see the claims the token is signed with. This
+		is the last point a token request can be denied at
+	*/
+	added, err := runHooks(serv, app, request, requestedApi.Audience, *claims, account, extraClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	maps.Copy(extraClaims, added)
+
+	var tokenClaims jwt.Claims = *claims
+	if len(extraClaims) != 0 {
+		tokenClaims = claim.WithExtra(*claims, extraClaims)
+	}
+
+	_, span = tracing.Start(request.Context, "token.sign")
+	generatedToken, err := requestedApi.GenerateToken(serv, app, tokenClaims)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	generatedToken.Scope = scope
+	generatedToken.SessionId = sessionRef
+
+	/*
+		Exchanged tokens never outlive their subject token, so their lifetime can be shorter than the client's token
+		lifetime. Refresh and ID tokens are never issued for them, as the client can exchange the subject token again
+	*/
+	if exchange != nil {
+		generatedToken.ExpiresIn = uint32(claims.ExpiresAt.Sub(claims.IssuedAt.Time) / time.Second)
+		subjectIsUser = false
+	}
+
+	/*
+		Refresh tokens are only issued for tokens issued on behalf of a user, as clients using client credentials can
+		always request a new token with their secret. The client must also be allowed to use the refresh token grant
+	*/
+	if subjectIsUser && slices.Contains(app.GrantTypes, client.GrantTypeRefreshToken) {
+		if refreshExpiresAt.IsZero() {
+			refreshExpiresAt = serv.Clock().Now().Add(time.Duration(app.RefreshTokenLifetime) * time.Second)
+		}
+
+		err = generatedToken.IssueRefreshToken(refreshExpiresAt, refreshFamily)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	/*
+		ID tokens describe the user that authenticated, so they are only issued alongside tokens issued on behalf of a
+		user, and only when the client asked for one with the openid scope
+	*/
+	if subjectIsUser && requestsOpenID(scope) {
+		binding := idTokenBinding{Nonce: nonce, AccessToken: generatedToken.AccessToken}
+
+		generatedToken.IdToken, err = issueIdToken(serv, app, requestedApi.Audience, claims.Subject, issuer, binding)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, span = tracing.Start(request.Context, "token.store")
 	err = token.NewToken(serv, generatedToken)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
 
-	return generatedToken.Response(), nil
+	telemetry.RecordGrant(serv, request.GrantType)
+
+	serv.PublishEvent(events.TypeTokenIssued, map[string]any{
+		"client_id":     app.ClientId,
+		"sub":           claims.Subject,
+		"audience":      requestedApi.Audience,
+		"grant_type":    request.GrantType,
+		"scope":         scope,
+		"refresh_token": generatedToken.RefreshToken != "",
+		"id_token":      generatedToken.IdToken != "",
+	})
+
+	resp := generatedToken.Response()
+	if exchange != nil {
+		resp.IssuedTokenType = TokenTypeAccessToken
+	}
+
+	return resp, nil
+}
+
+/*
+insertsUserClaims - Returns true if the claims profile or the claim mappings of the ResourceServer insert claims of the
+user the token is issued for, so that the user is only fetched when they do
+*/
+func insertsUserClaims(requestedApi *resourceserver.ResourceServer) bool {
+	return len(claim.ProfileClaims(requestedApi.ClaimsProfile)) != 0 || len(requestedApi.ClaimMappings) != 0
+}
+
+/*
+userClaims - Inserts the claims of the user the token is being issued for, filtered by the claims profile of the
+ResourceServer, along with the custom claims from its claim mappings. The account is nil for tokens that are not issued
+on behalf of a user, which only receive the registered claims, the static values of the claim mappings, and the extra
+claims provided by the grant (act for token exchange, scope, and roles when RBAC is enforced). Returns the claims to
+insert alongside the registered claims
+*/
+func userClaims(serv *server.Server, requestedApi *resourceserver.ResourceServer, account *user.User, extra map[string]any) map[string]any {
+	ret := map[string]any{}
+
+	var accountClaims map[string]any
+	if account != nil && insertsUserClaims(requestedApi) {
+		accountClaims = account.Claims()
+		ret = claim.Filter(requestedApi.ClaimsProfile, accountClaims)
+
+		/*
+			Metadata is added after the claims are filtered by the profile, so that it can only be inserted into tokens
+			by mapping one of its keys explicitly
+		*/
+		accountClaims[claim.SourceUserMetadata] = map[string]any(account.UserMetadata)
+		accountClaims[claim.SourceAppMetadata] = map[string]any(account.AppMetadata)
+	}
+
+	for key, value := range claim.Map(serv.Config.ClaimConfig, requestedApi.ClaimMappings, accountClaims) {
+		ret[key] = value
+	}
+
+	for key, value := range extra {
+		ret[key] = value
+	}
+
+	return ret
+}
+
+/*
+runHooks - Runs the token issuance hooks (see hook.Run) for the token about to be signed, and returns the claims they
+added. The account is the user the token is issued for, or nil if it is not issued on behalf of a user
+*/
+func runHooks(serv *server.Server, app *client.Client, request *request.TokenRequest, audience string, claims jwt.RegisteredClaims, account *user.User, extra map[string]any) (map[string]any, error) {
+	if !hook.Enabled(serv, audience) {
+		return nil, nil
+	}
+
+	input := &hook.Input{Client: app, Request: request, Audience: audience, User: account}
+
+	_, span := tracing.Start(request.Context, "token.hooks")
+	added, err := hook.Run(serv, input, claims, extra)
+	tracing.End(span, err)
+
+	return added, err
+}
+
+/*
+activeAccount - Determines if the user the subject provided in the parameter belongs to can still be issued tokens. If
+their account is locked, then user.ErrUserLocked is returned, and if they were deleted, then the error provided in the
+parameter is returned instead
+*/
+func activeAccount(serv *server.Server, subject string, missing error) error {
+	account, err := user.GetBySubject(serv, subject, false)
+	if err != nil {
+		if errors.Is(err, user.ErrUserDoesNotExist) {
+			return missing
+		}
+
+		return err
+	}
+
+	if account.Locked {
+		return user.ErrUserLocked
+	}
+
+	return nil
 }
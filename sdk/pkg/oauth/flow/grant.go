@@ -0,0 +1,135 @@
+package flow
+
+import (
+	"slices"
+	"sync"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidGrant - A named error that gets returned when an extended grant is registered without an issuer, or under the name of a built-in grant type
+var ErrInvalidGrant = credstackError.NewError(500, "ERR_INVALID_GRANT_REGISTRATION", "token: Extended grants must have an issuer, and cannot replace a built-in grant type")
+
+/*
+GrantResult - The outcome of an extended grant. The token is issued from it exactly like the built-in grants: the scope
+is resolved and validated, RBAC and the policy engine are enforced, and hooks run before it is signed
+*/
+type GrantResult struct {
+	// Claims - The registered claims of the token. These should be created with claim.NewClaimsWithSubject, with the user's identifier as the subject for grants issued on behalf of a user, or the client ID otherwise
+	Claims *jwt.RegisteredClaims
+
+	// SubjectIsUser - If set to true, the token is issued on behalf of the user in the subject claim, so their claims are inserted, and refresh and ID tokens can be issued
+	SubjectIsUser bool
+
+	// Scope - The scopes the token is issued with. If empty, the scope of the token request is used
+	Scope string
+
+	// SessionId - The identifier of the session the token is bound to, if any
+	SessionId string
+}
+
+/*
+Grant - An extended grant type (RFC 6749 section 4.5) that tokens can be issued under, registered with RegisterGrant
+*/
+type Grant struct {
+	// Validate - Validates the token request before the token is issued. The client has already been authorized for the grant type and audience. Optional
+	Validate func(serv *server.Server, app *client.Client, request *request.TokenRequest) error
+
+	// Issue - Authenticates the token request and returns what the token is issued with. Parameters specific to the grant can be read from TokenRequest.Parameters. Errors are returned to the client as they are
+	Issue func(serv *server.Server, app *client.Client, request *request.TokenRequest, issuer string) (*GrantResult, error)
+}
+
+var (
+	// grantMu - Guards grants, as grants can be registered while tokens are being issued
+	grantMu sync.RWMutex
+
+	// grants - The extended grants registered with RegisterGrant, keyed by their grant type
+	grants = map[string]Grant{}
+)
+
+/*
+RegisterGrant - Registers an extended grant that tokens can be issued under with the grant type provided in the
+parameter, so that deployments can add their own flows without modifying IssueTokenForFlow. Extended grant types should
+be absolute URIs (RFC 6749 section 4.5). The grant type also becomes assignable to clients (see
+client.RegisterGrantType), and must still be assigned to a client before it can use it. Registering a grant under a type
+that is already registered replaces it. If the grant has no issuer, or the grant type is a built-in one, then
+ErrInvalidGrant is returned
+*/
+func RegisterGrant(grantType string, grant Grant) error {
+	if grantType == "" || grant.Issue == nil || slices.Contains(client.GrantTypes, grantType) {
+		return ErrInvalidGrant
+	}
+
+	grantMu.Lock()
+	defer grantMu.Unlock()
+
+	grants[grantType] = grant
+	client.RegisterGrantType(grantType)
+
+	return nil
+}
+
+/*
+UnregisterGrant - Removes the extended grant registered under the grant type provided in the parameter. Tokens can no
+longer be issued under it, although clients that were assigned it keep it. Removing a grant that was never registered
+is not an error
+*/
+func UnregisterGrant(grantType string) {
+	grantMu.Lock()
+	defer grantMu.Unlock()
+
+	delete(grants, grantType)
+	client.UnregisterGrantType(grantType)
+}
+
+/*
+IssuableGrantTypes - Returns every grant type that tokens can actually be issued under: the built-in grant types that
+IssueTokenForFlow implements, followed by the extended grants registered with RegisterGrant. The deprecated password
+grant is excluded, as clients can still be created with it but no tokens are ever issued under it
+*/
+func IssuableGrantTypes() []string {
+	return slices.DeleteFunc(client.SupportedGrantTypes(), func(grantType string) bool {
+		return grantType == client.GrantTypePassword
+	})
+}
+
+/*
+extendedGrant - Authorizes the client for the extended grant registered under the grant type of the request, and issues
+its claims. If no grant is registered under it, then ErrInvalidGrantType is returned
+*/
+func extendedGrant(serv *server.Server, app *client.Client, request *request.TokenRequest, issuer string) (*GrantResult, error) {
+	grantMu.RLock()
+	grant, ok := grants[request.GrantType]
+	grantMu.RUnlock()
+
+	if !ok {
+		return nil, ErrInvalidGrantType
+	}
+
+	err := app.ValidateAuthFlow(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if grant.Validate != nil {
+		err = grant.Validate(serv, app, request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := grant.Issue(serv, app, request, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil || result.Claims == nil {
+		return nil, ErrInvalidGrant
+	}
+
+	return result, nil
+}
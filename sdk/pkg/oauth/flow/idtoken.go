@@ -0,0 +1,114 @@
+package flow
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+)
+
+// ScopeOpenID - The scope that must be requested for an ID token to be issued (OpenID Connect Core 1.0 section 3.1.2.1)
+const ScopeOpenID string = "openid"
+
+/*
+requestsOpenID - Determines if the space separated scope string provided in the parameter includes the openid scope
+*/
+func requestsOpenID(scope string) bool {
+	return slices.Contains(strings.Fields(scope), ScopeOpenID)
+}
+
+/*
+idTokenBinding - The values an ID token is bound to. Each of these is optional, and only the claims for the values that
+are set are inserted into the ID token
+*/
+type idTokenBinding struct {
+	// Nonce - The nonce from the authorization request, inserted as the nonce claim
+	Nonce string
+
+	// AccessToken - The access token issued alongside the ID token. Its hash is inserted as the at_hash claim
+	AccessToken string
+
+	// Code - The authorization code issued alongside the ID token (hybrid flow). Its hash is inserted as the c_hash claim
+	Code string
+}
+
+/*
+issueIdToken - Generates an ID token for the user identified by the subject. The audience of an ID token is always the
+client it was issued to, and it carries the user's standard claims along with the claims for the values it is bound to. It is signed with the algorithm the client registered
+(Client.IdTokenSignedResponseAlg): RS256 and ES256 ID tokens are signed with the current key for the algorithm under the
+requested audience, and HS256 ID tokens are signed with the client secret. Clients created before ID tokens were supported
+have no algorithm stored, and receive RS256 ID tokens
+*/
+func issueIdToken(serv *server.Server, app *client.Client, audience string, subject string, issuer string, binding idTokenBinding) (string, error) {
+	account, err := user.GetBySubject(serv, subject, false)
+	if err != nil {
+		return "", err
+	}
+
+	alg := app.IdTokenSignedResponseAlg
+	if alg == "" {
+		alg = client.IdTokenAlgRS256
+	}
+
+	registered := claim.NewClaimsWithSubject(serv.Clock(), issuer, app.ClientId, subject, app.TokenLifetime)
+	claims := claim.WithExtra(registered, claim.Filter(claim.ProfileStandard, account.Claims()))
+
+	/*
+		The hashes are computed with the hash function of the algorithm the ID token is signed with, so the client can
+		verify that the access token and code it received were issued alongside this ID token
+	*/
+	if binding.Nonce != "" {
+		claims.Extra["nonce"] = binding.Nonce
+	}
+
+	if binding.AccessToken != "" {
+		claims.Extra["at_hash"] = claim.HalfHash(alg, binding.AccessToken)
+	}
+
+	if binding.Code != "" {
+		claims.Extra["c_hash"] = claim.HalfHash(alg, binding.Code)
+	}
+
+	var tok *token.Token
+
+	switch alg {
+	case client.IdTokenAlgRS256:
+		privateKey, err := jwk.ActiveKey(serv, alg, audience)
+		if err != nil {
+			return "", err
+		}
+
+		tok, err = token.RS256(serv, privateKey, claims, uint32(app.TokenLifetime))
+		if err != nil {
+			return "", err
+		}
+	case client.IdTokenAlgES256:
+		privateKey, err := jwk.ActiveKey(serv, alg, audience)
+		if err != nil {
+			return "", err
+		}
+
+		tok, err = token.ES256(serv, privateKey, claims, uint32(app.TokenLifetime))
+		if err != nil {
+			return "", err
+		}
+	case client.IdTokenAlgHS256:
+		tok, err = token.HS256(app.SigningKey(), claims, uint32(app.TokenLifetime))
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("%w (%v)", token.ErrFailedToSignToken, "Invalid Signing Algorithm")
+	}
+
+	/*
+		The token functions always return the signed JWT as the access token, regardless of what it is used for
+	*/
+	return tok.AccessToken, nil
+}
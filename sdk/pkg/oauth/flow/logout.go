@@ -0,0 +1,260 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/credstack/credstack/sdk/pkg/audit"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/session"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EventLoggedOut - The audit event recorded when a client ends a user's session through the end session endpoint
+const EventLoggedOut = "user.logged_out"
+
+// EventSignedOut - The audit event recorded when an admin signs a user out of one or all of their sessions
+const EventSignedOut = "user.signed_out"
+
+// ErrInvalidIdTokenHint - Returned when the id_token_hint was not issued by credstack, or was not issued to the client initiating the logout
+var ErrInvalidIdTokenHint = credstackError.NewError(400, "invalid_request", "logout: The id_token_hint is not a valid ID token issued by this server")
+
+// ErrLogoutClientRequired - Returned when a logout request identifies neither the client nor the user
+var ErrLogoutClientRequired = credstackError.NewError(400, "invalid_request", "logout: Either id_token_hint or client_id must be sent")
+
+// ErrPostLogoutRedirectMismatch - Returned when the post_logout_redirect_uri is not registered on the client
+var ErrPostLogoutRedirectMismatch = credstackError.NewError(400, "invalid_request", "logout: The post_logout_redirect_uri is not registered on the client")
+
+/*
+EndSessionResult - The outcome of a logout request
+*/
+type EndSessionResult struct {
+	// ClientId - The client that initiated the logout
+	ClientId string
+
+	// ClientName - The name of the client that initiated the logout, for display
+	ClientName string
+
+	// Subject - The user that was logged out. Empty if the user could not be identified, in which case no session was ended
+	Subject string
+
+	// Revoked - The number of tokens that were revoked
+	Revoked int64
+
+	// Redirect - The URI the user agent should be redirected to, with the state appended. Empty if no
+	// post_logout_redirect_uri was sent, in which case the user should be shown that they have been logged out
+	Redirect string
+}
+
+/*
+EndSession - Processes a logout request initiated by a client (OpenID Connect RP-Initiated Logout 1.0). The client is
+identified by the id_token_hint, or by client_id if no hint was sent, and the two must agree if both are sent.
+
+The hint must be an ID token signed by credstack for the client. Its expiration is not checked, as a client commonly
+logs a user out after their ID token has expired. If no hint was sent, then the user is identified by the session provided
+in the parameter instead. The user is logged out by revoking every token the client holds on their behalf, and by ending
+their sessions so that prompt=none requests no longer succeed.
+
+The post_logout_redirect_uri, if sent, must exactly match one registered on the client. Errors are never redirected,
+as the redirect URI cannot be trusted until it has been validated
+*/
+func EndSession(serv *server.Server, req *request.EndSessionRequest, sessionId string, issuer string) (*EndSessionResult, error) {
+	ret := &EndSessionResult{ClientId: req.ClientId}
+
+	if req.IdTokenHint != "" {
+		clientId, subject, err := verifyIdTokenHint(serv, req.IdTokenHint, req.ClientId, issuer)
+		if err != nil {
+			return nil, err
+		}
+
+		ret.ClientId, ret.Subject = clientId, subject
+	}
+
+	if ret.ClientId == "" {
+		return nil, ErrLogoutClientRequired
+	}
+
+	if ret.Subject == "" {
+		if current, err := session.Get(serv, sessionId); err == nil {
+			ret.Subject = current.Subject
+		}
+	}
+
+	app, err := client.Get(serv, ret.ClientId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.ClientName = app.Name
+
+	if req.PostLogoutRedirectUri != "" {
+		if !app.AllowsPostLogoutRedirect(req.PostLogoutRedirectUri) {
+			return nil, ErrPostLogoutRedirectMismatch
+		}
+
+		redirect, err := url.Parse(req.PostLogoutRedirectUri)
+		if err != nil {
+			return nil, ErrPostLogoutRedirectMismatch
+		}
+
+		if req.State != "" {
+			query := redirect.Query()
+			query.Set("state", req.State)
+			redirect.RawQuery = query.Encode()
+		}
+
+		ret.Redirect = redirect.String()
+	}
+
+	if ret.Subject == "" {
+		return ret, nil
+	}
+
+	ret.Revoked, err = token.RevokeForSubject(serv, ret.Subject, ret.ClientId)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = session.RevokeAll(serv, ret.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	err = audit.Log(serv, EventLoggedOut, ret.ClientId, ret.Subject, "User logged out by client "+ret.ClientId, map[string]string{
+		"client_id": ret.ClientId,
+		"revoked":   strconv.FormatInt(ret.Revoked, 10),
+	})
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to record logout in the audit log", err)
+	}
+
+	return ret, nil
+}
+
+/*
+SignOutResult - The outcome of signing a user out with SignOut
+*/
+type SignOutResult struct {
+	// Sessions - The number of sessions that were ended
+	Sessions int64 `json:"sessions"`
+
+	// Tokens - The number of tokens that were revoked
+	Tokens int64 `json:"tokens"`
+}
+
+/*
+SignOut - Signs the user identified by the subject out of the session identified by the identifier in the session's
+header, and revokes every token that was issued from it, for every client. If the identifier is empty, then the user is
+signed out everywhere: every one of their sessions is ended, and every token issued from any of them is revoked in one
+operation. The actor is the admin performing the sign out, and is recorded in the audit log
+*/
+func SignOut(serv *server.Server, subject string, identifier string, actor string) (*SignOutResult, error) {
+	if subject == "" {
+		return nil, session.ErrSessionMissingSubject
+	}
+
+	ret := &SignOutResult{}
+
+	/*
+		The session is ended before its tokens are revoked, so that no new tokens can be issued from it with prompt=none
+		while they are being revoked
+	*/
+	if identifier != "" {
+		err := session.Revoke(serv, subject, identifier)
+		if err != nil {
+			return nil, err
+		}
+
+		ret.Sessions = 1
+	} else {
+		ended, err := session.RevokeAll(serv, subject)
+		if err != nil {
+			return nil, err
+		}
+
+		ret.Sessions = ended
+	}
+
+	revoked, err := token.RevokeForSession(serv, subject, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.Tokens = revoked
+
+	description := "User signed out everywhere"
+	if identifier != "" {
+		description = "User signed out of session " + identifier
+	}
+
+	err = audit.Log(serv, EventSignedOut, actor, subject, description, map[string]string{
+		"session":  identifier,
+		"sessions": strconv.FormatInt(ret.Sessions, 10),
+		"revoked":  strconv.FormatInt(ret.Tokens, 10),
+	})
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to record sign out in the audit log", err)
+	}
+
+	return ret, nil
+}
+
+/*
+verifyIdTokenHint - Verifies the signature and issuer of an ID token sent as an id_token_hint, and returns the client it
+was issued to and its subject. HS256 ID tokens are verified with the secret of the client in their aud claim, and RS256
+and ES256 ID tokens with the published key named by their kid. If a client ID is provided in the parameter, then the ID
+token must have been issued to it
+*/
+func verifyIdTokenHint(serv *server.Server, hint string, clientId string, issuer string) (string, string, error) {
+	claims := jwt.MapClaims{}
+
+	parsed, err := jwt.ParseWithClaims(
+		hint,
+		claims,
+		func(t *jwt.Token) (any, error) {
+			audience, err := claims.GetAudience()
+			if err != nil || len(audience) != 1 {
+				return nil, errors.New("ID tokens must have a single audience")
+			}
+
+			if t.Method.Alg() == client.IdTokenAlgHS256 {
+				app, err := client.Get(serv, audience[0], true)
+				if err != nil {
+					return nil, err
+				}
+
+				return app.SigningKey(), nil
+			}
+
+			return jwk.Keyfunc(serv)(t)
+		},
+		jwt.WithValidMethods(client.IdTokenAlgs),
+		jwt.WithoutClaimsValidation(),
+	)
+	if err != nil || !parsed.Valid {
+		return "", "", fmt.Errorf("%w (%v)", ErrInvalidIdTokenHint, err)
+	}
+
+	if iss, _ := claims.GetIssuer(); iss != issuer {
+		return "", "", fmt.Errorf("%w (issued by %q)", ErrInvalidIdTokenHint, iss)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return "", "", fmt.Errorf("%w (missing sub)", ErrInvalidIdTokenHint)
+	}
+
+	audience, _ := claims.GetAudience()
+	if clientId != "" && audience[0] != clientId {
+		return "", "", fmt.Errorf("%w (issued to a different client)", ErrInvalidIdTokenHint)
+	}
+
+	return audience[0], subject, nil
+}
@@ -0,0 +1,81 @@
+package flow
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// CodeChallengeMethodS256 - The only code challenge method credstack supports (RFC 7636 section 4.2). The plain method is rejected, as it does not protect a code that is intercepted along with the authorization request
+const CodeChallengeMethodS256 = "S256"
+
+// CodeChallengeMethods - Provides a slice of the code challenge methods that credstack supports
+var CodeChallengeMethods = []string{CodeChallengeMethodS256}
+
+// ErrInvalidCodeVerifier - Returned when the code verifier sent with an authorization code does not match the code challenge of the authorization request, or is sent for a code that was issued without one. Uses the error code defined in RFC 7636 section 4.6
+var ErrInvalidCodeVerifier = credstackError.NewError(400, "invalid_grant", "token: The code verifier does not match the code challenge of the authorization request")
+
+/*
+validateCodeChallenge - Validates the code challenge of an authorization request (RFC 7636 section 4.3). Only the S256
+method is accepted, so a challenge without a method is rejected instead of being treated as plain. An S256 challenge is
+the unpadded base64url encoding of a SHA-256 hash, so it must decode to exactly 32 bytes
+*/
+func validateCodeChallenge(challenge string, method string) error {
+	if challenge == "" {
+		if method != "" {
+			return ErrInvalidAuthorizationRequest
+		}
+
+		return nil
+	}
+
+	if method != CodeChallengeMethodS256 {
+		return ErrInvalidAuthorizationRequest
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(decoded) != sha256.Size {
+		return ErrInvalidAuthorizationRequest
+	}
+
+	return nil
+}
+
+/*
+verifyCodeVerifier - Verifies the code verifier sent with an authorization code against the code challenge the code was
+issued with (RFC 7636 section 4.6). If the code was issued without a challenge, then a verifier must not be sent, so that
+a client cannot be downgraded into redeeming a code that was never bound to one. The verifier must be between 43 and 128
+characters of the unreserved set (RFC 7636 section 4.1)
+*/
+func verifyCodeVerifier(challenge string, verifier string) error {
+	if challenge == "" {
+		if verifier != "" {
+			return ErrInvalidCodeVerifier
+		}
+
+		return nil
+	}
+
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return ErrInvalidCodeVerifier
+	}
+
+	for _, char := range verifier {
+		isUnreserved := (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9') ||
+			char == '-' || char == '.' || char == '_' || char == '~'
+		if !isUnreserved {
+			return ErrInvalidCodeVerifier
+		}
+	}
+
+	hashed := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(hashed[:])
+
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) != 1 {
+		return ErrInvalidCodeVerifier
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package flow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// rfcVerifier and rfcChallenge - The code verifier and S256 code challenge from RFC 7636 appendix B
+const (
+	rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestValidateCodeChallenge(t *testing.T) {
+	cases := []struct {
+		name      string
+		challenge string
+		method    string
+		valid     bool
+	}{
+		{name: "s256", challenge: rfcChallenge, method: CodeChallengeMethodS256, valid: true},
+		{name: "absent", valid: true},
+		{name: "plain", challenge: rfcVerifier, method: "plain"},
+		{name: "missing method", challenge: rfcChallenge},
+		{name: "method without challenge", method: CodeChallengeMethodS256},
+		{name: "not a hash", challenge: "abc", method: CodeChallengeMethodS256},
+		{name: "padded", challenge: rfcChallenge + "=", method: CodeChallengeMethodS256},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateCodeChallenge(tc.challenge, tc.method)
+			if tc.valid && err != nil {
+				t.Fatalf("validateCodeChallenge: %v", err)
+			}
+
+			if !tc.valid && !errors.Is(err, ErrInvalidAuthorizationRequest) {
+				t.Fatalf("validateCodeChallenge: expected ErrInvalidAuthorizationRequest, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	cases := []struct {
+		name      string
+		challenge string
+		verifier  string
+		valid     bool
+	}{
+		{name: "matches", challenge: rfcChallenge, verifier: rfcVerifier, valid: true},
+		{name: "no challenge", valid: true},
+		{name: "missing verifier", challenge: rfcChallenge},
+		{name: "wrong verifier", challenge: rfcChallenge, verifier: strings.Repeat("a", 43)},
+		{name: "too short", challenge: rfcChallenge, verifier: rfcVerifier[:42]},
+		{name: "too long", challenge: rfcChallenge, verifier: strings.Repeat("a", 129)},
+		{name: "reserved characters", challenge: rfcChallenge, verifier: rfcVerifier[:42] + "/"},
+		{name: "verifier without challenge", verifier: rfcVerifier},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyCodeVerifier(tc.challenge, tc.verifier)
+			if tc.valid && err != nil {
+				t.Fatalf("verifyCodeVerifier: %v", err)
+			}
+
+			if !tc.valid && !errors.Is(err, ErrInvalidCodeVerifier) {
+				t.Fatalf("verifyCodeVerifier: expected ErrInvalidCodeVerifier, got %v", err)
+			}
+		})
+	}
+}
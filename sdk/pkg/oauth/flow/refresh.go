@@ -0,0 +1,112 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrInvalidRefreshToken - Returned when a refresh token does not exist, has expired, has been revoked, has already been redeemed, or was issued to a different client or audience
+var ErrInvalidRefreshToken = credstackError.NewError(400, "ERR_INVALID_REFRESH_TOKEN", "token: The refresh token is invalid or has expired")
+
+/*
+refreshTokenGrant - Exchanges a refresh token for new claims with the same subject and audience. The refresh token is
+rotated: it is atomically marked as consumed so that it can only be redeemed once, and a new refresh token in the same
+family is issued with the new access token. The redeemed token is returned so that the new refresh token inherits its
+expiration, family, and scope, which bounds how long a grant can be kept alive by rotating it.
+
+If a consumed refresh token is presented again, then either the legitimate client or an attacker holds a stolen copy,
+and there is no way to tell which. The entire family is revoked so that neither can continue using it, and a security
+event is logged.
+
+The user the refresh token was issued for must still be able to log in: if their account was locked, then
+user.ErrUserLocked is returned, and if they were deleted, then ErrInvalidRefreshToken is returned. Public clients are not required to send a client secret, however confidential clients are
+*/
+func refreshTokenGrant(serv *server.Server, app *client.Client, req *request.TokenRequest, issuer string) (*jwt.RegisteredClaims, *token.Token, error) {
+	if req.RefreshToken == "" {
+		return nil, nil, ErrInvalidTokenRequest
+	}
+
+	result := serv.Database().Collection("token").FindOneAndUpdate(
+		serv.Context(),
+		bson.M{
+			"refresh_token":      req.RefreshToken,
+			"client_id":          app.ClientId,
+			"audience":           req.Audience,
+			"refresh_consumed":   bson.M{"$ne": true},
+			"revoked":            bson.M{"$ne": true},
+			"refresh_expires_at": bson.M{"$gt": serv.Clock().Now()},
+		},
+		bson.M{"$set": bson.M{"refresh_consumed": true}},
+	)
+
+	var previous token.Token
+
+	err := result.Decode(&previous)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil, detectRefreshReuse(serv, app, req.RefreshToken)
+		}
+
+		return nil, nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	err = activeAccount(serv, previous.Subject, ErrInvalidRefreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims := claim.NewClaimsWithSubject(
+		serv.Clock(),
+		issuer,
+		previous.Audience,
+		previous.Subject,
+		app.TokenLifetime,
+	)
+
+	return &claims, &previous, nil
+}
+
+/*
+detectRefreshReuse - Determines why a refresh token could not be redeemed. If it was already consumed, then its family
+is revoked and a security event is logged. ErrInvalidRefreshToken is always returned, so that the caller cannot tell if
+reuse was detected
+*/
+func detectRefreshReuse(serv *server.Server, app *client.Client, refreshToken string) error {
+	var consumed token.Token
+
+	err := serv.Database().Collection("token").FindOne(
+		serv.Context(),
+		bson.M{"refresh_token": refreshToken, "client_id": app.ClientId, "refresh_consumed": true},
+	).Decode(&consumed)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrInvalidRefreshToken
+		}
+
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	revoked, err := token.RevokeFamily(serv, consumed.Family)
+	if err != nil {
+		return err
+	}
+
+	serv.Log().LogSecurityEvent(
+		"RefreshTokenReuse",
+		consumed.Subject,
+		app.ClientId,
+		fmt.Sprintf("A consumed refresh token was presented again. Revoked %d tokens in family %s", revoked, consumed.Family),
+	)
+
+	return ErrInvalidRefreshToken
+}
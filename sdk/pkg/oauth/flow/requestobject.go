@@ -0,0 +1,153 @@
+package flow
+
+import (
+	"fmt"
+	"slices"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/*
+The short codes of the request object errors below are the error codes defined in RFC 9101 section 6.3, as they are
+returned to the client's redirect URI where clients expect the standard codes
+*/
+
+// ErrInvalidRequestObject - Returned when the request object cannot be decoded, is not signed by one of the client's keys, or has invalid claims
+var ErrInvalidRequestObject = credstackError.NewError(400, "invalid_request_object", "authorize: The request object is invalid")
+
+// ErrRequestObjectRequired - Returned when a client that requires signed request objects sends an authorization request without one
+var ErrRequestObjectRequired = credstackError.NewError(400, "invalid_request", "authorize: The client requires authorization requests to be sent as a signed request object")
+
+// ErrRequestURINotSupported - Returned when an authorization request passes its request object by reference, which credstack does not support
+var ErrRequestURINotSupported = credstackError.NewError(400, "request_uri_not_supported", "authorize: Request objects cannot be passed by reference. Use the request parameter instead")
+
+/*
+requestObjectClaims - The authorization request parameters that can be sent in a request object, along with the
+registered claims that are validated
+*/
+type requestObjectClaims struct {
+	jwt.RegisteredClaims
+
+	// ResponseType - Overrides the response_type parameter
+	ResponseType string `json:"response_type"`
+
+	// ClientId - Must match the client_id parameter if it is present
+	ClientId string `json:"client_id"`
+
+	// RedirectUri - Overrides the redirect_uri parameter
+	RedirectUri string `json:"redirect_uri"`
+
+	// Audience - Overrides the audience parameter. This is the API the access token is requested for, and is unrelated to the aud claim
+	Audience string `json:"audience"`
+
+	// Scope - Overrides the scope parameter
+	Scope string `json:"scope"`
+
+	// State - Overrides the state parameter
+	State string `json:"state"`
+
+	// Nonce - Overrides the nonce parameter
+	Nonce string `json:"nonce"`
+
+	// CodeChallenge - Overrides the code_challenge parameter
+	CodeChallenge string `json:"code_challenge"`
+
+	// CodeChallengeMethod - Overrides the code_challenge_method parameter
+	CodeChallengeMethod string `json:"code_challenge_method"`
+
+	// Prompt - Overrides the prompt parameter
+	Prompt string `json:"prompt"`
+
+	// ResponseMode - Overrides the response_mode parameter
+	ResponseMode string `json:"response_mode"`
+}
+
+/*
+resolveRequestObject - Verifies the request object sent in the request parameter of an authorization request (RFC 9101)
+and applies its parameters to the request. The request object must be signed with one of the keys registered on the
+client, must have been issued by the client (iss), must be intended for credstack (aud, if present), and must not be
+expired.
+
+If the client requires signed request objects, then only the parameters in the request object are used and the query
+parameters are discarded, as RFC 9101 section 5 requires. Otherwise, the parameters in the request object override the
+query parameters, and query parameters that are not in the request object are kept (OpenID Connect Core 1.0 section
+6.3.3). The client_id parameter is the exception: it is required outside of the request object so that the client
+can be found, and must match the request object if it is included in it
+*/
+func resolveRequestObject(serv *server.Server, app *client.Client, req *request.AuthorizationRequest, issuer string) error {
+	if req.RequestUri != "" {
+		return ErrRequestURINotSupported
+	}
+
+	if req.Request == "" {
+		if app.RequireSignedRequestObject {
+			return ErrRequestObjectRequired
+		}
+
+		return nil
+	}
+
+	claims := new(requestObjectClaims)
+
+	_, err := jwt.ParseWithClaims(
+		req.Request,
+		claims,
+		func(token *jwt.Token) (any, error) {
+			kid, _ := token.Header["kid"].(string)
+			return app.RequestObjectKey(kid, token.Method.Alg())
+		},
+		jwt.WithValidMethods(client.RequestObjectAlgs),
+		jwt.WithIssuer(app.ClientId),
+		jwt.WithTimeFunc(serv.Clock().Now),
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrInvalidRequestObject, err)
+	}
+
+	/*
+		The aud claim is optional, but if the client includes it, then it must identify credstack, so that a request
+		object intended for another authorization server cannot be replayed here
+	*/
+	aud := claims.RegisteredClaims.Audience
+	if len(aud) != 0 && !slices.Contains(aud, issuer) {
+		return fmt.Errorf("%w (the aud claim does not identify this issuer)", ErrInvalidRequestObject)
+	}
+
+	if claims.ClientId != "" && claims.ClientId != req.ClientId {
+		return fmt.Errorf("%w (the client_id claim does not match the client_id parameter)", ErrInvalidRequestObject)
+	}
+
+	resolved := request.AuthorizationRequest{
+		ClientId: req.ClientId,
+		Request:  req.Request,
+	}
+
+	if !app.RequireSignedRequestObject {
+		resolved = *req
+	}
+
+	override := func(target *string, value string) {
+		if value != "" {
+			*target = value
+		}
+	}
+
+	override(&resolved.ResponseType, claims.ResponseType)
+	override(&resolved.RedirectUri, claims.RedirectUri)
+	override(&resolved.Audience, claims.Audience)
+	override(&resolved.Scope, claims.Scope)
+	override(&resolved.State, claims.State)
+	override(&resolved.Nonce, claims.Nonce)
+	override(&resolved.CodeChallenge, claims.CodeChallenge)
+	override(&resolved.CodeChallengeMethod, claims.CodeChallengeMethod)
+	override(&resolved.Prompt, claims.Prompt)
+	override(&resolved.ResponseMode, claims.ResponseMode)
+
+	*req = resolved
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package flow
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/session"
+)
+
+const (
+	// PromptNone - The authorization request must complete without displaying any page (OpenID Connect Core 1.0 section 3.1.2.1)
+	PromptNone string = "none"
+
+	// PromptLogin - The user must log in again, even if they are already signed in
+	PromptLogin string = "login"
+
+	// PromptConsent - The user must be asked to authorize the client again
+	PromptConsent string = "consent"
+)
+
+// Prompts - Provides a slice of the prompt values that credstack supports
+var Prompts = []string{PromptNone, PromptLogin, PromptConsent}
+
+const (
+	// ResponseModeQuery - The authorization response is returned in the query string of the redirect URI
+	ResponseModeQuery string = "query"
+
+	// ResponseModeFragment - The authorization response is returned in the fragment of the redirect URI
+	ResponseModeFragment string = "fragment"
+
+	// ResponseModeWebMessage - The authorization response is posted to the window that opened the authorization
+	// endpoint (a parent frame or opener) with window.postMessage, for single page applications using a hidden iframe
+	ResponseModeWebMessage string = "web_message"
+)
+
+// ResponseModes - Provides a slice of the response modes that credstack supports
+var ResponseModes = []string{ResponseModeQuery, ResponseModeFragment, ResponseModeWebMessage}
+
+/*
+The short codes of the errors below are the error codes defined in OpenID Connect Core 1.0 section 3.1.2.6, as they are
+returned to the client's redirect URI where clients expect the standard codes
+*/
+
+// ErrLoginRequired - Returned when a prompt=none request is made while the user is not signed in
+var ErrLoginRequired = credstackError.NewError(401, "login_required", "authorize: The user must log in")
+
+// ErrConsentRequired - Returned when a prompt=none request is made for a client the user has not authorized while signed in
+var ErrConsentRequired = credstackError.NewError(403, "consent_required", "authorize: The user must authorize the client")
+
+/*
+validatePrompt - Ensures that every prompt value is supported, and that none is not combined with any other value, as
+OpenID Connect Core 1.0 section 3.1.2.1 requires
+*/
+func validatePrompt(prompt string) error {
+	values := strings.Fields(prompt)
+
+	for _, value := range values {
+		if !slices.Contains(Prompts, value) {
+			return ErrInvalidAuthorizationRequest
+		}
+	}
+
+	if slices.Contains(values, PromptNone) && len(values) > 1 {
+		return ErrInvalidAuthorizationRequest
+	}
+
+	return nil
+}
+
+/*
+validateResponseMode - Ensures that the response mode is supported for the response type. The query mode cannot be used
+with response types that include an ID token, as it would expose the ID token in server logs
+*/
+func validateResponseMode(responseMode string, responseType string) error {
+	if responseMode == "" {
+		return nil
+	}
+
+	if !slices.Contains(ResponseModes, responseMode) {
+		return ErrInvalidAuthorizationRequest
+	}
+
+	if responseMode == ResponseModeQuery && slices.Contains(strings.Fields(responseType), client.ResponseTypeIdToken) {
+		return ErrInvalidAuthorizationRequest
+	}
+
+	return nil
+}
+
+/*
+HasPrompt - Determines if the authorization request includes the prompt value provided in the parameter
+*/
+func HasPrompt(req *request.AuthorizationRequest, prompt string) bool {
+	return slices.Contains(strings.Fields(req.Prompt), prompt)
+}
+
+/*
+SilentAuthorize - Completes a prompt=none authorization request that was validated with ValidateAuthorizationRequest
+against the session identified by the session ID provided in the parameter, without displaying any page. If the
+user is not signed in, then ErrLoginRequired is returned, and if they have not authorized the client during the session,
+then ErrConsentRequired is returned. If their account was locked since they signed in, then user.ErrUserLocked is
+returned, and if it was deleted, then ErrLoginRequired is returned. These are returned to the client's redirect URI, so
+that a single page application renewing its tokens in a hidden iframe can fall back to a full redirect
+*/
+func SilentAuthorize(serv *server.Server, app *client.Client, req *request.AuthorizationRequest, sessionId string, issuer string) (*response.AuthorizationResponse, error) {
+	current, err := session.Get(serv, sessionId)
+	if err != nil {
+		if errors.Is(err, session.ErrSessionDoesNotExist) {
+			return nil, ErrLoginRequired
+		}
+
+		return nil, err
+	}
+
+	if !slices.Contains(current.Clients, app.ClientId) {
+		return nil, ErrConsentRequired
+	}
+
+	err = activeAccount(serv, current.Subject, ErrLoginRequired)
+	if err != nil {
+		return nil, err
+	}
+
+	return Authorize(serv, app, req, current.Subject, current.Header.Identifier, issuer)
+}
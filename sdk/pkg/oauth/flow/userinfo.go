@@ -0,0 +1,84 @@
+package flow
+
+import (
+	"errors"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+)
+
+// ErrInsufficientScope - Returned when the userinfo endpoint is called with an access token that was not issued with the openid scope. Uses the error code defined in RFC 6750 section 3.1
+var ErrInsufficientScope = credstackError.NewError(403, "insufficient_scope", "userinfo: The access token was not issued with the openid scope")
+
+/*
+UserInfo - Returns the claims of the user the bearer access token provided in the parameter was issued for (OpenID
+Connect Core 1.0 section 5.3). The access token must be active and must have been issued with the openid scope. The
+sub claim is always returned, and the remaining claims are filtered by the scopes the token was issued with (profile,
+email, address, phone).
+
+Tokens issued with client credentials are not issued on behalf of a user, so their subject does not resolve to a user
+and ErrInvalidAccessToken is returned for them
+*/
+func UserInfo(serv *server.Server, accessToken string) (map[string]any, error) {
+	issued, err := token.Lookup(serv, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if !requestsOpenID(issued.Scope) {
+		return nil, ErrInsufficientScope
+	}
+
+	account, err := user.GetBySubject(serv, issued.Subject, false)
+	if err != nil {
+		if errors.Is(err, user.ErrUserDoesNotExist) {
+			return nil, token.ErrInvalidAccessToken
+		}
+
+		return nil, err
+	}
+
+	claims := claim.FilterByScope(issued.Scope, account.Claims())
+	claims["sub"] = issued.Subject
+
+	return claims, nil
+}
+
+/*
+UpdateUserMetadata - Merges the patch provided in the parameter into the user metadata of the user the bearer access token
+was issued for, so that users can edit their own metadata (see user.UpdateUserMetadata). The access token is checked
+exactly like UserInfo. App metadata can never be edited this way. The merged metadata is returned
+*/
+func UpdateUserMetadata(serv *server.Server, accessToken string, patch map[string]any) (user.Metadata, error) {
+	issued, err := token.Lookup(serv, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if !requestsOpenID(issued.Scope) {
+		return nil, ErrInsufficientScope
+	}
+
+	account, err := user.GetBySubject(serv, issued.Subject, false)
+	if err != nil {
+		if errors.Is(err, user.ErrUserDoesNotExist) {
+			return nil, token.ErrInvalidAccessToken
+		}
+
+		return nil, err
+	}
+
+	ret, err := user.UpdateUserMetadataByIdentifier(serv, account.Header.Identifier, patch)
+	if err != nil {
+		if errors.Is(err, user.ErrUserDoesNotExist) {
+			return nil, token.ErrInvalidAccessToken
+		}
+
+		return nil, err
+	}
+
+	return ret, nil
+}
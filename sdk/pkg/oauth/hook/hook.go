@@ -0,0 +1,231 @@
+package hook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/client"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/*
+ErrIssuanceDenied - Returned when a hook denies a token from being issued. Uses the error code defined in RFC 6749
+section 5.2 for a grant that is no longer valid, as the client cannot fix the request itself
+*/
+var ErrIssuanceDenied = credstackError.NewError(403, "access_denied", "token: Token issuance was denied by a hook")
+
+// ErrHookUnavailable - Returned when a webhook cannot be reached and HookWebhookConfig.FailOpen is not set
+var ErrHookUnavailable = credstackError.NewError(503, "temporarily_unavailable", "token: A token issuance hook could not be reached")
+
+// ErrInvalidHookClaim - Returned when a hook adds a claim that shadows a registered claim, or that is not namespaced
+var ErrInvalidHookClaim = credstackError.NewError(500, "server_error", "token: A token issuance hook added a claim that cannot be inserted into tokens")
+
+/*
+Input - Describes the token that is about to be signed. Hooks must treat every field as read only, and add claims by
+returning them instead
+*/
+type Input struct {
+	// Claims - The claims the token is signed with, including the claims added by the hooks that ran before this one
+	Claims map[string]any
+
+	// Client - The client the token is being issued to
+	Client *client.Client
+
+	// User - The user the token is being issued on behalf of. Nil for tokens issued with client credentials
+	User *user.User
+
+	// Request - The token request the token is being issued for
+	Request *request.TokenRequest
+
+	// Audience - The audience of the resource server the token is being issued for
+	Audience string
+}
+
+/*
+Hook - A function that runs before a token is signed. The claims it returns are inserted into the token, and must pass
+claim.ValidateCustom. Returning an error denies the token request: errors that are already a CredstackError are returned
+to the client as they are, and any other error is wrapped in ErrIssuanceDenied with its message as the reason
+*/
+type Hook func(serv *server.Server, input *Input) (map[string]any, error)
+
+/*
+registered - A hook registered with Register, kept with its name so that it can be replaced
+*/
+type registered struct {
+	name string
+	hook Hook
+}
+
+var (
+	// mu - Guards hooks, as hooks can be registered while tokens are being issued
+	mu sync.RWMutex
+
+	// hooks - The hooks registered with Register, in the order they were registered
+	hooks []registered
+)
+
+/*
+Register - Registers a hook that runs before every token is signed, under the name provided in the parameter. Hooks run
+in the order they were registered, before any webhook defined in HookConfig. Registering a hook under a name that is
+already in use replaces the existing hook, keeping its position
+*/
+func Register(name string, hook Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := range hooks {
+		if hooks[i].name == name {
+			hooks[i].hook = hook
+			return
+		}
+	}
+
+	hooks = append(hooks, registered{name: name, hook: hook})
+}
+
+/*
+Unregister - Removes the hook registered under the name provided in the parameter. Removing a hook that was never
+registered is not an error
+*/
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := range hooks {
+		if hooks[i].name == name {
+			hooks = append(hooks[:i], hooks[i+1:]...)
+			return
+		}
+	}
+}
+
+/*
+Enabled - Determines if any hook or webhook would run for a token issued for the audience provided in the parameter. This
+lets callers skip gathering the input (like fetching the user) when no hook would read it
+*/
+func Enabled(serv *server.Server, audience string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if len(hooks) != 0 {
+		return true
+	}
+
+	for _, webhook := range serv.Config.HookConfig.Webhooks {
+		if appliesTo(webhook.Audiences, audience) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Run - Runs every registered hook, followed by every webhook for the audience, against the token described by the
+registered and extra claims provided in the parameter. Returns the claims the hooks added, which should be merged into the
+extra claims of the token. Each hook sees the claims added by the hooks before it, and a later hook replaces a claim that
+an earlier one added. If any hook denies the token, then no further hooks run and the error is returned
+*/
+func Run(serv *server.Server, input *Input, registeredClaims jwt.RegisteredClaims, extra map[string]any) (map[string]any, error) {
+	if !Enabled(serv, input.Audience) {
+		return nil, nil
+	}
+
+	claims, err := flatten(registeredClaims, extra)
+	if err != nil {
+		return nil, err
+	}
+
+	input.Claims = claims
+	added := map[string]any{}
+
+	apply := func(name string, result map[string]any) error {
+		for key, value := range result {
+			err := claim.ValidateCustom(serv.Config.ClaimConfig, key)
+			if err != nil {
+				return fmt.Errorf("%w (%s: %v)", ErrInvalidHookClaim, name, err)
+			}
+
+			added[key] = value
+			input.Claims[key] = value
+		}
+
+		return nil
+	}
+
+	mu.RLock()
+	current := make([]registered, len(hooks))
+	copy(current, hooks)
+	mu.RUnlock()
+
+	for _, h := range current {
+		result, err := h.hook(serv, input)
+		if err != nil {
+			var credstackErr credstackError.CredstackError
+			if errors.As(err, &credstackErr) {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("%w (%s: %v)", ErrIssuanceDenied, h.name, err)
+		}
+
+		err = apply(h.name, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, webhook := range serv.Config.HookConfig.Webhooks {
+		if !appliesTo(webhook.Audiences, input.Audience) {
+			continue
+		}
+
+		result, err := callWebhook(serv, webhook, input)
+		if err != nil {
+			return nil, err
+		}
+
+		err = apply(webhook.Name, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return added, nil
+}
+
+/*
+flatten - Merges the registered and extra claims into a single map, the same as they are serialized into the token
+*/
+func flatten(registeredClaims jwt.RegisteredClaims, extra map[string]any) (map[string]any, error) {
+	encoded, err := json.Marshal(claim.WithExtra(registeredClaims, maps.Clone(extra)))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]any{}
+
+	err = json.Unmarshal(encoded, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+/*
+appliesTo - Determines if a webhook restricted to the audiences provided in the parameter is called for a token issued for
+the audience. Webhooks with no audiences are called for every token
+*/
+func appliesTo(audiences []string, audience string) bool {
+	return len(audiences) == 0 || slices.Contains(audiences, audience)
+}
@@ -0,0 +1,170 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+webhookClient - Describes the client the token is being issued to. The client secret is never sent to a webhook
+*/
+type webhookClient struct {
+	// ClientId - The client ID of the client
+	ClientId string `json:"client_id"`
+
+	// Name - The name of the client
+	Name string `json:"name"`
+
+	// IsPublic - If set to true, the client cannot keep a secret (single page and native applications)
+	IsPublic bool `json:"is_public"`
+}
+
+/*
+webhookRequest - Describes the token request the token is being issued for
+*/
+type webhookRequest struct {
+	// GrantType - The grant type the token is being requested with
+	GrantType string `json:"grant_type"`
+
+	// Audience - The audience of the resource server the token is being issued for
+	Audience string `json:"audience"`
+
+	// Scope - The scopes that were requested
+	Scope string `json:"scope,omitempty"`
+
+	// RemoteAddr - The IP address the request originated from
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+/*
+webhookPayload - The document sent to a webhook. The user is described by their OpenID Connect claims, so that their
+credential is never sent
+*/
+type webhookPayload struct {
+	Claims  map[string]any `json:"claims"`
+	Client  webhookClient  `json:"client"`
+	User    map[string]any `json:"user,omitempty"`
+	Request webhookRequest `json:"request"`
+}
+
+/*
+webhookResponse - The response a webhook returns. Allow must be set to true for the token to be issued, so that a webhook
+that responds with an empty document denies the token instead of allowing it. Reason explains a denial, and Claims are
+inserted into the token
+*/
+type webhookResponse struct {
+	Allow  bool           `json:"allow"`
+	Reason string         `json:"reason"`
+	Claims map[string]any `json:"claims"`
+}
+
+/*
+callWebhook - Sends the input to the webhook provided in the parameter, and returns the claims it added. If the webhook
+denies the token, then ErrIssuanceDenied is returned wrapped with the reason it gave. If the webhook cannot be reached or
+responds with anything other than 200, then ErrHookUnavailable is returned, unless HookWebhookConfig.FailOpen is set, in
+which case the token is issued without its claims
+*/
+func callWebhook(serv *server.Server, webhook config.HookWebhookConfig, input *Input) (map[string]any, error) {
+	ret, err := post(webhook, input)
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to call token issuance webhook "+webhook.Name, err)
+
+		if webhook.FailOpen {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%w (%s: %v)", ErrHookUnavailable, webhook.Name, err)
+	}
+
+	if !ret.Allow {
+		if ret.Reason != "" {
+			return nil, fmt.Errorf("%w (%s: %s)", ErrIssuanceDenied, webhook.Name, ret.Reason)
+		}
+
+		return nil, fmt.Errorf("%w (%s)", ErrIssuanceDenied, webhook.Name)
+	}
+
+	return ret.Claims, nil
+}
+
+/*
+post - Sends the input to the webhook with a POST request and decodes its response
+*/
+func post(webhook config.HookWebhookConfig, input *Input) (_ *webhookResponse, err error) {
+	payload := webhookPayload{
+		Claims: input.Claims,
+		Client: webhookClient{ClientId: input.Client.ClientId, Name: input.Client.Name, IsPublic: input.Client.IsPublic},
+		Request: webhookRequest{
+			GrantType:  input.Request.GrantType,
+			Audience:   input.Audience,
+			Scope:      input.Request.Scope,
+			RemoteAddr: input.Request.RemoteAddr,
+		},
+	}
+
+	if input.User != nil {
+		payload.User = input.User.Claims()
+	}
+
+	encoded, err := json.Marshal(&payload)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := webhook.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	/*
+		The webhook is called as part of the trace of the token request, and the trace is propagated to it, so that the
+		time spent in the webhook shows up in the trace of the request
+	*/
+	ctx, span := tracing.StartKind(input.Request.Context, "hook "+webhook.Name, trace.SpanKindClient)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	req.Header.Set("Content-Type", "application/json")
+	if webhook.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+webhook.BearerToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	var ret webhookResponse
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
@@ -0,0 +1,188 @@
+package jwk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+/*
+activeKeyId - Identifies the current key of an algorithm and audience in the activeKeyCache. The database is part of the
+identifier, so that servers with different databases in the same process never share keys, while every server scoped
+to a request with Server.WithContext shares the keys of the server it was scoped from
+*/
+type activeKeyId struct {
+	database *server.Database
+	alg      string
+	audience string
+}
+
+/*
+newActiveKeyId - Returns the identifier of the current key of an algorithm and audience on the server provided in the
+parameter
+*/
+func newActiveKeyId(serv *server.Server, alg string, audience string) activeKeyId {
+	return activeKeyId{database: serv.Database(), alg: alg, audience: audience}
+}
+
+/*
+cachedActiveKey - A current key held in the activeKeyCache, along with when it has to be looked up again
+*/
+type cachedActiveKey struct {
+	// key - The current key. Its Signer is built before it is cached, so that it is never parsed again while cached
+	key *PrivateJSONWebKey
+
+	// expiresAt - When the key has to be looked up again, so that rotations on other replicas are picked up
+	expiresAt time.Time
+}
+
+/*
+activeKeyCache - Caches the current key of every algorithm and audience in memory, so that signing a token does not need
+a database round trip, or to parse and validate the key material, every time. Keys are invalidated on this replica as
+soon as they are rotated out, and expire after KeyConfig.CacheTTL so that rotations on other replicas are picked up.
+Expired keys are removed as soon as they are found, so the cache never holds more than one key per algorithm and
+audience.
+
+Every invalidation increments the generation of the key, so that a lookup that started before a rotation cannot cache the
+key that was rotated out once it completes
+*/
+type activeKeyCache struct {
+	// mu - Protects keys and generations
+	mu sync.RWMutex
+
+	// keys - The cached current keys
+	keys map[activeKeyId]cachedActiveKey
+
+	// generations - How many times the current key of an algorithm and audience was invalidated
+	generations map[activeKeyId]uint64
+}
+
+// activeKeys - The cache of current keys used by ActiveKey
+var activeKeys = newActiveKeyCache()
+
+/*
+newActiveKeyCache - Constructs an empty activeKeyCache
+*/
+func newActiveKeyCache() *activeKeyCache {
+	return &activeKeyCache{
+		keys:        make(map[activeKeyId]cachedActiveKey),
+		generations: make(map[activeKeyId]uint64),
+	}
+}
+
+/*
+load - Returns the current key of the algorithm and audience from the cache, or looks it up with the lookup function
+provided in the parameter and caches it if it is not cached or has expired
+*/
+func (cache *activeKeyCache) load(serv *server.Server, alg string, audience string, lookup func(serv *server.Server, alg string, audience string) (*PrivateJSONWebKey, error)) (*PrivateJSONWebKey, error) {
+	cached := cache.get(serv, alg, audience)
+	if cached != nil {
+		return cached, nil
+	}
+
+	generation := cache.generation(serv, alg, audience)
+
+	key, err := lookup(serv, alg, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.put(serv, key, generation)
+
+	return key, nil
+}
+
+/*
+get - Returns a copy of the cached current key, or nil if it is not cached or has expired. Expired keys are removed from
+the cache. A copy is returned so that callers cannot modify the cached key
+*/
+func (cache *activeKeyCache) get(serv *server.Server, alg string, audience string) *PrivateJSONWebKey {
+	id := newActiveKeyId(serv, alg, audience)
+
+	cache.mu.RLock()
+	cached, ok := cache.keys[id]
+	cache.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	if !serv.Clock().Now().Before(cached.expiresAt) {
+		cache.mu.Lock()
+		if current, ok := cache.keys[id]; ok && current.expiresAt.Equal(cached.expiresAt) {
+			delete(cache.keys, id)
+		}
+		cache.mu.Unlock()
+
+		return nil
+	}
+
+	key := *cached.key
+
+	return &key
+}
+
+/*
+generation - Returns the current generation of the key of an algorithm and audience. This must be read before the key is
+looked up in the database, and passed to put
+*/
+func (cache *activeKeyCache) generation(serv *server.Server, alg string, audience string) uint64 {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	return cache.generations[newActiveKeyId(serv, alg, audience)]
+}
+
+/*
+put - Caches the current key that was looked up in the database, and removes any other keys that have expired. The key
+is not cached if it was invalidated since the generation provided in the parameter was read, if its Signer cannot be
+built, or if the cache is disabled
+*/
+func (cache *activeKeyCache) put(serv *server.Server, key *PrivateJSONWebKey, generation uint64) {
+	ttl := serv.Config.KeyConfig.CacheTTL
+	if ttl <= 0 {
+		return
+	}
+
+	cached := *key
+
+	signer, err := key.Signer(serv)
+	if err != nil {
+		return
+	}
+
+	cached.signer = signer
+
+	id := newActiveKeyId(serv, key.Alg, key.Audience)
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.generations[id] != generation {
+		return
+	}
+
+	now := serv.Clock().Now()
+	for other, entry := range cache.keys {
+		if !now.Before(entry.expiresAt) {
+			delete(cache.keys, other)
+		}
+	}
+
+	cache.keys[id] = cachedActiveKey{key: &cached, expiresAt: now.Add(ttl)}
+}
+
+/*
+invalidate - Removes the cached current key of an algorithm and audience. This must be called once the current key has
+been replaced in the database
+*/
+func (cache *activeKeyCache) invalidate(serv *server.Server, alg string, audience string) {
+	id := newActiveKeyId(serv, alg, audience)
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	delete(cache.keys, id)
+	cache.generations[id]++
+}
@@ -0,0 +1,135 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+)
+
+// ECKeySize - The size in bits of the P-256 curve used for ES256 keys
+const ECKeySize int = 256
+
+/*
+ECDSA - Converts a private JSON Web Key into an ecdsa.PrivateKey struct so that it can be used with the crypto/ecdsa
+package. If the key is not an ECDSA key, then ErrKeyIsNotValid is returned
+*/
+func (key *PrivateJSONWebKey) ECDSA() (*ecdsa.PrivateKey, error) {
+	keyBytes := []byte(key.KeyMaterial)
+	decoded, err := secret.DecodeBase64(keyBytes, uint32(len(keyBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", secret.ErrFailedToBaseDecode, err)
+	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrMarshalKey, err)
+	}
+
+	privateKey, ok := parsedKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w (%v)", ErrKeyIsNotValid, "key is not an ECDSA key")
+	}
+
+	return privateKey, nil
+}
+
+/*
+NewPrivateKeyES256 - Generates a P-256 ECDSA Key Pair for signing ES256 tokens. Like NewPrivateKey, the private key is
+stored as PKCS#8 and the generated key is marked as active. ECDSA keys are much faster to generate than RSA keys, so
+this is cheap enough to call during a request
+*/
+func NewPrivateKeyES256(audience string) (*PrivateJSONWebKey, *JSONWebKey, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), secret.RandReader())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v (%w)", ErrGenerateKey, err)
+	}
+
+	return NewPrivateKeyFromECDSA(privateKey, audience)
+}
+
+/*
+NewPrivateKeyFromECDSA - Builds the private and public JSON Web Keys for an existing P-256 private key. This is used by
+NewPrivateKeyES256 after a key has been generated, and by ImportKey. The key is assumed to be on the P-256 curve
+*/
+func NewPrivateKeyFromECDSA(privateKey *ecdsa.PrivateKey, audience string) (*PrivateJSONWebKey, *JSONWebKey, error) {
+	/*
+		The coordinates are left padded to the size of the curve, as RFC 7518 section 6.2.1.2 requires them to be the
+		full 32 bytes even when they have leading zeros
+	*/
+	x := make([]byte, ECKeySize/8)
+	y := make([]byte, ECKeySize/8)
+	privateKey.PublicKey.X.FillBytes(x)
+	privateKey.PublicKey.Y.FillBytes(y)
+
+	keyHeader := header.New(secret.EncodeBase64(append(x, y...)))
+
+	jwk := &JSONWebKey{
+		Use: "sig",
+		Kty: "EC",
+		Alg: "ES256",
+		Kid: keyHeader.Identifier,
+		Crv: "P-256",
+		X:   secret.EncodeBase64(x),
+		Y:   secret.EncodeBase64(y),
+	}
+
+	encoded, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v (%w)", ErrMarshalKey, err)
+	}
+
+	ret := &PrivateJSONWebKey{
+		Alg:         "ES256",
+		Header:      keyHeader,
+		KeyMaterial: secret.EncodeBase64(encoded),
+		Size:        int64(ECKeySize),
+		IsCurrent:   true,
+		Audience:    audience,
+	}
+
+	return ret, jwk, nil
+}
+
+/*
+ECDSA - Converts a public JSON Web Key into an ecdsa.PublicKey struct so that it can be used with the crypto/ecdsa
+package. Only keys on the P-256 curve are supported, as these are the only EC keys that credstack generates
+*/
+func (key *JSONWebKey) ECDSA() (*ecdsa.PublicKey, error) {
+	if key.Kty != "EC" || key.Crv != "P-256" {
+		return nil, fmt.Errorf("%w (%v)", ErrKeyIsNotValid, "key is not a P-256 EC key")
+	}
+
+	xBytes := []byte(key.X)
+	x, err := secret.DecodeBase64(xBytes, uint32(len(xBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", secret.ErrFailedToBaseDecode, err)
+	}
+
+	yBytes := []byte(key.Y)
+	y, err := secret.DecodeBase64(yBytes, uint32(len(yBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", secret.ErrFailedToBaseDecode, err)
+	}
+
+	publicKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+
+	/*
+		Converting to crypto/ecdh validates that the point is on the curve, without relying on the deprecated
+		elliptic.Curve.IsOnCurve
+	*/
+	_, err = publicKey.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrKeyIsNotValid, err)
+	}
+
+	return publicKey, nil
+}
@@ -0,0 +1,221 @@
+package jwk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/lock"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// BundleVersion - The version of the KeyBundle format written by Export. Import rejects bundles with any other version
+const BundleVersion = 1
+
+// ErrUnsupportedBundle - Provides a named error for when a key bundle was written by an incompatible version of credstack
+var ErrUnsupportedBundle = credstackError.NewError(400, "ERR_UNSUPPORTED_KEY_BUNDLE", "jwk: The key bundle was written by an unsupported version of credstack")
+
+// ErrKeyIdConflict - Provides a named error for when an imported key has the same key ID as a different key that already exists
+var ErrKeyIdConflict = credstackError.NewError(409, "ERR_KEY_ID_CONFLICT", "jwk: A different key with the same key ID already exists")
+
+/*
+KeyBundle - Every signing key of a deployment, along with the JWK published for it. This contains private key material,
+so it should only ever be written to disk encrypted
+*/
+type KeyBundle struct {
+	// Version - The version of the bundle format. See BundleVersion
+	Version int `json:"version"`
+
+	// ExportedAt - A unix timestamp representing when the bundle was exported
+	ExportedAt int64 `json:"exported_at"`
+
+	// Keys - The key pairs in the bundle
+	Keys []KeyPair `json:"keys"`
+}
+
+/*
+KeyPair - A private key, and the public JWK that is published for it under .well-known/jwks.json
+*/
+type KeyPair struct {
+	// Private - The private key, including whether it is current or staged
+	Private *PrivateJSONWebKey `json:"private"`
+
+	// Public - The public JWK published for the private key
+	Public *JSONWebKey `json:"public"`
+}
+
+/*
+ImportResult - The outcome of importing a key bundle
+*/
+type ImportResult struct {
+	// Imported - The key IDs of the keys that were imported
+	Imported []string `json:"imported" yaml:"imported"`
+
+	// Skipped - The key IDs of the keys that already existed with the same key material, and were left unchanged
+	Skipped []string `json:"skipped" yaml:"skipped"`
+}
+
+/*
+Export - Collects every private key in the database along with its published JWK, so that they can be imported into
+another environment with Import. Private keys whose JWK is no longer published were revoked with RotateRevokeKeys, and
+are not exported, as no token signed with them can be validated anymore
+*/
+func Export(serv *server.Server) (*KeyBundle, error) {
+	privateKeys, err := ListPrivateKeys(serv)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &KeyBundle{
+		Version:    BundleVersion,
+		ExportedAt: serv.Clock().Now().Unix(),
+		Keys:       make([]KeyPair, 0, len(privateKeys)),
+	}
+
+	for _, privateKey := range privateKeys {
+		public, err := Get(serv, privateKey.Header.Identifier)
+		if err != nil {
+			if errors.Is(err, ErrKeyNotExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		ret.Keys = append(ret.Keys, KeyPair{Private: privateKey, Public: public})
+	}
+
+	return ret, nil
+}
+
+/*
+Import - Stores the keys from a bundle written by Export, so that tokens signed in the environment the bundle was
+exported from remain valid in this one. Every private key is verified against its JWK before anything is written.
+
+Keys that already exist with the same key material are skipped, so a bundle can safely be imported more than once. If a
+different key already exists under the same key ID, then ErrKeyIdConflict is returned. When an imported key is the
+current key for its algorithm and audience, then the current key for them is rotated out in the same way RotateKeys does,
+so that its tokens remain valid but new tokens are signed with the imported key
+*/
+func Import(serv *server.Server, bundle *KeyBundle) (*ImportResult, error) {
+	if bundle.Version != BundleVersion {
+		return nil, fmt.Errorf("%w (version %d)", ErrUnsupportedBundle, bundle.Version)
+	}
+
+	for _, pair := range bundle.Keys {
+		if pair.Private == nil || pair.Private.Header == nil || pair.Public == nil || pair.Private.Header.Identifier != pair.Public.Kid {
+			return nil, fmt.Errorf("%w (key pair is incomplete)", ErrKeyIsNotValid)
+		}
+
+		err := pair.Private.Verify(serv, pair.Public)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, pair.Public.Kid)
+		}
+	}
+
+	ret := &ImportResult{Imported: []string{}, Skipped: []string{}}
+
+	/*
+		Keys that are not current are imported first, so that a staged key is never promoted before the current key it
+		follows has been imported
+	*/
+	pairs := slices.Clone(bundle.Keys)
+	slices.SortStableFunc(pairs, func(a KeyPair, b KeyPair) int {
+		switch {
+		case a.Private.IsCurrent == b.Private.IsCurrent:
+			return 0
+		case b.Private.IsCurrent:
+			return -1
+		default:
+			return 1
+		}
+	})
+
+	for _, pair := range pairs {
+		imported, err := importPair(serv, pair)
+		if err != nil {
+			return nil, err
+		}
+
+		if imported {
+			ret.Imported = append(ret.Imported, pair.Public.Kid)
+		} else {
+			ret.Skipped = append(ret.Skipped, pair.Public.Kid)
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+importPair - Stores a single verified key pair. Returns false if the key already exists with the same key material
+*/
+func importPair(serv *server.Server, pair KeyPair) (bool, error) {
+	kid := pair.Public.Kid
+
+	var existing PrivateJSONWebKey
+
+	err := serv.Database().Collection("key").FindOne(serv.Context(), bson.M{"header.identifier": kid}).Decode(&existing)
+	if err == nil {
+		if existing.KeyMaterial != pair.Private.KeyMaterial || existing.KeyReference != pair.Private.KeyReference {
+			return false, fmt.Errorf("%w (%s)", ErrKeyIdConflict, kid)
+		}
+
+		return false, nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return false, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	alg, audience := pair.Private.Alg, pair.Private.Audience
+
+	return true, lock.WithLock(serv, "key.rotate:"+alg+":"+audience, func(ctx context.Context) error {
+		serv := serv.WithContext(ctx)
+
+		/*
+			The JWK is published first, so that it can already be fetched under .well-known/jwks.json by the time the
+			first token is signed with the imported key. It is replaced if it exists, as the private key it belongs to
+			does not
+		*/
+		_, err := serv.Database().Collection("jwk").ReplaceOne(
+			serv.Context(),
+			bson.M{"kid": kid},
+			pair.Public,
+			mongoOpts.Replace().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		models := []mongo.WriteModel{}
+		if pair.Private.IsCurrent {
+			retire, err := retireUpdate(serv)
+			if err != nil {
+				return err
+			}
+
+			models = append(models, mongo.NewUpdateManyModel().
+				SetFilter(bson.M{"alg": alg, "audience": audience, "is_current": true}).
+				SetUpdate(retire))
+		}
+
+		models = append(models, mongo.NewInsertOneModel().SetDocument(pair.Private))
+
+		_, err = serv.Database().BulkWrite("key", models, true)
+		if err != nil {
+			return err
+		}
+
+		if pair.Private.IsCurrent {
+			activeKeys.invalidate(serv, alg, audience)
+		}
+
+		return nil
+	})
+}
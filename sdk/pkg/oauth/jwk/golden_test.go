@@ -0,0 +1,40 @@
+package jwk
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/credstack/credstack/sdk/internal/golden"
+)
+
+func TestRSAJWKGolden(t *testing.T) {
+	golden.Deterministic(t)
+
+	_, publicKey, err := NewPrivateKeyFromRSA(golden.RSAKey(t), "https://api.credstack.test")
+	if err != nil {
+		t.Fatalf("NewPrivateKeyFromRSA: %v", err)
+	}
+
+	encoded, err := json.MarshalIndent(publicKey, "", "  ")
+	if err != nil {
+		t.Fatalf("json.MarshalIndent: %v", err)
+	}
+
+	golden.Assert(t, "rsa_jwk", append(encoded, '\n'))
+}
+
+func TestECDSAJWKGolden(t *testing.T) {
+	golden.Deterministic(t)
+
+	_, publicKey, err := NewPrivateKeyFromECDSA(golden.ECDSAKey(t), "https://api.credstack.test")
+	if err != nil {
+		t.Fatalf("NewPrivateKeyFromECDSA: %v", err)
+	}
+
+	encoded, err := json.MarshalIndent(publicKey, "", "  ")
+	if err != nil {
+		t.Fatalf("json.MarshalIndent: %v", err)
+	}
+
+	golden.Assert(t, "ecdsa_jwk", append(encoded, '\n'))
+}
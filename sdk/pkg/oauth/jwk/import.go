@@ -0,0 +1,263 @@
+package jwk
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/events"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+// ErrInvalidImportedKey - Provides a named error for when an imported key is not an RSA or P-256 private key that credstack can sign with
+var ErrInvalidImportedKey = credstackError.NewError(400, "ERR_INVALID_IMPORTED_KEY", "jwk: The imported key must be an RSA key of at least 2048 bits or a P-256 EC key")
+
+/*
+privateJWK - The members of a private JSON Web Key (RFC 7518 section 6) that are needed to import it. The CRT members of
+RSA keys are not read, as they are computed again from the primes
+*/
+type privateJWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	D   string `json:"d"`
+	P   string `json:"p"`
+	Q   string `json:"q"`
+	Oth []any  `json:"oth"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+/*
+ImportKey - Imports a private key that was generated outside of credstack, so that tokens that were signed with it by
+another identity provider keep validating after migrating to credstack. The key can either be PEM encoded (PKCS#8,
+PKCS#1 or SEC 1), or a private JSON Web Key. RSA keys must be at least 2048 bits, and EC keys must be on the P-256 curve.
+
+The key ID is derived from the key in the same way as it is for generated keys, unless one is provided in the parameter
+or in the JSON Web Key. Tokens issued by the previous identity provider reference its key ID's, so the original key ID
+must be kept for them to validate.
+
+If activate is true, then the key becomes the current key for the audience, and the current key is rotated out in the
+same way RotateKeys does. Otherwise, the key is only published in the JWKS, and is retired in the same way as a key that
+was rotated out now. Imported keys always sign locally, even if an external signing backend is configured.
+
+Importing the same key again is not an error, and leaves the existing key unchanged, in which case false is returned. If
+a different key already exists under the key ID, then ErrKeyIdConflict is returned
+*/
+func ImportKey(serv *server.Server, encoded []byte, audience string, kid string, activate bool) (*PrivateJSONWebKey, bool, error) {
+	var privateKey *PrivateJSONWebKey
+	var jwk *JSONWebKey
+	var err error
+
+	trimmed := bytes.TrimSpace(encoded)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		privateKey, jwk, kid, err = importJWK(trimmed, audience, kid)
+	} else {
+		privateKey, jwk, err = importPEM(trimmed, audience)
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if kid != "" {
+		privateKey.Header.Identifier = kid
+		jwk.Kid = kid
+	}
+
+	privateKey.IsCurrent = activate
+	if !activate {
+		privateKey.RetiresAt, err = retirement(serv)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	imported, err := importPair(serv, KeyPair{Private: privateKey, Public: jwk})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if imported {
+		serv.PublishEvent(events.TypeKeyImported, map[string]string{
+			"alg":      privateKey.Alg,
+			"audience": audience,
+			"kid":      jwk.Kid,
+			"active":   fmt.Sprint(activate),
+		})
+	}
+
+	return privateKey, imported, nil
+}
+
+/*
+importPEM - Parses and validates a PEM encoded private key, and builds the private and public JSON Web Keys for it
+*/
+func importPEM(encoded []byte, audience string) (*PrivateJSONWebKey, *JSONWebKey, error) {
+	block, _ := pem.Decode(encoded)
+	if block == nil {
+		return nil, nil, fmt.Errorf("%w (key is neither PEM encoded nor a JSON Web Key)", ErrInvalidImportedKey)
+	}
+
+	var parsed any
+	var err error
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, nil, fmt.Errorf("%w (unsupported PEM block %q)", ErrInvalidImportedKey, block.Type)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w (%v)", ErrInvalidImportedKey, err)
+	}
+
+	switch typed := parsed.(type) {
+	case *rsa.PrivateKey:
+		return importRSA(typed, audience)
+	case *ecdsa.PrivateKey:
+		if typed.Curve != elliptic.P256() {
+			return nil, nil, fmt.Errorf("%w (EC key is not on the P-256 curve)", ErrInvalidImportedKey)
+		}
+
+		return NewPrivateKeyFromECDSA(typed, audience)
+	default:
+		return nil, nil, fmt.Errorf("%w (unsupported key type %T)", ErrInvalidImportedKey, parsed)
+	}
+}
+
+/*
+importJWK - Parses and validates a private JSON Web Key, and builds the private and public JSON Web Keys for it. The key
+ID provided in the parameter takes precedence over the one in the JSON Web Key, and the one that applies is returned
+*/
+func importJWK(encoded []byte, audience string, kid string) (*PrivateJSONWebKey, *JSONWebKey, string, error) {
+	var key privateJWK
+
+	err := json.Unmarshal(encoded, &key)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("%w (%v)", ErrInvalidImportedKey, err)
+	}
+
+	if key.Use != "" && key.Use != "sig" {
+		return nil, nil, "", fmt.Errorf("%w (key is not a signing key)", ErrInvalidImportedKey)
+	}
+
+	if kid == "" {
+		kid = key.Kid
+	}
+
+	var privateKey *PrivateJSONWebKey
+	var jwk *JSONWebKey
+
+	switch {
+	case key.Kty == "RSA" && (key.Alg == "" || key.Alg == "RS256"):
+		if len(key.Oth) != 0 {
+			return nil, nil, "", fmt.Errorf("%w (multi-prime RSA keys are not supported)", ErrInvalidImportedKey)
+		}
+
+		fields, err := decodeJWKFields(key.N, key.E, key.D, key.P, key.Q)
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		exponent := new(big.Int).SetBytes(fields[1])
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, nil, "", fmt.Errorf("%w (public exponent is too large)", ErrInvalidImportedKey)
+		}
+
+		privateKey, jwk, err = importRSA(&rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: new(big.Int).SetBytes(fields[0]), E: int(exponent.Int64())},
+			D:         new(big.Int).SetBytes(fields[2]),
+			Primes:    []*big.Int{new(big.Int).SetBytes(fields[3]), new(big.Int).SetBytes(fields[4])},
+		}, audience)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	case key.Kty == "EC" && key.Crv == "P-256" && (key.Alg == "" || key.Alg == "ES256"):
+		fields, err := decodeJWKFields(key.D, key.X, key.Y)
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		ecKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), fields[0])
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("%w (%v)", ErrInvalidImportedKey, err)
+		}
+
+		/*
+			The public key is derived from the private scalar, so the coordinates in the JSON Web Key are only checked
+			against it, to catch keys whose members were mixed up
+		*/
+		if ecKey.X.Cmp(new(big.Int).SetBytes(fields[1])) != 0 || ecKey.Y.Cmp(new(big.Int).SetBytes(fields[2])) != 0 {
+			return nil, nil, "", fmt.Errorf("%w (public key does not match private key)", ErrInvalidImportedKey)
+		}
+
+		privateKey, jwk, err = NewPrivateKeyFromECDSA(ecKey, audience)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	default:
+		return nil, nil, "", fmt.Errorf("%w (unsupported key type %s %s)", ErrInvalidImportedKey, key.Kty, key.Alg)
+	}
+
+	return privateKey, jwk, kid, nil
+}
+
+/*
+importRSA - Validates an RSA private key, and builds the private and public JSON Web Keys for it
+*/
+func importRSA(privateKey *rsa.PrivateKey, audience string) (*PrivateJSONWebKey, *JSONWebKey, error) {
+	if privateKey.N.BitLen() < RSAKeySize {
+		return nil, nil, fmt.Errorf("%w (RSA key is only %d bits)", ErrInvalidImportedKey, privateKey.N.BitLen())
+	}
+
+	err := privateKey.Validate()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w (%v)", ErrInvalidImportedKey, err)
+	}
+
+	privateKey.Precompute()
+
+	return NewPrivateKeyFromRSA(privateKey, audience)
+}
+
+/*
+decodeJWKFields - Decodes the base64url encoded members of a JSON Web Key. RFC 7518 requires them to be unpadded, however
+padding is accepted, as credstack publishes its own JWK's padded. Every member must be present
+*/
+func decodeJWKFields(fields ...string) ([][]byte, error) {
+	ret := make([][]byte, 0, len(fields))
+
+	for _, field := range fields {
+		if field == "" {
+			return nil, fmt.Errorf("%w (key is missing a required member)", ErrInvalidImportedKey)
+		}
+
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(field, "="))
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrInvalidImportedKey, err)
+		}
+
+		ret = append(ret, decoded)
+	}
+
+	return ret, nil
+}
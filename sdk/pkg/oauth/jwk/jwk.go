@@ -1,7 +1,6 @@
 package jwk
 
 import (
-	"context"
 	"crypto/rsa"
 	"errors"
 	"fmt"
@@ -35,11 +34,20 @@ type JSONWebKey struct {
 	// Alg - Defines the algorithm that this JWK was generated using
 	Alg string `json:"alg" bson:"alg"`
 
-	// N - Public modulos for the key
-	N string `json:"n" bson:"n"`
+	// N - Public modulos for the key. Only set for RSA keys
+	N string `json:"n,omitempty" bson:"n,omitempty"`
 
-	// E - Public exponent for the key
-	E string `json:"e" bson:"e"`
+	// E - Public exponent for the key. Only set for RSA keys
+	E string `json:"e,omitempty" bson:"e,omitempty"`
+
+	// Crv - The curve the key was generated on. Only set for EC keys
+	Crv string `json:"crv,omitempty" bson:"crv,omitempty"`
+
+	// X - The x coordinate of the public key. Only set for EC keys
+	X string `json:"x,omitempty" bson:"x,omitempty"`
+
+	// Y - The y coordinate of the public key. Only set for EC keys
+	Y string `json:"y,omitempty" bson:"y,omitempty"`
 }
 
 /*
@@ -100,28 +108,59 @@ TODO: Update this to remove alg check. HS256 tokens use client secret for signin
 */
 func New(serv *server.Server, alg string, audience string) (*PrivateJSONWebKey, error) {
 	ret := new(PrivateJSONWebKey)
-	if alg == "RS256" {
-		privateKey, jwk, err := NewPrivateKey(audience)
+	if alg == "RS256" || alg == "ES256" {
+		privateKey, jwk, err := generateKey(serv, alg, audience)
 		if err != nil {
 			return nil, err
 		}
 
-		_, err = serv.Database().Collection("key").InsertOne(context.Background(), privateKey)
+		_, err = serv.Database().Collection("key").InsertOne(serv.Context(), privateKey)
 		if err != nil {
 			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
 		}
 
-		_, err = serv.Database().Collection("jwk").InsertOne(context.Background(), jwk)
+		_, err = serv.Database().Collection("jwk").InsertOne(serv.Context(), jwk)
 		if err != nil {
 			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
 		}
 
+		activeKeys.invalidate(serv, alg, audience)
+
 		ret = privateKey
 	}
 
 	return ret, nil
 }
 
+/*
+generateKey - Generates a new key pair for the asymmetric algorithm provided in the parameter. If an external signing
+backend is configured, then the key is generated in it and only a reference to it is returned in place of its key
+material. If the algorithm is not RS256 or ES256, then ErrUnsupportedKeyAlg is returned
+*/
+func generateKey(serv *server.Server, alg string, audience string) (*PrivateJSONWebKey, *JSONWebKey, error) {
+	if alg != "RS256" && alg != "ES256" {
+		return nil, nil, ErrUnsupportedKeyAlg
+	}
+
+	backend, err := serv.Signer()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if backend != nil {
+		return generateExternal(backend, alg, audience)
+	}
+
+	switch alg {
+	case "RS256":
+		return NewPrivateKey(audience)
+	case "ES256":
+		return NewPrivateKeyES256(audience)
+	default:
+		return nil, nil, ErrUnsupportedKeyAlg
+	}
+}
+
 /*
 Get - Fetches the public JSON Web Key that matches the key identifier passed in the parameter. This just returns
 the model and other functions provided in this package can be used to convert it back to a valid rsa.PublicKey
@@ -133,7 +172,7 @@ func Get(serv *server.Server, kid string) (*JSONWebKey, error) {
 		The header.identifier field always represents our Key Identifiers (kid) so we can always safely lookup our key
 		with this. Additionally, the same KID is used across both the JWK and the Private Key to simplify key access
 	*/
-	result := serv.Database().Collection("jwk").FindOne(context.Background(), bson.M{"kid": kid})
+	result := serv.Database().Collection("jwk").FindOne(serv.Context(), bson.M{"kid": kid})
 	err := result.Decode(&jwk)
 	if err != nil {
 		if !errors.Is(err, mongo.ErrNoDocuments) && err != nil {
@@ -153,18 +192,36 @@ ActiveKey - Fetches the latest active private key according to the algorithm tha
 model (key.PrivateJSONWebKey) is used for both RS256 and HS256 keys, so the same function can be used for either. Additional
 functions are provided within the package to convert this model into a valid RSA private key to use
 
+If a staged key's staging period has elapsed, then it is promoted to the current key before the lookup. See Stage
+
+The current key is cached in memory for KeyConfig.CacheTTL, along with its parsed key material. While it is cached, the
+database is not queried, so a staged key is promoted up to KeyConfig.CacheTTL after its staging period has elapsed
+
 TODO: This does not support HS-256
 TODO: This may not be needed, validate as the rest of this package gets fleshed out
 */
 func ActiveKey(serv *server.Server, alg string, audience string) (*PrivateJSONWebKey, error) {
+	return activeKeys.load(serv, alg, audience, currentKey)
+}
+
+/*
+currentKey - Promotes the staged key of the algorithm and audience if its staging period has elapsed, and then looks up
+the current key in the database. If there is none, then ErrKeyNotExist is returned
+*/
+func currentKey(serv *server.Server, alg string, audience string) (*PrivateJSONWebKey, error) {
+	err := promoteStaged(serv, alg, audience)
+	if err != nil {
+		return nil, err
+	}
+
 	var jwk PrivateJSONWebKey
 
 	/*
 		The header.identifier field always represents our Key Identifiers (kid) so we can always safely lookup our key
 		with this. Additionally, the same KID is used across both the JWK and the Private Key to simplify key access
 	*/
-	result := serv.Database().Collection("key").FindOne(context.Background(), bson.M{"alg": alg, "is_current": true, "audience": audience})
-	err := result.Decode(&jwk)
+	result := serv.Database().Collection("key").FindOne(serv.Context(), bson.M{"alg": alg, "is_current": true, "audience": audience})
+	err = result.Decode(&jwk)
 	if err != nil {
 		if !errors.Is(err, mongo.ErrNoDocuments) && err != nil {
 			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
@@ -1,7 +1,6 @@
 package jwk
 
 import (
-	"context"
 	"errors"
 	"fmt"
 
@@ -19,7 +18,7 @@ type JSONWebKeySet struct {
 }
 
 /*
-JWKS - Fetches all JSON Web Keys stored in the database and returns them as a slice. Only RSA Keys are returned with
+JWKS - Fetches all JSON Web Keys stored in the database and returns them as a slice. Only RSA and EC Keys are returned with
 this function call, as this is intended to be used with the .well-known/jwks.json endpoint, and HSA secrets should not
 be exposed publicly as they are symmetrical
 
@@ -31,7 +30,7 @@ func JWKS(serv *server.Server) (*JSONWebKeySet, error) {
 	/*
 		This function call is actually fairly simple, as all we really need to do here is list out the entire collection.
 	*/
-	cursor, err := serv.Database().Collection("jwk").Find(context.Background(), bson.M{"kty": "RSA"})
+	cursor, err := serv.Database().Collection("jwk").Find(serv.Context(), bson.M{"kty": bson.M{"$in": bson.A{"RSA", "EC"}}})
 	if err != nil {
 		if !errors.Is(err, mongo.ErrNoDocuments) && err != nil {
 			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
@@ -41,7 +40,7 @@ func JWKS(serv *server.Server) (*JSONWebKeySet, error) {
 	/*
 		Then we simply just decode all the results into our slice and then return it.
 	*/
-	err = cursor.All(context.Background(), &jwks.Keys) // check here for proper errors
+	err = cursor.All(serv.Context(), &jwks.Keys) // check here for proper errors
 	if err != nil {
 		if !errors.Is(err, mongo.ErrNoDocuments) && err != nil {
 			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
@@ -0,0 +1,89 @@
+package jwk
+
+import (
+	"crypto"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrMissingKid - Provides a named error for when a token has no kid in its header, so the key it was signed with cannot be selected
+var ErrMissingKid = credstackError.NewError(401, "ERR_MISSING_KID", "jwk: The token has no kid in its header")
+
+// ErrKeyAlgMismatch - Provides a named error for when a token is signed with a different algorithm than the key its kid selects
+var ErrKeyAlgMismatch = credstackError.NewError(401, "ERR_KEY_ALG_MISMATCH", "jwk: The token is signed with a different algorithm than the key its kid selects")
+
+/*
+PublicKey - Converts a public JSON Web Key into the public key of its type, an *rsa.PublicKey or an *ecdsa.PublicKey, so
+that it can be used to verify signatures
+*/
+func (key *JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch key.Kty {
+	case "RSA":
+		return key.RSA()
+	case "EC":
+		return key.ECDSA()
+	default:
+		return nil, fmt.Errorf("%w (unsupported key type %q)", ErrKeyIsNotValid, key.Kty)
+	}
+}
+
+/*
+Key - Returns the key with the kid provided in the parameter from the set. If there is none, then ErrKeyNotExist is
+returned
+*/
+func (set *JSONWebKeySet) Key(kid string) (*JSONWebKey, error) {
+	for i := range set.Keys {
+		if set.Keys[i].Kid == kid {
+			return &set.Keys[i], nil
+		}
+	}
+
+	return nil, ErrKeyNotExist
+}
+
+/*
+Keyfunc - A jwt.Keyfunc that selects the key a token was signed with from the set, by the kid in its header. Every key
+in the set stays usable for verification, so tokens signed before a rotation keep validating for as long as their key is
+published. Resource servers that cache the JWKS should fetch it again when this returns ErrKeyNotExist, as the token may
+have been signed with a key that was published after it was cached
+*/
+func (set *JSONWebKeySet) Keyfunc(token *jwt.Token) (any, error) {
+	return selectKey(token, set.Key)
+}
+
+/*
+Keyfunc - Returns a jwt.Keyfunc that selects the key a token was signed with from the keys published by this deployment,
+by the kid in its header. See JSONWebKeySet.Keyfunc
+*/
+func Keyfunc(serv *server.Server) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		return selectKey(token, func(kid string) (*JSONWebKey, error) {
+			return Get(serv, kid)
+		})
+	}
+}
+
+/*
+selectKey - Looks up the key with the kid in the header of the token, and ensures that the token is signed with the
+algorithm of the key, so that a key can never be used with an algorithm it was not published for
+*/
+func selectKey(token *jwt.Token, lookup func(kid string) (*JSONWebKey, error)) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrMissingKid
+	}
+
+	public, err := lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if public.Alg != token.Method.Alg() {
+		return nil, fmt.Errorf("%w (token is %s, key %s is %s)", ErrKeyAlgMismatch, token.Method.Alg(), kid, public.Alg)
+	}
+
+	return public.PublicKey()
+}
@@ -1,7 +1,6 @@
 package jwk
 
 import (
-	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"fmt"
@@ -23,9 +22,15 @@ type PrivateJSONWebKey struct {
 	// Alg - Specifies the algorithm used to generate the key. Most commonly RSA
 	Alg string `json:"alg" bson:"alg"`
 
-	// KeyMaterial - The private key material used for signing tokens
+	// KeyMaterial - The private key material used for signing tokens. Empty if the key lives in an external signing backend
 	KeyMaterial string `json:"key_material" bson:"key_material"`
 
+	// Backend - The external signing backend the key lives in (see SignerConfig.Backend). Empty if the key material is stored here
+	Backend string `json:"backend,omitempty" bson:"backend,omitempty"`
+
+	// KeyReference - The reference the backend identifies the key with. Only set if Backend is set
+	KeyReference string `json:"key_reference,omitempty" bson:"key_reference,omitempty"`
+
 	// Size - The size of the key in bits
 	Size int64 `json:"size" bson:"size"`
 
@@ -34,6 +39,15 @@ type PrivateJSONWebKey struct {
 
 	// Audience - The audience that this key is signing tokens for
 	Audience string `json:"audience" bson:"audience"`
+
+	// ActivatesAt - A unix timestamp representing when a staged key becomes the current key. Zero if the key is not staged
+	ActivatesAt int64 `json:"activates_at" bson:"activates_at"`
+
+	// RetiresAt - A unix timestamp representing when a key that was rotated out, and is only used for verification, is removed along with its JWK. Zero if the key was never rotated out
+	RetiresAt int64 `json:"retires_at" bson:"retires_at"`
+
+	// signer - The Signer of the key, built before the key is cached by ActiveKey. Nil for keys that were not cached
+	signer Signer
 }
 
 /*
@@ -89,18 +103,27 @@ func NewPrivateKey(audience string) (*PrivateJSONWebKey, *JSONWebKey, error) {
 		First we want to generate our key here. Since we don't need to conform to user provided size, we can always
 		use the 2048 as the size in bits.
 
-		The first parameter of our GenerateKey function, wants an io.Reader to provide random bytes from. It is
-		recommended to use rand.Reader here as this can generate cryptographically random bytes to use as the
-		basis of our Key
+		The first parameter of our GenerateKey function, wants an io.Reader to provide random bytes from. We use the
+		reader provided by the secret package here, which is rand.Reader unless it has been replaced for testing
 
 		Notice that we are not calling key.Validate after this function. This is because when rsa.GenerateKey is called,
 		it will automatically check the correctness of the Key
 	*/
-	privateKey, err := rsa.GenerateKey(rand.Reader, RSAKeySize)
+	privateKey, err := rsa.GenerateKey(secret.RandReader(), RSAKeySize)
 	if err != nil {
 		return nil, nil, fmt.Errorf("%v (%w)", ErrGenerateKey, err)
 	}
 
+	return NewPrivateKeyFromRSA(privateKey, audience)
+}
+
+/*
+NewPrivateKeyFromRSA - Builds the private and public JSON Web Keys for an existing RSA private key. This is used by
+NewPrivateKey after a key has been generated, but can also be used with a fixed key so that JWK serialization and token
+signing produce the same output on every run (golden files), and by ImportKey. The key is assumed to have already been
+validated
+*/
+func NewPrivateKeyFromRSA(privateKey *rsa.PrivateKey, audience string) (*PrivateJSONWebKey, *JSONWebKey, error) {
 	/*
 		We always use the same KID as we want to be able to identify both using a single identifier
 	*/
@@ -136,7 +159,7 @@ func NewPrivateKey(audience string) (*PrivateJSONWebKey, *JSONWebKey, error) {
 		Alg:         "RS256",
 		Header:      keyHeader,
 		KeyMaterial: secret.EncodeBase64(encoded),
-		Size:        int64(RSAKeySize),
+		Size:        int64(privateKey.N.BitLen()),
 		IsCurrent:   true,
 		Audience:    audience,
 	}
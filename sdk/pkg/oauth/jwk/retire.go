@@ -0,0 +1,142 @@
+package jwk
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+/*
+retireUpdate - Returns the update that rotates the current key out, so that it is only used for verification from then
+on. The key stays published until KeyConfig.GracePeriod has elapsed, or until the longest token lifetime of any client has
+elapsed if that is later, as no token signed with the key before it was rotated out can outlive either
+*/
+func retireUpdate(serv *server.Server) (bson.M, error) {
+	retiresAt, err := retirement(serv)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.M{"$set": bson.M{"is_current": false, "retires_at": retiresAt}}, nil
+}
+
+/*
+retirement - Returns the unix timestamp that a key rotated out now is retired at. See retireUpdate
+*/
+func retirement(serv *server.Server) (int64, error) {
+	lifetime, err := longestTokenLifetime(serv)
+	if err != nil {
+		return 0, err
+	}
+
+	return serv.Clock().Now().Add(max(serv.Config.KeyConfig.GracePeriod, lifetime)).Unix(), nil
+}
+
+/*
+longestTokenLifetime - Returns the longest token lifetime of any client. Clients are queried directly, as the client
+package depends on this one
+*/
+func longestTokenLifetime(serv *server.Server) (time.Duration, error) {
+	var longest struct {
+		TokenLifetime uint64 `bson:"token_lifetime"`
+	}
+
+	err := serv.Database().Collection("client").FindOne(
+		serv.Context(),
+		bson.M{},
+		mongoOpts.FindOne().SetSort(bson.D{{Key: "token_lifetime", Value: -1}}).SetProjection(bson.M{"token_lifetime": 1}),
+	).Decode(&longest)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return time.Duration(longest.TokenLifetime) * time.Second, nil
+}
+
+/*
+prune - Removes the keys for an algorithm and audience that were rotated out and whose retirement has passed, along with
+their JWK's, so that they are no longer published in the JWKS. There is no background job for this, so it is called
+whenever the keys are rotated. Keys that were rotated out before retirement was tracked are never removed, and neither
+are the keys of AuditConfig.SigningAudience, as audit signatures are verified with them for as long as the audit log is
+kept. Keys that live in an external signing backend are destroyed in it first, and if that fails they are kept until
+the next rotation. Returns the key ID's that were removed
+*/
+func prune(serv *server.Server, alg string, audience string) ([]string, error) {
+	if audience == serv.Config.AuditConfig.SigningAudience {
+		return nil, nil
+	}
+
+	result, err := serv.Database().Collection("key").Find(
+		serv.Context(),
+		bson.M{"alg": alg, "audience": audience, "is_current": false, "retires_at": bson.M{"$gt": 0, "$lte": serv.Clock().Now().Unix()}},
+		mongoOpts.Find().SetProjection(bson.M{"header.identifier": 1, "alg": 1, "backend": 1, "key_reference": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var retired []*PrivateJSONWebKey
+
+	err = result.All(serv.Context(), &retired)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if len(retired) == 0 {
+		return nil, nil
+	}
+
+	kids := make([]string, 0, len(retired))
+	for _, key := range retired {
+		if key.Backend != "" {
+			err = destroyExternal(serv, key)
+			if err != nil {
+				serv.Log().LogErrorEvent("Failed to destroy retired key "+key.Header.Identifier+" in its signing backend", err)
+				continue
+			}
+		}
+
+		kids = append(kids, key.Header.Identifier)
+	}
+
+	if len(kids) == 0 {
+		return nil, nil
+	}
+
+	/*
+		The JWK's are removed first, so that a failure in between leaves a private key without a JWK, which Export already
+		skips, rather than a published JWK whose private key is gone
+	*/
+	_, err = serv.Database().Collection("jwk").DeleteMany(serv.Context(), bson.M{"kid": bson.M{"$in": kids}})
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	_, err = serv.Database().Collection("key").DeleteMany(serv.Context(), bson.M{"header.identifier": bson.M{"$in": kids}})
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return kids, nil
+}
+
+/*
+destroyExternal - Destroys the key material of a key that lives in an external signing backend
+*/
+func destroyExternal(serv *server.Server, key *PrivateJSONWebKey) error {
+	backend, err := keyBackend(serv, key)
+	if err != nil {
+		return err
+	}
+
+	return backend.Destroy(key.KeyReference)
+}
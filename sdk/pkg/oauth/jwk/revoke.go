@@ -2,69 +2,177 @@ package jwk
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/credstack/credstack/sdk/pkg/approval/gate"
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/events"
+	"github.com/credstack/credstack/sdk/pkg/lock"
 	"github.com/credstack/credstack/sdk/pkg/server"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 var ErrNoKeysToRevoke = credstackError.NewError(404, "ERR_NO_KEY_REVOKE", "jwk: There are no keys in the database to revoke")
 
 /*
-revokeAllKeys - Revokes all the keys for a given algorithm and given audience
+hasKeys - Determines if any keys exist for a given algorithm and given audience
 */
-func revokeAllKeys(serv *server.Server, alg string, audience string) error {
-	/*
-		All we really need to do to "revoke" keys is set is_current to false. This marks the key as not available for
-		signing new tokens, as only one of these can be present at a time
-
-		This function is really only a helper function for RotateKeys and RotateRevokeKeys
-	*/
-	result, err := serv.Database().Collection("key").UpdateMany(context.Background(), bson.M{"alg": alg, "audience": audience}, bson.M{"$set": bson.M{"is_current": false}})
+func hasKeys(serv *server.Server, alg string, audience string) (bool, error) {
+	count, err := serv.Database().Collection("key").CountDocuments(serv.Context(), bson.M{"alg": alg, "audience": audience}, mongoOpts.Count().SetLimit(1))
 	if err != nil {
-		if !errors.Is(err, mongo.ErrNoDocuments) && err != nil {
-			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
-		}
+		return false, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
 	}
 
-	if result.MatchedCount == 0 {
-		return ErrNoKeysToRevoke
-	}
+	return count != 0, nil
+}
 
-	return nil
+func init() {
+	gate.Register(gate.ActionKeyRotate, func(serv *server.Server, target string) error {
+		_, err := rotateAudience(serv, target)
+		return err
+	})
 }
 
 /*
-RotateKeys - Marks all private keys in the database as not available for signing and generates a new key. The new key
-generated here is automatically marked as available for signing and any new tokens issues post-function call will use
-this key to sign tokens
+RotateKeys - Generates a new key for signing, and rotates the current key out so that it is only used for verification.
+Any new tokens issued post-function call will use the new key to sign tokens
+
+The JWK of the previous key is left in the jwk collection, so that it can still be fetched under .well-known/jwks.json
+and tokens signed with it are still considered 'valid'. It is kept until KeyConfig.GracePeriod has elapsed, or until
+every token signed with it has expired if that is later (see retireUpdate). Keys whose retirement has passed are removed
+along with their JWK's once the new key is in place
 
-This differs from RotateRevokeKeys, as this function leaves the JWK's associated with them in the jwk collection. This
-means that they can still be fetched under .well-known/jwks.json and any tokens signed with old keys are still considered
-'valid'
+Rotation is performed while holding a lock on the algorithm and audience, so that replicas in an HA deployment cannot
+rotate the same keys at the same time. If another replica is already rotating them, then lock.ErrLockHeld is returned.
+If rotating keys requires approval, then gate.ErrApprovalRequired is returned instead, and the keys must be rotated by
+approving a key.rotate approval
 */
 func RotateKeys(serv *server.Server, alg string, audience string) error {
-	/*
-		First we need to mark any old keys as not available for signing. This is consumed with one database call using
-		UpdateMany.
-
-		This can be a potential point of failure as if NewKey fails, then no keys exist for signing
-	*/
-	err := revokeAllKeys(serv, alg, audience)
+	err := gate.Check(serv, gate.ActionKeyRotate)
 	if err != nil {
 		return err
 	}
 
-	/*
-		Then we simply just generate our new key
-	*/
-	_, err = New(serv, alg, audience)
+	return rotateKeys(serv, alg, audience)
+}
+
+/*
+RotateAudience - Rotates the keys of every algorithm the audience provided in the parameter has a current key for, in the
+same way as RotateKeys, and returns the algorithms that were rotated. If the audience has no current keys, then
+ErrNoKeysToRevoke is returned. If rotating keys requires approval, then gate.ErrApprovalRequired is returned instead,
+and the keys must be rotated by approving a key.rotate approval
+*/
+func RotateAudience(serv *server.Server, audience string) ([]string, error) {
+	err := gate.Check(serv, gate.ActionKeyRotate)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return rotateAudience(serv, audience)
+}
+
+/*
+rotateAudience - Provides the logic for RotateAudience without checking for approval. This is what is executed once a
+key.rotate approval has been approved
+*/
+func rotateAudience(serv *server.Server, audience string) ([]string, error) {
+	keys, err := ListPrivateKeys(serv)
+	if err != nil {
+		return nil, err
+	}
+
+	var algs []string
+	for _, key := range keys {
+		if key.Audience == audience && key.IsCurrent && !slices.Contains(algs, key.Alg) {
+			algs = append(algs, key.Alg)
+		}
+	}
+
+	if len(algs) == 0 {
+		return nil, ErrNoKeysToRevoke
+	}
+
+	slices.Sort(algs)
+
+	for _, alg := range algs {
+		err = rotateKeys(serv, alg, audience)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	return algs, nil
+}
+
+/*
+rotateKeys - Provides the logic for RotateKeys without checking for approval
+*/
+func rotateKeys(serv *server.Server, alg string, audience string) error {
+	return lock.WithLock(serv, "key.rotate:"+alg+":"+audience, func(ctx context.Context) error {
+		serv := serv.WithContext(ctx)
+
+		exists, err := hasKeys(serv, alg, audience)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return ErrNoKeysToRevoke
+		}
+
+		/*
+			The new key is generated before anything is written, so that a failure to generate it leaves the old keys
+			available for signing. The JWK is published first so that it can already be fetched under
+			.well-known/jwks.json by the time the first token is signed with it
+		*/
+		privateKey, jwk, err := generateKey(serv, alg, audience)
+		if err != nil {
+			return err
+		}
+
+		retire, err := retireUpdate(serv)
+		if err != nil {
+			return err
+		}
+
+		_, err = serv.Database().Collection("jwk").InsertOne(serv.Context(), jwk)
+		if err != nil {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		/*
+			Rotating the current key out and inserting the new key is done with a single ordered bulk write, so that there
+			is never a window between the two where no key exists for signing. Keys that were already rotated out keep
+			their retirement
+		*/
+		_, err = serv.Database().BulkWrite("key", []mongo.WriteModel{
+			mongo.NewUpdateManyModel().
+				SetFilter(bson.M{"alg": alg, "audience": audience, "is_current": true}).
+				SetUpdate(retire),
+			mongo.NewInsertOneModel().SetDocument(privateKey),
+		}, true)
+		if err != nil {
+			return err
+		}
+
+		activeKeys.invalidate(serv, alg, audience)
+
+		pruned, err := prune(serv, alg, audience)
+		if err != nil {
+			return err
+		}
+
+		serv.PublishEvent(events.TypeKeyRotated, map[string]string{
+			"alg":      alg,
+			"audience": audience,
+			"kid":      jwk.Kid,
+			"pruned":   strings.Join(pruned, ","),
+		})
+
+		return nil
+	})
 }
@@ -0,0 +1,250 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/signer"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ErrSignerMismatch - Provides a named error for when a key lives in a signing backend other than the one that is configured
+var ErrSignerMismatch = credstackError.NewError(500, "ERR_SIGNER_MISMATCH", "jwk: The key lives in a signing backend that is not configured")
+
+/*
+Signer - Signs tokens with a private key. Keys whose key material is stored in the database sign with it directly, and
+keys that live in an external signing backend sign by calling it, so that their private half never leaves the backend
+*/
+type Signer interface {
+	// Sign - Signs the SHA-256 digest of the signing input of a token, and returns the signature as it is encoded in a JWS: PKCS #1 v1.5 for RS256, and the concatenated R and S for ES256
+	Sign(digest []byte) ([]byte, error)
+}
+
+/*
+Signer - Returns the Signer for the key. If the key lives in an external signing backend, then that backend must be the
+one that is configured, otherwise ErrSignerMismatch is returned. Keys returned by ActiveKey from its cache already hold
+their Signer, so their key material is not parsed again
+*/
+func (key *PrivateJSONWebKey) Signer(serv *server.Server) (Signer, error) {
+	if key.signer != nil {
+		return key.signer, nil
+	}
+
+	if key.Backend != "" {
+		backend, err := keyBackend(serv, key)
+		if err != nil {
+			return nil, err
+		}
+
+		return &backendSigner{backend: backend, reference: key.KeyReference, alg: key.Alg}, nil
+	}
+
+	switch key.Alg {
+	case "RS256":
+		privateKey, err := key.RSA()
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsaSigner{privateKey: privateKey}, nil
+	case "ES256":
+		privateKey, err := key.ECDSA()
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsaSigner{privateKey: privateKey}, nil
+	default:
+		return nil, ErrUnsupportedKeyAlg
+	}
+}
+
+/*
+keyBackend - Returns the configured signing backend if it is the backend the key provided in the parameter lives in
+*/
+func keyBackend(serv *server.Server, key *PrivateJSONWebKey) (signer.Backend, error) {
+	backend, err := serv.Signer()
+	if err != nil {
+		return nil, err
+	}
+
+	if backend == nil || backend.Name() != key.Backend {
+		return nil, fmt.Errorf("%w (%s)", ErrSignerMismatch, key.Backend)
+	}
+
+	return backend, nil
+}
+
+/*
+rsaSigner - Signs with an RSA private key stored in the database
+*/
+type rsaSigner struct {
+	privateKey *rsa.PrivateKey
+}
+
+func (s *rsaSigner) Sign(digest []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(secret.RandReader(), s.privateKey, crypto.SHA256, digest)
+}
+
+/*
+ecdsaSigner - Signs with an ECDSA private key stored in the database
+*/
+type ecdsaSigner struct {
+	privateKey *ecdsa.PrivateKey
+}
+
+func (s *ecdsaSigner) Sign(digest []byte) ([]byte, error) {
+	r, sig, err := ecdsa.Sign(secret.RandReader(), s.privateKey, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		R and S are left padded to the size of the curve, as RFC 7518 section 3.4 requires them to be the full 32 bytes
+	*/
+	ret := make([]byte, 2*ECKeySize/8)
+	r.FillBytes(ret[:ECKeySize/8])
+	sig.FillBytes(ret[ECKeySize/8:])
+
+	return ret, nil
+}
+
+/*
+backendSigner - Signs by calling the external signing backend the key lives in
+*/
+type backendSigner struct {
+	backend   signer.Backend
+	reference string
+	alg       string
+}
+
+func (s *backendSigner) Sign(digest []byte) ([]byte, error) {
+	return s.backend.Sign(s.reference, s.alg, digest)
+}
+
+/*
+generateExternal - Generates a new key in the external signing backend provided in the parameter. Only the reference to
+the key is stored in place of its key material, and the JWK is built from the public key the backend returns. The key ID
+is derived from the public key in the same way as it is for keys that are generated locally
+*/
+func generateExternal(backend signer.Backend, alg string, audience string) (*PrivateJSONWebKey, *JSONWebKey, error) {
+	reference, public, err := backend.Generate(alg, audience)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyHeader, jwk, size, err := publicJWK(public, alg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ret := &PrivateJSONWebKey{
+		Alg:          alg,
+		Header:       keyHeader,
+		Size:         size,
+		IsCurrent:    true,
+		Audience:     audience,
+		Backend:      backend.Name(),
+		KeyReference: reference,
+	}
+
+	return ret, jwk, nil
+}
+
+/*
+publicJWK - Builds the JWK of a public key, along with the header of the key it belongs to and its size in bits
+*/
+func publicJWK(public crypto.PublicKey, alg string) (*header.Header, *JSONWebKey, int64, error) {
+	switch typed := public.(type) {
+	case *rsa.PublicKey:
+		keyHeader := header.New(typed.N.String())
+
+		return keyHeader, &JSONWebKey{
+			Use: "sig",
+			Kty: "RSA",
+			Alg: alg,
+			Kid: keyHeader.Identifier,
+			N:   secret.EncodeBase64(typed.N.Bytes()),
+			E:   secret.EncodeBase64(big.NewInt(int64(typed.E)).Bytes()),
+		}, int64(typed.N.BitLen()), nil
+	case *ecdsa.PublicKey:
+		x := make([]byte, ECKeySize/8)
+		y := make([]byte, ECKeySize/8)
+		typed.X.FillBytes(x)
+		typed.Y.FillBytes(y)
+
+		keyHeader := header.New(secret.EncodeBase64(append(x, y...)))
+
+		return keyHeader, &JSONWebKey{
+			Use: "sig",
+			Kty: "EC",
+			Alg: alg,
+			Kid: keyHeader.Identifier,
+			Crv: "P-256",
+			X:   secret.EncodeBase64(x),
+			Y:   secret.EncodeBase64(y),
+		}, int64(ECKeySize), nil
+	default:
+		return nil, nil, 0, ErrKeyIsNotValid
+	}
+}
+
+/*
+Sync - Publishes the JWK of every key that lives in the configured signing backend again, from the public key the
+backend holds for it, so that the JWKS always matches the backend. A JWK is only replaced under the key ID of its key, so
+if the public key in the backend no longer matches the key ID, then ErrKeyPairMismatch is returned for it. Keys that were
+already removed from the JWKS by RotateRevokeKeys are left unpublished. Returns the key ID's that were synced
+*/
+func Sync(serv *server.Server) ([]string, error) {
+	backend, err := serv.Signer()
+	if err != nil || backend == nil {
+		return nil, err
+	}
+
+	keys, err := ListPrivateKeys(serv)
+	if err != nil {
+		return nil, err
+	}
+
+	synced := make([]string, 0)
+
+	for _, key := range keys {
+		if key.Backend != backend.Name() {
+			continue
+		}
+
+		kid := key.Header.Identifier
+
+		public, err := backend.PublicKey(key.KeyReference, key.Alg)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, kid)
+		}
+
+		_, jwk, _, err := publicJWK(public, key.Alg)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, kid)
+		}
+
+		if jwk.Kid != kid {
+			return nil, fmt.Errorf("%w (%s)", ErrKeyPairMismatch, kid)
+		}
+
+		result, err := serv.Database().Collection("jwk").ReplaceOne(serv.Context(), bson.M{"kid": kid}, jwk)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		if result.MatchedCount != 0 {
+			synced = append(synced, kid)
+		}
+	}
+
+	return synced, nil
+}
@@ -0,0 +1,120 @@
+package jwk
+
+import (
+	"errors"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var ErrKeyAlreadyStaged = credstackError.NewError(409, "ERR_KEY_ALREADY_STAGED", "jwk: A key is already staged for this algorithm and audience")
+var ErrUnsupportedKeyAlg = credstackError.NewError(400, "ERR_UNSUPPORTED_KEY_ALG", "jwk: Only RS256 and ES256 keys can be generated")
+
+/*
+Stage - Generates a new key and publishes it in the JWKS without using it for signing. Once KeyConfig.StagingPeriod has
+elapsed, the key is promoted to the current key the next time ActiveKey is called. This allows resource servers to
+fetch the new public key before any tokens are signed with it, so that tokens issued immediately after a rotation do not
+fail verification against a cached JWKS.
+
+Only one key can be staged per algorithm and audience at a time. If one is already staged, then ErrKeyAlreadyStaged is
+returned
+*/
+func Stage(serv *server.Server, alg string, audience string) (*PrivateJSONWebKey, error) {
+	if alg != "RS256" && alg != "ES256" {
+		return nil, ErrUnsupportedKeyAlg
+	}
+
+	existing := serv.Database().Collection("key").FindOne(
+		serv.Context(),
+		bson.M{"alg": alg, "audience": audience, "is_current": false, "activates_at": bson.M{"$gt": 0}},
+	)
+
+	err := existing.Err()
+	if err == nil {
+		return nil, ErrKeyAlreadyStaged
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	privateKey, jwk, err := generateKey(serv, alg, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey.IsCurrent = false
+	privateKey.ActivatesAt = serv.Clock().Now().Add(serv.Config.KeyConfig.StagingPeriod).Unix()
+
+	/*
+		The JWK is inserted with the private key, as publishing it in the JWKS is the entire purpose of staging
+	*/
+	_, err = serv.Database().Collection("key").InsertOne(serv.Context(), privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	_, err = serv.Database().Collection("jwk").InsertOne(serv.Context(), jwk)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return privateKey, nil
+}
+
+/*
+promoteStaged - Promotes a staged key to the current key if its staging period has elapsed. There is no background job
+for this, so it is called by ActiveKey before the current key is looked up. The staged key is claimed atomically with
+FindOneAndUpdate, so if multiple replicas attempt this at the same time only one of them rotates the previous keys out and
+removes the keys whose retirement has passed
+*/
+func promoteStaged(serv *server.Server, alg string, audience string) error {
+	result := serv.Database().Collection("key").FindOneAndUpdate(
+		serv.Context(),
+		bson.M{
+			"alg":          alg,
+			"audience":     audience,
+			"is_current":   false,
+			"activates_at": bson.M{"$gt": 0, "$lte": serv.Clock().Now().Unix()},
+		},
+		bson.M{"$set": bson.M{"is_current": true, "activates_at": 0}},
+	)
+
+	var promoted PrivateJSONWebKey
+
+	err := result.Decode(&promoted)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	/*
+		The previous keys are only rotated out. Their JWK's are left in place, so that tokens signed with them can still
+		be verified until they expire (see retireUpdate)
+	*/
+	retire, err := retireUpdate(serv)
+	if err != nil {
+		return err
+	}
+
+	_, err = serv.Database().Collection("key").UpdateMany(
+		serv.Context(),
+		bson.M{"alg": alg, "audience": audience, "header.identifier": bson.M{"$ne": promoted.Header.Identifier}, "is_current": true},
+		retire,
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	activeKeys.invalidate(serv, alg, audience)
+
+	_, err = prune(serv, alg, audience)
+
+	return err
+}
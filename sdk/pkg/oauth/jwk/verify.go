@@ -0,0 +1,96 @@
+package jwk
+
+import (
+	"crypto"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ErrKeyPairMismatch - Provides a named error for when a private key is not the private half of the JWK published under its kid
+var ErrKeyPairMismatch = credstackError.NewError(500, "ERR_KEY_PAIR_MISMATCH", "jwk: The private key does not match the public key published under its key ID")
+
+/*
+Verify - Parses the private key material and ensures that it is the private half of the public JSON Web Key provided in
+the parameter. RSA keys are additionally checked for mathematical correctness when they are parsed. If the key lives in
+an external signing backend, then its public key is fetched from the backend instead. If the private key cannot be
+parsed, or the backend cannot be reached, then that error is returned. If it parses, but does not match, then
+ErrKeyPairMismatch is returned
+*/
+func (key *PrivateJSONWebKey) Verify(serv *server.Server, public *JSONWebKey) error {
+	if key.Alg != public.Alg {
+		return fmt.Errorf("%w (private key is %s, public key is %s)", ErrKeyPairMismatch, key.Alg, public.Alg)
+	}
+
+	var privatePublic crypto.PublicKey
+	var publicKey interface{ Equal(crypto.PublicKey) bool }
+	var err error
+
+	switch key.Alg {
+	case "RS256":
+		publicKey, err = public.RSA()
+	case "ES256":
+		publicKey, err = public.ECDSA()
+	default:
+		return ErrUnsupportedKeyAlg
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case key.Backend != "":
+		backend, err := keyBackend(serv, key)
+		if err != nil {
+			return err
+		}
+
+		privatePublic, err = backend.PublicKey(key.KeyReference, key.Alg)
+		if err != nil {
+			return err
+		}
+	case key.Alg == "RS256":
+		privateKey, err := key.RSA()
+		if err != nil {
+			return err
+		}
+
+		privatePublic = &privateKey.PublicKey
+	default:
+		privateKey, err := key.ECDSA()
+		if err != nil {
+			return err
+		}
+
+		privatePublic = &privateKey.PublicKey
+	}
+
+	if !publicKey.Equal(privatePublic) {
+		return ErrKeyPairMismatch
+	}
+
+	return nil
+}
+
+/*
+ListPrivateKeys - Fetches every private key stored in the database, including keys that are no longer current and keys
+that are staged. This exposes key material, so it should never be returned from the API
+*/
+func ListPrivateKeys(serv *server.Server) ([]*PrivateJSONWebKey, error) {
+	cursor, err := serv.Database().Collection("key").Find(serv.Context(), bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := make([]*PrivateJSONWebKey, 0)
+
+	err = cursor.All(serv.Context(), &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,33 @@
+package resourceserver
+
+import (
+	"github.com/credstack/credstack/sdk/pkg/legacy"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+/*
+UnmarshalBSON - Decodes a ResourceServer, converting a TokenType that was written by the protobuf models as an enum
+number into its string equivalent. This lets documents that have not been rewritten by the legacy migration be read
+while it runs
+*/
+func (api *ResourceServer) UnmarshalBSON(data []byte) error {
+	type plain ResourceServer
+
+	/*
+		The TokenType declared here is shallower than the one inlined from Plain, so it takes precedence and receives the
+		raw value of token_type
+	*/
+	document := struct {
+		Plain     *plain        `bson:",inline"`
+		TokenType bson.RawValue `bson:"token_type"`
+	}{Plain: (*plain)(api)}
+
+	err := bson.Unmarshal(data, &document)
+	if err != nil {
+		return err
+	}
+
+	api.TokenType, err = legacy.DecodeString(document.TokenType, legacy.TokenTypes)
+
+	return err
+}
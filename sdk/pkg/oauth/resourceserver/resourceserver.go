@@ -1,13 +1,14 @@
 package resourceserver
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"slices"
 
+	"github.com/credstack/credstack/sdk/pkg/approval/gate"
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
 	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
 	"github.com/credstack/credstack/sdk/pkg/oauth/client"
 	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
 	"github.com/credstack/credstack/sdk/pkg/oauth/token"
@@ -36,6 +37,12 @@ var ErrServerAlreadyExists = credstackError.NewError(409, "SERVER_ALREADY_EXIST"
 // ErrServerDoesNotExist - Provides a named error for when you try and fetch an API with a domain that does not exist
 var ErrServerDoesNotExist = credstackError.NewError(404, "SERVER_DOES_NOT_EXIST", "resource_server: Resource Server does not exist under the specified domain")
 
+// ErrUnknownClaimsProfile - Provides a named error for when a Resource Server is updated with a claims profile that does not exist
+var ErrUnknownClaimsProfile = credstackError.NewError(400, "SERVER_UNKNOWN_CLAIMS_PROFILE", "resource_server: The requested claims profile does not exist")
+
+// ErrInvalidEncryptionKey - Provides a named error for when a Resource Server is updated with an encryption key that cannot be used to encrypt tokens
+var ErrInvalidEncryptionKey = credstackError.NewError(400, "SERVER_INVALID_ENCRYPTION_KEY", "resource_server: The encryption key must be an RSA public key of at least 2048 bits with a use of enc and an alg of RSA-OAEP-256")
+
 // ErrServerMissingId - Provides a named error for when you try and insert or fetch an API with no domain or name
 var ErrServerMissingId = credstackError.NewError(400, "SERVER_MISSING_ID", "resource_server: Resource Server is missing a domain identifier or a name")
 
@@ -55,8 +62,18 @@ type ResourceServer struct {
 	// TokenType - The type of tokens that the API should validate
 	TokenType string `json:"token_type" bson:"token_type"`
 
-	// EnforceRBAC - If set to true, then the API will evaluate scopes and roles during validation (and will insert them as claims in the token)
+	// EnforceRBAC - If set to true, then tokens issued on behalf of users are narrowed to the scopes granted to them directly or through their roles, and their roles are inserted as a claim in the token
 	EnforceRBAC bool `json:"enforce_rbac" bson:"enforce_rbac"`
+
+	// ClaimsProfile - Determines which user claims are inserted into access tokens. Can be: minimal (default), standard, full
+	ClaimsProfile string `json:"claims_profile" bson:"claims_profile"`
+
+	// EncryptionKey - The RSA public key of the API. If set, access tokens issued for the API are encrypted with it
+	// (nested JWT), so that their claims are only readable by the API and not by the client or any hop in between
+	EncryptionKey *jwk.JSONWebKey `json:"encryption_key,omitempty" bson:"encryption_key,omitempty"`
+
+	// ClaimMappings - Custom claims inserted into access tokens issued for the API, in addition to the claims of the ClaimsProfile
+	ClaimMappings []claim.Mapping `json:"claim_mappings" bson:"claim_mappings"`
 }
 
 /*
@@ -65,7 +82,54 @@ will be inserted into the generated token. Calling this function alone, does not
 generates the token. An instantiated server structure needs to be passed here to ensure that we can fetch the current
 active encryption key for token signing (RS256)
 */
-func (api *ResourceServer) GenerateToken(serv *server.Server, application *client.Client, claims jwt.RegisteredClaims) (*token.Token, error) {
+func (api *ResourceServer) GenerateToken(serv *server.Server, application *client.Client, claims jwt.Claims) (*token.Token, error) {
+	tok, err := api.signToken(serv, application, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		The client ID is recorded on the token so that it can be returned from introspection, and so that every token
+		issued to a client can be revoked at once. The audience is recorded so that refresh tokens can only be redeemed
+		for the ResourceServer they were issued for
+	*/
+	tok.ClientId = application.ClientId
+	tok.Audience = api.Audience
+
+	if api.EncryptionKey != nil {
+		tok.SignedToken = tok.AccessToken
+
+		tok.AccessToken, err = token.Encrypt(tok.SignedToken, api.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tok, nil
+}
+
+/*
+ValidateEncryptionKey - Ensures that the key provided in the parameter can be used to encrypt access tokens. The key
+must be an RSA public key of at least 2048 bits. Its use and alg are optional, but if they are set then they must be enc
+and RSA-OAEP-256. If the key is invalid, then ErrInvalidEncryptionKey is returned
+*/
+func ValidateEncryptionKey(key *jwk.JSONWebKey) error {
+	if key.Kty != "RSA" || (key.Use != "" && key.Use != "enc") || (key.Alg != "" && key.Alg != token.KeyAlgRSAOAEP256) {
+		return ErrInvalidEncryptionKey
+	}
+
+	public, err := key.RSA()
+	if err != nil || public.N.BitLen() < 2048 {
+		return ErrInvalidEncryptionKey
+	}
+
+	return nil
+}
+
+/*
+signToken - Signs the claims with the key for the ResourceServer's token type
+*/
+func (api *ResourceServer) signToken(serv *server.Server, application *client.Client, claims jwt.Claims) (*token.Token, error) {
 	switch api.TokenType {
 	case "RS256":
 		privateKey, err := jwk.ActiveKey(serv, api.TokenType, api.Audience)
@@ -73,14 +137,14 @@ func (api *ResourceServer) GenerateToken(serv *server.Server, application *clien
 			return nil, err
 		}
 
-		tok, err := token.RS256(privateKey, claims, uint32(application.TokenLifetime))
+		tok, err := token.RS256(serv, privateKey, claims, uint32(application.TokenLifetime))
 		if err != nil {
 			return nil, err
 		}
 
 		return tok, nil
 	case "HS256":
-		tok, err := token.HS256(application.ClientSecret, claims, uint32(application.TokenLifetime))
+		tok, err := token.HS256(application.SigningKey(), claims, uint32(application.TokenLifetime))
 		if err != nil {
 			return nil, err
 		}
@@ -124,11 +188,13 @@ func New(serv *server.Server, name string, audience string, tokenType string) er
 		tokens. Additionally, we have an enum defined for our tokenType which enforces validation for it
 	*/
 	newApi := &ResourceServer{
-		Header:      header.New(audience),
-		Name:        name,
-		Audience:    audience,
-		TokenType:   tokenType,
-		EnforceRBAC: false,
+		Header:        header.New(audience),
+		Name:          name,
+		Audience:      audience,
+		TokenType:     tokenType,
+		EnforceRBAC:   false,
+		ClaimsProfile: claim.ProfileMinimal,
+		ClaimMappings: make([]claim.Mapping, 0),
 	}
 
 	/*
@@ -143,7 +209,7 @@ func New(serv *server.Server, name string, audience string, tokenType string) er
 		After we build our model, we can consume a single database call to insert our new model. We have unique indexes
 		created on both the domain and header.Identifier fields.
 	*/
-	_, err = serv.Database().Collection("resource_server").InsertOne(context.Background(), newApi)
+	_, err = serv.Database().Collection("resource_server").InsertOne(serv.Context(), newApi)
 	if err != nil {
 		var writeError mongo.WriteException
 		if errors.As(err, &writeError) {
@@ -177,7 +243,7 @@ func Get(serv *server.Server, audience string) (*ResourceServer, error) {
 	}
 
 	result := serv.Database().Collection("resource_server").FindOne(
-		context.Background(),
+		serv.Context(),
 		bson.M{"audience": audience},
 	)
 
@@ -211,8 +277,8 @@ func List(serv *server.Server, limit int) ([]*ResourceServer, error) {
 		limit = 10
 	}
 
-	result, err := serv.Database().Collection("resource_server").Find(
-		context.Background(),
+	result, err := serv.Database().ReadCollection("resource_server", server.ReadClassList).Find(
+		serv.Context(),
 		bson.M{},
 		mongoOpts.Find().SetBatchSize(int32(limit)),
 	)
@@ -222,7 +288,7 @@ func List(serv *server.Server, limit int) ([]*ResourceServer, error) {
 
 	ret := make([]*ResourceServer, 0, limit)
 
-	err = result.All(context.Background(), &ret)
+	err = result.All(serv.Context(), &ret)
 	if err != nil {
 		if !errors.Is(err, mongo.ErrNoDocuments) && err != nil {
 			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
@@ -238,15 +304,36 @@ func List(serv *server.Server, limit int) ([]*ResourceServer, error) {
 
 /*
 Update - Provides functionality for updating the ResourceServer connected to the given domain. Only the
-following fields can be updated here: Name, TokenType, EnforceRBAC, and Applications. To update
-any other fields, you must delete the existing API and then re-create it. The domain field is
+following fields can be updated here: Name, TokenType, EnforceRBAC, ClaimsProfile, EncryptionKey, ClaimMappings, and Applications. To
+update any other fields, you must delete the existing API and then re-create it. The domain field is
 never mutable as this is used as the basis for header.Identifier
+
+To stop encrypting access tokens for the API, update it with an EncryptionKey that has an empty kty. ClaimMappings
+replaces the mappings of the API entirely: a nil ClaimMappings leaves them unchanged, where an empty one removes them all
 */
 func Update(serv *server.Server, audience string, patch *ResourceServer) error {
 	if audience == "" {
 		return ErrServerMissingId
 	}
 
+	if patch.ClaimsProfile != "" && !slices.Contains(claim.Profiles, patch.ClaimsProfile) {
+		return ErrUnknownClaimsProfile
+	}
+
+	if patch.EncryptionKey != nil && patch.EncryptionKey.Kty != "" {
+		err := ValidateEncryptionKey(patch.EncryptionKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	if patch.ClaimMappings != nil {
+		err := claim.ValidateMappings(serv.Config.ClaimConfig, patch.ClaimMappings)
+		if err != nil {
+			return err
+		}
+	}
+
 	/*
 		buildApiPatch - Provides a sub-function to convert the given api model into a bson.M struct that can be
 		provided to mongo.UpdateOne. Only specified fields are supported in this function, so not all are included
@@ -262,13 +349,30 @@ func Update(serv *server.Server, audience string, patch *ResourceServer) error {
 			update["name"] = patch.Name
 		}
 
+		if patch.ClaimsProfile != "" {
+			update["claims_profile"] = patch.ClaimsProfile
+		}
+
+		if patch.EncryptionKey != nil && patch.EncryptionKey.Kty != "" {
+			update["encryption_key"] = patch.EncryptionKey
+		}
+
+		if patch.ClaimMappings != nil {
+			update["claim_mappings"] = patch.ClaimMappings
+		}
+
 		return update
 	}
 
+	operations := bson.M{"$set": buildApiPatch(patch)}
+	if patch.EncryptionKey != nil && patch.EncryptionKey.Kty == "" {
+		operations["$unset"] = bson.M{"encryption_key": ""}
+	}
+
 	result, err := serv.Database().Collection("resource_server").UpdateOne(
-		context.Background(),
+		serv.Context(),
 		bson.M{"audience": audience},
-		bson.M{"$set": buildApiPatch(patch)},
+		operations,
 	)
 
 	if err != nil {
@@ -282,18 +386,37 @@ func Update(serv *server.Server, audience string, patch *ResourceServer) error {
 	return nil
 }
 
+func init() {
+	gate.Register(gate.ActionResourceServerDelete, deleteServer)
+}
+
 /*
-Delete - Completely removes the API from Credstack. A valid, non-empty domain must be provided here
-to serve as the lookup key. If DeletedCount == 0 here, then the API is considered not to exist. Any other errors here
-are propagated through the error return type
+Delete - Completely removes the API from Credstack, along with the scopes registered on it. A valid, non-empty domain must
+be provided here to serve as the lookup key. If DeletedCount == 0 here, then the API is considered not to exist. Any other
+errors here are propagated through the error return type. If deleting resource servers requires approval, then
+gate.ErrApprovalRequired is returned instead, and the API must be deleted by approving a resource_server.delete approval
 */
 func Delete(serv *server.Server, audience string) error {
+	err := gate.Check(serv, gate.ActionResourceServerDelete)
+	if err != nil {
+		return err
+	}
+
+	return deleteServer(serv, audience)
+}
+
+/*
+deleteServer - Provides the logic for Delete without checking for approval. This is what is executed once a
+resource_server.delete approval has been approved. The scopes registered on the API are removed along with it, so that
+they are not inherited by an API that is later created with the same audience.
+*/
+func deleteServer(serv *server.Server, audience string) error {
 	if audience == "" {
 		return ErrServerMissingId
 	}
 
 	result, err := serv.Database().Collection("resource_server").DeleteOne(
-		context.Background(),
+		serv.Context(),
 		bson.M{"audience": audience},
 	)
 
@@ -305,5 +428,10 @@ func Delete(serv *server.Server, audience string) error {
 		return ErrServerDoesNotExist
 	}
 
+	_, err = serv.Database().Collection("scope").DeleteMany(serv.Context(), bson.M{"audience": audience})
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
 	return nil
 }
@@ -0,0 +1,429 @@
+package scope
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/resourceserver"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+/*
+Reserved - The scopes that credstack defines itself: openid, offline_access, and the OpenID Connect scopes that grant
+access to user claims. These can always be requested, and cannot be registered on a resource server
+*/
+var Reserved = append([]string{"openid", "offline_access"}, claim.ClaimScopes...)
+
+// ErrScopeAlreadyExists - Provides a named error for when a scope is registered twice for the same resource server
+var ErrScopeAlreadyExists = credstackError.NewError(409, "SCOPE_ALREADY_EXISTS", "scope: Scope already exists for the specified audience")
+
+// ErrScopeDoesNotExist - Provides a named error for when a scope cannot be found
+var ErrScopeDoesNotExist = credstackError.NewError(404, "SCOPE_DOES_NOT_EXIST", "scope: Scope does not exist for the specified audience")
+
+// ErrScopeMissingId - Provides a named error for when a scope is fetched, updated, or deleted without an audience or name
+var ErrScopeMissingId = credstackError.NewError(400, "SCOPE_MISSING_ID", "scope: Scope is missing an audience or a name")
+
+// ErrInvalidScopeName - Provides a named error for when a scope is registered with a name that cannot be requested
+var ErrInvalidScopeName = credstackError.NewError(400, "SCOPE_INVALID_NAME", "scope: Scope names must not contain whitespace, quotes, or backslashes, and must not be a reserved scope")
+
+/*
+ErrInvalidScope - Returned when a token is requested with a scope that is not registered on the resource server. Uses the
+error code defined in RFC 6749 section 5.2, as it is returned from the token endpoint
+*/
+var ErrInvalidScope = credstackError.NewError(400, "invalid_scope", "token: The requested scope is not registered for the audience")
+
+/*
+Scope - Represents a permission that a resource server defines, and that clients can request in tokens issued for it
+*/
+type Scope struct {
+	// Header - The header for the Scope. Created at object birth
+	Header *header.Header `json:"header" bson:"header"`
+
+	// Name - The name of the scope, as it is requested and inserted into tokens (read:orders)
+	Name string `json:"name" bson:"name"`
+
+	// Description - A human-readable explanation of what the scope grants access to, for developers
+	Description string `json:"description" bson:"description"`
+
+	// ConsentText - The text shown to users when a client requests the scope (Read your orders). Published in the scope catalog
+	ConsentText string `json:"consent_text" bson:"consent_text"`
+
+	// Audience - The audience of the resource server the scope belongs to
+	Audience string `json:"audience" bson:"audience"`
+}
+
+/*
+validName - Determines if the name provided in the parameter can be used as a scope. Names must only use the characters
+allowed in a scope-token (RFC 6749 section 3.3), and must not be reserved
+*/
+func validName(name string) bool {
+	if name == "" || slices.Contains(Reserved, name) {
+		return false
+	}
+
+	for _, c := range name {
+		if c <= 0x20 || c == '"' || c == '\\' || c >= 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+New - Registers a new scope on the resource server identified by its audience. The resource server must exist, and the
+name must be unique among the scopes registered on it. The header of the scope is always overwritten
+*/
+func New(serv *server.Server, scope *Scope) error {
+	if scope.Audience == "" {
+		return ErrScopeMissingId
+	}
+
+	if !validName(scope.Name) {
+		return ErrInvalidScopeName
+	}
+
+	_, err := resourceserver.Get(serv, scope.Audience)
+	if err != nil {
+		return err
+	}
+
+	/*
+		The same name can be registered on more than one resource server, so the audience is included in the basis to
+		keep the identifier unique
+	*/
+	scope.Header = header.New(scope.Audience + " " + scope.Name)
+
+	_, err = serv.Database().Collection("scope").InsertOne(serv.Context(), scope)
+	if err != nil {
+		var writeError mongo.WriteException
+		if errors.As(err, &writeError) {
+			if writeError.HasErrorCode(11000) {
+				return ErrScopeAlreadyExists
+			}
+		}
+
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return nil
+}
+
+/*
+Get - Fetches a scope registered on the resource server identified by its audience. If the scope does not exist, then
+ErrScopeDoesNotExist is returned
+*/
+func Get(serv *server.Server, audience string, name string) (*Scope, error) {
+	if audience == "" || name == "" {
+		return nil, ErrScopeMissingId
+	}
+
+	result := serv.Database().Collection("scope").FindOne(serv.Context(), bson.M{"audience": audience, "name": name})
+
+	var ret Scope
+
+	err := result.Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrScopeDoesNotExist
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+List - Lists the scopes registered on the resource server identified by its audience, sorted by name. The maximum that
+can be returned in a single call is 10, and if a limit exceeds this, it will be reset to 10
+*/
+func List(serv *server.Server, audience string, limit int) ([]*Scope, error) {
+	if audience == "" {
+		return nil, ErrScopeMissingId
+	}
+
+	if limit > 10 || limit <= 0 {
+		limit = 10
+	}
+
+	result, err := serv.Database().ReadCollection("scope", server.ReadClassList).Find(
+		serv.Context(),
+		bson.M{"audience": audience},
+		mongoOpts.Find().SetLimit(int64(limit)).SetSort(bson.D{{Key: "name", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := make([]*Scope, 0, limit)
+
+	err = result.All(serv.Context(), &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return ret, nil
+}
+
+/*
+Update - Updates a scope registered on the resource server identified by its audience. Only the Description and the
+ConsentText can be updated here, as the name is requested by clients and is the basis for header.Identifier. Empty fields
+are left unchanged. To rename a scope, delete it and register it again
+*/
+func Update(serv *server.Server, audience string, name string, patch *Scope) error {
+	if audience == "" || name == "" {
+		return ErrScopeMissingId
+	}
+
+	update := make(bson.M)
+
+	if patch.Description != "" {
+		update["description"] = patch.Description
+	}
+
+	if patch.ConsentText != "" {
+		update["consent_text"] = patch.ConsentText
+	}
+
+	if len(update) == 0 {
+		return nil
+	}
+
+	result, err := serv.Database().Collection("scope").UpdateOne(
+		serv.Context(),
+		bson.M{"audience": audience, "name": name},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrScopeDoesNotExist
+	}
+
+	return nil
+}
+
+/*
+Delete - Removes a scope from the resource server identified by its audience, so that it can no longer be requested.
+Tokens that were already issued with it are not affected. If the scope does not exist, then ErrScopeDoesNotExist is
+returned
+*/
+func Delete(serv *server.Server, audience string, name string) error {
+	if audience == "" || name == "" {
+		return ErrScopeMissingId
+	}
+
+	result, err := serv.Database().Collection("scope").DeleteOne(serv.Context(), bson.M{"audience": audience, "name": name})
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrScopeDoesNotExist
+	}
+
+	return nil
+}
+
+/*
+Validate - Ensures that every scope in the space separated scope string provided in the parameter can be requested for
+the resource server identified by its audience. Reserved scopes can always be requested. Every other scope must be
+registered on the resource server, or ErrInvalidScope is returned.
+
+Resource servers that have no scopes registered are not validated, so that deployments that predate scope management
+keep working until they register their scopes
+*/
+func Validate(serv *server.Server, audience string, requested string) error {
+	custom := slices.DeleteFunc(strings.Fields(requested), func(name string) bool {
+		return slices.Contains(Reserved, name)
+	})
+
+	if len(custom) == 0 {
+		return nil
+	}
+
+	found, err := Registered(serv, audience, custom)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range custom {
+		if !slices.Contains(found, name) {
+			return fmt.Errorf("%w (%s)", ErrInvalidScope, name)
+		}
+	}
+
+	return nil
+}
+
+/*
+Registered - Returns the names provided in the parameter that are registered as scopes on the resource server identified
+by its audience, in the order they were provided. If the resource server has no scopes registered, then every name is
+returned, as scopes are not enforced for it
+*/
+func Registered(serv *server.Server, audience string, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	registered, err := serv.Database().Collection("scope").CountDocuments(
+		serv.Context(),
+		bson.M{"audience": audience},
+		mongoOpts.Count().SetLimit(1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if registered == 0 {
+		return names, nil
+	}
+
+	result := serv.Database().Collection("scope").Distinct(
+		serv.Context(),
+		"name",
+		bson.M{"audience": audience, "name": bson.M{"$in": names}},
+	)
+
+	var found []string
+
+	err = result.Decode(&found)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+		return !slices.Contains(found, name)
+	}), nil
+}
+
+/*
+Resolve - Applies the default and forced scopes of a client to the space separated scope string provided in the
+parameter. If no scope was requested, then the default scopes are used. The forced scopes are always appended. Default
+and forced scopes that are not registered on the resource server identified by its audience are skipped, so that a client
+can be given scopes for more than one resource server. Returns the space separated scope string to issue the token with
+*/
+func Resolve(serv *server.Server, audience string, requested string, defaults []string, forced []string) (string, error) {
+	added := forced
+	if strings.TrimSpace(requested) == "" {
+		added = append(slices.Clone(defaults), forced...)
+	}
+
+	if len(added) == 0 {
+		return requested, nil
+	}
+
+	custom := slices.DeleteFunc(slices.Clone(added), func(name string) bool {
+		return slices.Contains(Reserved, name)
+	})
+
+	permitted, err := Registered(serv, audience, custom)
+	if err != nil {
+		return "", err
+	}
+
+	ret := strings.Fields(requested)
+	for _, name := range added {
+		if slices.Contains(ret, name) {
+			continue
+		}
+
+		if slices.Contains(Reserved, name) || slices.Contains(permitted, name) {
+			ret = append(ret, name)
+		}
+	}
+
+	return strings.Join(ret, " "), nil
+}
+
+/*
+Catalog - Returns the scopes registered on every resource server, grouped by resource server, so that they can be
+published. If an audience is provided, then only the scopes of that resource server are returned. Resource servers that
+have no scopes registered are omitted, as there is nothing to describe for them
+*/
+func Catalog(serv *server.Server, audience string) (*response.ScopeCatalog, error) {
+	filter := bson.M{}
+	if audience != "" {
+		filter["audience"] = audience
+	}
+
+	result, err := serv.Database().ReadCollection("scope", server.ReadClassList).Find(
+		serv.Context(),
+		filter,
+		mongoOpts.Find().SetSort(bson.D{{Key: "audience", Value: 1}, {Key: "name", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var scopes []*Scope
+
+	err = result.All(serv.Context(), &scopes)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := &response.ScopeCatalog{ResourceServers: []response.ResourceServerScopes{}}
+
+	audiences := []string{}
+	for _, registered := range scopes {
+		last := len(ret.ResourceServers) - 1
+		if last < 0 || ret.ResourceServers[last].Audience != registered.Audience {
+			ret.ResourceServers = append(ret.ResourceServers, response.ResourceServerScopes{Audience: registered.Audience, Scopes: []response.ScopeMetadata{}})
+			audiences = append(audiences, registered.Audience)
+			last++
+		}
+
+		ret.ResourceServers[last].Scopes = append(ret.ResourceServers[last].Scopes, response.ScopeMetadata{
+			Name:        registered.Name,
+			Description: registered.Description,
+			ConsentText: registered.ConsentText,
+		})
+	}
+
+	if len(audiences) == 0 {
+		return ret, nil
+	}
+
+	/*
+		The names of the resource servers are fetched with a single query, projected to the only fields the catalog
+		publishes, so that nothing else about a resource server is ever exposed here
+	*/
+	result, err = serv.Database().ReadCollection("resource_server", server.ReadClassList).Find(
+		serv.Context(),
+		bson.M{"audience": bson.M{"$in": audiences}},
+		mongoOpts.Find().SetProjection(bson.M{"audience": 1, "name": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var names []response.ResourceServerScopes
+
+	err = result.All(serv.Context(), &names)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	for _, named := range names {
+		for i := range ret.ResourceServers {
+			if ret.ResourceServers[i].Audience == named.Audience {
+				ret.ResourceServers[i].Name = named.Name
+			}
+		}
+	}
+
+	return ret, nil
+}
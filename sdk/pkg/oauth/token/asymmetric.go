@@ -0,0 +1,51 @@
+package token
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/*
+signAsymmetric - Signs a token with the private key provided in the parameter, through its jwk.Signer. The signature is
+computed here rather than with jwt.Token.SignedString, as SignedString requires the private key itself, which keys that
+live in an external signing backend never expose
+*/
+func signAsymmetric(serv *server.Server, key *jwk.PrivateJSONWebKey, method jwt.SigningMethod, claims jwt.Claims, expiresIn uint32) (*Token, error) {
+	generatedJwt := jwt.NewWithClaims(method, claims)
+	generatedJwt.Header["kid"] = key.Header.Identifier
+
+	signer, err := key.Signer(serv)
+	if err != nil {
+		return nil, err
+	}
+
+	signingString, err := generatedJwt.SigningString()
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrFailedToSignToken, err)
+	}
+
+	digest := sha256.Sum256([]byte(signingString))
+
+	sig, err := signer.Sign(digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrFailedToSignToken, err)
+	}
+
+	/*
+		Marshal the generated JWT into a structure that we can actually store in the database
+	*/
+	subject, _ := claims.GetSubject()
+
+	token := &Token{
+		Subject:     subject,
+		AccessToken: signingString + "." + generatedJwt.EncodeSegment(sig),
+		ExpiresIn:   expiresIn,
+		ExpiresAt:   expiresAt(claims),
+	}
+
+	return token, nil
+}
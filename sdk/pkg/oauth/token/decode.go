@@ -0,0 +1,294 @@
+package token
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// SignatureValid - The signature was verified against the key published in the JWKS
+	SignatureValid = "valid"
+
+	// SignatureInvalid - The signature does not match the key published in the JWKS under the token's kid
+	SignatureInvalid = "invalid"
+
+	// SignatureUnverified - The signature could not be checked (unknown kid, HS256, or verification was not requested)
+	SignatureUnverified = "unverified"
+)
+
+/*
+Problem codes reported by Decode. These are stable, so that scripts can match on them
+*/
+const (
+	// ProblemMalformed - The token, or one of its registered claims, could not be decoded
+	ProblemMalformed = "malformed"
+
+	// ProblemEncrypted - The token is encrypted for its audience, and no decryption key was provided
+	ProblemEncrypted = "encrypted"
+
+	// ProblemUndecryptable - The token is encrypted, and could not be decrypted with the decryption key provided
+	ProblemUndecryptable = "undecryptable"
+
+	// ProblemMissingKid - The header has no kid, so the signing key cannot be found
+	ProblemMissingKid = "missing_kid"
+
+	// ProblemUnknownKid - No key is published in the JWKS under the token's kid
+	ProblemUnknownKid = "unknown_kid"
+
+	// ProblemAlgMismatch - The alg in the header does not match the algorithm of the key published under the kid
+	ProblemAlgMismatch = "alg_mismatch"
+
+	// ProblemSymmetric - The token is signed with HS256, which cannot be verified against the JWKS
+	ProblemSymmetric = "symmetric_alg"
+
+	// ProblemInvalidSignature - The signature does not match the key published under the kid
+	ProblemInvalidSignature = "invalid_signature"
+
+	// ProblemJWKSUnavailable - The JWKS could not be read from the database
+	ProblemJWKSUnavailable = "jwks_unavailable"
+
+	// ProblemExpired - The exp claim has passed
+	ProblemExpired = "expired"
+
+	// ProblemNotYetValid - The nbf claim has not passed yet
+	ProblemNotYetValid = "not_yet_valid"
+
+	// ProblemIssuedInFuture - The iat claim is in the future
+	ProblemIssuedInFuture = "issued_in_future"
+
+	// ProblemWrongAudience - The aud claim does not contain the expected audience
+	ProblemWrongAudience = "wrong_audience"
+
+	// ProblemWrongIssuer - The iss claim is not the expected issuer
+	ProblemWrongIssuer = "wrong_issuer"
+)
+
+/*
+DecodeOptions - Controls which checks Decode performs
+*/
+type DecodeOptions struct {
+	// Audience - The audience the token is expected to be issued for. If empty, the audience is not checked
+	Audience string
+
+	// Issuer - The issuer the token is expected to be issued by. If empty, the issuer is not checked
+	Issuer string
+
+	// Verify - If set to true, the signature is verified against the JWKS. This requires a connection to the database
+	Verify bool
+
+	// DecryptionKey - The private key of the audience, used to unwrap encrypted access tokens (nested JWTs) before they
+	// are decoded. If nil, encrypted tokens are reported with the encrypted problem
+	DecryptionKey *rsa.PrivateKey
+}
+
+/*
+DecodeProblem - Explains a single reason a token would be rejected by a relying party
+*/
+type DecodeProblem struct {
+	// Code - A stable identifier for the problem (expired, unknown_kid)
+	Code string `json:"code" yaml:"code"`
+
+	// Message - A human-readable explanation of the problem, and how it can be resolved
+	Message string `json:"message" yaml:"message"`
+}
+
+/*
+Decoded - The result of decoding and checking a JWT. This is intended for debugging integrations, and should not be used
+to authorize requests
+*/
+type Decoded struct {
+	// Encrypted - If set to true, the token was encrypted for its audience. The header, claims, and signature are those
+	// of the signed token inside it
+	Encrypted bool `json:"encrypted" yaml:"encrypted"`
+
+	// Header - The decoded JOSE header of the token
+	Header map[string]any `json:"header" yaml:"header"`
+
+	// Claims - The decoded claims of the token
+	Claims map[string]any `json:"claims" yaml:"claims"`
+
+	// Signature - The outcome of verifying the signature. One of: valid, invalid, unverified
+	Signature string `json:"signature" yaml:"signature"`
+
+	// Problems - Every reason a relying party would reject the token. Empty if the token is valid
+	Problems []DecodeProblem `json:"problems" yaml:"problems"`
+}
+
+/*
+Valid - Returns true if the signature was verified and no problems were found
+*/
+func (decoded *Decoded) Valid() bool {
+	return decoded.Signature == SignatureValid && len(decoded.Problems) == 0
+}
+
+/*
+problem - Records a problem with the token
+*/
+func (decoded *Decoded) problem(code string, format string, args ...any) {
+	decoded.Problems = append(decoded.Problems, DecodeProblem{Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+/*
+Decode - Decodes the JWT provided in the parameter, and explains every reason a relying party would reject it: an
+expired or not yet valid token (according to the server's clock), an unexpected audience or issuer, and, if Verify is
+set, a kid that is not published in the JWKS or a signature that does not match it. Unlike validation, every check is
+performed even after one fails, so that all the problems are reported at once.
+
+Tokens that cannot be decoded are reported with the malformed problem, and a JWKS that cannot be read is reported with
+the jwks_unavailable problem, so that the claims are always returned if they can be decoded. Encrypted tokens are
+unwrapped with DecryptionKey first, and the signed token inside them is decoded instead
+*/
+func Decode(serv *server.Server, raw string, opts DecodeOptions) *Decoded {
+	decoded := &Decoded{
+		Header:    map[string]any{},
+		Claims:    map[string]any{},
+		Signature: SignatureUnverified,
+		Problems:  []DecodeProblem{},
+	}
+
+	if IsEncrypted(raw) {
+		decoded.Encrypted = true
+
+		if opts.DecryptionKey == nil {
+			decoded.problem(ProblemEncrypted, "The token is encrypted for its audience. Provide the audience's private key to decrypt it")
+			return decoded
+		}
+
+		signed, err := Decrypt(raw, opts.DecryptionKey)
+		if err != nil {
+			decoded.problem(ProblemUndecryptable, "The token could not be decrypted. It was encrypted for a different key, or has been modified: %v", err)
+			return decoded
+		}
+
+		raw = signed
+	}
+
+	claims := jwt.MapClaims{}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(raw, claims)
+	if err != nil {
+		decoded.problem(ProblemMalformed, "The token could not be decoded as a JWT: %v", err)
+		return decoded
+	}
+
+	decoded.Header = parsed.Header
+	decoded.Claims = claims
+
+	checkTimes(serv, decoded, claims)
+	checkAudience(decoded, claims, opts)
+
+	if opts.Verify {
+		verifySignature(serv, decoded, raw)
+	}
+
+	return decoded
+}
+
+/*
+checkTimes - Checks the exp, nbf, and iat claims against the server's clock. No leeway is applied, so that tokens that
+are close to being rejected are reported as well
+*/
+func checkTimes(serv *server.Server, decoded *Decoded, claims jwt.MapClaims) {
+	now := serv.Clock().Now()
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil {
+		decoded.problem(ProblemMalformed, "The exp claim is not a valid NumericDate: %v", err)
+	} else if exp != nil && !now.Before(exp.Time) {
+		decoded.problem(ProblemExpired, "The token expired at %s (%s ago)", exp.UTC().Format(time.RFC3339), now.Sub(exp.Time).Round(time.Second))
+	}
+
+	nbf, err := claims.GetNotBefore()
+	if err != nil {
+		decoded.problem(ProblemMalformed, "The nbf claim is not a valid NumericDate: %v", err)
+	} else if nbf != nil && now.Before(nbf.Time) {
+		decoded.problem(ProblemNotYetValid, "The token is not valid until %s (in %s). Check for clock skew between the issuer and this host", nbf.UTC().Format(time.RFC3339), nbf.Sub(now).Round(time.Second))
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil {
+		decoded.problem(ProblemMalformed, "The iat claim is not a valid NumericDate: %v", err)
+	} else if iat != nil && now.Before(iat.Time) {
+		decoded.problem(ProblemIssuedInFuture, "The token was issued at %s, which is %s in the future. Check for clock skew between the issuer and this host", iat.UTC().Format(time.RFC3339), iat.Sub(now).Round(time.Second))
+	}
+}
+
+/*
+checkAudience - Checks the aud and iss claims against the values that are expected in the options
+*/
+func checkAudience(decoded *Decoded, claims jwt.MapClaims, opts DecodeOptions) {
+	if opts.Audience != "" {
+		aud, err := claims.GetAudience()
+		if err != nil {
+			decoded.problem(ProblemMalformed, "The aud claim is not a string or an array of strings: %v", err)
+		} else if !slices.Contains(aud, opts.Audience) {
+			decoded.problem(ProblemWrongAudience, "The token was issued for %v, not %s. Request the token with audience=%s", []string(aud), opts.Audience, opts.Audience)
+		}
+	}
+
+	if opts.Issuer != "" {
+		iss, _ := claims.GetIssuer()
+		if iss != opts.Issuer {
+			decoded.problem(ProblemWrongIssuer, "The token was issued by %q, not %q. Check that the relying party is configured with the issuer from the discovery document", iss, opts.Issuer)
+		}
+	}
+}
+
+/*
+verifySignature - Finds the key the token was signed with in the JWKS using the kid in its header, and verifies the
+signature with it. Only the signature is checked here, as the claims are checked separately
+*/
+func verifySignature(serv *server.Server, decoded *Decoded, raw string) {
+	alg, _ := decoded.Header["alg"].(string)
+
+	if alg == "HS256" {
+		decoded.problem(ProblemSymmetric, "HS256 tokens are signed with the client secret of the client they were issued to, and are not published in the JWKS, so the signature cannot be verified here")
+		return
+	}
+
+	kid, _ := decoded.Header["kid"].(string)
+	if kid == "" {
+		decoded.problem(ProblemMissingKid, "The token has no kid in its header, so the key it was signed with cannot be found in the JWKS")
+		return
+	}
+
+	public, err := jwk.Get(serv, kid)
+	if err != nil {
+		if errors.Is(err, jwk.ErrKeyNotExist) {
+			decoded.problem(ProblemUnknownKid, "No key with kid %s is published in the JWKS. The token was not issued by this deployment, or its key was revoked", kid)
+			return
+		}
+
+		decoded.problem(ProblemJWKSUnavailable, "The JWKS could not be read: %v", err)
+		return
+	}
+
+	if public.Alg != alg {
+		decoded.problem(ProblemAlgMismatch, "The token claims to be signed with %s, but the key with kid %s is a %s key", alg, kid, public.Alg)
+		decoded.Signature = SignatureInvalid
+		return
+	}
+
+	_, err = jwt.Parse(
+		raw,
+		func(*jwt.Token) (any, error) {
+			return public.PublicKey()
+		},
+		jwt.WithValidMethods([]string{public.Alg}),
+		jwt.WithoutClaimsValidation(),
+	)
+	if err != nil {
+		decoded.problem(ProblemInvalidSignature, "The signature does not match the key with kid %s. The token has been modified, or was signed by a different key with the same kid: %v", kid, err)
+		decoded.Signature = SignatureInvalid
+		return
+	}
+
+	decoded.Signature = SignatureValid
+}
@@ -0,0 +1,16 @@
+package token
+
+import (
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+/*
+ES256 - Generates arbitrary ES256 tokens with the claims that are passed as an argument to this function. Like RS256,
+the KID of the key is inserted into the header so that validators can find the public key in the JWKS. This function
+doesn't provide logic for storing the token, and is completely unaware of OAuth authentication flows
+*/
+func ES256(serv *server.Server, ecKey *jwk.PrivateJSONWebKey, claims jwt.Claims, expiresIn uint32) (*Token, error) {
+	return signAsymmetric(serv, ecKey, jwt.SigningMethodES256, claims, expiresIn)
+}
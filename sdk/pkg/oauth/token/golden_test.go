@@ -0,0 +1,60 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/credstack/credstack/sdk/internal/golden"
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+/*
+newGoldenServer - Constructs a server with a clock fixed at golden.Epoch, so that the claims of every token are the same
+on every run. The server is never started, as signing does not touch the database. The clock is restored once the test
+completes, as the server also sets it on the header package
+*/
+func newGoldenServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	golden.Deterministic(t)
+
+	serv := server.New(config.New())
+	serv.SetClock(golden.Clock())
+	t.Cleanup(func() { serv.SetClock(clock.System) })
+
+	return serv
+}
+
+func TestHS256Golden(t *testing.T) {
+	serv := newGoldenServer(t)
+
+	claims := claim.NewClaimsWithSubject(serv.Clock(), "https://credstack.test", "https://api.credstack.test", "golden-subject", 3600)
+
+	tok, err := HS256([]byte("golden-client-secret"), claims, 3600)
+	if err != nil {
+		t.Fatalf("HS256: %v", err)
+	}
+
+	golden.Assert(t, "hs256", []byte(tok.AccessToken+"\n"))
+}
+
+func TestRS256Golden(t *testing.T) {
+	serv := newGoldenServer(t)
+
+	key, _, err := jwk.NewPrivateKeyFromRSA(golden.RSAKey(t), "https://api.credstack.test")
+	if err != nil {
+		t.Fatalf("NewPrivateKeyFromRSA: %v", err)
+	}
+
+	claims := claim.NewClaimsWithSubject(serv.Clock(), "https://credstack.test", "https://api.credstack.test", "golden-subject", 3600)
+
+	tok, err := RS256(serv, key, claims, 3600)
+	if err != nil {
+		t.Fatalf("RS256: %v", err)
+	}
+
+	golden.Assert(t, "rs256", []byte(tok.AccessToken+"\n"))
+}
@@ -0,0 +1,136 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrBatchTooLarge - An error that gets returned when more tokens are introspected at once than IntrospectionConfig.MaxBatchSize allows
+var ErrBatchTooLarge = credstackError.NewError(413, "ERR_BATCH_TOO_LARGE", "token: Too many tokens were provided in a single introspection request")
+
+// ErrEmptyBatch - An error that gets returned when an introspection request does not contain any tokens
+var ErrEmptyBatch = credstackError.NewError(400, "ERR_EMPTY_BATCH", "token: At least one token must be provided for introspection")
+
+/*
+Introspect - Determines the status of the token provided in the parameter (RFC 7662). Access tokens are looked up first,
+and if no access token matches, the token is looked up as a refresh token. An access token is active if it exists in the
+database, has not been revoked, and has not expired according to the servers clock. A refresh token is active if it
+has additionally not been redeemed. Tokens that are not active only return the active field
+*/
+func Introspect(serv *server.Server, tok string) (*response.IntrospectionResponse, error) {
+	if tok == "" {
+		return &response.IntrospectionResponse{Active: false}, nil
+	}
+
+	var issued Token
+
+	err := serv.Database().Collection("token").FindOne(serv.Context(), bson.M{"access_token": tok}).Decode(&issued)
+	if err == nil {
+		return accessTokenStatus(serv, &issued), nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	err = serv.Database().Collection("token").FindOne(
+		serv.Context(),
+		bson.M{
+			"refresh_token":      tok,
+			"refresh_consumed":   bson.M{"$ne": true},
+			"revoked":            bson.M{"$ne": true},
+			"refresh_expires_at": bson.M{"$gt": serv.Clock().Now()},
+		},
+	).Decode(&issued)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &response.IntrospectionResponse{Active: false}, nil
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &response.IntrospectionResponse{
+		Active:   true,
+		Scope:    issued.Scope,
+		ClientId: issued.ClientId,
+		Exp:      issued.RefreshExpiresAt.Unix(),
+		Sub:      issued.Subject,
+	}, nil
+}
+
+/*
+IntrospectBatch - Determines the status of each of the access tokens provided in the parameter, and returns them in the
+same order. All tokens are fetched with a single database call, so that API gateways validating many tokens can amortize
+the cost of each request. Only access tokens can be introspected in a batch. If more tokens are provided than
+IntrospectionConfig.MaxBatchSize allows, then ErrBatchTooLarge is returned
+*/
+func IntrospectBatch(serv *server.Server, tokens []string) ([]*response.IntrospectionResponse, error) {
+	if len(tokens) == 0 {
+		return nil, ErrEmptyBatch
+	}
+
+	if len(tokens) > serv.Config.IntrospectionConfig.MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	cursor, err := serv.Database().Collection("token").Find(serv.Context(), bson.M{"access_token": bson.M{"$in": tokens}})
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var found []*Token
+
+	err = cursor.All(serv.Context(), &found)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	issued := make(map[string]*Token, len(found))
+	for _, tok := range found {
+		issued[tok.AccessToken] = tok
+	}
+
+	ret := make([]*response.IntrospectionResponse, 0, len(tokens))
+	for _, accessToken := range tokens {
+		tok, ok := issued[accessToken]
+		if !ok {
+			ret = append(ret, &response.IntrospectionResponse{Active: false})
+			continue
+		}
+
+		ret = append(ret, accessTokenStatus(serv, tok))
+	}
+
+	return ret, nil
+}
+
+/*
+accessTokenStatus - Builds the introspection response for an access token that was found in the database. The token is
+inactive if it has been revoked or has expired
+*/
+func accessTokenStatus(serv *server.Server, tok *Token) *response.IntrospectionResponse {
+	if tok.Revoked || tok.Expired(serv.Clock(), 0) {
+		return &response.IntrospectionResponse{Active: false}
+	}
+
+	status := &response.IntrospectionResponse{
+		Active:    true,
+		Scope:     tok.Scope,
+		ClientId:  tok.ClientId,
+		TokenType: "Bearer",
+		Sub:       tok.Subject,
+	}
+
+	if !tok.ExpiresAt.IsZero() {
+		status.Exp = tok.ExpiresAt.Unix()
+	}
+
+	return status
+}
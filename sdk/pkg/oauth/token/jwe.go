@@ -0,0 +1,120 @@
+package token
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/go-jose/go-jose/v4"
+)
+
+const (
+	// KeyAlgRSAOAEP256 - The JWE key management algorithm used to encrypt the content encryption key (RFC 7518 section 4.3)
+	KeyAlgRSAOAEP256 = string(jose.RSA_OAEP_256)
+
+	// ContentEncA256GCM - The JWE content encryption algorithm used to encrypt the signed token (RFC 7518 section 5.3)
+	ContentEncA256GCM = string(jose.A256GCM)
+)
+
+// ErrFailedToEncryptToken - An error that gets wrapped when a signed token cannot be encrypted for its audience
+var ErrFailedToEncryptToken = credstackError.NewError(500, "ERR_FAILED_TO_ENCRYPT", "token: Failed to encrypt token due to an internal error")
+
+// ErrFailedToDecryptToken - An error that gets wrapped when an encrypted token is malformed, or cannot be decrypted with the key provided
+var ErrFailedToDecryptToken = credstackError.NewError(401, "ERR_FAILED_TO_DECRYPT", "token: Failed to decrypt token")
+
+/*
+IsEncrypted - Determines if the token provided in the parameter is a JWE in compact serialization, rather than a signed
+JWT. Encrypted tokens have five segments, where signed tokens have three
+*/
+func IsEncrypted(raw string) bool {
+	return strings.Count(raw, ".") == 4
+}
+
+/*
+Encrypt - Wraps the signed token provided in the parameter in a JWE encrypted with the RSA public key of its audience,
+producing a nested JWT. The content is encrypted with A256GCM under a random key, which is encrypted with RSA-OAEP-256.
+The cty header of JWT marks the plaintext as a nested JWT (RFC 7519 section 5.2), and the signed token is left unchanged
+inside, so the recipient verifies it as usual after decrypting it
+*/
+func Encrypt(signed string, key *jwk.JSONWebKey) (string, error) {
+	public, err := key.RSA()
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", ErrFailedToEncryptToken, err)
+	}
+
+	encrypter, err := jose.NewEncrypter(
+		jose.A256GCM,
+		jose.Recipient{Algorithm: jose.RSA_OAEP_256, Key: public, KeyID: key.Kid},
+		(&jose.EncrypterOptions{}).WithContentType("JWT"),
+	)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", ErrFailedToEncryptToken, err)
+	}
+
+	encrypted, err := encrypter.Encrypt([]byte(signed))
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", ErrFailedToEncryptToken, err)
+	}
+
+	ret, err := encrypted.CompactSerialize()
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", ErrFailedToEncryptToken, err)
+	}
+
+	return ret, nil
+}
+
+/*
+Decrypt - Unwraps a token produced by Encrypt with the RSA private key of the audience, and returns the signed token
+inside it. Only the encryption is removed here, and the signed token must still be verified by the caller. If the token
+is malformed, uses an algorithm other than RSA-OAEP-256 with A256GCM, or was encrypted for a different key, then
+ErrFailedToDecryptToken is returned
+*/
+func Decrypt(raw string, key *rsa.PrivateKey) (string, error) {
+	encrypted, err := jose.ParseEncryptedCompact(
+		raw,
+		[]jose.KeyAlgorithm{jose.RSA_OAEP_256},
+		[]jose.ContentEncryption{jose.A256GCM},
+	)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", ErrFailedToDecryptToken, err)
+	}
+
+	plaintext, err := encrypted.Decrypt(key)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", ErrFailedToDecryptToken, err)
+	}
+
+	return string(plaintext), nil
+}
+
+/*
+ParseDecryptionKey - Parses a PEM encoded RSA private key (PKCS#8 or PKCS#1), so that it can be passed to Decrypt. This
+is the private half of the encryption key registered on a ResourceServer, which credstack itself never holds
+*/
+func ParseDecryptionKey(encoded []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(encoded)
+	if block == nil {
+		return nil, fmt.Errorf("%w (no PEM block found)", ErrFailedToDecryptToken)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrFailedToDecryptToken, err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w (not an RSA private key)", ErrFailedToDecryptToken)
+	}
+
+	return key, nil
+}
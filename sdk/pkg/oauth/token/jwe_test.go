@@ -0,0 +1,61 @@
+package token
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/credstack/credstack/sdk/internal/golden"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/go-jose/go-jose/v4"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := golden.RSAKey(t)
+
+	_, public, err := jwk.NewPrivateKeyFromRSA(key, "https://api.credstack.test")
+	if err != nil {
+		t.Fatalf("NewPrivateKeyFromRSA: %v", err)
+	}
+
+	encrypted, err := Encrypt("header.claims.signature", public)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	if !IsEncrypted(encrypted) {
+		t.Fatalf("expected a compact JWE, got %q", encrypted)
+	}
+
+	decrypted, err := Decrypt(encrypted, key)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+
+	if decrypted != "header.claims.signature" {
+		t.Fatalf("expected the signed token back, got %q", decrypted)
+	}
+}
+
+func TestDecryptRejectsUnlistedAlgorithms(t *testing.T) {
+	key := golden.RSAKey(t)
+
+	encrypter, err := jose.NewEncrypter(jose.A128CBC_HS256, jose.Recipient{Algorithm: jose.RSA1_5, Key: &key.PublicKey}, nil)
+	if err != nil {
+		t.Fatalf("NewEncrypter: %v", err)
+	}
+
+	encrypted, err := encrypter.Encrypt([]byte("header.claims.signature"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	raw, err := encrypted.CompactSerialize()
+	if err != nil {
+		t.Fatalf("CompactSerialize: %v", err)
+	}
+
+	_, err = Decrypt(raw, key)
+	if !errors.Is(err, ErrFailedToDecryptToken) {
+		t.Fatalf("expected ErrFailedToDecryptToken, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrInvalidAccessToken - An error that gets returned when a bearer access token does not exist, has expired, or has been revoked. Uses the error code defined in RFC 6750 section 3.1
+var ErrInvalidAccessToken = credstackError.NewError(401, "invalid_token", "token: The access token is invalid, expired, or revoked")
+
+/*
+Lookup - Fetches the token that the bearer access token provided in the parameter was issued as. Endpoints that are
+called with an access token (userinfo) use this to authenticate the caller. If the token is not active, then
+ErrInvalidAccessToken is returned
+*/
+func Lookup(serv *server.Server, accessToken string) (*Token, error) {
+	if accessToken == "" {
+		return nil, ErrInvalidAccessToken
+	}
+
+	var issued Token
+
+	err := serv.Database().Collection("token").FindOne(serv.Context(), bson.M{"access_token": accessToken}).Decode(&issued)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidAccessToken
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if issued.Revoked || issued.Expired(serv.Clock(), 0) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	return &issued, nil
+}
@@ -0,0 +1,66 @@
+package token
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/query"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+/*
+querySpec - Describes how issued tokens are queried. Tokens are paginated by their object ID, which MongoDB generates
+when they are inserted and which begins with the time they were inserted at, so the time range matches when the token
+was issued. The access, refresh, and ID tokens themselves can never be selected, so that listing tokens never exposes
+credentials
+*/
+var querySpec = &query.Spec{
+	Collection: "token",
+	Fields: []string{
+		"sub",
+		"client_id",
+		"audience",
+		"expires_in",
+		"expires_at",
+		"refresh_expires_at",
+		"refresh_consumed",
+		"family",
+		"scope",
+		"session_id",
+		"revoked",
+	},
+	CursorField: "_id",
+	ParseCursor: func(cursor string) (any, error) {
+		return bson.ObjectIDFromHex(cursor)
+	},
+	FormatCursor: func(value any) (string, error) {
+		id, ok := value.(bson.ObjectID)
+		if !ok {
+			return "", fmt.Errorf("unexpected object ID type: %T", value)
+		}
+
+		return id.Hex(), nil
+	},
+	SubjectField: "sub",
+	TimeField:    "_id",
+	TimeValue: func(t time.Time) any {
+		return bson.NewObjectIDFromTimestamp(t)
+	},
+}
+
+/*
+List - Returns a single page of issued tokens matching the options provided in the parameter, in the order they were
+issued. The subject filter matches Token.Subject, and the time range matches when the token was issued
+*/
+func List(serv *server.Server, opts *query.Options) (*query.Page, error) {
+	return query.List(serv, querySpec, opts)
+}
+
+/*
+Export - Opens a stream of every issued token matching the options provided in the parameter, in the order they were
+issued. See query.Export
+*/
+func Export(serv *server.Server, opts *query.Options) (*query.Stream, error) {
+	return query.Export(serv, querySpec, opts)
+}
@@ -0,0 +1,97 @@
+package token
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/region"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	// TokenTypeHintAccessToken - The token type hint for access tokens (RFC 7009 section 2.1)
+	TokenTypeHintAccessToken string = "access_token"
+
+	// TokenTypeHintRefreshToken - The token type hint for refresh tokens (RFC 7009 section 2.1)
+	TokenTypeHintRefreshToken string = "refresh_token"
+)
+
+// ErrTokenClientMismatch - An error that gets returned when a client attempts to revoke a token that was issued to a different client
+var ErrTokenClientMismatch = credstackError.NewError(403, "ERR_TOKEN_CLIENT_MISMATCH", "token: The token was not issued to the client that attempted to revoke it")
+
+/*
+Revoke - Revokes the access token or refresh token provided in the parameter (RFC 7009). Revoked tokens are kept in the
+database with the revoked flag set, so that introspection reports them as inactive and refresh tokens can no longer be
+redeemed. The token type hint decides which field is checked first, and the other is checked if nothing matches.
+
+Revoking an access token only revokes that token. Revoking a refresh token revokes every token in its family, as RFC
+7009 section 2.1 expects the access tokens issued from the same grant to be invalidated with it.
+
+Tokens can only be revoked by the client they were issued to, so ErrTokenClientMismatch is returned if the token belongs
+to a different client. As required by RFC 7009 section 2.2, a token that does not exist is not considered an error
+*/
+func Revoke(serv *server.Server, tok string, clientId string, tokenTypeHint string) error {
+	if tok == "" {
+		return nil
+	}
+
+	fields := []string{TokenTypeHintAccessToken, TokenTypeHintRefreshToken}
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		fields = []string{TokenTypeHintRefreshToken, TokenTypeHintAccessToken}
+	}
+
+	for _, field := range fields {
+		var issued Token
+
+		err := serv.Database().Collection("token").FindOne(serv.Context(), bson.M{field: tok}).Decode(&issued)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		if issued.ClientId != clientId {
+			return ErrTokenClientMismatch
+		}
+
+		filter := bson.M{field: tok}
+		if field == TokenTypeHintRefreshToken && issued.Family != "" {
+			filter = bson.M{"family": issued.Family}
+		}
+
+		_, err = serv.Database().Collection("token").UpdateMany(
+			serv.Context(),
+			filter,
+			bson.M{"$set": bson.M{"revoked": true}},
+		)
+		if err != nil {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		if _, ok := filter["family"]; ok {
+			region.RecordRevocation(serv, region.RevocationKindFamily, issued.Family, issued.ClientId)
+		} else {
+			region.RecordRevocation(serv, region.RevocationKindToken, HashAccessToken(issued.AccessToken), issued.ClientId)
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+/*
+HashAccessToken - Returns the SHA-256 hash of the access token provided in the parameter, encoded as a hex string. This
+identifies revoked access tokens in the revocation feed without exposing the tokens themselves
+*/
+func HashAccessToken(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,14 +1,19 @@
 package token
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/credstack/credstack/sdk/pkg/approval/gate"
+	"github.com/credstack/credstack/sdk/pkg/clock"
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
 	"github.com/credstack/credstack/sdk/pkg/models/response"
+	"github.com/credstack/credstack/sdk/pkg/region"
+	"github.com/credstack/credstack/sdk/pkg/secret"
 	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
@@ -29,9 +34,16 @@ type Token struct {
 	// ClientId - The client ID of the application that issued the token
 	ClientId string `json:"client_id" bson:"client_id"`
 
+	// Audience - The audience of the ResourceServer the token was issued for
+	Audience string `json:"audience" bson:"audience"`
+
 	// AccessToken - The access token that was issued
 	AccessToken string `json:"access_token" bson:"access_token"`
 
+	// SignedToken - The signed JWT wrapped inside AccessToken when the access token is encrypted for its audience. Empty
+	// if the access token is not encrypted. This is kept so that credstack can read the claims of tokens it cannot decrypt
+	SignedToken string `json:"-" bson:"signed_token,omitempty"`
+
 	// RefreshToken - The refresh token that was issued
 	RefreshToken string `json:"refresh_token" bson:"refresh_token"`
 
@@ -47,8 +59,54 @@ type Token struct {
 	// RefreshExpiresAt - A timestamp that represents the datetime in which the refresh token expires
 	RefreshExpiresAt time.Time `json:"refresh_expires_at" bson:"refresh_expires_at"`
 
+	// RefreshConsumed - If set to true, the refresh token has already been redeemed. It is kept so that reuse can be detected
+	RefreshConsumed bool `json:"refresh_consumed" bson:"refresh_consumed"`
+
+	// Family - Identifies every token that was issued by rotating the same original refresh token. Empty if no refresh token was issued
+	Family string `json:"family" bson:"family"`
+
 	// Scope - Any permission scopes that were issued with the token
 	Scope string `json:"scope" bson:"scope"`
+
+	// SessionId - The identifier of the session the user authorized the client in. Inherited by every token issued by rotating its refresh token or exchanging it. Empty for tokens that were not issued from a browser session
+	SessionId string `json:"session_id" bson:"session_id"`
+
+	// Revoked - If set to true, the token was revoked with Revoke. Revoked tokens are inactive, and their refresh tokens cannot be redeemed
+	Revoked bool `json:"revoked" bson:"revoked"`
+}
+
+/*
+Signed - Returns the signed JWT of the access token. This is the access token itself, unless it is encrypted for its
+audience, in which case the signed JWT inside it is returned
+*/
+func (token *Token) Signed() string {
+	if token.SignedToken != "" {
+		return token.SignedToken
+	}
+
+	return token.AccessToken
+}
+
+/*
+Expired - Determines if the access token has expired according to the clock provided in the parameter. The leeway is
+added to the expiration to tolerate clock skew between replicas
+*/
+func (token *Token) Expired(c clock.Clock, leeway time.Duration) bool {
+	return clock.Expired(c, token.ExpiresAt, leeway)
+}
+
+/*
+expiresAt - Returns the expiration of a token from its exp claim. This was computed from the servers clock when the
+claims were created, so the stored expiration always matches the one in the signed token. If the claims have no exp,
+then a zero time is returned, which is treated as never expiring
+*/
+func expiresAt(claims jwt.Claims) time.Time {
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return time.Time{}
+	}
+
+	return exp.UTC()
 }
 
 /*
@@ -65,12 +123,45 @@ func (token *Token) Response() *response.TokenResponse {
 	}
 }
 
+/*
+IssueRefreshToken - Generates an opaque refresh token for the token, which expires at the time provided in the parameter.
+Refresh tokens are not JWTs, as they are only ever redeemed with credstack and are looked up in the database. The refresh
+token is stored alongside the access token when the token is passed to NewToken.
+
+The family should be the family of the refresh token that was redeemed to issue this token. If it is empty, then a new
+family is started
+*/
+func (token *Token) IssueRefreshToken(expiresAt time.Time, family string) error {
+	refreshToken, err := secret.RandString(32)
+	if err != nil {
+		return err
+	}
+
+	if family == "" {
+		family = secret.GenerateUUID(refreshToken)
+	}
+
+	token.RefreshToken = refreshToken
+	token.RefreshExpiresAt = expiresAt.UTC()
+	token.Family = family
+
+	return nil
+}
+
 /*
 NewToken - Provides logic for storing tokens of a specific type in the database. This does not generate tokens as this
-logic is provided through a method on the API struct
+logic is provided through a method on the API struct. If a refresh token was issued with Token.IssueRefreshToken, then it
+is stored in the same document as the access token.
+
+If the token store is in write_behind mode, the token is queued and written in a later batch, so it cannot be revoked or
+introspected until then. If the queue is full, then the token is written synchronously instead
 */
 func NewToken(serv *server.Server, token *Token) error {
-	_, err := serv.Database().Collection("token").InsertOne(context.Background(), token)
+	if serv.TokenWriter().Enqueue(token) {
+		return nil
+	}
+
+	_, err := serv.Database().Collection("token").InsertOne(serv.Context(), token)
 	if err != nil {
 		var writeError mongo.WriteException
 		if errors.As(err, &writeError) {
@@ -85,3 +176,143 @@ func NewToken(serv *server.Server, token *Token) error {
 
 	return nil
 }
+
+/*
+RevokeFamily - Revokes every token that was issued by rotating the same original refresh token. This is used when a
+refresh token is reused, as one of the tokens in the family has been stolen and there is no way to know which. The tokens
+are kept with the revoked flag set, the same as Revoke, so that introspection reports them as inactive instead of not
+found, and later replays of a consumed token in the family are still detected as reuse. The number of tokens that were
+revoked is returned
+*/
+func RevokeFamily(serv *server.Server, family string) (int64, error) {
+	if family == "" {
+		return 0, nil
+	}
+
+	result, err := serv.Database().Collection("token").UpdateMany(
+		serv.Context(),
+		bson.M{"family": family, "revoked": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	region.RecordRevocation(serv, region.RevocationKindFamily, family, "")
+
+	return result.ModifiedCount, nil
+}
+
+func init() {
+	gate.Register(gate.ActionTokenRevokeAll, func(serv *server.Server, target string) error {
+		_, err := revokeForClient(serv, target)
+		return err
+	})
+}
+
+/*
+RevokeForClient - Revokes every token that was issued to the client ID provided in the parameter. The tokens are kept
+with the revoked flag set, the same as Revoke, so that introspection reports them as inactive and their refresh tokens
+can no longer be redeemed. The number of tokens that were revoked is returned. Revoking tokens for a client that has none
+is not considered an error. If revoking every token of a client requires approval, then gate.ErrApprovalRequired is
+returned instead, and the tokens must be revoked by approving a token.revoke_all approval
+*/
+func RevokeForClient(serv *server.Server, clientId string) (int64, error) {
+	err := gate.Check(serv, gate.ActionTokenRevokeAll)
+	if err != nil {
+		return 0, err
+	}
+
+	return revokeForClient(serv, clientId)
+}
+
+/*
+revokeForClient - Provides the logic for RevokeForClient without checking for approval. This is what is executed once a
+token.revoke_all approval has been approved
+*/
+func revokeForClient(serv *server.Server, clientId string) (int64, error) {
+	result, err := serv.Database().Collection("token").UpdateMany(
+		serv.Context(),
+		bson.M{"client_id": clientId, "revoked": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	region.RecordRevocation(serv, region.RevocationKindClient, clientId, clientId)
+
+	return result.ModifiedCount, nil
+}
+
+/*
+RevokeForSubject - Revokes every token that was issued to the client ID provided in the parameter on behalf of the
+subject. This ends the subject's session with the client when they log out: the tokens are kept with the revoked flag
+set, the same as Revoke, so that introspection reports them as inactive and their refresh tokens can no longer be
+redeemed. The number of tokens that were revoked is returned
+*/
+func RevokeForSubject(serv *server.Server, subject string, clientId string) (int64, error) {
+	result, err := serv.Database().Collection("token").UpdateMany(
+		serv.Context(),
+		bson.M{"sub": subject, "client_id": clientId, "revoked": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	region.RecordRevocation(serv, region.RevocationKindSubject, subject, clientId)
+
+	return result.ModifiedCount, nil
+}
+
+/*
+RevokeAllForSubject - Revokes every token that was issued on behalf of the subject provided in the parameter, regardless
+of which client it was issued to or if it was bound to a session. This is used when a user is locked or deprovisioned,
+so that none of their refresh tokens can be redeemed again. The number of tokens that were revoked is returned
+*/
+func RevokeAllForSubject(serv *server.Server, subject string) (int64, error) {
+	result, err := serv.Database().Collection("token").UpdateMany(
+		serv.Context(),
+		bson.M{"sub": subject, "revoked": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	region.RecordRevocation(serv, region.RevocationKindSubject, subject, "")
+
+	return result.ModifiedCount, nil
+}
+
+/*
+RevokeForSession - Revokes every token that was bound to the session of the subject identified by the identifier in the
+session's header, regardless of which client it was issued to, including the tokens issued by rotating their refresh
+tokens. If the identifier is empty, then every token bound to any session of the subject is revoked instead, which signs
+the user out everywhere. Tokens issued without a session (like with the device code grant) are not affected. The tokens
+are kept with the revoked flag set, the same as RevokeForSubject. The number of tokens that were revoked is returned
+*/
+func RevokeForSession(serv *server.Server, subject string, identifier string) (int64, error) {
+	filter := bson.M{"sub": subject, "session_id": bson.M{"$ne": ""}, "revoked": bson.M{"$ne": true}}
+	if identifier != "" {
+		filter["session_id"] = identifier
+	}
+
+	result, err := serv.Database().Collection("token").UpdateMany(
+		serv.Context(),
+		filter,
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if identifier != "" {
+		region.RecordRevocation(serv, region.RevocationKindSession, identifier, "")
+	} else {
+		region.RecordRevocation(serv, region.RevocationKindSession, subject, "")
+	}
+
+	return result.ModifiedCount, nil
+}
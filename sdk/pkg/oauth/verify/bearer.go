@@ -0,0 +1,126 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrMissingToken - Provides a named error for when a request has no access token in its Authorization header
+var ErrMissingToken = credstackError.NewError(401, "ERR_MISSING_TOKEN", "verify: The request has no bearer token")
+
+// ErrInsufficientScope - Provides a named error for when a token was not issued with every scope a route requires. The missing scopes are appended to the error
+var ErrInsufficientScope = credstackError.NewError(403, "ERR_INSUFFICIENT_SCOPE", "verify: The token was not issued with the scopes required by this route")
+
+// claimsContextKey - The key verified claims are stored under in a context.Context
+type claimsContextKey struct{}
+
+/*
+BearerToken - Returns the access token from the value of an Authorization header with the Bearer scheme (RFC 6750
+section 2.1). The scheme is matched case insensitively
+*/
+func BearerToken(authorization string) (string, bool) {
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "bearer ") {
+		return "", false
+	}
+
+	accessToken := strings.TrimSpace(authorization[7:])
+
+	return accessToken, accessToken != ""
+}
+
+/*
+RequireScopes - Ensures that the token the claims were verified from was issued with every scope provided in the
+parameter. If it was not, then ErrInsufficientScope is returned with the missing scopes appended to it
+*/
+func RequireScopes(claims *Claims, scopes ...string) error {
+	var missing []string
+
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			missing = append(missing, scope)
+		}
+	}
+
+	if len(missing) != 0 {
+		return fmt.Errorf("%w (missing %s)", ErrInsufficientScope, strings.Join(missing, " "))
+	}
+
+	return nil
+}
+
+/*
+Authenticate - Extracts the access token from the value of an Authorization header, verifies it, and ensures that it was
+issued with every scope provided in the parameter. This is what the resource server middlewares are built on, and can be
+used directly to integrate with other frameworks
+*/
+func (verifier *Verifier) Authenticate(authorization string, scopes ...string) (*Claims, error) {
+	accessToken, ok := BearerToken(authorization)
+	if !ok {
+		return nil, ErrMissingToken
+	}
+
+	claims, err := verifier.Verify(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	err = RequireScopes(claims, scopes...)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+/*
+Challenge - Returns the value of the WWW-Authenticate header to respond with when Authenticate returns the error provided
+in the parameter (RFC 6750 section 3), along with if one should be sent at all. Errors that are not caused by the token,
+such as ErrJWKSUnavailable, are not challenged
+*/
+func Challenge(err error, scopes []string) (string, bool) {
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		return `Bearer`, true
+	case errors.Is(err, ErrInsufficientScope):
+		return fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")), true
+	case errors.Is(err, ErrInvalidToken):
+		return `Bearer error="invalid_token"`, true
+	default:
+		return "", false
+	}
+}
+
+/*
+ErrorResponse - Returns the status code and JSON body to respond with when Authenticate returns the error provided in the
+parameter. The body is shaped like the error responses of credstack itself, and only carries the message of the named
+error, as the reason appended to it can describe the internals of the resource server
+*/
+func ErrorResponse(err error) (int, map[string]string) {
+	var casted credstackError.CredstackError
+	if !errors.As(err, &casted) {
+		return 500, map[string]string{"message": "verify: An internal error occurred"}
+	}
+
+	return casted.HTTPStatusCode, map[string]string{"error": casted.Short(), "message": casted.Error()}
+}
+
+/*
+NewContext - Returns a copy of the context provided in the parameter that carries the verified claims
+*/
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+/*
+FromContext - Returns the verified claims carried by the context provided in the parameter. If the request was not
+authenticated by one of the resource server middlewares, then false is returned
+*/
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+
+	return claims, ok
+}
@@ -0,0 +1,80 @@
+package verify
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// registeredClaims - The names of the claims that are decoded into jwt.RegisteredClaims, or into a typed member of Claims, so they are not repeated in Claims.Extra
+var registeredClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "scope", "roles"}
+
+/*
+Claims - The claims of an access token that passed verification. The claims credstack uses for authorization are
+decoded into typed members, and every other claim (such as act, or claims inserted by hooks) is kept in Extra
+*/
+type Claims struct {
+	jwt.RegisteredClaims
+
+	// Scope - The space separated scopes the token was issued with. This is omitted if the token was issued without any scopes
+	Scope string `json:"scope,omitempty"`
+
+	// Roles - The roles of the user the token was issued on behalf of. This is only present if the API enforces RBAC
+	Roles []string `json:"roles,omitempty"`
+
+	// Extra - Every claim that is not a registered claim, scope or roles
+	Extra map[string]any `json:"-"`
+}
+
+/*
+UnmarshalJSON - Decodes the registered claims and typed members, and collects every other claim into Extra
+*/
+func (claims *Claims) UnmarshalJSON(data []byte) error {
+	type typedClaims Claims
+
+	var typed typedClaims
+
+	err := json.Unmarshal(data, &typed)
+	if err != nil {
+		return err
+	}
+
+	var all map[string]any
+
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range registeredClaims {
+		delete(all, name)
+	}
+
+	*claims = Claims(typed)
+	claims.Extra = all
+
+	return nil
+}
+
+/*
+Scopes - Returns the scopes the token was issued with
+*/
+func (claims *Claims) Scopes() []string {
+	return strings.Fields(claims.Scope)
+}
+
+/*
+HasScope - Returns true if the token was issued with the scope provided in the parameter
+*/
+func (claims *Claims) HasScope(scope string) bool {
+	return slices.Contains(claims.Scopes(), scope)
+}
+
+/*
+HasRole - Returns true if the token was issued on behalf of a user with the role provided in the parameter
+*/
+func (claims *Claims) HasRole(role string) bool {
+	return slices.Contains(claims.Roles, role)
+}
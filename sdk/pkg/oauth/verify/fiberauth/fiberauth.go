@@ -0,0 +1,47 @@
+package fiberauth
+
+import (
+	"github.com/credstack/credstack/sdk/pkg/oauth/verify"
+	"github.com/gofiber/fiber/v3"
+)
+
+// claimsKey - The key of the fiber.Ctx local that holds the verified claims
+type claimsKey struct{}
+
+/*
+New - Returns a handler that authenticates the request with the bearer token in its Authorization header, and ensures
+that the token was issued with every scope provided in the parameter. The verified claims are stored in the locals of the
+request, and in its context, so that they can be read with Claims or verify.FromContext. Rejected requests are responded
+to with the WWW-Authenticate header described in RFC 6750 section 3. Register it on a group to protect every route in it,
+or on a single route to require scopes for that route only
+*/
+func New(verifier *verify.Verifier, scopes ...string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		claims, err := verifier.Authenticate(c.Get(fiber.HeaderAuthorization), scopes...)
+		if err != nil {
+			challenge, ok := verify.Challenge(err, scopes)
+			if ok {
+				c.Set(fiber.HeaderWWWAuthenticate, challenge)
+			}
+
+			status, body := verify.ErrorResponse(err)
+
+			return c.Status(status).JSON(body)
+		}
+
+		c.Locals(claimsKey{}, claims)
+		c.SetContext(verify.NewContext(c.Context(), claims))
+
+		return c.Next()
+	}
+}
+
+/*
+Claims - Returns the claims verified by the handler returned from New. If the request was not authenticated by it, then
+nil is returned
+*/
+func Claims(c fiber.Ctx) *verify.Claims {
+	claims, _ := c.Locals(claimsKey{}).(*verify.Claims)
+
+	return claims
+}
@@ -0,0 +1,48 @@
+package httpauth
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/credstack/credstack/sdk/pkg/oauth/verify"
+)
+
+/*
+New - Returns middleware that authenticates the request with the bearer token in its Authorization header, and ensures
+that the token was issued with every scope provided in the parameter. The verified claims are stored in the context of
+the request, so that they can be read with Claims or verify.FromContext. Rejected requests are responded to with the
+WWW-Authenticate header described in RFC 6750 section 3, and are never passed to the wrapped handler
+*/
+func New(verifier *verify.Verifier, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := verifier.Authenticate(r.Header.Get("Authorization"), scopes...)
+			if err != nil {
+				challenge, ok := verify.Challenge(err, scopes)
+				if ok {
+					w.Header().Set("WWW-Authenticate", challenge)
+				}
+
+				status, body := verify.ErrorResponse(err)
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				_ = json.NewEncoder(w).Encode(body)
+
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(verify.NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+/*
+Claims - Returns the claims verified by the middleware returned from New. If the request was not authenticated by it,
+then nil is returned
+*/
+func Claims(r *http.Request) *verify.Claims {
+	claims, _ := verify.FromContext(r.Context())
+
+	return claims
+}
@@ -0,0 +1,89 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+)
+
+// maxJWKSSize - The largest JWKS that will be read. A JWKS only holds a handful of public keys, so anything larger is not a JWKS
+const maxJWKSSize = 1 << 20
+
+/*
+Refresh - Fetches the JWKS from credstack and replaces the cached copy with it. The ETag of the cached copy is sent in
+If-None-Match, so if the JWKS has not changed, then credstack responds with a 304 and the cached copy is kept. If the JWKS
+could not be fetched, then ErrJWKSUnavailable is returned and the cached copy is kept
+*/
+func (verifier *Verifier) Refresh() error {
+	verifier.fetchMu.Lock()
+	defer verifier.fetchMu.Unlock()
+
+	verifier.mu.RLock()
+	etag := verifier.etag
+	verifier.mu.RUnlock()
+
+	keys, etag, err := verifier.fetch(etag)
+
+	verifier.mu.Lock()
+	defer verifier.mu.Unlock()
+
+	verifier.lastFetch = verifier.config.Clock.Now()
+
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrJWKSUnavailable, err)
+	}
+
+	if keys != nil {
+		verifier.keys = keys
+		verifier.etag = etag
+	}
+
+	return nil
+}
+
+/*
+fetch - Fetches the JWKS, conditionally on the ETag provided in the parameter if it is not empty. If credstack responds
+with a 304, then nil is returned for the JWKS
+*/
+func (verifier *Verifier) fetch(etag string) (*jwk.JSONWebKeySet, string, error) {
+	req, err := http.NewRequest(http.MethodGet, verifier.config.JWKSURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := verifier.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var keys jwk.JSONWebKeySet
+
+	err = json.Unmarshal(body, &keys)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &keys, resp.Header.Get("ETag"), nil
+}
@@ -0,0 +1,287 @@
+package verify
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken - Provides a named error for when a token fails verification. The reason is appended to the error
+var ErrInvalidToken = credstackError.NewError(401, "ERR_INVALID_TOKEN", "verify: The token is not valid")
+
+// ErrJWKSUnavailable - Provides a named error for when the JWKS could not be fetched, so tokens cannot be verified
+var ErrJWKSUnavailable = credstackError.NewError(503, "ERR_JWKS_UNAVAILABLE", "verify: Failed to fetch the JWKS")
+
+// ErrInvalidVerifierConfig - Provides a named error for when a Verifier is constructed without a JWKS URL, issuer, or audience
+var ErrInvalidVerifierConfig = credstackError.NewError(500, "ERR_INVALID_VERIFIER_CONFIG", "verify: JWKS URL, issuer, and audience are required")
+
+/*
+Config - The options of a Verifier. JWKSURL, Issuer and Audience are required, every other option falls back to its
+default when it is left empty
+*/
+type Config struct {
+	// JWKSURL - The URL of the JWKS of the credstack deployment, usually {issuer}/.well-known/jwks.json
+	JWKSURL string `mapstructure:"jwks_url"`
+
+	// Issuer - The issuer tokens must be issued by. This must match the issuer credstack is configured with exactly
+	Issuer string `mapstructure:"issuer"`
+
+	// Audience - The audience of the API the resource server implements. Tokens issued for any other audience are rejected
+	Audience string `mapstructure:"audience"`
+
+	// Algorithms - The signing algorithms tokens are accepted with. Defaults to RS256 and ES256
+	Algorithms []string `mapstructure:"algorithms"`
+
+	// Leeway - How far the clock of the resource server may drift from the clock of credstack when exp, nbf and iat are validated. Defaults to 30 seconds, set it to a negative duration to validate them without any leeway
+	Leeway time.Duration `mapstructure:"leeway"`
+
+	// RefreshInterval - How often the JWKS is fetched again in the background, once Start has been called
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+
+	// MinRefreshInterval - How long to wait between fetching the JWKS again because a token was signed with an unknown key, so that tokens with made up key ID's cannot be used to flood credstack with requests
+	MinRefreshInterval time.Duration `mapstructure:"min_refresh_interval"`
+
+	// Timeout - How long to wait for the JWKS to be fetched. This is ignored if HTTPClient is set
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// HTTPClient - The client the JWKS is fetched with. If this is nil, then a client with Timeout is used
+	HTTPClient *http.Client `mapstructure:"-"`
+
+	// Clock - The clock expirations are evaluated against. If this is nil, then clock.System is used
+	Clock clock.Clock `mapstructure:"-"`
+
+	// DecryptionKey - The private half of the encryption key registered on the API (see token.ParseDecryptionKey). Encrypted tokens are decrypted with it before they are verified. If this is nil, then encrypted tokens are rejected
+	DecryptionKey *rsa.PrivateKey `mapstructure:"-"`
+}
+
+// DefaultConfig Initializes the options of a Verifier with sensible defaults, for the issuer and audience provided in the parameters
+func DefaultConfig(issuer string, audience string) Config {
+	return Config{
+		JWKSURL:            issuer + "/.well-known/jwks.json",
+		Issuer:             issuer,
+		Audience:           audience,
+		Algorithms:         []string{"RS256", "ES256"},
+		Leeway:             30 * time.Second,
+		RefreshInterval:    5 * time.Minute,
+		MinRefreshInterval: 30 * time.Second,
+		Timeout:            10 * time.Second,
+		Clock:              clock.System,
+	}
+}
+
+/*
+Verifier - Verifies access tokens issued by credstack from within a resource server. The JWKS is fetched from credstack
+and cached in memory, so verifying a token never needs a network round trip unless it was signed with a key that is not
+cached yet. The JWKS is fetched conditionally with the ETag of the cached copy, so refreshing an unchanged JWKS only
+costs a 304
+*/
+type Verifier struct {
+	// config - The options of the verifier, with defaults applied
+	config Config
+
+	// client - The client the JWKS is fetched with
+	client *http.Client
+
+	// parser - Validates the signature and registered claims of tokens
+	parser *jwt.Parser
+
+	// mu - Protects keys, etag and lastFetch
+	mu sync.RWMutex
+
+	// keys - The cached JWKS
+	keys *jwk.JSONWebKeySet
+
+	// etag - The ETag credstack returned with the cached JWKS
+	etag string
+
+	// lastFetch - When the JWKS was last fetched, regardless of if it succeeded. Used to rate limit fetches for unknown keys
+	lastFetch time.Time
+
+	// fetchMu - Ensures the JWKS is only fetched by one goroutine at a time
+	fetchMu sync.Mutex
+
+	// stop - Closed by Stop to end the background refresh
+	stop chan struct{}
+
+	// wg - Tracks the background refresh so that Stop can wait for it
+	wg sync.WaitGroup
+}
+
+/*
+NewVerifier - Constructs a Verifier and fetches the JWKS for the first time, so that a wrong JWKS URL is surfaced when
+the resource server starts. Options that are left empty in the config fall back to their default in DefaultConfig
+*/
+func NewVerifier(config Config) (*Verifier, error) {
+	if config.JWKSURL == "" || config.Issuer == "" || config.Audience == "" {
+		return nil, ErrInvalidVerifierConfig
+	}
+
+	defaults := DefaultConfig(config.Issuer, config.Audience)
+
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = defaults.Algorithms
+	}
+
+	switch {
+	case config.Leeway == 0:
+		config.Leeway = defaults.Leeway
+	case config.Leeway < 0:
+		config.Leeway = 0
+	}
+
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = defaults.RefreshInterval
+	}
+
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = defaults.MinRefreshInterval
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+
+	if config.Clock == nil {
+		config.Clock = defaults.Clock
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: config.Timeout}
+	}
+
+	verifier := &Verifier{
+		config: config,
+		client: client,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(config.Algorithms),
+			jwt.WithIssuer(config.Issuer),
+			jwt.WithAudience(config.Audience),
+			jwt.WithLeeway(config.Leeway),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+			jwt.WithTimeFunc(config.Clock.Now),
+		),
+		stop: make(chan struct{}),
+	}
+
+	err := verifier.Refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	return verifier, nil
+}
+
+/*
+Verify - Verifies the signature of the token provided in the parameter, validates its issuer, audience and expiration,
+and returns its claims. If the token was signed with a key that is not in the cached JWKS, then the JWKS is fetched again
+(at most once every MinRefreshInterval) so that keys published after it was cached are picked up. If the token is not
+valid, then ErrInvalidToken is returned with the reason appended to it.
+
+Tokens issued for APIs that encrypt their tokens are nested JWTs (see token.Encrypt). These are decrypted with
+DecryptionKey first, and the signed token inside is then verified like any other
+*/
+func (verifier *Verifier) Verify(raw string) (*Claims, error) {
+	if token.IsEncrypted(raw) {
+		if verifier.config.DecryptionKey == nil {
+			return nil, fmt.Errorf("%w (the token is encrypted, but no decryption key is configured)", ErrInvalidToken)
+		}
+
+		signed, err := token.Decrypt(raw, verifier.config.DecryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrInvalidToken, err)
+		}
+
+		raw = signed
+	}
+
+	claims := new(Claims)
+
+	_, err := verifier.parser.ParseWithClaims(raw, claims, verifier.keyfunc)
+	if err != nil {
+		if errors.Is(err, ErrJWKSUnavailable) {
+			return nil, ErrJWKSUnavailable
+		}
+
+		return nil, fmt.Errorf("%w (%v)", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+/*
+keyfunc - A jwt.Keyfunc that selects the key from the cached JWKS, and fetches the JWKS again if the key is not in it
+*/
+func (verifier *Verifier) keyfunc(token *jwt.Token) (any, error) {
+	key, err := verifier.Keys().Keyfunc(token)
+	if !errors.Is(err, jwk.ErrKeyNotExist) {
+		return key, err
+	}
+
+	verifier.mu.RLock()
+	limited := verifier.config.Clock.Now().Sub(verifier.lastFetch) < verifier.config.MinRefreshInterval
+	verifier.mu.RUnlock()
+
+	if limited {
+		return nil, err
+	}
+
+	refreshErr := verifier.Refresh()
+	if refreshErr != nil {
+		return nil, refreshErr
+	}
+
+	return verifier.Keys().Keyfunc(token)
+}
+
+/*
+Keys - Returns the cached JWKS. This should not be modified, as it is shared with every call to Verify
+*/
+func (verifier *Verifier) Keys() *jwk.JSONWebKeySet {
+	verifier.mu.RLock()
+	defer verifier.mu.RUnlock()
+
+	return verifier.keys
+}
+
+/*
+Start - Starts a goroutine that fetches the JWKS again every RefreshInterval. Failed refreshes keep the cached JWKS, so
+that tokens keep verifying while credstack is unreachable
+*/
+func (verifier *Verifier) Start() {
+	verifier.wg.Add(1)
+
+	go func() {
+		defer verifier.wg.Done()
+
+		ticker := time.NewTicker(verifier.config.RefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-verifier.stop:
+				return
+			case <-ticker.C:
+				_ = verifier.Refresh()
+			}
+		}
+	}()
+}
+
+/*
+Stop - Stops the background refresh started by Start, and waits for a refresh that is in progress to complete
+*/
+func (verifier *Verifier) Stop() {
+	close(verifier.stop)
+	verifier.wg.Wait()
+}
@@ -0,0 +1,153 @@
+package verify
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/credstack/credstack/sdk/internal/golden"
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/oauth/claim"
+	"github.com/credstack/credstack/sdk/pkg/oauth/jwk"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://credstack.test"
+	testAudience = "https://api.credstack.test"
+)
+
+/*
+newTestVerifier - Serves a JWKS holding the public half of the golden RSA key, and constructs a Verifier for it with
+the decryption key provided in the parameter. Returns the verifier along with a signed token issued for testAudience
+*/
+func newTestVerifier(t *testing.T, decryptionKey *rsa.PrivateKey) (*Verifier, string) {
+	t.Helper()
+
+	private, public, err := jwk.NewPrivateKeyFromRSA(golden.RSAKey(t), testAudience)
+	if err != nil {
+		t.Fatalf("NewPrivateKeyFromRSA: %v", err)
+	}
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&jwk.JSONWebKeySet{Keys: []jwk.JSONWebKey{*public}})
+	}))
+	t.Cleanup(jwks.Close)
+
+	config := DefaultConfig(testIssuer, testAudience)
+	config.JWKSURL = jwks.URL
+	config.DecryptionKey = decryptionKey
+
+	verifier, err := NewVerifier(config)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+
+	signingKey, err := private.RSA()
+	if err != nil {
+		t.Fatalf("RSA: %v", err)
+	}
+
+	claims := claim.NewClaimsWithSubject(clock.System, testIssuer, testAudience, "test-subject", 3600)
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	unsigned.Header["kid"] = public.Kid
+
+	signed, err := unsigned.SignedString(signingKey)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	return verifier, signed
+}
+
+/*
+newEncryptionKey - Generates the encryption key of an API, and returns its private half along with the public JWK
+tokens are encrypted with
+*/
+func newEncryptionKey(t *testing.T) (*rsa.PrivateKey, *jwk.JSONWebKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	_, public, err := jwk.NewPrivateKeyFromRSA(key, testAudience)
+	if err != nil {
+		t.Fatalf("NewPrivateKeyFromRSA: %v", err)
+	}
+
+	return key, public
+}
+
+func TestVerifySigned(t *testing.T) {
+	verifier, signed := newTestVerifier(t, nil)
+
+	claims, err := verifier.Verify(signed)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if claims.Subject != "test-subject" {
+		t.Fatalf("expected subject test-subject, got %q", claims.Subject)
+	}
+}
+
+func TestVerifyEncrypted(t *testing.T) {
+	decryptionKey, encryptionKey := newEncryptionKey(t)
+
+	verifier, signed := newTestVerifier(t, decryptionKey)
+
+	encrypted, err := token.Encrypt(signed, encryptionKey)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	claims, err := verifier.Verify(encrypted)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if claims.Subject != "test-subject" {
+		t.Fatalf("expected subject test-subject, got %q", claims.Subject)
+	}
+}
+
+func TestVerifyEncryptedWithoutKey(t *testing.T) {
+	_, encryptionKey := newEncryptionKey(t)
+
+	verifier, signed := newTestVerifier(t, nil)
+
+	encrypted, err := token.Encrypt(signed, encryptionKey)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	_, err = verifier.Verify(encrypted)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestVerifyEncryptedWithWrongKey(t *testing.T) {
+	_, encryptionKey := newEncryptionKey(t)
+	otherKey, _ := newEncryptionKey(t)
+
+	verifier, signed := newTestVerifier(t, otherKey)
+
+	encrypted, err := token.Encrypt(signed, encryptionKey)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	_, err = verifier.Verify(encrypted)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+}
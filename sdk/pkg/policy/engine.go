@@ -0,0 +1,227 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+const (
+	// DecisionToken - The decision requested before a token is issued
+	DecisionToken string = "token"
+
+	// DecisionManagement - The decision requested before a management API request is handled
+	DecisionManagement string = "management"
+)
+
+// ErrPolicyDenied - An error that gets returned when the policy engine denies a request
+var ErrPolicyDenied = credstackError.NewError(403, "ERR_POLICY_DENIED", "policy: The request was denied by policy")
+
+// ErrPolicyUnavailable - An error that gets returned when the policy engine cannot be reached and PolicyEngineConfig.FailOpen is not set
+var ErrPolicyUnavailable = credstackError.NewError(503, "ERR_POLICY_UNAVAILABLE", "policy: The policy engine could not be reached")
+
+/*
+ClientInput - Describes the client making the request to the policy engine
+*/
+type ClientInput struct {
+	// ClientId - The client ID of the client
+	ClientId string `json:"client_id"`
+
+	// Name - The name of the client
+	Name string `json:"name"`
+
+	// IsPublic - If set to true, the client cannot keep a secret (single page and native applications)
+	IsPublic bool `json:"is_public"`
+}
+
+/*
+RequestInput - Describes the HTTP request that the decision is requested for
+*/
+type RequestInput struct {
+	// Method - The HTTP method of the request
+	Method string `json:"method,omitempty"`
+
+	// Path - The path of the request
+	Path string `json:"path,omitempty"`
+
+	// RemoteAddr - The IP address the request originated from
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// Actor - The admin performing a management API request
+	Actor string `json:"actor,omitempty"`
+
+	// Time - A unix timestamp representing when the request was made, according to the server's clock
+	Time int64 `json:"time"`
+}
+
+/*
+Input - The input document sent to the policy engine. Only the fields that apply to the decision are set: token
+decisions describe the client, the user, the audience, and the scopes, and management decisions describe the request
+*/
+type Input struct {
+	// Decision - The decision being requested. One of: token, management
+	Decision string `json:"decision"`
+
+	// Client - The client the token is being issued to
+	Client *ClientInput `json:"client,omitempty"`
+
+	// Subject - The user the token is being issued on behalf of. Empty for tokens issued with client credentials
+	Subject string `json:"subject,omitempty"`
+
+	// GrantType - The grant type the token is being requested with
+	GrantType string `json:"grant_type,omitempty"`
+
+	// Audience - The audience of the resource server the token is being issued for
+	Audience string `json:"audience,omitempty"`
+
+	// Scopes - The scopes the token is being issued with
+	Scopes []string `json:"scopes,omitempty"`
+
+	// Request - The HTTP request the decision is requested for
+	Request RequestInput `json:"request"`
+}
+
+/*
+dataResponse - The response of the OPA Data API. The result is either a boolean, or an object with an allow field and an
+optional reason, so that policies can explain their denials
+*/
+type dataResponse struct {
+	Result json.RawMessage `json:"result"`
+}
+
+/*
+Enabled - Determines if the policy engine is configured to evaluate the decision provided in the parameter
+*/
+func Enabled(serv *server.Server, decision string) bool {
+	return serv.Config.PolicyConfig.Engine.URL != "" && path(serv, decision) != ""
+}
+
+/*
+Evaluate - Requests a decision from the policy engine for the input provided in the parameter. If the engine allows the
+request, then nil is returned. If it denies the request, or the rule is undefined for the input, then ErrPolicyDenied is
+returned, wrapped with the reason the policy gave if there is one. If the engine cannot be reached, then
+ErrPolicyUnavailable is returned, unless PolicyEngineConfig.FailOpen is set.
+
+If the policy engine is not configured for the decision, then every request is allowed
+*/
+func Evaluate(serv *server.Server, input *Input) error {
+	if !Enabled(serv, input.Decision) {
+		return nil
+	}
+
+	if input.Request.Time == 0 {
+		input.Request.Time = serv.Clock().Now().Unix()
+	}
+
+	allowed, reason, err := query(serv, input)
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to request a "+input.Decision+" decision from the policy engine", err)
+
+		if serv.Config.PolicyConfig.Engine.FailOpen {
+			return nil
+		}
+
+		return fmt.Errorf("%w (%v)", ErrPolicyUnavailable, err)
+	}
+
+	if !allowed {
+		if reason != "" {
+			return fmt.Errorf("%w (%s)", ErrPolicyDenied, reason)
+		}
+
+		return ErrPolicyDenied
+	}
+
+	return nil
+}
+
+/*
+query - Sends the input to the rule for its decision with the OPA Data API, and returns whether the request is allowed
+along with the reason the policy gave
+*/
+func query(serv *server.Server, input *Input) (bool, string, error) {
+	engine := serv.Config.PolicyConfig.Engine
+
+	encoded, err := json.Marshal(map[string]any{"input": input})
+	if err != nil {
+		return false, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(serv.Context(), engine.Timeout)
+	defer cancel()
+
+	endpoint := strings.TrimSuffix(engine.URL, "/") + "/v1/data/" + strings.Trim(path(serv, input.Decision), "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(encoded))
+	if err != nil {
+		return false, "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if engine.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+engine.BearerToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, "", fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	var ret dataResponse
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&ret)
+	if err != nil {
+		return false, "", err
+	}
+
+	/*
+		An undefined rule has no result, which OPA returns for inputs that no rule matches. This is treated as a denial,
+		so that a policy only allows what it explicitly allows
+	*/
+	if len(ret.Result) == 0 {
+		return false, "", nil
+	}
+
+	var allowed bool
+	if json.Unmarshal(ret.Result, &allowed) == nil {
+		return allowed, "", nil
+	}
+
+	var structured struct {
+		Allow  bool   `json:"allow"`
+		Reason string `json:"reason"`
+	}
+
+	err = json.Unmarshal(ret.Result, &structured)
+	if err != nil {
+		return false, "", fmt.Errorf("the result must be a boolean or an object with an allow field (%v)", err)
+	}
+
+	return structured.Allow, structured.Reason, nil
+}
+
+/*
+path - Returns the path of the rule that is consulted for the decision provided in the parameter
+*/
+func path(serv *server.Server, decision string) string {
+	switch decision {
+	case DecisionToken:
+		return serv.Config.PolicyConfig.Engine.TokenPath
+	case DecisionManagement:
+		return serv.Config.PolicyConfig.Engine.ManagementPath
+	default:
+		return ""
+	}
+}
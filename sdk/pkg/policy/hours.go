@@ -0,0 +1,91 @@
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrOutsideBusinessHours - An error that gets returned when a token is requested for an audience outside of its allowed hours
+var ErrOutsideBusinessHours = credstackError.NewError(403, "ERR_OUTSIDE_BUSINESS_HOURS", "policy: Tokens cannot be issued for the requested audience outside of business hours")
+
+// ErrUnknownTimeZone - An error that gets returned when business hours cannot be evaluated, as the time zone of the user or the policy is not a known IANA time zone
+var ErrUnknownTimeZone = credstackError.NewError(403, "ERR_UNKNOWN_TIME_ZONE", "policy: Business hours cannot be evaluated, as the time zone is not a known IANA time zone")
+
+// defaultWeekdays - The days that are used when a BusinessHoursPolicy does not define any
+var defaultWeekdays = []int{int(time.Monday), int(time.Tuesday), int(time.Wednesday), int(time.Thursday), int(time.Friday)}
+
+/*
+Allows - Determines if the given policy permits token issuance at the provided time. The time is converted into the
+subjects time zone (zoneInfo) before it is evaluated, falling back to the policies own ZoneInfo if the subject does not
+have one, and to UTC if neither is set. A return value of true indicates that issuance is permitted.
+
+If the time zone cannot be loaded, then ErrUnknownTimeZone is returned instead of evaluating the policy in UTC, as that
+would open or close the window at the wrong hours
+*/
+func Allows(policy config.BusinessHoursPolicy, now time.Time, zoneInfo string) (bool, error) {
+	if zoneInfo == "" {
+		zoneInfo = policy.ZoneInfo
+	}
+
+	location, err := time.LoadLocation(zoneInfo)
+	if err != nil {
+		return false, fmt.Errorf("%w (%v)", ErrUnknownTimeZone, err)
+	}
+
+	local := now.In(location)
+
+	weekdays := policy.Weekdays
+	if len(weekdays) == 0 {
+		weekdays = defaultWeekdays
+	}
+
+	if !slices.Contains(weekdays, int(local.Weekday())) {
+		return false, nil
+	}
+
+	return local.Hour() >= policy.StartHour && local.Hour() < policy.EndHour, nil
+}
+
+/*
+HasBusinessHours - Returns true if any business hours policy applies to the audience provided in the parameter, so that
+callers can avoid looking up the time zone of the user when no policy would evaluate it
+*/
+func HasBusinessHours(config config.PolicyConfig, audience string) bool {
+	for _, policy := range config.BusinessHours {
+		if policy.Audience == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+EnforceBusinessHours - Evaluates every business hours policy that applies to the requested audience. The zoneInfo
+parameter should be the ZoneInfo of the user the token is being issued for, or an empty string if the token is not
+being issued on behalf of a user (Client Credentials). If any applicable policy does not allow issuance, then
+ErrOutsideBusinessHours is returned. If the time zone is unknown, then ErrUnknownTimeZone is returned, so that issuance
+is denied rather than evaluated in the wrong time zone
+*/
+func EnforceBusinessHours(config config.PolicyConfig, audience string, zoneInfo string, now time.Time) error {
+	for _, policy := range config.BusinessHours {
+		if policy.Audience != audience {
+			continue
+		}
+
+		allowed, err := Allows(policy, now, zoneInfo)
+		if err != nil {
+			return err
+		}
+
+		if !allowed {
+			return ErrOutsideBusinessHours
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+// wednesdayNoonUTC - A Wednesday at 12:00 UTC, which is 08:00 in New York and 21:00 in Tokyo
+var wednesdayNoonUTC = time.Date(2026, time.January, 7, 12, 0, 0, 0, time.UTC)
+
+func TestEnforceBusinessHours(t *testing.T) {
+	policies := config.PolicyConfig{
+		BusinessHours: []config.BusinessHoursPolicy{
+			{Audience: "https://api.credstack.test", StartHour: 9, EndHour: 17, ZoneInfo: "America/New_York"},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		audience string
+		zoneInfo string
+		expected error
+	}{
+		{name: "outside the window of the policy zone", audience: "https://api.credstack.test", expected: ErrOutsideBusinessHours},
+		{name: "inside the window of the user zone", audience: "https://api.credstack.test", zoneInfo: "Europe/London"},
+		{name: "outside the window of the user zone", audience: "https://api.credstack.test", zoneInfo: "Asia/Tokyo", expected: ErrOutsideBusinessHours},
+		{name: "unknown user zone", audience: "https://api.credstack.test", zoneInfo: "Mars/Olympus_Mons", expected: ErrUnknownTimeZone},
+		{name: "other audience", audience: "https://other.credstack.test", zoneInfo: "Mars/Olympus_Mons"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := EnforceBusinessHours(policies, tc.audience, tc.zoneInfo, wednesdayNoonUTC)
+			if tc.expected == nil && err != nil {
+				t.Fatalf("EnforceBusinessHours: %v", err)
+			}
+
+			if tc.expected != nil && !errors.Is(err, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestValidatePolicyConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy config.BusinessHoursPolicy
+		valid  bool
+	}{
+		{name: "valid", policy: config.BusinessHoursPolicy{Audience: "a", StartHour: 0, EndHour: 24, Weekdays: []int{0, 6}, ZoneInfo: "Asia/Tokyo"}, valid: true},
+		{name: "missing audience", policy: config.BusinessHoursPolicy{StartHour: 9, EndHour: 17}},
+		{name: "start out of range", policy: config.BusinessHoursPolicy{Audience: "a", StartHour: -1, EndHour: 17}},
+		{name: "end out of range", policy: config.BusinessHoursPolicy{Audience: "a", StartHour: 9, EndHour: 25}},
+		{name: "inverted", policy: config.BusinessHoursPolicy{Audience: "a", StartHour: 22, EndHour: 6}},
+		{name: "empty window", policy: config.BusinessHoursPolicy{Audience: "a", StartHour: 9, EndHour: 9}},
+		{name: "weekday out of range", policy: config.BusinessHoursPolicy{Audience: "a", StartHour: 9, EndHour: 17, Weekdays: []int{7}}},
+		{name: "unknown zone", policy: config.BusinessHoursPolicy{Audience: "a", StartHour: 9, EndHour: 17, ZoneInfo: "Mars/Olympus_Mons"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policies := config.PolicyConfig{BusinessHours: []config.BusinessHoursPolicy{tc.policy}}
+
+			err := policies.Validate()
+			if tc.valid && err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+
+			if !tc.valid && !errors.Is(err, config.ErrInvalidPolicyConfig) {
+				t.Fatalf("expected ErrInvalidPolicyConfig, got %v", err)
+			}
+		})
+	}
+}
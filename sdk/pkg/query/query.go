@@ -0,0 +1,394 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// DefaultLimit - The number of documents returned in a page when no limit is provided
+	DefaultLimit int = 50
+
+	// MaxLimit - The maximum number of documents that can be returned in a single page. Larger limits are reset to this
+	MaxLimit int = 500
+)
+
+// ErrInvalidField - Provides a named error for when a field is selected that cannot be returned from the collection
+var ErrInvalidField = credstackError.NewError(400, "QUERY_INVALID_FIELD", "query: One or more of the selected fields cannot be returned")
+
+// ErrInvalidCursor - Provides a named error for when a page is requested with a cursor that was not returned by a previous page
+var ErrInvalidCursor = credstackError.NewError(400, "QUERY_INVALID_CURSOR", "query: The cursor is malformed")
+
+// ErrInvalidTime - Provides a named error for when the start or end of a time range is neither an RFC 3339 timestamp nor a unix timestamp
+var ErrInvalidTime = credstackError.NewError(400, "QUERY_INVALID_TIME", "query: Times must be RFC 3339 or unix timestamps")
+
+// ErrInvalidTimeRange - Provides a named error for when the start of a time range is after its end
+var ErrInvalidTimeRange = credstackError.NewError(400, "QUERY_INVALID_TIME_RANGE", "query: The start of the time range must be before its end")
+
+/*
+Options - Describes which documents of a collection are returned, and which of their fields. Every option is optional
+*/
+type Options struct {
+	// Fields - The fields returned for each document. If empty, every field that the collection allows to be selected is returned
+	Fields []string
+
+	// Subject - Only documents about this subject are returned
+	Subject string
+
+	// From - Only documents at or after this time are returned
+	From time.Time
+
+	// To - Only documents before this time are returned
+	To time.Time
+
+	// After - The cursor of the last document of the previous page. Only documents after it are returned
+	After string
+
+	// Limit - The number of documents returned in a page. Reset to DefaultLimit if zero or less, and to MaxLimit if larger
+	Limit int
+}
+
+/*
+Spec - Describes how a collection is queried with Options. Each collection that can be queried defines its own
+*/
+type Spec struct {
+	// Collection - The name of the collection, as it is named throughout credstack
+	Collection string
+
+	// Fields - The fields that can be selected. Fields that hold credentials must never be listed here, as these are the only fields ever returned
+	Fields []string
+
+	// CursorField - The field documents are sorted by and paginated with. Must be unique and increasing, and is always returned
+	CursorField string
+
+	// ParseCursor - Converts a cursor returned by FormatCursor back into the value of CursorField
+	ParseCursor func(cursor string) (any, error)
+
+	// FormatCursor - Converts the value of CursorField into the opaque cursor returned to the caller
+	FormatCursor func(value any) (string, error)
+
+	// SubjectField - The field compared with Options.Subject
+	SubjectField string
+
+	// TimeField - The field compared with Options.From and Options.To
+	TimeField string
+
+	// TimeValue - Converts Options.From and Options.To into the form stored in TimeField. If nil, they are compared as dates
+	TimeValue func(t time.Time) any
+}
+
+/*
+Page - A single page of documents. Next is the cursor to pass as Options.After to request the following page, and is
+empty once the last page has been returned
+*/
+type Page struct {
+	// Items - The documents in the page, limited to the selected fields
+	Items []bson.M `json:"items"`
+
+	// Next - The cursor of the following page. Empty if there are no more documents
+	Next string `json:"next,omitempty"`
+}
+
+/*
+ParseFields - Splits a comma separated list of fields (sub,client_id,expires_at) into the form used by Options.Fields.
+Whitespace and empty entries are ignored
+*/
+func ParseFields(fields string) []string {
+	ret := make([]string, 0)
+
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			ret = append(ret, field)
+		}
+	}
+
+	return ret
+}
+
+/*
+ParseTime - Parses the start or end of a time range, which can be an RFC 3339 timestamp (2025-01-02T15:04:05Z) or a
+unix timestamp in seconds. An empty value is returned as a zero time, which leaves that end of the range open
+*/
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+
+	ret, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w (%s)", ErrInvalidTime, value)
+	}
+
+	return ret, nil
+}
+
+/*
+projection - Builds the projection for the selected fields. The cursor field is always included so that the next page
+can be requested. If a field is selected that the spec does not allow, then ErrInvalidField is returned
+*/
+func (spec *Spec) projection(fields []string) (bson.M, error) {
+	if len(fields) == 0 {
+		fields = spec.Fields
+	}
+
+	ret := bson.M{spec.CursorField: 1}
+	if spec.CursorField != "_id" {
+		ret["_id"] = 0
+	}
+
+	for _, field := range fields {
+		if !slices.Contains(spec.Fields, field) {
+			return nil, fmt.Errorf("%w (%s)", ErrInvalidField, field)
+		}
+
+		ret[field] = 1
+	}
+
+	return ret, nil
+}
+
+/*
+filter - Builds the filter for the options. If the time range is inverted, then ErrInvalidTimeRange is returned, and if
+the cursor cannot be parsed, then ErrInvalidCursor is returned
+*/
+func (spec *Spec) filter(opts *Options) (bson.M, error) {
+	ret := bson.M{}
+
+	if opts.Subject != "" {
+		ret[spec.SubjectField] = opts.Subject
+	}
+
+	if !opts.From.IsZero() && !opts.To.IsZero() && !opts.From.Before(opts.To) {
+		return nil, ErrInvalidTimeRange
+	}
+
+	timeRange := bson.M{}
+	if !opts.From.IsZero() {
+		timeRange["$gte"] = spec.timeValue(opts.From)
+	}
+
+	if !opts.To.IsZero() {
+		timeRange["$lt"] = spec.timeValue(opts.To)
+	}
+
+	if len(timeRange) != 0 {
+		ret[spec.TimeField] = timeRange
+	}
+
+	if opts.After != "" {
+		after, err := spec.ParseCursor(opts.After)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrInvalidCursor, err)
+		}
+
+		/*
+			The cursor field can also be the time field (like object IDs, which begin with a timestamp), so the cursor is
+			added to the time range instead of replacing it
+		*/
+		if existing, ok := ret[spec.CursorField].(bson.M); ok {
+			existing["$gt"] = after
+		} else {
+			ret[spec.CursorField] = bson.M{"$gt": after}
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+timeValue - Converts a time into the form stored in TimeField
+*/
+func (spec *Spec) timeValue(t time.Time) any {
+	if spec.TimeValue != nil {
+		return spec.TimeValue(t)
+	}
+
+	return t
+}
+
+/*
+List - Returns a single page of the documents in the collection described by the spec that match the options, sorted by
+the cursor field. Only the selected fields are read from the database, so that large collections can be paged through
+without loading entire documents
+*/
+func List(serv *server.Server, spec *Spec, opts *Options) (*Page, error) {
+	projection, err := spec.projection(opts.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := spec.filter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	/*
+		One more document than the limit is requested, so that we know if there is a following page without consuming
+		an additional database call
+	*/
+	result, err := serv.Database().ReadCollection(spec.Collection, server.ReadClassList).Find(
+		serv.Context(),
+		filter,
+		mongoOpts.Find().
+			SetProjection(projection).
+			SetSort(bson.D{{Key: spec.CursorField, Value: 1}}).
+			SetLimit(int64(limit+1)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var documents []bson.D
+
+	err = result.All(serv.Context(), &documents)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	items := make([]bson.M, 0, len(documents))
+	for _, document := range documents {
+		items = append(items, toMap(document))
+	}
+
+	ret := &Page{Items: items}
+	if len(items) > limit {
+		ret.Items = items[:limit]
+
+		ret.Next, err = spec.FormatCursor(ret.Items[limit-1][spec.CursorField])
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+Stream - The documents matched by Export, read from the database in batches as they are consumed
+*/
+type Stream struct {
+	cursor *mongo.Cursor
+}
+
+/*
+Each - Passes every document in the stream to the function provided in the parameter, in order, and closes the stream
+once they have all been consumed. If the function returns an error, then the stream is closed early and the error is
+returned
+*/
+func (stream *Stream) Each(fn func(document bson.M) error) error {
+	defer stream.Close()
+
+	for stream.cursor.Next(context.Background()) {
+		var document bson.D
+
+		err := stream.cursor.Decode(&document)
+		if err != nil {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		err = fn(toMap(document))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := stream.cursor.Err(); err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return nil
+}
+
+/*
+Close - Closes the stream without consuming the rest of it. Closing a stream that was already closed is not an error
+*/
+func (stream *Stream) Close() {
+	_ = stream.cursor.Close(context.Background())
+}
+
+/*
+Export - Opens a stream of every document in the collection described by the spec that match the options, sorted by the
+cursor field. Options.Limit is ignored, and documents are read from the database in batches as they are consumed, so
+that memory use stays bounded regardless of how many documents match. The options are validated before the stream is
+returned, so that an invalid export can be rejected before anything is written to the caller
+*/
+func Export(serv *server.Server, spec *Spec, opts *Options) (*Stream, error) {
+	projection, err := spec.projection(opts.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := spec.filter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := serv.Database().ReadCollection(spec.Collection, server.ReadClassExport).Find(
+		serv.Context(),
+		filter,
+		mongoOpts.Find().
+			SetProjection(projection).
+			SetSort(bson.D{{Key: spec.CursorField, Value: 1}}).
+			SetBatchSize(int32(MaxLimit)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &Stream{cursor: cursor}, nil
+}
+
+/*
+toMap - Converts a decoded document into a bson.M. The driver decodes embedded documents as bson.D, which is encoded to
+JSON as a list of keys and values, so embedded documents and arrays are converted recursively so that they are encoded
+as JSON objects instead
+*/
+func toMap(document bson.D) bson.M {
+	ret := make(bson.M, len(document))
+	for _, element := range document {
+		ret[element.Key] = normalize(element.Value)
+	}
+
+	return ret
+}
+
+/*
+normalize - Converts the embedded documents in a decoded value with toMap. Any other value is returned as it is
+*/
+func normalize(value any) any {
+	switch typed := value.(type) {
+	case bson.D:
+		return toMap(typed)
+	case bson.A:
+		ret := make(bson.A, len(typed))
+		for i := range typed {
+			ret[i] = normalize(typed[i])
+		}
+
+		return ret
+	default:
+		return value
+	}
+}
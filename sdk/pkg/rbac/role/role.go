@@ -0,0 +1,370 @@
+package role
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/oauth/scope"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrRoleAlreadyExists - Provides a named error for when a role is created with a name that is already in use
+var ErrRoleAlreadyExists = credstackError.NewError(409, "ROLE_ALREADY_EXISTS", "role: Role already exists under the specified name")
+
+// ErrRoleDoesNotExist - Provides a named error for when a role cannot be found
+var ErrRoleDoesNotExist = credstackError.NewError(404, "ROLE_DOES_NOT_EXIST", "role: Role does not exist under the specified name")
+
+// ErrRoleMissingId - Provides a named error for when a role is fetched, updated, deleted, or assigned without a name
+var ErrRoleMissingId = credstackError.NewError(400, "ROLE_MISSING_ID", "role: Role is missing a name")
+
+// ErrInvalidRoleName - Provides a named error for when a role is created with a name that cannot be inserted into tokens
+var ErrInvalidRoleName = credstackError.NewError(400, "ROLE_INVALID_NAME", "role: Role names must not contain whitespace, quotes, or backslashes")
+
+/*
+ErrNoPermittedScopes - Returned when a token is requested for a ResourceServer with EnforceRBAC set, and the user has not
+been granted any of the requested scopes. Uses the error code defined in RFC 6749 section 5.2, as it is returned from the
+token endpoint
+*/
+var ErrNoPermittedScopes = credstackError.NewError(400, "invalid_scope", "token: The user has not been granted any of the requested scopes for the audience")
+
+/*
+Role - Represents a named set of scopes that can be assigned to users. When a ResourceServer has EnforceRBAC set, the
+scopes of the roles assigned to a user are granted to the tokens issued on their behalf
+*/
+type Role struct {
+	// Header - The header for the Role. Created at object birth
+	Header *header.Header `json:"header" bson:"header"`
+
+	// Name - The name of the role, as it is assigned to users and inserted into tokens (billing-admin)
+	Name string `json:"name" bson:"name"`
+
+	// DisplayName - The name the role is shown with. Unlike Name, it can contain whitespace and can be changed. Roles provisioned from a directory (SCIM groups) are shown with the name of the group
+	DisplayName string `json:"display_name,omitempty" bson:"display_name,omitempty"`
+
+	// Description - A human-readable explanation of who the role is meant for
+	Description string `json:"description" bson:"description"`
+
+	// Scopes - The scopes granted to users that are assigned the role. These can belong to any resource server, and
+	// are filtered to the scopes registered on the audience when a token is issued
+	Scopes []string `json:"scopes" bson:"scopes"`
+}
+
+/*
+validName - Determines if the name provided in the parameter can be used as a role. Role names are inserted into tokens
+and passed in query strings, so they follow the same rules as scope names
+*/
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		if c <= 0x20 || c == '"' || c == '\\' || c >= 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+New - Creates a new role. The name must be unique, as it is the basis for header.Identifier. The header of the role is
+always overwritten
+*/
+func New(serv *server.Server, role *Role) error {
+	if !validName(role.Name) {
+		return ErrInvalidRoleName
+	}
+
+	if role.Scopes == nil {
+		role.Scopes = make([]string, 0)
+	}
+
+	role.Header = header.New(role.Name)
+
+	_, err := serv.Database().Collection("role").InsertOne(serv.Context(), role)
+	if err != nil {
+		var writeError mongo.WriteException
+		if errors.As(err, &writeError) {
+			if writeError.HasErrorCode(11000) {
+				return ErrRoleAlreadyExists
+			}
+		}
+
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return nil
+}
+
+/*
+Get - Fetches a role by its name. If the role does not exist, then ErrRoleDoesNotExist is returned
+*/
+func Get(serv *server.Server, name string) (*Role, error) {
+	if name == "" {
+		return nil, ErrRoleMissingId
+	}
+
+	result := serv.Database().Collection("role").FindOne(serv.Context(), bson.M{"name": name})
+
+	var ret Role
+
+	err := result.Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRoleDoesNotExist
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+List - Lists all roles, sorted by name. The maximum that can be returned in a single call is 10, and if a limit exceeds
+this, it will be reset to 10
+*/
+func List(serv *server.Server, limit int) ([]*Role, error) {
+	if limit > 10 || limit <= 0 {
+		limit = 10
+	}
+
+	result, err := serv.Database().ReadCollection("role", server.ReadClassList).Find(
+		serv.Context(),
+		bson.M{},
+		mongoOpts.Find().SetLimit(int64(limit)).SetSort(bson.D{{Key: "name", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := make([]*Role, 0, limit)
+
+	err = result.All(serv.Context(), &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return ret, nil
+}
+
+/*
+Update - Updates a role by its name. The following fields can be updated here: DisplayName, Description and Scopes. Scopes replaces
+the scopes of the role entirely, so the full list must always be provided. A nil Scopes leaves them unchanged, where an
+empty one removes them all. The name cannot be updated, as it is the basis for header.Identifier
+*/
+func Update(serv *server.Server, name string, patch *Role) error {
+	if name == "" {
+		return ErrRoleMissingId
+	}
+
+	update := make(bson.M)
+
+	if patch.DisplayName != "" {
+		update["display_name"] = patch.DisplayName
+	}
+
+	if patch.Description != "" {
+		update["description"] = patch.Description
+	}
+
+	if patch.Scopes != nil {
+		update["scopes"] = patch.Scopes
+	}
+
+	if len(update) == 0 {
+		return nil
+	}
+
+	result, err := serv.Database().Collection("role").UpdateOne(
+		serv.Context(),
+		bson.M{"name": name},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRoleDoesNotExist
+	}
+
+	return nil
+}
+
+/*
+Delete - Removes a role by its name, and unassigns it from every user it was assigned to, so that a role created later
+with the same name is not inherited by them. Tokens that were already issued with its scopes are not affected
+*/
+func Delete(serv *server.Server, name string) error {
+	if name == "" {
+		return ErrRoleMissingId
+	}
+
+	result, err := serv.Database().Collection("role").DeleteOne(serv.Context(), bson.M{"name": name})
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrRoleDoesNotExist
+	}
+
+	_, err = serv.Database().Collection("user").UpdateMany(
+		serv.Context(),
+		bson.M{"roles": name},
+		bson.M{"$pull": bson.M{"roles": name}},
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return nil
+}
+
+/*
+Assign - Assigns the role identified by its name to the user identified by their email address. The role must exist.
+Assigning a role that the user already has is not an error
+*/
+func Assign(serv *server.Server, email string, name string) error {
+	if email == "" {
+		return user.ErrUserMissingIdentifier
+	}
+
+	_, err := Get(serv, name)
+	if err != nil {
+		return err
+	}
+
+	return updateUserRoles(serv, email, bson.M{"$addToSet": bson.M{"roles": name}})
+}
+
+/*
+Unassign - Removes the role identified by its name from the user identified by their email address. Removing a role
+that the user does not have is not an error
+*/
+func Unassign(serv *server.Server, email string, name string) error {
+	if email == "" {
+		return user.ErrUserMissingIdentifier
+	}
+
+	if name == "" {
+		return ErrRoleMissingId
+	}
+
+	return updateUserRoles(serv, email, bson.M{"$pull": bson.M{"roles": name}})
+}
+
+/*
+updateUserRoles - Provides the shared update logic for Assign and Unassign
+*/
+func updateUserRoles(serv *server.Server, email string, update bson.M) error {
+	result, err := serv.Database().Collection("user").UpdateOne(
+		serv.Context(),
+		bson.M{"canonical_email": user.NormalizeEmail(email, serv.Config.EmailConfig)},
+		update,
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return user.ErrUserDoesNotExist
+	}
+
+	return nil
+}
+
+/*
+Expand - Returns every scope granted to the user provided in the parameter: the scopes assigned to them directly, along
+with the scopes of each of their roles. Roles that no longer exist are ignored. The returned scopes are not filtered to
+any audience
+*/
+func Expand(serv *server.Server, account *user.User) ([]string, error) {
+	ret := slices.Clone(account.Scopes)
+
+	if len(account.Roles) == 0 {
+		return ret, nil
+	}
+
+	result, err := serv.Database().Collection("role").Find(
+		serv.Context(),
+		bson.M{"name": bson.M{"$in": account.Roles}},
+		mongoOpts.Find().SetProjection(bson.M{"scopes": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var roles []*Role
+
+	err = result.All(serv.Context(), &roles)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	for _, role := range roles {
+		ret = append(ret, role.Scopes...)
+	}
+
+	slices.Sort(ret)
+
+	return slices.Compact(ret), nil
+}
+
+/*
+Grant - Determines the scopes a token issued on behalf of the user provided in the parameter is issued with, when the
+ResourceServer identified by its audience has EnforceRBAC set. Reserved scopes that were requested are always kept.
+Every other requested scope is kept only if the user was granted it directly or through a role, and the rest are
+dropped, so the token is issued with a narrower scope than requested (RFC 6749 section 3.3). If no other scope was
+requested, then every scope granted to the user that is registered on the audience is used instead (or every scope
+granted to the user, if the audience has no scopes registered). If no scope other than the reserved scopes remains, then
+ErrNoPermittedScopes is returned, as the user has no permission to access the audience.
+
+Returns the space separated scope string to issue the token with
+*/
+func Grant(serv *server.Server, account *user.User, audience string, requested string) (string, error) {
+	granted, err := Expand(serv, account)
+	if err != nil {
+		return "", err
+	}
+
+	var reserved, custom []string
+	for _, name := range strings.Fields(requested) {
+		if slices.Contains(scope.Reserved, name) {
+			reserved = append(reserved, name)
+		} else {
+			custom = append(custom, name)
+		}
+	}
+
+	if len(custom) != 0 {
+		custom = slices.DeleteFunc(custom, func(name string) bool {
+			return !slices.Contains(granted, name)
+		})
+	} else {
+		granted = slices.DeleteFunc(granted, func(name string) bool {
+			return slices.Contains(scope.Reserved, name)
+		})
+
+		custom, err = scope.Registered(serv, audience, granted)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if len(custom) == 0 {
+		return "", ErrNoPermittedScopes
+	}
+
+	return strings.Join(append(reserved, custom...), " "), nil
+}
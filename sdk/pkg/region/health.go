@@ -0,0 +1,166 @@
+package region
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+const (
+	// StatusOK - The region and every peer are healthy
+	StatusOK string = "ok"
+
+	// StatusDegradedGlobal - The region is healthy, but one or more peers cannot be reached. The region should keep serving requests, as routing them elsewhere would not help
+	StatusDegradedGlobal string = "degraded_global"
+
+	// StatusDegradedLocal - The region cannot reach the database. Requests should be routed to another region
+	StatusDegradedLocal string = "degraded_local"
+)
+
+// PathHealth - The path of the health endpoint, relative to a region's base URL
+const PathHealth = "/region/health"
+
+/*
+Probe - The result of checking a single dependency
+*/
+type Probe struct {
+	// Healthy - If set to true, then the dependency responded in time
+	Healthy bool `json:"healthy"`
+
+	// LatencyMs - How long the dependency took to respond, in milliseconds
+	LatencyMs int64 `json:"latency_ms"`
+
+	// Error - Why the dependency is unhealthy. Empty if it is healthy
+	Error string `json:"error,omitempty"`
+}
+
+/*
+Health - Describes the health of the region a server runs in, separately from the health of its peers. A load balancer
+only needs to route traffic away from a region when its own health is degraded (StatusDegradedLocal), as an unreachable
+peer does not prevent the region from serving requests
+*/
+type Health struct {
+	// Region - The name of the region
+	Region string `json:"region"`
+
+	// Status - The overall status. One of: ok, degraded_global, degraded_local
+	Status string `json:"status"`
+
+	// Local - The health of the region's connection to the database
+	Local Probe `json:"local"`
+
+	// Peers - The health of every peer, keyed by their name. Omitted if peers were not probed
+	Peers map[string]Probe `json:"peers,omitempty"`
+}
+
+/*
+Check - Checks the health of the region, and of every peer in RegionConfig.Peers if withPeers is set. Peers are probed
+concurrently with their local health endpoint, and are never asked to probe their own peers, so that probes do not cascade
+across the deployment
+*/
+func Check(serv *server.Server, withPeers bool) *Health {
+	ret := &Health{
+		Region: serv.Config.RegionConfig.Name,
+		Status: StatusOK,
+		Local:  checkLocal(serv),
+	}
+
+	if withPeers && len(serv.Config.RegionConfig.Peers) != 0 {
+		ret.Peers = checkPeers(serv)
+
+		for _, probe := range ret.Peers {
+			if !probe.Healthy {
+				ret.Status = StatusDegradedGlobal
+			}
+		}
+	}
+
+	if !ret.Local.Healthy {
+		ret.Status = StatusDegradedLocal
+	}
+
+	return ret
+}
+
+/*
+checkLocal - Checks that the database can be reached and written to. The circuit breaker is consulted first, so that
+the check fails fast while the database is known to be unavailable
+*/
+func checkLocal(serv *server.Server) Probe {
+	err := serv.Database().Available()
+	if err != nil {
+		return Probe{Error: err.Error()}
+	}
+
+	latency, err := serv.Database().Ping()
+	if err != nil {
+		return Probe{Error: err.Error()}
+	}
+
+	return Probe{Healthy: true, LatencyMs: latency.Milliseconds()}
+}
+
+/*
+checkPeers - Probes every peer concurrently, and returns their health keyed by their name
+*/
+func checkPeers(serv *server.Server) map[string]Probe {
+	peers := serv.Config.RegionConfig.Peers
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	ret := make(map[string]Probe, len(peers))
+	for name, base := range peers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			probe := checkPeer(serv.Clock(), base, serv.Config.RegionConfig.PeerTimeout)
+
+			mu.Lock()
+			ret[name] = probe
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	return ret
+}
+
+/*
+checkPeer - Requests the local health of the peer at the base URL provided in the parameter. The peer is healthy if it
+responds with a 200 before the timeout. The latency of the request is measured with the clock provided in the parameter
+*/
+func checkPeer(c clock.Clock, base string, timeout time.Duration) Probe {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+PathHealth+"?peers=false", nil)
+	if err != nil {
+		return Probe{Error: err.Error()}
+	}
+
+	start := c.Now()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Probe{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	latency := c.Now().Sub(start).Milliseconds()
+
+	if resp.StatusCode != http.StatusOK {
+		return Probe{LatencyMs: latency, Error: fmt.Sprintf("status code %d", resp.StatusCode)}
+	}
+
+	return Probe{Healthy: true, LatencyMs: latency}
+}
@@ -0,0 +1,120 @@
+package region
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/siem"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// RevocationKindToken - A single access token was revoked. The value is the SHA-256 hash of the access token, encoded as a hex string
+	RevocationKindToken string = "token"
+
+	// RevocationKindFamily - Every token issued by rotating the same refresh token was revoked. The value is the family
+	RevocationKindFamily string = "family"
+
+	// RevocationKindClient - Every token issued to a client was revoked. The value is the client ID
+	RevocationKindClient string = "client"
+
+	// RevocationKindSubject - Every token issued to a client on behalf of a user, or to every client if no client ID is recorded, was revoked. The value is the subject
+	RevocationKindSubject string = "subject"
+
+	// RevocationKindSession - Every token bound to a session of a user was revoked. The value is the identifier of the session, or the subject if every one of their sessions was signed out
+	RevocationKindSession string = "session"
+)
+
+// EventTokenRevoked - The event type revocations are published to the SIEM dispatcher with
+const EventTokenRevoked = "token.revoked"
+
+/*
+Revocation - Records that one or more tokens were revoked, so that every region can learn about it. Revocations are
+written to the shared database and published on the event dispatcher. Resource servers that validate tokens locally (and
+therefore never see the revoked flag) can follow the feed returned by Revocations to reject revoked tokens in every region
+*/
+type Revocation struct {
+	// Region - The region the tokens were revoked in
+	Region string `json:"region" bson:"region"`
+
+	// Kind - What was revoked. One of: token, family, client, subject, session
+	Kind string `json:"kind" bson:"kind"`
+
+	// Value - Identifies what was revoked. Its meaning depends on Kind
+	Value string `json:"value" bson:"value"`
+
+	// ClientId - The client the revoked tokens were issued to. Empty if it is not known
+	ClientId string `json:"client_id,omitempty" bson:"client_id,omitempty"`
+
+	// RevokedAt - A unix timestamp representing when the tokens were revoked
+	RevokedAt int64 `json:"revoked_at" bson:"revoked_at"`
+
+	// ExpiresAt - When the revocation is removed from the feed. This is stored as a date so that the TTL index on the
+	// collection can remove it, as tokens revoked this long ago have expired by themselves
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+RecordRevocation - Records that tokens were revoked, and publishes the revocation on the event dispatcher. The tokens
+have already been revoked in the database by the caller, so a failure here is logged instead of returned, as the
+revocation itself succeeded. If the server is not region-aware, then nothing is recorded
+*/
+func RecordRevocation(serv *server.Server, kind string, value string, clientId string) {
+	regionConfig := serv.Config.RegionConfig
+	if regionConfig.Name == "" || value == "" {
+		return
+	}
+
+	now := serv.Clock().Now()
+
+	revocation := &Revocation{
+		Region:    regionConfig.Name,
+		Kind:      kind,
+		Value:     value,
+		ClientId:  clientId,
+		RevokedAt: now.Unix(),
+		ExpiresAt: now.Add(regionConfig.RevocationRetention),
+	}
+
+	_, err := serv.Database().Collection("revocation").InsertOne(serv.Context(), revocation)
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to record "+kind+" revocation for other regions", err)
+	}
+
+	serv.SIEM().Publish(siem.Event{
+		Time: revocation.RevokedAt,
+		Type: EventTokenRevoked,
+		Data: *revocation,
+	})
+}
+
+/*
+Revocations - Lists the revocations recorded in every region at or after the unix timestamp provided in the parameter,
+oldest first, so that a follower can resume from the RevokedAt of the last revocation it processed. The maximum that can
+be returned in a single call is 100, and if a limit exceeds this, it will be reset to 100
+*/
+func Revocations(serv *server.Server, since int64, limit int) ([]*Revocation, error) {
+	if limit > 100 || limit <= 0 {
+		limit = 100
+	}
+
+	result, err := serv.Database().Collection("revocation").Find(
+		serv.Context(),
+		bson.M{"revoked_at": bson.M{"$gte": since}},
+		mongoOpts.Find().SetLimit(int64(limit)).SetSort(bson.D{{Key: "revoked_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := make([]*Revocation, 0, limit)
+
+	err = result.All(serv.Context(), &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,392 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+/*
+filter - A parsed SCIM filter expression (RFC 7644 section 3.4.2.2). Filters are either compiled to a MongoDB query
+(see compile) when resources are listed, or evaluated against the values of a multi-valued attribute (see matches) when
+they select the values a PATCH operation applies to
+*/
+type filter interface{}
+
+/*
+comparison - Compares an attribute with a value. The attribute is its lowercased path, without the schema URN
+(emails.value). The pr operator has no value
+*/
+type comparison struct {
+	attr  string
+	op    string
+	value any
+}
+
+/*
+logical - Combines two filters with and or or
+*/
+type logical struct {
+	op    string
+	left  filter
+	right filter
+}
+
+/*
+negation - Negates a filter (not)
+*/
+type negation struct {
+	inner filter
+}
+
+/*
+valuePath - Applies a filter to the values of a multi-valued attribute (emails[type eq "work"]), matching if any value
+of it matches. The attributes the inner filter compares are relative to the multi-valued attribute
+*/
+type valuePath struct {
+	attr  string
+	inner filter
+}
+
+/*
+parseFilter - Parses the filter expression provided in the parameter. The and operator binds tighter than or, and not
+must be followed by a parenthesized filter. If the expression is malformed, then ErrInvalidFilter is returned
+*/
+func parseFilter(expression string) (filter, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterParser{tokens: tokens}
+
+	ret, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("%w (unexpected %q)", ErrInvalidFilter, p.tokens[p.pos].text)
+	}
+
+	return ret, nil
+}
+
+/*
+filterToken - A token of a filter expression. Quoted strings are unquoted, and the text of every other token is kept as it was
+written
+*/
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+/*
+tokenize - Splits a filter expression into tokens: quoted strings, parentheses, brackets, and words (attribute paths,
+operators and literals)
+*/
+func tokenize(expression string) ([]filterToken, error) {
+	var ret []filterToken
+
+	for i := 0; i < len(expression); {
+		c := rune(expression[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			ret = append(ret, filterToken{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expression) && expression[end] != '"' {
+				if expression[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			if end >= len(expression) {
+				return nil, fmt.Errorf("%w (unterminated string)", ErrInvalidFilter)
+			}
+
+			var value string
+
+			err := json.Unmarshal([]byte(expression[i:end+1]), &value)
+			if err != nil {
+				return nil, fmt.Errorf("%w (%v)", ErrInvalidFilter, err)
+			}
+
+			ret = append(ret, filterToken{text: value, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(expression) && !unicode.IsSpace(rune(expression[end])) && !strings.ContainsRune("()[]\"", rune(expression[end])) {
+				end++
+			}
+
+			ret = append(ret, filterToken{text: expression[i:end]})
+			i = end
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+filterParser - A recursive descent parser over the tokens of a filter expression
+*/
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+/*
+peek - Returns the next token as a lowercased keyword, or an empty string if there are no tokens left or the next token
+is a quoted string
+*/
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return ""
+	}
+
+	return strings.ToLower(p.tokens[p.pos].text)
+}
+
+/*
+expect - Consumes the next token, which must be the punctuation provided in the parameter
+*/
+func (p *filterParser) expect(text string) error {
+	if p.peek() != text {
+		return fmt.Errorf("%w (expected %q)", ErrInvalidFilter, text)
+	}
+
+	p.pos++
+
+	return nil
+}
+
+func (p *filterParser) or() (filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "or" {
+		p.pos++
+
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+
+		left = logical{op: "or", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) and() (filter, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "and" {
+		p.pos++
+
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = logical{op: "and", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) unary() (filter, error) {
+	switch p.peek() {
+	case "not":
+		p.pos++
+
+		err := p.expect("(")
+		if err != nil {
+			return nil, err
+		}
+
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		return negation{inner: inner}, p.expect(")")
+	case "(":
+		p.pos++
+
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		return inner, p.expect(")")
+	case "":
+		return nil, fmt.Errorf("%w (expected an attribute)", ErrInvalidFilter)
+	}
+
+	attr := normalizePath(p.tokens[p.pos].text)
+	p.pos++
+
+	if p.peek() == "[" {
+		p.pos++
+
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.expect("]")
+		if err != nil {
+			return nil, err
+		}
+
+		return valuePath{attr: attr, inner: inner}, nil
+	}
+
+	op := p.peek()
+	p.pos++
+
+	switch op {
+	case "pr":
+		return comparison{attr: attr, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("%w (unknown operator %q)", ErrInvalidFilter, op)
+	}
+
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("%w (expected a value)", ErrInvalidFilter)
+	}
+
+	value := p.tokens[p.pos]
+	p.pos++
+
+	if value.quoted {
+		return comparison{attr: attr, op: op, value: value.text}, nil
+	}
+
+	var literal any
+
+	err := json.Unmarshal([]byte(value.text), &literal)
+	if err != nil {
+		return nil, fmt.Errorf("%w (invalid value %q)", ErrInvalidFilter, value.text)
+	}
+
+	return comparison{attr: attr, op: op, value: literal}, nil
+}
+
+/*
+normalizePath - Lowercases an attribute path, as attribute names are case insensitive, and removes the URN of the core
+schemas from it, so that fully qualified paths (urn:ietf:params:scim:schemas:core:2.0:User:userName) are handled like
+the attribute they name
+*/
+func normalizePath(path string) string {
+	path = strings.ToLower(path)
+
+	for _, schema := range []string{SchemaUser, SchemaGroup} {
+		if prefix := strings.ToLower(schema) + ":"; strings.HasPrefix(path, prefix) {
+			return strings.TrimPrefix(path, prefix)
+		}
+	}
+
+	return path
+}
+
+/*
+matches - Evaluates the filter against a value of a multi-valued attribute, decoded from JSON. Attribute names are
+compared case insensitively, as are strings. Only comparisons of the sub-attributes of the value are supported, as this
+is only used for the value filters of PATCH paths
+*/
+func matches(f filter, value map[string]any) bool {
+	switch typed := f.(type) {
+	case logical:
+		if typed.op == "and" {
+			return matches(typed.left, value) && matches(typed.right, value)
+		}
+
+		return matches(typed.left, value) || matches(typed.right, value)
+	case negation:
+		return !matches(typed.inner, value)
+	case comparison:
+		actual, ok := lookup(value, typed.attr)
+		if typed.op == "pr" {
+			return ok && actual != nil && actual != ""
+		}
+
+		return ok && compareValues(actual, typed.op, typed.value)
+	default:
+		return false
+	}
+}
+
+/*
+lookup - Returns the attribute of the JSON object provided in the parameter with the lowercased name, comparing names
+case insensitively
+*/
+func lookup(value map[string]any, name string) (any, bool) {
+	for key, attr := range value {
+		if strings.ToLower(key) == name {
+			return attr, true
+		}
+	}
+
+	return nil, false
+}
+
+/*
+compareValues - Compares two values decoded from JSON with a SCIM comparison operator. Strings are compared case
+insensitively
+*/
+func compareValues(actual any, op string, expected any) bool {
+	actualString, actualOk := actual.(string)
+	expectedString, expectedOk := expected.(string)
+
+	if !actualOk || !expectedOk {
+		switch op {
+		case "eq":
+			return fmt.Sprint(actual) == fmt.Sprint(expected)
+		case "ne":
+			return fmt.Sprint(actual) != fmt.Sprint(expected)
+		default:
+			return false
+		}
+	}
+
+	actualString, expectedString = strings.ToLower(actualString), strings.ToLower(expectedString)
+
+	switch op {
+	case "eq":
+		return actualString == expectedString
+	case "ne":
+		return actualString != expectedString
+	case "co":
+		return strings.Contains(actualString, expectedString)
+	case "sw":
+		return strings.HasPrefix(actualString, expectedString)
+	case "ew":
+		return strings.HasSuffix(actualString, expectedString)
+	case "gt":
+		return actualString > expectedString
+	case "ge":
+		return actualString >= expectedString
+	case "lt":
+		return actualString < expectedString
+	case "le":
+		return actualString <= expectedString
+	default:
+		return false
+	}
+}
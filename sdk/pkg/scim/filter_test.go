@@ -0,0 +1,180 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func eq(attr string, value any) comparison {
+	return comparison{attr: attr, op: "eq", value: value}
+}
+
+func pr(attr string) comparison {
+	return comparison{attr: attr, op: "pr"}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       filter
+	}{
+		{
+			name:       "comparison",
+			expression: `userName eq "bjensen"`,
+			want:       eq("username", "bjensen"),
+		},
+		{
+			name:       "and binds tighter than or",
+			expression: `title pr or userType eq "Employee" and active eq true`,
+			want:       logical{op: "or", left: pr("title"), right: logical{op: "and", left: eq("usertype", "Employee"), right: eq("active", true)}},
+		},
+		{
+			name:       "and binds tighter than a trailing or",
+			expression: `title pr and userType eq "Employee" or active eq true`,
+			want:       logical{op: "or", left: logical{op: "and", left: pr("title"), right: eq("usertype", "Employee")}, right: eq("active", true)},
+		},
+		{
+			name:       "parentheses override precedence",
+			expression: `(title pr or userType eq "Employee") and active eq true`,
+			want:       logical{op: "and", left: logical{op: "or", left: pr("title"), right: eq("usertype", "Employee")}, right: eq("active", true)},
+		},
+		{
+			name:       "left associative",
+			expression: `a pr and b pr and c pr`,
+			want:       logical{op: "and", left: logical{op: "and", left: pr("a"), right: pr("b")}, right: pr("c")},
+		},
+		{
+			name:       "not applies to its parentheses only",
+			expression: `not (title pr) and active eq true`,
+			want:       logical{op: "and", left: negation{inner: pr("title")}, right: eq("active", true)},
+		},
+		{
+			name:       "operators are case insensitive",
+			expression: `userName EQ "bjensen" AND title Pr`,
+			want:       logical{op: "and", left: eq("username", "bjensen"), right: pr("title")},
+		},
+		{
+			name:       "fully qualified attribute",
+			expression: `urn:ietf:params:scim:schemas:core:2.0:User:name.familyName co "O'Malley"`,
+			want:       comparison{attr: "name.familyname", op: "co", value: "O'Malley"},
+		},
+		{
+			name:       "escaped quotes",
+			expression: `displayName eq "say \"hi\""`,
+			want:       eq("displayname", `say "hi"`),
+		},
+		{
+			name:       "keywords and punctuation inside quotes",
+			expression: `displayName eq "(a or b) and [c]"`,
+			want:       eq("displayname", "(a or b) and [c]"),
+		},
+		{
+			name:       "quoted keyword",
+			expression: `userName eq "or"`,
+			want:       eq("username", "or"),
+		},
+		{
+			name:       "unicode escape",
+			expression: `displayName sw "\u00e9"`,
+			want:       comparison{attr: "displayname", op: "sw", value: "é"},
+		},
+		{
+			name:       "literals",
+			expression: `active eq false or count gt 42 or manager eq null`,
+			want:       logical{op: "or", left: logical{op: "or", left: eq("active", false), right: comparison{attr: "count", op: "gt", value: float64(42)}}, right: eq("manager", nil)},
+		},
+		{
+			name:       "value path",
+			expression: `emails[type eq "work" and value co "@example.com"]`,
+			want:       valuePath{attr: "emails", inner: logical{op: "and", left: eq("type", "work"), right: comparison{attr: "value", op: "co", value: "@example.com"}}},
+		},
+		{
+			name:       "value path combined with a comparison",
+			expression: `userType eq "Employee" and emails[type eq "work"]`,
+			want:       logical{op: "and", left: eq("usertype", "Employee"), right: valuePath{attr: "emails", inner: eq("type", "work")}},
+		},
+		{
+			name:       "value path containing or",
+			expression: `emails[type eq "work" or primary eq true] or title pr`,
+			want:       logical{op: "or", left: valuePath{attr: "emails", inner: logical{op: "or", left: eq("type", "work"), right: eq("primary", true)}}, right: pr("title")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseFilter(test.expression)
+			if err != nil {
+				t.Fatalf("parseFilter(%q): %v", test.expression, err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("parseFilter(%q) = %#v, want %#v", test.expression, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterMalformed(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+	}{
+		{name: "empty", expression: ``},
+		{name: "attribute only", expression: `userName`},
+		{name: "missing value", expression: `userName eq`},
+		{name: "unknown operator", expression: `userName like "b%"`},
+		{name: "unquoted string", expression: `userName eq bjensen`},
+		{name: "unterminated string", expression: `userName eq "bjensen`},
+		{name: "escaped closing quote", expression: `userName eq "bjensen\"`},
+		{name: "trailing escape", expression: `userName eq "bjensen\`},
+		{name: "invalid escape", expression: `userName eq "\q"`},
+		{name: "quoted attribute", expression: `"userName" eq "bjensen"`},
+		{name: "dangling or", expression: `userName eq "bjensen" or`},
+		{name: "leading and", expression: `and userName eq "bjensen"`},
+		{name: "unclosed parenthesis", expression: `(userName pr`},
+		{name: "unopened parenthesis", expression: `userName pr)`},
+		{name: "not without parentheses", expression: `not userName pr`},
+		{name: "unclosed value path", expression: `emails[type eq "work"`},
+		{name: "empty value path", expression: `emails[]`},
+		{name: "trailing tokens", expression: `userName pr title pr`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseFilter(test.expression)
+			if !errors.Is(err, ErrInvalidFilter) {
+				t.Fatalf("parseFilter(%q) = %#v, %v, want ErrInvalidFilter", test.expression, got, err)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	value := map[string]any{"Value": "BJensen@Example.com", "type": "work", "primary": true}
+
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{expression: `value eq "bjensen@example.com"`, want: true},
+		{expression: `VALUE ew "@example.com"`, want: true},
+		{expression: `type eq "home"`, want: false},
+		{expression: `primary eq true`, want: true},
+		{expression: `display pr`, want: false},
+		{expression: `type eq "home" or primary eq true`, want: true},
+		{expression: `type eq "work" and not (primary eq true)`, want: false},
+	}
+
+	for _, test := range tests {
+		f, err := parseFilter(test.expression)
+		if err != nil {
+			t.Fatalf("parseFilter(%q): %v", test.expression, err)
+		}
+
+		if got := matches(f, value); got != test.want {
+			t.Errorf("matches(%q) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package scim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/rbac/role"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+/*
+Group - A group as it is represented to directories (RFC 7643 section 4.2). Groups are stored as roles, and their
+members are the users the role is assigned to, so that group memberships in the directory control the scopes users are
+granted through RBAC
+*/
+type Group struct {
+	// Schemas - Always SchemaGroup
+	Schemas []string `json:"schemas"`
+
+	// Id - The header identifier of the role
+	Id string `json:"id,omitempty"`
+
+	// DisplayName - The display name of the role (see role.Role.DisplayName)
+	DisplayName string `json:"displayName"`
+
+	// Members - The users the role is assigned to. Only users can be members, as roles cannot be nested
+	Members []MultiValue `json:"members,omitempty"`
+
+	// Meta - The metadata of the group. Read-only
+	Meta *Meta `json:"meta,omitempty"`
+}
+
+/*
+groupAttributes - The attributes groups can be filtered by
+*/
+var groupAttributes = map[string]attribute{
+	"id":                {field: "header.identifier", kind: kindString, caseExact: true},
+	"displayname":       {resolve: resolveDisplayName},
+	"members":           {resolve: resolveMember},
+	"members.value":     {resolve: resolveMember},
+	"meta.created":      {field: "header.created_at", kind: kindDateTime},
+	"meta.lastmodified": {field: "header.updated_at", kind: kindDateTime},
+}
+
+/*
+resolveDisplayName - Compiles comparisons of the display name of a group. Roles that were not provisioned have no display
+name, and are shown with their name instead
+*/
+func resolveDisplayName(serv *server.Server, op string, value any) (bson.M, error) {
+	displayName, err := compileComparison(attribute{field: "display_name", kind: kindString}, comparison{attr: "displayname", op: op, value: value})
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := compileComparison(attribute{field: "name", kind: kindString}, comparison{attr: "displayname", op: op, value: value})
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.M{"$or": bson.A{
+		displayName,
+		bson.M{"$and": bson.A{bson.M{"display_name": bson.M{"$in": bson.A{nil, ""}}}, name}},
+	}}, nil
+}
+
+/*
+resolveMember - Compiles eq comparisons of the members of a group, which match the roles assigned to the user with the
+identifier being compared with
+*/
+func resolveMember(serv *server.Server, op string, value any) (bson.M, error) {
+	id, ok := value.(string)
+	if op != "eq" || !ok {
+		return nil, fmt.Errorf("%w (members can only be compared with eq)", ErrInvalidFilter)
+	}
+
+	account, err := user.GetByIdentifier(serv, id, false)
+	if errors.Is(err, user.ErrUserDoesNotExist) {
+		return bson.M{"name": bson.M{"$in": bson.A{}}}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.M{"name": bson.M{"$in": account.Roles}}, nil
+}
+
+/*
+displayName - Returns the name the role is shown to directories with
+*/
+func displayName(r *role.Role) string {
+	if r.DisplayName != "" {
+		return r.DisplayName
+	}
+
+	return r.Name
+}
+
+// invalidRoleName - Matches the characters that cannot be used in role names (see role.New)
+var invalidRoleName = regexp.MustCompile(`[\x00-\x20"\\\x7f-\x{10FFFF}]+`)
+
+/*
+roleName - Returns the name of the role a group is provisioned as. Group names commonly contain spaces, which role names
+cannot, so these are replaced with dashes. When a display name has to be changed to be used as a role name, a hash of it
+is appended, so that two groups whose names only differ in those characters are provisioned as different roles. Names
+without any character that can be kept are provisioned as group followed by the hash
+*/
+func roleName(displayName string) string {
+	name := invalidRoleName.ReplaceAllString(displayName, "-")
+	if name == displayName {
+		return name
+	}
+
+	name = strings.Trim(name, "-")
+	if name == "" {
+		name = "group"
+	}
+
+	sum := sha256.Sum256([]byte(displayName))
+
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
+
+/*
+getRole - Fetches a role by its header identifier. If the role does not exist, then ErrResourceNotFound is returned
+*/
+func getRole(serv *server.Server, id string) (*role.Role, error) {
+	var ret role.Role
+
+	err := serv.Database().Collection("role").FindOne(serv.Context(), bson.M{"header.identifier": id}).Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrResourceNotFound
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+toGroup - Converts a role to its SCIM representation. Its members are only fetched if withMembers is set, as directories
+exclude them when they only need the group itself, and groups can have many members
+*/
+func toGroup(serv *server.Server, r *role.Role, withMembers bool, issuer string) (*Group, error) {
+	ret := &Group{
+		Schemas:     []string{SchemaGroup},
+		Id:          r.Header.Identifier,
+		DisplayName: displayName(r),
+		Meta:        newMeta("Group", r.Header.Identifier, r.Header.CreatedAt, r.Header.UpdatedAt, issuer),
+	}
+
+	if !withMembers {
+		return ret, nil
+	}
+
+	result, err := serv.Database().Collection("user").Find(
+		serv.Context(),
+		bson.M{"roles": r.Name},
+		mongoOpts.Find().SetProjection(bson.M{"header": 1, "username": 1}).SetSort(bson.D{{Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var members []*user.User
+
+	err = result.All(serv.Context(), &members)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	for _, member := range members {
+		ret.Members = append(ret.Members, MultiValue{
+			Value:   member.Header.Identifier,
+			Display: member.Username,
+			Ref:     strings.TrimSuffix(issuer, "/") + PathBase + "/Users/" + member.Header.Identifier,
+		})
+	}
+
+	return ret, nil
+}
+
+/*
+CreateGroup - Provisions the group provided in the parameter as a new role (see roleName), assigns it to its members, and
+returns it as it was stored. If a role already exists under the same name, then ErrUniqueness is returned
+*/
+func CreateGroup(serv *server.Server, resource *Group, issuer string) (*Group, error) {
+	if resource.DisplayName == "" {
+		return nil, fmt.Errorf("%w (displayName is required)", ErrInvalidValue)
+	}
+
+	created := &role.Role{Name: roleName(resource.DisplayName), DisplayName: resource.DisplayName}
+
+	err := role.New(serv, created)
+	if err != nil {
+		if errors.Is(err, role.ErrRoleAlreadyExists) {
+			return nil, ErrUniqueness
+		}
+
+		return nil, err
+	}
+
+	err = setMembers(serv, created, nil, resource.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	return toGroup(serv, created, true, issuer)
+}
+
+/*
+GetGroup - Returns the group with the identifier provided in the parameter, with its members if withMembers is set. If
+the group does not exist, then ErrResourceNotFound is returned
+*/
+func GetGroup(serv *server.Server, id string, withMembers bool, issuer string) (*Group, error) {
+	found, err := getRole(serv, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toGroup(serv, found, withMembers, issuer)
+}
+
+/*
+ReplaceGroup - Replaces the display name and members of the group with the identifier provided in the parameter with
+those of the group provided in the parameter, and returns it as it was stored. Users that are no longer members have the
+role unassigned from them. The name of the role never changes, so renaming a group only changes its display name
+*/
+func ReplaceGroup(serv *server.Server, id string, resource *Group, issuer string) (*Group, error) {
+	current, err := GetGroup(serv, id, true, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceGroup(serv, current, resource, issuer)
+}
+
+/*
+PatchGroup - Applies the operations of the PATCH request provided in the parameter to the group with the identifier
+provided in the parameter, and returns it as it was stored. Directories add and remove members by patching members
+*/
+func PatchGroup(serv *server.Server, id string, patch *PatchRequest, issuer string) (*Group, error) {
+	current, err := GetGroup(serv, id, true, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	patched := *current
+	patched.Members = append([]MultiValue(nil), current.Members...)
+
+	err = applyPatch(&patched, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceGroup(serv, current, &patched, issuer)
+}
+
+/*
+replaceGroup - Provides the shared update logic for ReplaceGroup and PatchGroup
+*/
+func replaceGroup(serv *server.Server, current *Group, resource *Group, issuer string) (*Group, error) {
+	if resource.DisplayName == "" {
+		return nil, fmt.Errorf("%w (displayName is required)", ErrInvalidValue)
+	}
+
+	found, err := getRole(serv, current.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if resource.DisplayName != current.DisplayName {
+		err = role.Update(serv, found.Name, &role.Role{DisplayName: resource.DisplayName})
+		if err != nil {
+			return nil, err
+		}
+
+		found.DisplayName = resource.DisplayName
+	}
+
+	err = setMembers(serv, found, current.Members, resource.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	return toGroup(serv, found, true, issuer)
+}
+
+/*
+setMembers - Assigns the role to the users that are members of the group and were not before, and unassigns it from the
+users that no longer are. If any new member does not exist, then ErrInvalidValue is returned and no membership is changed
+*/
+func setMembers(serv *server.Server, r *role.Role, current []MultiValue, desired []MultiValue) error {
+	before := make(map[string]bool, len(current))
+	for _, member := range current {
+		before[member.Value] = true
+	}
+
+	after := make(map[string]bool, len(desired))
+	for _, member := range desired {
+		after[member.Value] = true
+	}
+
+	var added, removed []string
+
+	for id := range after {
+		if !before[id] {
+			added = append(added, id)
+		}
+	}
+
+	for id := range before {
+		if !after[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	collection := serv.Database().Collection("user")
+
+	if len(added) != 0 {
+		count, err := collection.CountDocuments(serv.Context(), bson.M{"header.identifier": bson.M{"$in": added}})
+		if err != nil {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		if count != int64(len(added)) {
+			return fmt.Errorf("%w (every member must be an existing user)", ErrInvalidValue)
+		}
+
+		_, err = collection.UpdateMany(
+			serv.Context(),
+			bson.M{"header.identifier": bson.M{"$in": added}},
+			bson.M{"$addToSet": bson.M{"roles": r.Name}},
+		)
+		if err != nil {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+	}
+
+	if len(removed) != 0 {
+		_, err := collection.UpdateMany(
+			serv.Context(),
+			bson.M{"header.identifier": bson.M{"$in": removed}},
+			bson.M{"$pull": bson.M{"roles": r.Name}},
+		)
+		if err != nil {
+			return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+	}
+
+	return nil
+}
+
+/*
+DeleteGroup - Deletes the role of the group with the identifier provided in the parameter, which unassigns it from every
+member (see role.Delete). If the group does not exist, then ErrResourceNotFound is returned
+*/
+func DeleteGroup(serv *server.Server, id string) error {
+	found, err := getRole(serv, id)
+	if err != nil {
+		return err
+	}
+
+	err = role.Delete(serv, found.Name)
+	if errors.Is(err, role.ErrRoleDoesNotExist) {
+		return ErrResourceNotFound
+	}
+
+	return err
+}
+
+/*
+ListGroups - Returns the page of groups matching the filter provided in the parameter, sorted by name, with their members
+if withMembers is set. The start index is 1-based, and the count is limited to ScimConfig.MaxResults. An empty filter
+matches every group
+*/
+func ListGroups(serv *server.Server, expression string, startIndex int, count int, withMembers bool, issuer string) (*ListResponse, error) {
+	var f filter
+
+	if expression != "" {
+		var err error
+
+		f, err = parseFilter(expression)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query, err := compile(serv, f, groupAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	startIndex, count = page(serv, startIndex, count)
+
+	collection := serv.Database().ReadCollection("role", server.ReadClassList)
+
+	total, err := collection.CountDocuments(serv.Context(), query)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := &ListResponse{Schemas: []string{SchemaListResponse}, TotalResults: total, StartIndex: startIndex, Resources: []any{}}
+
+	if count == 0 {
+		return ret, nil
+	}
+
+	result, err := collection.Find(
+		serv.Context(),
+		query,
+		mongoOpts.Find().SetSort(bson.D{{Key: "name", Value: 1}}).SetSkip(int64(startIndex-1)).SetLimit(int64(count)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var roles []*role.Role
+
+	err = result.All(serv.Context(), &roles)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	for _, found := range roles {
+		group, err := toGroup(serv, found, withMembers, issuer)
+		if err != nil {
+			return nil, err
+		}
+
+		ret.Resources = append(ret.Resources, group)
+	}
+
+	ret.ItemsPerPage = len(ret.Resources)
+
+	return ret, nil
+}
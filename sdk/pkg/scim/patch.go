@@ -0,0 +1,394 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+/*
+PatchRequest - The body of a PATCH request (RFC 7644 section 3.5.2)
+*/
+type PatchRequest struct {
+	// Schemas - Always SchemaPatchOp
+	Schemas []string `json:"schemas"`
+
+	// Operations - The operations to apply, in order
+	Operations []PatchOperation `json:"Operations"`
+}
+
+/*
+PatchOperation - A single operation of a PATCH request
+*/
+type PatchOperation struct {
+	// Op - The operation: add, replace or remove. Compared case insensitively, as some directories send Replace
+	Op string `json:"op"`
+
+	// Path - The attribute the operation applies to (name.givenName, emails[type eq "work"].value). Optional for add and replace, in which case Value is an object of the attributes to apply
+	Path string `json:"path,omitempty"`
+
+	// Value - The value to add or replace with. Optional for remove
+	Value any `json:"value,omitempty"`
+}
+
+/*
+applyPatch - Applies the operations of a PATCH request to a resource provided in the parameter, which must be a pointer
+to a User or Group. The resource is converted to its JSON form, the operations are applied to it, and it is decoded back
+into the resource, so that every attribute supports the same PATCH semantics. Attributes the resource does not define,
+like those of extension schemas, are dropped when it is decoded
+*/
+func applyPatch(resource any, patch *PatchRequest) error {
+	encoded, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]any
+
+	err = json.Unmarshal(encoded, &doc)
+	if err != nil {
+		return err
+	}
+
+	for _, operation := range patch.Operations {
+		err = applyOperation(doc, strings.ToLower(operation.Op), operation.Path, operation.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	/*
+		Some directories (Entra ID) send booleans as the strings True and False
+	*/
+	if key, ok := keyFor(doc, "active"); ok {
+		if value, isString := doc[key].(string); isString {
+			doc[key] = strings.EqualFold(value, "true")
+		}
+	}
+
+	encoded, err = json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	/*
+		Decoding into the resource only sets the attributes that are present, so it is cleared first for removed
+		attributes to stay removed
+	*/
+	reflect.ValueOf(resource).Elem().SetZero()
+
+	err = json.Unmarshal(encoded, resource)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrInvalidValue, err)
+	}
+
+	return nil
+}
+
+/*
+applyOperation - Applies a single operation to the JSON form of a resource. Operations without a path apply each
+attribute of their value as if it was the path
+*/
+func applyOperation(doc map[string]any, op string, path string, value any) error {
+	if op != "add" && op != "replace" && op != "remove" {
+		return fmt.Errorf("%w (unknown operation %q)", ErrInvalidSyntax, op)
+	}
+
+	if path == "" {
+		attrs, ok := value.(map[string]any)
+		if op == "remove" || !ok {
+			return ErrNoTarget
+		}
+
+		for name, attrValue := range attrs {
+			err := applyOperation(doc, op, name, attrValue)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	attr, valueFilter, sub, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	/*
+		Attributes of schemas other than the core schemas are not stored, so operations on them are ignored
+	*/
+	if strings.HasPrefix(attr, "urn:") {
+		return nil
+	}
+
+	key, _ := keyFor(doc, attr)
+
+	if valueFilter != nil {
+		return applyFiltered(doc, key, op, valueFilter, sub, value)
+	}
+
+	if sub != "" {
+		object, ok := doc[key].(map[string]any)
+		if !ok {
+			if _, isArray := doc[key].([]any); isArray {
+				return fmt.Errorf("%w (%s is multi-valued)", ErrInvalidPath, path)
+			}
+
+			if op == "remove" {
+				return nil
+			}
+
+			object = map[string]any{}
+			doc[key] = object
+		}
+
+		subKey, _ := keyFor(object, sub)
+
+		if op == "remove" {
+			delete(object, subKey)
+		} else {
+			object[subKey] = value
+		}
+
+		return nil
+	}
+
+	existing, exists := doc[key]
+
+	switch op {
+	case "remove":
+		values, isArray := existing.([]any)
+		removed, hasValue := value.([]any)
+
+		/*
+			Entra ID removes members by sending the values to remove instead of a filter
+		*/
+		if isArray && hasValue {
+			doc[key] = without(values, removed)
+		} else {
+			delete(doc, key)
+		}
+	case "add":
+		if values, isArray := existing.([]any); isArray {
+			added, addingArray := value.([]any)
+			if !addingArray {
+				added = []any{value}
+			}
+
+			doc[key] = append(values, without(added, values)...)
+
+			return nil
+		}
+
+		if !exists {
+			doc[key] = value
+			return nil
+		}
+
+		fallthrough
+	case "replace":
+		/*
+			Replacing a complex attribute only replaces the sub-attributes that are provided (RFC 7644 section 3.5.2.3)
+		*/
+		object, isObject := existing.(map[string]any)
+		replacement, replacingObject := value.(map[string]any)
+
+		if isObject && replacingObject {
+			for name, subValue := range replacement {
+				subKey, _ := keyFor(object, name)
+				object[subKey] = subValue
+			}
+
+			return nil
+		}
+
+		doc[key] = value
+	}
+
+	return nil
+}
+
+/*
+applyFiltered - Applies an operation to the values of a multi-valued attribute that match the value filter provided in
+the parameter. If no value matches an add or replace operation, then a value is created from the filter when it only
+consists of eq comparisons (emails[type eq "work"].value), as directories expect
+*/
+func applyFiltered(doc map[string]any, key string, op string, valueFilter filter, sub string, value any) error {
+	values, _ := doc[key].([]any)
+
+	var kept []any
+
+	matched := false
+
+	for _, element := range values {
+		object, ok := element.(map[string]any)
+		if !ok || !matches(valueFilter, object) {
+			kept = append(kept, element)
+			continue
+		}
+
+		matched = true
+
+		switch {
+		case op == "remove" && sub == "":
+			continue
+		case op == "remove":
+			subKey, _ := keyFor(object, sub)
+			delete(object, subKey)
+		case sub != "":
+			subKey, _ := keyFor(object, sub)
+			object[subKey] = value
+		default:
+			replacement, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%w (the value must be an object)", ErrInvalidValue)
+			}
+
+			for name, subValue := range replacement {
+				subKey, _ := keyFor(object, name)
+				object[subKey] = subValue
+			}
+		}
+
+		kept = append(kept, object)
+	}
+
+	if !matched && op != "remove" {
+		seeded, ok := seed(valueFilter)
+		if !ok || sub == "" {
+			return fmt.Errorf("%w (no value matches the filter)", ErrNoTarget)
+		}
+
+		seeded[sub] = value
+		kept = append(kept, seeded)
+	}
+
+	doc[key] = kept
+
+	return nil
+}
+
+/*
+seed - Returns the value described by a filter that only consists of eq comparisons joined with and, and false for any
+other filter
+*/
+func seed(f filter) (map[string]any, bool) {
+	switch typed := f.(type) {
+	case comparison:
+		if typed.op != "eq" {
+			return nil, false
+		}
+
+		return map[string]any{typed.attr: typed.value}, true
+	case logical:
+		if typed.op != "and" {
+			return nil, false
+		}
+
+		left, ok := seed(typed.left)
+		if !ok {
+			return nil, false
+		}
+
+		right, ok := seed(typed.right)
+		if !ok {
+			return nil, false
+		}
+
+		for name, value := range right {
+			left[name] = value
+		}
+
+		return left, true
+	default:
+		return nil, false
+	}
+}
+
+/*
+parsePath - Splits the path of a PATCH operation into the attribute it applies to, the filter selecting the values of a
+multi-valued attribute, and the sub-attribute: attr[filter].sub. The attribute and sub-attribute are lowercased, and the
+filter and sub-attribute are optional
+*/
+func parsePath(path string) (string, filter, string, error) {
+	path = normalizePath(path)
+
+	open := strings.IndexByte(path, '[')
+	if open == -1 {
+		/*
+			The schema URN of extension attributes contains dots, so only the part after its last colon is split
+		*/
+		name := path[strings.LastIndexByte(path, ':')+1:]
+		if dot := strings.IndexByte(name, '.'); dot != -1 {
+			split := len(path) - len(name) + dot
+			return path[:split], nil, path[split+1:], nil
+		}
+
+		return path, nil, "", nil
+	}
+
+	end := strings.LastIndexByte(path, ']')
+	if end < open {
+		return "", nil, "", fmt.Errorf("%w (%s)", ErrInvalidPath, path)
+	}
+
+	valueFilter, err := parseFilter(path[open+1 : end])
+	if err != nil {
+		return "", nil, "", fmt.Errorf("%w (%v)", ErrInvalidPath, err)
+	}
+
+	rest := path[end+1:]
+	if rest != "" && !strings.HasPrefix(rest, ".") {
+		return "", nil, "", fmt.Errorf("%w (%s)", ErrInvalidPath, path)
+	}
+
+	return path[:open], valueFilter, strings.TrimPrefix(rest, "."), nil
+}
+
+/*
+keyFor - Returns the key of the JSON object provided in the parameter that matches the lowercased name provided in the
+parameter, as attribute names are case insensitive. If there is none, then the name is returned along with false
+*/
+func keyFor(object map[string]any, name string) (string, bool) {
+	for key := range object {
+		if strings.ToLower(key) == name {
+			return key, true
+		}
+	}
+
+	return name, false
+}
+
+/*
+without - Returns the values that are not in the values to remove provided in the parameter. Values are compared by their
+value sub-attribute when they have one (members, emails), and as a whole otherwise
+*/
+func without(values []any, remove []any) []any {
+	identity := func(element any) string {
+		if object, ok := element.(map[string]any); ok {
+			if key, found := keyFor(object, "value"); found {
+				return strings.ToLower(fmt.Sprint(object[key]))
+			}
+		}
+
+		encoded, _ := json.Marshal(element)
+		return string(encoded)
+	}
+
+	removed := make(map[string]bool, len(remove))
+	for _, element := range remove {
+		removed[identity(element)] = true
+	}
+
+	ret := make([]any, 0, len(values))
+
+	for _, element := range values {
+		if !removed[identity(element)] {
+			ret = append(ret, element)
+		}
+	}
+
+	return ret
+}
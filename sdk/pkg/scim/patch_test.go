@@ -0,0 +1,197 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path   string
+		attr   string
+		filter filter
+		sub    string
+	}{
+		{path: `userName`, attr: "username"},
+		{path: `name.givenName`, attr: "name", sub: "givenname"},
+		{path: `urn:ietf:params:scim:schemas:core:2.0:User:name.familyName`, attr: "name", sub: "familyname"},
+		{path: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber`, attr: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:user:employeenumber"},
+		{path: `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value`, attr: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:user:manager", sub: "value"},
+		{path: `members[value eq "2819c223"]`, attr: "members", filter: eq("value", "2819c223")},
+		{path: `emails[type eq "work"].value`, attr: "emails", filter: eq("type", "work"), sub: "value"},
+		{path: `emails[type eq "work" and primary eq true].display`, attr: "emails", filter: logical{op: "and", left: eq("type", "work"), right: eq("primary", true)}, sub: "display"},
+		{path: `emails[value eq "a]b"]`, attr: "emails", filter: eq("value", "a]b")},
+	}
+
+	for _, test := range tests {
+		attr, valueFilter, sub, err := parsePath(test.path)
+		if err != nil {
+			t.Fatalf("parsePath(%q): %v", test.path, err)
+		}
+
+		if attr != test.attr || !reflect.DeepEqual(valueFilter, test.filter) || sub != test.sub {
+			t.Errorf("parsePath(%q) = %q, %#v, %q, want %q, %#v, %q", test.path, attr, valueFilter, sub, test.attr, test.filter, test.sub)
+		}
+	}
+}
+
+func TestParsePathMalformed(t *testing.T) {
+	for _, path := range []string{
+		`emails[type eq "work"`,
+		`emails]type eq "work"[`,
+		`emails[type eq]`,
+		`emails[type eq "work"]value`,
+		`emails[]`,
+	} {
+		_, _, _, err := parsePath(path)
+		if !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("parsePath(%q) = %v, want ErrInvalidPath", path, err)
+		}
+	}
+}
+
+func newPatchUser() *User {
+	active := true
+
+	return &User{
+		Schemas:  []string{SchemaUser},
+		UserName: "bjensen",
+		Name:     &Name{GivenName: "Barbara", FamilyName: "Jensen"},
+		Active:   &active,
+		Emails: []MultiValue{
+			{Value: "bjensen@example.com", Type: "work", Primary: true},
+			{Value: "babs@example.org", Type: "home"},
+		},
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	inactive := false
+
+	tests := []struct {
+		name       string
+		operations []PatchOperation
+		want       func(resource *User)
+	}{
+		{
+			name:       "replace an attribute",
+			operations: []PatchOperation{{Op: "replace", Path: "userName", Value: "barbara"}},
+			want:       func(resource *User) { resource.UserName = "barbara" },
+		},
+		{
+			name:       "replace without a path",
+			operations: []PatchOperation{{Op: "Replace", Value: map[string]any{"userName": "barbara", "active": false}}},
+			want: func(resource *User) {
+				resource.UserName = "barbara"
+				resource.Active = &inactive
+			},
+		},
+		{
+			name:       "active as a string",
+			operations: []PatchOperation{{Op: "replace", Path: "active", Value: "False"}},
+			want:       func(resource *User) { resource.Active = &inactive },
+		},
+		{
+			name:       "replace a sub-attribute",
+			operations: []PatchOperation{{Op: "replace", Path: "name.givenName", Value: "Babs"}},
+			want:       func(resource *User) { resource.Name.GivenName = "Babs" },
+		},
+		{
+			name:       "replace only the provided sub-attributes",
+			operations: []PatchOperation{{Op: "replace", Path: "name", Value: map[string]any{"familyName": "Smith"}}},
+			want:       func(resource *User) { resource.Name.FamilyName = "Smith" },
+		},
+		{
+			name:       "remove an attribute",
+			operations: []PatchOperation{{Op: "remove", Path: "name"}},
+			want:       func(resource *User) { resource.Name = nil },
+		},
+		{
+			name:       "replace through a value path",
+			operations: []PatchOperation{{Op: "replace", Path: `emails[type eq "work"].value`, Value: "barbara@example.com"}},
+			want:       func(resource *User) { resource.Emails[0].Value = "barbara@example.com" },
+		},
+		{
+			name:       "add through a value path that matches nothing",
+			operations: []PatchOperation{{Op: "add", Path: `emails[type eq "other"].value`, Value: "b@example.net"}},
+			want: func(resource *User) {
+				resource.Emails = append(resource.Emails, MultiValue{Value: "b@example.net", Type: "other"})
+			},
+		},
+		{
+			name:       "remove through a value path",
+			operations: []PatchOperation{{Op: "remove", Path: `emails[type eq "home"]`}},
+			want:       func(resource *User) { resource.Emails = resource.Emails[:1] },
+		},
+		{
+			name:       "remove values without a filter",
+			operations: []PatchOperation{{Op: "remove", Path: "emails", Value: []any{map[string]any{"value": "BJensen@example.com"}}}},
+			want:       func(resource *User) { resource.Emails = resource.Emails[1:] },
+		},
+		{
+			name:       "add values that already exist",
+			operations: []PatchOperation{{Op: "add", Path: "emails", Value: []any{map[string]any{"value": "babs@example.org"}, map[string]any{"value": "b@example.net"}}}},
+			want: func(resource *User) {
+				resource.Emails = append(resource.Emails, MultiValue{Value: "b@example.net"})
+			},
+		},
+		{
+			name:       "extension attributes are ignored",
+			operations: []PatchOperation{{Op: "replace", Path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:employeeNumber", Value: "701984"}},
+			want:       func(resource *User) {},
+		},
+		{
+			name: "operations apply in order",
+			operations: []PatchOperation{
+				{Op: "remove", Path: "name"},
+				{Op: "add", Path: "name.givenName", Value: "Babs"},
+			},
+			want: func(resource *User) { resource.Name = &Name{GivenName: "Babs"} },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := newPatchUser()
+
+			err := applyPatch(got, &PatchRequest{Schemas: []string{SchemaPatchOp}, Operations: test.operations})
+			if err != nil {
+				t.Fatalf("applyPatch: %v", err)
+			}
+
+			want := newPatchUser()
+			test.want(want)
+
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("applyPatch = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyPatchMalformed(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation PatchOperation
+		want      error
+	}{
+		{name: "unknown operation", operation: PatchOperation{Op: "move", Path: "userName"}, want: ErrInvalidSyntax},
+		{name: "remove without a path", operation: PatchOperation{Op: "remove"}, want: ErrNoTarget},
+		{name: "replace without a path or object", operation: PatchOperation{Op: "replace", Value: "barbara"}, want: ErrNoTarget},
+		{name: "malformed path", operation: PatchOperation{Op: "replace", Path: `emails[type eq "work"`, Value: "x"}, want: ErrInvalidPath},
+		{name: "sub-attribute of a multi-valued attribute", operation: PatchOperation{Op: "replace", Path: "emails.value", Value: "x"}, want: ErrInvalidPath},
+		{name: "filter that cannot seed a value", operation: PatchOperation{Op: "replace", Path: `emails[type co "other"].value`, Value: "x"}, want: ErrNoTarget},
+		{name: "value path without a sub-attribute or object", operation: PatchOperation{Op: "replace", Path: `emails[type eq "work"]`, Value: "x"}, want: ErrInvalidValue},
+		{name: "value of the wrong type", operation: PatchOperation{Op: "replace", Path: "userName", Value: 42}, want: ErrInvalidValue},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := applyPatch(newPatchUser(), &PatchRequest{Schemas: []string{SchemaPatchOp}, Operations: []PatchOperation{test.operation}})
+			if !errors.Is(err, test.want) {
+				t.Fatalf("applyPatch = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
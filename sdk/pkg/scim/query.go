@@ -0,0 +1,203 @@
+package scim
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	kindString   = "string"
+	kindBoolean  = "boolean"
+	kindDateTime = "dateTime"
+)
+
+/*
+attribute - Describes how an attribute that resources can be filtered by is stored
+*/
+type attribute struct {
+	// field - The field of the document the attribute is stored in
+	field string
+
+	// kind - The type of the attribute: string, boolean or dateTime. Dates are stored as unix timestamps
+	kind string
+
+	// caseExact - If set to true, then strings are compared case sensitively (RFC 7643 section 2.2)
+	caseExact bool
+
+	// inverted - If set to true, then the boolean is stored negated (active is stored as locked)
+	inverted bool
+
+	// resolve - Compiles comparisons of attributes that are not stored on the document itself (the members of a group). If set, every other field is ignored
+	resolve func(serv *server.Server, op string, value any) (bson.M, error)
+}
+
+/*
+compile - Compiles a filter to a MongoDB query, with the attributes provided in the parameter. Attributes that are not
+in the map cannot be filtered by, and ErrInvalidFilter is returned for them. A nil filter matches every document
+*/
+func compile(serv *server.Server, f filter, attrs map[string]attribute) (bson.M, error) {
+	switch typed := f.(type) {
+	case nil:
+		return bson.M{}, nil
+	case logical:
+		left, err := compile(serv, typed.left, attrs)
+		if err != nil {
+			return nil, err
+		}
+
+		right, err := compile(serv, typed.right, attrs)
+		if err != nil {
+			return nil, err
+		}
+
+		return bson.M{"$" + typed.op: bson.A{left, right}}, nil
+	case negation:
+		inner, err := compile(serv, typed.inner, attrs)
+		if err != nil {
+			return nil, err
+		}
+
+		return bson.M{"$nor": bson.A{inner}}, nil
+	case valuePath:
+		return compile(serv, prefix(typed.inner, typed.attr), attrs)
+	case comparison:
+		attr, ok := attrs[typed.attr]
+		if !ok {
+			return nil, fmt.Errorf("%w (%s)", ErrInvalidFilter, typed.attr)
+		}
+
+		if attr.resolve != nil {
+			return attr.resolve(serv, typed.op, typed.value)
+		}
+
+		return compileComparison(attr, typed)
+	default:
+		return nil, ErrInvalidFilter
+	}
+}
+
+/*
+prefix - Qualifies the attributes compared by the filter of a value path with the multi-valued attribute it applies to,
+so that emails[value eq "a@example.com"] is compiled like emails.value eq "a@example.com"
+*/
+func prefix(f filter, attr string) filter {
+	switch typed := f.(type) {
+	case logical:
+		return logical{op: typed.op, left: prefix(typed.left, attr), right: prefix(typed.right, attr)}
+	case negation:
+		return negation{inner: prefix(typed.inner, attr)}
+	case comparison:
+		return comparison{attr: attr + "." + typed.attr, op: typed.op, value: typed.value}
+	default:
+		return f
+	}
+}
+
+/*
+compileComparison - Compiles a comparison of an attribute that is stored on the document
+*/
+func compileComparison(attr attribute, c comparison) (bson.M, error) {
+	if c.op == "pr" {
+		if attr.kind == kindBoolean {
+			return bson.M{}, nil
+		}
+
+		return bson.M{attr.field: bson.M{"$exists": true, "$nin": bson.A{nil, "", bson.A{}}}}, nil
+	}
+
+	switch attr.kind {
+	case kindBoolean:
+		value, ok := c.value.(bool)
+		if !ok || (c.op != "eq" && c.op != "ne") {
+			return nil, fmt.Errorf("%w (%s can only be compared with eq or ne and a boolean)", ErrInvalidFilter, c.attr)
+		}
+
+		if c.op == "ne" {
+			value = !value
+		}
+
+		if attr.inverted {
+			value = !value
+		}
+
+		/*
+			Booleans that were never set are false, so matching false must also match a missing field
+		*/
+		if !value {
+			return bson.M{attr.field: bson.M{"$ne": true}}, nil
+		}
+
+		return bson.M{attr.field: true}, nil
+	case kindDateTime:
+		value, ok := c.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w (%s must be compared with a date)", ErrInvalidFilter, c.attr)
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrInvalidFilter, err)
+		}
+
+		switch c.op {
+		case "eq":
+			return bson.M{attr.field: parsed.Unix()}, nil
+		case "ne", "gt", "ge", "lt", "le":
+			return bson.M{attr.field: bson.M{mongoOperators[c.op]: parsed.Unix()}}, nil
+		default:
+			return nil, fmt.Errorf("%w (%s cannot be compared with %s)", ErrInvalidFilter, c.attr, c.op)
+		}
+	}
+
+	value, ok := c.value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w (%s must be compared with a string)", ErrInvalidFilter, c.attr)
+	}
+
+	switch c.op {
+	case "eq":
+		if attr.caseExact {
+			return bson.M{attr.field: value}, nil
+		}
+
+		return bson.M{attr.field: pattern("^"+regexp.QuoteMeta(value)+"$", attr.caseExact)}, nil
+	case "ne":
+		if attr.caseExact {
+			return bson.M{attr.field: bson.M{"$ne": value}}, nil
+		}
+
+		return bson.M{attr.field: bson.M{"$not": pattern("^"+regexp.QuoteMeta(value)+"$", attr.caseExact)}}, nil
+	case "co":
+		return bson.M{attr.field: pattern(regexp.QuoteMeta(value), attr.caseExact)}, nil
+	case "sw":
+		return bson.M{attr.field: pattern("^"+regexp.QuoteMeta(value), attr.caseExact)}, nil
+	case "ew":
+		return bson.M{attr.field: pattern(regexp.QuoteMeta(value)+"$", attr.caseExact)}, nil
+	default:
+		return bson.M{attr.field: bson.M{mongoOperators[c.op]: value}}, nil
+	}
+}
+
+// mongoOperators - The MongoDB operators of the SCIM ordering operators
+var mongoOperators = map[string]string{
+	"ne": "$ne",
+	"gt": "$gt",
+	"ge": "$gte",
+	"lt": "$lt",
+	"le": "$lte",
+}
+
+/*
+pattern - Returns a regular expression for MongoDB, which is case insensitive unless caseExact is set
+*/
+func pattern(expression string, caseExact bool) bson.Regex {
+	if caseExact {
+		return bson.Regex{Pattern: expression}
+	}
+
+	return bson.Regex{Pattern: expression, Options: "i"}
+}
@@ -0,0 +1,231 @@
+package scim
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/user"
+)
+
+const (
+	// SchemaUser - The core schema of users (RFC 7643 section 4.1)
+	SchemaUser = "urn:ietf:params:scim:schemas:core:2.0:User"
+
+	// SchemaGroup - The core schema of groups (RFC 7643 section 4.2)
+	SchemaGroup = "urn:ietf:params:scim:schemas:core:2.0:Group"
+
+	// SchemaListResponse - The schema of list responses (RFC 7644 section 3.4.2)
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+
+	// SchemaPatchOp - The schema of PATCH requests (RFC 7644 section 3.5.2)
+	SchemaPatchOp = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+
+	// SchemaError - The schema of error responses (RFC 7644 section 3.12)
+	SchemaError = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	// ContentType - The media type of every SCIM request and response
+	ContentType = "application/scim+json"
+
+	// PathBase - The path every SCIM endpoint is served under, relative to the issuer
+	PathBase = "/scim/v2"
+)
+
+/*
+The short codes of the following errors are the scimType defined for them in RFC 7644 section 3.12, so that they can be
+returned to directories as-is (see NewError)
+*/
+
+// ErrInvalidFilter - Provides a named error for when a filter is malformed, or compares an attribute that cannot be filtered by
+var ErrInvalidFilter = credstackError.NewError(400, "invalidFilter", "scim: The filter is malformed or compares an unsupported attribute")
+
+// ErrInvalidPath - Provides a named error for when the path of a PATCH operation is malformed
+var ErrInvalidPath = credstackError.NewError(400, "invalidPath", "scim: The path of the operation is malformed")
+
+// ErrNoTarget - Provides a named error for when a PATCH operation does not select any attribute to apply to
+var ErrNoTarget = credstackError.NewError(400, "noTarget", "scim: The operation does not select an attribute")
+
+// ErrInvalidValue - Provides a named error for when a resource is missing a required attribute, or an attribute has a value that cannot be stored
+var ErrInvalidValue = credstackError.NewError(400, "invalidValue", "scim: A required attribute is missing or an attribute is invalid")
+
+// ErrInvalidSyntax - Provides a named error for when a request body cannot be parsed, or a PATCH operation is unknown
+var ErrInvalidSyntax = credstackError.NewError(400, "invalidSyntax", "scim: The request is malformed")
+
+// ErrUniqueness - Provides a named error for when a user or group is created or renamed to a name that is already in use
+var ErrUniqueness = credstackError.NewError(409, "uniqueness", "scim: A resource with the same unique attribute already exists")
+
+// ErrResourceNotFound - Provides a named error for when a user or group does not exist under the requested ID
+var ErrResourceNotFound = credstackError.NewError(404, "SCIM_RESOURCE_NOT_FOUND", "scim: The resource does not exist")
+
+// ErrProvisioningDisabled - Provides a named error for when SCIM is called while no provisioning clients are configured
+var ErrProvisioningDisabled = credstackError.NewError(404, "SCIM_DISABLED", "scim: SCIM provisioning is not enabled")
+
+// ErrForbiddenClient - Provides a named error for when SCIM is called with an access token that was not issued to a provisioning client with client credentials, or without the SCIM scope
+var ErrForbiddenClient = credstackError.NewError(403, "SCIM_FORBIDDEN", "scim: The access token was not issued to a provisioning client with the SCIM scope")
+
+// scimTypes - The short codes of the errors above that are a scimType
+var scimTypes = []string{"invalidFilter", "invalidPath", "noTarget", "invalidValue", "invalidSyntax", "uniqueness"}
+
+/*
+Meta - The metadata of a resource (RFC 7643 section 3.1)
+*/
+type Meta struct {
+	// ResourceType - The type of the resource: User or Group
+	ResourceType string `json:"resourceType"`
+
+	// Created - When the resource was created, in RFC 3339 format
+	Created string `json:"created"`
+
+	// LastModified - When the resource was last modified, in RFC 3339 format
+	LastModified string `json:"lastModified"`
+
+	// Location - The URL of the resource
+	Location string `json:"location"`
+}
+
+/*
+newMeta - Builds the metadata of the resource of the type provided in the parameter from the unix timestamps of its
+header. The location is the resource under the SCIM endpoints of the issuer
+*/
+func newMeta(resourceType string, id string, createdAt int64, updatedAt int64, issuer string) *Meta {
+	return &Meta{
+		ResourceType: resourceType,
+		Created:      time.Unix(createdAt, 0).UTC().Format(time.RFC3339),
+		LastModified: time.Unix(updatedAt, 0).UTC().Format(time.RFC3339),
+		Location:     strings.TrimSuffix(issuer, "/") + PathBase + "/" + resourceType + "s/" + id,
+	}
+}
+
+/*
+ListResponse - A page of resources returned from a query (RFC 7644 section 3.4.2)
+*/
+type ListResponse struct {
+	// Schemas - Always SchemaListResponse
+	Schemas []string `json:"schemas"`
+
+	// TotalResults - How many resources matched the filter, across every page
+	TotalResults int64 `json:"totalResults"`
+
+	// StartIndex - The 1-based index of the first resource of the page
+	StartIndex int `json:"startIndex"`
+
+	// ItemsPerPage - How many resources are in the page
+	ItemsPerPage int `json:"itemsPerPage"`
+
+	// Resources - The resources of the page
+	Resources []any `json:"Resources"`
+}
+
+/*
+Error - The body of a SCIM error response (RFC 7644 section 3.12)
+*/
+type Error struct {
+	// Schemas - Always SchemaError
+	Schemas []string `json:"schemas"`
+
+	// Status - The HTTP status code of the response, as a string
+	Status string `json:"status"`
+
+	// ScimType - The type of error, for the errors RFC 7644 defines one for
+	ScimType string `json:"scimType,omitempty"`
+
+	// Detail - A human-readable explanation of the error
+	Detail string `json:"detail,omitempty"`
+}
+
+/*
+NewError - Converts the error provided in the parameter to a SCIM error response, and returns it along with its HTTP
+status code. Errors from the user and role packages are translated to the scimType directories expect (an email address
+that is already registered is uniqueness). Only the message of named errors is returned, and any other error is reported
+as an internal error, as it can describe internals
+*/
+func NewError(err error) (int, *Error) {
+	var casted credstackError.CredstackError
+
+	if !errors.As(err, &casted) {
+		return 500, &Error{Schemas: []string{SchemaError}, Status: "500", Detail: "scim: An internal error occurred"}
+	}
+
+	ret := &Error{Schemas: []string{SchemaError}, Status: strconv.Itoa(casted.HTTPStatusCode), Detail: casted.Error()}
+
+	switch {
+	case slices.Contains(scimTypes, casted.Short()):
+		ret.ScimType = casted.Short()
+	case casted.HTTPStatusCode == 409:
+		ret.ScimType = "uniqueness"
+	case casted.HTTPStatusCode == 400:
+		ret.ScimType = "invalidValue"
+	}
+
+	return casted.HTTPStatusCode, ret
+}
+
+/*
+Authenticate - Authenticates a provisioning client with the bearer access token provided in the parameter. The token
+must be active, must have been issued with client credentials to one of ScimConfig.Clients, and must have been issued
+for ScimConfig.Audience with ScimConfig.Scope. Directories cannot refresh tokens on their own, so provisioning clients are usually given a long
+access token lifetime. Returns the client ID of the provisioning client
+*/
+func Authenticate(serv *server.Server, accessToken string) (string, error) {
+	config := serv.Config.ScimConfig
+
+	if len(config.Clients) == 0 {
+		return "", ErrProvisioningDisabled
+	}
+
+	issued, err := token.Lookup(serv, accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	if issued.Audience != config.Audience {
+		return "", fmt.Errorf("%w (token was issued for %s)", token.ErrInvalidAccessToken, issued.Audience)
+	}
+
+	if issued.Subject != issued.ClientId || !slices.Contains(config.Clients, issued.ClientId) || !slices.Contains(strings.Fields(issued.Scope), config.Scope) {
+		return "", ErrForbiddenClient
+	}
+
+	return issued.ClientId, nil
+}
+
+/*
+page - Clamps the 1-based start index and count of a list request (RFC 7644 section 3.4.2.4) to the values that can be
+queried, and returns them. A negative count is treated as zero, and a count above ScimConfig.MaxResults is lowered to it
+*/
+func page(serv *server.Server, startIndex int, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	if count < 0 {
+		count = 0
+	}
+
+	if count > serv.Config.ScimConfig.MaxResults {
+		count = serv.Config.ScimConfig.MaxResults
+	}
+
+	return startIndex, count
+}
+
+/*
+translateError - Translates the errors of the user package that mean a resource does not exist, or is not unique, to
+their SCIM equivalents
+*/
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, user.ErrUserDoesNotExist):
+		return ErrResourceNotFound
+	case errors.Is(err, user.ErrUserAlreadyExists), errors.Is(err, user.ErrIdentityEmailConflict), errors.Is(err, user.ErrIdentityAlreadyLinked):
+		return ErrUniqueness
+	default:
+		return err
+	}
+}
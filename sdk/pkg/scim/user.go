@@ -0,0 +1,523 @@
+package scim
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/approval/gate"
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/credstack/credstack/sdk/pkg/oauth/token"
+	"github.com/credstack/credstack/sdk/pkg/rbac/role"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"github.com/credstack/credstack/sdk/pkg/session"
+	"github.com/credstack/credstack/sdk/pkg/user"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+/*
+User - A user as it is represented to directories (RFC 7643 section 4.1). The userName is the username of the user, and
+the primary email address is their email address. active is the inverse of Locked, and groups are the roles assigned to
+the user, which are read-only here and are changed through the members of groups
+*/
+type User struct {
+	// Schemas - Always SchemaUser
+	Schemas []string `json:"schemas"`
+
+	// Id - The header identifier of the user
+	Id string `json:"id,omitempty"`
+
+	// ExternalId - The identifier of the user in the directory
+	ExternalId string `json:"externalId,omitempty"`
+
+	// UserName - The username of the user
+	UserName string `json:"userName"`
+
+	// Name - The name of the user
+	Name *Name `json:"name,omitempty"`
+
+	// DisplayName - The full name of the user, or their username if they have no name. Read-only
+	DisplayName string `json:"displayName,omitempty"`
+
+	// Active - If set to false, then the user is locked and cannot sign in. Defaults to true
+	Active *bool `json:"active,omitempty"`
+
+	// Password - The password of the user. Never returned
+	Password string `json:"password,omitempty"`
+
+	// Emails - The email addresses of the user. Only the primary one (or the first one) is stored
+	Emails []MultiValue `json:"emails,omitempty"`
+
+	// PhoneNumbers - The phone numbers of the user. Only the primary one (or the first one) is stored
+	PhoneNumbers []MultiValue `json:"phoneNumbers,omitempty"`
+
+	// Addresses - The addresses of the user. Only the formatted form of the primary one (or the first one) is stored
+	Addresses []Address `json:"addresses,omitempty"`
+
+	// Timezone - The time zone of the user, in IANA format
+	Timezone string `json:"timezone,omitempty"`
+
+	// Groups - The groups (roles) the user is a member of. Read-only
+	Groups []MultiValue `json:"groups,omitempty"`
+
+	// Meta - The metadata of the user. Read-only
+	Meta *Meta `json:"meta,omitempty"`
+}
+
+/*
+Name - The components of the name of a user
+*/
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	MiddleName string `json:"middleName,omitempty"`
+}
+
+/*
+MultiValue - A value of a multi-valued attribute (RFC 7643 section 2.4)
+*/
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+/*
+Address - A physical address of a user. The components are only used to build the formatted address when it is not
+provided, as only the formatted address is stored
+*/
+type Address struct {
+	Formatted     string `json:"formatted,omitempty"`
+	StreetAddress string `json:"streetAddress,omitempty"`
+	Locality      string `json:"locality,omitempty"`
+	Region        string `json:"region,omitempty"`
+	PostalCode    string `json:"postalCode,omitempty"`
+	Country       string `json:"country,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Primary       bool   `json:"primary,omitempty"`
+}
+
+/*
+userAttributes - The attributes users can be filtered by
+*/
+var userAttributes = map[string]attribute{
+	"id":                 {field: "header.identifier", kind: kindString, caseExact: true},
+	"externalid":         {field: "external_id", kind: kindString, caseExact: true},
+	"username":           {field: "username", kind: kindString},
+	"name.givenname":     {field: "given_name", kind: kindString},
+	"name.familyname":    {field: "family_name", kind: kindString},
+	"name.middlename":    {field: "middle_name", kind: kindString},
+	"emails":             {field: "email", kind: kindString},
+	"emails.value":       {field: "email", kind: kindString},
+	"phonenumbers":       {field: "phone_number", kind: kindString},
+	"phonenumbers.value": {field: "phone_number", kind: kindString},
+	"active":             {field: "locked", kind: kindBoolean, inverted: true},
+	"meta.created":       {field: "header.created_at", kind: kindDateTime},
+	"meta.lastmodified":  {field: "header.updated_at", kind: kindDateTime},
+}
+
+/*
+toUser - Converts a user to its SCIM representation. The names of its roles must be mapped to the roles themselves in the
+map provided in the parameter (see rolesNamed). Roles that no longer exist are omitted
+*/
+func toUser(account *user.User, groups map[string]*role.Role, issuer string) *User {
+	active := !account.Locked
+
+	ret := &User{
+		Schemas:    []string{SchemaUser},
+		Id:         account.Header.Identifier,
+		ExternalId: account.ExternalId,
+		UserName:   account.Username,
+		Active:     &active,
+		Emails:     []MultiValue{{Value: account.Email, Type: "work", Primary: true}},
+		Timezone:   account.ZoneInfo,
+		Meta:       newMeta("User", account.Header.Identifier, account.Header.CreatedAt, account.Header.UpdatedAt, issuer),
+	}
+
+	formatted, _ := account.Claims()["name"].(string)
+
+	ret.DisplayName = formatted
+	if ret.DisplayName == "" {
+		ret.DisplayName = account.Username
+	}
+
+	if formatted != "" {
+		ret.Name = &Name{
+			Formatted:  formatted,
+			FamilyName: account.FamilyName,
+			GivenName:  account.GivenName,
+			MiddleName: account.MiddleName,
+		}
+	}
+
+	if account.PhoneNumber != "" {
+		ret.PhoneNumbers = []MultiValue{{Value: account.PhoneNumber, Type: "work", Primary: true}}
+	}
+
+	if account.Address != "" {
+		ret.Addresses = []Address{{Formatted: account.Address, Type: "work", Primary: true}}
+	}
+
+	for _, name := range account.Roles {
+		group, ok := groups[name]
+		if !ok {
+			continue
+		}
+
+		ret.Groups = append(ret.Groups, MultiValue{
+			Value:   group.Header.Identifier,
+			Display: displayName(group),
+			Ref:     strings.TrimSuffix(issuer, "/") + PathBase + "/Groups/" + group.Header.Identifier,
+		})
+	}
+
+	return ret
+}
+
+/*
+toProfile - Converts the SCIM representation of a user to the profile it is stored with. The email address is the
+primary email address, or the first one, or the userName if the user has no email addresses and their userName is an
+email address. If the user has neither a userName nor an email address, then ErrInvalidValue is returned
+*/
+func toProfile(resource *User) (*user.User, error) {
+	if resource.UserName == "" {
+		return nil, fmt.Errorf("%w (userName is required)", ErrInvalidValue)
+	}
+
+	ret := &user.User{
+		Username:    resource.UserName,
+		Email:       primaryValue(resource.Emails),
+		PhoneNumber: primaryValue(resource.PhoneNumbers),
+		ZoneInfo:    resource.Timezone,
+		ExternalId:  resource.ExternalId,
+		Locked:      resource.Active != nil && !*resource.Active,
+	}
+
+	if ret.Email == "" && strings.Contains(resource.UserName, "@") {
+		ret.Email = resource.UserName
+	}
+
+	if ret.Email == "" {
+		return nil, fmt.Errorf("%w (an email address is required)", ErrInvalidValue)
+	}
+
+	if resource.Name != nil {
+		ret.GivenName = resource.Name.GivenName
+		ret.MiddleName = resource.Name.MiddleName
+		ret.FamilyName = resource.Name.FamilyName
+	}
+
+	for _, address := range resource.Addresses {
+		formatted := address.Formatted
+		if formatted == "" {
+			formatted = strings.Join(nonEmpty(address.StreetAddress, address.Locality, address.Region, address.PostalCode, address.Country), ", ")
+		}
+
+		if ret.Address == "" || address.Primary {
+			ret.Address = formatted
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+primaryValue - Returns the primary value of a multi-valued attribute, or its first value if none is primary
+*/
+func primaryValue(values []MultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+
+	if len(values) != 0 {
+		return values[0].Value
+	}
+
+	return ""
+}
+
+/*
+nonEmpty - Returns the values provided in the parameter that are not empty
+*/
+func nonEmpty(values ...string) []string {
+	var ret []string
+
+	for _, value := range values {
+		if value != "" {
+			ret = append(ret, value)
+		}
+	}
+
+	return ret
+}
+
+/*
+CreateUser - Provisions the user provided in the parameter, and returns it as it was stored. If ScimConfig.Connection is
+set, then the identity of the user with the connection is linked to them as their primary identity (see
+user.Provision), and any password is ignored. Otherwise, the user is registered with the password, if one is provided
+(see user.RegisterProfile). If a user is already registered under the email address, then ErrUniqueness is returned
+*/
+func CreateUser(serv *server.Server, resource *User, issuer string) (*User, error) {
+	profile, err := toProfile(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var account *user.User
+
+	if connection := serv.Config.ScimConfig.Connection; connection != "" {
+		subject := resource.UserName
+		if serv.Config.ScimConfig.SubjectAttribute == config.ScimSubjectExternalId {
+			subject = resource.ExternalId
+		}
+
+		if subject == "" {
+			return nil, fmt.Errorf("%w (%s is required)", ErrInvalidValue, serv.Config.ScimConfig.SubjectAttribute)
+		}
+
+		account, err = user.Provision(serv, user.Identity{Provider: connection, Subject: subject, Email: profile.Email}, profile)
+	} else {
+		account, err = user.RegisterProfile(serv, profile, resource.Password)
+	}
+
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return toUser(account, nil, issuer), nil
+}
+
+/*
+GetUser - Returns the user with the identifier provided in the parameter. If the user does not exist, then
+ErrResourceNotFound is returned
+*/
+func GetUser(serv *server.Server, id string, issuer string) (*User, error) {
+	account, err := user.GetByIdentifier(serv, id, false)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	groups, err := rolesNamed(serv, account.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	return toUser(account, groups, issuer), nil
+}
+
+/*
+ReplaceUser - Replaces the user with the identifier provided in the parameter with the user provided in the parameter
+(see user.Replace), and returns it as it was stored. If a password is provided, then it is reset, and the reset is
+recorded in the audit log under the actor provided in the parameter. Passwords are ignored when provisioned users sign
+in through ScimConfig.Connection. If the user is deactivated, then they are signed out everywhere (see deactivate)
+*/
+func ReplaceUser(serv *server.Server, id string, resource *User, issuer string, actor string) (*User, error) {
+	profile, err := toProfile(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := user.GetByIdentifier(serv, id, false)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	account, err := user.Replace(serv, id, profile)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	if resource.Password != "" && serv.Config.ScimConfig.Connection == "" {
+		err = user.ResetPassword(serv, account.Email, resource.Password, actor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if account.Locked && !current.Locked {
+		err = deactivate(serv, account)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := rolesNamed(serv, account.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	return toUser(account, groups, issuer), nil
+}
+
+/*
+PatchUser - Applies the operations of the PATCH request provided in the parameter to the user with the identifier
+provided in the parameter, and returns it as it was stored. The patched user replaces the stored one, exactly like
+ReplaceUser. Directories deprovision users by patching active to false
+*/
+func PatchUser(serv *server.Server, id string, patch *PatchRequest, issuer string, actor string) (*User, error) {
+	resource, err := GetUser(serv, id, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyPatch(resource, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return ReplaceUser(serv, id, resource, issuer, actor)
+}
+
+/*
+DeleteUser - Deletes the user with the identifier provided in the parameter. If the user does not exist, then
+ErrResourceNotFound is returned. If deleting users requires approval, then gate.ErrApprovalRequired is returned before
+the user is deactivated, and the user must be deleted by approving a user.delete approval instead
+*/
+func DeleteUser(serv *server.Server, id string) error {
+	err := gate.Check(serv, gate.ActionUserDelete)
+	if err != nil {
+		return err
+	}
+
+	account, err := user.GetByIdentifier(serv, id, false)
+	if err != nil {
+		return translateError(err)
+	}
+
+	err = deactivate(serv, account)
+	if err != nil {
+		return err
+	}
+
+	return translateError(user.Delete(serv, account.Email))
+}
+
+/*
+ListUsers - Returns the page of users matching the filter provided in the parameter, in the order they were created. The
+start index is 1-based, and the count is limited to ScimConfig.MaxResults. An empty filter matches every user
+*/
+func ListUsers(serv *server.Server, expression string, startIndex int, count int, issuer string) (*ListResponse, error) {
+	var f filter
+
+	if expression != "" {
+		var err error
+
+		f, err = parseFilter(expression)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query, err := compile(serv, f, userAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	startIndex, count = page(serv, startIndex, count)
+
+	collection := serv.Database().ReadCollection("user", server.ReadClassList)
+
+	total, err := collection.CountDocuments(serv.Context(), query)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := &ListResponse{Schemas: []string{SchemaListResponse}, TotalResults: total, StartIndex: startIndex, Resources: []any{}}
+
+	if count == 0 {
+		return ret, nil
+	}
+
+	result, err := collection.Find(
+		serv.Context(),
+		query,
+		mongoOpts.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetSkip(int64(startIndex-1)).
+			SetLimit(int64(count)).
+			SetProjection(bson.M{"credential": 0}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var accounts []*user.User
+
+	err = result.All(serv.Context(), &accounts)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var names []string
+	for _, account := range accounts {
+		names = append(names, account.Roles...)
+	}
+
+	groups, err := rolesNamed(serv, names)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, account := range accounts {
+		ret.Resources = append(ret.Resources, toUser(account, groups, issuer))
+	}
+
+	ret.ItemsPerPage = len(ret.Resources)
+
+	return ret, nil
+}
+
+/*
+deactivate - Signs the user out everywhere, by ending every session they have and revoking every token issued on their
+behalf, including the refresh tokens of grants without a session (like the device code grant), so that locking or
+deprovisioning a user takes effect immediately instead of when their tokens expire
+*/
+func deactivate(serv *server.Server, account *user.User) error {
+	_, err := session.RevokeAll(serv, account.Subject())
+	if err != nil {
+		return err
+	}
+
+	_, err = token.RevokeAllForSubject(serv, account.Subject())
+
+	return err
+}
+
+/*
+rolesNamed - Returns the roles with the names provided in the parameter, keyed by name. Roles that do not exist are
+omitted
+*/
+func rolesNamed(serv *server.Server, names []string) (map[string]*role.Role, error) {
+	ret := make(map[string]*role.Role, len(names))
+
+	if len(names) == 0 {
+		return ret, nil
+	}
+
+	result, err := serv.Database().Collection("role").Find(
+		serv.Context(),
+		bson.M{"name": bson.M{"$in": names}},
+		mongoOpts.Find().SetProjection(bson.M{"name": 1, "display_name": 1, "header": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var roles []*role.Role
+
+	err = result.All(serv.Context(), &roles)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	for _, found := range roles {
+		ret[found.Name] = found
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,45 @@
+package secret
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/credstack/credstack/sdk/internal/golden"
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+func TestArgon2Golden(t *testing.T) {
+	golden.Deterministic(t)
+
+	hash, salt, err := NewArgon2Hash([]byte("correct horse battery staple"), config.DefaultCredentialConfig())
+	if err != nil {
+		t.Fatalf("NewArgon2Hash: %v", err)
+	}
+
+	golden.Assert(t, "argon2", []byte("hash="+hex.EncodeToString(hash)+"\nsalt="+hex.EncodeToString(salt)+"\n"))
+}
+
+func TestPBKDF2Golden(t *testing.T) {
+	golden.Deterministic(t)
+
+	credentialConfig := config.DefaultCredentialConfig()
+	credentialConfig.Algorithm = config.CredentialAlgorithmPBKDF2
+
+	hash, salt, err := NewPBKDF2Hash([]byte("correct horse battery staple"), credentialConfig)
+	if err != nil {
+		t.Fatalf("NewPBKDF2Hash: %v", err)
+	}
+
+	golden.Assert(t, "pbkdf2", []byte("hash="+hex.EncodeToString(hash)+"\nsalt="+hex.EncodeToString(salt)+"\n"))
+}
+
+func TestRandStringGolden(t *testing.T) {
+	golden.Deterministic(t)
+
+	str, err := RandString(32)
+	if err != nil {
+		t.Fatalf("RandString: %v", err)
+	}
+
+	golden.Assert(t, "randstring", []byte(str+"\n"))
+}
@@ -0,0 +1,43 @@
+package secret
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/subtle"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+NewPBKDF2Hash - Generates a PBKDF2-HMAC-SHA256 hash for the secret provided in the first parameter. This is provided
+as a FIPS 140 approved alternative to NewArgon2Hash and should only be used when CryptoConfig.FIPSMode is enabled, as
+Argon2id provides far better resistance against GPU based attacks. Like NewArgon2Hash, the options used here should be
+persisted using the user.Credential model so that the same ones can be used for validation.
+*/
+func NewPBKDF2Hash(secret []byte, config config.CredentialConfig) ([]byte, []byte, error) {
+	salt, err := RandBytes(config.SaltLength)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, string(secret), salt, int(config.Iterations), int(config.KeyLength))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, salt, nil
+}
+
+/*
+ValidatePBKDF2Hash - Validates that the PBKDF2 hash of 'secret' matches the hash provided in 'target'. See
+ValidateArgon2Hash for a description of the parameters. A returned value of true indicates that the hashes match, any
+other result indicates that they do not
+*/
+func ValidatePBKDF2Hash(secret []byte, salt []byte, target []byte, config config.CredentialConfig) bool {
+	key, err := pbkdf2.Key(sha256.New, string(secret), salt, int(config.Iterations), int(config.KeyLength))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(target, key) == 1
+}
@@ -0,0 +1,126 @@
+package secret
+
+import (
+	"encoding/hex"
+	"hash/crc32"
+	"math/big"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// checksumLength - The number of base62 characters needed to encode a CRC32 checksum. Base62 is used so that checksums never contain separators
+const checksumLength = 6
+
+// ErrInvalidSecretPolicy - Provides a named error for when a secret policy cannot be used for generating secrets
+var ErrInvalidSecretPolicy = credstackError.NewError(500, "ERR_INVALID_SECRET_POLICY", "secret: The secret policy is invalid")
+
+/*
+Generate - Generates a new secret according to the policy provided in the parameter. The random portion of the secret
+is read from RandReader, encoded according to the policy, and then prefixed. If the policy enables checksums, then a
+CRC32 of the prefix and the random portion is appended as 6 base62 characters. This format (similar to the ones used
+by GitHub and Stripe) lets secret scanners detect leaked credstack secrets with ValidChecksum, without needing access
+to the database
+*/
+func Generate(policy config.SecretPolicy) (string, error) {
+	if policy.Length == 0 {
+		return "", ErrInvalidSecretPolicy
+	}
+
+	var body string
+
+	switch policy.Encoding {
+	case config.SecretEncodingBase64, "":
+		data, err := RandBytes(policy.Length)
+		if err != nil {
+			return "", err
+		}
+
+		body = EncodeBase64(data)
+	case config.SecretEncodingHex:
+		data, err := RandBytes(policy.Length)
+		if err != nil {
+			return "", err
+		}
+
+		body = hex.EncodeToString(data)
+	case config.SecretEncodingAlphabet:
+		var err error
+
+		body, err = randAlphabet(policy.Alphabet, policy.Length)
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrInvalidSecretPolicy
+	}
+
+	ret := policy.Prefix + body
+	if policy.Checksum {
+		ret += checksum(ret)
+	}
+
+	return ret, nil
+}
+
+/*
+ValidChecksum - Determines if the secret provided in the parameter ends with a valid checksum and starts with the
+prefix defined in the policy. This is intended for secret scanners and leak detection, and does not indicate that the
+secret is actually issued to a client
+*/
+func ValidChecksum(secret string, policy config.SecretPolicy) bool {
+	if !strings.HasPrefix(secret, policy.Prefix) || len(secret) < len(policy.Prefix)+checksumLength {
+		return false
+	}
+
+	split := len(secret) - checksumLength
+
+	return checksum(secret[:split]) == secret[split:]
+}
+
+/*
+checksum - Computes the CRC32 (IEEE) of the data provided in the parameter, encoded as a fixed width base62 string
+*/
+func checksum(data string) string {
+	sum := crc32.ChecksumIEEE([]byte(data))
+
+	encoded := new(big.Int).SetUint64(uint64(sum)).Text(62)
+
+	return strings.Repeat("0", checksumLength-len(encoded)) + encoded
+}
+
+/*
+randAlphabet - Generates a string of the requested length with characters drawn uniformly from the alphabet provided
+in the parameter. The alphabet is treated as single byte (ASCII) characters. Random bytes that would introduce a bias towards the start of the alphabet are discarded
+*/
+func randAlphabet(alphabet string, length uint32) (string, error) {
+	if len(alphabet) < 2 || len(alphabet) > 256 {
+		return "", ErrInvalidSecretPolicy
+	}
+
+	limit := 256 - (256 % len(alphabet))
+
+	var builder strings.Builder
+	builder.Grow(int(length))
+
+	for uint32(builder.Len()) < length {
+		data, err := RandBytes(length)
+		if err != nil {
+			return "", err
+		}
+
+		for _, b := range data {
+			if int(b) >= limit {
+				continue
+			}
+
+			builder.WriteByte(alphabet[int(b)%len(alphabet)])
+			if uint32(builder.Len()) == length {
+				break
+			}
+		}
+	}
+
+	return builder.String(), nil
+}
@@ -1,9 +1,20 @@
 package secret
 
 import (
-	"crypto/rand"
+	"io"
+
+	"github.com/credstack/credstack/sdk/internal/random"
 )
 
+/*
+RandReader - Returns the source of randomness used by the secret package. Other packages that need an io.Reader for
+randomness (like rsa.SignPKCS1v15) should use this over rand.Reader, so that tests can replace it with a deterministic
+one (see golden.Deterministic)
+*/
+func RandReader() io.Reader {
+	return random.Reader()
+}
+
 /*
 RandBytes - A function for generating cryptographically secure, random byte arrays of a fixed
 size. Most commonly used for generating Argon2 hashes, or secured version 5 UUIDs. The error returned
@@ -13,10 +24,10 @@ func RandBytes(length uint32) ([]byte, error) {
 	ret := make([]byte, length)
 
 	/*
-		Fill the created byte array with cryptographically secured data. n is used as an offset
-		for the byte array
+		Fill the created byte array with cryptographically secured data. io.ReadFull is used here as readers other than
+		crypto/rand may return fewer bytes than requested
 	*/
-	_, err := rand.Read(ret)
+	_, err := io.ReadFull(random.Reader(), ret)
 	if err != nil {
 		return nil, err
 	}
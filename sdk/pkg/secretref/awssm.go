@@ -0,0 +1,90 @@
+package secretref
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+awsSMProvider - Reads secrets from AWS Secrets Manager. References are the name or ARN of the secret
+(awssm://credstack/database). Secrets that are stored as a JSON object, such as the ones rotated by the RDS rotation
+functions, can have a single member referenced by its name (awssm://credstack/database#password)
+*/
+type awsSMProvider struct {
+	// client - The client every request to Secrets Manager is sent with
+	client *secretsmanager.Client
+}
+
+/*
+newAWSSMProvider - Constructs the Provider for awssm references. Options that are not set in the config are resolved by
+the AWS SDK: the region from AWS_REGION or the shared config file, and the credentials from its default credential chain
+(environment variables, the shared config and credentials files, SSO, web identity, and the ECS and EC2 instance roles)
+when the first secret is read
+*/
+func newAWSSMProvider(secretsConfig config.SecretsConfig, _ clock.Clock) (Provider, error) {
+	smConfig := secretsConfig.AWS
+
+	var options []func(*awsConfig.LoadOptions) error
+
+	if smConfig.Region != "" {
+		options = append(options, awsConfig.WithRegion(smConfig.Region))
+	}
+
+	if smConfig.AccessKeyId != "" {
+		options = append(options, awsConfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(smConfig.AccessKeyId, smConfig.SecretAccessKey, smConfig.SessionToken),
+		))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretsConfig.Timeout)
+	defer cancel()
+
+	loaded, err := awsConfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrResolveFailed, err)
+	}
+
+	client := secretsmanager.NewFromConfig(loaded, func(o *secretsmanager.Options) {
+		if smConfig.Endpoint != "" {
+			o.BaseEndpoint = aws.String(smConfig.Endpoint)
+		}
+	})
+
+	return &awsSMProvider{client: client}, nil
+}
+
+/*
+Fetch - Reads the current version of the secret with the name or ARN provided in the parameter with GetSecretValue.
+Secrets referenced by ARN (arn:aws:secretsmanager:<region>:<account>:secret:<name>) are read from the region of the ARN
+*/
+func (provider *awsSMProvider) Fetch(ctx context.Context, secretId string) (map[string]string, error) {
+	var region string
+	if parts := strings.Split(secretId, ":"); len(parts) >= 7 && parts[0] == "arn" {
+		region = parts[3]
+	}
+
+	secret, err := provider.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretId)},
+		func(o *secretsmanager.Options) {
+			if region != "" {
+				o.Region = region
+			}
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrResolveFailed, err)
+	}
+
+	if secret.SecretString == nil && secret.SecretBinary != nil {
+		return values(string(secret.SecretBinary)), nil
+	}
+
+	return values(aws.ToString(secret.SecretString)), nil
+}
@@ -0,0 +1,41 @@
+package secretref
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+fileProvider - Reads secrets from files, such as Kubernetes secrets and Docker secrets mounted into the container
+(file:///run/secrets/db-password). Files are read again every time they are resolved, so secrets that are updated in
+place by the orchestrator are picked up on the next refresh
+*/
+type fileProvider struct{}
+
+/*
+newFileProvider - Constructs the Provider for file references. It requires no options
+*/
+func newFileProvider(config.SecretsConfig, clock.Clock) (Provider, error) {
+	return fileProvider{}, nil
+}
+
+/*
+Fetch - Reads the file at the path provided in the parameter. A single trailing newline is removed, as most tools that
+write secrets to files (echo, kubectl create secret --from-file) add one
+*/
+func (provider fileProvider) Fetch(_ context.Context, path string) (map[string]string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrResolveFailed, err)
+	}
+
+	secret := strings.TrimSuffix(string(contents), "\n")
+	secret = strings.TrimSuffix(secret, "\r")
+
+	return values(secret), nil
+}
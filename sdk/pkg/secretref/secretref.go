@@ -0,0 +1,254 @@
+package secretref
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrUnknownScheme - An error that gets returned when a reference uses a scheme that has not been registered
+var ErrUnknownScheme = credstackError.NewError(500, "ERR_UNKNOWN_SECRET_SCHEME", "secretref: The scheme of the secret reference has not been registered")
+
+// ErrInvalidReference - An error that gets returned when a reference does not have a path, or names a key that the secret does not hold
+var ErrInvalidReference = credstackError.NewError(500, "ERR_INVALID_SECRET_REFERENCE", "secretref: The secret reference does not refer to a value")
+
+// ErrResolveFailed - An error that gets wrapped when a provider fails to fetch the secret a reference refers to
+var ErrResolveFailed = credstackError.NewError(500, "ERR_SECRET_RESOLVE_FAILED", "secretref: Failed to fetch the secret the reference refers to")
+
+/*
+Provider - Interface that all secret providers must implement. Providers are shared across every reference with their
+scheme, so implementations must be safe for concurrent use
+*/
+type Provider interface {
+	// Fetch - Fetches the secret stored at the path. Secrets holding more than one value (a Vault secret, a JSON object) return each of them keyed by their name. Secrets holding a single value return it under the empty key
+	Fetch(ctx context.Context, path string) (map[string]string, error)
+}
+
+/*
+Factory - A function that constructs a Provider from the secrets configuration, and the clock of the server for providers
+that sign their requests. Providers register a Factory with Register so that they can be referenced by their scheme
+*/
+type Factory func(config config.SecretsConfig, c clock.Clock) (Provider, error)
+
+var (
+	// registryLock - Protects the providers map
+	registryLock sync.RWMutex
+
+	// providers - All registered providers keyed by their scheme
+	providers = map[string]Factory{
+		"file":  newFileProvider,
+		"vault": newVaultProvider,
+		"awssm": newAWSSMProvider,
+	}
+)
+
+/*
+Register - Registers a new provider under the scheme provided in the parameter. If a provider already exists under this
+scheme, then it is replaced
+*/
+func Register(scheme string, factory Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	providers[scheme] = factory
+}
+
+/*
+IsReference - Returns true if the value provided in the parameter starts with the scheme of a registered provider
+(vault://). Any other value is a secret on its own, and is used as-is
+*/
+func IsReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, "://")
+	if !ok {
+		return false
+	}
+
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	_, ok = providers[scheme]
+	return ok
+}
+
+/*
+parse - Splits a reference into its scheme, path and key. The key follows the last '#' of the reference, and selects a
+single value of a secret that holds more than one (vault://secret/data/credstack#password). If there is no key, then the
+secret as a whole is referenced
+*/
+func parse(reference string) (scheme string, path string, key string, err error) {
+	scheme, rest, ok := strings.Cut(reference, "://")
+	if !ok {
+		return "", "", "", ErrInvalidReference
+	}
+
+	path = rest
+	if index := strings.LastIndex(rest, "#"); index != -1 {
+		path, key = rest[:index], rest[index+1:]
+	}
+
+	if path == "" {
+		return "", "", "", ErrInvalidReference
+	}
+
+	return scheme, path, key, nil
+}
+
+/*
+values - Returns the values held by the raw contents of a secret. If the contents are a JSON object, then each of its
+members is returned under its name, so one of them must be selected with a key. Otherwise the contents are a single
+value, and are returned under the empty key
+*/
+func values(contents string) map[string]string {
+	var object map[string]any
+	if json.Unmarshal([]byte(contents), &object) == nil {
+		return flatten(object)
+	}
+
+	return map[string]string{"": contents}
+}
+
+/*
+flatten - Converts the members of a JSON object to strings. Strings are returned as-is, and any other member (numbers,
+booleans, nested objects) is returned as it is encoded in JSON
+*/
+func flatten(object map[string]any) map[string]string {
+	ret := make(map[string]string, len(object))
+
+	for key, value := range object {
+		if str, ok := value.(string); ok {
+			ret[key] = str
+			continue
+		}
+
+		encoded, err := json.Marshal(value)
+		if err == nil {
+			ret[key] = string(encoded)
+		}
+	}
+
+	return ret
+}
+
+/*
+Resolver - Resolves secret references with the registered providers. Providers are only constructed the first time a
+reference with their scheme is resolved, so that the options of a provider that is never referenced are not required
+*/
+type Resolver struct {
+	// config - The options providers are constructed with
+	config config.SecretsConfig
+
+	// clock - The clock providers are constructed with
+	clock clock.Clock
+
+	// lock - Protects the providers map
+	lock sync.Mutex
+
+	// providers - The providers that have been constructed so far, keyed by their scheme
+	providers map[string]Provider
+}
+
+/*
+provider - Returns the provider for the scheme provided in the parameter, constructing it if this is the first time it has
+been used. If no provider is registered under the scheme, then ErrUnknownScheme is returned
+*/
+func (resolver *Resolver) provider(scheme string) (Provider, error) {
+	resolver.lock.Lock()
+	defer resolver.lock.Unlock()
+
+	if provider, ok := resolver.providers[scheme]; ok {
+		return provider, nil
+	}
+
+	registryLock.RLock()
+	factory, ok := providers[scheme]
+	registryLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w (%s)", ErrUnknownScheme, scheme)
+	}
+
+	provider, err := factory(resolver.config, resolver.clock)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver.providers[scheme] = provider
+
+	return provider, nil
+}
+
+/*
+Resolve - Resolves the references provided in the parameter, keyed by the name of the field they were set on. The
+secrets are returned keyed by the same name. Every secret is only fetched once, even if more than one of its keys are
+referenced, so that values that were issued together (the username and password of dynamic database credentials) are
+always resolved together. Errors name the field that failed, but never contain the secret itself
+*/
+func (resolver *Resolver) Resolve(ctx context.Context, references map[string]string) (map[string]string, error) {
+	fields := make([]string, 0, len(references))
+	for field := range references {
+		fields = append(fields, field)
+	}
+
+	// sorted, so that the same field always fails first when more than one reference is broken
+	sort.Strings(fields)
+
+	fetched := make(map[string]map[string]string)
+	ret := make(map[string]string, len(references))
+
+	for _, field := range fields {
+		scheme, path, key, err := parse(references[field])
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, field)
+		}
+
+		secret, ok := fetched[scheme+"://"+path]
+		if !ok {
+			provider, err := resolver.provider(scheme)
+			if err != nil {
+				return nil, fmt.Errorf("%w (%s)", err, field)
+			}
+
+			fetchCtx, cancel := context.WithTimeout(ctx, resolver.config.Timeout)
+			secret, err = provider.Fetch(fetchCtx, path)
+			cancel()
+
+			if err != nil {
+				return nil, fmt.Errorf("%w (%s)", err, field)
+			}
+
+			fetched[scheme+"://"+path] = secret
+		}
+
+		value, ok := secret[key]
+		if !ok && key == "" {
+			return nil, fmt.Errorf("%w (%s: the secret holds more than one value, so one must be named with #<key>)", ErrInvalidReference, field)
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("%w (%s: no value named %q)", ErrInvalidReference, field, key)
+		}
+
+		ret[field] = value
+	}
+
+	return ret, nil
+}
+
+/*
+New - Constructs a Resolver with the options and clock provided in the parameters. No provider is constructed until a
+reference is resolved with it
+*/
+func New(config config.SecretsConfig, c clock.Clock) *Resolver {
+	return &Resolver{
+		config:    config,
+		clock:     c,
+		providers: make(map[string]Provider),
+	}
+}
@@ -0,0 +1,124 @@
+package secretref
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+vaultProvider - Reads secrets from HashiCorp Vault. References are the API path of the secret relative to /v1/, so any
+secrets engine that returns its secret with a GET request can be read: KV version 1 (vault://kv/credstack#password), KV
+version 2 (vault://secret/data/credstack#password), and dynamic database credentials
+(vault://database/creds/credstack#username)
+*/
+type vaultProvider struct {
+	// address - The address of the Vault server
+	address string
+
+	// token - The token every request is authenticated with
+	token string
+
+	// namespace - The Vault Enterprise namespace every request is made in. Empty outside of Vault Enterprise
+	namespace string
+
+	// client - The client every request to Vault is sent with
+	client *http.Client
+}
+
+/*
+newVaultProvider - Constructs the Provider for vault references. Options that are not set in the config are read from the
+standard Vault environment variables. If there is no address or token, then ErrResolveFailed is returned
+*/
+func newVaultProvider(secretsConfig config.SecretsConfig, _ clock.Clock) (Provider, error) {
+	vaultConfig := secretsConfig.Vault
+
+	provider := &vaultProvider{
+		address:   vaultConfig.Address,
+		token:     vaultConfig.Token,
+		namespace: vaultConfig.Namespace,
+		client:    &http.Client{Timeout: secretsConfig.Timeout},
+	}
+
+	if provider.address == "" {
+		provider.address = os.Getenv("VAULT_ADDR")
+	}
+
+	if provider.token == "" {
+		provider.token = os.Getenv("VAULT_TOKEN")
+	}
+
+	if provider.namespace == "" {
+		provider.namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+
+	if provider.address == "" || provider.token == "" {
+		return nil, fmt.Errorf("%w (vault requires an address and a token)", ErrResolveFailed)
+	}
+
+	return provider, nil
+}
+
+/*
+Fetch - Reads the secret at the path provided in the parameter. Secrets in a KV version 2 mount are nested in a second
+data object next to their metadata, so this is unwrapped before the values of the secret are returned
+*/
+func (provider *vaultProvider) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		strings.TrimSuffix(provider.address, "/")+"/v1/"+strings.TrimPrefix(path, "/"),
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrResolveFailed, err)
+	}
+
+	req.Header.Set("X-Vault-Token", provider.token)
+
+	if provider.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", provider.namespace)
+	}
+
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrResolveFailed, err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrResolveFailed, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%w (%s: %s)", ErrResolveFailed, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+
+	err = json.Unmarshal(body, &secret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrResolveFailed, err)
+	}
+
+	data := secret.Data
+
+	nested, isNested := data["data"].(map[string]any)
+	_, hasMetadata := data["metadata"].(map[string]any)
+	if isNested && hasMetadata {
+		data = nested
+	}
+
+	return flatten(data), nil
+}
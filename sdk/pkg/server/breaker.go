@@ -0,0 +1,108 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrDatabaseUnavailable - Provides a named error for when the circuit breaker is open and database calls are failing fast
+var ErrDatabaseUnavailable = credstackError.NewError(503, "DATABASE_UNAVAILABLE", "database: the database is currently unavailable, try again later")
+
+/*
+Breaker - A circuit breaker that tracks the health of the connection to MongoDB. The breaker opens after a number of
+consecutive failures (failed heartbeats or commands that failed with a network error), and while it is open callers can
+fail fast with ErrDatabaseUnavailable instead of waiting out the full server selection timeout. Once the cooldown has
+elapsed the breaker is half-open, and the next success closes it again while the next failure re-opens it
+*/
+type Breaker struct {
+	// mu - Protects all fields below, as the breaker is fed by the drivers monitoring goroutines
+	mu sync.Mutex
+
+	// threshold - The number of consecutive failures required to open the breaker. Zero disables the breaker
+	threshold int
+
+	// cooldown - How long the breaker stays open before allowing calls through again
+	cooldown time.Duration
+
+	// failures - The number of consecutive failures that have been recorded
+	failures int
+
+	// openedAt - The time the breaker was last opened. Zero while the breaker is closed
+	openedAt time.Time
+
+	// clock - The clock the cooldown is measured with
+	clock clock.Clock
+}
+
+/*
+Allow - Returns ErrDatabaseUnavailable if the breaker is open. Once the cooldown has elapsed, nil is returned so that
+calls can probe the database again
+*/
+func (breaker *Breaker) Allow() error {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	if breaker.openedAt.IsZero() {
+		return nil
+	}
+
+	if breaker.clock.Now().Sub(breaker.openedAt) >= breaker.cooldown {
+		return nil
+	}
+
+	return ErrDatabaseUnavailable
+}
+
+/*
+Success - Records a successful call or heartbeat and closes the breaker
+*/
+func (breaker *Breaker) Success() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	breaker.failures = 0
+	breaker.openedAt = time.Time{}
+}
+
+/*
+Failure - Records a failed call or heartbeat. If the threshold has been reached, or the breaker is half-open, then the
+breaker is (re-)opened
+*/
+func (breaker *Breaker) Failure() {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	if breaker.threshold <= 0 {
+		return
+	}
+
+	breaker.failures++
+	if breaker.failures >= breaker.threshold {
+		breaker.openedAt = breaker.clock.Now()
+	}
+}
+
+/*
+setClock - Replaces the clock the cooldown is measured with
+*/
+func (breaker *Breaker) setClock(c clock.Clock) {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+
+	breaker.clock = c
+}
+
+/*
+NewBreaker - Constructs a closed Breaker that opens after threshold consecutive failures, and stays open for the
+cooldown provided in the parameter, as measured by the clock. A threshold of zero disables the breaker
+*/
+func NewBreaker(threshold int, cooldown time.Duration, c clock.Clock) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		clock:     c,
+	}
+}
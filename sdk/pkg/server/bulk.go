@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrPartialWrite - Returned from bulk operations when some of the operations were applied and others were rejected. The BulkResult describes which
+var ErrPartialWrite = credstackError.NewError(500, "PARTIAL_WRITE", "database: one or more operations in a bulk write failed")
+
+/*
+BulkFailure - Describes a single operation that was rejected during a bulk write
+*/
+type BulkFailure struct {
+	// Index - The index of the operation in the slice that was passed to the bulk write
+	Index int `json:"index"`
+
+	// Code - The MongoDB error code the operation was rejected with (11000 for duplicate keys)
+	Code int `json:"code"`
+
+	// Message - The message MongoDB rejected the operation with
+	Message string `json:"message"`
+}
+
+/*
+BulkResult - The outcome of a bulk write. When ErrPartialWrite is returned, the counts describe the operations that were
+applied, and Failures describes the operations that were not
+*/
+type BulkResult struct {
+	// Inserted - The number of documents that were inserted
+	Inserted int64 `json:"inserted"`
+
+	// Matched - The number of documents that matched the filters of update and replace operations
+	Matched int64 `json:"matched"`
+
+	// Modified - The number of documents that were modified by update and replace operations
+	Modified int64 `json:"modified"`
+
+	// Deleted - The number of documents that were deleted
+	Deleted int64 `json:"deleted"`
+
+	// Upserted - The number of documents that were inserted by upserts
+	Upserted int64 `json:"upserted"`
+
+	// Failures - The operations that were rejected. Empty if every operation was applied
+	Failures []BulkFailure `json:"failures"`
+}
+
+/*
+HasDuplicates - Determines if any of the failed operations were rejected because of a duplicate key
+*/
+func (result *BulkResult) HasDuplicates() bool {
+	for _, failure := range result.Failures {
+		if failure.Code == 11000 {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+BulkWrite - Applies the operations provided in the parameter to the collection in a single round trip. When ordered is
+true, the operations are applied in order and the bulk write stops at the first failure. When ordered is false, every
+operation is attempted and failures do not prevent the others from being applied.
+
+If some of the operations are rejected (duplicate keys, validation failures), then ErrPartialWrite is returned along with
+a BulkResult describing what was and was not applied. Any other error is wrapped with ErrInternalDatabase, and no
+result is returned as it cannot be known what was applied
+*/
+func (database *Database) BulkWrite(collection string, models []mongo.WriteModel, ordered bool) (*BulkResult, error) {
+	if len(models) == 0 {
+		return &BulkResult{Failures: []BulkFailure{}}, nil
+	}
+
+	result, err := database.Collection(collection).BulkWrite(
+		context.Background(),
+		models,
+		mongoOpts.BulkWrite().SetOrdered(ordered),
+	)
+
+	ret := &BulkResult{Failures: []BulkFailure{}}
+	if result != nil {
+		ret.Inserted = result.InsertedCount
+		ret.Matched = result.MatchedCount
+		ret.Modified = result.ModifiedCount
+		ret.Deleted = result.DeletedCount
+		ret.Upserted = result.UpsertedCount
+	}
+
+	if err == nil {
+		return ret, nil
+	}
+
+	return bulkError(ret, err)
+}
+
+/*
+InsertMany - Inserts the documents provided in the parameter into the collection in a single round trip. This should be
+preferred over looping InsertOne. Ordering and partial failures behave exactly as they do with BulkWrite
+*/
+func (database *Database) InsertMany(collection string, documents []any, ordered bool) (*BulkResult, error) {
+	if len(documents) == 0 {
+		return &BulkResult{Failures: []BulkFailure{}}, nil
+	}
+
+	result, err := database.Collection(collection).InsertMany(
+		context.Background(),
+		documents,
+		mongoOpts.InsertMany().SetOrdered(ordered),
+	)
+
+	ret := &BulkResult{Failures: []BulkFailure{}}
+	if result != nil {
+		ret.Inserted = int64(len(result.InsertedIDs))
+	}
+
+	if err == nil {
+		return ret, nil
+	}
+
+	return bulkError(ret, err)
+}
+
+/*
+bulkError - Converts the error returned from a bulk operation into either ErrPartialWrite, with the rejected operations
+recorded on the result, or a wrapped ErrInternalDatabase. Write concern errors are never treated as partial failures, as
+it cannot be known which operations were durably applied
+*/
+func bulkError(result *BulkResult, err error) (*BulkResult, error) {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return nil, fmt.Errorf("%w (%v)", ErrInternalDatabase, err)
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		result.Failures = append(result.Failures, BulkFailure{
+			Index:   writeErr.Index,
+			Code:    writeErr.Code,
+			Message: writeErr.Message,
+		})
+	}
+
+	return result, fmt.Errorf("%w (%d failed)", ErrPartialWrite, len(result.Failures))
+}
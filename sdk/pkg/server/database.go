@@ -2,9 +2,15 @@ package server
 
 import (
 	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
 
+	"github.com/credstack/credstack/sdk/pkg/clock"
 	"github.com/credstack/credstack/sdk/pkg/config"
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
@@ -35,20 +41,108 @@ type Database struct {
 
 	// database - A reference to the Mongo database storing data the server needs to access
 	database *mongo.Database
+
+	// breaker - Tracks the health of the connection so that callers can fail fast while MongoDB is unavailable
+	breaker *Breaker
+
+	// tracer - Records a span for every command sent to MongoDB. Spans are only exported while tracing is enabled
+	tracer *commandTracer
+
+	// clock - The clock round trips to the database are measured with
+	clock clock.Clock
+
+	// lock - Protects client, database, and the credentials in config, as these are replaced when the credentials are rotated
+	lock sync.RWMutex
 }
 
 /*
 Config - Returns a pointer to the config struct used with the Database
 */
 func (database *Database) Config() config.DatabaseConfig {
+	database.lock.RLock()
+	defer database.lock.RUnlock()
+
 	return database.config
 }
 
 /*
-Collection - A getter for returning the underlying mongo.Collection pointer
+mongoClient - Returns the Mongo client that operations are currently made with
+*/
+func (database *Database) mongoClient() *mongo.Client {
+	database.lock.RLock()
+	defer database.lock.RUnlock()
+
+	return database.client
+}
+
+/*
+mongoDatabase - Returns the Mongo database that operations are currently made with
+*/
+func (database *Database) mongoDatabase() *mongo.Database {
+	database.lock.RLock()
+	defer database.lock.RUnlock()
+
+	return database.database
+}
+
+/*
+Collection - A getter for returning the underlying mongo.Collection pointer. The name provided in the parameter is
+resolved with DatabaseConfig.CollectionName, so callers always use credstack's collection names regardless of any
+prefix or overrides
 */
 func (database *Database) Collection(collection string) *mongo.Collection {
-	return database.database.Collection(collection)
+	return database.mongoDatabase().Collection(database.config.CollectionName(collection))
+}
+
+/*
+SetClock - Replaces the clock used by the circuit breaker and for measuring round trips. This is called by
+Server.SetClock, and should not be called while the database is in use
+*/
+func (database *Database) SetClock(c clock.Clock) {
+	database.clock = c
+	database.breaker.setClock(c)
+}
+
+/*
+Available - Returns ErrDatabaseUnavailable if the circuit breaker is open. Callers that are about to make database calls
+(like API handlers) should check this first, so that they fail fast instead of waiting out the server selection timeout
+*/
+func (database *Database) Available() error {
+	return database.breaker.Allow()
+}
+
+/*
+monitors - Returns the server and command monitors used for feeding the circuit breaker. Heartbeats detect when the
+server is unreachable even if no requests are being made, and commands that fail with network errors are counted as
+well. Commands that fail for any other reason (duplicate keys, validation) do not indicate an outage and are ignored.
+The command monitor additionally records a span for every command
+*/
+func (database *Database) monitors() (*event.ServerMonitor, *event.CommandMonitor) {
+	serverMonitor := &event.ServerMonitor{
+		ServerHeartbeatSucceeded: func(*event.ServerHeartbeatSucceededEvent) {
+			database.breaker.Success()
+		},
+		ServerHeartbeatFailed: func(*event.ServerHeartbeatFailedEvent) {
+			database.breaker.Failure()
+		},
+	}
+
+	commandMonitor := &event.CommandMonitor{
+		Started: database.tracer.started,
+		Succeeded: func(_ context.Context, succeeded *event.CommandSucceededEvent) {
+			database.breaker.Success()
+			database.tracer.finished(succeeded.RequestID, nil)
+		},
+		Failed: func(_ context.Context, failed *event.CommandFailedEvent) {
+			if mongo.IsNetworkError(failed.Failure) {
+				database.breaker.Failure()
+			}
+
+			database.tracer.finished(failed.RequestID, commandError(failed))
+		},
+	}
+
+	return serverMonitor, commandMonitor
 }
 
 /*
@@ -57,11 +151,34 @@ this function should be re-used across multiple calls to ensure that excess reso
 are not wasted initiating additional connections to MongoDB.
 */
 func (database *Database) Connect() error {
-	client, err := mongo.Connect(database.config.Mongo())
+	connConfig := database.Config()
+
+	client, err := database.connect(connConfig)
 	if err != nil {
 		return err
 	}
 
+	database.lock.Lock()
+	defer database.lock.Unlock()
+
+	database.client = client
+	database.database = client.Database(connConfig.DefaultDatabase)
+
+	return nil
+}
+
+/*
+connect - Connects a new Mongo client with the config provided in the parameter, and ensures that it can reach and
+authenticate with the database
+*/
+func (database *Database) connect(connConfig config.DatabaseConfig) (*mongo.Client, error) {
+	serverMonitor, commandMonitor := database.monitors()
+
+	client, err := mongo.Connect(connConfig.Mongo().SetServerMonitor(serverMonitor).SetMonitor(commandMonitor))
+	if err != nil {
+		return nil, err
+	}
+
 	/*
 		Ideally we want to consume as little calls as possible, however mongo.Client.Ping is
 		generally a fairly cheap call. Additionally, authentication errors do not get passed
@@ -71,22 +188,108 @@ func (database *Database) Connect() error {
 		to validate that we were able to connect to the database successfully
 	*/
 	err = client.Ping(context.Background(), readpref.Nearest())
+	if err != nil {
+		_ = client.Disconnect(context.Background()) // the client is discarded, so we don't leak its monitoring goroutines across retries
+		return nil, err
+	}
+
+	return client, nil
+}
+
+/*
+SetCredentials - Replaces the username and password the database is authenticated with. This only takes effect the next
+time Database.Connect is called, so it should only be used before connecting. Use Database.Rotate to replace the
+credentials of a database that is already connected
+*/
+func (database *Database) SetCredentials(username string, password string) {
+	database.lock.Lock()
+	defer database.lock.Unlock()
+
+	database.config.Username = username
+	database.config.Password = password
+}
+
+/*
+Rotate - Connects a new client with the username and password provided in the parameter, and replaces the client that
+operations are made with once it has authenticated. The previous client is then disconnected, which waits for any
+operations that are still in flight on it to finish (up to the connection timeout). If the new client fails to connect,
+then the previous client is kept and the error is returned
+*/
+func (database *Database) Rotate(username string, password string) error {
+	rotated := database.Config()
+	rotated.Username = username
+	rotated.Password = password
+
+	client, err := database.connect(rotated)
 	if err != nil {
 		return err
 	}
 
+	database.lock.Lock()
+	previous := database.client
 	database.client = client
-	database.database = client.Database(database.config.DefaultDatabase)
+	database.database = client.Database(rotated.DefaultDatabase)
+	database.config.Username = username
+	database.config.Password = password
+	database.lock.Unlock()
+
+	if previous == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	if rotated.ConnectionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rotated.ConnectionTimeout)
+		defer cancel()
+	}
+
+	_ = previous.Disconnect(ctx) // operations are already made with the new client, so there is nothing to recover if this fails
 
 	return nil
 }
 
+/*
+ConnectWithRetry - Calls Connect, retrying with exponential backoff and jitter if it fails. This allows the server to be
+started before MongoDB is reachable, which is common in containerized deployments. The onRetry function is called
+before every retry with the attempt number, the delay before the retry, and the error that caused it. If every attempt
+fails, then the last error is returned
+*/
+func (database *Database) ConnectWithRetry(onRetry func(attempt int, delay time.Duration, err error)) error {
+	backoff := database.config.ConnectBackoff
+
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		err = database.Connect()
+		if err == nil || attempt >= database.config.ConnectRetries {
+			return err
+		}
+
+		/*
+			Jitter is applied (a random delay between half the backoff and the full backoff), so that replicas that
+			were started at the same time don't all retry at the same time
+		*/
+		delay := backoff/2 + rand.N(backoff/2+1)
+		if onRetry != nil {
+			onRetry(attempt+1, delay, err)
+		}
+
+		time.Sleep(delay)
+
+		backoff *= 2
+		if backoff > database.config.ConnectMaxBackoff {
+			backoff = database.config.ConnectMaxBackoff
+		}
+	}
+}
+
 /*
 Disconnect - Gracefully disconnects from the MongoDB client. Acts as a wrapper
 around mongo.Client.Disconnect and returns any errors that arise from it
 */
 func (database *Database) Disconnect() error {
-	err := database.client.Disconnect(context.Background())
+	err := database.mongoClient().Disconnect(context.Background())
 	if err != nil {
 		return err
 	}
@@ -104,8 +307,17 @@ get inserted. This really shouldn't happen any way as these are generated based
 object, applying indexes here provides an easier way to determine if an object already exists without consuming
 an additional database call.
 
+Collections are created under the names resolved by DatabaseConfig.CollectionName, so any prefix or overrides are
+applied here as well.
+
+Collections listed in DatabaseConfig.NaturalKeyIndexes also receive a unique index on the natural key of their objects,
+so that duplicates are still rejected when the ID strategy does not derive identifiers from it.
+
+Collections listed in DatabaseConfig.TTLIndexes also receive a TTL index, so that MongoDB removes their documents once
+they expire.
+
 A map is returned representing the errors that were encountered during the initialization process. The maps key
-represents the name of the collection and the value is the error that occurred. If an error occurs during initialization
+represents the name of the collection (as it is named in the database) and the value is the error that occurred. If an error occurs during initialization
 then the current iteration of the loop is continued and initialization is continued
 */
 func (database *Database) PreFlight() map[string]error {
@@ -126,8 +338,10 @@ func (database *Database) PreFlight() map[string]error {
 		Generally, this can be optimized to consume even less DB calls with the CreateMultiple function, however this
 		function is only really called once through the entire lifetime of the database
 	*/
-	for collection, fields := range indexingMap {
-		err := database.database.CreateCollection(
+	for logical, fields := range indexingMap {
+		collection := database.config.CollectionName(logical)
+
+		err := database.mongoDatabase().CreateCollection(
 			context.Background(),
 			collection,
 		)
@@ -154,6 +368,34 @@ func (database *Database) PreFlight() map[string]error {
 			failed[collection] = err
 			continue
 		}
+
+		if natural, ok := database.config.NaturalKeyIndexes()[logical]; ok {
+			index = mongo.IndexModel{
+				Keys:    natural,
+				Options: mongoOpts.Index().SetUnique(true),
+			}
+
+			_, err = database.mongoDatabase().Collection(collection).Indexes().CreateOne(context.Background(), index)
+			if err != nil {
+				failed[collection] = err
+				continue
+			}
+		}
+
+		field, ok := database.config.TTLIndexes()[logical]
+		if !ok {
+			continue
+		}
+
+		ttl := mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: mongoOpts.Index().SetExpireAfterSeconds(0),
+		}
+
+		_, err = database.mongoDatabase().Collection(collection).Indexes().CreateOne(context.Background(), ttl)
+		if err != nil {
+			failed[collection] = err
+		}
 	}
 
 	return failed
@@ -167,8 +409,11 @@ if more than 1 are passed here, only the first is used.
 
 If you need to construct a new database from viper configurations, you should use options.DatabaseOptions.FromConfig
 */
-func NewDatabase(config config.DatabaseConfig) *Database {
+func NewDatabase(config config.DatabaseConfig, c clock.Clock) *Database {
 	return &Database{
-		config: config,
+		config:  config,
+		breaker: NewBreaker(config.BreakerThreshold, config.BreakerCooldown, c),
+		tracer:  &commandTracer{},
+		clock:   c,
 	}
 }
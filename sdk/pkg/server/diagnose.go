@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+// ErrMissingIndex - Provides a named error for when a collection is missing the unique index that PreFlight creates on it
+var ErrMissingIndex = credstackError.NewError(500, "MISSING_INDEX", "database: a required unique index does not exist")
+
+/*
+Ping - Pings the primary and returns how long the round trip took. Unlike Connect, which accepts any member of the
+replica set, this ensures that writes can be made
+*/
+func (database *Database) Ping() (time.Duration, error) {
+	start := database.clock.Now()
+
+	err := database.mongoClient().Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return 0, err
+	}
+
+	return database.clock.Now().Sub(start), nil
+}
+
+/*
+ServerTime - Returns the current time according to the MongoDB server, read from the localTime field of the hello
+command. Comparing this to the local clock detects clock skew, which causes freshly issued tokens to be rejected by
+other services
+*/
+func (database *Database) ServerTime() (time.Time, error) {
+	var hello struct {
+		LocalTime time.Time `bson:"localTime"`
+	}
+
+	err := database.mongoDatabase().RunCommand(context.Background(), bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return hello.LocalTime, nil
+}
+
+/*
+MissingIndexes - Checks every collection that PreFlight creates for the unique indexes that PreFlight applies to it. A map
+is returned in the same form as PreFlight: the key is the name of the collection (as it is named in the database) and the
+value is ErrMissingIndex, or the error that occurred while listing its indexes. An empty map means every index exists
+*/
+func (database *Database) MissingIndexes() map[string]error {
+	indexingMap := database.config.IndexingMap()
+	missing := make(map[string]error)
+
+	for logical, fields := range indexingMap {
+		collection := database.config.CollectionName(logical)
+
+		cursor, err := database.mongoDatabase().Collection(collection).Indexes().List(context.Background())
+		if err != nil {
+			missing[collection] = err
+			continue
+		}
+
+		var indexes []struct {
+			Key    bson.D `bson:"key"`
+			Unique bool   `bson:"unique"`
+		}
+
+		err = cursor.All(context.Background(), &indexes)
+		if err != nil {
+			missing[collection] = err
+			continue
+		}
+
+		expected := []bson.D{fields}
+		if natural, ok := database.config.NaturalKeyIndexes()[logical]; ok {
+			expected = append(expected, natural)
+		}
+
+		for _, keys := range expected {
+			found := false
+			for _, index := range indexes {
+				if index.Unique && sameKeys(index.Key, keys) {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				missing[collection] = fmt.Errorf("%w (%v)", ErrMissingIndex, keys)
+				break
+			}
+		}
+	}
+
+	return missing
+}
+
+/*
+sameKeys - Determines if two index specifications index the same fields in the same order. The direction of each field
+is not compared, as the server can return it as a different numeric type than it was created with
+*/
+func sameKeys(a bson.D, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Key != b[i].Key {
+			return false
+		}
+	}
+
+	return true
+}
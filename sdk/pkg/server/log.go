@@ -2,8 +2,10 @@ package server
 
 import (
 	"os"
+	"path/filepath"
 
 	internalTime "github.com/credstack/credstack/sdk/internal/time"
+	"github.com/credstack/credstack/sdk/pkg/clock"
 	"github.com/credstack/credstack/sdk/pkg/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -89,6 +91,34 @@ func (log *Log) LogAuthEvent(eventType string, email string, username string, me
 	)
 }
 
+/*
+LogSecurityEvent - Handler for logging events that indicate a credential may have been compromised, like the reuse of a
+refresh token. These are logged at the warning level so that they stand out from routine authentication events
+*/
+func (log *Log) LogSecurityEvent(eventType string, subject string, appId string, description string) {
+	log.log.Warn(
+		"SecurityEvent",
+		zap.String("eventType", eventType),
+		zap.String("subject", subject),
+		zap.String("application_id", appId),
+		zap.String("description", description),
+	)
+}
+
+/*
+LogDeprecationEvent - Handler for logging the use of a deprecated endpoint or grant type, so that operators can identify
+which clients still need to migrate before the sunset date
+*/
+func (log *Log) LogDeprecationEvent(feature string, appId string, remoteAddr string, sunset string) {
+	log.log.Warn(
+		"DeprecationEvent",
+		zap.String("feature", feature),
+		zap.String("application_id", appId),
+		zap.String("remote_addr", remoteAddr),
+		zap.String("sunset", sunset),
+	)
+}
+
 /*
 LogDatabaseEvent - Logs database specific events, mostly connection and disconnections. Additionally, authentication
 errors get logged here as well.
@@ -145,9 +175,9 @@ func (log *Log) CloseLog() error {
 /*
 NewLog - Constructs a new Log using the values passed in its parameters. If an options structure is not passed in this
 functions parameter, then the Log is initialized with default values. Additionally, if more than 1 are passed here,
-only the first is used.
+only the first is used. The clock provided in the parameter timestamps the name of the log file.
 */
-func NewLog(config config.LogConfig) *Log {
+func NewLog(config config.LogConfig, c clock.Clock) *Log {
 	log := &Log{
 		config: config,
 	}
@@ -178,14 +208,17 @@ func NewLog(config config.LogConfig) *Log {
 	if log.config.UseFileLogging {
 		// filename - Provides dead simple log rotation. The timestamp provided here is arbitrary and go uses this
 		// as a reference for how to build the format for time.Now
-		filename := "/credstack-" + internalTime.StringTimestamp()
+		filename := "credstack-" + internalTime.StringTimestamp(c.Now())
 
 		/*
-			os.OpenFile expects this directory to exist, and should be created before utilizing file logging
+			os.OpenFile expects this directory to exist, so it is created first. Package managers and service managers
+			usually create it with the correct owner already, in which case this does nothing
 		*/
-		fp, err := os.OpenFile(log.config.LogPath+filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			fileError = err
+		fileError = os.MkdirAll(log.config.LogPath, 0750)
+
+		var fp *os.File
+		if fileError == nil {
+			fp, fileError = os.OpenFile(filepath.Join(log.config.LogPath, filename), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		}
 
 		if fileError == nil {
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+/*
+ReadClass - Describes the kind of read being made, so that heavy reads can be routed away from the primary. Reads that
+authentication depends on (fetching a client, a token, a signing key) should never be made with a ReadClass, and should
+always use Database.Collection so that they read from the primary
+*/
+type ReadClass string
+
+const (
+	// ReadClassList - Reads made by list endpoints. Routed with DatabaseConfig.ListReadPreference
+	ReadClassList ReadClass = "list"
+
+	// ReadClassReport - Reads that scan entire collections to produce a report. Routed with DatabaseConfig.ReportReadPreference
+	ReadClassReport ReadClass = "report"
+
+	// ReadClassExport - Reads made by bulk exports. Routed with DatabaseConfig.ExportReadPreference
+	ReadClassExport ReadClass = "export"
+)
+
+/*
+readPreference - Returns the read preference configured for the read class provided in the parameter. If the class is
+unknown or its read preference cannot be parsed, then the primary is returned, so that a misconfiguration never routes
+reads somewhere unexpected
+*/
+func (database *Database) readPreference(class ReadClass) *readpref.ReadPref {
+	var preference string
+
+	switch class {
+	case ReadClassList:
+		preference = database.config.ListReadPreference
+	case ReadClassReport:
+		preference = database.config.ReportReadPreference
+	case ReadClassExport:
+		preference = database.config.ExportReadPreference
+	default:
+		return readpref.Primary()
+	}
+
+	mode, err := readpref.ModeFromString(preference)
+	if err != nil {
+		return readpref.Primary()
+	}
+
+	ret, err := readpref.New(mode)
+	if err != nil {
+		return readpref.Primary()
+	}
+
+	return ret
+}
+
+/*
+ReadCollection - Returns the collection provided in the parameter with the read preference configured for the read
+class. Reads made through the returned collection may be served by a secondary, and can therefore return data that is
+slightly stale. Only use this for reads that can tolerate this (reports, exports, list endpoints). As DatabaseConfig
+currently connects directly to a single host, read preferences only take effect once that host is part of a replica set
+that the driver can discover
+*/
+func (database *Database) ReadCollection(collection string, class ReadClass) *mongo.Collection {
+	return database.mongoDatabase().Collection(
+		database.config.CollectionName(collection),
+		mongoOpts.Collection().SetReadPreference(database.readPreference(class)),
+	)
+}
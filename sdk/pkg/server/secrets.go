@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/secretref"
+)
+
+// databaseCredentials - The fields of the config holding the database credentials, which are resolved again periodically
+var databaseCredentials = []string{"database.username", "database.password"}
+
+/*
+ResolveSecrets - Replaces every field of the config that is set to a secret reference with the secret it refers to. This
+is called by Server.Start, so it only needs to be called by code that uses the config without starting the server (doctor).
+The references to the database credentials are kept, so that Server.Start can resolve them again periodically
+*/
+func (server *Server) ResolveSecrets() error {
+	fields := server.Config.SecretFields()
+
+	references := make(map[string]string)
+	for field, value := range fields {
+		if secretref.IsReference(*value) {
+			references[field] = *value
+		}
+	}
+
+	if len(references) == 0 {
+		return nil
+	}
+
+	server.secrets = secretref.New(server.Config.SecretsConfig, server.clock)
+
+	resolved, err := server.secrets.Resolve(context.Background(), references)
+	if err != nil {
+		return err
+	}
+
+	for field, value := range resolved {
+		*fields[field] = value
+	}
+
+	/*
+		The database was constructed along with the server, so it still holds the references and needs to be updated
+		with the resolved credentials before it connects
+	*/
+	server.Database().SetCredentials(server.Config.DatabaseConfig.Username, server.Config.DatabaseConfig.Password)
+
+	server.databaseReferences = make(map[string]string)
+	for _, field := range databaseCredentials {
+		if reference, ok := references[field]; ok {
+			server.databaseReferences[field] = reference
+		}
+	}
+
+	return nil
+}
+
+/*
+refreshSecrets - Resolves the database credentials again every SecretsConfig.RefreshInterval until Server.Stop is called,
+and rotates the database connection over to them if they have changed. Only the database credentials are refreshed, as
+every other secret is copied into the component that uses it when the server starts
+*/
+func (server *Server) refreshSecrets() {
+	defer server.secretsWG.Done()
+
+	ticker := time.NewTicker(server.Config.SecretsConfig.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-server.secretsStop:
+			return
+		case <-ticker.C:
+			server.rotateDatabaseCredentials()
+		}
+	}
+}
+
+/*
+rotateDatabaseCredentials - Resolves the references to the database credentials, and rotates the database connection over
+to them if either has changed. Failures are only logged, as the current connection keeps working until the previous
+credentials are revoked, and the next refresh may succeed before then
+*/
+func (server *Server) rotateDatabaseCredentials() {
+	resolved, err := server.secrets.Resolve(context.Background(), server.databaseReferences)
+	if err != nil {
+		server.Log().LogErrorEvent("Failed to resolve database credentials, the current credentials are kept", err)
+		return
+	}
+
+	current := server.Database().Config()
+
+	username, ok := resolved["database.username"]
+	if !ok {
+		username = current.Username
+	}
+
+	password, ok := resolved["database.password"]
+	if !ok {
+		password = current.Password
+	}
+
+	if username == current.Username && password == current.Password {
+		return
+	}
+
+	server.Log().LogDatabaseEvent("DatabaseRotateCredentials", current.Hostname, int(current.Port))
+
+	err = server.Database().Rotate(username, password)
+	if err != nil {
+		server.Log().LogErrorEvent("Failed to connect to database with rotated credentials, the current connection is kept", err)
+	}
+}
@@ -1,7 +1,20 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/cache"
+	"github.com/credstack/credstack/sdk/pkg/clock"
 	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/credstack/credstack/sdk/pkg/events"
+	"github.com/credstack/credstack/sdk/pkg/geoip"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/secretref"
+	"github.com/credstack/credstack/sdk/pkg/siem"
+	"github.com/credstack/credstack/sdk/pkg/signer"
 )
 
 /*
@@ -12,11 +25,87 @@ type Server struct {
 	// Config The global configuration structure used for the entire application
 	Config *config.ServerConfig
 
+	// ctx - The context the database calls made with the server are bound to. Nil unless the server was scoped to a request with WithContext
+	ctx context.Context
+
+	*components
+}
+
+/*
+components - The components of a Server. These are shared by the server and every server scoped to a request from it
+(see Server.WithContext), so that they are only constructed, started and stopped once
+*/
+type components struct {
 	// database - Provides a connected database for services to interact with
 	database *Database
 
 	// log - Provides a production-ready Zap logger for services to interact with
 	log *Log
+
+	// geoip - Resolves IP addresses to locations. Initialized when Server.Start is called
+	geoip geoip.Resolver
+
+	// siem - Ships audit and security events to external SIEMs. Initialized when Server.Start is called
+	siem *siem.Dispatcher
+
+	// events - Delivers lifecycle events to webhooks. Initialized when Server.Start is called
+	events *events.Dispatcher
+
+	// clock - Provides the current time for any expiration logic. Defaults to clock.System
+	clock clock.Clock
+
+	// documents - Caches public documents (JWKS) so that they can be served during database outages
+	documents *cache.Cache
+
+	// tokenWriter - Writes issued tokens in batches when the token store is in write_behind mode. Nil in sync mode
+	tokenWriter *WriteBehind
+
+	// signerOnce - Ensures that the signing backend is only constructed once
+	signerOnce sync.Once
+
+	// signer - The external backend signing keys are generated in. Nil for the local backend
+	signer signer.Backend
+
+	// signerErr - The error the signing backend failed to be constructed with, if any
+	signerErr error
+
+	// secrets - Resolves secret references in the config. Nil if the config did not contain any
+	secrets *secretref.Resolver
+
+	// databaseReferences - The references the database credentials were resolved from, keyed by their config key. Empty if neither is a reference
+	databaseReferences map[string]string
+
+	// secretsStop - Closed by Server.Stop to stop re-resolving the database credentials
+	secretsStop chan struct{}
+
+	// secretsWG - Tracks the goroutine re-resolving the database credentials so that Stop can wait for it to finish
+	secretsWG sync.WaitGroup
+}
+
+/*
+Context - Returns the context the database calls made with the server are bound to. This is the context of the request
+the server was scoped to with WithContext, so that calls made on behalf of a request are cancelled once its deadline
+elapses or its client disconnects. Servers that are not scoped to a request return context.Background()
+*/
+func (server *Server) Context() context.Context {
+	if server.ctx == nil {
+		return context.Background()
+	}
+
+	return server.ctx
+}
+
+/*
+WithContext - Returns a copy of the server that is scoped to the context provided in the parameter (see Context). The
+copy shares the config, database, and every other component with the server, so it does not need to be started or
+stopped, and is only meant to live as long as the request it was scoped to
+*/
+func (server *Server) WithContext(ctx context.Context) *Server {
+	return &Server{
+		Config:     server.Config,
+		ctx:        ctx,
+		components: server.components,
+	}
 }
 
 /*
@@ -38,9 +127,126 @@ func (server *Server) Log() *Log {
 }
 
 /*
-Start - Initializes the server. Connects to the database and initializes the logger
+GeoIP - Returns the geo-ip Resolver that the server is currently using. This is nil until Server.Start has been called
+*/
+func (server *Server) GeoIP() geoip.Resolver {
+	return server.geoip
+}
+
+/*
+SIEM - Returns the Dispatcher used for exporting events to external SIEMs. This is nil until Server.Start has been
+called, however Dispatcher.Publish is safe to call on a nil Dispatcher
+*/
+func (server *Server) SIEM() *siem.Dispatcher {
+	return server.siem
+}
+
+/*
+Events - Returns the Dispatcher used for delivering lifecycle events to webhooks. This is nil until Server.Start has been
+called, however Dispatcher.Publish is safe to call on a nil Dispatcher
+*/
+func (server *Server) Events() *events.Dispatcher {
+	return server.events
+}
+
+/*
+PublishEvent - Publishes a lifecycle event of the type provided in the parameter to the webhooks, as occurring now
+according to the server's clock. Delivery happens in the background, so this never blocks the caller. If the event cannot
+be created, then the error is logged and the event is dropped
+*/
+func (server *Server) PublishEvent(eventType string, data any) {
+	event, err := events.New(eventType, server.Clock().Now(), data)
+	if err != nil {
+		server.Log().LogErrorEvent("Failed to create event: "+eventType, err)
+		return
+	}
+
+	server.Events().Publish(event)
+}
+
+/*
+Documents - Returns the cache used for serving public documents (JWKS) while the database is unavailable
+*/
+func (server *Server) Documents() *cache.Cache {
+	return server.documents
+}
+
+/*
+TokenWriter - Returns the WriteBehind queue that issued tokens are written through. This is nil unless the token store
+is in write_behind mode and Server.Start has been called, however WriteBehind.Enqueue is safe to call on a nil WriteBehind
+*/
+func (server *Server) TokenWriter() *WriteBehind {
+	return server.tokenWriter
+}
+
+/*
+Signer - Returns the external Backend that signing keys are generated in and tokens are signed by, or nil if keys are
+generated and stored by credstack itself. The backend is constructed the first time this is called, so that it is also
+available to commands that never call Server.Start (doctor, key export)
+*/
+func (server *Server) Signer() (signer.Backend, error) {
+	server.signerOnce.Do(func() {
+		server.signer, server.signerErr = signer.New(server.Config.SignerConfig, server.clock)
+	})
+
+	return server.signer, server.signerErr
+}
+
+/*
+Clock - Returns the Clock that the server is currently using. Any code that evaluates expirations (tokens, keys) should
+read the current time from here instead of calling time.Now directly
+*/
+func (server *Server) Clock() clock.Clock {
+	return server.clock
+}
+
+/*
+SetClock - Replaces the Clock that the server is using. This is primarily used by tests with a clock.Fake so that
+expirations can be evaluated without sleeping
+*/
+func (server *Server) SetClock(c clock.Clock) {
+	server.clock = c
+
+	server.database.SetClock(c)
+	server.documents.SetClock(c)
+	header.SetClock(c)
+}
+
+/*
+Start - Initializes the server. Validates the configuration, resolves secret references, connects to the database and
+initializes the logger
 */
 func (server *Server) Start() error {
+	err := server.Config.Validate()
+	if err != nil {
+		server.Log().LogErrorEvent("Configuration failed validation", err)
+		return err
+	}
+
+	/*
+		Every object created from here on records the region it was created in, so the region is set before anything
+		can be created
+	*/
+	header.SetRegion(server.Config.RegionConfig.Name)
+	header.SetClock(server.clock)
+
+	err = header.SetStrategy(server.Config.IdentifierConfig.Strategy, server.Config.IdentifierConfig.Namespace)
+	if err != nil {
+		err = fmt.Errorf("%w (%s)", err, server.Config.IdentifierConfig.Strategy)
+		server.Log().LogErrorEvent("Configuration failed validation", err)
+		return err
+	}
+
+	/*
+		Secret references are resolved before anything is constructed from the config, as the references themselves
+		would otherwise be used as secrets
+	*/
+	err = server.ResolveSecrets()
+	if err != nil {
+		server.Log().LogErrorEvent("Failed to resolve secret references", err)
+		return err
+	}
+
 	server.Log().LogDatabaseEvent("DatabaseConnect",
 		server.Config.DatabaseConfig.Hostname,
 		int(server.Config.DatabaseConfig.Port),
@@ -48,14 +254,77 @@ func (server *Server) Start() error {
 
 	/*
 		We still need to connect to our database as the constructors for Server do not
-		provide this functionality by default.
+		provide this functionality by default. The database may not be reachable yet if it was started at the
+		same time as us, so we retry with backoff before giving up
 	*/
-	err := server.Database().Connect()
+	err = server.Database().ConnectWithRetry(func(attempt int, delay time.Duration, err error) {
+		server.Log().LogErrorEvent(fmt.Sprintf("Failed to connect to database, retrying in %s (attempt %d of %d)", delay.Round(time.Millisecond), attempt, server.Config.DatabaseConfig.ConnectRetries), err)
+	})
 	if err != nil {
 		server.Log().LogErrorEvent("Failed to connect to database", err)
 		return err
 	}
 
+	if len(server.databaseReferences) != 0 && server.Config.SecretsConfig.RefreshInterval > 0 {
+		server.secretsStop = make(chan struct{})
+		server.secretsWG.Add(1)
+		go server.refreshSecrets()
+	}
+
+	/*
+		The geo-ip resolver is initialized after the database, as opening the backend (for example, a MaxMind
+		database file) can fail if it is misconfigured and we want to surface this error before serving requests
+	*/
+	resolver, err := geoip.New(server.Config.GeoIPConfig)
+	if err != nil {
+		server.Log().LogErrorEvent("Failed to initialize geo-ip resolver", err)
+		return err
+	}
+
+	server.geoip = resolver
+
+	/*
+		The signing backend is constructed here as well, so that missing credentials are surfaced before serving requests
+		instead of when the first key is generated
+	*/
+	_, err = server.Signer()
+	if err != nil {
+		server.Log().LogErrorEvent("Failed to initialize signing backend", err)
+		return err
+	}
+
+	dispatcher, err := siem.NewDispatcher(server.Config.SIEMConfig, func(exporter string, err error) {
+		server.Log().LogErrorEvent("Dropped batch of events after failing to export them to SIEM: "+exporter, err)
+	})
+	if err != nil {
+		server.Log().LogErrorEvent("Failed to initialize SIEM exporters", err)
+		return err
+	}
+
+	dispatcher.Start()
+	server.siem = dispatcher
+
+	/*
+		Events that cannot be delivered are recorded as dead letters, so that an operator can redeliver them. A dead
+		letter that cannot be recorded is only logged, as the event is lost either way
+	*/
+	server.events = events.NewDispatcher(server.Config.EventsConfig, server.clock, func(letter events.DeadLetter) {
+		_, err := server.Database().Collection("event_dead_letter").InsertOne(context.Background(), &letter)
+		if err != nil {
+			server.Log().LogErrorEvent("Failed to record dead letter for event webhook: "+letter.Webhook, err)
+		}
+	})
+
+	server.events.Start()
+
+	if server.Config.TokenStoreConfig.Mode == config.TokenStoreModeWriteBehind {
+		server.tokenWriter = NewWriteBehind(server.database, "token", server.Config.TokenStoreConfig, func(count int, err error) {
+			server.Log().LogErrorEvent(fmt.Sprintf("Dropped %d tokens after failing to write them to the database", count), err)
+		})
+
+		server.tokenWriter.Start()
+	}
+
 	return nil
 }
 
@@ -63,6 +332,32 @@ func (server *Server) Start() error {
 Stop - Stops the server from running. Disconnects the database and flushes the logger to disk
 */
 func (server *Server) Stop() error {
+	/*
+		Queued tokens are written before we disconnect, as they would otherwise be lost. New tokens cannot be issued
+		at this point, as the API has already stopped accepting requests
+	*/
+	if server.tokenWriter != nil {
+		server.Log().LogShutdownEvent("TokenFlush", "Writing queued tokens to the database")
+		server.tokenWriter.Stop()
+	}
+
+	/*
+		Queued events are delivered before we disconnect, so that any that fail can still be recorded as dead letters
+	*/
+	if server.events != nil {
+		server.Log().LogShutdownEvent("EventFlush", "Delivering queued events to webhooks")
+		server.events.Stop()
+	}
+
+	/*
+		The database credentials are no longer re-resolved once we start disconnecting, so that the connection is not
+		rotated while it is being closed
+	*/
+	if server.secretsStop != nil {
+		close(server.secretsStop)
+		server.secretsWG.Wait()
+	}
+
 	server.Log().LogDatabaseEvent("DatabaseDisconnect",
 		server.Config.DatabaseConfig.Hostname,
 		int(server.Config.DatabaseConfig.Port),
@@ -75,6 +370,21 @@ func (server *Server) Stop() error {
 		return err // log here
 	}
 
+	/*
+		The SIEM dispatcher is stopped before the logger is flushed, as any events that fail to export during the
+		final flush are logged
+	*/
+	if server.siem != nil {
+		server.siem.Stop()
+	}
+
+	if server.geoip != nil {
+		err = server.geoip.Close()
+		if err != nil {
+			return err
+		}
+	}
+
 	server.Log().LogShutdownEvent("LogFlush", "Flushing queued logs and closing log file")
 
 	/*
@@ -95,8 +405,12 @@ func (server *Server) Stop() error {
 // New Initializes a new Server structure with the values provided in the Config structure
 func New(config *config.ServerConfig) *Server {
 	return &Server{
-		Config:   config,
-		database: NewDatabase(config.DatabaseConfig),
-		log:      NewLog(config.LogConfig),
+		Config: config,
+		components: &components{
+			database:  NewDatabase(config.DatabaseConfig, clock.System),
+			log:       NewLog(config.LogConfig, clock.System),
+			clock:     clock.System,
+			documents: cache.New(config.DocumentCacheConfig, clock.System),
+		},
 	}
 }
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/credstack/credstack/sdk/pkg/tracing"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+commandTracer - Records a span for every command sent to MongoDB, from the command monitor of the Database. Commands are
+sent with the context of the operation that issued them, so their spans are children of any span that context carries
+*/
+type commandTracer struct {
+	// spans - The spans of commands that have not finished yet, keyed by the request ID of the command
+	spans sync.Map
+}
+
+/*
+started - Starts the span of the command provided in the parameter. Spans are named after the command and the collection
+it operates on (find client), as described by the OpenTelemetry database semantic conventions. The command itself is
+never recorded, as its filters and documents can contain secrets and personal data
+*/
+func (tracer *commandTracer) started(ctx context.Context, started *event.CommandStartedEvent) {
+	name := started.CommandName
+
+	attributes := []attribute.KeyValue{
+		semconv.DBSystemNameMongoDB,
+		semconv.DBNamespace(started.DatabaseName),
+		semconv.DBOperationName(started.CommandName),
+	}
+
+	/*
+		The first element of a command is its name, and its value is the collection the command operates on. Commands
+		that do not operate on a collection (ping, endSessions) have a value of another type
+	*/
+	if element, err := started.Command.IndexErr(0); err == nil {
+		if collection, ok := element.Value().StringValueOK(); ok {
+			name += " " + collection
+			attributes = append(attributes, semconv.DBCollectionName(collection))
+		}
+	}
+
+	_, span := tracing.StartKind(ctx, name, trace.SpanKindClient, attributes...)
+	if !span.IsRecording() {
+		return
+	}
+
+	tracer.spans.Store(started.RequestID, span)
+}
+
+/*
+finished - Ends the span of the command with the request ID provided in the parameter. If the command failed, then the
+error provided in the parameter is recorded on it
+*/
+func (tracer *commandTracer) finished(requestId int64, err error) {
+	span, ok := tracer.spans.LoadAndDelete(requestId)
+	if !ok {
+		return
+	}
+
+	tracing.End(span.(trace.Span), err)
+}
+
+/*
+commandError - Returns the failure of a failed command as an error
+*/
+func commandError(failed *event.CommandFailedEvent) error {
+	if failed.Failure == nil {
+		return errors.New("command failed")
+	}
+
+	return failed.Failure
+}
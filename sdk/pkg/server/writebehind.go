@@ -0,0 +1,292 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/credstack/credstack/sdk/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// writeBehindBackoff - The initial delay between retries of a failed batch. This is doubled after every attempt
+const writeBehindBackoff = 100 * time.Millisecond
+
+/*
+WriteBehindStats - A snapshot of the state of a WriteBehind queue. QueueDepth approaching Capacity means the database
+is not keeping up with issuance, and new writes will start falling back to synchronous writes
+*/
+type WriteBehindStats struct {
+	// QueueDepth - The number of documents currently waiting to be written
+	QueueDepth int `json:"queue_depth"`
+
+	// Capacity - The maximum number of documents that can be queued
+	Capacity int `json:"capacity"`
+
+	// Written - The number of documents that have been written in batches
+	Written int64 `json:"written"`
+
+	// Dropped - The number of documents that could not be written, either individually or because their batch exhausted its retries
+	Dropped int64 `json:"dropped"`
+
+	// Fallbacks - The number of documents that were written synchronously because the queue was full
+	Fallbacks int64 `json:"fallbacks"`
+}
+
+/*
+WriteBehind - Queues documents for a single collection into a bounded buffer and writes them in batches. This removes the
+database write from the latency of the request that produced the document. Enqueue never blocks: if the queue is full,
+the caller is expected to write the document synchronously instead, which applies back-pressure to the caller without
+losing the document
+*/
+type WriteBehind struct {
+	// database - The database that batches are written to
+	database *Database
+
+	// collection - The collection that batches are written to
+	collection string
+
+	// config - The options for the queue
+	config config.TokenStoreConfig
+
+	// queue - Documents waiting to be batched
+	queue chan any
+
+	// onError - Called with the number of documents that were dropped whenever a write fails
+	onError func(count int, err error)
+
+	// wg - Tracks the running flush goroutine so that Stop can wait for it to finish
+	wg sync.WaitGroup
+
+	// written - The number of documents that have been written in batches
+	written atomic.Int64
+
+	// dropped - The number of documents that could not be written
+	dropped atomic.Int64
+
+	// fallbacks - The number of documents written synchronously because the queue was full
+	fallbacks atomic.Int64
+
+	// lock - Held for reading while documents are queued, and for writing while Stop closes the queue, so that a document is never sent on a closed queue
+	lock sync.RWMutex
+
+	// stopped - Set by Stop. Documents enqueued after this are written synchronously by the caller
+	stopped bool
+
+	// metrics - The registration of the callback that reports Stats to OpenTelemetry, which is unregistered by Stop
+	metrics metric.Registration
+}
+
+/*
+Enqueue - Queues the document to be written in the next batch. If the queue is full, then false is returned and the
+fallback is counted, and the caller should write the document synchronously. Calling Enqueue on a nil WriteBehind always
+returns false, so callers do not need to check if write-behind is enabled. Once Stop has been called, false is always
+returned so that the document is written synchronously before the database is disconnected
+*/
+func (writer *WriteBehind) Enqueue(document any) bool {
+	if writer == nil {
+		return false
+	}
+
+	writer.lock.RLock()
+	defer writer.lock.RUnlock()
+
+	if writer.stopped {
+		return false
+	}
+
+	select {
+	case writer.queue <- document:
+		return true
+	default:
+		writer.fallbacks.Add(1)
+		return false
+	}
+}
+
+/*
+Stats - Returns a snapshot of the queue depth and write counters. Calling Stats on a nil WriteBehind returns empty stats
+*/
+func (writer *WriteBehind) Stats() WriteBehindStats {
+	if writer == nil {
+		return WriteBehindStats{}
+	}
+
+	return WriteBehindStats{
+		QueueDepth: len(writer.queue),
+		Capacity:   cap(writer.queue),
+		Written:    writer.written.Load(),
+		Dropped:    writer.dropped.Load(),
+		Fallbacks:  writer.fallbacks.Load(),
+	}
+}
+
+/*
+Start - Starts the goroutine that batches and writes queued documents, and registers the metrics of the queue (see
+registerMetrics)
+*/
+func (writer *WriteBehind) Start() {
+	writer.registerMetrics()
+
+	writer.wg.Add(1)
+	go writer.run()
+}
+
+/*
+registerMetrics - Reports Stats to OpenTelemetry whenever metrics are collected: the queue depth and capacity as gauges,
+and the written, dropped, and fallback counts as counters, each with the collection of the queue as an attribute. Alerting
+on the queue depth approaching its capacity, or on fallbacks increasing, shows that the database is not keeping up before
+issuance slows down. Metrics are only exported while tracing is enabled (see tracing.NewProvider). A failure to register
+them never prevents the queue from starting, and is reported to the global OpenTelemetry error handler instead
+*/
+func (writer *WriteBehind) registerMetrics() {
+	meter := tracing.Meter()
+
+	queueDepth, queueErr := meter.Int64ObservableGauge("credstack.write_behind.queue_depth", metric.WithDescription("The number of documents waiting to be written"))
+	capacity, capacityErr := meter.Int64ObservableGauge("credstack.write_behind.capacity", metric.WithDescription("The maximum number of documents that can be queued"))
+	written, writtenErr := meter.Int64ObservableCounter("credstack.write_behind.written", metric.WithDescription("The number of documents that have been written in batches"))
+	dropped, droppedErr := meter.Int64ObservableCounter("credstack.write_behind.dropped", metric.WithDescription("The number of documents that could not be written"))
+	fallbacks, fallbacksErr := meter.Int64ObservableCounter("credstack.write_behind.fallbacks", metric.WithDescription("The number of documents written synchronously because the queue was full"))
+
+	err := errors.Join(queueErr, capacityErr, writtenErr, droppedErr, fallbacksErr)
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+
+	collection := metric.WithAttributes(attribute.String("db.collection.name", writer.collection))
+
+	writer.metrics, err = meter.RegisterCallback(func(_ context.Context, observer metric.Observer) error {
+		stats := writer.Stats()
+
+		observer.ObserveInt64(queueDepth, int64(stats.QueueDepth), collection)
+		observer.ObserveInt64(capacity, int64(stats.Capacity), collection)
+		observer.ObserveInt64(written, stats.Written, collection)
+		observer.ObserveInt64(dropped, stats.Dropped, collection)
+		observer.ObserveInt64(fallbacks, stats.Fallbacks, collection)
+
+		return nil
+	}, queueDepth, capacity, written, dropped, fallbacks)
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+/*
+Stop - Closes the queue and waits for any queued documents to be written. This must be called before the database is
+disconnected
+*/
+func (writer *WriteBehind) Stop() {
+	writer.lock.Lock()
+	if writer.stopped {
+		writer.lock.Unlock()
+		return
+	}
+
+	writer.stopped = true
+	close(writer.queue)
+	writer.lock.Unlock()
+
+	writer.wg.Wait()
+
+	if writer.metrics != nil {
+		_ = writer.metrics.Unregister()
+	}
+}
+
+/*
+run - Collects documents into batches and writes them once the batch is full, or once the flush interval has elapsed
+*/
+func (writer *WriteBehind) run() {
+	defer writer.wg.Done()
+
+	ticker := time.NewTicker(writer.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]any, 0, writer.config.BatchSize)
+
+	for {
+		select {
+		case document, ok := <-writer.queue:
+			if !ok {
+				writer.flush(batch)
+				return
+			}
+
+			batch = append(batch, document)
+			if len(batch) >= writer.config.BatchSize {
+				writer.flush(batch)
+				batch = make([]any, 0, writer.config.BatchSize)
+			}
+		case <-ticker.C:
+			writer.flush(batch)
+			batch = make([]any, 0, writer.config.BatchSize)
+		}
+	}
+}
+
+/*
+flush - Writes the batch with a single unordered Database.InsertMany, retrying with exponential backoff. The insert is
+unordered so that a single duplicate does not prevent the rest of the batch from being written. Documents that were
+rejected individually (ErrPartialWrite) are dropped without retrying the batch, as retrying would only fail them again.
+If every attempt fails, then the batch is dropped. The error handler is called for any documents that were dropped
+*/
+func (writer *WriteBehind) flush(batch []any) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var err error
+
+	backoff := writeBehindBackoff
+	for attempt := 0; attempt <= writer.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var result *BulkResult
+
+		result, err = writer.database.InsertMany(writer.collection, batch, false)
+		if err == nil {
+			writer.written.Add(result.Inserted)
+			return
+		}
+
+		if errors.Is(err, ErrPartialWrite) {
+			writer.written.Add(result.Inserted)
+			writer.dropped.Add(int64(len(result.Failures)))
+
+			if writer.onError != nil {
+				writer.onError(len(result.Failures), err)
+			}
+
+			return
+		}
+	}
+
+	writer.dropped.Add(int64(len(batch)))
+
+	if writer.onError != nil {
+		writer.onError(len(batch), err)
+	}
+}
+
+/*
+NewWriteBehind - Constructs a WriteBehind that writes batches to the collection provided in the parameter. Calling this
+function does not start writing, this needs to be done post-construction with WriteBehind.Start
+*/
+func NewWriteBehind(database *Database, collection string, config config.TokenStoreConfig, onError func(count int, err error)) *WriteBehind {
+	return &WriteBehind{
+		database:   database,
+		collection: collection,
+		config:     config,
+		queue:      make(chan any, config.QueueSize),
+		onError:    onError,
+	}
+}
@@ -0,0 +1,258 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrSessionDoesNotExist - Provides a named error for when a session cannot be found, or has expired
+var ErrSessionDoesNotExist = credstackError.NewError(404, "SESSION_DOES_NOT_EXIST", "session: Session does not exist or has expired")
+
+// ErrSessionMissingSubject - Provides a named error for when sessions are listed or revoked without a subject
+var ErrSessionMissingSubject = credstackError.NewError(400, "SESSION_MISSING_SUBJECT", "session: A subject must be provided")
+
+// ErrSessionMissingIdentifier - Provides a named error for when a session is revoked without an identifier
+var ErrSessionMissingIdentifier = credstackError.NewError(400, "SESSION_MISSING_ID", "session: Session is missing an identifier")
+
+/*
+Session - Represents a user that is signed in to credstack from a browser. The session ID that identifies the session to
+credstack is opaque, and is only ever stored in the user agent's cookie. Only its hash is stored here, and sessions are
+referred to by the identifier in their header everywhere else (like the management API)
+*/
+type Session struct {
+	// Header - The header for the Session. Created at object birth
+	Header *header.Header `json:"header" bson:"header"`
+
+	// SessionHash - The SHA-256 hash of the session ID, encoded as a hex string
+	SessionHash string `json:"-" bson:"session_hash"`
+
+	// Subject - The user that is signed in
+	Subject string `json:"subject" bson:"subject"`
+
+	// Clients - The client IDs the user has authorized during the session
+	Clients []string `json:"clients" bson:"clients"`
+
+	// RemoteAddr - The IP address the user logged in from
+	RemoteAddr string `json:"remote_addr" bson:"remote_addr"`
+
+	// UserAgent - The user agent the user logged in with, so that they can recognize their sessions
+	UserAgent string `json:"user_agent" bson:"user_agent"`
+
+	// LastSeenAt - A unix timestamp representing when the session was last used
+	LastSeenAt int64 `json:"last_seen_at" bson:"last_seen_at"`
+
+	// AbsoluteExpiresAt - A unix timestamp representing when the session ends, regardless of how often it is used
+	AbsoluteExpiresAt int64 `json:"absolute_expires_at" bson:"absolute_expires_at"`
+
+	// ExpiresAt - When the session ends if it is not used again. This is the earliest of the idle and absolute timeouts,
+	// and is stored as a date so that the TTL index on the collection can remove the session once it passes
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+Start - Records that the user identified by the subject has logged in and authorized the client, and returns the session
+ID to store in the user agent's cookie along with the session itself. If the session ID provided in the parameter belongs
+to an active session for the same user, then the client is added to it and the same ID is returned. Otherwise, a new
+session is started.
+
+If SessionConfig.AbsoluteTimeout is zero, then sessions are disabled and an empty session ID is returned with a nil session
+*/
+func Start(serv *server.Server, sessionId string, subject string, clientId string, remoteAddr string, userAgent string) (string, *Session, error) {
+	timeout := serv.Config.SessionConfig.AbsoluteTimeout
+	if timeout <= 0 {
+		return "", nil, nil
+	}
+
+	if existing, err := Get(serv, sessionId); err == nil && existing.Subject == subject {
+		_, err = serv.Database().Collection("session").UpdateOne(
+			serv.Context(),
+			bson.M{"session_hash": existing.SessionHash},
+			bson.M{"$addToSet": bson.M{"clients": clientId}},
+		)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+
+		return sessionId, existing, nil
+	}
+
+	sessionId, err := secret.RandString(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	/*
+		The session ID cannot be used as the basis for the header, as the identifier would then be derived from the
+		secret, so a random basis is used instead
+	*/
+	sessionHeader, err := header.NewRandom()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := serv.Clock().Now()
+	absolute := now.Add(timeout)
+
+	started := &Session{
+		Header:            sessionHeader,
+		SessionHash:       hashSessionId(sessionId),
+		Subject:           subject,
+		Clients:           []string{clientId},
+		RemoteAddr:        remoteAddr,
+		UserAgent:         userAgent,
+		LastSeenAt:        now.Unix(),
+		AbsoluteExpiresAt: absolute.Unix(),
+		ExpiresAt:         idleExpiry(serv, now, absolute),
+	}
+
+	_, err = serv.Database().Collection("session").InsertOne(serv.Context(), started)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return sessionId, started, nil
+}
+
+/*
+Get - Fetches the active session identified by the session ID provided in the parameter, and marks it as used so that
+its idle timeout starts over. If the session does not exist or has expired, then ErrSessionDoesNotExist is returned.
+Expired sessions are checked for explicitly, as the TTL index only removes them periodically
+*/
+func Get(serv *server.Server, sessionId string) (*Session, error) {
+	if sessionId == "" {
+		return nil, ErrSessionDoesNotExist
+	}
+
+	var ret Session
+
+	now := serv.Clock().Now()
+
+	err := serv.Database().Collection("session").FindOne(
+		serv.Context(),
+		bson.M{"session_hash": hashSessionId(sessionId), "expires_at": bson.M{"$gt": now}},
+	).Decode(&ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrSessionDoesNotExist
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret.LastSeenAt = now.Unix()
+	ret.ExpiresAt = idleExpiry(serv, now, time.Unix(ret.AbsoluteExpiresAt, 0))
+
+	_, err = serv.Database().Collection("session").UpdateOne(
+		serv.Context(),
+		bson.M{"session_hash": ret.SessionHash},
+		bson.M{"$set": bson.M{"last_seen_at": ret.LastSeenAt, "expires_at": ret.ExpiresAt}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+List - Lists the active sessions of the user identified by the subject, most recently used first
+*/
+func List(serv *server.Server, subject string) ([]*Session, error) {
+	if subject == "" {
+		return nil, ErrSessionMissingSubject
+	}
+
+	result, err := serv.Database().ReadCollection("session", server.ReadClassList).Find(
+		serv.Context(),
+		bson.M{"subject": subject, "expires_at": bson.M{"$gt": serv.Clock().Now()}},
+		mongoOpts.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := []*Session{}
+
+	err = result.All(serv.Context(), &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return ret, nil
+}
+
+/*
+Revoke - Ends a single session of the user identified by the subject, using the identifier in the session's header. If
+the session does not exist or belongs to a different user, then ErrSessionDoesNotExist is returned
+*/
+func Revoke(serv *server.Server, subject string, identifier string) error {
+	if subject == "" {
+		return ErrSessionMissingSubject
+	}
+
+	if identifier == "" {
+		return ErrSessionMissingIdentifier
+	}
+
+	result, err := serv.Database().Collection("session").DeleteOne(
+		serv.Context(),
+		bson.M{"subject": subject, "header.identifier": identifier},
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrSessionDoesNotExist
+	}
+
+	return nil
+}
+
+/*
+RevokeAll - Ends every session of the user identified by the subject, and returns how many were ended
+*/
+func RevokeAll(serv *server.Server, subject string) (int64, error) {
+	if subject == "" {
+		return 0, ErrSessionMissingSubject
+	}
+
+	result, err := serv.Database().Collection("session").DeleteMany(serv.Context(), bson.M{"subject": subject})
+	if err != nil {
+		return 0, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return result.DeletedCount, nil
+}
+
+/*
+idleExpiry - Returns when a session used at the time provided in the parameter ends if it is not used again. This is the
+idle timeout from now, but never later than the absolute expiration of the session
+*/
+func idleExpiry(serv *server.Server, now time.Time, absolute time.Time) time.Time {
+	idle := serv.Config.SessionConfig.IdleTimeout
+	if idle <= 0 || now.Add(idle).After(absolute) {
+		return absolute
+	}
+
+	return now.Add(idle)
+}
+
+/*
+hashSessionId - Hashes a session ID for storage, so that a read of the database cannot be used to hijack sessions
+*/
+func hashSessionId(sessionId string) string {
+	sum := sha256.Sum256([]byte(sessionId))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,229 @@
+package siem
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+// retryBackoff - The initial delay between retries of a failed batch. This is doubled after every attempt
+const retryBackoff = time.Second
+
+/*
+ErrorHandler - A function that is called whenever a batch is dropped after exhausting its retries. This is used for
+surfacing export failures to the servers logger, as the siem package has no awareness of it
+*/
+type ErrorHandler func(exporter string, err error)
+
+/*
+pipeline - Buffers, batches, and exports events for a single exporter. Every exporter gets its own pipeline so that a slow
+or unavailable SIEM does not delay delivery to the others
+*/
+type pipeline struct {
+	// config - The options for the exporter this pipeline feeds
+	config config.SIEMExporterConfig
+
+	// exporter - The exporter that batches are sent to
+	exporter Exporter
+
+	// queue - Events waiting to be batched
+	queue chan Event
+
+	// dropped - The number of events dropped because the queue was full
+	dropped atomic.Int64
+}
+
+/*
+Dispatcher - Fans out published events to every configured exporter. Publishing is non-blocking, and events are dropped
+(and counted) if an exporters queue is full, as we never want SIEM delivery to block token issuance or management calls
+*/
+type Dispatcher struct {
+	// pipelines - One pipeline per configured exporter
+	pipelines []*pipeline
+
+	// onError - Called when a batch is dropped after exhausting its retries
+	onError ErrorHandler
+
+	// wg - Tracks the running pipeline goroutines so that Stop can wait for them to flush
+	wg sync.WaitGroup
+
+	// lock - Held for reading while events are queued, and for writing while Stop closes the queues, so that an event is never sent on a closed queue
+	lock sync.RWMutex
+
+	// stopped - Set by Stop. Events published after this are dropped
+	stopped bool
+}
+
+/*
+Publish - Queues the event for every exporter whose filter matches it. Calling Publish on a nil Dispatcher is a no-op,
+so callers do not need to check if the server has been started. Events published after Stop has been called are
+dropped, as the server is shutting down
+*/
+func (dispatcher *Dispatcher) Publish(event Event) {
+	if dispatcher == nil {
+		return
+	}
+
+	dispatcher.lock.RLock()
+	defer dispatcher.lock.RUnlock()
+
+	if dispatcher.stopped {
+		return
+	}
+
+	for _, p := range dispatcher.pipelines {
+		if !matches(p.config, event) {
+			continue
+		}
+
+		select {
+		case p.queue <- event:
+		default:
+			p.dropped.Add(1)
+		}
+	}
+}
+
+/*
+Dropped - Returns the number of events that have been dropped for each exporter because its queue was full
+*/
+func (dispatcher *Dispatcher) Dropped() map[string]int64 {
+	ret := make(map[string]int64, len(dispatcher.pipelines))
+	for _, p := range dispatcher.pipelines {
+		ret[p.config.Name] = p.dropped.Load()
+	}
+
+	return ret
+}
+
+/*
+Start - Starts a goroutine for each exporter that batches and exports queued events
+*/
+func (dispatcher *Dispatcher) Start() {
+	for _, p := range dispatcher.pipelines {
+		dispatcher.wg.Add(1)
+		go dispatcher.run(p)
+	}
+}
+
+/*
+Stop - Closes every exporters queue and waits for any buffered events to be flushed. Calling Stop more than once is a
+no-op
+*/
+func (dispatcher *Dispatcher) Stop() {
+	dispatcher.lock.Lock()
+	if dispatcher.stopped {
+		dispatcher.lock.Unlock()
+		return
+	}
+
+	dispatcher.stopped = true
+	for _, p := range dispatcher.pipelines {
+		close(p.queue)
+	}
+	dispatcher.lock.Unlock()
+
+	dispatcher.wg.Wait()
+}
+
+/*
+run - Collects events into batches and exports them once the batch is full, or once the flush interval has elapsed
+*/
+func (dispatcher *Dispatcher) run(p *pipeline) {
+	defer dispatcher.wg.Done()
+
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, p.config.BatchSize)
+
+	for {
+		select {
+		case event, ok := <-p.queue:
+			if !ok {
+				dispatcher.export(p, batch)
+				return
+			}
+
+			batch = append(batch, event)
+			if len(batch) >= p.config.BatchSize {
+				dispatcher.export(p, batch)
+				batch = make([]Event, 0, p.config.BatchSize)
+			}
+		case <-ticker.C:
+			dispatcher.export(p, batch)
+			batch = make([]Event, 0, p.config.BatchSize)
+		}
+	}
+}
+
+/*
+export - Sends the batch to the exporter, retrying with exponential backoff. If every attempt fails, then the batch is
+dropped and the error handler is called
+*/
+func (dispatcher *Dispatcher) export(p *pipeline, batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var err error
+
+	backoff := retryBackoff
+	for attempt := 0; attempt <= p.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		err = p.exporter.Export(context.Background(), batch)
+		if err == nil {
+			return
+		}
+	}
+
+	if dispatcher.onError != nil {
+		dispatcher.onError(p.config.Name, err)
+	}
+}
+
+/*
+NewDispatcher - Constructs a Dispatcher with a pipeline for each exporter defined in the config. Any unset batching
+options on an exporter are replaced with defaults. Calling this function does not start delivery, this needs to be
+done post-construction with Dispatcher.Start
+*/
+func NewDispatcher(config config.SIEMConfig, onError ErrorHandler) (*Dispatcher, error) {
+	dispatcher := &Dispatcher{
+		pipelines: make([]*pipeline, 0, len(config.Exporters)),
+		onError:   onError,
+	}
+
+	for _, exporterConfig := range config.Exporters {
+		if exporterConfig.BatchSize <= 0 {
+			exporterConfig.BatchSize = 100
+		}
+
+		if exporterConfig.FlushInterval <= 0 {
+			exporterConfig.FlushInterval = 5 * time.Second
+		}
+
+		if exporterConfig.Timeout <= 0 {
+			exporterConfig.Timeout = 10 * time.Second
+		}
+
+		exporter, err := newExporter(exporterConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		dispatcher.pipelines = append(dispatcher.pipelines, &pipeline{
+			config:   exporterConfig,
+			exporter: exporter,
+			queue:    make(chan Event, config.QueueSize),
+		})
+	}
+
+	return dispatcher, nil
+}
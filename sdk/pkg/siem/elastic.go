@@ -0,0 +1,100 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+elasticDocument - The document written to Elasticsearch for each event. @timestamp is included so that events can be
+used with data streams and Kibana without an ingest pipeline
+*/
+type elasticDocument struct {
+	Timestamp string `json:"@timestamp"`
+	Event     Event  `json:"event"`
+}
+
+/*
+elasticBulkResponse - The subset of the bulk API response needed to detect partial failures
+*/
+type elasticBulkResponse struct {
+	Errors bool `json:"errors"`
+}
+
+/*
+ElasticExporter - Ships events to Elasticsearch using the bulk API. Each event is written as a create operation so that
+the exporter works with both regular indices and data streams
+*/
+type ElasticExporter struct {
+	// config - The options used for connecting to Elasticsearch
+	config config.SIEMExporterConfig
+
+	// client - The HTTP client used for sending requests
+	client *http.Client
+}
+
+/*
+Export - Sends the batch of events to the _bulk endpoint. The bulk API returns 200 even if some operations fail, so the
+response body is checked as well and the batch is retried if any operation failed
+*/
+func (exporter *ElasticExporter) Export(ctx context.Context, events []Event) error {
+	var body bytes.Buffer
+
+	encoder := json.NewEncoder(&body)
+	for _, event := range events {
+		err := encoder.Encode(map[string]any{"create": map[string]string{"_index": exporter.config.Index}})
+		if err != nil {
+			return fmt.Errorf("%w (%v)", ErrExportFailed, err)
+		}
+
+		err = encoder.Encode(elasticDocument{
+			Timestamp: time.Unix(event.Time, 0).UTC().Format(time.RFC3339),
+			Event:     event,
+		})
+		if err != nil {
+			return fmt.Errorf("%w (%v)", ErrExportFailed, err)
+		}
+	}
+
+	endpoint := strings.TrimSuffix(exporter.config.Endpoint, "/") + "/_bulk"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrExportFailed, err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if exporter.config.Token != "" {
+		req.Header.Set("Authorization", "ApiKey "+exporter.config.Token)
+	}
+
+	resp, err := exporter.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrExportFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w (elasticsearch returned status %d)", ErrExportFailed, resp.StatusCode)
+	}
+
+	var bulkResponse elasticBulkResponse
+
+	err = json.NewDecoder(resp.Body).Decode(&bulkResponse)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrExportFailed, err)
+	}
+
+	if bulkResponse.Errors {
+		return fmt.Errorf("%w (one or more bulk operations failed)", ErrExportFailed)
+	}
+
+	return nil
+}
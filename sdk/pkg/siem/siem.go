@@ -0,0 +1,75 @@
+package siem
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrUnknownExporter - An error that gets returned when an exporter is configured with a type that does not exist
+var ErrUnknownExporter = credstackError.NewError(500, "ERR_UNKNOWN_SIEM_EXPORTER", "siem: The requested exporter type does not exist")
+
+// ErrExportFailed - An error that gets wrapped when a SIEM rejects a batch of events
+var ErrExportFailed = credstackError.NewError(502, "ERR_SIEM_EXPORT_FAILED", "siem: Failed to export events")
+
+/*
+Event - Represents a single audit or security event that can be shipped to a SIEM. Data is marshaled to JSON as-is, so
+it should be a structure with JSON tags (like audit.Record)
+*/
+type Event struct {
+	// Time - A unix timestamp representing when the event occurred
+	Time int64 `json:"time"`
+
+	// Type - The type of the event (user.registered, token.issued). Used for filtering
+	Type string `json:"type"`
+
+	// Data - The payload of the event
+	Data any `json:"data"`
+}
+
+/*
+Exporter - Interface that all SIEM exporters implement. Export is called with batches of events that have already been
+filtered for the exporter, and should return an error if the batch should be retried
+*/
+type Exporter interface {
+	// Export - Ships the batch of events to the SIEM
+	Export(ctx context.Context, events []Event) error
+}
+
+/*
+newExporter - Constructs the Exporter for the type defined in the config. If the type does not exist, then
+ErrUnknownExporter is returned
+*/
+func newExporter(config config.SIEMExporterConfig) (Exporter, error) {
+	client := &http.Client{Timeout: config.Timeout}
+
+	switch config.Type {
+	case "splunk":
+		return &SplunkExporter{config: config, client: client}, nil
+	case "elastic":
+		return &ElasticExporter{config: config, client: client}, nil
+	default:
+		return nil, ErrUnknownExporter
+	}
+}
+
+/*
+matches - Determines if the event should be exported according to the exporters EventTypes filter. An empty filter
+matches every event
+*/
+func matches(config config.SIEMExporterConfig, event Event) bool {
+	if len(config.EventTypes) == 0 {
+		return true
+	}
+
+	for _, prefix := range config.EventTypes {
+		if strings.HasPrefix(event.Type, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
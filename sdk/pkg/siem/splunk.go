@@ -0,0 +1,79 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+splunkEvent - The envelope expected by the Splunk HTTP Event Collector for each event
+*/
+type splunkEvent struct {
+	Time       int64  `json:"time"`
+	Source     string `json:"source"`
+	SourceType string `json:"sourcetype,omitempty"`
+	Index      string `json:"index,omitempty"`
+	Event      Event  `json:"event"`
+}
+
+/*
+SplunkExporter - Ships events to a Splunk HTTP Event Collector. Batches are sent as concatenated JSON event envelopes to
+the /services/collector/event endpoint, which is the native batching format supported by HEC
+*/
+type SplunkExporter struct {
+	// config - The options used for connecting to HEC
+	config config.SIEMExporterConfig
+
+	// client - The HTTP client used for sending requests
+	client *http.Client
+}
+
+/*
+Export - Sends the batch of events to HEC. Any non-200 response is returned as a wrapped ErrExportFailed so that the
+batch can be retried
+*/
+func (exporter *SplunkExporter) Export(ctx context.Context, events []Event) error {
+	var body bytes.Buffer
+
+	encoder := json.NewEncoder(&body)
+	for _, event := range events {
+		err := encoder.Encode(splunkEvent{
+			Time:       event.Time,
+			Source:     "credstack",
+			SourceType: exporter.config.SourceType,
+			Index:      exporter.config.Index,
+			Event:      event,
+		})
+		if err != nil {
+			return fmt.Errorf("%w (%v)", ErrExportFailed, err)
+		}
+	}
+
+	endpoint := strings.TrimSuffix(exporter.config.Endpoint, "/") + "/services/collector/event"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrExportFailed, err)
+	}
+
+	req.Header.Set("Authorization", "Splunk "+exporter.config.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := exporter.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrExportFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w (splunk returned status %d)", ErrExportFailed, resp.StatusCode)
+	}
+
+	return nil
+}
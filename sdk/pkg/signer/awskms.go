@@ -0,0 +1,189 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+awsKMSBackend - Signs with AWS KMS. A KMS key is created for every signing key, so references are the ARN of the KMS
+key, and retired keys are scheduled for deletion
+*/
+type awsKMSBackend struct {
+	// config - The options of the backend
+	config config.AWSKMSSignerConfig
+
+	// client - The client every request to KMS is sent with
+	client *kms.Client
+
+	// timeout - How long every request to KMS, including its retries, is waited for
+	timeout time.Duration
+}
+
+/*
+newAWSKMSBackend - Constructs the Backend for AWS KMS. If credentials are set in the config, then every request is
+signed with them. Otherwise, they are resolved by the default credential chain of the AWS SDK (environment variables,
+the shared config and credentials files, SSO, web identity, and the ECS and EC2 instance roles) when the first request
+is sent
+*/
+func newAWSKMSBackend(signerConfig config.SignerConfig, _ clock.Clock) (Backend, error) {
+	kmsConfig := signerConfig.AWSKMS
+
+	options := []func(*awsConfig.LoadOptions) error{awsConfig.WithRegion(kmsConfig.Region)}
+
+	if kmsConfig.AccessKeyId != "" {
+		options = append(options, awsConfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(kmsConfig.AccessKeyId, kmsConfig.SecretAccessKey, kmsConfig.SessionToken),
+		))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), signerConfig.Timeout)
+	defer cancel()
+
+	loaded, err := awsConfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", config.ErrInvalidSignerConfig, err)
+	}
+
+	client := kms.NewFromConfig(loaded, func(o *kms.Options) {
+		if kmsConfig.Endpoint != "" {
+			o.BaseEndpoint = aws.String(kmsConfig.Endpoint)
+		}
+	})
+
+	return &awsKMSBackend{
+		config:  kmsConfig,
+		client:  client,
+		timeout: signerConfig.Timeout,
+	}, nil
+}
+
+func (backend *awsKMSBackend) Name() string {
+	return "aws_kms"
+}
+
+/*
+Generate - Creates a new KMS key for signing with the algorithm, tagged with the audience it signs tokens for
+*/
+func (backend *awsKMSBackend) Generate(alg string, audience string) (string, crypto.PublicKey, error) {
+	keySpec := map[string]types.KeySpec{"RS256": types.KeySpecRsa2048, "ES256": types.KeySpecEccNistP256}[alg]
+	if keySpec == "" {
+		return "", nil, ErrUnsupportedAlg
+	}
+
+	/*
+		Tag values are limited to 256 characters, so longer audiences are only described by the name of the key
+	*/
+	tags := []types.Tag{{TagKey: aws.String("credstack:key"), TagValue: aws.String(keyName("", alg, audience))}}
+	if len(audience) <= 256 {
+		tags = append(tags, types.Tag{TagKey: aws.String("credstack:audience"), TagValue: aws.String(audience)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	resp, err := backend.client.CreateKey(ctx, &kms.CreateKeyInput{
+		KeySpec:     keySpec,
+		KeyUsage:    types.KeyUsageTypeSignVerify,
+		Description: aws.String("credstack " + alg + " signing key"),
+		Tags:        tags,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	arn := aws.ToString(resp.KeyMetadata.Arn)
+
+	public, err := backend.PublicKey(arn, alg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return arn, public, nil
+}
+
+/*
+PublicKey - Fetches the public key of the KMS key with the ARN provided in the parameter
+*/
+func (backend *awsKMSBackend) PublicKey(reference string, alg string) (crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	resp, err := backend.client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(reference)})
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	return parsePublicKey(resp.PublicKey, alg)
+}
+
+/*
+Sign - Signs the digest with the KMS key with the ARN provided in the parameter. KMS returns ECDSA signatures DER encoded,
+so they are converted to the concatenated R and S
+*/
+func (backend *awsKMSBackend) Sign(reference string, alg string, digest []byte) ([]byte, error) {
+	signingAlgorithm := map[string]types.SigningAlgorithmSpec{
+		"RS256": types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+		"ES256": types.SigningAlgorithmSpecEcdsaSha256,
+	}[alg]
+	if signingAlgorithm == "" {
+		return nil, ErrUnsupportedAlg
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	resp, err := backend.client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(reference),
+		Message:          digest,
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: signingAlgorithm,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	if alg == "ES256" {
+		return jwsECDSA(resp.Signature)
+	}
+
+	return resp.Signature, nil
+}
+
+/*
+Destroy - Schedules the KMS key for deletion after AWSKMSSignerConfig.PendingWindowDays. A key that was already scheduled
+for deletion, or deleted, is not an error
+*/
+func (backend *awsKMSBackend) Destroy(reference string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	_, err := backend.client.ScheduleKeyDeletion(ctx, &kms.ScheduleKeyDeletionInput{
+		KeyId:               aws.String(reference),
+		PendingWindowInDays: aws.Int32(int32(backend.config.PendingWindowDays)),
+	})
+
+	var invalidState *types.KMSInvalidStateException
+	var notFound *types.NotFoundException
+
+	if errors.As(err, &invalidState) || errors.As(err, &notFound) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package signer
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// gcpGenerationTimeout - How long a new crypto key version is waited for, as Cloud KMS generates asymmetric keys in the background
+const gcpGenerationTimeout = time.Minute
+
+/*
+gcpKMSBackend - Signs with Google Cloud KMS. Every algorithm and audience has its own crypto key in the key ring, and
+every signing key generated for them is a version of it, so references are the resource name of the crypto key version.
+Retired versions are destroyed
+*/
+type gcpKMSBackend struct {
+	// config - The options of the backend
+	config config.GCPKMSSignerConfig
+
+	// client - The client every request to Cloud KMS is sent with
+	client *kms.KeyManagementClient
+
+	// timeout - How long every request to Cloud KMS, including its retries, is waited for
+	timeout time.Duration
+}
+
+/*
+newGCPKMSBackend - Constructs the Backend for Google Cloud KMS. If a credentials file is configured, such as the JSON key
+of a service account, then it is read here. Otherwise, the application default credentials are used
+(GOOGLE_APPLICATION_CREDENTIALS, the credentials of the gcloud CLI, workload identity federation, or the service account
+of the instance through the metadata server). Either way, credentials that cannot be found are surfaced when the server
+starts
+*/
+func newGCPKMSBackend(signerConfig config.SignerConfig, _ clock.Clock) (Backend, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signerConfig.Timeout)
+	defer cancel()
+
+	var credentials *google.Credentials
+
+	if signerConfig.GCPKMS.CredentialsFile != "" {
+		contents, err := os.ReadFile(signerConfig.GCPKMS.CredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", config.ErrInvalidSignerConfig, err)
+		}
+
+		credentials, err = google.CredentialsFromJSON(ctx, contents, kms.DefaultAuthScopes()...)
+		if err != nil {
+			return nil, fmt.Errorf("%w (credentials_file is not a valid credentials file: %v)", config.ErrInvalidSignerConfig, err)
+		}
+	} else {
+		found, err := google.FindDefaultCredentials(ctx, kms.DefaultAuthScopes()...)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", config.ErrInvalidSignerConfig, err)
+		}
+
+		credentials = found
+	}
+
+	/*
+		The gRPC client is used, as it returns the exact status of every error, which the backend relies on to tell a
+		crypto key that already exists, or a version that is already destroyed, apart from other failures. The client is
+		constructed with the background context, as its credentials keep the context for the lifetime of the client
+	*/
+	client, err := kms.NewKeyManagementClient(
+		context.Background(),
+		option.WithCredentials(credentials),
+		option.WithEndpoint(gcpEndpoint(signerConfig.GCPKMS.Endpoint)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", config.ErrInvalidSignerConfig, err)
+	}
+
+	return &gcpKMSBackend{
+		config:  signerConfig.GCPKMS,
+		client:  client,
+		timeout: signerConfig.Timeout,
+	}, nil
+}
+
+/*
+gcpEndpoint - Returns the address the gRPC client dials for the endpoint provided in the parameter. Endpoints are
+configured as URLs (https://cloudkms.googleapis.com), so the host is used, on port 443 unless the URL includes one
+*/
+func gcpEndpoint(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return endpoint
+	}
+
+	if parsed.Port() == "" {
+		return parsed.Host + ":443"
+	}
+
+	return parsed.Host
+}
+
+func (backend *gcpKMSBackend) Name() string {
+	return "gcp_kms"
+}
+
+/*
+Generate - Creates the crypto key of the algorithm and audience if it does not exist yet, which creates its first
+version, and adds a new version to it otherwise. Versions are generated in the background, so this waits until the new
+version is enabled
+*/
+func (backend *gcpKMSBackend) Generate(alg string, audience string) (string, crypto.PublicKey, error) {
+	algorithm := map[string]kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm{
+		"RS256": kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256,
+		"ES256": kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+	}[alg]
+	if algorithm == kmspb.CryptoKeyVersion_CRYPTO_KEY_VERSION_ALGORITHM_UNSPECIFIED {
+		return "", nil, ErrUnsupportedAlg
+	}
+
+	id := keyName(backend.config.KeyPrefix, alg, audience)
+	keyRing := strings.Trim(backend.config.KeyRing, "/")
+	key := keyRing + "/cryptoKeys/" + id
+
+	ctx, cancel := context.WithTimeout(context.Background(), gcpGenerationTimeout)
+	defer cancel()
+
+	var version *kmspb.CryptoKeyVersion
+
+	created, err := backend.client.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+		Parent:      keyRing,
+		CryptoKeyId: id,
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose:         kmspb.CryptoKey_ASYMMETRIC_SIGN,
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{Algorithm: algorithm},
+			Labels:          map[string]string{"managed-by": "credstack"},
+		},
+	})
+
+	switch {
+	case err == nil:
+		version = &kmspb.CryptoKeyVersion{Name: created.Name + "/cryptoKeyVersions/1"}
+	case status.Code(err) == codes.AlreadyExists:
+		version, err = backend.client.CreateCryptoKeyVersion(ctx, &kmspb.CreateCryptoKeyVersionRequest{
+			Parent:           key,
+			CryptoKeyVersion: &kmspb.CryptoKeyVersion{},
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+		}
+	default:
+		return "", nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	for version.State != kmspb.CryptoKeyVersion_ENABLED {
+		select {
+		case <-ctx.Done():
+			return "", nil, fmt.Errorf("%w (%s was not generated in time)", ErrBackendRequest, version.Name)
+		case <-time.After(time.Second):
+		}
+
+		version, err = backend.client.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: version.Name})
+		if err != nil {
+			return "", nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+		}
+	}
+
+	public, err := backend.PublicKey(version.Name, alg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return version.Name, public, nil
+}
+
+/*
+PublicKey - Fetches the public key of the crypto key version with the resource name provided in the parameter
+*/
+func (backend *gcpKMSBackend) PublicKey(reference string, alg string) (crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	resp, err := backend.client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: reference})
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	return parsePublicKey([]byte(resp.Pem), alg)
+}
+
+/*
+Sign - Signs the digest with the crypto key version with the resource name provided in the parameter. Cloud KMS returns
+ECDSA signatures DER encoded, so they are converted to the concatenated R and S
+*/
+func (backend *gcpKMSBackend) Sign(reference string, alg string, digest []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	resp, err := backend.client.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+		Name:   reference,
+		Digest: &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	if alg == "ES256" {
+		return jwsECDSA(resp.Signature)
+	}
+
+	return resp.Signature, nil
+}
+
+/*
+Destroy - Schedules the crypto key version for destruction. Cloud KMS keeps it for the destroy scheduled duration of the
+crypto key (30 days by default) before the key material is destroyed. A version that is already scheduled for
+destruction, or destroyed, is not an error
+*/
+func (backend *gcpKMSBackend) Destroy(reference string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), backend.timeout)
+	defer cancel()
+
+	_, err := backend.client.DestroyCryptoKeyVersion(ctx, &kmspb.DestroyCryptoKeyVersionRequest{Name: reference})
+	if err != nil && status.Code(err) != codes.FailedPrecondition {
+		return fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	return nil
+}
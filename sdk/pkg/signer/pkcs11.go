@@ -0,0 +1,409 @@
+//go:build cgo
+
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/miekg/pkcs11"
+)
+
+var (
+	// pkcs11P256 - The DER encoded OID of the P-256 curve, which is how PKCS#11 identifies the curve of an EC key
+	pkcs11P256 = []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+
+	// pkcs11SHA256Prefix - The DER encoded DigestInfo of a SHA-256 digest, without the digest. CKM_RSA_PKCS signs its input as is, so the digest is wrapped in it first
+	pkcs11SHA256Prefix = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+)
+
+/*
+pkcs11Backend - Signs with an HSM through its PKCS#11 module. A key pair is generated on the token for every signing key,
+identified by a random CKA_ID, so references are the hex encoded CKA_ID. The private key is generated as sensitive and
+not extractable, so it never leaves the HSM. Retired key pairs are destroyed
+*/
+type pkcs11Backend struct {
+	// config - The options of the backend
+	config config.PKCS11SignerConfig
+
+	// ctx - The loaded PKCS#11 module
+	ctx *pkcs11.Ctx
+
+	// mu - Protects session. A PKCS#11 session can only be used by one caller at a time, so every operation holds this
+	mu sync.Mutex
+
+	// session - The logged in session every operation is performed in
+	session pkcs11.SessionHandle
+}
+
+/*
+newPKCS11Backend - Constructs the Backend for PKCS#11. The module is loaded, and a session is logged in to the token, here,
+so that a wrong module path, slot or PIN is surfaced when the server starts
+*/
+func newPKCS11Backend(signerConfig config.SignerConfig, _ clock.Clock) (Backend, error) {
+	ctx := pkcs11.New(signerConfig.PKCS11.ModulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("%w (failed to load the pkcs11 module %s)", config.ErrInvalidSignerConfig, signerConfig.PKCS11.ModulePath)
+	}
+
+	err := ctx.Initialize()
+	if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	backend := &pkcs11Backend{
+		config: signerConfig.PKCS11,
+		ctx:    ctx,
+	}
+
+	err = backend.openSession()
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, err
+	}
+
+	return backend, nil
+}
+
+func (backend *pkcs11Backend) Name() string {
+	return "pkcs11"
+}
+
+/*
+openSession - Opens a read/write session with the token in the configured slot, and logs in to it as the user
+*/
+func (backend *pkcs11Backend) openSession() error {
+	session, err := backend.ctx.OpenSession(backend.config.Slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	err = backend.ctx.Login(session, pkcs11.CKU_USER, backend.config.Pin)
+	if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+		backend.ctx.CloseSession(session)
+		return fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	backend.session = session
+
+	return nil
+}
+
+/*
+do - Calls fn with the session, holding mu for the duration of the call. If the session was closed by the HSM, for
+instance because it was restarted, then a new session is opened and fn is called once more
+*/
+func (backend *pkcs11Backend) do(fn func(session pkcs11.SessionHandle) error) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	err := fn(backend.session)
+	if !errors.Is(err, pkcs11.Error(pkcs11.CKR_SESSION_HANDLE_INVALID)) &&
+		!errors.Is(err, pkcs11.Error(pkcs11.CKR_SESSION_CLOSED)) &&
+		!errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_NOT_LOGGED_IN)) {
+		return err
+	}
+
+	backend.ctx.CloseSession(backend.session)
+
+	err = backend.openSession()
+	if err != nil {
+		return err
+	}
+
+	return fn(backend.session)
+}
+
+/*
+findObject - Returns the handle of the object of the class provided in the parameter with the CKA_ID. If there is none,
+then errNotFound is returned
+*/
+func (backend *pkcs11Backend) findObject(session pkcs11.SessionHandle, class uint, id []byte) (pkcs11.ObjectHandle, error) {
+	err := backend.ctx.FindObjectsInit(session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	handles, _, err := backend.ctx.FindObjects(session, 1)
+
+	finalErr := backend.ctx.FindObjectsFinal(session)
+	if err == nil {
+		err = finalErr
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(handles) == 0 {
+		return 0, errNotFound
+	}
+
+	return handles[0], nil
+}
+
+/*
+Generate - Generates a new key pair on the token, labeled with the name of the algorithm and audience it signs tokens for
+*/
+func (backend *pkcs11Backend) Generate(alg string, audience string) (string, crypto.PublicKey, error) {
+	var mechanism uint
+	var public []*pkcs11.Attribute
+
+	switch alg {
+	case "RS256":
+		mechanism = pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN
+		public = []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA),
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, 2048),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{0x01, 0x00, 0x01}),
+		}
+	case "ES256":
+		mechanism = pkcs11.CKM_EC_KEY_PAIR_GEN
+		public = []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, pkcs11P256),
+		}
+	default:
+		return "", nil, ErrUnsupportedAlg
+	}
+
+	id := make([]byte, 16)
+
+	_, err := io.ReadFull(secret.RandReader(), id)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	label := keyName(backend.config.KeyPrefix, alg, audience)
+
+	public = append(public,
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PUBLIC_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	)
+
+	private := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	}
+
+	err = backend.do(func(session pkcs11.SessionHandle) error {
+		_, _, err := backend.ctx.GenerateKeyPair(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, public, private)
+		return err
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	reference := hex.EncodeToString(id)
+
+	publicKey, err := backend.PublicKey(reference, alg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return reference, publicKey, nil
+}
+
+/*
+PublicKey - Reads the public key of the key pair with the hex encoded CKA_ID provided in the parameter from the token
+*/
+func (backend *pkcs11Backend) PublicKey(reference string, alg string) (crypto.PublicKey, error) {
+	id, err := hex.DecodeString(reference)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrInvalidPublicKey, err)
+	}
+
+	var template []*pkcs11.Attribute
+
+	switch alg {
+	case "RS256":
+		template = []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		}
+	case "ES256":
+		template = []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		}
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+
+	var attributes []*pkcs11.Attribute
+
+	err = backend.do(func(session pkcs11.SessionHandle) error {
+		handle, err := backend.findObject(session, pkcs11.CKO_PUBLIC_KEY, id)
+		if err != nil {
+			return err
+		}
+
+		attributes, err = backend.ctx.GetAttributeValue(session, handle, template)
+
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	if alg == "RS256" {
+		exponent := new(big.Int).SetBytes(attributes[1].Value)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w (public exponent is too large)", ErrInvalidPublicKey)
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(attributes[0].Value), E: int(exponent.Int64())}, nil
+	}
+
+	return pkcs11ECPublicKey(attributes[0].Value, attributes[1].Value)
+}
+
+/*
+pkcs11ECPublicKey - Converts the CKA_EC_PARAMS and CKA_EC_POINT of an EC public key into an ecdsa.PublicKey. PKCS#11
+requires the point to be wrapped in a DER OCTET STRING, however some modules return it unwrapped, so both are accepted
+*/
+func pkcs11ECPublicKey(params []byte, point []byte) (crypto.PublicKey, error) {
+	if string(params) != string(pkcs11P256) {
+		return nil, fmt.Errorf("%w (key is not on the P-256 curve)", ErrInvalidPublicKey)
+	}
+
+	var unwrapped []byte
+
+	rest, err := asn1.Unmarshal(point, &unwrapped)
+	if err == nil && len(rest) == 0 {
+		point = unwrapped
+	}
+
+	/*
+		crypto/ecdh validates that the point is on the curve, without relying on the deprecated elliptic.Curve.IsOnCurve
+	*/
+	_, err = ecdh.P256().NewPublicKey(point)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrInvalidPublicKey, err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(point[1:33]),
+		Y:     new(big.Int).SetBytes(point[33:]),
+	}, nil
+}
+
+/*
+Sign - Signs the digest with the private key of the key pair with the hex encoded CKA_ID provided in the parameter.
+CKM_ECDSA already returns the concatenated R and S, so only RSA signatures need the digest to be prepared
+*/
+func (backend *pkcs11Backend) Sign(reference string, alg string, digest []byte) ([]byte, error) {
+	id, err := hex.DecodeString(reference)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	var mechanism uint
+	var message []byte
+
+	switch alg {
+	case "RS256":
+		mechanism = pkcs11.CKM_RSA_PKCS
+		message = append(append([]byte{}, pkcs11SHA256Prefix...), digest...)
+	case "ES256":
+		mechanism = pkcs11.CKM_ECDSA
+		message = digest
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+
+	var sig []byte
+
+	err = backend.do(func(session pkcs11.SessionHandle) error {
+		handle, err := backend.findObject(session, pkcs11.CKO_PRIVATE_KEY, id)
+		if err != nil {
+			return err
+		}
+
+		err = backend.ctx.SignInit(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, handle)
+		if err != nil {
+			return err
+		}
+
+		sig, err = backend.ctx.Sign(session, message)
+
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	return sig, nil
+}
+
+/*
+Destroy - Destroys both halves of the key pair with the hex encoded CKA_ID provided in the parameter. A half that was
+already destroyed is not an error
+*/
+func (backend *pkcs11Backend) Destroy(reference string) error {
+	id, err := hex.DecodeString(reference)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	err = backend.do(func(session pkcs11.SessionHandle) error {
+		for _, class := range []uint{pkcs11.CKO_PRIVATE_KEY, pkcs11.CKO_PUBLIC_KEY} {
+			handle, err := backend.findObject(session, class, id)
+			if errors.Is(err, errNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			err = backend.ctx.DestroyObject(session, handle)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	return nil
+}
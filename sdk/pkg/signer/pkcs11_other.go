@@ -0,0 +1,17 @@
+//go:build !cgo
+
+package signer
+
+import (
+	"fmt"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+newPKCS11Backend - PKCS#11 modules are loaded with cgo, so the pkcs11 backend cannot be used in builds without it
+*/
+func newPKCS11Backend(signerConfig config.SignerConfig, _ clock.Clock) (Backend, error) {
+	return nil, fmt.Errorf("%w (pkcs11 requires credstack to be built with cgo enabled)", config.ErrInvalidSignerConfig)
+}
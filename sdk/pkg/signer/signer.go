@@ -0,0 +1,243 @@
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrUnknownBackend - An error that gets returned when the configured signing backend has not been registered
+var ErrUnknownBackend = credstackError.NewError(500, "ERR_UNKNOWN_SIGNER_BACKEND", "signer: The requested signing backend does not exist")
+
+// ErrUnsupportedAlg - An error that gets returned when a key is requested for an algorithm other than RS256 and ES256
+var ErrUnsupportedAlg = credstackError.NewError(400, "ERR_UNSUPPORTED_SIGNER_ALG", "signer: Only RS256 and ES256 keys can be generated in a signing backend")
+
+// ErrBackendRequest - An error that gets wrapped when a request to the signing backend fails, or it responds with an error
+var ErrBackendRequest = credstackError.NewError(502, "ERR_SIGNER_REQUEST_FAILED", "signer: The signing backend failed to complete the request")
+
+// ErrInvalidPublicKey - An error that gets returned when the signing backend returns a public key that cannot be parsed, or that does not match the algorithm of the key
+var ErrInvalidPublicKey = credstackError.NewError(502, "ERR_SIGNER_INVALID_PUBLIC_KEY", "signer: The signing backend returned an invalid public key")
+
+// errNotFound - Wraps ErrBackendRequest when the backend responds with 404, so that a key that does not exist yet can be told apart from other failures
+var errNotFound = fmt.Errorf("%w (not found)", ErrBackendRequest)
+
+// errConflict - Wraps ErrBackendRequest when the backend responds with 409, so that a key that already exists can be told apart from other failures
+var errConflict = fmt.Errorf("%w (conflict)", ErrBackendRequest)
+
+/*
+Backend - Interface that all external signing backends must implement. Keys are identified by a reference that the
+backend returns when they are generated, which is stored in place of their key material. Backends are shared across the
+entire server, so implementations must be safe for concurrent use
+*/
+type Backend interface {
+	// Name - Returns the name the backend is registered under, which is stored with every key generated in it
+	Name() string
+
+	// Generate - Generates a new key for the algorithm (RS256 or ES256) and audience in the backend, and returns its reference along with its public key
+	Generate(alg string, audience string) (string, crypto.PublicKey, error)
+
+	// PublicKey - Fetches the public key of the key with the reference provided in the parameter, and ensures that it can be used for the algorithm
+	PublicKey(reference string, alg string) (crypto.PublicKey, error)
+
+	// Sign - Signs a SHA-256 digest with the key, and returns the signature as it is encoded in a JWS: PKCS #1 v1.5 for RS256, and the concatenated R and S for ES256
+	Sign(reference string, alg string, digest []byte) ([]byte, error)
+
+	// Destroy - Deletes the key, or schedules it for deletion, once it is retired. Backends that cannot delete a single key leave it in place
+	Destroy(reference string) error
+}
+
+/*
+Factory - A function that constructs a Backend from the signer configuration, and the clock of the server for backends
+that sign their requests or cache credentials. Backends register a Factory with Register so that they can be selected
+using SignerConfig.Backend
+*/
+type Factory func(config config.SignerConfig, c clock.Clock) (Backend, error)
+
+var (
+	// registryLock - Protects the backends map
+	registryLock sync.RWMutex
+
+	// backends - All registered signing backends keyed by their name
+	backends = map[string]Factory{
+		config.SignerBackendVault:  newVaultBackend,
+		config.SignerBackendAWSKMS: newAWSKMSBackend,
+		config.SignerBackendGCPKMS: newGCPKMSBackend,
+		config.SignerBackendPKCS11: newPKCS11Backend,
+	}
+)
+
+/*
+Register - Registers a new signing backend under the provided name. If a backend already exists under this name, then it
+is overwritten. This should be called before the server is started, usually from an init function
+*/
+func Register(name string, factory Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	backends[name] = factory
+}
+
+/*
+New - Constructs the Backend defined in the config. The local backend is not a Backend, as keys are generated and stored
+by credstack itself, so nil is returned for it. If the backend has not been registered, then ErrUnknownBackend is
+returned
+*/
+func New(config config.SignerConfig, c clock.Clock) (Backend, error) {
+	if config.Backend == "local" {
+		return nil, nil
+	}
+
+	registryLock.RLock()
+	factory, ok := backends[config.Backend]
+	registryLock.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownBackend
+	}
+
+	return factory(config, c)
+}
+
+/*
+keyName - Returns the name of the key generated in a backend for the algorithm and audience provided in the parameter.
+Audiences are usually URLs, which backends do not allow in key names, so the audience is hashed
+*/
+func keyName(prefix string, alg string, audience string) string {
+	sum := sha256.Sum256([]byte(audience))
+	return prefix + strings.ToLower(alg) + "-" + hex.EncodeToString(sum[:8])
+}
+
+/*
+parsePublicKey - Parses a PKIX public key, either PEM or DER encoded, and ensures that it can be used for the algorithm
+provided in the parameter. If it cannot, then ErrInvalidPublicKey is returned
+*/
+func parsePublicKey(encoded []byte, alg string) (crypto.PublicKey, error) {
+	if block, _ := pem.Decode(encoded); block != nil {
+		encoded = block.Bytes
+	}
+
+	public, err := x509.ParsePKIXPublicKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrInvalidPublicKey, err)
+	}
+
+	switch typed := public.(type) {
+	case *rsa.PublicKey:
+		if alg == "RS256" {
+			return typed, nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == "ES256" && typed.Curve.Params().Name == "P-256" {
+			return typed, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w (the key cannot be used for %s)", ErrInvalidPublicKey, alg)
+}
+
+/*
+jwsECDSA - Converts an ASN.1 DER encoded ECDSA signature, which is what KMS backends return, to the concatenated R and S
+that a JWS holds (RFC 7518 section 3.4)
+*/
+func jwsECDSA(der []byte) ([]byte, error) {
+	var sig struct {
+		R *big.Int
+		S *big.Int
+	}
+
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w (malformed ECDSA signature)", ErrBackendRequest)
+	}
+
+	ret := make([]byte, 64)
+	sig.R.FillBytes(ret[:32])
+	sig.S.FillBytes(ret[32:])
+
+	return ret, nil
+}
+
+/*
+doJSON - Sends a request with the JSON body provided in the parameter, and decodes the JSON response into ret. If the
+backend responds with a status other than 2xx, then ErrBackendRequest is returned wrapped with the status and the body of
+the response, as backends describe what went wrong there. Responses with 404 and 409 are returned as errNotFound and
+errConflict. A nil ret discards the response
+*/
+func doJSON(client *http.Client, req *http.Request, ret any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w (%s)", errNotFound, strings.TrimSpace(string(body)))
+	case resp.StatusCode == http.StatusConflict:
+		return fmt.Errorf("%w (%s)", errConflict, strings.TrimSpace(string(body)))
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("%w (%s: %s)", ErrBackendRequest, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if ret == nil || len(body) == 0 {
+		return nil
+	}
+
+	err = json.Unmarshal(body, ret)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	return nil
+}
+
+/*
+newJSONRequest - Builds a request with the value provided in the parameter encoded as its JSON body. A nil value sends no
+body
+*/
+func newJSONRequest(method string, url string, value any) (*http.Request, error) {
+	var body []byte
+
+	if value != nil {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		body = encoded
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	if value != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
@@ -0,0 +1,265 @@
+package signer
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/clock"
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+/*
+vaultBackend - Signs with the transit secrets engine of HashiCorp Vault. Every algorithm and audience has its own transit
+key, and every signing key generated for them is a version of it, so references are the name of the transit key and the
+version, separated by a colon. Versions cannot be deleted on their own, so retired keys are left in place
+*/
+type vaultBackend struct {
+	// config - The options of the backend
+	config config.VaultSignerConfig
+
+	// client - The client every request to Vault is sent with
+	client *http.Client
+}
+
+/*
+newVaultBackend - Constructs the Backend for Vault. Nothing is sent to Vault until the first key is generated
+*/
+func newVaultBackend(config config.SignerConfig, _ clock.Clock) (Backend, error) {
+	return &vaultBackend{
+		config: config.Vault,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+func (backend *vaultBackend) Name() string {
+	return "vault"
+}
+
+/*
+vaultKey - The parts of a transit key that are read by the backend
+*/
+type vaultKey struct {
+	Data struct {
+		// LatestVersion - The version of the key that was created last
+		LatestVersion int `json:"latest_version"`
+
+		// Keys - The public keys of every version of the key, keyed by their version
+		Keys map[string]struct {
+			PublicKey string `json:"public_key"`
+		} `json:"keys"`
+	} `json:"data"`
+}
+
+/*
+request - Builds a request to the path provided in the parameter, relative to the mount path of the transit secrets engine
+*/
+func (backend *vaultBackend) request(method string, path string, value any) (*http.Request, error) {
+	req, err := newJSONRequest(
+		method,
+		strings.TrimSuffix(backend.config.Address, "/")+"/v1/"+strings.Trim(backend.config.MountPath, "/")+"/"+path,
+		value,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Vault-Token", backend.config.Token)
+
+	if backend.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", backend.config.Namespace)
+	}
+
+	return req, nil
+}
+
+/*
+readKey - Reads the transit key with the name provided in the parameter
+*/
+func (backend *vaultBackend) readKey(name string) (*vaultKey, error) {
+	req, err := backend.request(http.MethodGet, "keys/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret vaultKey
+
+	err = doJSON(backend.client, req, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+/*
+Generate - Creates the transit key of the algorithm and audience if it does not exist yet, and rotates it otherwise, so
+that the latest version is a key that was never used to sign before. The version is read back after rotating, so if the
+same transit key is rotated twice at the same time, then both calls may return the later version
+*/
+func (backend *vaultBackend) Generate(alg string, audience string) (string, crypto.PublicKey, error) {
+	keyType := map[string]string{"RS256": "rsa-2048", "ES256": "ecdsa-p256"}[alg]
+	if keyType == "" {
+		return "", nil, ErrUnsupportedAlg
+	}
+
+	name := keyName(backend.config.KeyPrefix, alg, audience)
+
+	path := "keys/" + url.PathEscape(name) + "/rotate"
+	var body any
+
+	_, err := backend.readKey(name)
+	if err != nil {
+		if !errors.Is(err, errNotFound) {
+			return "", nil, err
+		}
+
+		path = "keys/" + url.PathEscape(name)
+		body = map[string]any{"type": keyType, "exportable": false}
+	}
+
+	req, err := backend.request(http.MethodPost, path, body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = doJSON(backend.client, req, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, err := backend.readKey(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	reference := name + ":" + strconv.Itoa(key.Data.LatestVersion)
+
+	public, err := backend.publicKey(key, reference, alg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return reference, public, nil
+}
+
+/*
+PublicKey - Fetches the public key of the version of the transit key that the reference provided in the parameter
+points to
+*/
+func (backend *vaultBackend) PublicKey(reference string, alg string) (crypto.PublicKey, error) {
+	name, _, err := splitVaultReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := backend.readKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.publicKey(key, reference, alg)
+}
+
+/*
+publicKey - Returns the public key of the version that the reference provided in the parameter points to, from a transit
+key that was already read
+*/
+func (backend *vaultBackend) publicKey(key *vaultKey, reference string, alg string) (crypto.PublicKey, error) {
+	_, version, err := splitVaultReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	found, ok := key.Data.Keys[version]
+	if !ok || found.PublicKey == "" {
+		return nil, fmt.Errorf("%w (version %s of the transit key has no public key)", ErrInvalidPublicKey, version)
+	}
+
+	return parsePublicKey([]byte(found.PublicKey), alg)
+}
+
+/*
+Sign - Signs the digest with the version of the transit key that the reference provided in the parameter points to.
+ECDSA signatures are requested with the jws marshaling algorithm, so that Vault returns them as the concatenated R and S
+encoded with base64url, where RSA signatures are always returned encoded with standard base64
+*/
+func (backend *vaultBackend) Sign(reference string, alg string, digest []byte) ([]byte, error) {
+	name, version, err := splitVaultReference(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	keyVersion, _ := strconv.Atoi(version)
+
+	body := map[string]any{
+		"input":                base64.StdEncoding.EncodeToString(digest),
+		"prehashed":            true,
+		"key_version":          keyVersion,
+		"marshaling_algorithm": "jws",
+	}
+
+	if alg == "RS256" {
+		body["signature_algorithm"] = "pkcs1v15"
+	}
+
+	req, err := backend.request(http.MethodPost, "sign/"+url.PathEscape(name)+"/sha2-256", body)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+
+	err = doJSON(backend.client, req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		Signatures are prefixed with vault:v<version>: which is not part of the signature itself
+	*/
+	parts := strings.Split(resp.Data.Signature, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w (malformed signature)", ErrBackendRequest)
+	}
+
+	decode := base64.RawStdEncoding.DecodeString
+	if alg == "ES256" {
+		decode = base64.RawURLEncoding.DecodeString
+	}
+
+	sig, err := decode(strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrBackendRequest, err)
+	}
+
+	return sig, nil
+}
+
+/*
+Destroy - Leaves the version in place, as the transit secrets engine can only trim every version older than a given one
+*/
+func (backend *vaultBackend) Destroy(reference string) error {
+	return nil
+}
+
+/*
+splitVaultReference - Splits a reference into the name of the transit key and its version
+*/
+func splitVaultReference(reference string) (string, string, error) {
+	index := strings.LastIndexByte(reference, ':')
+	if index == -1 {
+		return "", "", fmt.Errorf("%w (malformed key reference %q)", ErrBackendRequest, reference)
+	}
+
+	return reference[:index], reference[index+1:], nil
+}
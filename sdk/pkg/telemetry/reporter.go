@@ -0,0 +1,67 @@
+package telemetry
+
+import (
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/server"
+)
+
+/*
+Reporter - Sends a report once every TelemetryConfig.Interval in the background. A report that fails to send is only
+logged, as telemetry must never affect serving requests
+*/
+type Reporter struct {
+	// serv - The server reports are built from
+	serv *server.Server
+
+	// stop - Closed to stop the background goroutine
+	stop chan struct{}
+
+	// done - Closed once the background goroutine has returned
+	done chan struct{}
+}
+
+/*
+Start - Starts the background goroutine. The first report is sent once the first interval has elapsed, so that a
+short-lived process never reports
+*/
+func (reporter *Reporter) Start() {
+	go func() {
+		defer close(reporter.done)
+
+		ticker := time.NewTicker(reporter.serv.Config.TelemetryConfig.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-reporter.stop:
+				return
+			case <-ticker.C:
+				err := Send(reporter.serv)
+				if err != nil {
+					reporter.serv.Log().LogErrorEvent("Failed to send telemetry report", err)
+				}
+			}
+		}
+	}()
+}
+
+/*
+Stop - Stops the background goroutine and waits for it to return. A report that is being sent is allowed to finish
+*/
+func (reporter *Reporter) Stop() {
+	close(reporter.stop)
+	<-reporter.done
+}
+
+/*
+NewReporter - Constructs a Reporter for the server provided in the parameter. Calling this function does not start
+reporting, this needs to be done post-construction with Reporter.Start
+*/
+func NewReporter(serv *server.Server) *Reporter {
+	return &Reporter{
+		serv: serv,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
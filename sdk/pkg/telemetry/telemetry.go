@@ -0,0 +1,239 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/header"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	// grants - The number of tokens issued by each grant type since the last report. Keyed by grant type
+	grants sync.Map
+
+	// instanceId - A random identifier for this process, generated when it starts. Used to count the instances of a deployment
+	instanceId = newIdentifier()
+)
+
+/*
+Report - The document sent to the telemetry endpoint. It only ever holds anonymous aggregates: no issuer, hostname,
+address, client, user, or token is included. The identifiers are random, and only tie reports from the same deployment
+and process together
+*/
+type Report struct {
+	// DeploymentId - A random identifier shared by every instance connected to the same database. Generated the first time a report is built
+	DeploymentId string `json:"deployment_id"`
+
+	// InstanceId - A random identifier for the process that built the report. Changes every time the process starts
+	InstanceId string `json:"instance_id"`
+
+	// Version - The version of credstack the process was built from
+	Version string `json:"version"`
+
+	// GoVersion - The version of Go the process was built with
+	GoVersion string `json:"go_version"`
+
+	// Platform - The operating system and architecture of the process (linux/amd64)
+	Platform string `json:"platform"`
+
+	// Instances - The number of instances of the deployment that built a report within the last two intervals
+	Instances int64 `json:"instances"`
+
+	// GrantTypes - The number of tokens this instance issued by each grant type since its last report
+	GrantTypes map[string]int64 `json:"grant_types"`
+
+	// Since - A unix timestamp representing when the grant types started being counted
+	Since int64 `json:"since"`
+}
+
+// since - A unix timestamp representing when the grant type counters were last reset. Zero until the first grant is counted or report is built
+var since atomic.Int64
+
+/*
+RecordGrant - Counts a token issued with the grant type provided in the parameter. This is always counted, whether
+telemetry is enabled or not, so that the preview shows what would be sent
+*/
+func RecordGrant(serv *server.Server, grantType string) {
+	since.CompareAndSwap(0, serv.Clock().Now().Unix())
+
+	counter, _ := grants.LoadOrStore(grantType, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(1)
+}
+
+/*
+Build - Builds the report that would be sent for this instance, without sending it or resetting the grant type counters.
+This is what the management API returns as a preview. The deployment identifier is created in the database if it does
+not exist yet
+*/
+func Build(serv *server.Server) (*Report, error) {
+	return build(serv, false)
+}
+
+/*
+Send - Builds the report for this instance, sends it to TelemetryConfig.Endpoint, and resets the grant type counters
+once it has been accepted. Nothing is sent if telemetry is disabled
+*/
+func Send(serv *server.Server) error {
+	telemetryConfig := serv.Config.TelemetryConfig
+	if !telemetryConfig.Enabled {
+		return nil
+	}
+
+	report, err := build(serv, true)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, telemetryConfig.Endpoint, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	/*
+		The counters are only reset once the report has been accepted, so that the grants of a report that failed to
+		send are included in the next one
+	*/
+	for name, count := range report.GrantTypes {
+		if counter, ok := grants.Load(name); ok {
+			counter.(*atomic.Int64).Add(-count)
+		}
+	}
+
+	since.Store(serv.Clock().Now().Unix())
+
+	return nil
+}
+
+/*
+build - Provides the shared logic for Build and Send. If heartbeat is set, then this instance is recorded as active for
+the next two intervals, so that it is included in the instance count of every report built in that time
+*/
+func build(serv *server.Server, heartbeat bool) (*Report, error) {
+	deploymentId, err := deployment(serv)
+	if err != nil {
+		return nil, err
+	}
+
+	now := serv.Clock().Now()
+	since.CompareAndSwap(0, now.Unix())
+
+	if heartbeat {
+		_, err = serv.Database().Collection("telemetry_instance").UpdateOne(
+			context.Background(),
+			bson.M{"instance_id": instanceId},
+			bson.M{"$set": bson.M{"instance_id": instanceId, "expires_at": now.Add(2 * serv.Config.TelemetryConfig.Interval)}},
+			mongoOpts.UpdateOne().SetUpsert(true),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+		}
+	}
+
+	instances, err := serv.Database().Collection("telemetry_instance").CountDocuments(
+		context.Background(),
+		bson.M{"expires_at": bson.M{"$gt": now}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	ret := &Report{
+		DeploymentId: deploymentId,
+		InstanceId:   instanceId,
+		Version:      version(),
+		GoVersion:    runtime.Version(),
+		Platform:     runtime.GOOS + "/" + runtime.GOARCH,
+		Instances:    max(instances, 1),
+		GrantTypes:   map[string]int64{},
+		Since:        since.Load(),
+	}
+
+	grants.Range(func(name, counter any) bool {
+		if count := counter.(*atomic.Int64).Load(); count != 0 {
+			ret.GrantTypes[name.(string)] = count
+		}
+
+		return true
+	})
+
+	return ret, nil
+}
+
+/*
+deployment - Returns the random identifier of the deployment, creating it if it does not exist. Concurrent instances
+always agree on the same identifier, as it is only ever set on insert
+*/
+func deployment(serv *server.Server) (string, error) {
+	var ret struct {
+		DeploymentId string `bson:"deployment_id"`
+	}
+
+	err := serv.Database().Collection("telemetry").FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": "deployment"},
+		bson.M{"$setOnInsert": bson.M{"deployment_id": newIdentifier()}},
+		mongoOpts.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(mongoOpts.After),
+	).Decode(&ret)
+	if err != nil {
+		return "", fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return ret.DeploymentId, nil
+}
+
+/*
+newIdentifier - Generates a random identifier. An empty identifier is returned if the system's random source fails, as
+telemetry must never prevent the server from running
+*/
+func newIdentifier() string {
+	generated, err := header.NewRandom()
+	if err != nil {
+		return ""
+	}
+
+	return generated.Identifier
+}
+
+/*
+version - Returns the version of the main module the process was built from, or (devel) if it was built from a working
+tree
+*/
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+
+	return info.Main.Version
+}
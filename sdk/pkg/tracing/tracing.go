@@ -0,0 +1,174 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName - The name of the tracer and meter that every credstack span and metric is recorded with
+const instrumentationName = "github.com/credstack/credstack"
+
+/*
+Provider - Exports the spans and metrics recorded by credstack. While a Provider is running, it is installed as the global
+tracer and meter provider, so spans started with Start and instruments created with Meter anywhere in the SDK are
+exported by it. When tracing is disabled no Provider is constructed, Start returns spans that are never recorded, and
+instruments are never collected
+*/
+type Provider struct {
+	// provider - The tracer provider that batches spans and exports them
+	provider *sdktrace.TracerProvider
+
+	// meterProvider - The meter provider that periodically collects metrics and exports them
+	meterProvider *sdkmetric.MeterProvider
+}
+
+/*
+Shutdown - Exports every span and metric that has not been exported yet, and stops the Provider. Spans started afterward
+are dropped. This should be called once the API has stopped serving requests, so that their spans are not lost
+*/
+func (provider *Provider) Shutdown(ctx context.Context) error {
+	return errors.Join(provider.provider.Shutdown(ctx), provider.meterProvider.Shutdown(ctx))
+}
+
+/*
+NewProvider - Constructs a Provider that exports spans and metrics with OTLP over HTTP to the endpoint in the TracingConfig
+provided in the parameter, and installs it as the global tracer and meter provider. The W3C trace context and baggage
+propagators are installed alongside it, so that incoming traceparent headers are continued with Extract. Spans are
+sampled with TracingConfig.SampleRatio, unless the caller has already made a sampling decision. Metrics are collected
+and exported every minute
+*/
+func NewProvider(tracingConfig config.TracingConfig) (*Provider, error) {
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(tracingConfig.Endpoint),
+		otlptracehttp.WithHeaders(tracingConfig.Headers),
+	}
+
+	if tracingConfig.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	/*
+		The exporter does not connect until the first batch is exported, so this never fails because the collector is
+		unavailable. Spans that fail to export are reported to the global error handler and dropped
+	*/
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	metricOptions := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(tracingConfig.Endpoint),
+		otlpmetrichttp.WithHeaders(tracingConfig.Headers),
+	}
+
+	if tracingConfig.Insecure {
+		metricOptions = append(metricOptions, otlpmetrichttp.WithInsecure())
+	}
+
+	metricExporter, err := otlpmetrichttp.New(context.Background(), metricOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(tracingConfig.ServiceName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(tracingConfig.SampleRatio))),
+	)
+
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetMeterProvider(meterProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return &Provider{provider: provider, meterProvider: meterProvider}, nil
+}
+
+/*
+Meter - Returns the meter that credstack's instruments are created with. Instruments can be created before a Provider is
+constructed, as the global meter provider forwards them to it once it is installed
+*/
+func Meter() metric.Meter {
+	return otel.Meter(instrumentationName)
+}
+
+/*
+Start - Starts a span with the name and attributes provided in the parameters, as a child of any span carried by the
+context. The returned context carries the new span, and should be passed to anything the span covers. The span must be
+ended with End
+*/
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+/*
+StartKind - Starts a span exactly like Start, with the span kind provided in the parameter. Spans for incoming requests
+are started with trace.SpanKindServer, and spans for calls to other services with trace.SpanKindClient
+*/
+func StartKind(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+/*
+End - Ends the span provided in the parameter. If the error provided in the parameter is not nil, then it is recorded
+on the span and the span is marked as failed
+*/
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+/*
+Extract - Returns a copy of the context provided in the parameter that continues the trace described by the carrier
+(the traceparent and tracestate headers of an incoming request). If the carrier describes no trace, or tracing is
+disabled, then the context is returned unchanged
+*/
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+/*
+Inject - Writes the trace carried by the context provided in the parameter into the carrier (the headers of an outgoing
+request), so that the service it is sent to can continue the trace
+*/
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+}
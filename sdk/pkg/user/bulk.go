@@ -0,0 +1,533 @@
+package user
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/events"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DefaultImportBatchSize - The number of users inserted at once when no batch size is provided
+const DefaultImportBatchSize = 500
+
+// ErrMalformedImportRecord - Provides a named error for when a single record of a bulk import cannot be decoded. The rest of the import continues
+var ErrMalformedImportRecord = credstackError.NewError(400, "IMPORT_RECORD_MALFORMED", "user: The import record could not be decoded")
+
+// ErrMalformedImport - Provides a named error for when a bulk import cannot be decoded any further, such as a JSON array with a syntax error
+var ErrMalformedImport = credstackError.NewError(400, "IMPORT_MALFORMED", "user: The import could not be decoded")
+
+/*
+ImportReader - Reads the records of a bulk import one at a time, so that imports never need to be held in memory. Next
+returns io.EOF once every record has been read. Errors wrapping ErrMalformedImportRecord only affect the record that was
+being read, and reading can continue past them. Any other error ends the import
+*/
+type ImportReader interface {
+	Next() (*request.UserImportRequest, error)
+}
+
+/*
+ImportResult - The outcome of a single record of a bulk import
+*/
+type ImportResult struct {
+	// Record - The position of the record in the import, starting from 1. CSV headers are not counted
+	Record int `json:"record"`
+
+	// Email - The email address of the record, if it could be decoded
+	Email string `json:"email,omitempty"`
+
+	// Identifier - The identifier of the imported user. Empty if the record failed, or the import was a dry run
+	Identifier string `json:"identifier,omitempty"`
+
+	// Code - The short code of the error the record failed with. Empty if the record was imported
+	Code string `json:"code,omitempty"`
+
+	// Error - Why the record failed. Empty if the record was imported
+	Error string `json:"error,omitempty"`
+}
+
+/*
+ImportSummary - The number of records a bulk import imported, and the number that failed
+*/
+type ImportSummary struct {
+	// Imported - The number of users that were imported. In a dry run, the number of users that would have been
+	Imported int64 `json:"imported"`
+
+	// Failed - The number of records that failed, each of which was reported with an ImportResult
+	Failed int64 `json:"failed"`
+}
+
+/*
+ImportOptions - Controls how BulkImport imports users
+*/
+type ImportOptions struct {
+	// DryRun - If set to true, every record is validated and checked against existing users, but nothing is written
+	DryRun bool
+
+	// BatchSize - The number of users inserted at once. Reset to DefaultImportBatchSize if zero or less
+	BatchSize int
+
+	// OnResult - Called with the result of every record, in the order they were read. If it returns an error, then the import stops and the error is returned. Optional
+	OnResult func(result ImportResult) error
+}
+
+/*
+importEntry - A record that has been read, along with the user it was converted to or the error it failed with
+*/
+type importEntry struct {
+	result  ImportResult
+	account *User
+	err     error
+}
+
+/*
+BulkImport - Imports every record read from the reader provided in the parameter. Each record is validated exactly like
+Import, and its result is passed to ImportOptions.OnResult as the import progresses: records that fail are reported and
+skipped without affecting the rest of the import. Valid records are inserted in batches with a single write per batch,
+so that tens of thousands of users can be migrated from another identity provider at once.
+
+Only a single batch of records is held in memory, along with the canonical email address of every record read so far, so
+that the same user appearing twice in one import is reported as ErrUserAlreadyExists. If the reader fails with anything
+other than ErrMalformedImportRecord, or a database call fails, then the import stops and the summary up to that point is
+returned along with the error. Users that were inserted before that point are kept
+*/
+func BulkImport(serv *server.Server, reader ImportReader, opts ImportOptions) (ImportSummary, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultImportBatchSize
+	}
+
+	var summary ImportSummary
+
+	seen := make(map[string]struct{})
+	batch := make([]*importEntry, 0, opts.BatchSize)
+
+	for record := 1; ; record++ {
+		imported, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil && !errors.Is(err, ErrMalformedImportRecord) {
+			return summary, err
+		}
+
+		entry := &importEntry{result: ImportResult{Record: record}, err: err}
+		if err == nil {
+			entry.result.Email = imported.Email
+			entry.account, entry.err = newImportedUser(serv, imported)
+		}
+
+		if entry.err == nil {
+			if _, ok := seen[entry.account.CanonicalEmail]; ok {
+				entry.err = ErrUserAlreadyExists
+			} else {
+				seen[entry.account.CanonicalEmail] = struct{}{}
+			}
+		}
+
+		batch = append(batch, entry)
+		if len(batch) < opts.BatchSize {
+			continue
+		}
+
+		err = flushImport(serv, batch, opts, &summary)
+		if err != nil {
+			return summary, err
+		}
+
+		batch = batch[:0]
+	}
+
+	return summary, flushImport(serv, batch, opts, &summary)
+}
+
+/*
+newImportedUser - Validates a single record of a bulk import and converts it into the user model that gets inserted
+*/
+func newImportedUser(serv *server.Server, imported *request.UserImportRequest) (*User, error) {
+	if imported.Email == "" || imported.Username == "" {
+		return nil, ErrUserMissingIdentifier
+	}
+
+	credential, err := importCredential(serv, &imported.Credential)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := newUser(serv, imported.Email, imported.Username, imported.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	account.Credential = credential
+
+	return account, nil
+}
+
+/*
+flushImport - Inserts the valid users in a batch, and reports the result of every record in it. Users that already
+exist are found with a single query before the batch is inserted, and any that are created in the meantime are caught
+by the unique index on their canonical email address
+*/
+func flushImport(serv *server.Server, batch []*importEntry, opts ImportOptions, summary *ImportSummary) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := markExisting(serv, batch)
+	if err != nil {
+		return err
+	}
+
+	pending := make([]*importEntry, 0, len(batch))
+	documents := make([]any, 0, len(batch))
+	for _, entry := range batch {
+		if entry.err == nil {
+			pending = append(pending, entry)
+			documents = append(documents, entry.account)
+		}
+	}
+
+	if len(documents) != 0 && !opts.DryRun {
+		/*
+			The batch is inserted unordered, so that a single duplicate does not stop the users after it from being
+			inserted. Each write error holds the position of the document it failed on
+		*/
+		_, err = serv.Database().Collection("user").InsertMany(serv.Context(), documents, mongoOpts.InsertMany().SetOrdered(false))
+		if err != nil {
+			var bulkError mongo.BulkWriteException
+			if !errors.As(err, &bulkError) || bulkError.WriteConcernError != nil || len(bulkError.WriteErrors) == 0 {
+				return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+			}
+
+			for _, writeError := range bulkError.WriteErrors {
+				if writeError.Code == 11000 {
+					pending[writeError.Index].err = ErrUserAlreadyExists
+				} else {
+					pending[writeError.Index].err = fmt.Errorf("%w (%v)", server.ErrInternalDatabase, writeError.Message)
+				}
+			}
+		}
+	}
+
+	for _, entry := range batch {
+		if entry.err != nil {
+			summary.Failed++
+
+			entry.result.Error = entry.err.Error()
+
+			var casted credstackError.CredstackError
+			if errors.As(entry.err, &casted) {
+				entry.result.Code = casted.Short()
+			}
+		} else {
+			summary.Imported++
+
+			if !opts.DryRun {
+				entry.result.Identifier = entry.account.Header.Identifier
+
+				serv.PublishEvent(events.TypeUserRegistered, map[string]string{
+					"identifier": entry.account.Header.Identifier,
+					"email":      entry.account.Email,
+				})
+			}
+		}
+
+		if opts.OnResult != nil {
+			err = opts.OnResult(entry.result)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+markExisting - Marks every valid user in the batch that already exists with ErrUserAlreadyExists, using a single query
+that only returns their canonical email addresses
+*/
+func markExisting(serv *server.Server, batch []*importEntry) error {
+	emails := make([]string, 0, len(batch))
+	for _, entry := range batch {
+		if entry.err == nil {
+			emails = append(emails, entry.account.CanonicalEmail)
+		}
+	}
+
+	if len(emails) == 0 {
+		return nil
+	}
+
+	cursor, err := serv.Database().Collection("user").Find(
+		serv.Context(),
+		bson.M{"canonical_email": bson.M{"$in": emails}},
+		mongoOpts.Find().SetProjection(bson.M{"_id": 0, "canonical_email": 1}),
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	var existing []struct {
+		CanonicalEmail string `bson:"canonical_email"`
+	}
+
+	err = cursor.All(serv.Context(), &existing)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	found := make(map[string]struct{}, len(existing))
+	for _, document := range existing {
+		found[document.CanonicalEmail] = struct{}{}
+	}
+
+	for _, entry := range batch {
+		if entry.err != nil {
+			continue
+		}
+
+		if _, ok := found[entry.account.CanonicalEmail]; ok {
+			entry.err = ErrUserAlreadyExists
+		}
+	}
+
+	return nil
+}
+
+/*
+jsonImportReader - Reads records from either a JSON array of records, or newline delimited JSON with one record per line
+*/
+type jsonImportReader struct {
+	// decoder - Decodes the elements of a JSON array. Nil for newline delimited JSON
+	decoder *json.Decoder
+
+	// lines - Reads the lines of newline delimited JSON. Nil for JSON arrays
+	lines *bufio.Reader
+}
+
+/*
+NewJSONImportReader - Returns an ImportReader for the reader provided in the parameter, which can hold either a JSON
+array of UserImportRequest objects or newline delimited JSON with one object per line. The format is detected from the
+first character. In newline delimited JSON, a line that cannot be decoded only fails that record, while a syntax error in
+a JSON array ends the import with ErrMalformedImport
+*/
+func NewJSONImportReader(r io.Reader) (ImportReader, error) {
+	buffered := bufio.NewReader(r)
+
+	for {
+		next, err := buffered.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return &jsonImportReader{lines: buffered}, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrMalformedImport, err)
+		}
+
+		switch next[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = buffered.ReadByte()
+			continue
+		case '[':
+			decoder := json.NewDecoder(buffered)
+			if _, err := decoder.Token(); err != nil {
+				return nil, fmt.Errorf("%w (%v)", ErrMalformedImport, err)
+			}
+
+			return &jsonImportReader{decoder: decoder}, nil
+		default:
+			return &jsonImportReader{lines: buffered}, nil
+		}
+	}
+}
+
+/*
+Next - Reads the next record. See ImportReader
+*/
+func (reader *jsonImportReader) Next() (*request.UserImportRequest, error) {
+	var ret request.UserImportRequest
+
+	if reader.decoder != nil {
+		if !reader.decoder.More() {
+			return nil, io.EOF
+		}
+
+		/*
+			The decoder reads the whole element before it is unmarshalled, so an element of the wrong type only fails
+			that record. Syntax errors leave the decoder in the middle of the array, so nothing after them can be read
+		*/
+		err := reader.decoder.Decode(&ret)
+		if err != nil {
+			var typeError *json.UnmarshalTypeError
+			if errors.As(err, &typeError) {
+				return nil, fmt.Errorf("%w (%v)", ErrMalformedImportRecord, err)
+			}
+
+			return nil, fmt.Errorf("%w (%v)", ErrMalformedImport, err)
+		}
+
+		return &ret, nil
+	}
+
+	for {
+		line, err := reader.lines.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w (%v)", ErrMalformedImport, err)
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err != nil {
+				return nil, io.EOF
+			}
+
+			continue // blank lines are not records
+		}
+
+		decodeErr := json.Unmarshal(line, &ret)
+		if decodeErr != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrMalformedImportRecord, decodeErr)
+		}
+
+		return &ret, nil
+	}
+}
+
+// csvColumns - The columns a CSV import can have. email and username are required, and the rest are optional
+var csvColumns = []string{"email", "username", "phone_number", "algorithm", "hash", "salt", "digest", "iterations", "cost", "block_size", "parallelism"}
+
+/*
+csvImportReader - Reads records from CSV, with the columns named by its header
+*/
+type csvImportReader struct {
+	// reader - Reads the rows of the CSV
+	reader *csv.Reader
+
+	// columns - The position of each column in a row, keyed by its name
+	columns map[string]int
+}
+
+/*
+NewCSVImportReader - Returns an ImportReader for the CSV provided in the parameter. The first row must be a header naming
+the columns of every row after it, in any order: email and username are required, and phone_number, algorithm, hash,
+salt, digest, iterations, cost, block_size, and parallelism are optional (see request.ImportedCredential). If the header
+names an unknown column, or is missing a required one, then ErrMalformedImport is returned
+*/
+func NewCSVImportReader(r io.Reader) (ImportReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrMalformedImport, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+
+		if !slices.Contains(csvColumns, column) {
+			return nil, fmt.Errorf("%w (unknown column: %s)", ErrMalformedImport, column)
+		}
+
+		columns[column] = i
+	}
+
+	for _, required := range []string{"email", "username"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w (missing column: %s)", ErrMalformedImport, required)
+		}
+	}
+
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+/*
+Next - Reads the next record. See ImportReader
+*/
+func (reader *csvImportReader) Next() (*request.UserImportRequest, error) {
+	row, err := reader.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+
+	/*
+		The CSV reader always moves on to the next row, so rows with the wrong number of fields or bad quoting only fail
+		the record they are in
+	*/
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return nil, fmt.Errorf("%w (%v)", ErrMalformedImportRecord, err)
+		}
+
+		return nil, fmt.Errorf("%w (%v)", ErrMalformedImport, err)
+	}
+
+	value := func(column string) string {
+		i, ok := reader.columns[column]
+		if !ok || i >= len(row) {
+			return ""
+		}
+
+		return strings.TrimSpace(row[i])
+	}
+
+	number := func(column string) (uint32, error) {
+		if value(column) == "" {
+			return 0, nil
+		}
+
+		parsed, err := strconv.ParseUint(value(column), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("%w (%s: %v)", ErrMalformedImportRecord, column, err)
+		}
+
+		return uint32(parsed), nil
+	}
+
+	ret := &request.UserImportRequest{
+		Email:       value("email"),
+		Username:    value("username"),
+		PhoneNumber: value("phone_number"),
+		Credential: request.ImportedCredential{
+			Algorithm: value("algorithm"),
+			Hash:      value("hash"),
+			Salt:      value("salt"),
+			Digest:    value("digest"),
+		},
+	}
+
+	if ret.Credential.Iterations, err = number("iterations"); err != nil {
+		return nil, err
+	}
+
+	if ret.Credential.Cost, err = number("cost"); err != nil {
+		return nil, err
+	}
+
+	if ret.Credential.BlockSize, err = number("block_size"); err != nil {
+		return nil, err
+	}
+
+	if ret.Credential.Parallelism, err = number("parallelism"); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
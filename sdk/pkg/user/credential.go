@@ -1,11 +1,44 @@
 package user
 
 import (
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
 	"fmt"
+	"hash"
 
 	"github.com/credstack/credstack/sdk/pkg/config"
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
 	"github.com/credstack/credstack/sdk/pkg/secret"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// CredentialAlgorithmArgon2id - Identifies a credential hashed with Argon2id
+	CredentialAlgorithmArgon2id = config.CredentialAlgorithmArgon2id
+
+	// CredentialAlgorithmPBKDF2 - Identifies a credential hashed with PBKDF2-HMAC-SHA256, or the digest stored alongside it
+	CredentialAlgorithmPBKDF2 = config.CredentialAlgorithmPBKDF2
+
+	// CredentialAlgorithmBcrypt - Identifies a credential imported from another identity provider that was hashed with bcrypt
+	CredentialAlgorithmBcrypt = "bcrypt"
+
+	// CredentialAlgorithmScrypt - Identifies a credential imported from another identity provider that was hashed with scrypt
+	CredentialAlgorithmScrypt = "scrypt"
+)
+
+const (
+	// DigestSHA1 - Identifies PBKDF2-HMAC-SHA1. Only ever used by imported credentials
+	DigestSHA1 = "sha1"
+
+	// DigestSHA256 - Identifies PBKDF2-HMAC-SHA256. This is the digest credstack hashes credentials with
+	DigestSHA256 = "sha256"
+
+	// DigestSHA512 - Identifies PBKDF2-HMAC-SHA512. Only ever used by imported credentials
+	DigestSHA512 = "sha512"
 )
 
 // ErrUserCredentialInvalid - Provides a named error for when user credential validation fails
@@ -18,7 +51,10 @@ var ErrFailedToHashCredential = credstackError.NewError(500, "FAILED_TO_HASH_CRE
 Credential - Represents the users hashed password and the parameters used to hash it. Hashing is performed
 */
 type Credential struct {
-	// Key - The user's hashed password represented as a string
+	// Algorithm - The algorithm used for hashing the credential. Credentials created before this was tracked are empty, which is treated as argon2id
+	Algorithm string `bson:"algorithm" json:"algorithm"`
+
+	// Key - The user's hashed password represented as a string. For bcrypt, this is the full bcrypt hash, which holds its own salt and cost
 	Key string `bson:"key" json:"key"`
 
 	// Salt - A randomly generated string used for introducing a unique value to the generated key
@@ -27,10 +63,19 @@ type Credential struct {
 	// Time - The cost parameter used by Argon when hashing passwords. Should be 1 usually
 	Time uint32 `bson:"time" json:"time"`
 
+	// Iterations - The number of iterations used by PBKDF2 when hashing passwords, or the CPU/memory cost (N) used by scrypt. Zero for Argon hashed credentials
+	Iterations uint32 `bson:"iterations" json:"iterations"`
+
+	// Digest - The hash function used by PBKDF2. Empty for credentials hashed by credstack, which is treated as sha256
+	Digest string `bson:"digest,omitempty" json:"digest,omitempty"`
+
+	// BlockSize - The block size (r) used by scrypt. Zero for any other algorithm
+	BlockSize uint32 `bson:"block_size,omitempty" json:"block_size,omitempty"`
+
 	// Memory - The amount of memory to be used when hashing passwords
 	Memory uint32 `bson:"memory" json:"memory"`
 
-	// Threads - The number of go-routines (threads) to be used when hashing the user's password
+	// Threads - The number of go-routines (threads) to be used when hashing the user's password, or the parallelism (p) used by scrypt
 	Threads uint32 `bson:"threads" json:"threads"`
 
 	// KeyLength - The length of the Argon generated key
@@ -47,11 +92,19 @@ errors that occur here are returned in the wrapped error: ErrFailedToHashCredent
 */
 func NewCredential(credential string, config config.CredentialConfig) (*Credential, error) {
 	/*
-		All logic for generating Argon2 Hashes are provided by the secrets package. A new cryptographically secure salt
+		All logic for generating hashes is provided by the secrets package. A new cryptographically secure salt
 		is generated from this function call, however returned values are not base64 encoded or marshalled into the
-		UserCredential structure.
+		UserCredential structure. PBKDF2 is only used when it has been selected explicitly, which is required for FIPS mode
 	*/
-	hash, salt, err := secret.NewArgon2Hash([]byte(credential), config)
+	var hash, salt []byte
+	var err error
+
+	if config.Algorithm == CredentialAlgorithmPBKDF2 {
+		hash, salt, err = secret.NewPBKDF2Hash([]byte(credential), config)
+	} else {
+		hash, salt, err = secret.NewArgon2Hash([]byte(credential), config)
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("%w (%v)", ErrFailedToHashCredential, err)
 	}
@@ -60,7 +113,8 @@ func NewCredential(credential string, config config.CredentialConfig) (*Credenti
 		After our credentials are generated, we marshal them into the user.UserCredentials struct and return it to
 		the caller. Any secrets generated are base64 encoded here (URL Safe)
 	*/
-	return &Credential{
+	ret := &Credential{
+		Algorithm:  CredentialAlgorithmArgon2id,
 		Key:        secret.EncodeBase64(hash),
 		Salt:       secret.EncodeBase64(salt),
 		Time:       config.Time,
@@ -68,7 +122,14 @@ func NewCredential(credential string, config config.CredentialConfig) (*Credenti
 		Threads:    uint32(config.Threads),
 		KeyLength:  config.KeyLength,
 		SaltLength: config.SaltLength,
-	}, nil
+	}
+
+	if config.Algorithm == CredentialAlgorithmPBKDF2 {
+		ret.Algorithm = CredentialAlgorithmPBKDF2
+		ret.Iterations = config.Iterations
+	}
+
+	return ret, nil
 }
 
 /*
@@ -77,6 +138,19 @@ struct passed in the credential parameter. This should be a UserCredential struc
 the user credentials do not match, then ErrUserCredentialInvalid is returned. Otherwise, nil is returned
 */
 func CheckCredential(validate string, credential *Credential) error {
+	/*
+		Bcrypt hashes are stored exactly as they were imported, as they already encode their own salt and cost, so they
+		skip the decoding below entirely
+	*/
+	if credential.Algorithm == CredentialAlgorithmBcrypt {
+		err := bcrypt.CompareHashAndPassword([]byte(credential.Key), []byte(validate))
+		if err != nil {
+			return ErrUserCredentialInvalid
+		}
+
+		return nil
+	}
+
 	/*
 		To start the validation process we first need to base64 decode the salt that was
 		stored in MongoDB. We use make to allocate us a byte array of the requested salt length
@@ -96,16 +170,35 @@ func CheckCredential(validate string, credential *Credential) error {
 	}
 
 	/*
-		Finally, we pass our decoded values and our raw credential and pass them to ValidateArgon2Hash to check its
-		validity. We need to create a separate CredentialOptions structure here as the secrets package has no awareness
-		of the UserCredential structure.
+		Finally, we pass our decoded values and our raw credential to the validation function for the algorithm the
+		credential was hashed with. We need to create a separate CredentialOptions structure here as the secrets package
+		has no awareness of the UserCredential structure.
 	*/
-	isValid := secret.ValidateArgon2Hash([]byte(validate), decodedSalt, decodedHash, config.CredentialConfig{
-		Time:      credential.Time,
-		Memory:    credential.Memory,
-		Threads:   uint8(credential.Threads),
-		KeyLength: credential.KeyLength,
-	})
+	var isValid bool
+
+	switch credential.Algorithm {
+	case CredentialAlgorithmPBKDF2:
+		if credential.Digest != "" && credential.Digest != DigestSHA256 {
+			isValid = validatePBKDF2(validate, decodedSalt, decodedHash, credential)
+			break
+		}
+
+		isValid = secret.ValidatePBKDF2Hash([]byte(validate), decodedSalt, decodedHash, config.CredentialConfig{
+			Iterations: credential.Iterations,
+			KeyLength:  credential.KeyLength,
+		})
+	case CredentialAlgorithmScrypt:
+		isValid = validateScrypt(validate, decodedSalt, decodedHash, credential)
+	case CredentialAlgorithmArgon2id, "":
+		isValid = secret.ValidateArgon2Hash([]byte(validate), decodedSalt, decodedHash, config.CredentialConfig{
+			Time:      credential.Time,
+			Memory:    credential.Memory,
+			Threads:   uint8(credential.Threads),
+			KeyLength: credential.KeyLength,
+		})
+	default:
+		return ErrUserCredentialInvalid
+	}
 
 	/*
 		We return an error here instead of a boolean, so that when we implement this into the API, we don't need to do
@@ -118,3 +211,73 @@ func CheckCredential(validate string, credential *Credential) error {
 
 	return nil
 }
+
+/*
+NeedsRehash - Determines if the credential was hashed with weaker parameters than the CredentialConfig provided in the
+parameter: with a different algorithm, or with any cost parameter, key length, or salt length below the configured one.
+Credentials that need rehashing can still be checked with CheckCredential, and are rehashed by Login once the user
+provides their password
+*/
+func (credential *Credential) NeedsRehash(config config.CredentialConfig) bool {
+	algorithm := credential.Algorithm
+	if algorithm == "" {
+		algorithm = CredentialAlgorithmArgon2id
+	}
+
+	configured := config.Algorithm
+	if configured != CredentialAlgorithmPBKDF2 {
+		configured = CredentialAlgorithmArgon2id
+	}
+
+	if algorithm != configured {
+		return true
+	}
+
+	if credential.KeyLength < config.KeyLength || credential.SaltLength < config.SaltLength {
+		return true
+	}
+
+	if algorithm == CredentialAlgorithmPBKDF2 {
+		return credential.Iterations < config.Iterations || (credential.Digest != "" && credential.Digest != DigestSHA256)
+	}
+
+	return credential.Time < config.Time || credential.Memory < config.Memory || credential.Threads < uint32(config.Threads)
+}
+
+// digests - The hash functions PBKDF2 credentials can be hashed with, keyed by the value of Credential.Digest
+var digests = map[string]func() hash.Hash{
+	DigestSHA1:   sha1.New,
+	DigestSHA256: sha256.New,
+	DigestSHA512: sha512.New,
+}
+
+/*
+validatePBKDF2 - Validates an imported PBKDF2 credential that was hashed with a digest other than SHA-256. Credentials
+hashed by credstack always use SHA-256, and are validated by the secret package instead
+*/
+func validatePBKDF2(validate string, salt []byte, target []byte, credential *Credential) bool {
+	digest, ok := digests[credential.Digest]
+	if !ok {
+		return false
+	}
+
+	key, err := pbkdf2.Key(digest, validate, salt, int(credential.Iterations), int(credential.KeyLength))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(target, key) == 1
+}
+
+/*
+validateScrypt - Validates an imported scrypt credential. The cost, block size, and parallelism are stored in the
+Iterations, BlockSize, and Threads fields of the credential
+*/
+func validateScrypt(validate string, salt []byte, target []byte, credential *Credential) bool {
+	key, err := scrypt.Key([]byte(validate), salt, int(credential.Iterations), int(credential.BlockSize), int(credential.Threads), int(credential.KeyLength))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(target, key) == 1
+}
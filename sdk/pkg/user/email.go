@@ -0,0 +1,47 @@
+package user
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+)
+
+// gmailDomains - Domains that ignore dots in the local part of an email address
+var gmailDomains = []string{"gmail.com", "googlemail.com"}
+
+/*
+NormalizeEmail - Converts an email address into its canonical form according to the provided config. The canonical form
+is what gets used for uniqueness checks and lookups, so that addresses like "User+test@Gmail.com" cannot be used to
+register a second account for the same mailbox. The domain is always lower-cased as it is case-insensitive per RFC 5321,
+while the local part is only folded if config.FoldCase is true.
+
+Addresses that do not contain an '@' are returned with only surrounding whitespace removed, as validation of the
+format is handled separately by Register
+*/
+func NormalizeEmail(email string, config config.EmailConfig) string {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return email
+	}
+
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+
+	if config.FoldCase {
+		local = strings.ToLower(local)
+	}
+
+	if config.StripPlusAddressing {
+		if plus := strings.Index(local, "+"); plus != -1 {
+			local = local[:plus]
+		}
+	}
+
+	if config.StripGmailDots && slices.Contains(gmailDomains, domain) {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+
+	return local + "@" + domain
+}
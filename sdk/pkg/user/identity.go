@@ -0,0 +1,364 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/events"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ProviderPassword - The provider of the identity created for every user with a password. Its subject is the identifier of the user
+const ProviderPassword = "password"
+
+// subjectSeparator - Separates the provider of an identity from its subject in the subject claim (google|1234)
+const subjectSeparator = "|"
+
+// ErrInvalidIdentity - Provides a named error for when an identity has no provider or subject, or is a password identity, which can only be created by registering
+var ErrInvalidIdentity = credstackError.NewError(400, "IDENTITY_INVALID", "user: Identities must have a provider and a subject, and password identities cannot be linked")
+
+// ErrIdentityAlreadyLinked - Provides a named error for when an identity is already linked to a user
+var ErrIdentityAlreadyLinked = credstackError.NewError(409, "IDENTITY_ALREADY_LINKED", "user: The identity is already linked to a user")
+
+// ErrIdentityEmailConflict - Provides a named error for when the email address of an identity belongs to a different user
+var ErrIdentityEmailConflict = credstackError.NewError(409, "IDENTITY_EMAIL_CONFLICT", "user: The email address of the identity belongs to a different user")
+
+// ErrIdentityNotLinked - Provides a named error for when an identity is not linked to the user
+var ErrIdentityNotLinked = credstackError.NewError(404, "IDENTITY_NOT_LINKED", "user: The identity is not linked to the user")
+
+// ErrPrimaryIdentity - Provides a named error for when the primary identity of a user is unlinked. Another identity must be made primary first
+var ErrPrimaryIdentity = credstackError.NewError(400, "IDENTITY_PRIMARY", "user: The primary identity cannot be unlinked")
+
+// ErrIdentitiesChanged - Provides a named error for when the identities of a user were changed by someone else while they were being updated. The update can be retried
+var ErrIdentitiesChanged = credstackError.NewError(409, "IDENTITIES_CHANGED", "user: The identities of the user were changed concurrently")
+
+/*
+Identity - A credential that a user can sign in with, such as their password or an account with an external identity
+provider. A single user can have several identities linked to them, exactly one of which is primary
+*/
+type Identity struct {
+	// Provider - The provider of the identity: password, or the name of an external provider or connection (google, saml, ldap)
+	Provider string `json:"provider" bson:"provider"`
+
+	// Subject - The identifier of the user at the provider. For password identities, this is the identifier of the user
+	Subject string `json:"subject" bson:"subject"`
+
+	// Email - The email address the provider holds for the user. Optional
+	Email string `json:"email,omitempty" bson:"email,omitempty"`
+
+	// Primary - If set to true, then the subject claim of tokens issued for the user is derived from this identity (see User.Subject)
+	Primary bool `json:"primary" bson:"primary"`
+
+	// LinkedAt - A unix timestamp of when the identity was linked to the user
+	LinkedAt int64 `json:"linked_at" bson:"linked_at"`
+}
+
+/*
+PrimaryIdentity - Returns the primary identity of the user. Users created before identities were tracked have none
+stored, and their password is treated as their primary identity
+*/
+func (user *User) PrimaryIdentity() Identity {
+	for _, identity := range user.Identities {
+		if identity.Primary {
+			return identity
+		}
+	}
+
+	return Identity{Provider: ProviderPassword, Subject: user.Header.Identifier, Primary: true}
+}
+
+/*
+Subject - Returns the subject claim of tokens issued for the user, which is derived from their primary identity. For a
+password identity, this is the identifier of the user, and for any other identity, this is its provider and subject
+separated by a vertical bar (google|1234). GetBySubject resolves every subject a user has had, so changing the primary
+identity does not invalidate tokens that were already issued
+*/
+func (user *User) Subject() string {
+	primary := user.PrimaryIdentity()
+	if primary.Provider == ProviderPassword {
+		return user.Header.Identifier
+	}
+
+	return primary.Provider + subjectSeparator + primary.Subject
+}
+
+/*
+passwordIdentity - Returns the identity created for a user with a password when they are registered or imported
+*/
+func passwordIdentity(account *User, linkedAt int64) Identity {
+	return Identity{
+		Provider: ProviderPassword,
+		Subject:  account.Header.Identifier,
+		Email:    account.Email,
+		Primary:  true,
+		LinkedAt: linkedAt,
+	}
+}
+
+/*
+identityFilter - Returns a filter matching the user that has the identity provided in the parameters linked to them
+*/
+func identityFilter(provider string, subject string) bson.M {
+	return bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+}
+
+/*
+GetBySubject - Fetches the user that the subject claim of a token was issued for (see User.Subject). Subjects without a
+vertical bar are the identifier of the user, and are resolved like GetByIdentifier. Any other subject is resolved to the
+user with the identity it names linked to them. If no user matches, then ErrUserDoesNotExist is returned
+*/
+func GetBySubject(serv *server.Server, subject string, withCredentials bool) (*User, error) {
+	provider, providerSubject, ok := strings.Cut(subject, subjectSeparator)
+	if !ok {
+		return GetByIdentifier(serv, subject, withCredentials)
+	}
+
+	if provider == "" || providerSubject == "" {
+		return nil, ErrUserMissingIdentifier
+	}
+
+	return getUser(serv, identityFilter(provider, providerSubject), withCredentials)
+}
+
+/*
+GetByIdentity - Fetches the user that the identity provided in the parameters is linked to, so that users signing in
+with an external provider can be resolved to their account. If no user has it linked, then ErrUserDoesNotExist is
+returned
+*/
+func GetByIdentity(serv *server.Server, provider string, subject string) (*User, error) {
+	if provider == "" || subject == "" {
+		return nil, ErrInvalidIdentity
+	}
+
+	return getUser(serv, identityFilter(provider, subject), false)
+}
+
+/*
+Link - Links the identity provided in the parameter to the user with the email address provided, so that they can sign
+in with it. The identity is never made primary here, see SetPrimaryIdentity. If the identity is already linked to any
+user, then ErrIdentityAlreadyLinked is returned, and if the identity has an email address that belongs to a different
+user, then ErrIdentityEmailConflict is returned, as the accounts should be merged instead
+*/
+func Link(serv *server.Server, email string, identity Identity) error {
+	if identity.Provider == "" || identity.Subject == "" || identity.Provider == ProviderPassword || strings.Contains(identity.Provider, subjectSeparator) {
+		return ErrInvalidIdentity
+	}
+
+	existing := serv.Database().Collection("user").FindOne(
+		serv.Context(),
+		identityFilter(identity.Provider, identity.Subject),
+		mongoOpts.FindOne().SetProjection(bson.M{"_id": 1}),
+	)
+	if existing.Err() == nil {
+		return ErrIdentityAlreadyLinked
+	}
+
+	if !errors.Is(existing.Err(), mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, existing.Err())
+	}
+
+	return updateIdentities(serv, email, func(account *User, identities []Identity) ([]Identity, error) {
+		if identity.Email != "" {
+			canonical := NormalizeEmail(identity.Email, serv.Config.EmailConfig)
+			if canonical != account.CanonicalEmail {
+				err := emailConflict(serv, canonical)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		identity.Primary = false
+		identity.LinkedAt = serv.Clock().Now().Unix()
+
+		return append(identities, identity), nil
+	})
+}
+
+/*
+emailConflict - Returns ErrIdentityEmailConflict if a user is registered under the canonical email address provided in
+the parameter
+*/
+func emailConflict(serv *server.Server, canonicalEmail string) error {
+	result := serv.Database().Collection("user").FindOne(
+		serv.Context(),
+		bson.M{"canonical_email": canonicalEmail},
+		mongoOpts.FindOne().SetProjection(bson.M{"_id": 1}),
+	)
+	if result.Err() == nil {
+		return ErrIdentityEmailConflict
+	}
+
+	if !errors.Is(result.Err(), mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, result.Err())
+	}
+
+	return nil
+}
+
+/*
+Unlink - Removes the identity provided in the parameters from the user with the email address provided. The primary
+identity cannot be unlinked, so ErrPrimaryIdentity is returned for it. Unlinking the password identity also removes the
+users credential, so that they can no longer sign in with a password. If the identity is not linked to the user, then
+ErrIdentityNotLinked is returned
+*/
+func Unlink(serv *server.Server, email string, provider string, subject string) error {
+	return updateIdentities(serv, email, func(account *User, identities []Identity) ([]Identity, error) {
+		i := slices.IndexFunc(identities, func(identity Identity) bool {
+			return identity.Provider == provider && identity.Subject == subject
+		})
+		if i == -1 {
+			return nil, ErrIdentityNotLinked
+		}
+
+		if identities[i].Primary {
+			return nil, ErrPrimaryIdentity
+		}
+
+		return slices.Delete(identities, i, i+1), nil
+	})
+}
+
+/*
+SetPrimaryIdentity - Makes the identity provided in the parameters the primary identity of the user with the email
+address provided, which changes the subject claim of the tokens issued for them from now on (see User.Subject). If the
+identity is not linked to the user, then ErrIdentityNotLinked is returned
+*/
+func SetPrimaryIdentity(serv *server.Server, email string, provider string, subject string) error {
+	return updateIdentities(serv, email, func(account *User, identities []Identity) ([]Identity, error) {
+		found := false
+		for i := range identities {
+			identities[i].Primary = identities[i].Provider == provider && identities[i].Subject == subject
+			found = found || identities[i].Primary
+		}
+
+		if !found {
+			return nil, ErrIdentityNotLinked
+		}
+
+		return identities, nil
+	})
+}
+
+/*
+updateIdentities - Replaces the identities of the user with the email address provided with the ones returned by the
+function provided in the parameter, which receives a copy of the current ones. Users created before identities were
+tracked receive their password identity first. The identities are only replaced if they have not changed since they
+were read, otherwise ErrIdentitiesChanged is returned. If the password identity is removed, then the credential of the
+user is removed along with it
+*/
+func updateIdentities(serv *server.Server, email string, fn func(account *User, identities []Identity) ([]Identity, error)) error {
+	if email == "" {
+		return ErrUserMissingIdentifier
+	}
+
+	account, err := Get(serv, email, false)
+	if err != nil {
+		return err
+	}
+
+	/*
+		The filter matches the identities exactly as they were read. For users created before identities were tracked,
+		that is a missing field instead of an empty array
+	*/
+	filter := bson.M{"header.identifier": account.Header.Identifier, "identities": account.Identities}
+
+	identities := slices.Clone(account.Identities)
+	if identities == nil {
+		filter["identities"] = bson.M{"$exists": false}
+		identities = []Identity{passwordIdentity(account, account.Header.CreatedAt)}
+	}
+
+	updated, err := fn(account, identities)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"identities": updated}}
+
+	hasPassword := slices.ContainsFunc(updated, func(identity Identity) bool {
+		return identity.Provider == ProviderPassword
+	})
+	if !hasPassword {
+		update["$unset"] = bson.M{"credential": ""}
+	}
+
+	result, err := serv.Database().Collection("user").UpdateOne(serv.Context(), filter, update)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrIdentitiesChanged
+	}
+
+	return nil
+}
+
+/*
+Provision - Creates a user that signs in through an external identity provider, the first time they do (just in time
+provisioning). The identity provided in the parameter is linked to them as their primary identity, and they have no
+password. The email address, username, phone number and profile fields (see copyProfile) of the new user are taken from
+the profile provided in the parameter, and any other field of it is ignored.
+
+If the identity is already linked to a user, then ErrIdentityAlreadyLinked is returned. If a user is already registered
+under the email address, then ErrIdentityEmailConflict is returned instead of linking the identity to them, as the
+provider cannot be trusted to prove that the user owns that account. They must sign in to it and link the identity first
+*/
+func Provision(serv *server.Server, identity Identity, profile *User) (*User, error) {
+	if identity.Provider == "" || identity.Subject == "" || identity.Provider == ProviderPassword || strings.Contains(identity.Provider, subjectSeparator) {
+		return nil, ErrInvalidIdentity
+	}
+
+	if profile.Email == "" || profile.Username == "" {
+		return nil, ErrUserMissingIdentifier
+	}
+
+	account, err := newUser(serv, profile.Email, profile.Username, profile.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	copyProfile(account, profile)
+
+	identity.Primary = true
+	identity.LinkedAt = account.Header.CreatedAt
+	account.Identities = []Identity{identity}
+
+	_, err = GetByIdentity(serv, identity.Provider, identity.Subject)
+	if err == nil {
+		return nil, ErrIdentityAlreadyLinked
+	}
+
+	if !errors.Is(err, ErrUserDoesNotExist) {
+		return nil, err
+	}
+
+	err = emailConflict(serv, account.CanonicalEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = serv.Database().Collection("user").InsertOne(serv.Context(), account)
+	if err != nil {
+		var writeError mongo.WriteException
+		if errors.As(err, &writeError) && writeError.HasErrorCode(11000) {
+			return nil, ErrIdentityEmailConflict
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	serv.PublishEvent(events.TypeUserRegistered, map[string]string{
+		"identifier": account.Header.Identifier,
+		"email":      account.Email,
+	})
+
+	return account, nil
+}
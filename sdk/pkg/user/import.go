@@ -0,0 +1,193 @@
+package user
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/models/request"
+	"github.com/credstack/credstack/sdk/pkg/secret"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxImportedIterations - The most PBKDF2 iterations an imported credential can use. Every login with the credential computes every iteration, so this bounds the cost of validating it
+	maxImportedIterations uint32 = 10_000_000
+
+	// maxImportedBcryptCost - The highest cost an imported bcrypt credential can use. Each increment doubles the work of validating it
+	maxImportedBcryptCost = 16
+
+	// maxImportedScryptMemory - The most memory (128 * N * r bytes) validating an imported scrypt credential can allocate
+	maxImportedScryptMemory uint64 = 256 << 20
+
+	// maxImportedScryptParallelism - The highest parallelism (p) an imported scrypt credential can use. The work of validating it grows linearly with this
+	maxImportedScryptParallelism uint32 = 16
+)
+
+// ErrImportedCredentialInvalid - Provides a named error for when an imported credential has an unsupported algorithm, or is missing the parameters it was hashed with
+var ErrImportedCredentialInvalid = credstackError.NewError(400, "IMPORTED_CREDENTIAL_INVALID", "user: The imported credential is malformed or uses an unsupported algorithm")
+
+/*
+Import - Core logic for importing a user from another identity provider, along with the password hash it was exported
+with. The user is validated exactly like Register, however the password is never known: the foreign hash is stored with
+its parameters, validated against on the users first login, and then rehashed with the servers CredentialConfig (see
+Credential.NeedsRehash), so that users never notice the migration.
+
+If the credential is malformed, then ErrImportedCredentialInvalid is returned. bcrypt and scrypt are not FIPS 140
+approved, so in FIPS mode only PBKDF2 credentials can be imported, and config.ErrNotFIPSApproved is returned otherwise
+*/
+func Import(serv *server.Server, email string, username string, phoneNumber string, imported *request.ImportedCredential) error {
+	if email == "" || username == "" {
+		return ErrUserMissingIdentifier
+	}
+
+	credential, err := importCredential(serv, imported)
+	if err != nil {
+		return err
+	}
+
+	account, err := newUser(serv, email, username, phoneNumber)
+	if err != nil {
+		return err
+	}
+
+	return create(serv, account, func() (*Credential, error) {
+		return credential, nil
+	})
+}
+
+/*
+importCredential - Converts the imported credential provided in the parameter with NewImportedCredential, and rejects
+algorithms that are not FIPS 140 approved when the server is running in FIPS mode
+*/
+func importCredential(serv *server.Server, imported *request.ImportedCredential) (*Credential, error) {
+	credential, err := NewImportedCredential(imported)
+	if err != nil {
+		return nil, err
+	}
+
+	if serv.Config.CryptoConfig.FIPSEnabled() && credential.Algorithm != CredentialAlgorithmPBKDF2 {
+		return nil, fmt.Errorf("%w (%s credentials cannot be imported)", config.ErrNotFIPSApproved, credential.Algorithm)
+	}
+
+	return credential, nil
+}
+
+/*
+NewImportedCredential - Converts a password hash exported from another identity provider into a Credential that can be
+checked with CheckCredential. Salts and derived keys are accepted as either standard or URL-safe base64, with or without
+padding, and are re-encoded the way credstack stores them. If the algorithm is not supported, or any of the parameters
+it needs are missing, or its cost parameters are high enough that validating it on login would exhaust the server, then
+ErrImportedCredentialInvalid is returned
+*/
+func NewImportedCredential(imported *request.ImportedCredential) (*Credential, error) {
+	if imported == nil {
+		return nil, ErrImportedCredentialInvalid
+	}
+
+	if imported.Algorithm == CredentialAlgorithmBcrypt {
+		/*
+			bcrypt hashes hold their own salt and cost, so the cost is parsed here only to make sure that the hash is
+			well-formed before it is stored
+		*/
+		cost, err := bcrypt.Cost([]byte(imported.Hash))
+		if err != nil {
+			return nil, fmt.Errorf("%w (%v)", ErrImportedCredentialInvalid, err)
+		}
+
+		if cost > maxImportedBcryptCost {
+			return nil, fmt.Errorf("%w (bcrypt cost cannot be more than %d)", ErrImportedCredentialInvalid, maxImportedBcryptCost)
+		}
+
+		return &Credential{Algorithm: CredentialAlgorithmBcrypt, Key: imported.Hash}, nil
+	}
+
+	key, err := decodeForeign(imported.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	salt, err := decodeForeign(imported.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Credential{
+		Key:        secret.EncodeBase64(key),
+		Salt:       secret.EncodeBase64(salt),
+		KeyLength:  uint32(len(key)),
+		SaltLength: uint32(len(salt)),
+	}
+
+	switch imported.Algorithm {
+	case CredentialAlgorithmPBKDF2:
+		digest := strings.ToLower(imported.Digest)
+		if digest == "" {
+			digest = DigestSHA256
+		}
+
+		if _, ok := digests[digest]; !ok || imported.Iterations == 0 {
+			return nil, fmt.Errorf("%w (pbkdf2 requires iterations and a digest of sha1, sha256 or sha512)", ErrImportedCredentialInvalid)
+		}
+
+		if imported.Iterations > maxImportedIterations {
+			return nil, fmt.Errorf("%w (pbkdf2 iterations cannot be more than %d)", ErrImportedCredentialInvalid, maxImportedIterations)
+		}
+
+		ret.Algorithm = CredentialAlgorithmPBKDF2
+		ret.Iterations = imported.Iterations
+
+		/*
+			Credentials hashed by credstack never store their digest, so SHA-256 credentials are stored the same way and
+			are not rehashed on login unless their parameters are weaker than the configured ones
+		*/
+		if digest != DigestSHA256 {
+			ret.Digest = digest
+		}
+	case CredentialAlgorithmScrypt:
+		if imported.Cost < 2 || imported.Cost&(imported.Cost-1) != 0 || imported.BlockSize == 0 || imported.Parallelism == 0 {
+			return nil, fmt.Errorf("%w (scrypt requires a cost that is a power of two, a block size, and a parallelism)", ErrImportedCredentialInvalid)
+		}
+
+		/*
+			scrypt allocates 128 * N * r bytes for every validation, so the cost and block size are bounded together, which
+			also keeps their product from overflowing the int scrypt.Key takes them as
+		*/
+		if 128*uint64(imported.Cost)*uint64(imported.BlockSize) > maxImportedScryptMemory || imported.Parallelism > maxImportedScryptParallelism {
+			return nil, fmt.Errorf("%w (scrypt cannot use more than %d MiB of memory or a parallelism of more than %d)", ErrImportedCredentialInvalid, maxImportedScryptMemory>>20, maxImportedScryptParallelism)
+		}
+
+		ret.Algorithm = CredentialAlgorithmScrypt
+		ret.Iterations = imported.Cost
+		ret.BlockSize = imported.BlockSize
+		ret.Threads = imported.Parallelism
+	default:
+		return nil, fmt.Errorf("%w (unsupported algorithm: %s)", ErrImportedCredentialInvalid, imported.Algorithm)
+	}
+
+	return ret, nil
+}
+
+/*
+decodeForeign - Decodes a salt or derived key exported from another identity provider. Providers disagree on which base64
+alphabet to use and whether to pad it, so each of them is tried in turn. Empty values are rejected, as every algorithm
+other than bcrypt needs both
+*/
+func decodeForeign(value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("%w (missing hash or salt)", ErrImportedCredentialInvalid)
+	}
+
+	encodings := []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding}
+	for _, encoding := range encodings {
+		decoded, err := encoding.DecodeString(value)
+		if err == nil {
+			return decoded, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w (hash and salt must be base64 encoded)", ErrImportedCredentialInvalid)
+}
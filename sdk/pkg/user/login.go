@@ -1,3 +1,109 @@
 package user
 
+import (
+	"errors"
+	"fmt"
+	"sync"
 
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+/*
+Login - Validates the email address and password provided in the parameters and returns the user they belong to. The
+credential is removed from the returned user. If the user does not exist, ErrUserCredentialInvalid is returned instead
+of ErrUserDoesNotExist so that callers cannot use this to discover which email addresses are registered. The password is
+still checked against a placeholder credential in this case, so that the time taken does not reveal it either. If the
+user is locked, then ErrUserLocked is returned.
+
+If the credential was hashed with weaker parameters than the servers CredentialConfig (see Credential.NeedsRehash), then
+it is rehashed with the current parameters now that the password is known, so that costs can be raised without forcing
+password resets. Failing to rehash never fails the login
+*/
+func Login(serv *server.Server, email string, password string) (*User, error) {
+	ret, err := Get(serv, email, true)
+	if err != nil {
+		if errors.Is(err, ErrUserDoesNotExist) {
+			return nil, rejectCredential(serv, password)
+		}
+
+		return nil, err
+	}
+
+	if ret.Credential == nil {
+		return nil, rejectCredential(serv, password)
+	}
+
+	err = CheckCredential(password, ret.Credential)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		The lock is only checked once the password is known to be correct, so that callers cannot use this to discover
+		which accounts are locked
+	*/
+	if ret.Locked {
+		return nil, ErrUserLocked
+	}
+
+	if ret.Credential.NeedsRehash(serv.Config.CredentialConfig) {
+		err = rehash(serv, ret, password)
+		if err != nil {
+			serv.Log().LogErrorEvent("Failed to rehash user credential", err)
+		}
+	}
+
+	ret.Credential = nil
+
+	return ret, nil
+}
+
+// placeholderCredentials - The credentials that passwords are checked against when there is no user to check them against, keyed by the CredentialConfig they were hashed with
+var placeholderCredentials sync.Map
+
+/*
+rejectCredential - Checks the password provided in the parameter against a placeholder credential hashed with the
+servers CredentialConfig, and returns ErrUserCredentialInvalid. This spends the same time hashing as checking the
+password of a user that exists would, so that failed logins for unknown email addresses cannot be told apart by timing
+*/
+func rejectCredential(serv *server.Server, password string) error {
+	credentialConfig := serv.Config.CredentialConfig
+
+	placeholder, ok := placeholderCredentials.Load(credentialConfig)
+	if !ok {
+		generated, err := NewCredential("credstack-placeholder-credential", credentialConfig)
+		if err != nil {
+			return ErrUserCredentialInvalid
+		}
+
+		placeholder, _ = placeholderCredentials.LoadOrStore(credentialConfig, generated)
+	}
+
+	_ = CheckCredential(password, placeholder.(*Credential))
+
+	return ErrUserCredentialInvalid
+}
+
+/*
+rehash - Replaces the credential of the user provided in the parameter with one hashed from their password with the
+servers current CredentialConfig. The stored key is part of the filter, so that a password that was changed since the
+user was fetched is never overwritten with the old one
+*/
+func rehash(serv *server.Server, account *User, password string) error {
+	credential, err := NewCredential(password, serv.Config.CredentialConfig)
+	if err != nil {
+		return err
+	}
+
+	_, err = serv.Database().Collection("user").UpdateOne(
+		serv.Context(),
+		bson.M{"header.identifier": account.Header.Identifier, "credential.key": account.Credential.Key},
+		bson.M{"$set": bson.M{"credential": credential}},
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return nil
+}
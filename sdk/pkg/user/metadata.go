@@ -0,0 +1,246 @@
+package user
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	mongoOpts "go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// FieldUserMetadata - The field holding the metadata that users can edit themselves
+	FieldUserMetadata = "user_metadata"
+
+	// FieldAppMetadata - The field holding the metadata that can only be edited through the management API
+	FieldAppMetadata = "app_metadata"
+)
+
+// ErrMetadataTooLarge - Provides a named error for when an update would grow metadata past the limit configured in MetadataConfig
+var ErrMetadataTooLarge = credstackError.NewError(400, "METADATA_TOO_LARGE", "user: The metadata would exceed its size limit")
+
+// ErrInvalidMetadataKey - Provides a named error for when a metadata key is empty, contains a period, or starts with a dollar sign
+var ErrInvalidMetadataKey = credstackError.NewError(400, "METADATA_INVALID_KEY", "user: Metadata keys cannot be empty, contain a period, or start with a dollar sign")
+
+/*
+Metadata - Schemaless data stored on a user. Values can be any JSON value, including nested objects and arrays
+*/
+type Metadata map[string]any
+
+/*
+UnmarshalBSON - Decodes metadata so that nested documents are plain maps and arrays are plain slices, as the driver
+otherwise decodes them as bson.D and bson.A, which are encoded to JSON as a list of keys and values, and cannot be
+traversed by the claim mappings
+*/
+func (metadata *Metadata) UnmarshalBSON(data []byte) error {
+	decoder := bson.NewDecoder(bson.NewDocumentReader(bytes.NewReader(data)))
+	decoder.DefaultDocumentM()
+
+	var decoded bson.M
+
+	err := decoder.Decode(&decoded)
+	if err != nil {
+		return err
+	}
+
+	*metadata = make(Metadata, len(decoded))
+	for key, value := range decoded {
+		(*metadata)[key] = plainValue(value)
+	}
+
+	return nil
+}
+
+/*
+plainValue - Converts the documents and arrays in a decoded value into map[string]any and []any. Any other value is
+returned as it is
+*/
+func plainValue(value any) any {
+	switch typed := value.(type) {
+	case bson.M:
+		ret := make(map[string]any, len(typed))
+		for key, nested := range typed {
+			ret[key] = plainValue(nested)
+		}
+
+		return ret
+	case bson.A:
+		ret := make([]any, len(typed))
+		for i := range typed {
+			ret[i] = plainValue(typed[i])
+		}
+
+		return ret
+	default:
+		return value
+	}
+}
+
+/*
+UpdateUserMetadata - Merges the patch provided in the parameter into the user metadata of the user with the email
+address provided. Keys in the patch replace the keys of the same name, keys set to null are removed, and any other key
+is left as it is. The merged metadata is returned.
+
+If the merged metadata would be larger than MetadataConfig.MaxUserMetadataSize, then ErrMetadataTooLarge is returned and
+nothing is changed. If the user does not exist, then ErrUserDoesNotExist is returned
+*/
+func UpdateUserMetadata(serv *server.Server, email string, patch map[string]any) (Metadata, error) {
+	if email == "" {
+		return nil, ErrUserMissingIdentifier
+	}
+
+	return updateMetadata(serv, bson.M{"canonical_email": NormalizeEmail(email, serv.Config.EmailConfig)}, FieldUserMetadata, serv.Config.MetadataConfig.MaxUserMetadataSize, patch)
+}
+
+/*
+UpdateUserMetadataByIdentifier - Merges the patch provided in the parameter into the user metadata of the user with the
+identifier provided, so that users can edit their own metadata with an access token. See UpdateUserMetadata
+*/
+func UpdateUserMetadataByIdentifier(serv *server.Server, identifier string, patch map[string]any) (Metadata, error) {
+	if identifier == "" {
+		return nil, ErrUserMissingIdentifier
+	}
+
+	return updateMetadata(serv, bson.M{"header.identifier": identifier}, FieldUserMetadata, serv.Config.MetadataConfig.MaxUserMetadataSize, patch)
+}
+
+/*
+UpdateAppMetadata - Merges the patch provided in the parameter into the app metadata of the user with the email address
+provided, limited by MetadataConfig.MaxAppMetadataSize. App metadata can only be edited through the management API, so
+it can be trusted by the applications reading it from tokens. See UpdateUserMetadata
+*/
+func UpdateAppMetadata(serv *server.Server, email string, patch map[string]any) (Metadata, error) {
+	if email == "" {
+		return nil, ErrUserMissingIdentifier
+	}
+
+	return updateMetadata(serv, bson.M{"canonical_email": NormalizeEmail(email, serv.Config.EmailConfig)}, FieldAppMetadata, serv.Config.MetadataConfig.MaxAppMetadataSize, patch)
+}
+
+/*
+updateMetadata - Merges the patch into the metadata field of the user matching the filter. Only the keys in the patch are
+written, so that concurrent updates to different keys do not overwrite each other. The size limit is checked against the
+metadata as it was read, so concurrent updates can exceed it by at most the size of a single patch
+*/
+func updateMetadata(serv *server.Server, filter bson.M, field string, limit uint32, patch map[string]any) (Metadata, error) {
+	err := validateMetadataKeys(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var current User
+
+	err = serv.Database().Collection("user").FindOne(
+		serv.Context(),
+		filter,
+		mongoOpts.FindOne().SetProjection(bson.M{field: 1}),
+	).Decode(&current)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserDoesNotExist
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	merged := current.UserMetadata
+	if field == FieldAppMetadata {
+		merged = current.AppMetadata
+	}
+
+	merged = maps.Clone(merged)
+	if merged == nil {
+		merged = make(Metadata)
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+
+	for key, value := range patch {
+		if value == nil {
+			delete(merged, key)
+			unset[field+"."+key] = ""
+			continue
+		}
+
+		merged[key] = value
+		set[field+"."+key] = value
+	}
+
+	encoded, err := bson.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", ErrInvalidMetadataKey, err)
+	}
+
+	if len(encoded) > int(limit) {
+		return nil, fmt.Errorf("%w (%d of %d bytes)", ErrMetadataTooLarge, len(encoded), limit)
+	}
+
+	update := bson.M{}
+	if len(set) != 0 {
+		update["$set"] = set
+	}
+
+	if len(unset) != 0 {
+		update["$unset"] = unset
+	}
+
+	if len(update) == 0 {
+		return merged, nil
+	}
+
+	result, err := serv.Database().Collection("user").UpdateOne(serv.Context(), filter, update)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, ErrUserDoesNotExist
+	}
+
+	return merged, nil
+}
+
+/*
+validateMetadataKeys - Ensures that every key in the metadata, including the keys of nested objects, can be stored in
+MongoDB and addressed with a dotted path. If one cannot, then ErrInvalidMetadataKey is returned
+*/
+func validateMetadataKeys(metadata map[string]any) error {
+	for key, value := range metadata {
+		if key == "" || strings.Contains(key, ".") || strings.HasPrefix(key, "$") {
+			return fmt.Errorf("%w (%q)", ErrInvalidMetadataKey, key)
+		}
+
+		err := validateMetadataValue(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+validateMetadataValue - Validates the keys of the objects nested anywhere within a metadata value
+*/
+func validateMetadataValue(value any) error {
+	switch typed := value.(type) {
+	case map[string]any:
+		return validateMetadataKeys(typed)
+	case []any:
+		for _, element := range typed {
+			err := validateMetadataValue(element)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
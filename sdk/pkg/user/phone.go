@@ -0,0 +1,52 @@
+package user
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/credstack/credstack/sdk/pkg/config"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+)
+
+// ErrPhoneNumberInvalid - Provides a named error that occurs when a phone number cannot be normalized to E.164 format
+var ErrPhoneNumberInvalid = credstackError.NewError(400, "PHONE_NUMBER_INVALID", "phone: Invalid phone number. Phone numbers must be in E.164 format")
+
+// e164Regex - A regular expression for validating that a phone number conforms to E.164
+var e164Regex = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// phoneSeparators - Characters that are commonly used for formatting phone numbers and are removed during normalization
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+/*
+NormalizePhoneNumber - Converts a user provided phone number into E.164 format (+18005555555). Formatting characters
+(spaces, dashes, dots, and parentheses) are removed and the international "00" prefix is converted to "+". If the number
+does not include a country calling code, then config.DefaultCountryCode is applied to it after removing any leading trunk
+prefix (0). If no default country code is configured, then national numbers are rejected.
+
+An empty phone number is returned as-is, as the phone number is an optional field on the user. If the result is not a
+valid E.164 number, then ErrPhoneNumberInvalid is returned
+*/
+func NormalizePhoneNumber(phoneNumber string, config config.PhoneConfig) (string, error) {
+	normalized := phoneSeparators.Replace(strings.TrimSpace(phoneNumber))
+	if normalized == "" {
+		return "", nil
+	}
+
+	switch {
+	case strings.HasPrefix(normalized, "+"):
+	case strings.HasPrefix(normalized, "00"):
+		normalized = "+" + normalized[2:]
+	default:
+		if config.DefaultCountryCode == "" {
+			return "", ErrPhoneNumberInvalid
+		}
+
+		normalized = "+" + strings.TrimPrefix(config.DefaultCountryCode, "+") + strings.TrimPrefix(normalized, "0")
+	}
+
+	if !e164Regex.MatchString(normalized) {
+		return "", ErrPhoneNumberInvalid
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,68 @@
+package user
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/credstack/credstack/sdk/pkg/query"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+/*
+querySpec - Describes how users are exported. Users are paginated by their object ID, which MongoDB generates when they
+are inserted and which begins with the time they were inserted at, so the time range matches when the user was created.
+The credential can never be selected, so that exporting users never exposes password hashes
+*/
+var querySpec = &query.Spec{
+	Collection: "user",
+	Fields: []string{
+		"header",
+		"username",
+		"email",
+		"canonical_email",
+		"email_verified",
+		"given_name",
+		"middle_name",
+		"family_name",
+		"gender",
+		"birth_date",
+		"zone_info",
+		"phone_number",
+		"phone_number_verified",
+		"address",
+		"scopes",
+		"roles",
+		"locked",
+		"user_metadata",
+		"app_metadata",
+		"identities",
+		"external_id",
+	},
+	CursorField: "_id",
+	ParseCursor: func(cursor string) (any, error) {
+		return bson.ObjectIDFromHex(cursor)
+	},
+	FormatCursor: func(value any) (string, error) {
+		id, ok := value.(bson.ObjectID)
+		if !ok {
+			return "", fmt.Errorf("unexpected object ID type: %T", value)
+		}
+
+		return id.Hex(), nil
+	},
+	SubjectField: "header.identifier",
+	TimeField:    "_id",
+	TimeValue: func(t time.Time) any {
+		return bson.NewObjectIDFromTimestamp(t)
+	},
+}
+
+/*
+Export - Opens a stream of every user matching the options provided in the parameter, in the order they were created,
+without their credentials. The subject filter matches the identifier of the user, and the time range matches when the
+user was created. See query.Export
+*/
+func Export(serv *server.Server, opts *query.Options) (*query.Stream, error) {
+	return query.Export(serv, querySpec, opts)
+}
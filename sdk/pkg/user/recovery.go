@@ -0,0 +1,94 @@
+package user
+
+import (
+	"fmt"
+
+	"github.com/credstack/credstack/sdk/pkg/audit"
+	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	// EventPasswordReset - The audit event recorded when a user's password is reset by an administrator
+	EventPasswordReset = "user.password_reset"
+
+	// EventUnlocked - The audit event recorded when a locked user is unlocked by an administrator
+	EventUnlocked = "user.unlocked"
+)
+
+// ErrUserLocked - Provides a named error for when a user with valid credentials cannot log in as their account is locked
+var ErrUserLocked = credstackError.NewError(403, "USER_LOCKED", "user: user account is locked")
+
+/*
+ResetPassword - Replaces the password of the user with the email address provided in the parameter, without requiring
+the current one. The password is validated against the servers CredentialConfig in the same way as Register. This is
+intended for administrators, and is recorded in the audit log under the actor provided in the parameter
+*/
+func ResetPassword(serv *server.Server, email string, password string, actor string) error {
+	if email == "" {
+		return ErrUserMissingIdentifier
+	}
+
+	config := serv.Config.CredentialConfig
+
+	if len(password) < int(config.MinSecretLength) {
+		return ErrPasswordTooShort
+	}
+
+	if len(password) > int(config.MaxSecretLength) {
+		return ErrPasswordTooLong
+	}
+
+	credential, err := NewCredential(password, config)
+	if err != nil {
+		return err
+	}
+
+	return updateAccount(serv, email, bson.M{"credential": credential}, EventPasswordReset, actor, "Password reset by an administrator")
+}
+
+/*
+Unlock - Unlocks the user with the email address provided in the parameter, so that they can log in again. Unlocking a
+user that is not locked is not an error. This is recorded in the audit log under the actor provided in the parameter
+*/
+func Unlock(serv *server.Server, email string, actor string) error {
+	if email == "" {
+		return ErrUserMissingIdentifier
+	}
+
+	return updateAccount(serv, email, bson.M{"locked": false}, EventUnlocked, actor, "Account unlocked by an administrator")
+}
+
+/*
+updateAccount - Applies an administrative change to a user and records it in the audit log. Failures to record the
+change are logged rather than returned, as the change has already been persisted
+*/
+func updateAccount(serv *server.Server, email string, update bson.M, eventType string, actor string, description string) error {
+	account, err := Get(serv, email, false)
+	if err != nil {
+		return err
+	}
+
+	result, err := serv.Database().Collection("user").UpdateOne(
+		serv.Context(),
+		bson.M{"header.identifier": account.Header.Identifier},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserDoesNotExist
+	}
+
+	err = audit.Log(serv, eventType, actor, account.Header.Identifier, description, map[string]string{
+		"email": account.Email,
+	})
+	if err != nil {
+		serv.Log().LogErrorEvent("Failed to record account change in the audit log", err)
+	}
+
+	return nil
+}
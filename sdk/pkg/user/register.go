@@ -1,13 +1,13 @@
 package user
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"regexp"
 
 	"github.com/credstack/credstack/sdk/pkg/config"
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/events"
 	"github.com/credstack/credstack/sdk/pkg/header"
 	"github.com/credstack/credstack/sdk/pkg/server"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -37,8 +37,11 @@ var emailRegex = regexp.MustCompile("^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\\.[a-zA-Z
 Register - Core logic for registering new users with credstack. Performs full validation on any of the user data
 provided here. New users must have a unique email address and this will be validated here. Any errors propagated through
 this function call is returned. This is generally only named errors defined in this package.
+
+The phone number is optional, however if it is provided it is normalized to E.164 format using the servers PhoneConfig
+before it is stored. ErrPhoneNumberInvalid is returned if this fails
 */
-func Register(serv *server.Server, config config.CredentialConfig, email string, username string, password string) error {
+func Register(serv *server.Server, config config.CredentialConfig, email string, username string, password string, phoneNumber string) error {
 	/*
 		Originally, I was going to place this logic in NewCredential, however we don't want to consume a DB call
 		if the information provided here is invalid (Bad Request)
@@ -55,14 +58,65 @@ func Register(serv *server.Server, config config.CredentialConfig, email string,
 		return ErrPasswordTooLong
 	}
 
-	/*
-		Here we want to validate that the email address being used is valid. Eventually, we want to send the user a
-		validation email on account creation, so this must be valid
-	*/
-	if !emailRegex.MatchString(email) {
-		return ErrEmailAddressInvalid
+	account, err := newUser(serv, email, username, phoneNumber)
+	if err != nil {
+		return err
+	}
+
+	return create(serv, account, func() (*Credential, error) {
+		return NewCredential(password, config)
+	})
+}
+
+/*
+RegisterProfile - Registers a new user with the profile of the user provided in the parameter (see copyProfile for the
+fields that are copied), and returns it without its credential. Unlike Register, the password is optional, as users
+provisioned from a directory (SCIM) usually sign in through federation instead. Users registered without a password
+cannot log in with one until it is set with ResetPassword
+*/
+func RegisterProfile(serv *server.Server, profile *User, password string) (*User, error) {
+	if profile.Email == "" || profile.Username == "" {
+		return nil, ErrUserMissingIdentifier
+	}
+
+	if password != "" && len(password) < int(serv.Config.CredentialConfig.MinSecretLength) {
+		return nil, ErrPasswordTooShort
+	}
+
+	if len(password) > int(serv.Config.CredentialConfig.MaxSecretLength) {
+		return nil, ErrPasswordTooLong
 	}
 
+	account, err := newUser(serv, profile.Email, profile.Username, profile.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	copyProfile(account, profile)
+
+	err = create(serv, account, func() (*Credential, error) {
+		if password == "" {
+			return nil, nil
+		}
+
+		return NewCredential(password, serv.Config.CredentialConfig)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	account.Credential = nil
+
+	return account, nil
+}
+
+/*
+create - Inserts the new user provided in the parameter (see newUser). The credential is only produced once the user is
+known not to exist, as hashing a password is expensive. This is shared by Register, RegisterProfile and Import, which
+validate the credential itself before calling it
+*/
+func create(serv *server.Server, account *User, newCredential func() (*Credential, error)) error {
+
 	/*
 		Once we validate that the provided information is correct, we need to ensure that the user does not
 		already exist under this email address. Realistically, I wanted to **just** use unique indexes for
@@ -78,9 +132,9 @@ func Register(serv *server.Server, config config.CredentialConfig, email string,
 		care about its results, we only care that we don't get mongo.ErrNoDocuments returned to us
 	*/
 	result := serv.Database().Collection("user").FindOne(
-		context.Background(),
-		bson.M{"email": email},
-		mongoOpts.FindOne().SetProjection(bson.M{"email": 1}))
+		serv.Context(),
+		bson.M{"canonical_email": account.CanonicalEmail},
+		mongoOpts.FindOne().SetProjection(bson.M{"canonical_email": 1}))
 
 	/*
 		If our error is mongo.ErrNoDocuments, then we know the user does not exist. If we receive another error,
@@ -100,34 +154,18 @@ func Register(serv *server.Server, config config.CredentialConfig, email string,
 		Finally, once we know that the user doesn't already exist, we can pay the Argon cost, hash there password,
 		and store the results in the collection object
 	*/
-	credential, err := NewCredential(password, config)
+	credential, err := newCredential()
 	if err != nil {
 		return err
 	}
 
-	/*
-		Here we are constructing the user model that will get inserted into MongoDB. We need to use make on roles
-		and scopes to ensure that these don't get inserted into MongoDB as null fields. By default, an empty slice
-		is also nil in Go-Lang and this is what will get stored in our Database.
-
-		TODO: Validation for email address
-	*/
-	userHeader := header.New(email)
-
-	newUser := &User{
-		Header:     userHeader,
-		Username:   username,
-		Email:      email,
-		Credential: credential,
-		Roles:      make([]string, 0),
-		Scopes:     make([]string, 0),
-	}
+	account.Credential = credential
 
 	/*
 		We finally get to insert our model into MongoDB. Regardless of our previous FindOne call to validate
 		user existence, we still want to check for a write exception and wrap any un-expected errors here
 	*/
-	_, err = serv.Database().Collection("user").InsertOne(context.Background(), newUser)
+	_, err = serv.Database().Collection("user").InsertOne(serv.Context(), account)
 	if err != nil {
 		var writeError mongo.WriteException
 		if errors.As(err, &writeError) {
@@ -143,5 +181,77 @@ func Register(serv *server.Server, config config.CredentialConfig, email string,
 		return fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
 	}
 
+	serv.PublishEvent(events.TypeUserRegistered, map[string]string{
+		"identifier": account.Header.Identifier,
+		"email":      account.Email,
+	})
+
 	return nil
 }
+
+/*
+newUser - Validates the email address and phone number provided in the parameters and constructs the user model that
+gets inserted into MongoDB, without a credential. Nothing is read from or written to the database here
+*/
+func newUser(serv *server.Server, email string, username string, phoneNumber string) (*User, error) {
+	/*
+		Here we want to validate that the email address being used is valid. Eventually, we want to send the user a
+		validation email on account creation, so this must be valid
+	*/
+	if !emailRegex.MatchString(email) {
+		return nil, ErrEmailAddressInvalid
+	}
+
+	/*
+		Uniqueness is always enforced on the canonical form of the email address so that variations of the same
+		mailbox (case, plus addressing, gmail dots) cannot be used to register duplicate accounts. The address the
+		user provided is still stored as-is in the Email field
+	*/
+	canonicalEmail := NormalizeEmail(email, serv.Config.EmailConfig)
+
+	normalizedPhone, err := NormalizePhoneNumber(phoneNumber, serv.Config.PhoneConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	/*
+		Here we are constructing the user model that will get inserted into MongoDB. We need to use make on roles
+		and scopes to ensure that these don't get inserted into MongoDB as null fields. By default, an empty slice
+		is also nil in Go-Lang and this is what will get stored in our Database.
+	*/
+	ret := &User{
+		Header:         header.New(canonicalEmail),
+		Username:       username,
+		Email:          email,
+		CanonicalEmail: canonicalEmail,
+		PhoneNumber:    normalizedPhone,
+		Roles:          make([]string, 0),
+		Scopes:         make([]string, 0),
+	}
+
+	/*
+		Every user starts out with their password as their primary identity, so that the subject claim of their tokens
+		stays their identifier until another identity is made primary
+	*/
+	ret.Identities = []Identity{passwordIdentity(ret, ret.Header.CreatedAt)}
+
+	return ret, nil
+}
+
+/*
+copyProfile - Copies the profile fields that are not validated by newUser from the profile provided in the parameter onto
+the new user: EmailVerified, GivenName, MiddleName, FamilyName, Gender, BirthDate, ZoneInfo, Address, ExternalId and
+Locked
+*/
+func copyProfile(account *User, profile *User) {
+	account.EmailVerified = profile.EmailVerified
+	account.GivenName = profile.GivenName
+	account.MiddleName = profile.MiddleName
+	account.FamilyName = profile.FamilyName
+	account.Gender = profile.Gender
+	account.BirthDate = profile.BirthDate
+	account.ZoneInfo = profile.ZoneInfo
+	account.Address = profile.Address
+	account.ExternalId = profile.ExternalId
+	account.Locked = profile.Locked
+}
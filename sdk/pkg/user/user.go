@@ -1,11 +1,16 @@
 package user
 
 import (
-	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	internalTime "github.com/credstack/credstack/sdk/internal/time"
+	"github.com/credstack/credstack/sdk/pkg/approval/gate"
 	credstackError "github.com/credstack/credstack/sdk/pkg/errors"
+	"github.com/credstack/credstack/sdk/pkg/events"
 	"github.com/credstack/credstack/sdk/pkg/header"
 	"github.com/credstack/credstack/sdk/pkg/server"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -26,6 +31,9 @@ type User struct {
 	// Email - The email for the user. Required at registration and must be unique
 	Email string `json:"email" bson:"email"`
 
+	// CanonicalEmail - The normalized form of Email (see NormalizeEmail). Used for uniqueness checks and lookups
+	CanonicalEmail string `json:"canonical_email" bson:"canonical_email"`
+
 	// EmailVerified - A boolean variable for determining if the user has validated there email address
 	EmailVerified bool `json:"email_verified" bson:"email_verified"`
 
@@ -64,18 +72,108 @@ type User struct {
 
 	// Roles - A string slice containing roles that have been assigned to the user
 	Roles []string `json:"roles" bson:"roles"`
+
+	// Identities - The credentials the user can sign in with, exactly one of which is primary (see Identity). Updated with Link, Unlink and SetPrimaryIdentity
+	Identities []Identity `json:"identities,omitempty" bson:"identities,omitempty"`
+
+	// ExternalId - The identifier of the user in the directory that provisioned them (the SCIM externalId). Empty for users that were not provisioned
+	ExternalId string `json:"external_id,omitempty" bson:"external_id,omitempty"`
+
+	// Locked - If set to true, then the user cannot log in until they are unlocked (see Unlock)
+	Locked bool `json:"locked" bson:"locked"`
+
+	// UserMetadata - Schemaless data that the user can edit themselves, like preferences. Updated with UpdateUserMetadata
+	UserMetadata Metadata `json:"user_metadata,omitempty" bson:"user_metadata,omitempty"`
+
+	// AppMetadata - Schemaless data that can only be edited through the management API, like plans or entitlements. Updated with UpdateAppMetadata
+	AppMetadata Metadata `json:"app_metadata,omitempty" bson:"app_metadata,omitempty"`
+}
+
+/*
+LocalTime - Converts the provided time into the users time zone (ZoneInfo). If the user has not set a time zone, or it
+cannot be loaded, the time is returned in UTC. This should be used whenever timestamps are rendered for the user, like in
+notification emails
+*/
+func (user *User) LocalTime(t time.Time) time.Time {
+	return t.In(internalTime.LoadLocation(user.ZoneInfo))
+}
+
+/*
+Claims - Returns the user's profile as OpenID Connect standard claims (RFC: OpenID Connect Core 1.0 section 5.1). Claims
+that have not been set on the user are omitted. The credential, scopes, and roles are never included
+*/
+func (user *User) Claims() map[string]any {
+	claims := map[string]any{
+		"email_verified":        user.EmailVerified,
+		"phone_number_verified": user.PhoneNumberVerified,
+	}
+
+	optional := map[string]string{
+		"email":              user.Email,
+		"preferred_username": user.Username,
+		"given_name":         user.GivenName,
+		"middle_name":        user.MiddleName,
+		"family_name":        user.FamilyName,
+		"gender":             user.Gender,
+		"birthdate":          user.BirthDate,
+		"zoneinfo":           user.ZoneInfo,
+		"phone_number":       user.PhoneNumber,
+	}
+
+	for name, value := range optional {
+		if value != "" {
+			claims[name] = value
+		}
+	}
+
+	name := strings.Join(slices.DeleteFunc([]string{user.GivenName, user.MiddleName, user.FamilyName}, func(part string) bool {
+		return part == ""
+	}), " ")
+	if name != "" {
+		claims["name"] = name
+	}
+
+	/*
+		OpenID Connect defines address as a JSON object. We only store the address as a single string, so it is
+		returned as the formatted member
+	*/
+	if user.Address != "" {
+		claims["address"] = map[string]string{"formatted": user.Address}
+	}
+
+	return claims
 }
 
 /*
 Get - Fetches a user from the database and returns it's protobuf model for it. If you are fetching a user
 without its credentials, then set withCredentials to false. Projection is used on this field to prevent it from
-leaving the database due to its sensitive information
+leaving the database due to its sensitive information. The email provided is normalized before the lookup, so any
+variation of the address that shares the same canonical form will resolve to the same user
 */
 func Get(serv *server.Server, email string, withCredentials bool) (*User, error) {
 	if email == "" {
 		return nil, ErrUserMissingIdentifier
 	}
 
+	return getUser(serv, bson.M{"canonical_email": NormalizeEmail(email, serv.Config.EmailConfig)}, withCredentials)
+}
+
+/*
+GetByIdentifier - Fetches a user from the database by its header identifier. This is the value used as the sub claim of
+tokens issued on behalf of the user, so this should be used when a user needs to be resolved from a token
+*/
+func GetByIdentifier(serv *server.Server, identifier string, withCredentials bool) (*User, error) {
+	if identifier == "" {
+		return nil, ErrUserMissingIdentifier
+	}
+
+	return getUser(serv, bson.M{"header.identifier": identifier}, withCredentials)
+}
+
+/*
+getUser - Provides the shared lookup logic for Get and GetByIdentifier
+*/
+func getUser(serv *server.Server, filter bson.M, withCredentials bool) (*User, error) {
 	/*
 		We always use projection here to ensure that the credential field does not even
 		leave the database. If it is not needed, then we don't want to even touch it
@@ -90,8 +188,8 @@ func Get(serv *server.Server, email string, withCredentials bool) (*User, error)
 		does not set withCredentials to false
 	*/
 	result := serv.Database().Collection("user").FindOne(
-		context.Background(),
-		bson.M{"email": email},
+		serv.Context(),
+		filter,
 		findOpts,
 	)
 
@@ -130,8 +228,8 @@ func List(serv *server.Server, limit int, withCredentials bool) ([]*User, error)
 		findOpts.SetProjection(bson.M{"credential": 0})
 	}
 
-	result, err := serv.Database().Collection("user").Find(
-		context.Background(),
+	result, err := serv.Database().ReadCollection("user", server.ReadClassList).Find(
+		serv.Context(),
 		bson.M{},
 		findOpts,
 	)
@@ -142,7 +240,7 @@ func List(serv *server.Server, limit int, withCredentials bool) ([]*User, error)
 
 	ret := make([]*User, 0, limit)
 
-	err = result.All(context.Background(), &ret)
+	err = result.All(serv.Context(), &ret)
 	if err != nil {
 		if !errors.Is(err, mongo.ErrNoDocuments) && err != nil {
 			return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
@@ -159,14 +257,22 @@ func List(serv *server.Server, limit int, withCredentials bool) ([]*User, error)
 /*
 Update - Provides functionality for updating a select number of fields of the user model. A valid email address
 must be provided as an argument for this function call. Fields to update can be passed in the patch parameter. The
-following fields can be updated: Username, GivenName, FamilyName, Gender, BirthDate, and Address. If you need to
-update a different field (like email), then use the dedicated functions for this
+following fields can be updated: Username, GivenName, FamilyName, Gender, BirthDate, Address, and PhoneNumber. If you
+need to update a different field (like email), then use the dedicated functions for this
+
+Phone numbers are normalized to E.164 format before they are written, and updating the phone number always resets
+PhoneNumberVerified as the new number has not been verified yet
 */
 func Update(serv *server.Server, email string, patch *User) error {
 	if email == "" {
 		return ErrUserMissingIdentifier
 	}
 
+	normalizedPhone, err := NormalizePhoneNumber(patch.PhoneNumber, serv.Config.PhoneConfig)
+	if err != nil {
+		return err
+	}
+
 	/*
 		buildUserPatch - Provides a sub-function to convert the given userModel into a bson.M struct that can be
 		provided to mongo.UpdateOne. Only specified fields are supported in this function, so not all are included
@@ -199,12 +305,17 @@ func Update(serv *server.Server, email string, patch *User) error {
 			update["address"] = patch.Address
 		}
 
+		if normalizedPhone != "" {
+			update["phone_number"] = normalizedPhone
+			update["phone_number_verified"] = false
+		}
+
 		return update
 	}
 
 	result, err := serv.Database().Collection("user").UpdateOne(
-		context.Background(),
-		bson.M{"email": email},
+		serv.Context(),
+		bson.M{"canonical_email": NormalizeEmail(email, serv.Config.EmailConfig)},
 		bson.M{"$set": buildUserPatch(patch)},
 	)
 
@@ -219,20 +330,118 @@ func Update(serv *server.Server, email string, patch *User) error {
 	return nil
 }
 
+/*
+Replace - Replaces the profile of the user identified by its header identifier with the profile provided in the
+parameter, and returns the updated user without its credential. Unlike Update, every field that can be replaced is
+written, so fields that are empty in the profile are cleared. This is intended for directories that provision users
+(SCIM), which always send the full profile. The following fields are replaced: Username, Email, GivenName, MiddleName,
+FamilyName, PhoneNumber, Address, ZoneInfo, ExternalId and Locked.
+
+Changing the email address or phone number resets whether it was verified. If the new email address is already
+registered to a different user, then ErrUserAlreadyExists is returned
+*/
+func Replace(serv *server.Server, identifier string, profile *User) (*User, error) {
+	if profile.Email == "" || profile.Username == "" {
+		return nil, ErrUserMissingIdentifier
+	}
+
+	if !emailRegex.MatchString(profile.Email) {
+		return nil, ErrEmailAddressInvalid
+	}
+
+	normalizedPhone, err := NormalizePhoneNumber(profile.PhoneNumber, serv.Config.PhoneConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := GetByIdentifier(serv, identifier, false)
+	if err != nil {
+		return nil, err
+	}
+
+	canonicalEmail := NormalizeEmail(profile.Email, serv.Config.EmailConfig)
+
+	update := bson.M{
+		"username":          profile.Username,
+		"email":             profile.Email,
+		"canonical_email":   canonicalEmail,
+		"given_name":        profile.GivenName,
+		"middle_name":       profile.MiddleName,
+		"family_name":       profile.FamilyName,
+		"phone_number":      normalizedPhone,
+		"address":           profile.Address,
+		"zone_info":         profile.ZoneInfo,
+		"external_id":       profile.ExternalId,
+		"locked":            profile.Locked,
+		"header.updated_at": serv.Clock().Now().Unix(),
+	}
+
+	if canonicalEmail != current.CanonicalEmail {
+		update["email_verified"] = false
+	}
+
+	if normalizedPhone != current.PhoneNumber {
+		update["phone_number_verified"] = false
+	}
+
+	var ret User
+
+	err = serv.Database().Collection("user").FindOneAndUpdate(
+		serv.Context(),
+		bson.M{"header.identifier": identifier},
+		bson.M{"$set": update},
+		mongoOpts.FindOneAndUpdate().SetReturnDocument(mongoOpts.After).SetProjection(bson.M{"credential": 0}),
+	).Decode(&ret)
+	if err != nil {
+		/*
+			Duplicate keys are returned from findAndModify as a command error rather than a write exception
+		*/
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrUserAlreadyExists
+		}
+
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserDoesNotExist
+		}
+
+		return nil, fmt.Errorf("%w (%v)", server.ErrInternalDatabase, err)
+	}
+
+	return &ret, nil
+}
+
+func init() {
+	gate.Register(gate.ActionUserDelete, deleteUser)
+}
+
 /*
 Delete - Completely removes a user account from CredStack. A valid email address must be passed
 in this parameter, or it will return ErrUserMissingIdentifier. If the deleted count returned is equal to
 zero, then the function considers the user to not exist. A successful call to this function will return
-nil
+nil. If deleting users requires approval, then gate.ErrApprovalRequired is returned instead, and the user must be
+deleted by approving a user.delete approval
 */
 func Delete(serv *server.Server, email string) error {
+	err := gate.Check(serv, gate.ActionUserDelete)
+	if err != nil {
+		return err
+	}
+
+	return deleteUser(serv, email)
+}
+
+/*
+deleteUser - Provides the logic for Delete without checking for approval. This is what is executed once a user.delete
+approval has been approved
+*/
+func deleteUser(serv *server.Server, email string) error {
 	if email == "" {
 		return ErrUserMissingIdentifier
 	}
 
 	result, err := serv.Database().Collection("user").DeleteOne(
-		context.Background(),
-		bson.M{"email": email},
+		serv.Context(),
+		bson.M{"canonical_email": NormalizeEmail(email, serv.Config.EmailConfig)},
 	)
 
 	if err != nil {
@@ -243,5 +452,7 @@ func Delete(serv *server.Server, email string) error {
 		return ErrUserDoesNotExist
 	}
 
+	serv.PublishEvent(events.TypeUserDeleted, map[string]string{"email": email})
+
 	return nil
 }